@@ -1,603 +1,16 @@
+// Command python-executor is the python-executor CLI (see package cli).
 package main
 
 import (
-	"context"
 	"fmt"
-	"io"
 	"os"
-	"strings"
-	"time"
 
-	"github.com/geraldthewes/python-executor/pkg/client"
-	"github.com/spf13/cobra"
-)
-
-var (
-	// Global flags
-	serverURL string
-	timeout   int
-	memoryMB  int
-	diskMB    int
-	cpuShares int
-	network   bool
-	image     string
-	async     bool
-	quiet     bool
-	verbose   bool
-
-	// run command flags
-	files            []string
-	entrypoint       string
-	requirementsFile string
-	envVars          []string
-
-	// eval command flags
-	pythonVersion string
-	noResult      bool
+	"github.com/geraldthewes/python-executor/pkg/cli"
 )
 
 func main() {
-	rootCmd := NewRootCmd()
-
-	if err := rootCmd.Execute(); err != nil {
+	if err := cli.NewRootCmd().Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
-	}
-}
-
-// NewRootCmd creates and returns the root cobra command.
-// This is exported to allow documentation generation tools to access
-// the command tree without executing the CLI.
-func NewRootCmd() *cobra.Command {
-	rootCmd := &cobra.Command{
-		Use:   "python-executor",
-		Short: "Remote Python code execution CLI",
-		Long: `Execute Python code remotely in isolated containers.
-
-The python-executor CLI provides command-line access to execute Python code
-on a remote server in sandboxed Docker containers.
-
-Environment Variables:
-  PYEXEC_SERVER    Server URL (default: http://localhost:8080)
-
-Documentation:     https://github.com/geraldthewes/python-executor/blob/main/README.md
-Configuration:     https://github.com/geraldthewes/python-executor/blob/main/docs/configuration.md`,
-	}
-
-	// Global flags
-	rootCmd.PersistentFlags().StringVar(&serverURL, "server", getEnv("PYEXEC_SERVER", "http://localhost:8080"), "Server URL (env: PYEXEC_SERVER)")
-	rootCmd.PersistentFlags().IntVar(&timeout, "timeout", 0, "Execution timeout in seconds (0 = server default)")
-	rootCmd.PersistentFlags().IntVar(&memoryMB, "memory", 0, "Memory limit in MB (0 = server default)")
-	rootCmd.PersistentFlags().IntVar(&diskMB, "disk", 0, "Disk limit in MB (0 = server default)")
-	rootCmd.PersistentFlags().IntVar(&cpuShares, "cpu", 0, "CPU shares (0 = server default)")
-	rootCmd.PersistentFlags().BoolVar(&network, "network", false, "Allow network access (required for pip install)")
-	rootCmd.PersistentFlags().StringVar(&image, "image", "", "Docker image to use")
-	rootCmd.PersistentFlags().BoolVar(&async, "async", false, "Submit asynchronously and return execution ID")
-	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Quiet mode: only output stdout on success")
-	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose mode: show execution details")
-
-	// Commands
-	rootCmd.AddCommand(runCmd())
-	rootCmd.AddCommand(submitCmd())
-	rootCmd.AddCommand(followCmd())
-	rootCmd.AddCommand(killCmd())
-	rootCmd.AddCommand(evalCmd())
-	rootCmd.AddCommand(versionCmd())
-
-	return rootCmd
-}
-
-func runCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "run [file|directory|tar] [-- script-args...]",
-		Short: "Execute code synchronously",
-		Long: `Execute Python code and wait for the result.
-
-Input can be provided via:
-  - stdin:     echo 'print("hi")' | python-executor run
-  - file:      python-executor run script.py
-  - directory: python-executor run ./myproject/
-  - tar:       python-executor run code.tar
-
-Arguments after -- are passed to the Python script as sys.argv.
-
-Examples:
-  # Run code from stdin
-  echo 'print("Hello")' | python-executor run
-
-  # Run a Python file
-  python-executor run script.py
-
-  # Run a directory (uses main.py or __main__.py as entrypoint)
-  python-executor run ./myproject/
-
-  # Pass arguments to the script
-  python-executor run script.py -- --verbose input.txt
-
-  # Run with dependencies
-  python-executor run --requirements requirements.txt script.py
-
-  # Forward environment variables
-  python-executor run -e API_KEY -e DEBUG=true script.py`,
-		RunE: runExecution,
-	}
-
-	cmd.Flags().StringSliceVar(&files, "file", nil, "Additional file to include (can be repeated)")
-	cmd.Flags().StringVar(&entrypoint, "entrypoint", "", "Override the entrypoint script (default: auto-detect)")
-	cmd.Flags().StringVar(&requirementsFile, "requirements", "", "Path to requirements.txt (enables network)")
-	cmd.Flags().StringArrayVarP(&envVars, "env", "e", nil, "Environment variable: VAR (from env) or VAR=value")
-
-	return cmd
-}
-
-func submitCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "submit [file|directory|tar] [-- script-args...]",
-		Short: "Submit code asynchronously",
-		Long: `Submit code for execution and return immediately with an execution ID.
-
-Use this for long-running tasks. The execution ID can be used to:
-  - Check status: python-executor follow <id>
-  - Kill:         python-executor kill <id>
-
-Examples:
-  # Submit and get execution ID
-  EXEC_ID=$(python-executor submit long_task.py)
-  echo "Submitted: $EXEC_ID"
-
-  # Later, follow the execution
-  python-executor follow $EXEC_ID`,
-		RunE: submitExecution,
-	}
-
-	cmd.Flags().StringSliceVar(&files, "file", nil, "Additional file to include (can be repeated)")
-	cmd.Flags().StringVar(&entrypoint, "entrypoint", "", "Override the entrypoint script (default: auto-detect)")
-	cmd.Flags().StringVar(&requirementsFile, "requirements", "", "Path to requirements.txt (enables network)")
-	cmd.Flags().StringArrayVarP(&envVars, "env", "e", nil, "Environment variable: VAR (from env) or VAR=value")
-
-	return cmd
-}
-
-func followCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "follow <execution-id>",
-		Short: "Follow an async execution",
-		Long: `Poll an asynchronous execution until complete and display the result.
-
-The command polls the server every 2 seconds until the execution finishes,
-then prints stdout/stderr and exits with the script's exit code.
-
-Example:
-  # Submit and follow
-  EXEC_ID=$(python-executor submit script.py)
-  python-executor follow $EXEC_ID`,
-		Args: cobra.ExactArgs(1),
-		RunE: followExecution,
-	}
-}
-
-func killCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "kill <execution-id>",
-		Short: "Kill a running execution",
-		Long: `Terminate a running execution.
-
-The Docker container running the Python code will be forcefully stopped.
-
-Example:
-  python-executor kill exe_550e8400-e29b-41d4-a716-446655440000`,
-		Args: cobra.ExactArgs(1),
-		RunE: killExecution,
-	}
-}
-
-func evalCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:   "eval [code]",
-		Short: "Evaluate code with REPL-style expression results",
-		Long: `Execute Python code and return the value of the last expression.
-
-This command uses the simplified JSON API with REPL-style evaluation.
-If the last statement is an expression, its value is printed after any
-stdout output.
-
-Input can be provided via:
-  - argument:  python-executor eval '2 + 2'
-  - stdin:     echo '2 + 2' | python-executor eval
-
-Examples:
-  # Simple expression
-  python-executor eval '2 + 2'
-  # Output: 4
-
-  # Multi-line code (use single quotes to preserve newlines)
-  python-executor eval 'x = 5
-  x * 2'
-  # Output: 10
-
-  # Using imports
-  python-executor eval 'import math; math.sqrt(16)'
-  # Output: 4.0
-
-  # From stdin
-  echo 'import sys; sys.version' | python-executor eval
-
-  # Specify Python version
-  python-executor eval --python 3.11 'import sys; sys.version'
-
-  # Disable result output (only show stdout)
-  python-executor eval --no-result 'print("hello"); 42'
-  # Output: hello`,
-		RunE: evalExecution,
-	}
-
-	cmd.Flags().StringVar(&pythonVersion, "python", "", "Python version (3.10, 3.11, 3.12, 3.13)")
-	cmd.Flags().BoolVar(&noResult, "no-result", false, "Disable expression evaluation (just run code)")
-
-	return cmd
-}
-
-func versionCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "version",
-		Short: "Show version information",
-		Long:  `Display the version of the python-executor CLI.`,
-		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Println("python-executor v1.0.0")
-		},
-	}
-}
-
-func runExecution(cmd *cobra.Command, args []string) error {
-	// Separate positional args from script args
-	positionalArgs, scriptArgs := splitArgsAtDash(cmd, args)
-
-	tarData, meta, err := prepareExecution(positionalArgs, scriptArgs)
-	if err != nil {
-		return err
-	}
-
-	c := client.New(serverURL)
-	ctx := context.Background()
-
-	if async {
-		execID, err := c.ExecuteAsync(ctx, tarData, meta)
-		if err != nil {
-			return err
-		}
-		fmt.Println(execID)
-		return nil
-	}
-
-	result, err := c.ExecuteSync(ctx, tarData, meta)
-	if err != nil {
-		return err
-	}
-
-	printResult(result)
-	os.Exit(result.ExitCode)
-	return nil
-}
-
-func submitExecution(cmd *cobra.Command, args []string) error {
-	// Separate positional args from script args
-	positionalArgs, scriptArgs := splitArgsAtDash(cmd, args)
-
-	tarData, meta, err := prepareExecution(positionalArgs, scriptArgs)
-	if err != nil {
-		return err
-	}
-
-	c := client.New(serverURL)
-	ctx := context.Background()
-
-	execID, err := c.ExecuteAsync(ctx, tarData, meta)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(execID)
-	return nil
-}
-
-func followExecution(cmd *cobra.Command, args []string) error {
-	execID := args[0]
-
-	c := client.New(serverURL)
-	ctx := context.Background()
-
-	if !quiet {
-		fmt.Fprintf(os.Stderr, "Following execution %s...\n", execID)
-	}
-
-	result, err := c.WaitForCompletion(ctx, execID, 2*time.Second)
-	if err != nil {
-		return err
-	}
-
-	printResult(result)
-	os.Exit(result.ExitCode)
-	return nil
-}
-
-func killExecution(cmd *cobra.Command, args []string) error {
-	execID := args[0]
-
-	c := client.New(serverURL)
-	ctx := context.Background()
-
-	if err := c.KillExecution(ctx, execID); err != nil {
-		return err
-	}
-
-	if !quiet {
-		fmt.Println("Execution killed")
-	}
-
-	return nil
-}
-
-func evalExecution(cmd *cobra.Command, args []string) error {
-	var code string
-
-	if len(args) >= 1 {
-		code = args[0]
-	} else {
-		// Read from stdin
-		stdinData, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			return fmt.Errorf("reading stdin: %w", err)
-		}
-		if len(stdinData) == 0 {
-			return fmt.Errorf("no input provided: either specify code as an argument or pipe via stdin")
-		}
-		code = string(stdinData)
-	}
-
-	c := client.New(serverURL)
-	ctx := context.Background()
-
-	req := &client.SimpleExecRequest{
-		Code:         code,
-		EvalLastExpr: !noResult,
-	}
-
-	if pythonVersion != "" {
-		req.PythonVersion = pythonVersion
-	}
-
-	if timeout > 0 {
-		req.Config = &client.ExecutionConfig{
-			TimeoutSeconds: timeout,
-		}
-	}
-
-	result, err := c.Eval(ctx, req)
-	if err != nil {
-		return err
-	}
-
-	printEvalResult(result)
-	os.Exit(result.ExitCode)
-	return nil
-}
-
-func printEvalResult(result *client.ExecutionResult) {
-	if quiet {
-		if result.ExitCode == 0 {
-			// In quiet mode, prefer result over stdout for eval
-			if result.Result != nil && *result.Result != "" {
-				fmt.Println(*result.Result)
-			} else if result.Stdout != "" {
-				fmt.Print(result.Stdout)
-			}
-		}
-		return
-	}
-
-	if verbose {
-		fmt.Fprintf(os.Stderr, "Execution ID: %s\n", result.ExecutionID)
-		fmt.Fprintf(os.Stderr, "Status: %s\n", result.Status)
-		if result.DurationMs > 0 {
-			fmt.Fprintf(os.Stderr, "Duration: %dms\n", result.DurationMs)
-		}
-		fmt.Fprintf(os.Stderr, "---\n")
-	}
-
-	// Print stdout first
-	if result.Stdout != "" {
-		fmt.Print(result.Stdout)
-	}
-
-	// Print result (expression value)
-	if result.Result != nil && *result.Result != "" {
-		fmt.Println(*result.Result)
-	}
-
-	// Print stderr
-	if result.Stderr != "" {
-		fmt.Fprint(os.Stderr, result.Stderr)
-	}
-
-	if result.Error != "" {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
-	}
-}
-
-// splitArgsAtDash separates positional args from script args at the -- separator
-func splitArgsAtDash(cmd *cobra.Command, args []string) ([]string, []string) {
-	dashIdx := cmd.ArgsLenAtDash()
-	if dashIdx == -1 {
-		return args, nil
-	}
-	return args[:dashIdx], args[dashIdx:]
-}
-
-// resolveEnvVars processes --env flags, resolving VAR to VAR=value from environment
-func resolveEnvVars(envFlags []string) ([]string, error) {
-	result := make([]string, 0, len(envFlags))
-
-	for _, env := range envFlags {
-		if strings.Contains(env, "=") {
-			// Explicit value: VAR=value
-			result = append(result, env)
-		} else {
-			// Forward from environment: VAR
-			value, exists := os.LookupEnv(env)
-			if !exists {
-				return nil, fmt.Errorf("environment variable %q not set", env)
-			}
-			result = append(result, fmt.Sprintf("%s=%s", env, value))
-		}
-	}
-
-	return result, nil
-}
-
-// prepareExecution creates tar and metadata from inputs
-func prepareExecution(args []string, scriptArgs []string) ([]byte, *client.Metadata, error) {
-	var tarData []byte
-	var err error
-
-	// Priority 1: --file flags
-	if len(files) > 0 {
-		tarData, err = client.TarFromFiles(files)
-		if err != nil {
-			return nil, nil, fmt.Errorf("creating tar from files: %w", err)
-		}
-	} else if len(args) == 1 {
-		// Check what kind of argument it is
-		arg := args[0]
-
-		if strings.HasSuffix(arg, ".tar") {
-			// Priority 2: Explicit tar file
-			tarData, err = os.ReadFile(arg)
-			if err != nil {
-				return nil, nil, fmt.Errorf("reading tar file: %w", err)
-			}
-		} else {
-			info, err := os.Stat(arg)
-			if err != nil {
-				return nil, nil, fmt.Errorf("stat %s: %w", arg, err)
-			}
-
-			if info.IsDir() {
-				// Priority 3: Directory
-				tarData, err = client.TarFromDirectory(arg)
-				if err != nil {
-					return nil, nil, fmt.Errorf("creating tar from directory: %w", err)
-				}
-			} else {
-				// Priority 4: Single file
-				tarData, err = client.TarFromFiles([]string{arg})
-				if err != nil {
-					return nil, nil, fmt.Errorf("creating tar from file: %w", err)
-				}
-			}
-		}
-	} else if len(args) == 0 {
-		// Priority 5: Stdin
-		stdinData, err := io.ReadAll(os.Stdin)
-		if err != nil {
-			return nil, nil, fmt.Errorf("reading stdin: %w", err)
-		}
-
-		// Validate stdin is not empty
-		if len(stdinData) == 0 {
-			return nil, nil, fmt.Errorf("no input provided: either specify a file/directory argument or pipe code via stdin")
-		}
-
-		tarData, err = client.TarFromReader(strings.NewReader(string(stdinData)), "main.py")
-		if err != nil {
-			return nil, nil, fmt.Errorf("creating tar from stdin: %w", err)
-		}
-	} else {
-		return nil, nil, fmt.Errorf("invalid arguments")
-	}
-
-	// Detect entrypoint if not specified
-	if entrypoint == "" {
-		entrypoint, err = client.DetectEntrypoint(tarData)
-		if err != nil {
-			return nil, nil, fmt.Errorf("detecting entrypoint: %w", err)
-		}
-	}
-
-	// Resolve environment variables
-	resolvedEnvVars, err := resolveEnvVars(envVars)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Build metadata
-	meta := &client.Metadata{
-		Entrypoint:  entrypoint,
-		DockerImage: image,
-		EnvVars:     resolvedEnvVars,
-		ScriptArgs:  scriptArgs,
-		Config: &client.ExecutionConfig{
-			TimeoutSeconds:  timeout,
-			NetworkDisabled: !network,
-			MemoryMB:        memoryMB,
-			DiskMB:          diskMB,
-			CPUShares:       cpuShares,
-		},
-	}
-
-	// Read requirements file if specified
-	if requirementsFile != "" {
-		reqData, err := os.ReadFile(requirementsFile)
-		if err != nil {
-			return nil, nil, fmt.Errorf("reading requirements file: %w", err)
-		}
-		meta.RequirementsTxt = string(reqData)
-
-		// Enable network access for pip install
-		if !network {
-			network = true
-			meta.Config.NetworkDisabled = false
-			if !quiet {
-				fmt.Fprintln(os.Stderr, "Network access enabled for package installation")
-			}
-		}
-	}
-
-	return tarData, meta, nil
-}
-
-func printResult(result *client.ExecutionResult) {
-	if quiet {
-		if result.ExitCode == 0 {
-			fmt.Print(result.Stdout)
-		}
-		return
-	}
-
-	if verbose {
-		fmt.Fprintf(os.Stderr, "Execution ID: %s\n", result.ExecutionID)
-		fmt.Fprintf(os.Stderr, "Status: %s\n", result.Status)
-		if result.DurationMs > 0 {
-			fmt.Fprintf(os.Stderr, "Duration: %dms\n", result.DurationMs)
-		}
-		fmt.Fprintf(os.Stderr, "---\n")
-	}
-
-	if result.Stdout != "" {
-		fmt.Print(result.Stdout)
-	}
-
-	if result.Stderr != "" {
-		fmt.Fprint(os.Stderr, result.Stderr)
-	}
-
-	if result.Error != "" {
-		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
-	}
-}
-
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+		os.Exit(cli.ExitCode(err))
 	}
-	return defaultValue
 }
@@ -0,0 +1,70 @@
+// Command runner is a runner agent: it registers with a python-executor
+// control plane started with PYEXEC_EXECUTOR=runners, claims the executions
+// it can run and runs them in this host's Docker.
+package main
+
+import (
+	"context"
+	"errors"
+	"os/signal"
+	"syscall"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/runner"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	cfg := config.Load()
+
+	logger := logrus.New()
+	level, err := logrus.ParseLevel(cfg.Server.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+
+	if cfg.Runners.ServerURL == "" || cfg.Runners.Token == "" {
+		logger.Fatal("PYEXEC_RUNNER_SERVER and PYEXEC_RUNNER_TOKEN are required")
+	}
+
+	exec, err := executor.NewDockerExecutor(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to create executor")
+	}
+	defer exec.Close()
+	host := exec.Host()
+	logger.WithFields(logrus.Fields{"docker_host": host.Host, "source": host.Source}).Info("Using Docker")
+
+	reg := runner.Registration{
+		Name:     cfg.Server.NodeID,
+		Labels:   cfg.Server.NodeLabels,
+		MemoryMB: cfg.Server.NodeMemoryMB,
+		Slots:    cfg.Runners.Slots,
+	}
+	// Heartbeats keep well within the control plane's runner timeout
+	agent, err := runner.NewAgent(cfg.Runners.ServerURL, cfg.Runners.Token, reg, exec, cfg.Runners.Timeout/4, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid runner configuration")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"server": cfg.Runners.ServerURL,
+		"name":   reg.Name,
+		"labels": reg.Labels,
+		"slots":  reg.Slots,
+	}).Info("Starting python-executor runner")
+
+	// Stop claiming on SIGINT or SIGTERM; running executions finish first
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := agent.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		logger.WithError(err).Error("Runner stopped")
+	}
+	logger.Info("Runner exited")
+}
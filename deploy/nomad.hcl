@@ -56,6 +56,9 @@ job "python-executor" {
         PYEXEC_DEFAULT_CPU_SHARES = "1024"
         PYEXEC_DEFAULT_IMAGE   = "python:3.12-slim"
 
+        # Seconds to wait for running executions on shutdown (keep below kill_timeout)
+        PYEXEC_SHUTDOWN_DRAIN  = "60"
+
         # Network mode for execution containers: "host" or "bridge"
         # Default: host (uses host networking, more reliable)
         # Use "bridge" for better isolation (requires proper Docker NAT setup)
@@ -75,8 +78,8 @@ job "python-executor" {
         memory = 512  # MB
       }
 
-      # Graceful shutdown
-      kill_timeout = "30s"
+      # Graceful shutdown: drain period plus time for HTTP shutdown
+      kill_timeout = "90s"
     }
   }
 }
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// loadStatus describes how busy this instance is
+func (s *Server) loadStatus(ctx context.Context) client.LoadStatus {
+	load := client.LoadStatus{
+		Running:        s.running.Load(),
+		OverloadPolicy: config.OverloadQueue,
+		Waiting:        s.waiting.Load(),
+		Rejected:       s.rejected.Load(),
+		Throttled:      s.throttled.Load(),
+	}
+	if s.config != nil {
+		load.MaxWaiting = s.config.Queue.MaxWaiting
+		load.MaxQueueLength = s.config.Queue.MaxLength
+		if s.rejectPolicy() {
+			load.OverloadPolicy = config.OverloadReject
+		}
+	}
+	if s.slots != nil {
+		load.MaxConcurrent = cap(s.slots)
+		load.Saturation = float64(load.Running) / float64(load.MaxConcurrent)
+	}
+
+	queued, err := s.queue.Len(ctx)
+	if err != nil {
+		load.QueueError = err.Error()
+	}
+	load.Queued = queued
+	return load
+}
+
+// storageStats describes the stored executions
+func (s *Server) storageStats(ctx context.Context) client.StorageStats {
+	stats, err := s.storage.Stats(ctx)
+	if err != nil {
+		return client.StorageStats{Error: err.Error()}
+	}
+	return *stats
+}
+
+// GetStatus describes this instance
+// @Summary Get server status
+// @Description Report this instance's node ID, whether it is draining, and
+// @Description its load: running executions against the concurrency limit,
+// @Description sync requests waiting for a slot, queued async executions,
+// @Description submissions rejected as overloaded and requests throttled by
+// @Description quotas. Storage statistics count
+// @Description the stored executions by status, the oldest and their size,
+// @Description and the failures and total duration of the finished ones.
+// @Description It answers while storage is failing, with storage.error set.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} client.ServerStatus "Instance status"
+// @Router /admin/status [get]
+func (s *Server) GetStatus(c *gin.Context) {
+	status := client.ServerStatus{
+		Node:     s.nodeID(),
+		Draining: s.Draining(),
+		InFlight: s.InFlight(),
+		Load:     s.loadStatus(c.Request.Context()),
+		Storage:  s.storageStats(c.Request.Context()),
+	}
+	if s.config != nil {
+		status.Labels = s.config.Server.NodeLabels
+		status.MemoryMB = s.config.Server.NodeMemoryMB
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// metricsWriter writes metrics in the Prometheus text format
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+// metric writes one sample with its HELP and TYPE lines
+func (w *metricsWriter) metric(name, typ, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, typ, name, value)
+}
+
+// labeled writes one sample per label value under a single HELP and TYPE
+func (w *metricsWriter) labeled(name, typ, help, label string, values []string, samples []float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	for i, v := range values {
+		fmt.Fprintf(w, "%s{%s=%q} %g\n", name, label, v, samples[i])
+	}
+}
+
+// executionStatuses lists every status, so each has a sample even at 0
+var executionStatuses = []client.ExecutionStatus{
+	client.StatusAwaitingApproval,
+	client.StatusPending,
+	client.StatusRunning,
+	client.StatusCompleted,
+	client.StatusFailed,
+	client.StatusKilled,
+	client.StatusCancelled,
+}
+
+// boolValue returns 1 for true and 0 for false, as Prometheus expects
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Metrics exposes this instance's load for Prometheus
+// @Summary Prometheus metrics
+// @Description This instance's load and storage statistics in the
+// @Description Prometheus text format.
+// @Tags admin
+// @Produce plain
+// @Success 200 {string} string "Metrics"
+// @Router /metrics [get]
+func (s *Server) Metrics(c *gin.Context) {
+	load := s.loadStatus(c.Request.Context())
+
+	var w metricsWriter
+	w.metric("pyexec_executions_running", "gauge", "Executions running on this instance.", float64(load.Running))
+	w.metric("pyexec_executions_max_concurrent", "gauge", "Most executions this instance runs at once; 0 means no limit.", float64(load.MaxConcurrent))
+	w.metric("pyexec_saturation", "gauge", "Running executions divided by the concurrency limit; 0 without a limit.", load.Saturation)
+	w.metric("pyexec_requests_waiting", "gauge", "Sync requests waiting for a run slot.", float64(load.Waiting))
+	if load.QueueError == "" {
+		w.metric("pyexec_executions_queued", "gauge", "Async executions waiting for a worker.", float64(load.Queued))
+	}
+	w.metric("pyexec_submissions_rejected_total", "counter", "Submissions rejected because the server was at capacity.", float64(load.Rejected))
+	w.metric("pyexec_requests_throttled_total", "counter", "Requests refused because their caller was over its quota.", float64(load.Throttled))
+	w.metric("pyexec_in_flight", "gauge", "Executions and requests this instance is handling.", float64(s.InFlight()))
+	w.metric("pyexec_draining", "gauge", "1 once this instance has stopped accepting executions.", boolValue(s.Draining()))
+
+	if stats := s.storageStats(c.Request.Context()); stats.Error == "" {
+		statuses := make([]string, len(executionStatuses))
+		counts := make([]float64, len(executionStatuses))
+		for i, status := range executionStatuses {
+			statuses[i] = string(status)
+			counts[i] = float64(stats.ByStatus[status])
+		}
+		w.labeled("pyexec_storage_executions", "gauge", "Stored executions by status.", "status", statuses, counts)
+		w.metric("pyexec_storage_bytes", "gauge", "Size of the stored execution records.", float64(stats.Bytes))
+		w.metric("pyexec_storage_executions_finished", "gauge", "Stored executions that started and have finished.", float64(stats.Finished))
+		w.metric("pyexec_storage_executions_failed", "gauge", "Finished stored executions that did not complete with exit code 0.", float64(stats.Failures))
+		w.metric("pyexec_storage_duration_seconds", "gauge", "Total execution time of the finished stored executions.", float64(stats.DurationMs)/1000)
+		if stats.Oldest != nil {
+			w.metric("pyexec_storage_oldest_age_seconds", "gauge", "Age of the oldest stored execution.", time.Since(*stats.Oldest).Seconds())
+		}
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", w.Bytes())
+}
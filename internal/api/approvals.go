@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// approvalReason returns the approval rule a submission matches, or "" if
+// it may run without an admin's approval
+func (s *Server) approvalReason(meta *client.Metadata, tenant string) string {
+	if s.config == nil {
+		return ""
+	}
+	rules := s.config.Approval
+	defaults := s.config.Defaults
+
+	var cfg client.ExecutionConfig
+	if meta.Config != nil {
+		cfg = *meta.Config
+	}
+
+	// Limits left unset run with the server defaults
+	limit := func(value, def int) int {
+		if value == 0 {
+			return def
+		}
+		return value
+	}
+
+	switch {
+	case slices.Contains(rules.Tenants, tenant):
+		return fmt.Sprintf("tenant %s requires approval", tenant)
+	case rules.Network && !cfg.NetworkDisabled && !cfg.InstallNetworkOnly && !defaults.InstallNetworkOnly:
+		return "network access enabled"
+	case rules.MemoryMB > 0 && limit(cfg.MemoryMB, defaults.MemoryMB) > rules.MemoryMB:
+		return fmt.Sprintf("memory_mb above %d", rules.MemoryMB)
+	case rules.CPUShares > 0 && limit(cfg.CPUShares, defaults.CPUShares) > rules.CPUShares:
+		return fmt.Sprintf("cpu_shares above %d", rules.CPUShares)
+	case rules.DiskMB > 0 && limit(cfg.DiskMB, defaults.DiskMB) > rules.DiskMB:
+		return fmt.Sprintf("disk_mb above %d", rules.DiskMB)
+	case rules.TimeoutSeconds > 0 && limit(cfg.TimeoutSeconds, defaults.Timeout) > rules.TimeoutSeconds:
+		return fmt.Sprintf("timeout_seconds above %d", rules.TimeoutSeconds)
+	}
+	return ""
+}
+
+// holdForApproval stores an execution that matched an approval rule and
+// replies with its ID, as /exec/async does. It is queued once an admin
+// approves it.
+func (s *Server) holdForApproval(c *gin.Context, tarData []byte, metadata *client.Metadata, detected []string, reason string) {
+	ctx := c.Request.Context()
+
+	exec := &storage.Execution{
+		ID:             fmt.Sprintf("exe_%s", uuid.New().String()),
+		Status:         client.StatusAwaitingApproval,
+		ApprovalReason: reason,
+		Metadata:       metadata,
+		Detected:       detected,
+		Tenant:         tenantOf(c),
+		APIKeyName:     apiKeyOf(c),
+		Caller:         callerOf(c),
+		TraceID:        traceIDOf(c),
+		Node:           s.nodeID(),
+		CreatedAt:      time.Now(),
+	}
+	if err := s.storage.Create(ctx, exec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution"})
+		return
+	}
+	s.publishEvent(client.EventSubmitted, exec)
+
+	job := &queue.Job{ExecutionID: exec.ID, TarData: tarData, Metadata: metadata}
+	if err := s.queue.Hold(ctx, job); err != nil {
+		s.failExecution(ctx, exec, fmt.Sprintf("holding execution: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hold execution"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, client.AsyncResponse{
+		ExecutionID: exec.ID,
+	})
+}
+
+// ListApprovals lists the executions awaiting approval
+// @Summary List executions awaiting approval
+// @Description List the executions held by the server's approval rules,
+// @Description oldest first, with who submitted them, the rule each matched
+// @Description and the metadata it would run with.
+// @Tags admin
+// @Produce json
+// @Success 200 {object} client.ApprovalList "Executions awaiting approval"
+// @Failure 500 {object} gin.H "Failed to list executions"
+// @Router /admin/approvals [get]
+func (s *Server) ListApprovals(c *gin.Context) {
+	status := client.StatusAwaitingApproval
+	execs, err := s.storage.List(c.Request.Context(), &status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(execs, func(i, j int) bool {
+		return execs[i].CreatedAt.Before(execs[j].CreatedAt)
+	})
+
+	list := client.ApprovalList{Approvals: []client.Approval{}}
+	for _, exec := range execs {
+		list.Approvals = append(list.Approvals, client.Approval{
+			ExecutionID: exec.ID,
+			Tenant:      exec.Tenant,
+			Reason:      exec.ApprovalReason,
+			Metadata:    exec.Metadata,
+			CreatedAt:   exec.CreatedAt.UTC(),
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// ApproveExecution queues an execution that was awaiting approval
+// @Summary Approve an execution
+// @Description Queue an execution held by an approval rule. It then runs
+// @Description like any async execution.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Success 200 {object} client.ExecutionResult "Execution, now pending"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not awaiting approval"
+// @Failure 500 {object} gin.H "Failed to queue execution"
+// @Router /admin/approvals/{id}/approve [post]
+func (s *Server) ApproveExecution(c *gin.Context) {
+	ctx := c.Request.Context()
+	exec, ok := s.awaitingApproval(c)
+	if !ok {
+		return
+	}
+
+	// The status changes first so the worker that claims the job runs it
+	exec.Status = client.StatusPending
+	if err := s.storage.Update(ctx, exec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update execution"})
+		return
+	}
+	if err := s.queue.Approve(ctx, exec.ID); err != nil {
+		if errors.Is(err, queue.ErrNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "execution is not awaiting approval"})
+			return
+		}
+		s.failExecution(ctx, exec, fmt.Sprintf("queueing execution: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue execution"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exec.ToExecutionResult())
+}
+
+// RejectExecution cancels an execution that was awaiting approval
+// @Summary Reject an execution
+// @Description Cancel an execution held by an approval rule without running
+// @Description it. Its termination_reason becomes "rejected" and its error
+// @Description carries the reason given, if any.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Param request body client.RejectRequest false "Why the execution was rejected"
+// @Success 200 {object} client.ExecutionResult "Execution, now cancelled"
+// @Failure 400 {object} gin.H "Invalid JSON"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not awaiting approval"
+// @Failure 500 {object} gin.H "Failed to update execution"
+// @Router /admin/approvals/{id}/reject [post]
+func (s *Server) RejectExecution(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req client.RejectRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+
+	exec, ok := s.awaitingApproval(c)
+	if !ok {
+		return
+	}
+	if err := s.queue.Discard(ctx, exec.ID); err != nil {
+		if errors.Is(err, queue.ErrNotHeld) {
+			c.JSON(http.StatusConflict, gin.H{"error": "execution is not awaiting approval"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	message := "rejected by an admin"
+	if req.Reason != "" {
+		message += ": " + req.Reason
+	}
+	if err := s.cancelExecution(ctx, exec, client.TerminationRejected, message); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNotWaiting) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, exec.ToExecutionResult())
+}
+
+// awaitingApproval returns the execution named in the path, replying with
+// an error if it is not awaiting approval
+func (s *Server) awaitingApproval(c *gin.Context) (*storage.Execution, bool) {
+	exec, err := s.storage.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return nil, false
+	}
+	if exec.Status != client.StatusAwaitingApproval {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("execution is %s, not awaiting approval", exec.Status)})
+		return nil, false
+	}
+	return exec, true
+}
+
+// errNotWaiting is returned by cancelExecution for an execution a worker
+// started, or that finished, before it could be cancelled
+var errNotWaiting = errors.New("execution is no longer waiting to run")
+
+// cancelExecution marks an execution that never ran cancelled, with the
+// error message, if any. A worker may be starting it at the same moment,
+// so it is cancelled only if it is still pending or awaiting approval.
+// exec is updated to the cancelled execution.
+func (s *Server) cancelExecution(ctx context.Context, exec *storage.Execution, reason client.TerminationReason, message string) error {
+	finishedAt := time.Now()
+	cancelled, err := s.storage.Modify(ctx, exec.ID, func(exec *storage.Execution) error {
+		if exec.Status != client.StatusPending && exec.Status != client.StatusAwaitingApproval {
+			return errNotWaiting
+		}
+		exec.Status = client.StatusCancelled
+		exec.Termination = reason
+		exec.FinishedAt = &finishedAt
+		if message != "" {
+			exec.Error = message
+		}
+		return nil
+	})
+	if errors.Is(err, errNotWaiting) {
+		return err
+	}
+	if err != nil {
+		return errors.New("failed to cancel execution")
+	}
+	*exec = *cancelled
+	s.publishEvent(client.EventCompleted, exec)
+	return nil
+}
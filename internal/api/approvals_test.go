@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestApprovalReason(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Defaults.MemoryMB = 1024
+	cfg.Defaults.Timeout = 300
+	cfg.Approval = config.ApprovalConfig{Network: true, MemoryMB: 2048, TimeoutSeconds: 600, Tenants: []string{"interns"}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	offline := client.ExecutionConfig{NetworkDisabled: true}
+	for _, tc := range []struct {
+		cfg    *client.ExecutionConfig
+		tenant string
+		want   string
+	}{
+		{&offline, "default", ""},
+		{&client.ExecutionConfig{InstallNetworkOnly: true}, "default", ""},
+		{nil, "default", "network access enabled"},
+		{&offline, "interns", "tenant interns requires approval"},
+		{&client.ExecutionConfig{NetworkDisabled: true, MemoryMB: 4096}, "default", "memory_mb above 2048"},
+		{&client.ExecutionConfig{NetworkDisabled: true, TimeoutSeconds: 3600}, "default", "timeout_seconds above 600"},
+	} {
+		if got := server.approvalReason(&client.Metadata{Config: tc.cfg}, tc.tenant); got != tc.want {
+			t.Errorf("approvalReason(%+v, %s) = %q, want %q", tc.cfg, tc.tenant, got, tc.want)
+		}
+	}
+
+	// Defaults count when a limit is left unset
+	cfg.Defaults.MemoryMB = 8192
+	if got := server.approvalReason(&client.Metadata{Config: &offline}, "default"); got != "memory_mb above 2048" {
+		t.Errorf("approvalReason() with a large default = %q", got)
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	store := storage.NewMemoryStorage()
+	q := queue.NewMemoryQueue()
+	cfg := &config.Config{}
+	cfg.Approval.Network = true
+	server := NewServer(store, q, fake, cfg)
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.DELETE("/executions/:id", server.KillExecution)
+	router.GET("/admin/approvals", server.ListApprovals)
+	router.POST("/admin/approvals/:id/approve", server.ApproveExecution)
+	router.POST("/admin/approvals/:id/reject", server.RejectExecution)
+	ctx := context.Background()
+
+	// Offline code runs at once; code with network access is held
+	w := sendJSON(router, http.MethodPost, "/eval", `{"code": "print(1)", "config": {"network_disabled": true}}`)
+	if w.Code != http.StatusOK || len(fake.requests) != 1 {
+		t.Fatalf("offline eval = %d %s", w.Code, w.Body.String())
+	}
+	held := make([]string, 3)
+	for i := range held {
+		w = sendJSON(router, http.MethodPost, "/eval", `{"code": "import requests"}`)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("networked eval = %d %s", w.Code, w.Body.String())
+		}
+		var async client.AsyncResponse
+		json.Unmarshal(w.Body.Bytes(), &async)
+		held[i] = async.ExecutionID
+	}
+	if len(fake.requests) != 1 {
+		t.Errorf("held execution ran")
+	}
+	if n, _ := q.Len(ctx); n != 0 {
+		t.Errorf("queue length = %d, want 0", n)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py"}`, []byte("input")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("held exec with a stdin part = %d, want 400", w.Code)
+	}
+
+	w = sendJSON(router, http.MethodGet, "/admin/approvals", "")
+	var list client.ApprovalList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Approvals) != 3 || list.Approvals[0].Reason != "network access enabled" || list.Approvals[0].Tenant != defaultTenant {
+		t.Fatalf("approvals = %+v", list)
+	}
+
+	// Approving queues the execution for a worker
+	w = sendJSON(router, http.MethodPost, "/admin/approvals/"+held[0]+"/approve", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve = %d %s", w.Code, w.Body.String())
+	}
+	job, err := q.Claim(ctx)
+	if err != nil || job.ExecutionID != held[0] {
+		t.Errorf("claimed %+v, %v", job, err)
+	}
+	if exec, _ := store.Get(ctx, held[0]); exec.Status != client.StatusPending {
+		t.Errorf("approved status = %s", exec.Status)
+	}
+	if w := sendJSON(router, http.MethodPost, "/admin/approvals/"+held[0]+"/approve", ""); w.Code != http.StatusConflict {
+		t.Errorf("second approve = %d, want 409", w.Code)
+	}
+
+	w = sendJSON(router, http.MethodPost, "/admin/approvals/"+held[1]+"/reject", `{"reason": "no network for this project"}`)
+	var result client.ExecutionResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Status != client.StatusCancelled || result.TerminationReason != client.TerminationRejected || result.Error != "rejected by an admin: no network for this project" {
+		t.Errorf("reject = %d %s", w.Code, w.Body.String())
+	}
+
+	// Killing a held execution cancels it
+	w = sendJSON(router, http.MethodDelete, "/executions/"+held[2], "")
+	if w.Code != http.StatusOK {
+		t.Errorf("kill = %d %s", w.Code, w.Body.String())
+	}
+	if err := q.Approve(ctx, held[2]); err != queue.ErrNotHeld {
+		t.Errorf("killed execution still held: %v", err)
+	}
+
+	if w := sendJSON(router, http.MethodPost, "/admin/approvals/exe_missing/reject", ""); w.Code != http.StatusNotFound {
+		t.Errorf("reject unknown = %d, want 404", w.Code)
+	}
+}
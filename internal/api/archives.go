@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/geraldthewes/python-executor/internal/upload"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// GetArchive reports whether an archive is cached
+// @Summary Look up a cached archive
+// @Description Check whether the server has an archive with the given SHA-256,
+// @Description from an earlier exec request or completed upload. If it does, run
+// @Description it by putting archive_sha256 in the metadata instead of sending a
+// @Description tar part. Looking an archive up keeps it cached for another
+// @Description PYEXEC_UPLOAD_TTL.
+// @Tags uploads
+// @Produce json
+// @Param sha256 path string true "Hex SHA-256 of the archive as sent"
+// @Success 200 {object} client.Archive "Cached archive"
+// @Failure 404 {object} gin.H "Archive not cached"
+// @Router /archives/{sha256} [get]
+func (s *Server) GetArchive(c *gin.Context) {
+	if !s.cachesArchives() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive cache is not enabled"})
+		return
+	}
+
+	sum := c.Param("sha256")
+	size, err := s.uploads.ArchiveSize(sum)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, upload.ErrArchiveNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, client.Archive{SHA256: sum, Size: size})
+}
+
+// cachesArchives reports whether archives are kept by hash
+func (s *Server) cachesArchives() bool {
+	return s.uploads != nil && s.config != nil && s.config.Upload.CacheArchives
+}
+
+// cachedArchive returns the cached archive with the given hex SHA-256
+func (s *Server) cachedArchive(sum string) ([]byte, error) {
+	if !s.cachesArchives() {
+		return nil, upload.ErrArchiveNotFound
+	}
+	return s.uploads.Archive(sum)
+}
+
+// cacheArchive keeps an archive sent with a request so the client can run
+// it again by hash
+func (s *Server) cacheArchive(data []byte) {
+	if !s.cachesArchives() {
+		return
+	}
+	// The request doesn't depend on the cache, so failures are ignored
+	_, _ = s.uploads.PutArchive(data)
+}
+
+// requestErrorStatus returns the status for an error parsing an exec
+// request. An archive missing from the cache gets 404 so that clients
+// know to send it instead.
+func requestErrorStatus(err error) int {
+	if errors.Is(err, upload.ErrArchiveNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
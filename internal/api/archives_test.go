@@ -0,0 +1,137 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// metadataOnlyRequest builds an exec request with no tar part
+func metadataOnlyRequest(path, metadata string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("metadata", metadata)
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestArchiveCache_ExecuteByHash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	cfg := &config.Config{Upload: config.UploadConfig{Dir: t.TempDir(), CacheArchives: true}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.GET("/archives/:sha256", server.GetArchive)
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(input())"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tarData)
+	sum := hex.EncodeToString(digest[:])
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/archives/"+sum, nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("lookup before exec status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Running an archive caches it
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py"}`, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec status = %d (body %s)", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/archives/"+sum, nil))
+	var archive client.Archive
+	json.Unmarshal(w.Body.Bytes(), &archive)
+	if w.Code != http.StatusOK || archive.SHA256 != sum || archive.Size != int64(len(tarData)) {
+		t.Fatalf("lookup = %d %+v, want %s of %d bytes", w.Code, archive, sum, len(tarData))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+sum+`"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec by hash status = %d (body %s)", w.Code, w.Body.String())
+	}
+	if len(fake.requests) != 2 || !bytes.Equal(fake.requests[1].TarData, tarData) {
+		t.Error("executor did not get the cached archive")
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "unknown hash",
+			req:        metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+strings.Repeat("0", 64)+`"}`),
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "hash and tar",
+			req:        multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+sum+`"}`, nil),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "hash and upload",
+			req:        metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+sum+`","upload_id":"upl_1"}`),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestArchiveCache_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Upload: config.UploadConfig{Dir: t.TempDir()}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.GET("/archives/:sha256", server.GetArchive)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py"}`, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec status = %d (body %s)", w.Code, w.Body.String())
+	}
+	if server.cachesArchives() {
+		t.Fatal("archive cache enabled without CacheArchives")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+strings.Repeat("0", 64)+`"}`))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("exec by hash status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
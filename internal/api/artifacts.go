@@ -0,0 +1,286 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the artifacts holding the full log of an output stream that was
+// cut to the inline limit
+const (
+	stdoutLog = "stdout.log"
+	stderrLog = "stderr.log"
+	outputLog = "output.log"
+)
+
+// outputArchive names the artifact holding the files a pipeline step wrote
+// to /work/output, as a tar archive
+const outputArchive = "output.tar"
+
+// validateArtifacts checks a request's output directory, if any
+func validateArtifacts(cfg *client.ExecutionConfig) error {
+	if cfg == nil || cfg.OutputDir == "" {
+		return nil
+	}
+	if !cfg.CollectArtifacts {
+		return fmt.Errorf("config.output_dir requires config.collect_artifacts")
+	}
+	dir := cfg.OutputDir
+	if !path.IsAbs(dir) {
+		dir = path.Join("/work", dir)
+	}
+	if dir = path.Clean(dir); dir == "/" || dir == "/work" {
+		return fmt.Errorf("config.output_dir must be a directory other than / and /work")
+	}
+	return nil
+}
+
+// artifactURL returns the path an artifact is downloaded from
+func artifactURL(execID, name string) string {
+	return fmt.Sprintf("/api/v1/executions/%s/artifacts/%s", execID, name)
+}
+
+// ListArtifacts lists an execution's artifacts
+// @Summary List artifacts
+// @Description List an execution's artifacts, each with its name, content
+// @Description type, size and the url to download it from, without their
+// @Description contents: images, coverage reports, spilled logs and the files
+// @Description collected from the output directory with
+// @Description config.collect_artifacts.
+// @Tags execution
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Success 200 {object} client.ArtifactList "Artifacts"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Router /executions/{id}/artifacts [get]
+func (s *Server) ListArtifacts(c *gin.Context) {
+	exec, err := s.storage.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	list := client.ArtifactList{Artifacts: []client.Artifact{}}
+	for _, a := range exec.Artifacts {
+		a.Data = nil
+		a.URL = artifactURL(exec.ID, a.Name)
+		list.Artifacts = append(list.Artifacts, a)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetArtifact serves one of an execution's artifacts
+// @Summary Download an artifact
+// @Description Return an artifact's contents with its content type, as an
+// @Description attachment: browsers download it rather than render it.
+// @Description Artifacts listed with a url, such as logs spilled because they
+// @Description exceeded the inline limit, must be fetched here. Supports HTTP
+// @Description Range requests.
+// @Tags execution
+// @Produce octet-stream
+// @Param id path string true "Execution ID"
+// @Param name path string true "Artifact name, e.g. stdout.log"
+// @Param Range header string false "Byte range, e.g. bytes=1048576-"
+// @Success 200 {file} file "Artifact contents"
+// @Success 206 {file} file "Requested range"
+// @Failure 404 {object} gin.H "Execution or artifact not found"
+// @Failure 503 {object} gin.H "Storage unavailable"
+// @Router /executions/{id}/artifacts/{name} [get]
+func (s *Server) GetArtifact(c *gin.Context) {
+	exec, err := s.storage.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	// Image names may contain slashes, so the route uses a wildcard
+	name := strings.TrimPrefix(c.Param("name"), "/")
+	for _, a := range exec.Artifacts {
+		if a.Name != name {
+			continue
+		}
+
+		data := a.Data
+		if data == nil {
+			data, err = s.storage.GetArtifact(c.Request.Context(), exec.ID, a.Name)
+			if errors.Is(err, storage.ErrArtifactNotFound) {
+				break
+			}
+			if err != nil {
+				s.executionLookupFailed(c, err)
+				return
+			}
+		}
+
+		var modTime time.Time
+		if exec.FinishedAt != nil {
+			modTime = *exec.FinishedAt
+		}
+		// The content type is the script's to choose, so the artifact is
+		// never rendered as a page of this server's origin
+		c.Header("Content-Type", a.ContentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(a.Name)}))
+		c.Header("X-Content-Type-Options", "nosniff")
+		http.ServeContent(c.Writer, c.Request, "", modTime, bytes.NewReader(data))
+		return
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+}
+
+// storeArtifacts stores the contents of the artifacts downloaded by URL
+// apart from the execution's record, which keeps only their metadata: a
+// record must fit in a single value of the storage backend. An artifact
+// whose contents can't be stored is left out.
+func (s *Server) storeArtifacts(ctx context.Context, exec *storage.Execution) {
+	var kept []client.Artifact
+	for _, a := range exec.Artifacts {
+		if a.URL != "" && a.Data != nil {
+			if err := s.storage.PutArtifact(ctx, exec.ID, a.Name, a.Data); err != nil {
+				continue
+			}
+			a.Data = nil
+		}
+		kept = append(kept, a)
+	}
+	exec.Artifacts = kept
+}
+
+// inlineOutputLimit returns the most bytes of each output stream returned
+// inline, 0 meaning no limit
+func (s *Server) inlineOutputLimit() int {
+	if s.config == nil {
+		return 0
+	}
+	return s.config.Server.MaxInlineOutput
+}
+
+// spillLogs cuts Stdout, Stderr and Output down to limit bytes, keeping
+// their head and tail, and stores each full log as an artifact downloaded
+// from the artifacts endpoint. The line times of a cut log, or of any log
+// whose times alone are over limit, are moved to an artifact too. Nothing
+// is cut if limit is 0.
+func spillLogs(exec *storage.Execution, limit int) {
+	if limit <= 0 {
+		return
+	}
+	exec.StdoutTimes = spillTimes(exec, stdoutLog, exec.StdoutTimes, len(exec.Stdout) > limit, limit)
+	exec.StderrTimes = spillTimes(exec, stderrLog, exec.StderrTimes, len(exec.Stderr) > limit, limit)
+	exec.Stdout = spillLog(exec, stdoutLog, exec.Stdout, limit)
+	exec.Stderr = spillLog(exec, stderrLog, exec.Stderr, limit)
+	exec.Output = spillLog(exec, outputLog, exec.Output, limit)
+}
+
+// timesArtifact names the artifact holding the line times of a spilled log
+func timesArtifact(name string) string {
+	return strings.TrimSuffix(name, ".log") + ".times.json"
+}
+
+// spillTimes returns the line times of the named log to keep in the
+// record: none if they were recorded as an artifact, because the log was
+// cut or they take more than limit bytes themselves
+func spillTimes(exec *storage.Execution, name string, times []time.Time, cut bool, limit int) []time.Time {
+	if len(times) == 0 {
+		return times
+	}
+	data, err := json.Marshal(times)
+	if err != nil || !cut && len(data) <= limit {
+		return times
+	}
+
+	exec.Artifacts = append(exec.Artifacts, client.Artifact{
+		Name:        timesArtifact(name),
+		ContentType: "application/json",
+		Size:        int64(len(data)),
+		Data:        data,
+		URL:         artifactURL(exec.ID, timesArtifact(name)),
+	})
+	return nil
+}
+
+// spillLog returns output cut to limit, recording the full output as the
+// named artifact if it was longer
+func spillLog(exec *storage.Execution, name, output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+
+	exec.Artifacts = append(exec.Artifacts, client.Artifact{
+		Name:        name,
+		ContentType: "text/plain; charset=utf-8",
+		Size:        int64(len(output)),
+		Data:        []byte(output),
+		URL:         artifactURL(exec.ID, name),
+	})
+	return truncateLog(output, name, limit)
+}
+
+// truncateLog keeps about limit bytes of output, half from the start and
+// half from the end, with a note naming the artifact with the full log in
+// between. Cuts fall on UTF-8 character boundaries.
+func truncateLog(output, name string, limit int) string {
+	head := limit / 2
+	for head > 0 && !utf8.RuneStart(output[head]) {
+		head--
+	}
+	tail := len(output) - (limit - limit/2)
+	for tail < len(output) && !utf8.RuneStart(output[tail]) {
+		tail++
+	}
+
+	return fmt.Sprintf("%s\n... [%d bytes omitted; full log in artifact %s] ...\n%s", output[:head], tail-head, name, output[tail:])
+}
+
+// fullTimes returns the line times of an output stream: the spilled
+// artifact if they were moved to one, else those in the record
+func (s *Server) fullTimes(ctx context.Context, exec *storage.Execution, name string, times []time.Time) []time.Time {
+	data, ok := s.artifactData(ctx, exec, timesArtifact(name))
+	if !ok {
+		return times
+	}
+	var full []time.Time
+	if err := json.Unmarshal(data, &full); err != nil {
+		return times
+	}
+	return full
+}
+
+// fullLog returns the complete text of an output stream: the spilled
+// artifact if the stream was cut, else the inline text. The inline text
+// stands in for a spilled log that can't be read.
+func (s *Server) fullLog(ctx context.Context, exec *storage.Execution, name, inline string) string {
+	if data, ok := s.artifactData(ctx, exec, name); ok {
+		return string(data)
+	}
+	return inline
+}
+
+// artifactData returns the contents of an artifact downloaded by URL, if
+// the execution has it and they can be read
+func (s *Server) artifactData(ctx context.Context, exec *storage.Execution, name string) ([]byte, bool) {
+	for _, a := range exec.Artifacts {
+		if a.Name != name || a.URL == "" {
+			continue
+		}
+		if a.Data != nil {
+			return a.Data, true
+		}
+		if data, err := s.storage.GetArtifact(ctx, exec.ID, name); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,253 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSpillLogs(t *testing.T) {
+	exec := &storage.Execution{
+		ID:     "exe_1",
+		Stdout: strings.Repeat("a", 50) + strings.Repeat("b", 50),
+		Stderr: "short\n",
+	}
+
+	spillLogs(exec, 20)
+
+	if !strings.HasPrefix(exec.Stdout, strings.Repeat("a", 10)+"\n") || !strings.HasSuffix(exec.Stdout, "\n"+strings.Repeat("b", 10)) {
+		t.Errorf("stdout should keep 10 bytes of head and tail, got %q", exec.Stdout)
+	}
+	if !strings.Contains(exec.Stdout, "80 bytes omitted") || !strings.Contains(exec.Stdout, stdoutLog) {
+		t.Errorf("stdout should name the omitted bytes and the artifact, got %q", exec.Stdout)
+	}
+	if exec.Stderr != "short\n" {
+		t.Errorf("stderr under the limit should be unchanged, got %q", exec.Stderr)
+	}
+
+	if len(exec.Artifacts) != 1 {
+		t.Fatalf("got %d artifacts, want 1", len(exec.Artifacts))
+	}
+	a := exec.Artifacts[0]
+	if a.Name != stdoutLog || a.Size != 100 || a.URL != "/api/v1/executions/exe_1/artifacts/stdout.log" {
+		t.Errorf("artifact = %+v", a)
+	}
+	if got := (&Server{}).fullLog(context.Background(), exec, stdoutLog, exec.Stdout); len(got) != 100 {
+		t.Errorf("fullLog() returned %d bytes, want 100", len(got))
+	}
+
+	// The result lists the artifact without its data
+	result := exec.ToExecutionResult()
+	if len(result.Artifacts) != 1 || result.Artifacts[0].Data != nil || result.Artifacts[0].URL == "" {
+		t.Errorf("result artifacts = %+v", result.Artifacts)
+	}
+	if exec.Artifacts[0].Data == nil {
+		t.Error("stored artifact lost its data")
+	}
+}
+
+func TestSpillLogs_Times(t *testing.T) {
+	start := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	lineTimes := func(n int) []time.Time {
+		times := make([]time.Time, n)
+		for i := range times {
+			times[i] = start.Add(time.Duration(i) * time.Second)
+		}
+		return times
+	}
+	exec := &storage.Execution{
+		ID:          "exe_1",
+		Stdout:      strings.Repeat("line\n", 40),
+		StdoutTimes: lineTimes(40),
+		Stderr:      "a\nb\nc\n",
+		StderrTimes: lineTimes(3),
+	}
+
+	// stdout is cut, so its times go with it. stderr isn't, but its times
+	// alone are over the limit.
+	spillLogs(exec, 60)
+	if exec.StdoutTimes != nil || exec.StderrTimes != nil {
+		t.Errorf("times kept in the record: %d stdout, %d stderr", len(exec.StdoutTimes), len(exec.StderrTimes))
+	}
+	var names []string
+	for _, a := range exec.Artifacts {
+		names = append(names, a.Name)
+	}
+	if want := "stdout.times.json,stderr.times.json,stdout.log"; strings.Join(names, ",") != want {
+		t.Errorf("artifacts = %v, want %s", names, want)
+	}
+	server := &Server{}
+	if got := server.fullTimes(context.Background(), exec, stdoutLog, nil); len(got) != 40 || !got[39].Equal(start.Add(39*time.Second)) {
+		t.Errorf("fullTimes() = %d times, want the 40 recorded", len(got))
+	}
+
+	// Times of short logs stay in the record
+	exec = &storage.Execution{ID: "exe_2", Stdout: "a\n", StdoutTimes: lineTimes(1)}
+	spillLogs(exec, 60)
+	if len(exec.StdoutTimes) != 1 || exec.Artifacts != nil {
+		t.Errorf("short log's times spilled: %+v", exec)
+	}
+}
+
+func TestSpillLogs_NoLimit(t *testing.T) {
+	exec := &storage.Execution{Stdout: strings.Repeat("x", 1000)}
+	spillLogs(exec, 0)
+	if len(exec.Stdout) != 1000 || exec.Artifacts != nil {
+		t.Error("a zero limit should leave output alone")
+	}
+}
+
+func TestTruncateLog_KeepsUTF8(t *testing.T) {
+	output := strings.Repeat("é", 20) // 2 bytes each
+	got := truncateLog(output, stdoutLog, 7)
+	if !utf8.ValidString(got) {
+		t.Errorf("truncateLog() split a character: %q", got)
+	}
+}
+
+func TestGetArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	exec := &storage.Execution{
+		ID:     "exe_1",
+		Status: client.StatusCompleted,
+		Stdout: strings.Repeat("0123456789", 10),
+		Artifacts: []client.Artifact{
+			{Name: "plots/figure_1.png", ContentType: "image/png", Size: 3, Data: []byte("png")},
+		},
+	}
+	spillLogs(exec, 20)
+	memStorage.Create(context.Background(), exec)
+	server.storeArtifacts(context.Background(), exec)
+	memStorage.Update(context.Background(), exec)
+
+	// The record keeps the spilled log's metadata, not its contents
+	stored, _ := memStorage.Get(context.Background(), "exe_1")
+	if len(stored.Artifacts) != 2 || stored.Artifacts[1].Name != stdoutLog || stored.Artifacts[1].Data != nil {
+		t.Fatalf("stored artifacts = %+v", stored.Artifacts)
+	}
+
+	router := gin.New()
+	router.GET("/executions/:id/stdout", server.GetStdout)
+	router.GET("/executions/:id/artifacts/*name", server.GetArtifact)
+
+	tests := []struct {
+		name            string
+		path            string
+		wantStatus      int
+		wantBody        string
+		wantContentType string
+	}{
+		{name: "spilled log", path: "/executions/exe_1/artifacts/stdout.log", wantStatus: http.StatusOK, wantBody: strings.Repeat("0123456789", 10), wantContentType: "text/plain; charset=utf-8"},
+		{name: "nested image", path: "/executions/exe_1/artifacts/plots/figure_1.png", wantStatus: http.StatusOK, wantBody: "png", wantContentType: "image/png"},
+		{name: "stdout endpoint serves the full log", path: "/executions/exe_1/stdout", wantStatus: http.StatusOK, wantBody: strings.Repeat("0123456789", 10)},
+		{name: "unknown artifact", path: "/executions/exe_1/artifacts/missing.txt", wantStatus: http.StatusNotFound},
+		{name: "unknown execution", path: "/executions/exe_2/artifacts/stdout.log", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantContentType != "" && w.Header().Get("Content-Type") != tt.wantContentType {
+				t.Errorf("content type = %q, want %q", w.Header().Get("Content-Type"), tt.wantContentType)
+			}
+			if tt.wantContentType != "" && (!strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") || w.Header().Get("X-Content-Type-Options") != "nosniff") {
+				t.Errorf("headers = %v, want an attachment that isn't sniffed", w.Header())
+			}
+		})
+	}
+}
+
+func TestListArtifacts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusCompleted}
+	server.recordResult(exec, &executor.ExecutionOutput{
+		Artifacts: []client.Artifact{{Name: "figure_1.png", ContentType: "image/png", Size: 3, Data: []byte("png")}},
+		Files:     []client.Artifact{{Name: "output/results.csv", ContentType: "text/csv", Size: 4, Data: []byte("a,b\n")}},
+	}, nil)
+	memStorage.Create(context.Background(), exec)
+	server.storeArtifacts(context.Background(), exec)
+	memStorage.Update(context.Background(), exec)
+
+	// Collected files are downloaded by URL rather than returned inline
+	result := exec.ToExecutionResult()
+	if len(result.Artifacts) != 2 || result.Artifacts[1].Data != nil || result.Artifacts[1].URL != "/api/v1/executions/exe_1/artifacts/output/results.csv" {
+		t.Errorf("result artifacts = %+v", result.Artifacts)
+	}
+
+	router := gin.New()
+	router.GET("/executions/:id/artifacts", server.ListArtifacts)
+	router.GET("/executions/:id/artifacts/*name", server.GetArtifact)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions/exe_1/artifacts", nil))
+	var list client.ArtifactList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if w.Code != http.StatusOK || len(list.Artifacts) != 2 {
+		t.Fatalf("list = %d %s", w.Code, w.Body)
+	}
+	for _, a := range list.Artifacts {
+		if a.Data != nil || a.URL != "/api/v1/executions/exe_1/artifacts/"+a.Name {
+			t.Errorf("listed artifact = %+v, want a URL and no data", a)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions/exe_1/artifacts/output/results.csv", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "a,b\n" {
+		t.Errorf("download = %d %q", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions/exe_2/artifacts", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown execution status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestValidateArtifacts(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *client.ExecutionConfig
+		wantErr bool
+	}{
+		{name: "no config", cfg: nil},
+		{name: "default directory", cfg: &client.ExecutionConfig{CollectArtifacts: true}},
+		{name: "relative directory", cfg: &client.ExecutionConfig{CollectArtifacts: true, OutputDir: "results"}},
+		{name: "absolute directory", cfg: &client.ExecutionConfig{CollectArtifacts: true, OutputDir: "/tmp/results"}},
+		{name: "directory without collecting", cfg: &client.ExecutionConfig{OutputDir: "results"}, wantErr: true},
+		{name: "root", cfg: &client.ExecutionConfig{CollectArtifacts: true, OutputDir: "/"}, wantErr: true},
+		{name: "work", cfg: &client.ExecutionConfig{CollectArtifacts: true, OutputDir: "./"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateArtifacts(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateArtifacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the API key a request authenticates with. The key
+// may be sent as an Authorization bearer token instead, or as a Jupyter
+// "token" for the kernel gateway.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyContextKey holds the API key Authenticate matched for a request
+const apiKeyContextKey = "api_key"
+
+// SetAPIKeys makes the server require one of keys on every API request
+// except health checks, metrics, runner calls and progress reports, which
+// have their own tokens. No keys leave the API open.
+func (s *Server) SetAPIKeys(keys []config.APIKey) error {
+	if len(keys) == 0 {
+		s.apiKeys = nil
+		return nil
+	}
+	byHash := make(map[[32]byte]config.APIKey, len(keys))
+	names := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if names[k.Name] {
+			return fmt.Errorf("API key name %s is used twice", k.Name)
+		}
+		names[k.Name] = true
+		hash := sha256.Sum256([]byte(k.Key))
+		if other, ok := byHash[hash]; ok {
+			return fmt.Errorf("API keys %s and %s are the same key", other.Name, k.Name)
+		}
+		byHash[hash] = k
+	}
+	s.apiKeys = byHash
+	return nil
+}
+
+// requestAPIKey returns the key a request carries, if any
+func requestAPIKey(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	auth := c.GetHeader("Authorization")
+	if key, ok := strings.CutPrefix(auth, "Bearer "); ok {
+		return key
+	}
+	key, _ := strings.CutPrefix(auth, "token ")
+	return key
+}
+
+// Authenticate refuses requests without a valid API key with 401, if the
+// server has keys. Keys are looked up by their hash, so comparing them
+// takes the same time whatever the key.
+func (s *Server) Authenticate(c *gin.Context) {
+	if s.apiKeys == nil {
+		c.Next()
+		return
+	}
+	key := requestAPIKey(c)
+	if key == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("missing API key: send it in the %s header", APIKeyHeader)})
+		return
+	}
+	k, ok := s.apiKeys[sha256.Sum256([]byte(key))]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key"})
+		return
+	}
+	c.Set(apiKeyContextKey, k)
+	c.Next()
+}
+
+// RequireScope returns a middleware that refuses requests whose API key
+// lacks scope with 403. It follows Authenticate, and lets every request
+// through if the server has no keys.
+func (s *Server) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.apiKeys == nil {
+			c.Next()
+			return
+		}
+		k, _ := c.Value(apiKeyContextKey).(config.APIKey)
+		if !k.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API key %s does not have the %s scope", k.Name, scope)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// callerOf returns who a request is accounted to for its quotas (see
+// quotaCaller)
+func callerOf(c *gin.Context) string {
+	caller, _ := quotaCaller(c)
+	return caller
+}
+
+// apiKeyOf returns the name of the API key a request authenticated with,
+// or "" if the server has no keys
+func apiKeyOf(c *gin.Context) string {
+	k, _ := c.Value(apiKeyContextKey).(config.APIKey)
+	return k.Name
+}
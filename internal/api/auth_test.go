@@ -0,0 +1,113 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{Stdout: "1\n"}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+	if err := server.SetAPIKeys([]config.APIKey{
+		{Name: "reader", Key: "read-key"},
+		{Name: "ci", Key: "run-key", Scopes: []string{config.ScopeRun}},
+		{Name: "ops", Key: "admin-key", Scopes: []string{config.ScopeAdmin}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	ts := httptest.NewServer(SetupRouter(server, logger))
+	defer ts.Close()
+
+	do := func(method, path string, header http.Header, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		req.Header = header
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	key := func(name, value string) http.Header {
+		h := http.Header{}
+		h.Set(name, value)
+		return h
+	}
+	eval := `{"code": "print(1)"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		body   string
+		want   int
+	}{
+		{"health is open", "GET", "/health", http.Header{}, "", http.StatusOK},
+		{"no key", "GET", "/api/v1/executions/exe_1", http.Header{}, "", http.StatusUnauthorized},
+		{"wrong key", "GET", "/api/v1/executions/exe_1", key(APIKeyHeader, "nope"), "", http.StatusUnauthorized},
+		{"any key reads", "GET", "/api/v1/executions/exe_1", key(APIKeyHeader, "read-key"), "", http.StatusNotFound},
+		{"run needs the scope", "POST", "/api/v1/eval", key(APIKeyHeader, "read-key"), eval, http.StatusForbidden},
+		{"run", "POST", "/api/v1/eval", key("Authorization", "Bearer run-key"), eval, http.StatusOK},
+		{"kill needs the scope", "DELETE", "/api/v1/executions/exe_1", key(APIKeyHeader, "run-key"), "", http.StatusForbidden},
+		{"admin implies kill", "DELETE", "/api/v1/executions/exe_1", key(APIKeyHeader, "admin-key"), "", http.StatusNotFound},
+		{"admin needs the scope", "GET", "/api/v1/usage", key(APIKeyHeader, "run-key"), "", http.StatusForbidden},
+		{"admin", "GET", "/api/v1/admin/status", key(APIKeyHeader, "admin-key"), "", http.StatusOK},
+		{"jupyter token", "GET", "/api/kernelspecs", key("Authorization", "token read-key"), "", http.StatusOK},
+		{"jupyter without a key", "GET", "/api/kernels", http.Header{}, "", http.StatusUnauthorized},
+		{"progress has its own token", "POST", "/api/v1/executions/exe_1/progress", http.Header{}, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(tt.method, tt.path, tt.header, tt.body); got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	// Executions carry the name of the key they were submitted with
+	if len(fake.requests) != 1 || fake.requests[0].APIKeyName != "ci" {
+		t.Errorf("requests = %+v, want one submitted with the ci key", fake.requests)
+	}
+}
+
+func TestSetAPIKeys(t *testing.T) {
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+	if err := server.SetAPIKeys([]config.APIKey{{Name: "a", Key: "k"}, {Name: "a", Key: "k2"}}); err == nil {
+		t.Error("SetAPIKeys() with a name used twice = nil error")
+	}
+	if err := server.SetAPIKeys([]config.APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}); err == nil {
+		t.Error("SetAPIKeys() with a key used twice = nil error")
+	}
+
+	// Without keys the API is open
+	if err := server.SetAPIKeys(nil); err != nil || server.apiKeys != nil {
+		t.Errorf("SetAPIKeys(nil) = %v, keys %v", err, server.apiKeys)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("DELETE", "/api/v1/executions/exe_1", nil)
+	server.Authenticate(c)
+	server.RequireScope(config.ScopeAdmin)(c)
+	if c.IsAborted() {
+		t.Error("request aborted without keys configured")
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// errStorageUnavailable is the error of requests refused while storage is
+// failing
+const errStorageUnavailable = "storage is unavailable, retry later"
+
+// RequireStorage refuses requests with 503 while the storage backend's
+// circuit breaker is open, rather than letting each one wait on calls that
+// are bound to fail
+func (s *Server) RequireStorage(c *gin.Context) {
+	if wait, down := storage.Unavailable(s.storage); down {
+		rejectUnavailable(c, wait)
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// executionLookupFailed replies to a failed lookup of the execution named in
+// the path: 503 if storage stopped answering, otherwise 404
+func (s *Server) executionLookupFailed(c *gin.Context, err error) {
+	if errors.Is(err, storage.ErrUnavailable) {
+		wait, _ := storage.Unavailable(s.storage)
+		rejectUnavailable(c, wait)
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
+}
+
+// rejectUnavailable writes a 503 response telling the caller to retry once
+// storage is tried again
+func rejectUnavailable(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": errStorageUnavailable})
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// failingStorage is a storage whose circuit breaker is open
+type failingStorage struct {
+	*storage.MemoryStorage
+	open bool
+}
+
+func (f *failingStorage) Get(ctx context.Context, id string) (*storage.Execution, error) {
+	return nil, fmt.Errorf("getting key: %w", storage.ErrUnavailable)
+}
+
+func (f *failingStorage) Unavailable() (time.Duration, bool) {
+	return 10 * time.Second, f.open
+}
+
+func TestRequireStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &failingStorage{MemoryStorage: storage.NewMemoryStorage()}
+	server := NewServer(store, queue.NewMemoryQueue(), &fakeExecutor{}, nil)
+	router := gin.New()
+	router.GET("/executions/:id", server.RequireStorage, server.GetExecution)
+
+	// A lookup that fails because storage is unavailable isn't a 404
+	w := sendJSON(router, http.MethodGet, "/executions/exe_1", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("get = %d %s, want 503", w.Code, w.Body.String())
+	}
+
+	store.open = true
+	w = sendJSON(router, http.MethodGet, "/executions/exe_1", "")
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "10" {
+		t.Errorf("get with the breaker open = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestGetStatus_StorageUnavailable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := &failingStorage{MemoryStorage: storage.NewMemoryStorage(), open: true}
+	server := NewServer(store, queue.NewMemoryQueue(), &fakeExecutor{}, nil)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	router := SetupRouter(server, logger)
+
+	// Operators can still see the instance while storage is failing
+	if w := sendJSON(router, http.MethodGet, "/api/v1/admin/status", ""); w.Code != http.StatusOK {
+		t.Errorf("status = %d %s, want 200", w.Code, w.Body.String())
+	}
+	if w := sendJSON(router, http.MethodGet, "/api/v1/executions/exe_1", ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("get = %d, want 503", w.Code)
+	}
+}
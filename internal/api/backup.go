@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// GetBackup exports the execution store
+// @Summary Back up the execution store
+// @Description Download every stored execution and template as a
+// @Description gzip-compressed JSON archive, which POST /admin/restore loads
+// @Description into a server with any storage backend.
+// @Tags admin
+// @Produce application/gzip
+// @Success 200 {file} file "Backup archive"
+// @Failure 500 {object} gin.H "Failed to read the store"
+// @Router /admin/backup [get]
+func (s *Server) GetBackup(c *gin.Context) {
+	// The archive is built before anything is written, so a failure can
+	// still be reported as an error
+	var buf bytes.Buffer
+	if err := storage.Export(c.Request.Context(), s.storage, &buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("python-executor-backup-%s.json.gz", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Data(http.StatusOK, "application/gzip", buf.Bytes())
+}
+
+// RestoreBackup imports a backup into the execution store
+// @Summary Restore the execution store
+// @Description Load a backup from GET /admin/backup, compressed or not.
+// @Description Executions and templates the server already has are skipped
+// @Description unless overwrite is true. Executions that had not finished
+// @Description are restored as failed.
+// @Tags admin
+// @Accept application/gzip
+// @Produce json
+// @Param overwrite query bool false "Replace executions and templates the server already has"
+// @Success 200 {object} client.RestoreResult "What was restored"
+// @Failure 400 {object} gin.H "Invalid backup"
+// @Failure 500 {object} gin.H "Failed to store an execution or template"
+// @Router /admin/restore [post]
+func (s *Server) RestoreBackup(c *gin.Context) {
+	overwrite, _ := strconv.ParseBool(c.Query("overwrite"))
+
+	result, err := storage.Import(c.Request.Context(), s.storage, c.Request.Body, overwrite)
+	if errors.Is(err, storage.ErrInvalidBackup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		// Whatever was restored before the failure stays restored
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "restored": result})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
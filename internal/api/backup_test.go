@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBackupRestore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	src := storage.NewMemoryStorage()
+	src.Create(ctx, &storage.Execution{ID: "exe_1", Status: client.StatusCompleted, CreatedAt: time.Now()})
+	router := gin.New()
+	router.GET("/admin/backup", NewServer(src, queue.NewMemoryQueue(), &fakeExecutor{}, nil).GetBackup)
+
+	w := sendJSON(router, http.MethodGet, "/admin/backup", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("backup = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive := w.Body.Bytes()
+
+	dst := storage.NewMemoryStorage()
+	router = gin.New()
+	router.POST("/admin/restore", NewServer(dst, queue.NewMemoryQueue(), &fakeExecutor{}, nil).RestoreBackup)
+
+	restore := func(body []byte, query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/restore"+query, bytes.NewReader(body)))
+		return w
+	}
+
+	w = restore(archive, "")
+	var result client.RestoreResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Executions != 1 {
+		t.Fatalf("restore = %d %s", w.Code, w.Body.String())
+	}
+	if exec, err := dst.Get(ctx, "exe_1"); err != nil || exec.Status != client.StatusCompleted {
+		t.Errorf("restored execution = %+v, %v", exec, err)
+	}
+
+	w = restore(archive, "?overwrite=false")
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Executions != 0 || result.Skipped != 1 {
+		t.Errorf("second restore = %s", w.Body.String())
+	}
+
+	if w := restore([]byte("junk"), ""); w.Code != http.StatusBadRequest {
+		t.Errorf("restore of junk = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// parseCoverageReport reads the totals from the Cobertura XML report
+// written by `coverage xml`
+func parseCoverageReport(data []byte) (*client.CoverageReport, error) {
+	var root struct {
+		LineRate     float64 `xml:"line-rate,attr"`
+		LinesCovered int     `xml:"lines-covered,attr"`
+		LinesValid   int     `xml:"lines-valid,attr"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing coverage report: %w", err)
+	}
+
+	percent := root.LineRate * 100
+	if root.LinesValid > 0 {
+		percent = float64(root.LinesCovered) * 100 / float64(root.LinesValid)
+	}
+
+	return &client.CoverageReport{
+		Percent:      math.Round(percent*100) / 100,
+		LinesCovered: root.LinesCovered,
+		LinesValid:   root.LinesValid,
+	}, nil
+}
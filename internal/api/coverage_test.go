@@ -0,0 +1,38 @@
+package api
+
+import "testing"
+
+func TestParseCoverageReport(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want float64
+	}{
+		{
+			name: "line counts",
+			xml:  `<?xml version="1.0" ?><coverage version="7.4.0" line-rate="0.6667" branch-rate="0" lines-covered="2" lines-valid="3"><packages/></coverage>`,
+			want: 66.67,
+		},
+		{
+			name: "rate only",
+			xml:  `<coverage line-rate="0.5"></coverage>`,
+			want: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := parseCoverageReport([]byte(tt.xml))
+			if err != nil {
+				t.Fatalf("parseCoverageReport() error = %v", err)
+			}
+			if report.Percent != tt.want {
+				t.Errorf("Percent = %v, want %v", report.Percent, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseCoverageReport([]byte("<coverage")); err == nil {
+		t.Error("expected an error for a malformed report")
+	}
+}
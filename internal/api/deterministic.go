@@ -0,0 +1,24 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// validateDeterministic checks a request's seed and fake clock, if any
+func validateDeterministic(cfg *client.ExecutionConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.Seed != 0 && !cfg.Deterministic {
+		return fmt.Errorf("config.seed requires config.deterministic")
+	}
+	if cfg.FakeTime != "" {
+		if _, err := time.Parse(time.RFC3339, cfg.FakeTime); err != nil {
+			return fmt.Errorf("config.fake_time must be an RFC 3339 time, e.g. 2024-01-01T00:00:00Z")
+		}
+	}
+	return nil
+}
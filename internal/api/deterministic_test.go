@@ -0,0 +1,30 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestValidateDeterministic(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *client.ExecutionConfig
+		wantErr bool
+	}{
+		{name: "no config"},
+		{name: "deterministic", cfg: &client.ExecutionConfig{Deterministic: true}},
+		{name: "seed", cfg: &client.ExecutionConfig{Deterministic: true, Seed: 42}},
+		{name: "seed alone", cfg: &client.ExecutionConfig{Seed: 42}, wantErr: true},
+		{name: "fake time", cfg: &client.ExecutionConfig{FakeTime: "2024-01-01T00:00:00+01:00"}},
+		{name: "fake time without zone", cfg: &client.ExecutionConfig{FakeTime: "2024-01-01 00:00:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDeterministic(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateDeterministic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
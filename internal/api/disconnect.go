@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// syncHold is what a sync request holds while its execution runs: its
+// in-flight registration and, once admitted, a run slot. An execution
+// detached from its request takes the hold over.
+type syncHold struct {
+	s        *Server
+	slot     bool
+	detached bool
+}
+
+// holdSync registers a sync request as in flight. It returns false once the
+// server has started draining.
+func (s *Server) holdSync() (*syncHold, bool) {
+	if !s.acquire() {
+		return nil, false
+	}
+	return &syncHold{s: s}, true
+}
+
+// release gives back what the request holds, unless its execution was
+// detached and frees it when it finishes
+func (h *syncHold) release() {
+	if !h.detached {
+		h.free()
+	}
+}
+
+// free gives back the in-flight registration and run slot
+func (h *syncHold) free() {
+	if h.slot {
+		h.s.releaseSlot()
+	}
+	h.s.release()
+}
+
+// detachOnDisconnect reports whether the executions of sync callers that
+// disconnect run on, rather than being killed
+func (s *Server) detachOnDisconnect() bool {
+	return s.config != nil && s.config.Server.SyncDisconnect == config.DisconnectDetach
+}
+
+// syncDetachAfter returns how long a sync execution may run before the
+// caller is answered with 202; 0 means it never is
+func (s *Server) syncDetachAfter() time.Duration {
+	if s.config == nil {
+		return 0
+	}
+	return s.config.Server.SyncDetachAfter
+}
+
+// runSync runs a sync execution and replies with its result. The execution
+// runs on a context that is not cancelled with the request: under the kill
+// policy it is cancelled when the caller disconnects, which kills the
+// execution's container, and under detach the execution runs on with its
+// result stored as for an async one.
+//
+// If the execution is still running after the server's detach threshold,
+// the caller is answered 202 with its ID and it runs on, freeing hold when
+// it finishes. Executions streaming a stdin part read it from the request,
+// so they are never detached.
+func (s *Server) runSync(c *gin.Context, hold *syncHold, exec *storage.Execution, req *executor.ExecutionRequest) {
+	reqCtx := c.Request.Context()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(reqCtx))
+	var disconnected atomic.Bool
+	stopWatch := func() bool { return true }
+	if !s.detachOnDisconnect() {
+		stopWatch = context.AfterFunc(reqCtx, func() {
+			disconnected.Store(true)
+			cancel()
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		s.runWithRetries(ctx, exec, req)
+		stopWatch()
+		if disconnected.Load() {
+			markDisconnected(exec)
+		}
+		s.finishExecution(context.WithoutCancel(ctx), exec)
+	}()
+
+	var detach <-chan time.Time
+	if after := s.syncDetachAfter(); after > 0 && req.Stdin == nil {
+		timer := time.NewTimer(after)
+		defer timer.Stop()
+		detach = timer.C
+	}
+
+	select {
+	case <-done:
+		c.JSON(http.StatusOK, exec.ToExecutionResult())
+	case <-detach:
+		// The request ends with this reply, which must not kill the
+		// execution
+		stopWatch()
+		hold.detached = true
+		go func() {
+			<-done
+			hold.free()
+		}()
+		c.JSON(http.StatusAccepted, client.AsyncResponse{ExecutionID: exec.ID})
+	}
+}
+
+// markDisconnected records that an execution was killed because its sync
+// caller went away. Executions that finished on their own are left alone.
+func markDisconnected(exec *storage.Execution) {
+	if exec.Status != client.StatusFailed {
+		return
+	}
+	exec.Status = client.StatusKilled
+	exec.Termination = client.TerminationDisconnected
+	exec.Error = "killed because the caller disconnected"
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// disconnectExecutor runs until it is released or its context ends, which
+// it reports like the Docker executor does
+type disconnectExecutor struct {
+	fakeExecutor
+	started  chan string
+	released chan struct{}
+}
+
+func (f *disconnectExecutor) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	f.fakeExecutor.Execute(ctx, req)
+	f.started <- req.ID
+
+	select {
+	case <-f.released:
+		return &executor.ExecutionOutput{Stdout: "done\n"}, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w after 5m0s", executor.ErrTimeout)
+	}
+}
+
+// evalAndDisconnect posts to /eval and cancels the request once the
+// execution has started, returning the execution's ID
+func evalAndDisconnect(t *testing.T, router *gin.Engine, fake *disconnectExecutor) string {
+	t.Helper()
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "print('done')"})
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	go router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var id string
+	select {
+	case id = <-fake.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("execution never started")
+	}
+	cancel()
+	return id
+}
+
+func TestSyncDisconnect_Kill(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &disconnectExecutor{started: make(chan string, 1), released: make(chan struct{})}
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	id := evalAndDisconnect(t, router, fake)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exec, err := store.Get(context.Background(), id)
+		if err == nil && exec.Status.IsTerminal() {
+			if exec.Status != client.StatusKilled || exec.Termination != client.TerminationDisconnected {
+				t.Errorf("status = %s (%s), want killed (disconnected)", exec.Status, exec.Termination)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("execution was not killed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncDisconnect_Detach(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &disconnectExecutor{started: make(chan string, 1), released: make(chan struct{})}
+	store := storage.NewMemoryStorage()
+	cfg := &config.Config{}
+	cfg.Server.SyncDisconnect = config.DisconnectDetach
+	server := NewServer(store, queue.NewMemoryQueue(), fake, cfg)
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	id := evalAndDisconnect(t, router, fake)
+
+	// The execution runs on after the caller has gone
+	time.Sleep(20 * time.Millisecond)
+	if exec, _ := store.Get(context.Background(), id); exec.Status != client.StatusRunning {
+		t.Fatalf("status after disconnect = %s, want running", exec.Status)
+	}
+	close(fake.released)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exec, _ := store.Get(context.Background(), id)
+		if exec.Status.IsTerminal() {
+			if exec.Status != client.StatusCompleted || exec.Stdout != "done\n" {
+				t.Errorf("execution = %s with stdout %q, want completed with its output", exec.Status, exec.Stdout)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("detached execution never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSyncDetachAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &disconnectExecutor{started: make(chan string, 1), released: make(chan struct{})}
+	store := storage.NewMemoryStorage()
+	cfg := &config.Config{}
+	cfg.Queue.MaxConcurrent = 1
+	cfg.Server.SyncDetachAfter = 20 * time.Millisecond
+	server := NewServer(store, queue.NewMemoryQueue(), fake, cfg)
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "print('done')"})
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	var resp client.AsyncResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.ExecutionID != <-fake.started {
+		t.Errorf("execution_id = %q, want the running execution's", resp.ExecutionID)
+	}
+
+	// The request ending doesn't kill the detached execution, which keeps
+	// its slot until it finishes
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	if server.InFlight() != 1 || server.running.Load() != 1 {
+		t.Errorf("in flight = %d, running = %d after detaching, want 1 and 1", server.InFlight(), server.running.Load())
+	}
+	close(fake.released)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		exec, _ := store.Get(context.Background(), resp.ExecutionID)
+		if exec.Status.IsTerminal() && server.InFlight() == 0 {
+			if exec.Status != client.StatusCompleted || exec.Stdout != "done\n" {
+				t.Errorf("execution = %s with stdout %q, want completed with its output", exec.Status, exec.Stdout)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("detached execution never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := server.running.Load(); got != 0 {
+		t.Errorf("running = %d after finishing, want 0", got)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// validateDiskIO checks a request's block I/O limits, if any
+func (s *Server) validateDiskIO(cfg *client.ExecutionConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.BlkioWeight != 0 && (cfg.BlkioWeight < 10 || cfg.BlkioWeight > 1000) {
+		return fmt.Errorf("config.blkio_weight must be between 10 and 1000")
+	}
+	if cfg.DiskReadBps < 0 || cfg.DiskWriteBps < 0 {
+		return fmt.Errorf("config.disk_read_bps and config.disk_write_bps must not be negative")
+	}
+	// Runner agents have devices of their own
+	if (cfg.DiskReadBps > 0 || cfg.DiskWriteBps > 0) && s.runners == nil && len(s.config.Docker.BlkioDevices) == 0 {
+		return fmt.Errorf("config.disk_read_bps and config.disk_write_bps require the server's block devices (PYEXEC_BLKIO_DEVICES)")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestValidateDiskIO(t *testing.T) {
+	cfg := &config.Config{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	tests := []struct {
+		name    string
+		devices []string
+		cfg     *client.ExecutionConfig
+		wantErr bool
+	}{
+		{name: "no config"},
+		{name: "weight", cfg: &client.ExecutionConfig{BlkioWeight: 100}},
+		{name: "weight too low", cfg: &client.ExecutionConfig{BlkioWeight: 5}, wantErr: true},
+		{name: "weight too high", cfg: &client.ExecutionConfig{BlkioWeight: 1001}, wantErr: true},
+		{name: "rates", devices: []string{"/dev/sda"}, cfg: &client.ExecutionConfig{DiskReadBps: 10 << 20, DiskWriteBps: 5 << 20}},
+		{name: "negative rate", devices: []string{"/dev/sda"}, cfg: &client.ExecutionConfig{DiskWriteBps: -1}, wantErr: true},
+		{name: "rates without devices", cfg: &client.ExecutionConfig{DiskReadBps: 10 << 20}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Docker.BlkioDevices = tt.devices
+			if err := server.validateDiskIO(tt.cfg); (err != nil) != tt.wantErr {
+				t.Errorf("validateDiskIO() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
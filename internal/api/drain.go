@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errDraining is returned to clients submitting work during shutdown
+const errDraining = "server is shutting down; not accepting new executions"
+
+// acquire registers a new in-flight execution. It returns false once the
+// server has started draining, in which case the caller must reject the work.
+func (s *Server) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.inflight++
+	return true
+}
+
+// release marks an in-flight execution as finished
+func (s *Server) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inflight--
+	if s.inflight == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+}
+
+// Draining reports whether the server has stopped accepting new executions
+func (s *Server) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Drain stops accepting new executions and waits for in-flight ones to
+// finish or for ctx to expire. Executions still running when ctx expires keep
+// their running state and container, so RecoverExecutions can pick them up
+// after a restart.
+func (s *Server) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	if s.inflight == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.drained == nil {
+		s.drained = make(chan struct{})
+	}
+	drained := s.drained
+	s.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// InFlight returns the number of executions currently being handled
+func (s *Server) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inflight
+}
+
+// rejectDraining writes a 503 response for work submitted during shutdown
+func rejectDraining(c *gin.Context) {
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": errDraining})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/geraldthewes/python-executor/internal/egress"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// SetEgressProxy makes executions send their network traffic through
+// proxy, which execution containers reach at proxyURL, within their
+// bandwidth limit
+func (s *Server) SetEgressProxy(proxy *egress.Proxy, proxyURL *url.URL) {
+	s.egress = proxy
+	s.egressURL = proxyURL
+}
+
+// validateBandwidth checks a request's bandwidth limit, if any, against
+// the server's
+func (s *Server) validateBandwidth(cfg *client.ExecutionConfig) error {
+	if cfg == nil || cfg.BandwidthKbps == 0 {
+		return nil
+	}
+	if cfg.BandwidthKbps < 0 {
+		return fmt.Errorf("config.bandwidth_kbps must not be negative")
+	}
+	if s.egress == nil {
+		return fmt.Errorf("config.bandwidth_kbps requires the server's egress proxy (PYEXEC_EGRESS_PROXY_ADDR)")
+	}
+	if limit := s.config.Egress.Kbps; limit > 0 && cfg.BandwidthKbps > limit {
+		return fmt.Errorf("config.bandwidth_kbps must be at most %d", limit)
+	}
+	return nil
+}
+
+// bandwidthKbps returns the bandwidth limit of an execution: its own, or
+// else the server's
+func (s *Server) bandwidthKbps(exec *storage.Execution) int {
+	if exec.Metadata != nil && exec.Metadata.Config != nil && exec.Metadata.Config.BandwidthKbps > 0 {
+		return exec.Metadata.Config.BandwidthKbps
+	}
+	return s.config.Egress.Kbps
+}
+
+// egressEnv registers an execution with the egress proxy, if there is
+// one, and returns the environment variables that send its HTTP(S)
+// traffic through it. release must be called once the execution's run
+// is over.
+func (s *Server) egressEnv(exec *storage.Execution) (env []string, release func()) {
+	if s.egress == nil {
+		return nil, func() {}
+	}
+
+	proxyURL, release := s.egress.Register(exec.ID, s.bandwidthKbps(exec), s.egressURL)
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		env = append(env, name+"="+proxyURL)
+	}
+	env = append(env, "NO_PROXY=localhost,127.0.0.1", "no_proxy=localhost,127.0.0.1")
+	return env, release
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/egress"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEgressProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	cfg := &config.Config{}
+	cfg.Egress.Kbps = 10000
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+	eval := func(kbps int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)", Config: &client.ExecutionConfig{BandwidthKbps: kbps}})
+		req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A limit needs the proxy
+	if w := eval(1000); w.Code != http.StatusBadRequest {
+		t.Errorf("without a proxy: status = %d, want 400", w.Code)
+	}
+
+	proxyURL, _ := url.Parse("http://127.0.0.1:3128")
+	server.SetEgressProxy(egress.NewProxy(), proxyURL)
+	if w := eval(20000); w.Code != http.StatusBadRequest {
+		t.Errorf("above the server's limit: status = %d, want 400", w.Code)
+	}
+	if w := eval(-1); w.Code != http.StatusBadRequest {
+		t.Errorf("negative limit: status = %d, want 400", w.Code)
+	}
+
+	if w := eval(1000); w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", w.Code, w.Body.String())
+	}
+	var proxy string
+	for _, kv := range fake.requests[0].Env {
+		if v, ok := strings.CutPrefix(kv, "HTTPS_PROXY="); ok {
+			proxy = v
+		}
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host != "127.0.0.1:3128" || u.User.Username() != fake.requests[0].ID {
+		t.Errorf("HTTPS_PROXY = %q, want the proxy with the execution's credentials", proxy)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/events"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// SetEventPublisher makes the server publish execution lifecycle events
+// through p
+func (s *Server) SetEventPublisher(p *events.Publisher) {
+	s.events = p
+}
+
+// publishEvent publishes a lifecycle event of exec, if events are enabled
+func (s *Server) publishEvent(typ client.EventType, exec *storage.Execution) {
+	if s.events == nil {
+		return
+	}
+
+	ev := &client.ExecutionEvent{
+		Type:        typ,
+		ExecutionID: exec.ID,
+		Node:        s.nodeID(),
+		Time:        time.Now().UTC(),
+		Status:      exec.Status,
+	}
+	if exec.Metadata != nil {
+		ev.GroupID = exec.Metadata.GroupID
+	}
+	if typ == client.EventCompleted {
+		ev.Summary = &client.EventSummary{
+			ExitCode:          exec.ExitCode,
+			DurationMs:        exec.DurationMs,
+			Error:             exec.Error,
+			ErrorType:         exec.ErrorType,
+			TerminationReason: exec.Termination,
+		}
+		if len(exec.Attempts) > 0 {
+			ev.Summary.Attempts = len(exec.Attempts) + 1
+		}
+	}
+	s.events.Publish(ev)
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/events"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// eventSink records the events a publisher delivers
+type eventSink struct {
+	mu     sync.Mutex
+	events []*client.ExecutionEvent
+}
+
+func (e *eventSink) Send(ctx context.Context, ev *client.ExecutionEvent) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, ev)
+	return nil
+}
+
+func (e *eventSink) Close() error { return nil }
+
+func TestExecuteEval_PublishesEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{ExitCode: 3, Stderr: "boom"}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+	sink := &eventSink{}
+	publisher := events.NewPublisher([]events.Sink{sink}, 10, nil)
+	server.SetEventPublisher(publisher)
+
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "raise SystemExit(3)", GroupID: "batch"})
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var result client.ExecutionResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+
+	// Close waits for the queued events to be delivered
+	publisher.Close(context.Background())
+
+	want := []struct {
+		typ    client.EventType
+		status client.ExecutionStatus
+	}{
+		{client.EventSubmitted, client.StatusPending},
+		{client.EventStarted, client.StatusRunning},
+		{client.EventCompleted, client.StatusCompleted},
+	}
+	if len(sink.events) != len(want) {
+		t.Fatalf("published %d events, want %d", len(sink.events), len(want))
+	}
+	for i, ev := range sink.events {
+		if ev.Type != want[i].typ || ev.Status != want[i].status || ev.ExecutionID != result.ExecutionID || ev.GroupID != "batch" {
+			t.Errorf("event %d = %+v, want %s with status %s", i, ev, want[i].typ, want[i].status)
+		}
+	}
+	if summary := sink.events[2].Summary; summary == nil || summary.ExitCode != 3 {
+		t.Errorf("completed summary = %+v, want exit code 3", summary)
+	}
+	if sink.events[0].Summary != nil {
+		t.Errorf("submitted event has a summary")
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of GET /executions
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// listCursor is where a page of executions ended: the creation time and ID
+// of its last execution, in the newest-first order of storage.Search
+type listCursor struct {
+	createdAt time.Time
+	id        string
+}
+
+// encodeListCursor returns the opaque cursor of the page ending with exec
+func encodeListCursor(exec *storage.Execution) string {
+	raw := strconv.FormatInt(exec.CreatedAt.UnixNano(), 10) + "/" + exec.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeListCursor parses a cursor made by encodeListCursor
+func decodeListCursor(cursor string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), "/")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &listCursor{createdAt: time.Unix(0, n), id: id}, nil
+}
+
+// precedes reports whether exec was listed at or before the cursor
+func (cur *listCursor) precedes(exec *storage.Execution) bool {
+	if !exec.CreatedAt.Equal(cur.createdAt) {
+		return exec.CreatedAt.After(cur.createdAt)
+	}
+	return exec.ID <= cur.id
+}
+
+// listStatuses are the statuses GET /executions may filter by
+var listStatuses = map[client.ExecutionStatus]bool{
+	client.StatusAwaitingApproval: true,
+	client.StatusPending:          true,
+	client.StatusRunning:          true,
+	client.StatusCompleted:        true,
+	client.StatusFailed:           true,
+	client.StatusKilled:           true,
+	client.StatusCancelled:        true,
+}
+
+// parseListQuery builds the storage query of a GET /executions request
+// from its status, label, since, until and q parameters
+func parseListQuery(c *gin.Context) (*storage.Query, error) {
+	q := &storage.Query{Text: c.Query("q")}
+
+	for _, value := range c.QueryArray("status") {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if status == "" {
+				continue
+			}
+			if !listStatuses[client.ExecutionStatus(status)] {
+				return nil, fmt.Errorf("unknown status %q", status)
+			}
+			q.Statuses = append(q.Statuses, client.ExecutionStatus(status))
+		}
+	}
+
+	for _, label := range c.QueryArray("label") {
+		key, value, ok := strings.Cut(label, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q: use key=value", label)
+		}
+		if q.Labels == nil {
+			q.Labels = make(map[string]string)
+		}
+		q.Labels[key] = value
+	}
+
+	for _, bound := range []struct {
+		name string
+		t    *time.Time
+	}{
+		{"since", &q.Since},
+		{"until", &q.Until},
+	} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: use an RFC 3339 time, e.g. 2024-01-15T10:30:00Z", bound.name, value)
+		}
+		*bound.t = t
+	}
+	return q, nil
+}
+
+// parseListLimit parses the page size of a GET /executions request
+func parseListLimit(value string) (int, error) {
+	if value == "" {
+		return defaultListLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		return 0, fmt.Errorf("invalid limit %q: use 1 to %d", value, maxListLimit)
+	}
+	return limit, nil
+}
+
+// executionListResponse is a client.ExecutionList whose executions may be
+// cut down to the fields a request selected
+type executionListResponse struct {
+	client.ExecutionList
+	Executions []any `json:"executions"`
+}
+
+// ListExecutions lists stored executions, newest first
+// @Summary List executions
+// @Description List the stored executions matching every filter given, newest
+// @Description first, a page at a time. Pass a response's next_cursor as cursor
+// @Description to fetch the following page; it is omitted on the last one.
+// @Description fields selects the result fields returned for each execution,
+// @Description as for GET /executions/{id}. Their stdout, stderr and output
+// @Description are left out unless include=output, or fields, names them.
+// @Tags execution
+// @Produce json
+// @Param status query string false "Comma-separated statuses to match, e.g. running,pending"
+// @Param label query string false "Label the executions must have, key=value (can be repeated)"
+// @Param since query string false "Only executions created at or after this RFC 3339 time"
+// @Param until query string false "Only executions created before this RFC 3339 time"
+// @Param q query string false "Text the entrypoint or error must contain, ignoring case"
+// @Param limit query int false "Most executions to return, 1 to 1000" default(50)
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param fields query string false "Comma-separated result fields to return for each execution, e.g. execution_id,status,exit_code"
+// @Param include query string false "output to return each execution's stdout, stderr and output"
+// @Success 200 {object} client.ExecutionList "A page of executions"
+// @Failure 400 {object} gin.H "Invalid filter, limit, cursor, field or include"
+// @Failure 500 {object} gin.H "Failed to list executions"
+// @Router /executions [get]
+func (s *Server) ListExecutions(c *gin.Context) {
+	q, err := parseListQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := parseListLimit(c.Query("limit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var cursor *listCursor
+	if raw := c.Query("cursor"); raw != "" {
+		if cursor, err = decodeListCursor(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	withOutput, err := parseListInclude(c.Query("include"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	withOutput = withOutput || slices.ContainsFunc(fields, isOutputField)
+
+	execs, err := s.storage.Search(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list executions"})
+		return
+	}
+
+	// Skip what earlier pages returned. Executions created since then sort
+	// before the cursor, so pages neither repeat nor miss any.
+	start := 0
+	if cursor != nil {
+		for start < len(execs) && cursor.precedes(execs[start]) {
+			start++
+		}
+	}
+	page := execs[start:]
+
+	list := executionListResponse{Executions: make([]any, 0, min(len(page), limit))}
+	if len(page) > limit {
+		page = page[:limit]
+		list.NextCursor = encodeListCursor(page[limit-1])
+	}
+	for _, exec := range page {
+		result := exec.ToExecutionResult()
+		if !withOutput {
+			result.Stdout, result.Stderr, result.Output = "", "", ""
+		}
+		if fields == nil {
+			list.Executions = append(list.Executions, result)
+			continue
+		}
+		selected, err := selectFields(result, fields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list.Executions = append(list.Executions, selected)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// parseListInclude parses the include parameter of a listing, reporting
+// whether it asks for output
+func parseListInclude(raw string) (bool, error) {
+	output := false
+	for _, inc := range strings.Split(raw, ",") {
+		switch inc = strings.TrimSpace(inc); inc {
+		case "":
+		case "output":
+			output = true
+		default:
+			return false, fmt.Errorf("unknown include %q: use output", inc)
+		}
+	}
+	return output, nil
+}
+
+// isOutputField reports whether a result field is one of the logs that
+// listings leave out unless asked
+func isOutputField(field string) bool {
+	return field == "stdout" || field == "stderr" || field == "output"
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestListExecutions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMemoryStorage()
+	server := &Server{storage: store}
+	router := gin.New()
+	router.GET("/executions", server.ListExecutions)
+
+	created := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, exec := range []*storage.Execution{
+		{ID: "exe_1", Status: client.StatusCompleted, Stdout: "trained\n", Metadata: &client.Metadata{Entrypoint: "train.py", Labels: map[string]string{"team": "ml"}}},
+		{ID: "exe_2", Status: client.StatusFailed, Error: "image not found", Metadata: &client.Metadata{Entrypoint: "main.py"}},
+		{ID: "exe_3", Status: client.StatusRunning, Metadata: &client.Metadata{Entrypoint: "train.py", Labels: map[string]string{"team": "ml"}}},
+		{ID: "exe_4", Status: client.StatusCompleted, Metadata: &client.Metadata{Entrypoint: "main.py"}},
+	} {
+		exec.CreatedAt = created.Add(time.Duration(i) * time.Minute)
+		if err := store.Create(context.Background(), exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(t *testing.T, query url.Values) ([]string, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions?"+query.Encode(), nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body.String())
+		}
+		var resp client.ExecutionList
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, r := range resp.Executions {
+			ids = append(ids, r.ExecutionID)
+		}
+		return ids, resp.NextCursor
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{"all, newest first", nil, []string{"exe_4", "exe_3", "exe_2", "exe_1"}},
+		{"statuses", url.Values{"status": {"failed,running"}}, []string{"exe_3", "exe_2"}},
+		{"label", url.Values{"label": {"team=ml"}}, []string{"exe_3", "exe_1"}},
+		{"time range", url.Values{"since": {"2026-01-15T10:01:00Z"}, "until": {"2026-01-15T10:03:00Z"}}, []string{"exe_3", "exe_2"}},
+		{"text", url.Values{"q": {"NOT FOUND"}}, []string{"exe_2"}},
+		{"combined", url.Values{"status": {"completed"}, "q": {"train"}}, []string{"exe_1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, cursor := list(t, tt.query)
+			if !slices.Equal(ids, tt.want) || cursor != "" {
+				t.Errorf("executions = %v, cursor %q; want %v and no cursor", ids, cursor, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		ids, cursor := list(t, url.Values{"limit": {"3"}})
+		if !slices.Equal(ids, []string{"exe_4", "exe_3", "exe_2"}) || cursor == "" {
+			t.Fatalf("first page = %v, cursor %q", ids, cursor)
+		}
+
+		// An execution created since isn't returned on later pages
+		store.Create(context.Background(), &storage.Execution{ID: "exe_5", Status: client.StatusPending, CreatedAt: created.Add(time.Hour)})
+		ids, cursor = list(t, url.Values{"limit": {"3"}, "cursor": {cursor}})
+		if !slices.Equal(ids, []string{"exe_1"}) || cursor != "" {
+			t.Errorf("second page = %v, cursor %q; want [exe_1] and no cursor", ids, cursor)
+		}
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions?status=failed&fields=error", nil))
+		var resp map[string][]map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if got := resp["executions"]; len(got) != 1 || len(got[0]) != 3 || got[0]["error"] != "image not found" {
+			t.Errorf("executions = %v, want only execution_id, status and error", got)
+		}
+	})
+
+	t.Run("output", func(t *testing.T) {
+		// Output is left out unless asked for
+		for query, want := range map[string]string{
+			"":                        "",
+			"include=output":          "trained\n",
+			"fields=exit_code,stdout": "trained\n",
+			"fields=exit_code,error":  "",
+		} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions?q=train&status=completed&"+query, nil))
+			var resp client.ExecutionList
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Executions) != 1 || resp.Executions[0].Stdout != want {
+				t.Errorf("%q: executions = %+v, want stdout %q", query, resp.Executions, want)
+			}
+		}
+	})
+
+	for _, query := range []string{"status=done", "label=team", "since=yesterday", "limit=0", "limit=1001", "cursor=xyz", "fields=nope", "include=logs"} {
+		t.Run("invalid "+query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions?"+query, nil))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
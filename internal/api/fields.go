@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// resultFields is the set of JSON field names of client.ExecutionResult
+// that may be requested with ?fields=.
+var resultFields = jsonFieldNames(reflect.TypeOf(client.ExecutionResult{}))
+
+// jsonFieldNames returns the JSON names of a struct type's exported fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// parseFields parses a comma-separated ?fields= value. It returns nil if
+// the value is empty, meaning all fields, and an error naming the first
+// field that ExecutionResult doesn't have.
+func parseFields(raw string) ([]string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !resultFields[f] {
+			return nil, fmt.Errorf("unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// selectFields renders result as a JSON object holding only the given
+// fields. execution_id and status are always included so responses stay
+// self-describing. Requested fields that are empty (and omitted by
+// omitempty) are left out, as they would be in the full response.
+func selectFields(result *client.ExecutionResult, fields []string) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]json.RawMessage{
+		"execution_id": all["execution_id"],
+		"status":       all["status"],
+	}
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			selected[f] = v
+		}
+	}
+	return selected, nil
+}
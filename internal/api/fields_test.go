@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetExecution_Fields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	memStorage.Create(context.Background(), &storage.Execution{
+		ID:         "exe_1",
+		Status:     client.StatusCompleted,
+		Stdout:     strings.Repeat("x", 1024),
+		ExitCode:   0,
+		DurationMs: 1500,
+	})
+
+	router := gin.New()
+	router.GET("/executions/:id", server.GetExecution)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantKeys   []string
+	}{
+		{name: "selected fields", query: "?fields=status,exit_code,duration_ms", wantStatus: http.StatusOK, wantKeys: []string{"duration_ms", "execution_id", "exit_code", "status"}},
+		{name: "spaces and empty entries", query: "?fields=status,%20stdout,", wantStatus: http.StatusOK, wantKeys: []string{"execution_id", "status", "stdout"}},
+		{name: "omitted empty field", query: "?fields=stderr", wantStatus: http.StatusOK, wantKeys: []string{"execution_id", "status"}},
+		{name: "unknown field", query: "?fields=status,bogus", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/executions/exe_1"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantKeys == nil {
+				return
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			var keys []string
+			for k := range body {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	tarutil "github.com/geraldthewes/python-executor/internal/tar"
+	"github.com/geraldthewes/python-executor/internal/upload"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// FindMissingFiles reports which files of a project the server needs
+// @Summary Find missing files
+// @Description Given the SHA-256 of each file in a project, return those the
+// @Description server doesn't hold. Upload just those with PUT /files/{sha256},
+// @Description then assemble the archive with POST /archives, so that a repeat
+// @Description submission only sends the files that changed. Files are held by
+// @Description the instance that received them and deleted after
+// @Description PYEXEC_UPLOAD_TTL without use.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param request body client.MissingFilesRequest true "File hashes"
+// @Success 200 {object} client.MissingFilesResponse "Hashes the server doesn't hold"
+// @Failure 400 {object} gin.H "Invalid request"
+// @Failure 404 {object} gin.H "Archive cache not enabled"
+// @Router /files/missing [post]
+func (s *Server) FindMissingFiles(c *gin.Context) {
+	if !s.cachesArchives() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive cache is not enabled"})
+		return
+	}
+
+	var req client.MissingFilesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	missing, err := s.uploads.MissingFiles(req.SHA256)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, client.MissingFilesResponse{Missing: missing})
+}
+
+// PutFile stores one file of a project by its hash
+// @Summary Upload a file
+// @Description Store the request body as a file with the given SHA-256, for
+// @Description POST /archives to build archives from.
+// @Tags uploads
+// @Accept octet-stream
+// @Produce json
+// @Param sha256 path string true "Hex SHA-256 of the file"
+// @Param file body string true "File contents"
+// @Success 204 "File stored"
+// @Failure 400 {object} gin.H "Invalid hash"
+// @Failure 404 {object} gin.H "Archive cache not enabled"
+// @Failure 413 {object} gin.H "File exceeds PYEXEC_MAX_UPLOAD_MB"
+// @Failure 422 {object} gin.H "Contents don't match the hash"
+// @Router /files/{sha256} [put]
+func (s *Server) PutFile(c *gin.Context) {
+	if !s.cachesArchives() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive cache is not enabled"})
+		return
+	}
+
+	if err := s.uploads.PutFile(c.Param("sha256"), c.Request.Body); err != nil {
+		fileError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateArchive assembles an archive from uploaded files
+// @Summary Assemble an archive
+// @Description Build an archive from files uploaded with PUT /files/{sha256}
+// @Description and add it to the archive cache, to execute by archive_sha256.
+// @Description The same list of files always gives the same archive. If any
+// @Description file is missing the response lists them so they can be uploaded.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param request body client.CreateArchiveRequest true "Files of the archive"
+// @Success 201 {object} client.Archive "Cached archive"
+// @Failure 400 {object} gin.H "Invalid request or archive over the extraction limits"
+// @Failure 404 {object} gin.H "Archive cache not enabled"
+// @Failure 409 {object} gin.H "Files missing, listed in missing"
+// @Router /archives [post]
+func (s *Server) CreateArchive(c *gin.Context) {
+	if !s.cachesArchives() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "archive cache is not enabled"})
+		return
+	}
+
+	var req client.CreateArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "files must not be empty"})
+		return
+	}
+
+	sums := make([]string, len(req.Files))
+	for i, f := range req.Files {
+		if f.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("file %s: name must not be empty", f.SHA256)})
+			return
+		}
+		if _, err := fileMode(client.CodeFile{Name: f.Name, Mode: f.Mode}); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sums[i] = f.SHA256
+	}
+	missing, err := s.uploads.MissingFiles(sums)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "files are missing", "missing": missing})
+		return
+	}
+
+	tarData, err := s.buildTarFromStore(req.Files)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	if err := tarutil.CheckLimits(tarData, s.extractLimits()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sum, err := s.uploads.PutArchive(tarData)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, client.Archive{SHA256: sum, Size: int64(len(tarData))})
+}
+
+// buildTarFromStore builds an archive of stored files. Like
+// buildTarFromFiles it sets no times, so the archive only depends on the
+// files' names, modes and contents.
+func (s *Server) buildTarFromStore(files []client.ArchiveFile) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	for _, f := range files {
+		mode, err := fileMode(client.CodeFile{Name: f.Name, Mode: f.Mode})
+		if err != nil {
+			return nil, err
+		}
+		content, err := s.uploads.File(f.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", f.Name, err)
+		}
+
+		header := &tar.Header{
+			Name: f.Name,
+			Mode: mode,
+			Size: int64(len(content)),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("writing tar header for %s: %w", f.Name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, fmt.Errorf("writing tar content for %s: %w", f.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing tar writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fileError responds to an error from the file store
+func fileError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, upload.ErrInvalidHash):
+		status = http.StatusBadRequest
+	case errors.Is(err, upload.ErrFileNotFound):
+		// Expired between the check for missing files and reading it
+		status = http.StatusConflict
+	case errors.Is(err, upload.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, upload.ErrChecksum):
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
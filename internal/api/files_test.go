@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func sha256Hex(data string) string {
+	digest := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestIncrementalUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	cfg := &config.Config{Upload: config.UploadConfig{Dir: t.TempDir(), CacheArchives: true}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.POST("/archives", server.CreateArchive)
+	router.POST("/files/missing", server.FindMissingFiles)
+	router.PUT("/files/:sha256", server.PutFile)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	files := map[string]string{
+		"main.py": "from lib import greet\ngreet()",
+		"lib.py":  "def greet():\n    print('hi')",
+	}
+	manifest := `{"files":[` +
+		`{"name":"main.py","sha256":"` + sha256Hex(files["main.py"]) + `"},` +
+		`{"name":"lib.py","sha256":"` + sha256Hex(files["lib.py"]) + `","mode":"0755"}]}`
+
+	w := do(http.MethodPost, "/files/missing", `{"sha256":["`+sha256Hex(files["main.py"])+`","`+sha256Hex(files["lib.py"])+`"]}`)
+	var missing client.MissingFilesResponse
+	json.Unmarshal(w.Body.Bytes(), &missing)
+	if w.Code != http.StatusOK || len(missing.Missing) != 2 {
+		t.Fatalf("missing files = %d %+v, want both", w.Code, missing)
+	}
+
+	// Assembling before uploading lists what's missing
+	w = do(http.MethodPost, "/archives", manifest)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), sha256Hex(files["lib.py"])) {
+		t.Fatalf("create archive status = %d (body %s), want 409 listing lib.py", w.Code, w.Body.String())
+	}
+
+	for _, content := range files {
+		if w := do(http.MethodPut, "/files/"+sha256Hex(content), content); w.Code != http.StatusNoContent {
+			t.Fatalf("put file status = %d (body %s)", w.Code, w.Body.String())
+		}
+	}
+	w = do(http.MethodPost, "/files/missing", `{"sha256":["`+sha256Hex(files["main.py"])+`"]}`)
+	if w.Code != http.StatusOK || w.Body.String() != `{"missing":[]}` {
+		t.Fatalf("missing files after upload = %d %s, want none", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/archives", manifest)
+	var archive client.Archive
+	json.Unmarshal(w.Body.Bytes(), &archive)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create archive status = %d (body %s)", w.Code, w.Body.String())
+	}
+	// The same files always make the same archive
+	if w := do(http.MethodPost, "/archives", manifest); !strings.Contains(w.Body.String(), archive.SHA256) {
+		t.Errorf("second create archive = %s, want %s", w.Body.String(), archive.SHA256)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","archive_sha256":"`+archive.SHA256+`"}`))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec by hash status = %d (body %s)", w.Code, w.Body.String())
+	}
+	want, _ := buildTarFromFiles([]client.CodeFile{
+		{Name: "main.py", Content: files["main.py"]},
+		{Name: "lib.py", Content: files["lib.py"], Mode: "0755"},
+	})
+	if len(fake.requests) != 1 || !bytes.Equal(fake.requests[0].TarData, want) {
+		t.Error("executor did not get the assembled archive")
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"wrong contents", http.MethodPut, "/files/" + sha256Hex("a"), "b", http.StatusUnprocessableEntity},
+		{"invalid hash", http.MethodPut, "/files/xyz", "a", http.StatusBadRequest},
+		{"invalid missing hash", http.MethodPost, "/files/missing", `{"sha256":["xyz"]}`, http.StatusBadRequest},
+		{"no files", http.MethodPost, "/archives", `{"files":[]}`, http.StatusBadRequest},
+		{"no name", http.MethodPost, "/archives", `{"files":[{"sha256":"` + sha256Hex(files["lib.py"]) + `"}]}`, http.StatusBadRequest},
+		{"bad mode", http.MethodPost, "/archives", `{"files":[{"name":"a","sha256":"` + sha256Hex(files["lib.py"]) + `","mode":"9"}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do(tt.method, tt.path, tt.body); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIncrementalUpload_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Upload: config.UploadConfig{Dir: t.TempDir()}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	router := gin.New()
+	router.POST("/files/missing", server.FindMissingFiles)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/files/missing", strings.NewReader(`{"sha256":[]}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
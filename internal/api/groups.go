@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// groupIDPattern matches the group IDs callers may choose
+var groupIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`)
+
+// validateGroupID checks a request's group ID, if any
+func validateGroupID(id string) error {
+	if id != "" && !groupIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid group_id %q: use up to 128 letters, digits, '.', '_', ':' and '-'", id)
+	}
+	return nil
+}
+
+// labelKeyPattern matches the label keys callers may choose
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./-]{0,62}$`)
+
+// Limits on an execution's labels
+const (
+	maxLabels          = 32
+	maxLabelValueBytes = 256
+)
+
+// validateLabels checks a request's labels, if any
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("too many labels: %d, at most %d", len(labels), maxLabels)
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid label %q: use up to 63 letters, digits, '.', '_', '/' and '-'", key)
+		}
+		if len(value) > maxLabelValueBytes {
+			return fmt.Errorf("label %s: value longer than %d bytes", key, maxLabelValueBytes)
+		}
+	}
+	return nil
+}
+
+// groupExecutions returns the executions of a group, oldest first
+func (s *Server) groupExecutions(ctx context.Context, id string) ([]*storage.Execution, error) {
+	all, err := s.storage.List(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var execs []*storage.Execution
+	for _, exec := range all {
+		if exec.Metadata != nil && exec.Metadata.GroupID == id {
+			execs = append(execs, exec)
+		}
+	}
+	sort.Slice(execs, func(i, j int) bool {
+		return execs[i].CreatedAt.Before(execs[j].CreatedAt)
+	})
+	return execs, nil
+}
+
+// groupStatus aggregates the statuses of a group's executions
+func groupStatus(execs []*storage.Execution, counts map[client.ExecutionStatus]int) client.ExecutionStatus {
+	switch {
+	case counts[client.StatusPending]+counts[client.StatusAwaitingApproval] == len(execs):
+		return client.StatusPending
+	case counts[client.StatusPending]+counts[client.StatusRunning]+counts[client.StatusAwaitingApproval] > 0:
+		return client.StatusRunning
+	case counts[client.StatusKilled]+counts[client.StatusCancelled] > 0:
+		return client.StatusKilled
+	}
+	for _, exec := range execs {
+		if exec.Status != client.StatusCompleted || exec.ExitCode != 0 || exec.Error != "" {
+			return client.StatusFailed
+		}
+	}
+	return client.StatusCompleted
+}
+
+// groupResponse is a client.Group whose executions may be cut down to the
+// fields a request selected
+type groupResponse struct {
+	client.Group
+	Executions []any `json:"executions"`
+}
+
+// groupInfo describes a group, keeping only the given result fields of
+// its executions unless fields is nil
+func groupInfo(id string, execs []*storage.Execution, fields []string) (*groupResponse, error) {
+	g := &groupResponse{
+		Group: client.Group{
+			ID:     id,
+			Total:  len(execs),
+			Counts: make(map[client.ExecutionStatus]int),
+		},
+		Executions: make([]any, 0, len(execs)),
+	}
+	for _, exec := range execs {
+		g.Counts[exec.Status]++
+
+		result := exec.ToExecutionResult()
+		if fields == nil {
+			g.Executions = append(g.Executions, result)
+			continue
+		}
+		selected, err := selectFields(result, fields)
+		if err != nil {
+			return nil, err
+		}
+		g.Executions = append(g.Executions, selected)
+	}
+	g.Status = groupStatus(execs, g.Counts)
+	return g, nil
+}
+
+// GetGroup describes a group of executions
+// @Summary Get group status
+// @Description Return the aggregate status of the executions submitted with a
+// @Description group_id, their count in each status, and their results, oldest
+// @Description first. fields selects the result fields returned for each
+// @Description execution, as for GET /executions/{id}.
+// @Tags groups
+// @Produce json
+// @Param id path string true "Group ID"
+// @Param fields query string false "Comma-separated result fields to return for each execution, e.g. execution_id,status,exit_code"
+// @Success 200 {object} client.Group "Group status and results"
+// @Failure 400 {object} gin.H "Unknown field"
+// @Failure 404 {object} gin.H "No execution has this group ID"
+// @Router /groups/{id} [get]
+func (s *Server) GetGroup(c *gin.Context) {
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	execs, err := s.groupExecutions(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list executions"})
+		return
+	}
+	if len(execs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	g, err := groupInfo(c.Param("id"), execs, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
+
+// KillGroup kills every execution of a group
+// @Summary Kill a group
+// @Description Terminate the group's running executions and cancel its pending
+// @Description ones, then return the group as GET /groups/{id} does.
+// @Tags groups
+// @Produce json
+// @Param id path string true "Group ID"
+// @Success 200 {object} client.Group "Group status and results"
+// @Failure 404 {object} gin.H "No execution has this group ID"
+// @Failure 500 {object} gin.H "Failed to kill an execution"
+// @Router /groups/{id} [delete]
+func (s *Server) KillGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	execs, err := s.groupExecutions(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list executions"})
+		return
+	}
+	if len(execs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return
+	}
+
+	// Kill every execution before reporting the first failure
+	var killErr error
+	for _, exec := range execs {
+		if _, err := s.killExecution(ctx, exec); err != nil && killErr == nil {
+			killErr = fmt.Errorf("execution %s: %w", exec.ID, err)
+		}
+	}
+	if killErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": killErr.Error()})
+		return
+	}
+
+	g, err := groupInfo(id, execs, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, g)
+}
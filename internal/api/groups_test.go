@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGroupStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []client.ExecutionStatus
+		exitCode int
+		want     client.ExecutionStatus
+	}{
+		{"all pending", []client.ExecutionStatus{client.StatusPending, client.StatusPending}, 0, client.StatusPending},
+		{"some running", []client.ExecutionStatus{client.StatusPending, client.StatusCompleted}, 0, client.StatusRunning},
+		{"killed", []client.ExecutionStatus{client.StatusCancelled, client.StatusFailed}, 0, client.StatusKilled},
+		{"failed", []client.ExecutionStatus{client.StatusCompleted, client.StatusFailed}, 0, client.StatusFailed},
+		{"non-zero exit", []client.ExecutionStatus{client.StatusCompleted}, 1, client.StatusFailed},
+		{"completed", []client.ExecutionStatus{client.StatusCompleted, client.StatusCompleted}, 0, client.StatusCompleted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var execs []*storage.Execution
+			counts := map[client.ExecutionStatus]int{}
+			for _, status := range tt.statuses {
+				execs = append(execs, &storage.Execution{Status: status, ExitCode: tt.exitCode})
+				counts[status]++
+			}
+			if got := groupStatus(execs, counts); got != tt.want {
+				t.Errorf("groupStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	store := storage.NewMemoryStorage()
+	server := &Server{storage: store, executor: fake}
+	ctx := context.Background()
+
+	created := time.Now()
+	for i, exec := range []*storage.Execution{
+		{ID: "exe_2", Status: client.StatusRunning, ContainerID: "container-exe_2"},
+		{ID: "exe_1", Status: client.StatusCompleted},
+		{ID: "exe_3", Status: client.StatusPending},
+	} {
+		exec.CreatedAt = created.Add(time.Duration(exec.ID[4]-'0') * time.Second)
+		exec.Metadata = &client.Metadata{GroupID: "batch-42"}
+		if err := store.Create(ctx, exec); err != nil {
+			t.Fatalf("create %d: %v", i, err)
+		}
+	}
+	store.Create(ctx, &storage.Execution{ID: "exe_4", Status: client.StatusRunning, Metadata: &client.Metadata{GroupID: "other"}})
+
+	router := gin.New()
+	router.GET("/groups/:id", server.GetGroup)
+	router.DELETE("/groups/:id", server.KillGroup)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/groups/batch-42?fields=exit_code", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET group = %d %s", w.Code, w.Body.String())
+	}
+	var g client.Group
+	json.Unmarshal(w.Body.Bytes(), &g)
+	if g.Status != client.StatusRunning || g.Total != 3 || g.Counts[client.StatusPending] != 1 {
+		t.Errorf("group = %+v", g)
+	}
+	// Oldest first, cut down to the selected fields
+	if len(g.Executions) != 3 || g.Executions[0].ExecutionID != "exe_1" || g.Executions[2].ExecutionID != "exe_3" {
+		t.Errorf("executions = %+v", g.Executions)
+	}
+	if strings.Contains(w.Body.String(), `"created_at"`) {
+		t.Errorf("unselected field returned: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/groups/batch-42", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE group = %d %s", w.Code, w.Body.String())
+	}
+	json.Unmarshal(w.Body.Bytes(), &g)
+	if g.Status != client.StatusKilled || g.Counts[client.StatusKilled] != 1 || g.Counts[client.StatusCancelled] != 1 {
+		t.Errorf("group after kill = %+v", g)
+	}
+	if len(fake.killed) != 1 || fake.killed[0] != "container-exe_2" {
+		t.Errorf("killed containers = %v", fake.killed)
+	}
+	// Other groups are left alone
+	if exec, _ := store.Get(ctx, "exe_4"); exec.Status != client.StatusRunning {
+		t.Errorf("exe_4 status = %q, want running", exec.Status)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/groups/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET missing group = %d, want 404", w.Code)
+	}
+}
+
+func TestValidateGroupID(t *testing.T) {
+	for _, id := range []string{"", "batch-42", "job:2026.10_a"} {
+		if err := validateGroupID(id); err != nil {
+			t.Errorf("validateGroupID(%q) = %v", id, err)
+		}
+	}
+	for _, id := range []string{"-batch", "a/b", "a b", strings.Repeat("a", 129)} {
+		if err := validateGroupID(id); err == nil {
+			t.Errorf("validateGroupID(%q) = nil, want error", id)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := validateLabels(map[string]string{"job": "nightly", "team/owner": "data-eng", "empty": ""}); err != nil {
+		t.Errorf("validateLabels() = %v", err)
+	}
+	tooMany := make(map[string]string)
+	for i := 0; i <= maxLabels; i++ {
+		tooMany[fmt.Sprintf("k%d", i)] = "v"
+	}
+	for _, labels := range []map[string]string{
+		{"": "v"},
+		{"-job": "v"},
+		{"a b": "v"},
+		{strings.Repeat("k", 64): "v"},
+		{"job": strings.Repeat("v", maxLabelValueBytes+1)},
+		tooMany,
+	} {
+		if err := validateLabels(labels); err == nil {
+			t.Errorf("validateLabels(%.40v) = nil, want error", labels)
+		}
+	}
+}
@@ -4,22 +4,37 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/egress"
+	"github.com/geraldthewes/python-executor/internal/events"
 	"github.com/geraldthewes/python-executor/internal/executor"
 	"github.com/geraldthewes/python-executor/internal/imports"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/quota"
+	"github.com/geraldthewes/python-executor/internal/redact"
+	"github.com/geraldthewes/python-executor/internal/runner"
+	"github.com/geraldthewes/python-executor/internal/secrets"
 	"github.com/geraldthewes/python-executor/internal/storage"
+	tarutil "github.com/geraldthewes/python-executor/internal/tar"
+	"github.com/geraldthewes/python-executor/internal/upload"
 	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // pythonVersionImages maps python_version values to Docker images
@@ -106,17 +121,86 @@ func parseErrorFromStderr(stderr string) (errorType string, errorLine int) {
 // Server holds the API dependencies
 type Server struct {
 	storage  storage.Storage
+	queue    queue.Queue
 	executor executor.Executor
 	config   *config.Config
+	resolver *imports.Resolver // nil unless PYEXEC_RESOLVE_VERSIONS is set
+	uploads  *upload.Store     // nil if no upload directory is configured
+	events   *events.Publisher // nil unless an event broker is configured
+	redactor *redact.Redactor  // nil masks nothing
+	secrets  secrets.Store     // nil unless a secrets backend is configured
+	runners  *runner.Pool      // nil unless executions run on runner agents
+
+	// The egress proxy that limits executions' bandwidth, nil if none,
+	// and its URL as execution containers reach it (see egress.go)
+	egress    *egress.Proxy
+	egressURL *url.URL
+
+	// API keys requests authenticate with, by the SHA-256 of the key (see
+	// auth.go); nil leaves the API open
+	apiKeys map[[32]byte]config.APIKey
+
+	// In-flight tracking for graceful shutdown (see drain.go)
+	mu       sync.Mutex
+	inflight int
+	draining bool
+	drained  chan struct{}
+
+	// Persistent sessions open on this instance (see sessions.go)
+	sessionsMu       sync.Mutex
+	sessions         map[string]*session
+	sessionsStarting int
+
+	// Pipelines run by this instance (see pipelines.go)
+	pipelinesMu sync.Mutex
+	pipelines   map[string]*pipeline
+
+	// Output of the executions running on this instance, for clients
+	// following it live (see logstream.go)
+	liveLogsMu sync.Mutex
+	liveLogs   map[string]*liveLog
+
+	// Run slots bounding concurrent executions (see load.go); slots is nil
+	// without a limit
+	slots    chan struct{}
+	running  atomic.Int64 // executions holding a slot
+	waiting  atomic.Int64 // sync requests waiting for a slot
+	rejected atomic.Int64 // submissions rejected as overloaded
+
+	// Request rate limits of each caller (see quota.go)
+	limiter   *quota.Limiter
+	throttled atomic.Int64 // requests refused as over their caller's quota
 }
 
 // NewServer creates a new API server
-func NewServer(storage storage.Storage, exec executor.Executor, cfg *config.Config) *Server {
-	return &Server{
+func NewServer(storage storage.Storage, q queue.Queue, exec executor.Executor, cfg *config.Config) *Server {
+	s := &Server{
 		storage:  storage,
+		queue:    q,
 		executor: exec,
 		config:   cfg,
 	}
+	if cfg != nil {
+		s.limiter = quota.New(cfg.Quota.RequestsPerMinute, cfg.Quota.GlobalRequestsPerMinute)
+	}
+	if cfg != nil && cfg.Queue.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, cfg.Queue.MaxConcurrent)
+	}
+	if cfg != nil && cfg.Defaults.ResolveVersions {
+		s.resolver = imports.NewResolver(cfg.Defaults.PyPIURL, cfg.Defaults.ResolveCacheTTL)
+	}
+	if cfg != nil && cfg.Upload.Dir != "" {
+		s.uploads = upload.NewStore(cfg.Upload.Dir, int64(cfg.Upload.MaxMB)<<20)
+	}
+	return s
+}
+
+// nodeID returns the ID recorded on executions run by this instance
+func (s *Server) nodeID() string {
+	if s.config == nil {
+		return ""
+	}
+	return s.config.Server.NodeID
 }
 
 // ExecuteSync handles synchronous execution
@@ -128,19 +212,74 @@ func NewServer(storage storage.Storage, exec executor.Executor, cfg *config.Conf
 // @Tags execution
 // @Accept multipart/form-data
 // @Produce json
-// @Param tar formData file true "Uncompressed tar archive containing Python files"
+// @Param tar formData file false "Tar archive containing Python files, optionally gzip-compressed. Omitted when the metadata has upload_id or archive_sha256"
 // @Param metadata formData string true "Execution metadata as JSON: {\"entrypoint\":\"main.py\",\"config\":{\"timeout_seconds\":300}}"
+// @Param stdin formData file false "Standard input streamed to the script; use instead of metadata.stdin for large input"
+// @Param X-Tenant header string false "Tenant the execution is accounted to on servers without API keys (default \"default\")"
 // @Success 200 {object} client.ExecutionResult "Execution completed"
+// @Success 202 {object} client.AsyncResponse "Still running after the server's detach threshold, or held for an admin's approval; follow it with GET /executions/{id}"
 // @Failure 400 {object} gin.H "Invalid request format"
+// @Failure 404 {object} gin.H "archive_sha256 is not cached; send the tar part instead"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
 // @Failure 500 {object} gin.H "Execution failed"
+// @Failure 503 {object} gin.H "Server is shutting down"
 // @Router /exec/sync [post]
 func (s *Server) ExecuteSync(c *gin.Context) {
+	hold, ok := s.holdSync()
+	if !ok {
+		rejectDraining(c)
+		return
+	}
+	defer hold.release()
+
 	// Parse multipart form
 	tarData, metadata, err := s.parseRequest(c)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	detected, err := s.detectArchiveRequirements(c.Request.Context(), tarData, metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stdin, err := stdinPart(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if stdin != nil {
+		defer stdin.Close()
+		if metadata.Stdin != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provide stdin either in metadata or as a stdin part, not both"})
+			return
+		}
+	}
+
+	// Executions that need approval are held and answered like async ones
+	if reason := s.approvalReason(metadata, tenantOf(c)); reason != "" {
+		if stdin != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("execution requires approval (%s), which rules out a stdin part; use metadata.stdin", reason)})
+			return
+		}
+		s.holdForApproval(c, tarData, metadata, detected, reason)
+		return
+	}
+
+	// Sync executions run here, so this instance must satisfy their
+	// placement
+	if err := s.checkPlacement(metadata); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Wait for a run slot, unless the server is too busy
+	if err := s.admitSync(c.Request.Context()); err != nil {
+		s.rejectOverloaded(c, err)
+		return
+	}
+	hold.slot = true
 
 	// Generate execution ID
 	execID := fmt.Sprintf("exe_%s", uuid.New().String())
@@ -148,50 +287,41 @@ func (s *Server) ExecuteSync(c *gin.Context) {
 	// Create execution record
 	now := time.Now()
 	exec := &storage.Execution{
-		ID:        execID,
-		Status:    client.StatusPending,
-		Metadata:  metadata,
-		CreatedAt: now,
+		ID:         execID,
+		Status:     client.StatusPending,
+		Metadata:   metadata,
+		Detected:   detected,
+		Tenant:     tenantOf(c),
+		APIKeyName: apiKeyOf(c),
+		Caller:     callerOf(c),
+		TraceID:    traceIDOf(c),
+		Node:       s.nodeID(),
+		CreatedAt:  now,
 	}
 
 	if err := s.storage.Create(c.Request.Context(), exec); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution"})
 		return
 	}
+	s.publishEvent(client.EventSubmitted, exec)
 
 	// Update to running
 	exec.Status = client.StatusRunning
 	exec.StartedAt = &now
 	s.storage.Update(c.Request.Context(), exec)
+	s.publishEvent(client.EventStarted, exec)
 
-	// Execute
+	// Execute and reply with the result
 	req := &executor.ExecutionRequest{
 		ID:       execID,
 		TarData:  tarData,
 		Metadata: metadata,
 	}
-
-	output, err := s.executor.Execute(c.Request.Context(), req)
-
-	// Update execution with result
-	finishedAt := time.Now()
-	exec.FinishedAt = &finishedAt
-
-	if err != nil {
-		exec.Status = client.StatusFailed
-		exec.Error = err.Error()
-	} else {
-		exec.Status = client.StatusCompleted
-		exec.Stdout = output.Stdout
-		exec.Stderr = output.Stderr
-		exec.ExitCode = output.ExitCode
-		exec.DurationMs = output.DurationMs
+	if stdin != nil {
+		req.Stdin = stdin
 	}
 
-	s.storage.Update(c.Request.Context(), exec)
-
-	// Return result
-	c.JSON(http.StatusOK, exec.ToExecutionResult())
+	s.runSync(c, hold, exec, req)
 }
 
 // ExecuteAsync handles asynchronous execution
@@ -203,71 +333,150 @@ func (s *Server) ExecuteSync(c *gin.Context) {
 // @Tags execution
 // @Accept multipart/form-data
 // @Produce json
-// @Param tar formData file true "Uncompressed tar archive containing Python files"
+// @Param tar formData file false "Tar archive containing Python files, optionally gzip-compressed. Omitted when the metadata has upload_id or archive_sha256"
 // @Param metadata formData string true "Execution metadata as JSON: {\"entrypoint\":\"main.py\"}"
+// @Param X-Tenant header string false "Tenant the execution is accounted to on servers without API keys (default \"default\")"
 // @Success 202 {object} client.AsyncResponse "Execution submitted"
 // @Failure 400 {object} gin.H "Invalid request format"
+// @Failure 404 {object} gin.H "archive_sha256 is not cached; send the tar part instead"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
 // @Failure 500 {object} gin.H "Failed to create execution"
+// @Failure 503 {object} gin.H "Server is shutting down"
 // @Router /exec/async [post]
 func (s *Server) ExecuteAsync(c *gin.Context) {
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
 	// Parse multipart form
 	tarData, metadata, err := s.parseRequest(c)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	detected, err := s.detectArchiveRequirements(c.Request.Context(), tarData, metadata)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Queued jobs are stored (possibly in Consul) until a worker claims
+	// them, which rules out streaming stdin
+	if form := c.Request.MultipartForm; form != nil && len(form.File["stdin"]) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a stdin part is only supported by /exec/sync; use metadata.stdin for async executions"})
+		return
+	}
+
+	s.submitAsync(c, tarData, metadata, detected)
+}
+
+// submitAsync queues an execution, or holds it for approval, and replies
+// with its ID
+func (s *Server) submitAsync(c *gin.Context, tarData []byte, metadata *client.Metadata, detected []string) {
+	if reason := s.approvalReason(metadata, tenantOf(c)); reason != "" {
+		s.holdForApproval(c, tarData, metadata, detected, reason)
+		return
+	}
+	if err := s.admitAsync(c.Request.Context(), 1); err != nil {
+		s.rejectOverloaded(c, err)
+		return
+	}
+
 	// Generate execution ID
 	execID := fmt.Sprintf("exe_%s", uuid.New().String())
 
 	// Create execution record
 	exec := &storage.Execution{
-		ID:        execID,
-		Status:    client.StatusPending,
-		Metadata:  metadata,
-		CreatedAt: time.Now(),
+		ID:         execID,
+		Status:     client.StatusPending,
+		Metadata:   metadata,
+		Detected:   detected,
+		Tenant:     tenantOf(c),
+		APIKeyName: apiKeyOf(c),
+		Caller:     callerOf(c),
+		TraceID:    traceIDOf(c),
+		Node:       s.nodeID(),
+		CreatedAt:  time.Now(),
 	}
 
 	if err := s.storage.Create(c.Request.Context(), exec); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution"})
 		return
 	}
+	s.publishEvent(client.EventSubmitted, exec)
 
-	// Execute in background
-	go s.executeAsync(execID, tarData, metadata)
+	// Queue for a worker on any replica
+	job := &queue.Job{ExecutionID: execID, TarData: tarData, Metadata: metadata}
+	if err := s.queue.Enqueue(c.Request.Context(), job); err != nil {
+		s.failExecution(c.Request.Context(), exec, fmt.Sprintf("queueing execution: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue execution"})
+		return
+	}
 
-	// Return execution ID immediately
+	// Return execution ID immediately, with its place in the queue
+	position, _ := s.queue.Position(c.Request.Context(), execID)
 	c.JSON(http.StatusAccepted, client.AsyncResponse{
-		ExecutionID: execID,
+		ExecutionID:   execID,
+		QueuePosition: position,
 	})
 }
 
 // GetExecution retrieves execution status
 // @Summary Get execution status
 // @Description Retrieve the status and result of an execution.
-// @Description Status values: pending, running, completed, failed, killed
+// @Description Status values: awaiting_approval, pending, running, completed, failed, killed, cancelled
+// @Description Pending async executions report their queue_position, 1 for the next to run.
 // @Tags execution
 // @Produce json
 // @Param id path string true "Execution ID (e.g., exe_550e8400-e29b-41d4-a716-446655440000)"
+// @Param with_timestamps query bool false "Prefix each stdout/stderr line with the time it was emitted"
+// @Param fields query string false "Comma-separated result fields to return, e.g. status,exit_code,duration_ms"
 // @Success 200 {object} client.ExecutionResult "Execution status and result"
+// @Failure 400 {object} gin.H "Unknown field"
 // @Failure 404 {object} gin.H "Execution not found"
 // @Router /executions/{id} [get]
 func (s *Server) GetExecution(c *gin.Context) {
 	id := c.Param("id")
 
+	fields, err := parseFields(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	exec, err := s.storage.Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
+		s.executionLookupFailed(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, exec.ToExecutionResult())
+	result := exec.ToExecutionResult()
+	if exec.Status == client.StatusPending {
+		result.QueuePosition, _ = s.queue.Position(c.Request.Context(), id)
+	}
+	if withTimestamps, _ := strconv.ParseBool(c.Query("with_timestamps")); withTimestamps {
+		result.Stdout = s.timestampedLog(c.Request.Context(), exec, stdoutLog, exec.Stdout, exec.StdoutTimes)
+		result.Stderr = s.timestampedLog(c.Request.Context(), exec, stderrLog, exec.Stderr, exec.StderrTimes)
+	}
+
+	if fields == nil {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	selected, err := selectFields(result, fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, selected)
 }
 
-// KillExecution terminates a running execution
+// KillExecution terminates a running execution or cancels a pending one
 // @Summary Kill execution
-// @Description Terminate a running execution.
-// @Description If the execution is not running, returns the current status.
+// @Description Terminate a running execution, or cancel one that is still pending.
+// @Description If the execution has already finished, returns the current status.
 // @Tags execution
 // @Produce json
 // @Param id path string true "Execution ID (e.g., exe_550e8400-e29b-41d4-a716-446655440000)"
@@ -280,29 +489,62 @@ func (s *Server) KillExecution(c *gin.Context) {
 
 	exec, err := s.storage.Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "execution not found"})
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	status, err := s.killExecution(c.Request.Context(), exec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, client.KillResponse{Status: string(status)})
+}
+
+// killExecution terminates a running execution or cancels a pending or held
+// one, returning its status afterwards
+func (s *Server) killExecution(ctx context.Context, exec *storage.Execution) (client.ExecutionStatus, error) {
+	// Pending executions have no container yet; mark them cancelled so a
+	// worker claiming them skips them, and take them out of the queue.
+	// Held executions are dropped from the queue too.
+	if exec.Status == client.StatusPending || exec.Status == client.StatusAwaitingApproval {
+		if exec.Status == client.StatusAwaitingApproval && s.queue != nil {
+			s.queue.Discard(ctx, exec.ID)
+		}
+		err := s.cancelExecution(ctx, exec, "", "")
+		if err == nil {
+			if s.queue != nil {
+				s.queue.Remove(ctx, exec.ID)
+			}
+			return client.StatusCancelled, nil
+		}
+		if !errors.Is(err, errNotWaiting) {
+			return "", err
+		}
+
+		// A worker started it meanwhile, or it finished
+		if exec, err = s.storage.Get(ctx, exec.ID); err != nil {
+			return "", errors.New("failed to kill execution")
+		}
+	}
 
 	// Only kill if running
 	if exec.Status != client.StatusRunning {
-		c.JSON(http.StatusOK, client.KillResponse{Status: string(exec.Status)})
-		return
+		return exec.Status, nil
 	}
 
 	// Kill container
 	if exec.ContainerID != "" {
-		if err := s.executor.Kill(c.Request.Context(), exec.ContainerID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to kill container"})
-			return
+		if err := s.executor.Kill(ctx, exec.ContainerID); err != nil {
+			return "", errors.New("failed to kill container")
 		}
 	}
 
 	// Update status
 	exec.Status = client.StatusKilled
-	s.storage.Update(c.Request.Context(), exec)
+	s.storage.Update(ctx, exec)
 
-	c.JSON(http.StatusOK, client.KillResponse{Status: "killed"})
+	return client.StatusKilled, nil
 }
 
 // parseRequest parses multipart form data
@@ -312,18 +554,6 @@ func (s *Server) parseRequest(c *gin.Context) ([]byte, *client.Metadata, error)
 		return nil, nil, fmt.Errorf("parsing form: %w", err)
 	}
 
-	// Get tar file
-	tarFile, _, err := c.Request.FormFile("tar")
-	if err != nil {
-		return nil, nil, fmt.Errorf("missing tar file: %w", err)
-	}
-	defer tarFile.Close()
-
-	tarData, err := io.ReadAll(tarFile)
-	if err != nil {
-		return nil, nil, fmt.Errorf("reading tar: %w", err)
-	}
-
 	// Get metadata
 	metadataStr := c.Request.FormValue("metadata")
 	if metadataStr == "" {
@@ -335,24 +565,193 @@ func (s *Server) parseRequest(c *gin.Context) ([]byte, *client.Metadata, error)
 		return nil, nil, fmt.Errorf("parsing metadata: %w", err)
 	}
 
+	tarData, err := s.requestArchive(c, &metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch metadata.Mode {
+	case "":
+	case client.ModePytest:
+		if metadata.EvalLastExpr {
+			return nil, nil, fmt.Errorf("eval_last_expr is not supported in pytest mode")
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown mode %q", metadata.Mode)
+	}
+	if err := s.validateRetryPolicy(metadata.Retry); err != nil {
+		return nil, nil, err
+	}
+	if err := validateGroupID(metadata.GroupID); err != nil {
+		return nil, nil, err
+	}
+	if err := validateLabels(metadata.Labels); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSecretNames(metadata.Secrets); err != nil {
+		return nil, nil, err
+	}
+	if err := validatePlacement(metadata.Placement); err != nil {
+		return nil, nil, err
+	}
+	if err := s.validateBandwidth(metadata.Config); err != nil {
+		return nil, nil, err
+	}
+	if err := s.validateDiskIO(metadata.Config); err != nil {
+		return nil, nil, err
+	}
+	if err := validateDeterministic(metadata.Config); err != nil {
+		return nil, nil, err
+	}
+	if err := validateArtifacts(metadata.Config); err != nil {
+		return nil, nil, err
+	}
+	preset, err := s.lookupPreset(metadata.Preset)
+	if err != nil {
+		return nil, nil, err
+	}
+	applyPreset(&metadata, preset)
+
 	return tarData, &metadata, nil
 }
 
-// executeAsync runs execution in background
+// requestArchive returns the uncompressed archive of a parsed multipart
+// request: the tar part, or the upload or cached archive that metadata
+// names instead. It must be within the extraction limits.
+func (s *Server) requestArchive(c *gin.Context, metadata *client.Metadata) ([]byte, error) {
+	var sent []byte
+	tarFile, _, err := c.Request.FormFile("tar")
+	switch {
+	case metadata.UploadID != "" || metadata.ArchiveSHA256 != "":
+		if err == nil {
+			tarFile.Close()
+		}
+		if err == nil || (metadata.UploadID != "" && metadata.ArchiveSHA256 != "") {
+			return nil, fmt.Errorf("send only one of a tar file, upload_id and archive_sha256")
+		}
+		if metadata.UploadID != "" {
+			sent, err = s.uploadedArchive(metadata.UploadID)
+			if err != nil {
+				return nil, fmt.Errorf("upload %s: %w", metadata.UploadID, err)
+			}
+		} else {
+			sent, err = s.cachedArchive(metadata.ArchiveSHA256)
+			if err != nil {
+				return nil, fmt.Errorf("archive %s: %w", metadata.ArchiveSHA256, err)
+			}
+		}
+	case err != nil:
+		return nil, fmt.Errorf("missing tar file: %w", err)
+	default:
+		defer tarFile.Close()
+		sent, err = io.ReadAll(tarFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+	}
+
+	limits := s.extractLimits()
+	tarData, err := tarutil.Decompress(sent, limits.MaxArchiveBytes())
+	if err != nil {
+		return nil, err
+	}
+	if err := tarutil.CheckLimits(tarData, limits); err != nil {
+		return nil, err
+	}
+	if metadata.UploadID == "" && metadata.ArchiveSHA256 == "" {
+		s.cacheArchive(sent)
+	}
+	return tarData, nil
+}
+
+// extractLimits returns the limits on what a request's archive may
+// extract to
+func (s *Server) extractLimits() tarutil.Limits {
+	if s.config == nil {
+		return tarutil.Limits{}
+	}
+	return tarutil.Limits{
+		MaxTotalBytes: int64(s.config.Server.MaxExtractMB) << 20,
+		MaxFiles:      s.config.Server.MaxExtractFiles,
+		MaxFileBytes:  int64(s.config.Server.MaxExtractFileMB) << 20,
+	}
+}
+
+// stdinPart opens the optional "stdin" file part of a parsed multipart form.
+// Large parts are spooled to disk by ParseMultipartForm, so the returned file
+// can be streamed to the container without holding it in memory.
+func stdinPart(c *gin.Context) (multipart.File, error) {
+	form := c.Request.MultipartForm
+	if form == nil || len(form.File["stdin"]) == 0 {
+		return nil, nil
+	}
+
+	f, err := form.File["stdin"][0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("reading stdin part: %w", err)
+	}
+	return f, nil
+}
+
+// StartWorkers starts n workers that claim queued async executions until ctx
+// is cancelled
+func (s *Server) StartWorkers(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		go s.worker(ctx)
+	}
+}
+
+// worker claims and runs queued jobs one at a time
+func (s *Server) worker(ctx context.Context) {
+	for {
+		job, err := s.queue.ClaimMatching(ctx, s.canRun)
+		if err != nil {
+			if ctx.Err() != nil || err == queue.ErrClosed {
+				return
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// Wait for a run slot, shared with sync executions, and hand the
+		// job back if this instance is shutting down
+		if err := s.takeSlot(ctx); err != nil {
+			s.queue.Release(context.Background(), job.ExecutionID)
+			return
+		}
+		if !s.acquire() {
+			s.releaseSlot()
+			s.queue.Release(context.Background(), job.ExecutionID)
+			return
+		}
+
+		s.executeAsync(job.ExecutionID, job.TarData, job.Metadata)
+		s.releaseSlot()
+		s.queue.Complete(context.Background(), job.ExecutionID)
+	}
+}
+
+// executeAsync runs a claimed execution; the caller must hold an in-flight slot
 func (s *Server) executeAsync(execID string, tarData []byte, metadata *client.Metadata) {
+	defer s.release()
 	ctx := context.Background()
 
-	// Get execution
-	exec, err := s.storage.Get(ctx, execID)
+	// Update to running, unless it was cancelled while queued. A kill may
+	// be cancelling it at this moment, so it is started only if it is
+	// still pending.
+	now := time.Now()
+	exec, err := s.storage.Modify(ctx, execID, func(exec *storage.Execution) error {
+		if exec.Status != client.StatusPending {
+			return errNotWaiting
+		}
+		exec.Status = client.StatusRunning
+		exec.StartedAt = &now
+		return nil
+	})
 	if err != nil {
 		return
 	}
-
-	// Update to running
-	now := time.Now()
-	exec.Status = client.StatusRunning
-	exec.StartedAt = &now
-	s.storage.Update(ctx, exec)
+	s.publishEvent(client.EventStarted, exec)
 
 	// Execute
 	req := &executor.ExecutionRequest{
@@ -361,24 +760,165 @@ func (s *Server) executeAsync(execID string, tarData []byte, metadata *client.Me
 		Metadata: metadata,
 	}
 
-	output, err := s.executor.Execute(ctx, req)
+	s.runWithRetries(ctx, exec, req)
+	s.finishExecution(ctx, exec)
+}
 
-	// Update with result
+// runExecution runs a request through the executor, persisting the container
+// ID as soon as it is known so the execution can be killed.
+func (s *Server) runExecution(ctx context.Context, exec *storage.Execution, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	exec.Node = s.nodeID()
+	req.Tenant = exec.Tenant
+	req.APIKeyName = exec.APIKeyName
+	secretEnv, err := s.secretEnv(ctx, exec)
+	if err != nil {
+		return nil, err
+	}
+	req.Env = append(req.Env, secretEnv...)
+	req.Env = append(req.Env, traceEnv(exec.ID, exec.TraceID)...)
+	req.Env = append(req.Env, s.progressEnv(exec)...)
+	egressEnv, release := s.egressEnv(exec)
+	defer release()
+	req.Env = append(req.Env, egressEnv...)
+	req.OnContainerCreated = func(containerID string) {
+		exec.ContainerID = containerID
+		s.storage.Update(ctx, exec)
+	}
+	req.OnPhase = func(phase client.ExecutionPhase) {
+		exec.Phase = phase
+		s.storage.Update(ctx, exec)
+	}
+	req.OnOutput = s.liveOutput(exec)
+
+	return s.executor.Execute(ctx, req)
+}
+
+// recordResult copies executor output (or error) into the execution record
+func (s *Server) recordResult(exec *storage.Execution, output *executor.ExecutionOutput, err error) {
 	finishedAt := time.Now()
 	exec.FinishedAt = &finishedAt
+	exec.Phase = ""
 
 	if err != nil {
 		exec.Status = client.StatusFailed
-		exec.Error = err.Error()
-	} else {
-		exec.Status = client.StatusCompleted
-		exec.Stdout = output.Stdout
-		exec.Stderr = output.Stderr
-		exec.ExitCode = output.ExitCode
-		exec.DurationMs = output.DurationMs
+		exec.Error = s.outputRedactor(exec).String(err.Error())
+		if errors.Is(err, executor.ErrTimeout) {
+			exec.Signal = "SIGKILL"
+			exec.Termination = client.TerminationTimeout
+		}
+		return
 	}
 
-	s.storage.Update(ctx, exec)
+	// Secrets never reach storage, nor anything parsed from the output
+	s.redactOutput(exec, output)
+
+	exec.Status = client.StatusCompleted
+	exec.Stdout = output.Stdout
+	exec.Stderr = output.Stderr
+	exec.StdoutTimes = output.StdoutTimes
+	exec.StderrTimes = output.StderrTimes
+	exec.Output = output.Combined
+	exec.ExitCode = output.ExitCode
+	exec.DurationMs = output.DurationMs
+	exec.CPU = output.CPU
+	exec.Timings = output.Timings
+	if exec.Timings != nil && exec.StartedAt != nil {
+		exec.Timings.QueueMs = exec.StartedAt.Sub(exec.CreatedAt).Milliseconds()
+	}
+	exec.Install = output.Install
+	if exec.Install != nil {
+		exec.Install.Detected = exec.Detected
+	}
+	exec.Manifest = output.Manifest
+	exec.StructuredOutput = output.StructuredOutput
+	exec.StructuredOutputError = output.StructuredOutputError
+	exec.Artifacts = output.Artifacts
+	for _, f := range output.Files {
+		f.URL = artifactURL(exec.ID, f.Name)
+		exec.Artifacts = append(exec.Artifacts, f)
+	}
+	if output.OutputArchive != nil {
+		exec.Artifacts = append(exec.Artifacts, client.Artifact{
+			Name:        outputArchive,
+			ContentType: "application/x-tar",
+			Size:        int64(len(output.OutputArchive)),
+			Data:        output.OutputArchive,
+			URL:         artifactURL(exec.ID, outputArchive),
+		})
+	}
+	exec.Signal = signalName(output.ExitCode)
+	if output.OOMKilled {
+		exec.Termination = client.TerminationOOM
+	}
+	if output.DiskLimitExceeded {
+		exec.Termination = client.TerminationDiskLimit
+	}
+
+	// Parse REPL-style result from stdout if EvalLastExpr was enabled
+	if exec.Metadata != nil && exec.Metadata.EvalLastExpr && output.ExitCode == 0 {
+		exec.Stdout, exec.Result = parseResultFromStdout(output.Stdout)
+		exec.Output, _ = parseResultFromStdout(output.Combined)
+	}
+
+	// Parse the pytest and coverage reports. A malformed report is left
+	// out; the tools' own output still shows what happened.
+	if output.JUnitReport != nil {
+		exec.Tests, _ = parseJUnitReport(output.JUnitReport)
+	}
+	if output.CoverageXML != nil {
+		exec.Coverage, _ = parseCoverageReport(output.CoverageXML)
+	}
+
+	// Parse error details from stderr if the script failed
+	if output.ExitCode != 0 && output.Stderr != "" {
+		exec.ErrorType, exec.ErrorLine = parseErrorFromStderr(output.Stderr)
+		exec.Traceback = parseTraceback(output.Stderr)
+	}
+
+	// Keep stored and returned results bounded
+	spillLogs(exec, s.inlineOutputLimit())
+
+	if output.Install != nil && output.Install.ExitCode != 0 {
+		exec.Error = fmt.Sprintf("dependency installation failed with exit code %d; see install.stderr", output.Install.ExitCode)
+	}
+	if output.DiskLimitExceeded {
+		exec.Error = "the script wrote more than its disk limit (config.disk_mb) and was stopped"
+	}
+}
+
+// finishExecution persists the final state of an execution. An execution that
+// was killed while running keeps its killed status.
+func (s *Server) finishExecution(ctx context.Context, exec *storage.Execution) {
+	s.keepSuspensions(ctx, exec)
+	if current, err := s.storage.Get(ctx, exec.ID); err == nil && current.Status == client.StatusKilled {
+		exec.Status = client.StatusKilled
+		exec.Termination = client.TerminationKilled
+	}
+
+	s.storeArtifacts(ctx, exec)
+	if err := s.storage.Update(ctx, exec); err != nil {
+		// The backend refused the result, perhaps as too large for it:
+		// store the execution without it rather than leave it running
+		dropResult(exec, err)
+		s.storage.Update(ctx, exec)
+	}
+	s.endLiveLog(exec.ID)
+	s.publishEvent(client.EventCompleted, exec)
+	s.recordUsage(ctx, exec)
+}
+
+// dropResult clears an execution's output and what was parsed from it,
+// failing it with the error that kept the result from being stored
+func dropResult(exec *storage.Execution, err error) {
+	if exec.Status != client.StatusKilled {
+		exec.Status = client.StatusFailed
+	}
+	exec.Error = fmt.Sprintf("storing the result failed: %v", err)
+	exec.Stdout, exec.Stderr, exec.Output = "", "", ""
+	exec.StdoutTimes, exec.StderrTimes = nil, nil
+	exec.Result, exec.StructuredOutput = nil, nil
+	exec.Tests, exec.Coverage, exec.Artifacts = nil, nil, nil
+	exec.Traceback = nil
 }
 
 // maxCodeSize is the maximum allowed size for code in JSON requests (100KB)
@@ -396,10 +936,14 @@ const maxCodeSize = 100 * 1024
 // @Accept json
 // @Produce json
 // @Param request body client.SimpleExecRequest true "Execution request"
+// @Param X-Tenant header string false "Tenant the execution is accounted to on servers without API keys (default \"default\")"
 // @Success 200 {object} client.ExecutionResult "Execution completed"
+// @Success 202 {object} client.AsyncResponse "Still running after the server's detach threshold, or held for an admin's approval; follow it with GET /executions/{id}"
 // @Failure 400 {object} gin.H "Invalid request"
 // @Failure 413 {object} gin.H "Code size exceeds limit"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
 // @Failure 500 {object} gin.H "Execution failed"
+// @Failure 503 {object} gin.H "Server is shutting down"
 // @Router /eval [post]
 func (s *Server) ExecuteEval(c *gin.Context) {
 	var req client.SimpleExecRequest
@@ -408,10 +952,146 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		return
 	}
 
+	s.evalSync(c, &req)
+}
+
+// evalSync runs a JSON execution request and replies with its result
+func (s *Server) evalSync(c *gin.Context, req *client.SimpleExecRequest) {
+	hold, ok := s.holdSync()
+	if !ok {
+		rejectDraining(c)
+		return
+	}
+	defer hold.release()
+
+	tarData, metadata, detected, err := s.prepareEval(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// Executions that need approval are held and answered like async ones
+	if reason := s.approvalReason(metadata, tenantOf(c)); reason != "" {
+		s.holdForApproval(c, tarData, metadata, detected, reason)
+		return
+	}
+
+	// Sync executions run here, so this instance must satisfy their
+	// placement
+	if err := s.checkPlacement(metadata); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Wait for a run slot, unless the server is too busy
+	if err := s.admitSync(c.Request.Context()); err != nil {
+		s.rejectOverloaded(c, err)
+		return
+	}
+	hold.slot = true
+
+	// Generate execution ID
+	execID := fmt.Sprintf("exe_%s", uuid.New().String())
+
+	// Create execution record
+	now := time.Now()
+	exec := &storage.Execution{
+		ID:         execID,
+		Status:     client.StatusPending,
+		Metadata:   metadata,
+		Detected:   detected,
+		Tenant:     tenantOf(c),
+		APIKeyName: apiKeyOf(c),
+		Caller:     callerOf(c),
+		TraceID:    traceIDOf(c),
+		Node:       s.nodeID(),
+		CreatedAt:  now,
+	}
+
+	if err := s.storage.Create(c.Request.Context(), exec); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution"})
+		return
+	}
+	s.publishEvent(client.EventSubmitted, exec)
+
+	// Update to running
+	exec.Status = client.StatusRunning
+	exec.StartedAt = &now
+	s.storage.Update(c.Request.Context(), exec)
+	s.publishEvent(client.EventStarted, exec)
+
+	// Execute and reply with the result
+	execReq := &executor.ExecutionRequest{
+		ID:       execID,
+		TarData:  tarData,
+		Metadata: metadata,
+	}
+
+	s.runSync(c, hold, exec, execReq)
+}
+
+// evalError is an /eval request that can't be run, with the status to reply
+// with
+type evalError struct {
+	status int
+	err    error
+}
+
+func (e *evalError) Error() string {
+	return e.err.Error()
+}
+
+// evalErrorStatus returns the status for an error from prepareEval
+func evalErrorStatus(err error) int {
+	var ee *evalError
+	if errors.As(err, &ee) {
+		return ee.status
+	}
+	return http.StatusBadRequest
+}
+
+// prepareEval validates a JSON execution request and builds the archive and
+// metadata it runs with, along with the requirements detected in its code
+func (s *Server) prepareEval(ctx context.Context, req *client.SimpleExecRequest) ([]byte, *client.Metadata, []string, error) {
 	// Validate request
 	if req.Code == "" && len(req.Files) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "either 'code' or 'files' must be provided"})
-		return
+		return nil, nil, nil, errors.New("either 'code' or 'files' must be provided")
+	}
+	for _, f := range req.Files {
+		if _, err := decodeFileContent(f); err != nil {
+			return nil, nil, nil, err
+		}
+		if _, err := fileMode(f); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := s.validateRetryPolicy(req.Retry); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateGroupID(req.GroupID); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateSecretNames(req.Secrets); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validatePlacement(req.Placement); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.validateBandwidth(req.Config); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.validateDiskIO(req.Config); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateDeterministic(req.Config); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateArtifacts(req.Config); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Validate and resolve Python version to Docker image
@@ -420,13 +1100,19 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		var ok bool
 		dockerImage, ok = pythonVersionImages[req.PythonVersion]
 		if !ok {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": fmt.Sprintf("unsupported python_version %q; supported versions: 3.10, 3.11, 3.12, 3.13", req.PythonVersion),
-			})
-			return
+			return nil, nil, nil, fmt.Errorf("unsupported python_version %q; supported versions: 3.10, 3.11, 3.12, 3.13", req.PythonVersion)
 		}
 	}
 
+	// A preset's image stands in for an unset python_version
+	preset, err := s.lookupPreset(req.Preset)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if dockerImage == "" && preset != nil {
+		dockerImage = preset.DockerImage
+	}
+
 	// Build files list
 	var files []client.CodeFile
 	if len(req.Files) > 0 {
@@ -436,31 +1122,22 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		files = []client.CodeFile{{Name: "main.py", Content: req.Code}}
 	}
 
-	// Add eval wrapper script if EvalLastExpr is enabled
-	if req.EvalLastExpr {
-		files = append(files, client.CodeFile{
-			Name:    executor.EvalWrapperScript,
-			Content: executor.GetEvalWrapperCode(),
-		})
-	}
-
 	// Validate size
 	var totalSize int
 	for _, f := range files {
 		totalSize += len(f.Content)
 	}
 	if totalSize > maxCodeSize {
-		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-			"error": fmt.Sprintf("total code size %d bytes exceeds limit of %d bytes", totalSize, maxCodeSize),
-		})
-		return
+		return nil, nil, nil, &evalError{
+			status: http.StatusRequestEntityTooLarge,
+			err:    fmt.Errorf("total code size %d bytes exceeds limit of %d bytes", totalSize, maxCodeSize),
+		}
 	}
 
 	// Build tar archive
 	tarData, err := buildTarFromFiles(files)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("building archive: %v", err)})
-		return
+		return nil, nil, nil, &evalError{status: http.StatusInternalServerError, err: fmt.Errorf("building archive: %w", err)}
 	}
 
 	// Determine entrypoint
@@ -473,31 +1150,54 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		}
 	}
 
-	// Auto-detect imports if enabled
+	// The request's own requirements: requirements_txt, then the packages
+	// it doesn't already name
+	packages, err := packageRequirements(req.Packages)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	userRequirements := req.RequirementsTxt
+	if userRequirements == "-" {
+		userRequirements = ""
+	}
+	userRequirements = imports.MergeRequirements(packages, userRequirements)
+
+	// Auto-detect imports if enabled, by the request or else the server
 	var requirementsTxt string
+	var detected []string
 	autoDetectEnabled := s.config != nil && s.config.Defaults.AutoDetectImports
+	if req.AutoInstall != nil {
+		autoDetectEnabled = *req.AutoInstall
+	}
 
 	// "-" means explicitly disable auto-detection for this request
 	if req.RequirementsTxt == "-" {
-		requirementsTxt = ""
+		requirementsTxt = userRequirements
 	} else if autoDetectEnabled {
-		// Collect all Python code for analysis
-		var allCode strings.Builder
+		// Collect the source of every file for analysis
+		sources := make(map[string]string, len(files))
 		for _, f := range files {
-			if strings.HasSuffix(f.Name, ".py") {
-				allCode.WriteString(f.Content)
-				allCode.WriteString("\n")
+			if f.Encoding != client.EncodingBase64 {
+				sources[f.Name] = f.Content
 			}
 		}
 
-		// Detect third-party imports
-		detectedReqs := imports.DetectRequirements(allCode.String())
+		// Use the dependencies of a pyproject.toml or Pipfile, or else
+		// detect third-party imports
+		found, err := imports.FileRequirements(sources)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		detectedReqs := s.pinRequirements(ctx, found, dockerImage)
+		if detectedReqs != "" {
+			detected = strings.Split(detectedReqs, "\n")
+		}
 
 		// Merge with user-provided requirements (user-provided takes precedence)
-		requirementsTxt = imports.MergeRequirements(detectedReqs, req.RequirementsTxt)
+		requirementsTxt = imports.MergeRequirements(detectedReqs, userRequirements)
 	} else {
 		// Auto-detect disabled, use only user-provided
-		requirementsTxt = req.RequirementsTxt
+		requirementsTxt = userRequirements
 	}
 
 	// Build metadata
@@ -508,7 +1208,14 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		DockerImage:     dockerImage,
 		EvalLastExpr:    req.EvalLastExpr,
 		RequirementsTxt: requirementsTxt,
+		Retry:           req.Retry,
+		GroupID:         req.GroupID,
+		Labels:          req.Labels,
+		Secrets:         req.Secrets,
+		Placement:       req.Placement,
+		Preset:          req.Preset,
 	}
+	applyPreset(metadata, preset)
 
 	// Auto-enable network if packages need to be installed
 	if requirementsTxt != "" {
@@ -523,66 +1230,40 @@ func (s *Server) ExecuteEval(c *gin.Context) {
 		}
 	}
 
-	// Generate execution ID
-	execID := fmt.Sprintf("exe_%s", uuid.New().String())
-
-	// Create execution record
-	now := time.Now()
-	exec := &storage.Execution{
-		ID:        execID,
-		Status:    client.StatusPending,
-		Metadata:  metadata,
-		CreatedAt: now,
-	}
-
-	if err := s.storage.Create(c.Request.Context(), exec); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution"})
-		return
+	// Record the versions of detected packages, which the user never pinned
+	if len(detected) > 0 {
+		metadata.Config.FreezePackages = true
 	}
 
-	// Update to running
-	exec.Status = client.StatusRunning
-	exec.StartedAt = &now
-	s.storage.Update(c.Request.Context(), exec)
-
-	// Execute
-	execReq := &executor.ExecutionRequest{
-		ID:       execID,
-		TarData:  tarData,
-		Metadata: metadata,
-	}
-
-	output, err := s.executor.Execute(c.Request.Context(), execReq)
-
-	// Update execution with result
-	finishedAt := time.Now()
-	exec.FinishedAt = &finishedAt
-
-	if err != nil {
-		exec.Status = client.StatusFailed
-		exec.Error = err.Error()
-	} else {
-		exec.Status = client.StatusCompleted
-		exec.Stdout = output.Stdout
-		exec.Stderr = output.Stderr
-		exec.ExitCode = output.ExitCode
-		exec.DurationMs = output.DurationMs
-
-		// Parse error details from stderr if there was an error (non-zero exit code)
-		if output.ExitCode != 0 && output.Stderr != "" {
-			exec.ErrorType, exec.ErrorLine = parseErrorFromStderr(output.Stderr)
-		}
+	return tarData, metadata, detected, nil
+}
 
-		// Parse REPL-style result from stdout if EvalLastExpr was enabled
-		if req.EvalLastExpr && output.ExitCode == 0 {
-			exec.Stdout, exec.Result = parseResultFromStdout(output.Stdout)
+// decodeFileContent returns the raw bytes of a file according to its encoding
+func decodeFileContent(f client.CodeFile) ([]byte, error) {
+	switch f.Encoding {
+	case "":
+		return []byte(f.Content), nil
+	case client.EncodingBase64:
+		content, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: invalid base64 content: %w", f.Name, err)
 		}
+		return content, nil
+	default:
+		return nil, fmt.Errorf("file %s: unsupported encoding %q (use \"base64\" or omit)", f.Name, f.Encoding)
 	}
+}
 
-	s.storage.Update(c.Request.Context(), exec)
-
-	// Return result
-	c.JSON(http.StatusOK, exec.ToExecutionResult())
+// fileMode returns the permissions of a file, 0644 unless it sets Mode
+func fileMode(f client.CodeFile) (int64, error) {
+	if f.Mode == "" {
+		return 0644, nil
+	}
+	mode, err := strconv.ParseUint(f.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("file %s: invalid mode %q (use octal permissions such as \"0755\")", f.Name, f.Mode)
+	}
+	return int64(mode), nil
 }
 
 // buildTarFromFiles creates an uncompressed tar archive from code files
@@ -591,17 +1272,26 @@ func buildTarFromFiles(files []client.CodeFile) ([]byte, error) {
 	tw := tar.NewWriter(&buf)
 
 	for _, f := range files {
+		content, err := decodeFileContent(f)
+		if err != nil {
+			return nil, err
+		}
+		mode, err := fileMode(f)
+		if err != nil {
+			return nil, err
+		}
+
 		header := &tar.Header{
 			Name: f.Name,
-			Mode: 0644,
-			Size: int64(len(f.Content)),
+			Mode: mode,
+			Size: int64(len(content)),
 		}
 
 		if err := tw.WriteHeader(header); err != nil {
 			return nil, fmt.Errorf("writing tar header for %s: %w", f.Name, err)
 		}
 
-		if _, err := tw.Write([]byte(f.Content)); err != nil {
+		if _, err := tw.Write(content); err != nil {
 			return nil, fmt.Errorf("writing tar content for %s: %w", f.Name, err)
 		}
 	}
@@ -3,14 +3,25 @@ package api
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
 	"github.com/geraldthewes/python-executor/internal/storage"
 	"github.com/geraldthewes/python-executor/pkg/client"
 )
@@ -92,6 +103,76 @@ func TestBuildTarFromFiles(t *testing.T) {
 	}
 }
 
+func TestBuildTarFromFiles_Base64(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{
+		{Name: "image.png", Content: base64.StdEncoding.EncodeToString(binary), Encoding: client.EncodingBase64},
+	})
+	if err != nil {
+		t.Fatalf("buildTarFromFiles() error = %v", err)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	if _, err := tr.Next(); err != nil {
+		t.Fatalf("reading tar: %v", err)
+	}
+	content, _ := io.ReadAll(tr)
+	if !bytes.Equal(content, binary) {
+		t.Errorf("content = %v, want %v", content, binary)
+	}
+}
+
+func TestBuildTarFromFiles_Mode(t *testing.T) {
+	tarData, err := buildTarFromFiles([]client.CodeFile{
+		{Name: "main.py", Content: "print(1)"},
+		{Name: "setup.sh", Content: "#!/bin/sh\necho hi", Mode: "0755"},
+	})
+	if err != nil {
+		t.Fatalf("buildTarFromFiles() error = %v", err)
+	}
+
+	modes := make(map[string]int64)
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading tar: %v", err)
+		}
+		modes[hdr.Name] = hdr.Mode
+	}
+	if modes["main.py"] != 0644 || modes["setup.sh"] != 0755 {
+		t.Errorf("modes = %o and %o, want 644 and 755", modes["main.py"], modes["setup.sh"])
+	}
+
+	for _, mode := range []string{"rwx", "1777", "9"} {
+		if _, err := fileMode(client.CodeFile{Name: "x", Mode: mode}); err == nil {
+			t.Errorf("fileMode(%q) succeeded, want error", mode)
+		}
+	}
+}
+
+func TestDecodeFileContent_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		file client.CodeFile
+	}{
+		{name: "invalid base64", file: client.CodeFile{Name: "a.bin", Content: "not base64!", Encoding: client.EncodingBase64}},
+		{name: "unknown encoding", file: client.CodeFile{Name: "a.bin", Content: "x", Encoding: "hex"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeFileContent(tt.file); err == nil {
+				t.Error("decodeFileContent() expected error")
+			}
+		})
+	}
+}
+
 func TestParseErrorFromStderr(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -325,3 +406,695 @@ func TestExecuteEval_Validation(t *testing.T) {
 		})
 	}
 }
+
+func TestExecuteEval_AutoInstall(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	on, off := true, false
+	tests := []struct {
+		name         string
+		serverAuto   bool
+		autoInstall  *bool
+		wantReqs     string
+		wantDetected []string
+	}{
+		{name: "server default on", serverAuto: true, wantReqs: "numpy", wantDetected: []string{"numpy"}},
+		{name: "server default off", serverAuto: false, wantReqs: ""},
+		{name: "request turns it on", serverAuto: false, autoInstall: &on, wantReqs: "numpy", wantDetected: []string{"numpy"}},
+		{name: "request turns it off", serverAuto: true, autoInstall: &off, wantReqs: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeExecutor{output: &executor.ExecutionOutput{Install: &client.InstallResult{Packages: []string{"numpy==2.0.0"}}}}
+			cfg := &config.Config{}
+			cfg.Defaults.AutoDetectImports = tt.serverAuto
+			server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+			router := gin.New()
+			router.POST("/eval", server.ExecuteEval)
+
+			body, _ := json.Marshal(client.SimpleExecRequest{Code: "import numpy\nimport os", AutoInstall: tt.autoInstall})
+			req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body.String())
+			}
+			meta := fake.requests[0].Metadata
+			if meta.RequirementsTxt != tt.wantReqs {
+				t.Errorf("requirements = %q, want %q", meta.RequirementsTxt, tt.wantReqs)
+			}
+			if tt.wantReqs != "" && (meta.Config == nil || !meta.Config.FreezePackages) {
+				t.Errorf("freeze_packages not enabled for detected requirements")
+			}
+
+			var result client.ExecutionResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if !reflect.DeepEqual(result.Install.Detected, tt.wantDetected) {
+				t.Errorf("install.detected = %v, want %v", result.Install.Detected, tt.wantDetected)
+			}
+		})
+	}
+}
+
+func TestRecordResult_InstallFailure(t *testing.T) {
+	server := &Server{}
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+
+	server.recordResult(exec, &executor.ExecutionOutput{
+		ExitCode: 1,
+		Install:  &client.InstallResult{Stderr: "No matching distribution found", ExitCode: 1},
+	}, nil)
+
+	result := exec.ToExecutionResult()
+	if result.Install == nil || result.Install.Stderr != "No matching distribution found" {
+		t.Errorf("install result not reported: %+v", result.Install)
+	}
+	if !strings.Contains(result.Error, "dependency installation failed") {
+		t.Errorf("error = %q, want install failure", result.Error)
+	}
+}
+
+func TestRecordResult_Timings(t *testing.T) {
+	server := &Server{}
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	started := created.Add(1500 * time.Millisecond)
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning, CreatedAt: created, StartedAt: &started}
+
+	server.recordResult(exec, &executor.ExecutionOutput{
+		Timings: &client.Timings{PullMs: 10, InstallMs: 2000, RunMs: 300},
+	}, nil)
+
+	want := client.Timings{QueueMs: 1500, PullMs: 10, InstallMs: 2000, RunMs: 300}
+	if got := exec.ToExecutionResult().Timings; got == nil || *got != want {
+		t.Errorf("timings = %+v, want %+v", got, want)
+	}
+}
+
+// phasedExecutor is a fakeExecutor that reports phases, recording the
+// phase a status poll sees after each
+type phasedExecutor struct {
+	fakeExecutor
+	store storage.Storage
+	seen  []client.ExecutionPhase
+}
+
+func (f *phasedExecutor) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	for _, phase := range []client.ExecutionPhase{client.PhasePulling, client.PhaseInstalling, client.PhaseRunning} {
+		req.OnPhase(phase)
+		exec, _ := f.store.Get(ctx, req.ID)
+		f.seen = append(f.seen, exec.ToExecutionResult().Phase)
+	}
+	return f.fakeExecutor.Execute(ctx, req)
+}
+
+func TestRunExecution_Phases(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	fake := &phasedExecutor{store: store}
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+	ctx := context.Background()
+
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+	store.Create(ctx, exec)
+	output, err := server.runExecution(ctx, exec, &executor.ExecutionRequest{ID: "exe_1"})
+	want := []client.ExecutionPhase{client.PhasePulling, client.PhaseInstalling, client.PhaseRunning}
+	if !reflect.DeepEqual(fake.seen, want) {
+		t.Errorf("phases = %v, want %v", fake.seen, want)
+	}
+
+	// A finished execution is in no phase
+	server.recordResult(exec, output, err)
+	server.finishExecution(ctx, exec)
+	if got, _ := store.Get(ctx, "exe_1"); got.Phase != "" {
+		t.Errorf("finished execution phase = %q", got.Phase)
+	}
+}
+
+func TestRecordResult_ParsesEvalResult(t *testing.T) {
+	server := &Server{}
+	exec := &storage.Execution{
+		ID:       "exe_1",
+		Status:   client.StatusRunning,
+		Metadata: &client.Metadata{EvalLastExpr: true},
+	}
+
+	server.recordResult(exec, &executor.ExecutionOutput{
+		Stdout:   "hello\n" + executor.ResultMarker + "\"42\"\n",
+		Combined: "hello\nwarning\n" + executor.ResultMarker + "\"42\"\n",
+	}, nil)
+
+	result := exec.ToExecutionResult()
+	if result.Result == nil || *result.Result != "42" {
+		t.Errorf("result = %v, want 42", result.Result)
+	}
+	if result.Stdout != "hello" {
+		t.Errorf("stdout = %q, want marker stripped", result.Stdout)
+	}
+	if result.Output != "hello\nwarning" {
+		t.Errorf("output = %q, want marker stripped", result.Output)
+	}
+}
+
+func TestRecordResult_ParsesErrorDetails(t *testing.T) {
+	server := &Server{}
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+
+	server.recordResult(exec, &executor.ExecutionOutput{
+		ExitCode: 1,
+		Stderr:   "Traceback (most recent call last):\n  File \"/work/main.py\", line 3, in <module>\nNameError: name 'x' is not defined\n",
+	}, nil)
+
+	result := exec.ToExecutionResult()
+	if result.ErrorType != "NameError" {
+		t.Errorf("error type = %q, want NameError", result.ErrorType)
+	}
+	if result.ErrorLine != 3 {
+		t.Errorf("error line = %d, want 3", result.ErrorLine)
+	}
+}
+
+func TestFinishExecution_PreservesKilled(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	ctx := context.Background()
+
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+	if err := memStorage.Create(ctx, exec); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a concurrent kill
+	killed := &storage.Execution{ID: "exe_1", Status: client.StatusKilled}
+	memStorage.Update(ctx, killed)
+
+	server.recordResult(exec, &executor.ExecutionOutput{ExitCode: 137}, nil)
+	server.finishExecution(ctx, exec)
+
+	got, _ := memStorage.Get(ctx, "exe_1")
+	if got.Status != client.StatusKilled {
+		t.Errorf("status = %q, want %q", got.Status, client.StatusKilled)
+	}
+	if got.ExitCode != 137 {
+		t.Errorf("exit code = %d, want 137", got.ExitCode)
+	}
+	if got.Signal != "SIGKILL" || got.Termination != client.TerminationKilled {
+		t.Errorf("termination = %q (%q), want SIGKILL (killed)", got.Signal, got.Termination)
+	}
+}
+
+// smallStorage refuses records with more than max bytes of stdout, as a
+// backend with a value size limit would
+type smallStorage struct {
+	*storage.MemoryStorage
+	max int
+}
+
+func (s *smallStorage) Update(ctx context.Context, exec *storage.Execution) error {
+	if len(exec.Stdout) > s.max {
+		return errors.New("value too large")
+	}
+	return s.MemoryStorage.Update(ctx, exec)
+}
+
+func TestFinishExecution_ResultTooLarge(t *testing.T) {
+	store := &smallStorage{MemoryStorage: storage.NewMemoryStorage(), max: 10}
+	server := &Server{storage: store}
+	ctx := context.Background()
+
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+	store.Create(ctx, exec)
+	server.recordResult(exec, &executor.ExecutionOutput{Stdout: strings.Repeat("x", 100)}, nil)
+	server.finishExecution(ctx, exec)
+
+	// The execution doesn't stay running
+	got, _ := store.Get(ctx, "exe_1")
+	if got.Status != client.StatusFailed || got.Stdout != "" || !strings.Contains(got.Error, "value too large") {
+		t.Errorf("execution = %s %q %q, want failed without its output", got.Status, got.Stdout, got.Error)
+	}
+}
+
+func TestKillExecution_CancelsPending(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	jobs := queue.NewMemoryQueue()
+	server := &Server{storage: memStorage, queue: jobs}
+	ctx := context.Background()
+
+	if err := memStorage.Create(ctx, &storage.Execution{ID: "exe_1", Status: client.StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	jobs.Enqueue(ctx, &queue.Job{ExecutionID: "exe_1"})
+
+	router := gin.New()
+	router.DELETE("/executions/:id", server.KillExecution)
+
+	req := httptest.NewRequest(http.MethodDelete, "/executions/exe_1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"cancelled"`) {
+		t.Errorf("response body = %q, want cancelled status", w.Body.String())
+	}
+
+	got, _ := memStorage.Get(ctx, "exe_1")
+	if got.Status != client.StatusCancelled {
+		t.Errorf("stored status = %q, want %q", got.Status, client.StatusCancelled)
+	}
+	if n, _ := jobs.Len(ctx); n != 0 {
+		t.Errorf("queue length = %d, want the cancelled job removed", n)
+	}
+
+	// The async worker must skip a cancelled execution without touching it
+	server.acquire()
+	server.executeAsync("exe_1", nil, &client.Metadata{Entrypoint: "main.py"})
+	got, _ = memStorage.Get(ctx, "exe_1")
+	if got.Status != client.StatusCancelled || got.StartedAt != nil {
+		t.Errorf("cancelled execution was started: %+v", got)
+	}
+}
+
+func TestKillExecution_StartedMeanwhile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	// A worker starts the execution after the kill has read it as pending
+	store := &staleStorage{
+		MemoryStorage: storage.NewMemoryStorage(),
+		stale:         map[string]*storage.Execution{"exe_1": {ID: "exe_1", Status: client.StatusPending}},
+	}
+	store.Create(ctx, &storage.Execution{ID: "exe_1", Status: client.StatusRunning})
+	server := &Server{storage: store}
+
+	router := gin.New()
+	router.DELETE("/executions/:id", server.KillExecution)
+	req := httptest.NewRequest(http.MethodDelete, "/executions/exe_1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"killed"`) {
+		t.Errorf("response = %d %s, want killed", w.Code, w.Body.String())
+	}
+	got, _ := store.MemoryStorage.Get(ctx, "exe_1")
+	if got.Status != client.StatusKilled || got.FinishedAt != nil {
+		t.Errorf("running execution was cancelled instead of killed: %+v", got)
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		status     client.ExecutionStatus
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid update", status: client.StatusRunning, token: "secret", body: `{"percent": 40, "message": "step 2"}`, wantStatus: http.StatusOK},
+		{name: "heartbeat", status: client.StatusRunning, token: "secret", body: "", wantStatus: http.StatusOK},
+		{name: "wrong token", status: client.StatusRunning, token: "guess", body: `{"percent": 40}`, wantStatus: http.StatusForbidden},
+		{name: "missing token", status: client.StatusRunning, token: "", body: `{"percent": 40}`, wantStatus: http.StatusForbidden},
+		{name: "percent out of range", status: client.StatusRunning, token: "secret", body: `{"percent": 140}`, wantStatus: http.StatusBadRequest},
+		{name: "not running", status: client.StatusCompleted, token: "secret", body: `{"percent": 40}`, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStorage := storage.NewMemoryStorage()
+			server := &Server{storage: memStorage}
+			ctx := context.Background()
+
+			memStorage.Create(ctx, &storage.Execution{ID: "exe_1", Status: tt.status, ProgressToken: "secret"})
+
+			router := gin.New()
+			router.POST("/executions/:id/progress", server.ReportProgress)
+
+			req := httptest.NewRequest(http.MethodPost, "/executions/exe_1/progress", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set(ProgressTokenHeader, tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			got, _ := memStorage.Get(ctx, "exe_1")
+			if tt.wantStatus != http.StatusOK {
+				if got.Progress != nil {
+					t.Errorf("progress recorded on rejected report: %+v", got.Progress)
+				}
+				return
+			}
+			if got.Progress == nil || got.Progress.UpdatedAt.IsZero() {
+				t.Fatalf("progress not recorded: %+v", got.Progress)
+			}
+		})
+	}
+}
+
+// staleStorage reads executions once as they were when the test began,
+// then as stored
+type staleStorage struct {
+	*storage.MemoryStorage
+	stale map[string]*storage.Execution
+}
+
+func (s *staleStorage) Get(ctx context.Context, id string) (*storage.Execution, error) {
+	if exec, ok := s.stale[id]; ok {
+		delete(s.stale, id)
+		return exec, nil
+	}
+	return s.MemoryStorage.Get(ctx, id)
+}
+
+func TestReportProgress_FinishedMeanwhile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	// The execution completes after the report has read it as running
+	store := &staleStorage{
+		MemoryStorage: storage.NewMemoryStorage(),
+		stale:         map[string]*storage.Execution{"exe_1": {ID: "exe_1", Status: client.StatusRunning, ProgressToken: "secret"}},
+	}
+	store.Create(ctx, &storage.Execution{ID: "exe_1", Status: client.StatusCompleted, Stdout: "done\n", ProgressToken: "secret"})
+	server := &Server{storage: store}
+
+	router := gin.New()
+	router.POST("/executions/:id/progress", server.ReportProgress)
+	req := httptest.NewRequest(http.MethodPost, "/executions/exe_1/progress", strings.NewReader(`{"percent": 90}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ProgressTokenHeader, "secret")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusConflict, w.Body.String())
+	}
+	got, _ := store.MemoryStorage.Get(ctx, "exe_1")
+	if got.Status != client.StatusCompleted || got.Stdout != "done\n" || got.Progress != nil {
+		t.Errorf("completed execution overwritten: %+v", got)
+	}
+}
+
+func TestMergeProgress_KeepsOmittedFields(t *testing.T) {
+	percent := 25.0
+	prev := &client.Progress{Percent: &percent, Message: "loading"}
+
+	got := mergeProgress(prev, &client.ProgressUpdate{Message: "training"}, time.Now())
+	if got.Percent == nil || *got.Percent != 25 {
+		t.Errorf("percent = %v, want 25", got.Percent)
+	}
+	if got.Message != "training" {
+		t.Errorf("message = %q, want %q", got.Message, "training")
+	}
+}
+
+// multipartExecRequest builds an exec request with a tar, metadata and
+// optional stdin part
+func multipartExecRequest(t *testing.T, path, metadata string, stdin []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(input())"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, _ := w.CreateFormFile("tar", "code.tar")
+	part.Write(tarData)
+	w.WriteField("metadata", metadata)
+	if stdin != nil {
+		part, _ = w.CreateFormFile("stdin", "stdin")
+		part.Write(stdin)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestExecuteSync_StreamsStdinPart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py"}`, []byte("large input\n")))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if string(fake.stdin) != "large input\n" {
+		t.Errorf("executor stdin = %q, want %q", fake.stdin, "large input\n")
+	}
+}
+
+func TestExecute_RejectsInvalidStdinPart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.POST("/exec/async", server.ExecuteAsync)
+
+	tests := []struct {
+		name     string
+		path     string
+		metadata string
+	}{
+		{name: "stdin in metadata and part", path: "/exec/sync", metadata: `{"entrypoint":"main.py","stdin":"x"}`},
+		{name: "stdin part on async", path: "/exec/async", metadata: `{"entrypoint":"main.py"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, multipartExecRequest(t, tt.path, tt.metadata, []byte("data")))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExecute_RejectsArchiveOverLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Server: config.ServerConfig{MaxExtractFiles: 1}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	router := gin.New()
+	router.POST("/exec/async", server.ExecuteAsync)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(1)"}, {Name: "b.py"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, _ := w.CreateFormFile("tar", "code.tar")
+	part.Write(tarData)
+	w.WriteField("metadata", `{"entrypoint":"main.py"}`)
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/exec/async", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d (body %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "more than 1 files") {
+		t.Errorf("body = %s, want the limit named", rec.Body.String())
+	}
+}
+
+func TestExecuteSync_GzipArchive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(1)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(tarData)
+	zw.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("tar", "code.tar.gz")
+	part.Write(gz.Bytes())
+	w.WriteField("metadata", `{"entrypoint":"main.py"}`)
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/exec/sync", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if len(fake.requests) != 1 || !bytes.Equal(fake.requests[0].TarData, tarData) {
+		t.Error("executor did not get the decompressed archive")
+	}
+}
+
+// fakeExecutor is an in-process Executor used to exercise handlers without Docker
+type fakeExecutor struct {
+	mu         sync.Mutex
+	output     *executor.ExecutionOutput
+	err        error
+	containers map[string]string
+	attached   []string
+	killed     []string
+	requests   []*executor.ExecutionRequest
+	stdin      []byte // contents of the last streamed stdin
+}
+
+func (f *fakeExecutor) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	if req.Stdin != nil {
+		f.stdin, _ = io.ReadAll(req.Stdin)
+	}
+	f.mu.Unlock()
+
+	if req.OnContainerCreated != nil {
+		req.OnContainerCreated("container-" + req.ID)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.output != nil {
+		out := *f.output
+		return &out, nil
+	}
+	return &executor.ExecutionOutput{}, nil
+}
+
+func (f *fakeExecutor) Kill(ctx context.Context, containerID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.killed = append(f.killed, containerID)
+	return nil
+}
+
+func (f *fakeExecutor) ListContainers(ctx context.Context) (map[string]string, error) {
+	return f.containers, nil
+}
+
+func (f *fakeExecutor) Attach(ctx context.Context, containerID string) (*executor.ExecutionOutput, error) {
+	f.mu.Lock()
+	f.attached = append(f.attached, containerID)
+	f.mu.Unlock()
+	return f.Execute(ctx, &executor.ExecutionRequest{})
+}
+
+func (f *fakeExecutor) Close() error {
+	return nil
+}
+
+func TestDrain(t *testing.T) {
+	server := &Server{}
+
+	if !server.acquire() {
+		t.Fatal("acquire() should succeed before draining")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Drain(context.Background())
+	}()
+
+	// Wait for draining to begin, then verify new work is rejected
+	for !server.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if server.acquire() {
+		t.Error("acquire() should fail while draining")
+	}
+
+	server.release()
+	if err := <-done; err != nil {
+		t.Errorf("Drain() error = %v", err)
+	}
+}
+
+func TestDrain_Timeout(t *testing.T) {
+	server := &Server{}
+	server.acquire()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := server.Drain(ctx); err == nil {
+		t.Error("Drain() should time out while an execution is in flight")
+	}
+	if server.InFlight() != 1 {
+		t.Errorf("InFlight() = %d, want 1", server.InFlight())
+	}
+}
+
+func TestWorker_RunsQueuedExecution(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	jobs := queue.NewMemoryQueue()
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{Stdout: "hi\n"}}
+	server := NewServer(memStorage, jobs, fake, &config.Config{
+		Server: config.ServerConfig{NodeID: "node-a"},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := memStorage.Create(ctx, &storage.Execution{ID: "exe_1", Status: client.StatusPending}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Enqueue(ctx, &queue.Job{ExecutionID: "exe_1", Metadata: &client.Metadata{Entrypoint: "main.py"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.StartWorkers(ctx, 1)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := memStorage.Get(ctx, "exe_1")
+		if got.Status == client.StatusCompleted {
+			if got.Node != "node-a" || got.ContainerID != "container-exe_1" {
+				t.Errorf("node = %q, container = %q; want node-a and container-exe_1", got.Node, got.ContainerID)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("queued execution did not complete, status = %q", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/internal/imports"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// Inspect describes an archive without running it
+// @Summary Inspect an archive
+// @Description Return an archive's files, total size, the entrypoint that would
+// @Description run and the third-party packages its code imports, without
+// @Description executing anything. The request is the same multipart form as the
+// @Description exec endpoints, but metadata is optional; give it to name an
+// @Description upload_id or archive_sha256, or to check an entrypoint or mode.
+// @Tags execution
+// @Accept multipart/form-data
+// @Produce json
+// @Param tar formData file false "Tar archive, optionally gzip-compressed. Omitted when the metadata has upload_id or archive_sha256"
+// @Param metadata formData string false "Execution metadata as JSON"
+// @Success 200 {object} client.InspectResult "Archive contents"
+// @Failure 400 {object} gin.H "Invalid request or archive over the extraction limits"
+// @Failure 404 {object} gin.H "archive_sha256 or upload_id not found"
+// @Router /inspect [post]
+func (s *Server) Inspect(c *gin.Context) {
+	if err := c.Request.ParseMultipartForm(100 << 20); err != nil { // 100 MB max
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parsing form: %v", err)})
+		return
+	}
+
+	var metadata client.Metadata
+	if metadataStr := c.Request.FormValue("metadata"); metadataStr != "" {
+		if err := json.Unmarshal([]byte(metadataStr), &metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parsing metadata: %v", err)})
+			return
+		}
+	}
+
+	tarData, err := s.requestArchive(c, &metadata)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := inspectArchive(tarData, &metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// inspectArchive describes an uncompressed archive as metadata would run it
+func inspectArchive(tarData []byte, metadata *client.Metadata) (*client.InspectResult, error) {
+	result := &client.InspectResult{
+		Files:        []client.InspectedFile{},
+		Entrypoint:   metadata.Entrypoint,
+		Requirements: []string{},
+	}
+
+	reader := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar: %w", err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		result.Files = append(result.Files, client.InspectedFile{
+			Name: header.Name,
+			Size: header.Size,
+			Mode: fmt.Sprintf("%04o", header.FileInfo().Mode().Perm()),
+			Link: header.Linkname,
+		})
+		result.TotalSize += header.Size
+	}
+
+	// pytest discovers the tests itself
+	if result.Entrypoint == "" && metadata.Mode != client.ModePytest {
+		result.Entrypoint, _ = client.DetectEntrypoint(tarData)
+	}
+
+	sources, err := imports.SourceFiles(tarData)
+	if err != nil {
+		return nil, err
+	}
+	requirements, err := imports.FileRequirements(sources)
+	if err != nil {
+		return nil, err
+	}
+	for _, req := range strings.Split(requirements, "\n") {
+		if req != "" {
+			result.Requirements = append(result.Requirements, req)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// inspectRequest builds an inspect request with a tar part of files and,
+// if it isn't empty, metadata
+func inspectRequest(t *testing.T, files []client.CodeFile, metadata string) *http.Request {
+	t.Helper()
+
+	tarData, err := buildTarFromFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, _ := w.CreateFormFile("tar", "code.tar")
+	part.Write(tarData)
+	if metadata != "" {
+		w.WriteField("metadata", metadata)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/inspect", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestInspect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+	router := gin.New()
+	router.POST("/inspect", server.Inspect)
+
+	files := []client.CodeFile{
+		{Name: "app/__main__.py", Content: "import requests\nfrom app import util"},
+		{Name: "app/util.py", Content: "import numpy as np\nimport os"},
+		{Name: "run.sh", Content: "#!/bin/sh\n", Mode: "0755"},
+	}
+
+	tests := []struct {
+		name     string
+		metadata string
+		want     client.InspectResult
+	}{
+		{
+			name: "detected entrypoint",
+			want: client.InspectResult{
+				Files: []client.InspectedFile{
+					{Name: "app/__main__.py", Size: 36, Mode: "0644"},
+					{Name: "app/util.py", Size: 28, Mode: "0644"},
+					{Name: "run.sh", Size: 10, Mode: "0755"},
+				},
+				TotalSize:    74,
+				Entrypoint:   "app/__main__.py",
+				Requirements: []string{"numpy", "requests"},
+			},
+		},
+		{
+			name:     "named entrypoint",
+			metadata: `{"entrypoint":"app/util.py"}`,
+			want:     client.InspectResult{Entrypoint: "app/util.py"},
+		},
+		{
+			name:     "pytest",
+			metadata: `{"mode":"pytest"}`,
+			want:     client.InspectResult{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, inspectRequest(t, files, tt.metadata))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d (body %s)", w.Code, w.Body.String())
+			}
+
+			var got client.InspectResult
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Entrypoint != tt.want.Entrypoint {
+				t.Errorf("entrypoint = %q, want %q", got.Entrypoint, tt.want.Entrypoint)
+			}
+			if tt.want.Files != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if len(fake.requests) != 0 {
+		t.Errorf("executor ran %d requests, want none", len(fake.requests))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, metadataOnlyRequest("/inspect", `{}`))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("inspect without archive status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,631 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// The Jupyter kernel gateway endpoints expose sessions as remote kernels,
+// so that notebook servers (jupyter --gateway-url) and jupyter_client
+// based tools can run code in python-executor containers. They follow
+// the Kernel Gateway REST API and speak the kernel messaging protocol as
+// JSON over the channels WebSocket, supporting the subset of messages a
+// Python kernel without IPython needs.
+
+// jupyterProtocolVersion is the kernel messaging protocol version spoken
+// on the channels WebSocket
+const jupyterProtocolVersion = "5.3"
+
+// defaultKernelName is the kernel spec that runs the default image
+const defaultKernelName = "python3"
+
+// kernelSpec is an entry of GET /api/kernelspecs
+type kernelSpec struct {
+	Name      string            `json:"name"`
+	Spec      kernelSpecFile    `json:"spec"`
+	Resources map[string]string `json:"resources"`
+}
+
+// kernelSpecFile is a kernel spec's kernel.json
+type kernelSpecFile struct {
+	Argv          []string       `json:"argv"`
+	DisplayName   string         `json:"display_name"`
+	Language      string         `json:"language"`
+	InterruptMode string         `json:"interrupt_mode"`
+	Env           map[string]any `json:"env"`
+	Metadata      map[string]any `json:"metadata"`
+}
+
+// kernelModel describes a running kernel
+type kernelModel struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	LastActivity   time.Time `json:"last_activity"`
+	ExecutionState string    `json:"execution_state"`
+	Connections    int       `json:"connections"`
+}
+
+// startKernelRequest is the body of POST /api/kernels
+type startKernelRequest struct {
+	Name string            `json:"name"`
+	Env  map[string]string `json:"env"`
+}
+
+// kernelPythonVersions maps kernel spec names to python_version values.
+// The default kernel has no version and runs the default image.
+func kernelPythonVersions() map[string]string {
+	versions := map[string]string{defaultKernelName: ""}
+	for version := range pythonVersionImages {
+		versions["python"+version] = version
+	}
+	return versions
+}
+
+// kernelSpecs returns the kernel specs by name
+func kernelSpecs() map[string]kernelSpec {
+	specs := make(map[string]kernelSpec)
+	for name, version := range kernelPythonVersions() {
+		displayName := "Python 3 (python-executor)"
+		if version != "" {
+			displayName = fmt.Sprintf("Python %s (python-executor)", version)
+		}
+		specs[name] = kernelSpec{
+			Name: name,
+			Spec: kernelSpecFile{
+				Argv:          []string{},
+				DisplayName:   displayName,
+				Language:      "python",
+				InterruptMode: "message",
+				Env:           map[string]any{},
+				Metadata:      map[string]any{},
+			},
+			Resources: map[string]string{},
+		}
+	}
+	return specs
+}
+
+// kernelInfo returns the model of a session as a kernel. The caller holds
+// sessionsMu.
+func kernelInfo(sess *session) kernelModel {
+	name := sess.kernelName
+	if name == "" {
+		name = defaultKernelName
+	}
+	state := "idle"
+	if sess.running {
+		state = "busy"
+	}
+	return kernelModel{
+		ID:             sess.info.ID,
+		Name:           name,
+		LastActivity:   sess.info.LastUsedAt,
+		ExecutionState: state,
+		Connections:    sess.connections,
+	}
+}
+
+// ListKernelSpecs lists the kernels that can be started
+// @Summary List Jupyter kernel specs
+// @Description List a kernel spec per supported Python version, plus
+// @Description python3 for the default image, as the Jupyter Kernel Gateway does.
+// @Tags jupyter
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Kernel specs"
+// @Router /kernelspecs [get]
+func (s *Server) ListKernelSpecs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"default":     defaultKernelName,
+		"kernelspecs": kernelSpecs(),
+	})
+}
+
+// GetKernelSpec describes a kernel spec
+// @Summary Get a Jupyter kernel spec
+// @Tags jupyter
+// @Produce json
+// @Param name path string true "Kernel spec name"
+// @Success 200 {object} map[string]interface{} "Kernel spec"
+// @Failure 404 {object} gin.H "Kernel spec not found"
+// @Router /kernelspecs/{name} [get]
+func (s *Server) GetKernelSpec(c *gin.Context) {
+	spec, ok := kernelSpecs()[c.Param("name")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kernel spec not found"})
+		return
+	}
+	c.JSON(http.StatusOK, spec)
+}
+
+// ListKernels lists the running kernels
+// @Summary List Jupyter kernels
+// @Description List the caller's sessions open on this instance as kernels,
+// @Description including sessions started through /api/v1/sessions. Admin
+// @Description keys see every caller's.
+// @Tags jupyter
+// @Produce json
+// @Success 200 {array} map[string]interface{} "Kernels"
+// @Router /kernels [get]
+func (s *Server) ListKernels(c *gin.Context) {
+	s.sessionsMu.Lock()
+	kernels := make([]kernelModel, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		if canUseSession(c, sess) {
+			kernels = append(kernels, kernelInfo(sess))
+		}
+	}
+	s.sessionsMu.Unlock()
+
+	sort.Slice(kernels, func(i, j int) bool { return kernels[i].ID < kernels[j].ID })
+	c.JSON(http.StatusOK, kernels)
+}
+
+// StartKernel starts a kernel
+// @Summary Start a Jupyter kernel
+// @Description Start a session for the named kernel spec. env is passed to
+// @Description the interpreter as environment variables. Kernel evals have
+// @Description no timeout; the kernel is closed after the session idle
+// @Description timeout once no client is connected.
+// @Tags jupyter
+// @Accept json
+// @Produce json
+// @Param request body map[string]interface{} false "Kernel name and env"
+// @Success 201 {object} map[string]interface{} "Kernel started"
+// @Failure 400 {object} gin.H "Invalid request"
+// @Failure 403 {object} gin.H "The kernel matches an approval rule"
+// @Failure 404 {object} gin.H "Kernel spec not found"
+// @Failure 422 {object} gin.H "Installing dependencies failed"
+// @Failure 429 {object} gin.H "Too many open sessions, the tenant has used up its usage budget, or the caller has its most executions and sessions unfinished"
+// @Failure 500 {object} gin.H "Starting the kernel failed"
+// @Failure 501 {object} gin.H "Sessions are not supported"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /kernels [post]
+func (s *Server) StartKernel(c *gin.Context) {
+	if _, ok := s.sessionExecutor(); !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "sessions are not supported by this executor"})
+		return
+	}
+
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
+	var req startKernelRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+			return
+		}
+	}
+	if req.Name == "" {
+		req.Name = defaultKernelName
+	}
+	version, ok := kernelPythonVersions()[req.Name]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("kernel spec %q not found", req.Name)})
+		return
+	}
+
+	envVars := make([]string, 0, len(req.Env))
+	for k, v := range req.Env {
+		envVars = append(envVars, k+"="+v)
+	}
+	sort.Strings(envVars)
+
+	sess, err := s.openSession(c.Request.Context(), &client.CreateSessionRequest{
+		PythonVersion: version,
+		EnvVars:       envVars,
+	}, req.Name, callerOf(c), tenantOf(c))
+	if err != nil {
+		sessionError(c, err)
+		return
+	}
+
+	s.sessionsMu.Lock()
+	kernel := kernelInfo(sess)
+	s.sessionsMu.Unlock()
+	c.JSON(http.StatusCreated, kernel)
+}
+
+// GetKernel describes a kernel
+// @Summary Get a Jupyter kernel
+// @Tags jupyter
+// @Produce json
+// @Param id path string true "Kernel (session) ID"
+// @Success 200 {object} map[string]interface{} "Kernel"
+// @Failure 404 {object} gin.H "Kernel not found"
+// @Router /kernels/{id} [get]
+func (s *Server) GetKernel(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kernel not found"})
+		return
+	}
+
+	s.sessionsMu.Lock()
+	kernel := kernelInfo(sess)
+	s.sessionsMu.Unlock()
+	c.JSON(http.StatusOK, kernel)
+}
+
+// InterruptKernel interrupts the code a kernel is running
+// @Summary Interrupt a Jupyter kernel
+// @Description Raise KeyboardInterrupt in the code the kernel is running.
+// @Tags jupyter
+// @Param id path string true "Kernel (session) ID"
+// @Success 204 "Kernel interrupted"
+// @Failure 404 {object} gin.H "Kernel not found"
+// @Failure 500 {object} gin.H "Interrupting the kernel failed"
+// @Router /kernels/{id}/interrupt [post]
+func (s *Server) InterruptKernel(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kernel not found"})
+		return
+	}
+	if err := s.interruptSession(c.Request.Context(), sess); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("interrupting kernel: %v", err)})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RestartKernel restarts a kernel
+// @Summary Restart a Jupyter kernel
+// @Description Replace the kernel's interpreter with a fresh one, discarding
+// @Description its variables. The kernel keeps its ID.
+// @Tags jupyter
+// @Produce json
+// @Param id path string true "Kernel (session) ID"
+// @Success 200 {object} map[string]interface{} "Kernel restarted"
+// @Failure 404 {object} gin.H "Kernel not found"
+// @Failure 500 {object} gin.H "Restarting the kernel failed"
+// @Router /kernels/{id}/restart [post]
+func (s *Server) RestartKernel(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kernel not found"})
+		return
+	}
+	if err := s.restartSession(c.Request.Context(), sess); err != nil {
+		sessionError(c, err)
+		return
+	}
+
+	s.sessionsMu.Lock()
+	kernel := kernelInfo(sess)
+	s.sessionsMu.Unlock()
+	c.JSON(http.StatusOK, kernel)
+}
+
+// KernelChannels connects to a kernel's channels
+// @Summary Connect to a Jupyter kernel's channels
+// @Description Upgrade to a WebSocket carrying kernel protocol messages as
+// @Description JSON, each with a channel field (shell, control or iopub).
+// @Description Shell requests run one at a time in the order received;
+// @Description control requests are handled as they arrive.
+// @Tags jupyter
+// @Param id path string true "Kernel (session) ID"
+// @Success 101 "Switching protocols"
+// @Failure 404 {object} gin.H "Kernel not found"
+// @Router /kernels/{id}/channels [get]
+func (s *Server) KernelChannels(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "kernel not found"})
+		return
+	}
+
+	conn, err := s.upgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has written the error response
+		return
+	}
+	defer conn.Close()
+
+	s.sessionsMu.Lock()
+	sess.connections++
+	s.sessionsMu.Unlock()
+	defer func() {
+		s.sessionsMu.Lock()
+		sess.connections--
+		sess.touch(time.Now().UTC())
+		s.sessionsMu.Unlock()
+	}()
+
+	k := &kernelConn{
+		server:  s,
+		sess:    sess,
+		conn:    conn,
+		session: uuid.New().String(),
+		closed:  make(chan struct{}),
+	}
+	defer close(k.closed)
+
+	// Shell requests run in order on their own goroutine, so that control
+	// requests such as interrupts are read while code runs
+	shell := make(chan *jupyterMessage, 64)
+	defer close(shell)
+	go func() {
+		for msg := range shell {
+			k.handle(msg)
+		}
+	}()
+
+	for {
+		var msg jupyterMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Channel {
+		case "shell":
+			shell <- &msg
+		case "control":
+			k.handle(&msg)
+		}
+	}
+}
+
+// jupyterHeader is a kernel message header
+type jupyterHeader struct {
+	MsgID    string `json:"msg_id"`
+	Username string `json:"username"`
+	Session  string `json:"session"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// jupyterMessage is a kernel message in the WebSocket JSON encoding
+type jupyterMessage struct {
+	Header       jupyterHeader   `json:"header"`
+	ParentHeader json.RawMessage `json:"parent_header"`
+	Metadata     map[string]any  `json:"metadata"`
+	Content      json.RawMessage `json:"content"`
+	Buffers      []any           `json:"buffers"`
+	Channel      string          `json:"channel"`
+}
+
+// kernelConn is a client connected to a kernel's channels
+type kernelConn struct {
+	server  *Server
+	sess    *session
+	conn    *websocket.Conn
+	session string        // the kernel's session ID in message headers
+	closed  chan struct{} // closed when the client disconnects
+
+	writeMu sync.Mutex
+}
+
+// send writes a message in reply to parent. Errors are ignored: a client
+// that went away gets no more messages, and its code still runs.
+func (k *kernelConn) send(channel string, parent *jupyterMessage, msgType string, content any) {
+	contentJSON, _ := json.Marshal(content)
+	parentJSON, _ := json.Marshal(parent.Header)
+	msg := jupyterMessage{
+		Header: jupyterHeader{
+			MsgID:    uuid.New().String(),
+			Username: parent.Header.Username,
+			Session:  k.session,
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			MsgType:  msgType,
+			Version:  jupyterProtocolVersion,
+		},
+		ParentHeader: parentJSON,
+		Metadata:     map[string]any{},
+		Content:      contentJSON,
+		Buffers:      []any{},
+		Channel:      channel,
+	}
+
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	k.conn.WriteJSON(msg)
+}
+
+// reply answers a shell or control request on its own channel
+func (k *kernelConn) reply(req *jupyterMessage, content any) {
+	msgType := strings.TrimSuffix(req.Header.MsgType, "_request") + "_reply"
+	k.send(req.Channel, req, msgType, content)
+}
+
+// handle answers a request, bracketed by busy and idle status messages on
+// iopub as clients expect. Unsupported requests are ignored.
+func (k *kernelConn) handle(req *jupyterMessage) {
+	select {
+	case <-k.closed:
+		return
+	default:
+	}
+
+	k.send("iopub", req, "status", gin.H{"execution_state": "busy"})
+	defer k.send("iopub", req, "status", gin.H{"execution_state": "idle"})
+
+	switch req.Header.MsgType {
+	case "execute_request":
+		k.execute(req)
+	case "kernel_info_request":
+		k.reply(req, k.kernelInfoReply())
+	case "complete_request":
+		var content struct {
+			CursorPos int `json:"cursor_pos"`
+		}
+		json.Unmarshal(req.Content, &content)
+		k.reply(req, gin.H{
+			"status":       "ok",
+			"matches":      []string{},
+			"cursor_start": content.CursorPos,
+			"cursor_end":   content.CursorPos,
+			"metadata":     gin.H{},
+		})
+	case "inspect_request":
+		k.reply(req, gin.H{"status": "ok", "found": false, "data": gin.H{}, "metadata": gin.H{}})
+	case "is_complete_request":
+		k.reply(req, gin.H{"status": "unknown"})
+	case "history_request":
+		k.reply(req, gin.H{"status": "ok", "history": []any{}})
+	case "comm_info_request":
+		k.reply(req, gin.H{"status": "ok", "comms": gin.H{}})
+	case "interrupt_request":
+		if err := k.server.interruptSession(context.Background(), k.sess); err != nil {
+			k.reply(req, gin.H{"status": "error", "ename": "InterruptError", "evalue": err.Error(), "traceback": []string{}})
+			return
+		}
+		k.reply(req, gin.H{"status": "ok"})
+	case "shutdown_request":
+		k.shutdown(req)
+	}
+}
+
+// kernelInfoReply describes the kernel and its language
+func (k *kernelConn) kernelInfoReply() gin.H {
+	version := kernelPythonVersions()[k.sess.kernelName]
+	if version == "" {
+		version = "3"
+	}
+
+	return gin.H{
+		"status":           "ok",
+		"protocol_version": jupyterProtocolVersion,
+		"implementation":   "python-executor",
+		"language_info": gin.H{
+			"name":               "python",
+			"version":            version,
+			"mimetype":           "text/x-python",
+			"file_extension":     ".py",
+			"pygments_lexer":     "python3",
+			"codemirror_mode":    gin.H{"name": "python", "version": 3},
+			"nbconvert_exporter": "python",
+		},
+		"banner":     "Python " + version + " (python-executor session " + k.sess.info.ID + ")",
+		"help_links": []any{},
+	}
+}
+
+// execute runs an execute_request's code in the session, publishing its
+// output on iopub
+func (k *kernelConn) execute(req *jupyterMessage) {
+	var content struct {
+		Code         string `json:"code"`
+		Silent       bool   `json:"silent"`
+		StoreHistory *bool  `json:"store_history"`
+	}
+	json.Unmarshal(req.Content, &content)
+	storeHistory := !content.Silent && (content.StoreHistory == nil || *content.StoreHistory)
+
+	s := k.server
+	s.sessionsMu.Lock()
+	if storeHistory {
+		k.sess.executionCount++
+	}
+	count := k.sess.executionCount
+	s.sessionsMu.Unlock()
+
+	if !content.Silent {
+		k.send("iopub", req, "execute_input", gin.H{"code": content.Code, "execution_count": count})
+	}
+
+	fail := func(ename, evalue string, traceback []string) {
+		errContent := gin.H{"ename": ename, "evalue": evalue, "traceback": traceback}
+		if !content.Silent {
+			k.send("iopub", req, "error", errContent)
+		}
+		errContent["status"] = "error"
+		errContent["execution_count"] = count
+		k.reply(req, errContent)
+	}
+
+	if strings.TrimSpace(content.Code) == "" {
+		k.reply(req, gin.H{"status": "ok", "execution_count": count, "payload": []any{}, "user_expressions": gin.H{}})
+		return
+	}
+	if len(content.Code) > maxCodeSize {
+		fail("ValueError", fmt.Sprintf("code size %d bytes exceeds limit of %d bytes", len(content.Code), maxCodeSize), []string{})
+		return
+	}
+
+	if !s.acquire() {
+		fail("RuntimeError", errDraining, []string{})
+		return
+	}
+	output, err := s.runInSession(context.Background(), k.sess, content.Code, 0)
+	s.release()
+
+	if errors.Is(err, executor.ErrTimeout) {
+		msg := fmt.Sprintf("eval timed out after %s and was interrupted", k.sess.timeout)
+		fail("TimeoutError", msg, []string{"TimeoutError: " + msg})
+		return
+	}
+	if err != nil {
+		fail("RuntimeError", fmt.Sprintf("running code: %v", err), []string{})
+		return
+	}
+
+	if !content.Silent {
+		if output.Stdout != "" {
+			k.send("iopub", req, "stream", gin.H{"name": "stdout", "text": output.Stdout})
+		}
+		// The traceback is sent with the error instead
+		if stderr := strings.TrimSuffix(output.Stderr, output.Traceback); stderr != "" {
+			k.send("iopub", req, "stream", gin.H{"name": "stderr", "text": stderr})
+		}
+	}
+
+	if output.Error != "" {
+		evalue := strings.TrimPrefix(output.Error, output.ErrorType+": ")
+		traceback := strings.Split(strings.TrimRight(output.Traceback, "\n"), "\n")
+		fail(output.ErrorType, evalue, traceback)
+		return
+	}
+
+	if output.Result != nil && !content.Silent {
+		k.send("iopub", req, "execute_result", gin.H{
+			"execution_count": count,
+			"data":            gin.H{"text/plain": *output.Result},
+			"metadata":        gin.H{},
+		})
+	}
+	k.reply(req, gin.H{"status": "ok", "execution_count": count, "payload": []any{}, "user_expressions": gin.H{}})
+}
+
+// shutdown answers a shutdown_request by restarting the kernel or closing
+// its session
+func (k *kernelConn) shutdown(req *jupyterMessage) {
+	var content struct {
+		Restart bool `json:"restart"`
+	}
+	json.Unmarshal(req.Content, &content)
+
+	s := k.server
+	if content.Restart {
+		if err := s.restartSession(context.Background(), k.sess); err != nil {
+			k.reply(req, gin.H{"status": "error", "ename": "RestartError", "evalue": err.Error(), "traceback": []string{}, "restart": true})
+			return
+		}
+		k.reply(req, gin.H{"status": "ok", "restart": true})
+		return
+	}
+
+	s.sessionsMu.Lock()
+	if s.sessions[k.sess.info.ID] == k.sess {
+		delete(s.sessions, k.sess.info.ID)
+	}
+	s.sessionsMu.Unlock()
+	s.closeSession(context.Background(), k.sess)
+	k.reply(req, gin.H{"status": "ok", "restart": false})
+}
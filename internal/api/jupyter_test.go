@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// kernelClient sends requests on a kernel's channels and collects replies
+type kernelClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func (k *kernelClient) send(channel, msgType string, content any) {
+	k.t.Helper()
+	contentJSON, _ := json.Marshal(content)
+	msg := jupyterMessage{
+		Header:       jupyterHeader{MsgID: msgType + "-1", Session: "client", MsgType: msgType, Version: jupyterProtocolVersion},
+		ParentHeader: json.RawMessage(`{}`),
+		Content:      contentJSON,
+		Channel:      channel,
+	}
+	if err := k.conn.WriteJSON(msg); err != nil {
+		k.t.Fatalf("sending %s: %v", msgType, err)
+	}
+}
+
+// until reads messages up to and including one of type msgType
+func (k *kernelClient) until(msgType string) []jupyterMessage {
+	k.t.Helper()
+	k.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msgs []jupyterMessage
+	for {
+		var msg jupyterMessage
+		if err := k.conn.ReadJSON(&msg); err != nil {
+			k.t.Fatalf("reading until %s (got %d messages): %v", msgType, len(msgs), err)
+		}
+		msgs = append(msgs, msg)
+		if msg.Header.MsgType == msgType {
+			return msgs
+		}
+	}
+}
+
+// find returns the content of the first message of type msgType
+func find(msgs []jupyterMessage, msgType string) map[string]any {
+	for _, msg := range msgs {
+		if msg.Header.MsgType == msgType {
+			var content map[string]any
+			json.Unmarshal(msg.Content, &content)
+			return content
+		}
+	}
+	return nil
+}
+
+func TestKernelSpecs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeSessionExecutor{}, &config.Config{})
+	router := gin.New()
+	router.GET("/api/kernelspecs", server.ListKernelSpecs)
+	router.GET("/api/kernelspecs/:name", server.GetKernelSpec)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/kernelspecs", nil))
+	var specs struct {
+		Default     string                `json:"default"`
+		Kernelspecs map[string]kernelSpec `json:"kernelspecs"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &specs)
+	if specs.Default != "python3" || len(specs.Kernelspecs) != len(pythonVersionImages)+1 {
+		t.Fatalf("kernelspecs = %s, want python3 and one per Python version", w.Body.String())
+	}
+	if spec := specs.Kernelspecs["python3.12"].Spec; spec.DisplayName != "Python 3.12 (python-executor)" || spec.Language != "python" {
+		t.Errorf("python3.12 spec = %+v", spec)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/kernelspecs/python2", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown kernelspec status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestKernels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeSessionExecutor{}
+	cfg := &config.Config{Session: config.SessionConfig{Max: 4, IdleTimeout: time.Minute}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.GET("/api/kernels", server.ListKernels)
+	router.POST("/api/kernels", server.StartKernel)
+	router.GET("/api/kernels/:id", server.GetKernel)
+	router.POST("/api/kernels/:id/restart", server.RestartKernel)
+	router.GET("/api/kernels/:id/channels", server.KernelChannels)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/kernels", "application/json", strings.NewReader(`{"name":"python3.11","env":{"B":"2","A":"1"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kernel kernelModel
+	json.NewDecoder(resp.Body).Decode(&kernel)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(kernel.ID, "ses_") || kernel.Name != "python3.11" || kernel.ExecutionState != "idle" {
+		t.Fatalf("start = %d %+v", resp.StatusCode, kernel)
+	}
+	if meta := fake.started[0].Metadata; meta.DockerImage != "python:3.11-slim" || strings.Join(meta.EnvVars, " ") != "A=1 B=2" {
+		t.Errorf("start metadata = %+v, want the 3.11 image and sorted env", meta)
+	}
+
+	resp, err = http.Post(ts.URL+"/api/kernels", "application/json", strings.NewReader(`{"name":"ruby"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown kernel spec status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/kernels/"+kernel.ID+"/channels", nil)
+	if err != nil {
+		t.Fatalf("connecting to channels: %v", err)
+	}
+	defer conn.Close()
+	k := &kernelClient{t: t, conn: conn}
+
+	k.send("shell", "kernel_info_request", map[string]any{})
+	msgs := k.until("kernel_info_reply")
+	if info := find(msgs, "kernel_info_reply"); info["protocol_version"] != jupyterProtocolVersion {
+		t.Errorf("kernel_info_reply = %v", info)
+	}
+	if status := find(msgs, "status"); status["execution_state"] != "busy" || msgs[0].Channel != "iopub" {
+		t.Errorf("first message = %+v, want busy status on iopub", msgs[0])
+	}
+	if msgs[len(msgs)-1].Channel != "shell" || !strings.Contains(string(msgs[len(msgs)-1].ParentHeader), "kernel_info_request-1") {
+		t.Errorf("reply = %+v, want it on shell with the request as parent", msgs[len(msgs)-1])
+	}
+	k.until("status") // idle
+
+	// Code runs in the session, counting executions
+	k.send("shell", "execute_request", map[string]any{"code": "x = 1"})
+	k.until("execute_reply")
+	k.send("shell", "execute_request", map[string]any{"code": "x"})
+	msgs = k.until("execute_reply")
+	result := find(msgs, "execute_result")
+	if data, _ := result["data"].(map[string]any); data["text/plain"] != "x = 1;x" || result["execution_count"] != 2.0 {
+		t.Errorf("execute_result = %v, want the session's result and count 2", result)
+	}
+	if input := find(msgs, "execute_input"); input["code"] != "x" {
+		t.Errorf("execute_input = %v", input)
+	}
+
+	// An exception's traceback is sent as an error, not on stderr
+	k.send("shell", "execute_request", map[string]any{"code": "1/0"})
+	msgs = k.until("execute_reply")
+	var streams []string
+	for _, msg := range msgs {
+		if msg.Header.MsgType == "stream" {
+			var content map[string]string
+			json.Unmarshal(msg.Content, &content)
+			streams = append(streams, content["name"]+":"+content["text"])
+		}
+	}
+	if strings.Join(streams, "|") != "stdout:before\n|stderr:warning\n" {
+		t.Errorf("streams = %q", streams)
+	}
+	if e := find(msgs, "error"); e["ename"] != "ZeroDivisionError" || e["evalue"] != "division by zero" {
+		t.Errorf("error = %v", e)
+	}
+	if reply := find(msgs, "execute_reply"); reply["status"] != "error" || reply["execution_count"] != 3.0 {
+		t.Errorf("execute_reply = %v", reply)
+	}
+
+	// Control requests are answered while code runs
+	k.send("shell", "execute_request", map[string]any{"code": "sleep"})
+	k.send("control", "interrupt_request", map[string]any{})
+	msgs = k.until("execute_reply")
+	if reply := find(msgs, "execute_reply"); reply["ename"] != "KeyboardInterrupt" {
+		t.Errorf("execute_reply after interrupt = %v", reply)
+	}
+	if find(msgs, "interrupt_reply") == nil {
+		t.Errorf("no interrupt_reply in %d messages", len(msgs))
+	}
+	k.until("status") // idle
+
+	resp, err = http.Get(ts.URL + "/api/kernels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kernels []kernelModel
+	json.NewDecoder(resp.Body).Decode(&kernels)
+	resp.Body.Close()
+	if len(kernels) != 1 || kernels[0].Connections != 1 {
+		t.Errorf("kernels = %+v, want one with a connection", kernels)
+	}
+
+	// A restart keeps the ID and starts a fresh interpreter
+	resp, err = http.Post(ts.URL+"/api/kernels/"+kernel.ID+"/restart", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(fake.started) != 2 || fake.closed[0] != "container-1" {
+		t.Errorf("restart = %d, started %d, closed %v", resp.StatusCode, len(fake.started), fake.closed)
+	}
+	k.send("shell", "execute_request", map[string]any{"code": "y"})
+	msgs = k.until("execute_reply")
+	if data, _ := find(msgs, "execute_result")["data"].(map[string]any); data["text/plain"] != "y" {
+		t.Errorf("execute_result after restart = %v, want a fresh session", find(msgs, "execute_result"))
+	}
+	if reply := find(msgs, "execute_reply"); reply["execution_count"] != 1.0 {
+		t.Errorf("execution_count after restart = %v, want 1", reply["execution_count"])
+	}
+
+	k.send("control", "shutdown_request", map[string]any{"restart": false})
+	msgs = k.until("shutdown_reply")
+	if reply := find(msgs, "shutdown_reply"); reply["status"] != "ok" || len(fake.closed) != 2 {
+		t.Errorf("shutdown_reply = %v, closed %v", reply, fake.closed)
+	}
+	resp, err = http.Get(ts.URL + "/api/kernels/" + kernel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("kernel after shutdown status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// overloadRetryAfter is the Retry-After, in seconds, of submissions
+// rejected because the server is saturated
+const overloadRetryAfter = 5
+
+// errOverloaded is returned when a submission can't be admitted
+var errOverloaded = errors.New("server is at capacity; retry later")
+
+// rejectPolicy reports whether submissions are rejected, rather than
+// queued, while every run slot is taken
+func (s *Server) rejectPolicy() bool {
+	return s.config != nil && s.config.Queue.OverloadPolicy == config.OverloadReject
+}
+
+// takeSlot waits for a run slot, or for ctx to end. Every execution holds
+// one while it runs; without a concurrency limit there is always one free.
+func (s *Server) takeSlot(ctx context.Context) error {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.running.Add(1)
+	return nil
+}
+
+// tryTakeSlot takes a run slot if one is free
+func (s *Server) tryTakeSlot() bool {
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			return false
+		}
+	}
+	s.running.Add(1)
+	return true
+}
+
+// releaseSlot gives back a run slot
+func (s *Server) releaseSlot() {
+	s.running.Add(-1)
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// saturated reports whether every run slot is taken
+func (s *Server) saturated() bool {
+	return s.slots != nil && len(s.slots) == cap(s.slots)
+}
+
+// admitSync takes a run slot for a sync execution. Under the queue policy
+// it waits for one, unless too many requests are already waiting. It
+// returns errOverloaded if the request should be rejected.
+func (s *Server) admitSync(ctx context.Context) error {
+	if s.tryTakeSlot() {
+		return nil
+	}
+	if s.rejectPolicy() {
+		return errOverloaded
+	}
+
+	waiting := s.waiting.Add(1)
+	defer s.waiting.Add(-1)
+	if max := s.config.Queue.MaxWaiting; max > 0 && waiting > int64(max) {
+		return errOverloaded
+	}
+	return s.takeSlot(ctx)
+}
+
+// admitAsync checks whether n more executions may be queued: not while
+// every slot is taken under the reject policy, and not beyond the maximum
+// queue length under the queue policy
+func (s *Server) admitAsync(ctx context.Context, n int) error {
+	if s.rejectPolicy() {
+		if s.saturated() {
+			return errOverloaded
+		}
+		return nil
+	}
+
+	if s.config == nil || s.config.Queue.MaxLength <= 0 {
+		return nil
+	}
+	queued, err := s.queue.Len(ctx)
+	if err != nil {
+		return err
+	}
+	if queued+n > s.config.Queue.MaxLength {
+		return errOverloaded
+	}
+	return nil
+}
+
+// rejectOverloaded writes the response for a submission that was not
+// admitted
+func (s *Server) rejectOverloaded(c *gin.Context, err error) {
+	if !errors.Is(err, errOverloaded) {
+		if c.Request.Context().Err() == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check server load"})
+		}
+		return
+	}
+	s.rejected.Add(1)
+	c.Header("Retry-After", strconv.Itoa(overloadRetryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+}
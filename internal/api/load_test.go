@@ -0,0 +1,221 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// loadServer creates a server running at most one execution at a time
+func loadServer(policy string, configure func(*config.Config)) *Server {
+	cfg := &config.Config{}
+	cfg.Queue.MaxConcurrent = 1
+	cfg.Queue.OverloadPolicy = policy
+	if configure != nil {
+		configure(cfg)
+	}
+	return NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+}
+
+func TestOverload_Reject(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := loadServer(config.OverloadReject, nil)
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	// Every slot is taken: submissions are rejected at once
+	server.takeSlot(context.Background())
+	w := evalAs(router, "", "print(1)")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("Retry-After = %q, want 5", got)
+	}
+	if err := server.admitAsync(context.Background(), 1); !errors.Is(err, errOverloaded) {
+		t.Errorf("admitAsync() = %v, want errOverloaded", err)
+	}
+	if got := server.rejected.Load(); got != 1 {
+		t.Errorf("rejected = %d, want 1", got)
+	}
+
+	server.releaseSlot()
+	if w := evalAs(router, "", "print(1)"); w.Code != http.StatusOK {
+		t.Fatalf("status after release = %d (body %s)", w.Code, w.Body.String())
+	}
+	if err := server.admitAsync(context.Background(), 1); err != nil {
+		t.Errorf("admitAsync() after release = %v", err)
+	}
+	if got := server.running.Load(); got != 0 {
+		t.Errorf("running = %d, want 0", got)
+	}
+}
+
+func TestOverload_Queue(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := loadServer(config.OverloadQueue, func(cfg *config.Config) {
+		cfg.Queue.MaxWaiting = 1
+	})
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	// The first request waits for the slot; the second is one too many
+	server.takeSlot(context.Background())
+	done := make(chan int)
+	go func() {
+		done <- evalAs(router, "", "print(1)").Code
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for server.waiting.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("request never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if w := evalAs(router, "", "print(2)"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	server.releaseSlot()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("waiting request status = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiting request never ran")
+	}
+	if got := server.waiting.Load(); got != 0 {
+		t.Errorf("waiting = %d, want 0", got)
+	}
+}
+
+func TestOverload_MaxQueueLength(t *testing.T) {
+	server := loadServer(config.OverloadQueue, func(cfg *config.Config) {
+		cfg.Queue.MaxLength = 2
+	})
+	ctx := context.Background()
+
+	server.queue.Enqueue(ctx, &queue.Job{ExecutionID: "exe_1"})
+	if err := server.admitAsync(ctx, 1); err != nil {
+		t.Errorf("admitAsync(1) = %v, want nil", err)
+	}
+	if err := server.admitAsync(ctx, 2); !errors.Is(err, errOverloaded) {
+		t.Errorf("admitAsync(2) = %v, want errOverloaded", err)
+	}
+}
+
+func TestQueuePosition(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := loadServer(config.OverloadQueue, nil)
+	router := gin.New()
+	router.POST("/exec/async", server.ExecuteAsync)
+	router.GET("/executions/:id", server.GetExecution)
+
+	// With no workers running, submissions wait in the queue in order
+	var ids []string
+	for i := 1; i <= 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartExecRequest(t, "/exec/async", `{"entrypoint":"main.py"}`, nil))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("submission %d status = %d (body %s)", i, w.Code, w.Body.String())
+		}
+		var resp client.AsyncResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.QueuePosition != i {
+			t.Errorf("submission %d queue_position = %d, want %d", i, resp.QueuePosition, i)
+		}
+		ids = append(ids, resp.ExecutionID)
+	}
+
+	// Once the first is claimed, the second moves up
+	if _, err := server.queue.Claim(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/executions/"+ids[1], nil))
+	var result client.ExecutionResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.QueuePosition != 1 {
+		t.Errorf("queue_position = %d, want 1 (body %s)", result.QueuePosition, w.Body.String())
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := loadServer(config.OverloadReject, func(cfg *config.Config) {
+		cfg.Queue.MaxConcurrent = 4
+		cfg.Server.NodeID = "node-1"
+	})
+	server.takeSlot(context.Background())
+	server.queue.Enqueue(context.Background(), &queue.Job{ExecutionID: "exe_1"})
+	server.rejected.Add(3)
+	server.storage.Create(context.Background(), &storage.Execution{ID: "exe_1", Status: client.StatusPending, CreatedAt: time.Now()})
+
+	router := gin.New()
+	router.GET("/admin/status", server.GetStatus)
+	router.GET("/metrics", server.Metrics)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var status client.ServerStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	want := client.LoadStatus{
+		Running:        1,
+		MaxConcurrent:  4,
+		Saturation:     0.25,
+		OverloadPolicy: config.OverloadReject,
+		Queued:         1,
+		Rejected:       3,
+	}
+	if status.Node != "node-1" || status.Load != want {
+		t.Errorf("status = %+v, want node-1 with load %+v", status, want)
+	}
+	if stats := status.Storage; stats.Executions != 1 || stats.ByStatus[client.StatusPending] != 1 || stats.Oldest == nil || stats.Bytes == 0 {
+		t.Errorf("storage = %+v", stats)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE pyexec_saturation gauge\npyexec_saturation 0.25\n",
+		"pyexec_executions_running 1\n",
+		"pyexec_executions_queued 1\n",
+		"# TYPE pyexec_submissions_rejected_total counter\npyexec_submissions_rejected_total 3\n",
+		"pyexec_draining 0\n",
+		"pyexec_storage_executions{status=\"pending\"} 1\n",
+		"pyexec_storage_executions{status=\"failed\"} 0\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("metrics missing %q:\n%s", line, w.Body.String())
+		}
+	}
+}
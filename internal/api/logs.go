@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// GetStdout serves an execution's stdout as plain text
+// @Summary Download stdout
+// @Description Return the execution's standard output as text/plain. Supports
+// @Description HTTP Range requests, so large logs can be fetched in pieces or
+// @Description resumed from an offset. Alternatively offset, limit and unit
+// @Description select a slice in bytes or lines; the X-Next-Offset header
+// @Description gives the offset to continue from, and X-Output-Complete is
+// @Description true once the execution has finished and nothing is left.
+// @Tags execution
+// @Produce plain
+// @Param id path string true "Execution ID"
+// @Param with_timestamps query bool false "Prefix each line with the time it was emitted"
+// @Param offset query int false "Offset to start from, in unit"
+// @Param limit query int false "Most units to return (0 for no limit)"
+// @Param unit query string false "bytes (default) or lines"
+// @Param Range header string false "Byte range, e.g. bytes=1048576-"
+// @Success 200 {string} string "Full output"
+// @Success 206 {string} string "Requested range"
+// @Failure 400 {object} gin.H "Invalid offset, limit or unit"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 416 {string} string "Range not satisfiable"
+// @Router /executions/{id}/stdout [get]
+func (s *Server) GetStdout(c *gin.Context) {
+	s.serveOutput(c, false)
+}
+
+// GetStderr serves an execution's stderr as plain text
+// @Summary Download stderr
+// @Description Return the execution's standard error as text/plain. Supports
+// @Description HTTP Range requests and offset, limit and unit, like the stdout
+// @Description endpoint.
+// @Tags execution
+// @Produce plain
+// @Param id path string true "Execution ID"
+// @Param with_timestamps query bool false "Prefix each line with the time it was emitted"
+// @Param offset query int false "Offset to start from, in unit"
+// @Param limit query int false "Most units to return (0 for no limit)"
+// @Param unit query string false "bytes (default) or lines"
+// @Param Range header string false "Byte range, e.g. bytes=1048576-"
+// @Success 200 {string} string "Full output"
+// @Success 206 {string} string "Requested range"
+// @Failure 400 {object} gin.H "Invalid offset, limit or unit"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 416 {string} string "Range not satisfiable"
+// @Router /executions/{id}/stderr [get]
+func (s *Server) GetStderr(c *gin.Context) {
+	s.serveOutput(c, true)
+}
+
+// serveOutput writes an execution's stdout, or its stderr, honoring Range
+// headers or the offset, limit and unit query parameters
+func (s *Server) serveOutput(c *gin.Context, stderr bool) {
+	window, err := parseLogWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exec, err := s.storage.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	name, output, times := stdoutLog, exec.Stdout, exec.StdoutTimes
+	if stderr {
+		name, output, times = stderrLog, exec.Stderr, exec.StderrTimes
+	}
+	output = s.fullLog(ctx, exec, name, output)
+	if withTimestamps, _ := strconv.ParseBool(c.Query("with_timestamps")); withTimestamps {
+		output = prefixTimestamps(output, s.fullTimes(ctx, exec, name, times))
+	}
+
+	if window != nil {
+		chunk, next, atEnd := sliceLog(output, window)
+		c.Header("X-Next-Offset", strconv.Itoa(next))
+		c.Header("X-Output-Complete", strconv.FormatBool(atEnd && exec.Status.IsTerminal()))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(chunk))
+		return
+	}
+
+	// Only finished output is stable; let clients revalidate ranges against it
+	var modTime time.Time
+	if exec.FinishedAt != nil {
+		modTime = *exec.FinishedAt
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(c.Writer, c.Request, "", modTime, strings.NewReader(output))
+}
+
+// logWindow is a slice of a log selected with the offset, limit and unit
+// query parameters
+type logWindow struct {
+	offset int
+	limit  int // 0 for no limit
+	lines  bool
+}
+
+// parseLogWindow reads the offset, limit and unit query parameters. It
+// returns nil if none is set, in which case the whole log is served.
+func parseLogWindow(c *gin.Context) (*logWindow, error) {
+	offset, hasOffset := c.GetQuery("offset")
+	limit, hasLimit := c.GetQuery("limit")
+	unit, hasUnit := c.GetQuery("unit")
+	if !hasOffset && !hasLimit && !hasUnit {
+		return nil, nil
+	}
+
+	w := &logWindow{}
+	var err error
+	if hasOffset {
+		if w.offset, err = strconv.Atoi(offset); err != nil || w.offset < 0 {
+			return nil, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if hasLimit {
+		if w.limit, err = strconv.Atoi(limit); err != nil || w.limit < 0 {
+			return nil, fmt.Errorf("limit must be a non-negative integer")
+		}
+	}
+	switch unit {
+	case "", "bytes":
+	case "lines":
+		w.lines = true
+	default:
+		return nil, fmt.Errorf("unit must be bytes or lines")
+	}
+	return w, nil
+}
+
+// sliceLog returns the part of output selected by w, the offset just past
+// it, from which the next request continues, and whether it reaches the end
+// of output. Byte slices are shortened to
+// end on a UTF-8 character boundary, unless that would leave them empty.
+// Offsets past the end return nothing and keep the next offset at the end.
+func sliceLog(output string, w *logWindow) (string, int, bool) {
+	if w.lines {
+		lines := strings.SplitAfter(output, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		start := min(w.offset, len(lines))
+		end := len(lines)
+		if w.limit > 0 {
+			end = min(start+w.limit, end)
+		}
+		return strings.Join(lines[start:end], ""), end, end == len(lines)
+	}
+
+	start := min(w.offset, len(output))
+	end := len(output)
+	if w.limit > 0 && start+w.limit < end {
+		end = start + w.limit
+		cut := end
+		for cut > start && !utf8.RuneStart(output[cut]) {
+			cut--
+		}
+		if cut > start {
+			end = cut
+		}
+	}
+	return output[start:end], end, end == len(output)
+}
+
+// timestampedLog prefixes a stream's lines with their timestamps. The
+// times belong to the full log, so a spilled stream is prefixed in full and
+// then cut to the inline limit again.
+func (s *Server) timestampedLog(ctx context.Context, exec *storage.Execution, name, inline string, times []time.Time) string {
+	times = s.fullTimes(ctx, exec, name, times)
+	full := s.fullLog(ctx, exec, name, inline)
+	if full == inline {
+		return prefixTimestamps(inline, times)
+	}
+	output := prefixTimestamps(full, times)
+	if limit := s.inlineOutputLimit(); limit > 0 && len(output) > limit {
+		output = truncateLog(output, name, limit)
+	}
+	return output
+}
+
+// prefixTimestamps puts the emission time in front of each line of output,
+// in the same format as `docker logs --timestamps`. Lines without a recorded
+// time are left as they are.
+func prefixTimestamps(output string, times []time.Time) string {
+	if output == "" || len(times) == 0 {
+		return output
+	}
+
+	var b strings.Builder
+	b.Grow(len(output) + len(times)*len(time.RFC3339Nano))
+	for i, line := range strings.SplitAfter(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if i < len(times) {
+			b.WriteString(times[i].UTC().Format(time.RFC3339Nano))
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
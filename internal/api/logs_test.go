@@ -0,0 +1,195 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	finished := time.Now()
+	memStorage.Create(context.Background(), &storage.Execution{
+		ID:         "exe_1",
+		Status:     client.StatusCompleted,
+		Stdout:     "0123456789",
+		Stderr:     "warning\n",
+		FinishedAt: &finished,
+	})
+
+	router := gin.New()
+	router.GET("/executions/:id/stdout", server.GetStdout)
+	router.GET("/executions/:id/stderr", server.GetStderr)
+
+	tests := []struct {
+		name       string
+		path       string
+		rangeHdr   string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "whole stdout", path: "/executions/exe_1/stdout", wantStatus: http.StatusOK, wantBody: "0123456789"},
+		{name: "stderr", path: "/executions/exe_1/stderr", wantStatus: http.StatusOK, wantBody: "warning\n"},
+		{name: "open-ended range", path: "/executions/exe_1/stdout", rangeHdr: "bytes=6-", wantStatus: http.StatusPartialContent, wantBody: "6789"},
+		{name: "bounded range", path: "/executions/exe_1/stdout", rangeHdr: "bytes=2-4", wantStatus: http.StatusPartialContent, wantBody: "234"},
+		{name: "range past end", path: "/executions/exe_1/stdout", rangeHdr: "bytes=10-", wantStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "unknown execution", path: "/executions/exe_2/stdout", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.rangeHdr != "" {
+				req.Header.Set("Range", tt.rangeHdr)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if tt.wantStatus < 300 && w.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+				t.Errorf("content type = %q", w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestPrefixTimestamps(t *testing.T) {
+	t1 := time.Date(2024, 1, 15, 10, 30, 1, 5e8, time.UTC)
+	t2 := t1.Add(time.Second)
+
+	tests := []struct {
+		name   string
+		output string
+		times  []time.Time
+		want   string
+	}{
+		{
+			name:   "one time per line",
+			output: "first\nsecond\n",
+			times:  []time.Time{t1, t2},
+			want:   "2024-01-15T10:30:01.5Z first\n2024-01-15T10:30:02.5Z second\n",
+		},
+		{
+			name:   "unterminated last line",
+			output: "first\nsecond",
+			times:  []time.Time{t1, t2},
+			want:   "2024-01-15T10:30:01.5Z first\n2024-01-15T10:30:02.5Z second",
+		},
+		{
+			name:   "more lines than times",
+			output: "first\nsecond\n",
+			times:  []time.Time{t1},
+			want:   "2024-01-15T10:30:01.5Z first\nsecond\n",
+		},
+		{
+			name:   "no times recorded",
+			output: "first\n",
+			want:   "first\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixTimestamps(tt.output, tt.times); got != tt.want {
+				t.Errorf("prefixTimestamps() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSliceLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		window    logWindow
+		want      string
+		wantNext  int
+		wantAtEnd bool
+	}{
+		{name: "bytes from offset", output: "0123456789", window: logWindow{offset: 4}, want: "456789", wantNext: 10, wantAtEnd: true},
+		{name: "bytes with limit", output: "0123456789", window: logWindow{offset: 2, limit: 3}, want: "234", wantNext: 5},
+		{name: "bytes past end", output: "0123", window: logWindow{offset: 9}, want: "", wantNext: 4, wantAtEnd: true},
+		{name: "bytes stop before a split character", output: "aé", window: logWindow{limit: 2}, want: "a", wantNext: 1},
+		{name: "bytes keep a character longer than the limit", output: "éa", window: logWindow{limit: 1}, want: "\xc3", wantNext: 1},
+		{name: "lines from offset", output: "a\nb\nc\n", window: logWindow{offset: 1, lines: true}, want: "b\nc\n", wantNext: 3, wantAtEnd: true},
+		{name: "lines with limit", output: "a\nb\nc\n", window: logWindow{limit: 2, lines: true}, want: "a\nb\n", wantNext: 2},
+		{name: "unterminated last line", output: "a\nb", window: logWindow{offset: 1, lines: true}, want: "b", wantNext: 2, wantAtEnd: true},
+		{name: "lines past end", output: "a\n", window: logWindow{offset: 5, lines: true}, want: "", wantNext: 1, wantAtEnd: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, atEnd := sliceLog(tt.output, &tt.window)
+			if got != tt.want || next != tt.wantNext || atEnd != tt.wantAtEnd {
+				t.Errorf("sliceLog() = %q, %d, %v, want %q, %d, %v", got, next, atEnd, tt.want, tt.wantNext, tt.wantAtEnd)
+			}
+		})
+	}
+}
+
+func TestGetOutput_Window(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	memStorage.Create(context.Background(), &storage.Execution{
+		ID:     "exe_1",
+		Status: client.StatusCompleted,
+		Stdout: "one\ntwo\nthree\n",
+	})
+
+	router := gin.New()
+	router.GET("/executions/:id/stdout", server.GetStdout)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantStatus   int
+		wantBody     string
+		wantNext     string
+		wantComplete string
+	}{
+		{name: "bytes", query: "offset=4&limit=4", wantStatus: http.StatusOK, wantBody: "two\n", wantNext: "8", wantComplete: "false"},
+		{name: "lines to the end", query: "offset=1&unit=lines", wantStatus: http.StatusOK, wantBody: "two\nthree\n", wantNext: "3", wantComplete: "true"},
+		{name: "negative offset", query: "offset=-1", wantStatus: http.StatusBadRequest},
+		{name: "unknown unit", query: "unit=words", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/executions/exe_1/stdout?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("X-Next-Offset"); got != tt.wantNext {
+				t.Errorf("X-Next-Offset = %q, want %q", got, tt.wantNext)
+			}
+			if got := w.Header().Get("X-Output-Complete"); got != tt.wantComplete {
+				t.Errorf("X-Output-Complete = %q, want %q", got, tt.wantComplete)
+			}
+		})
+	}
+}
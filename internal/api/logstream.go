@@ -0,0 +1,315 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// liveLogBacklog is how many bytes of a running execution's output are
+// held for clients that connect after it was written
+const liveLogBacklog = 1 << 20
+
+// logPollInterval is how often a log stream checks on an execution that
+// isn't running on this instance
+const logPollInterval = time.Second
+
+// liveFrame is a piece of output written by a running execution
+type liveFrame struct {
+	stream client.OutputStream
+	data   string
+}
+
+// liveLog holds the recent output of a running execution and wakes the
+// clients following it. Writers never wait for clients; a client that
+// falls more than the backlog behind skips what was dropped.
+type liveLog struct {
+	mu      sync.Mutex
+	limit   int           // bytes held before the oldest frames are dropped
+	frames  []liveFrame   // the backlog
+	first   int           // sequence number of frames[0]
+	start   int64         // bytes written before frames[0]
+	size    int           // bytes held in frames
+	ended   bool          // the execution has finished
+	changed chan struct{} // closed, and replaced, on every write and at the end
+}
+
+func newLiveLog(limit int) *liveLog {
+	return &liveLog{limit: limit, changed: make(chan struct{})}
+}
+
+// logCursor is a client's position in a live log
+type logCursor struct {
+	seq    int   // sequence number of the next frame to read
+	offset int64 // bytes read or skipped so far
+}
+
+// write appends a frame, dropping the oldest ones past the limit
+func (l *liveLog) write(stream client.OutputStream, data string) {
+	if data == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ended {
+		return
+	}
+
+	l.frames = append(l.frames, liveFrame{stream: stream, data: data})
+	l.size += len(data)
+	for l.size > l.limit && len(l.frames) > 1 {
+		dropped := len(l.frames[0].data)
+		l.frames[0] = liveFrame{}
+		l.frames = l.frames[1:]
+		l.first++
+		l.start += int64(dropped)
+		l.size -= dropped
+	}
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// end marks the log finished, waking every client
+func (l *liveLog) end() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.ended {
+		l.ended = true
+		close(l.changed)
+	}
+}
+
+// read returns the frames past cur and advances it, along with how many
+// bytes were dropped before the client could read them, a channel closed
+// when there is more to read, and whether the log has ended
+func (l *liveLog) read(cur *logCursor) (frames []liveFrame, skipped int64, more <-chan struct{}, ended bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cur.seq < l.first {
+		skipped = l.start - cur.offset
+		cur.seq, cur.offset = l.first, l.start
+	}
+	frames = append(frames, l.frames[cur.seq-l.first:]...)
+	for _, f := range frames {
+		cur.offset += int64(len(f.data))
+	}
+	cur.seq += len(frames)
+	return frames, skipped, l.changed, l.ended
+}
+
+// liveOutput returns the OnOutput callback of an execution run by this
+// instance, which feeds its live log. Retries of the execution feed the
+// same log; finishExecution ends it.
+func (s *Server) liveOutput(exec *storage.Execution) func(client.OutputStream, []byte) {
+	s.liveLogsMu.Lock()
+	if s.liveLogs == nil {
+		s.liveLogs = make(map[string]*liveLog)
+	}
+	live, ok := s.liveLogs[exec.ID]
+	if !ok {
+		live = newLiveLog(liveLogBacklog)
+		s.liveLogs[exec.ID] = live
+	}
+	s.liveLogsMu.Unlock()
+
+	// Secrets are masked in each frame; one split across two writes is
+	// masked in the stored output only
+	redactor := s.outputRedactor(exec)
+	return func(stream client.OutputStream, data []byte) {
+		live.write(stream, redactor.String(string(data)))
+	}
+}
+
+// lookupLiveLog returns the live log of an execution running on this
+// instance, if any
+func (s *Server) lookupLiveLog(id string) *liveLog {
+	s.liveLogsMu.Lock()
+	defer s.liveLogsMu.Unlock()
+	return s.liveLogs[id]
+}
+
+// endLiveLog ends an execution's live log once its final state is stored
+func (s *Server) endLiveLog(id string) {
+	s.liveLogsMu.Lock()
+	live := s.liveLogs[id]
+	delete(s.liveLogs, id)
+	s.liveLogsMu.Unlock()
+	if live != nil {
+		live.end()
+	}
+}
+
+// upgrader returns the upgrader of WebSocket requests: log streams and
+// kernel channels
+func (s *Server) upgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{CheckOrigin: s.checkOrigin}
+}
+
+// checkOrigin accepts WebSocket requests from pages served by the server
+// itself or from an origin in PYEXEC_WEBSOCKET_ORIGINS, and requests
+// without an Origin, which browsers always send: those of scripts and
+// notebook servers. Other pages could otherwise use a visitor's
+// credentials to read output.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if s.config == nil {
+		return false
+	}
+	for _, allowed := range s.config.Server.WebSocketOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamLogs streams an execution's output over a WebSocket
+// @Summary Stream output live
+// @Description Upgrade to a WebSocket carrying the execution's stdout and
+// @Description stderr as JSON frames while it runs: {"type":"output",
+// @Description "stream":"stdout","data":"..."}. A client connecting late
+// @Description first receives the last MB of output; skipped gives the bytes
+// @Description before it that are no longer held. Once the execution has
+// @Description finished, a {"type":"end"} frame carries its status, exit code
+// @Description and error, and the server closes the connection.
+// @Description
+// @Description Output is live only when the instance answering runs the
+// @Description execution. Otherwise, as for an execution that has already
+// @Description finished, the stored stdout and then stderr are sent once it
+// @Description has.
+// @Tags execution
+// @Param id path string true "Execution ID"
+// @Success 101 "Switching protocols"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Router /executions/{id}/logs/stream [get]
+func (s *Server) StreamLogs(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	exec, err := s.storage.Get(ctx, id)
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	conn, err := s.upgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has written the error response
+		return
+	}
+	defer conn.Close()
+
+	// Clients send nothing, but reading notices when they go away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Follow the live log once the execution starts here; otherwise wait
+	// for it to finish
+	streamed := false
+	for !exec.Status.IsTerminal() {
+		if live := s.lookupLiveLog(id); live != nil && !streamed {
+			if !sendLiveLog(conn, live, closed) {
+				return
+			}
+			streamed = true
+		} else {
+			select {
+			case <-closed:
+				return
+			case <-time.After(logPollInterval):
+			}
+		}
+		current, err := s.storage.Get(ctx, id)
+		switch {
+		case errors.Is(err, storage.ErrUnavailable):
+			// Try again at the next poll
+		case err != nil:
+			closeLogStream(conn, websocket.CloseInternalServerErr, "execution not found")
+			return
+		default:
+			exec = current
+		}
+	}
+
+	if !streamed {
+		frames := []client.LogFrame{
+			{Type: client.FrameOutput, Stream: client.StreamStdout, Data: s.fullLog(ctx, exec, stdoutLog, exec.Stdout)},
+			{Type: client.FrameOutput, Stream: client.StreamStderr, Data: s.fullLog(ctx, exec, stderrLog, exec.Stderr)},
+		}
+		for _, frame := range frames {
+			if frame.Data == "" {
+				continue
+			}
+			if err := conn.WriteJSON(frame); err != nil {
+				return
+			}
+		}
+	}
+
+	end := client.LogFrame{
+		Type:     client.FrameEnd,
+		Status:   exec.Status,
+		ExitCode: exec.ExitCode,
+		Error:    exec.Error,
+	}
+	if err := conn.WriteJSON(end); err != nil {
+		return
+	}
+	closeLogStream(conn, websocket.CloseNormalClosure, "")
+}
+
+// sendLiveLog sends a live log's frames until it ends. It returns false if
+// the client went away first.
+func sendLiveLog(conn *websocket.Conn, live *liveLog, closed <-chan struct{}) bool {
+	var cur logCursor
+	for {
+		frames, skipped, more, ended := live.read(&cur)
+		for i, f := range frames {
+			frame := client.LogFrame{Type: client.FrameOutput, Stream: f.stream, Data: f.data}
+			if i == 0 {
+				frame.Skipped = skipped
+			}
+			if err := conn.WriteJSON(frame); err != nil {
+				return false
+			}
+		}
+		if ended {
+			return true
+		}
+
+		select {
+		case <-more:
+		case <-closed:
+			return false
+		}
+	}
+}
+
+// closeLogStream sends a close frame. The connection is closed by the
+// caller.
+func closeLogStream(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestLiveLog(t *testing.T) {
+	live := newLiveLog(10)
+	var early, late logCursor
+
+	live.write(client.StreamStdout, "12345")
+	frames, skipped, _, _ := live.read(&early)
+	if len(frames) != 1 || frames[0].data != "12345" || skipped != 0 {
+		t.Fatalf("first read = %v, skipped %d", frames, skipped)
+	}
+
+	// Past the limit the oldest frames go, and a client behind skips them
+	live.write(client.StreamStderr, "6789")
+	live.write(client.StreamStdout, "abc")
+	frames, skipped, more, ended := live.read(&late)
+	if len(frames) != 2 || frames[0].data != "6789" || skipped != 5 || ended {
+		t.Errorf("late read = %v, skipped %d, ended %v", frames, skipped, ended)
+	}
+	frames, skipped, _, _ = live.read(&early)
+	if len(frames) != 2 || frames[0].stream != client.StreamStderr || skipped != 0 {
+		t.Errorf("early read = %v, skipped %d", frames, skipped)
+	}
+
+	// Ending wakes the readers
+	live.end()
+	select {
+	case <-more:
+	default:
+		t.Error("end() did not wake readers")
+	}
+	if frames, _, _, ended := live.read(&late); len(frames) != 0 || !ended {
+		t.Errorf("read after end = %v, ended %v", frames, ended)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	server := &Server{config: &config.Config{Server: config.ServerConfig{WebSocketOrigins: []string{"https://viewer.example.com/"}}}}
+
+	for _, tt := range []struct {
+		origin string
+		want   bool
+	}{
+		{"", true}, // scripts and notebook servers
+		{"http://pyexec.internal:8080", true},
+		{"https://viewer.example.com", true},
+		{"https://evil.example.com", false},
+		{"http://pyexec.internal:9090", false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://pyexec.internal:8080/api/v1/executions/exe_1/logs/stream", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := server.checkOrigin(req); got != tt.want {
+			t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+
+	// Without an allow-list only the server's own pages are accepted
+	server = &Server{}
+	req := httptest.NewRequest(http.MethodGet, "http://pyexec.internal:8080/api/kernels/k/channels", nil)
+	req.Header.Set("Origin", "https://viewer.example.com")
+	if server.checkOrigin(req) {
+		t.Error("checkOrigin() accepted another origin without an allow-list")
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	memStorage := storage.NewMemoryStorage()
+	server := &Server{storage: memStorage}
+	ctx := context.Background()
+	memStorage.Create(ctx, &storage.Execution{
+		ID:       "exe_done",
+		Status:   client.StatusCompleted,
+		Stdout:   "done\n",
+		Stderr:   "warning\n",
+		ExitCode: 3,
+	})
+	running := &storage.Execution{ID: "exe_running", Status: client.StatusRunning}
+	memStorage.Create(ctx, running)
+
+	router := gin.New()
+	router.GET("/executions/:id/logs/stream", server.StreamLogs)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	dial := func(id string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/executions/"+id+"/logs/stream", nil)
+		if err != nil {
+			t.Fatalf("connecting to %s: %v", id, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	read := func(conn *websocket.Conn) client.LogFrame {
+		var frame client.LogFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("reading frame: %v", err)
+		}
+		return frame
+	}
+
+	// A finished execution's stored output is sent at once
+	conn := dial("exe_done")
+	if f := read(conn); f.Stream != client.StreamStdout || f.Data != "done\n" {
+		t.Errorf("first frame = %+v", f)
+	}
+	if f := read(conn); f.Stream != client.StreamStderr || f.Data != "warning\n" {
+		t.Errorf("second frame = %+v", f)
+	}
+	if f := read(conn); f.Type != client.FrameEnd || f.Status != client.StatusCompleted || f.ExitCode != 3 {
+		t.Errorf("end frame = %+v", f)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("after end = %v, want a normal close", err)
+	}
+	conn.Close()
+
+	// A running execution's output is sent as it is written, including
+	// what was written before the client connected
+	output := server.liveOutput(running)
+	output(client.StreamStdout, []byte("epoch 1\n"))
+	conn = dial("exe_running")
+	defer conn.Close()
+	if f := read(conn); f.Type != client.FrameOutput || f.Data != "epoch 1\n" {
+		t.Errorf("backlog frame = %+v", f)
+	}
+	output(client.StreamStderr, []byte("slow\n"))
+	if f := read(conn); f.Stream != client.StreamStderr || f.Data != "slow\n" {
+		t.Errorf("live frame = %+v", f)
+	}
+
+	running.Status = client.StatusCompleted
+	server.finishExecution(ctx, running)
+	if f := read(conn); f.Type != client.FrameEnd || f.Status != client.StatusCompleted {
+		t.Errorf("end frame = %+v", f)
+	}
+
+	// Unknown executions are refused before upgrading
+	resp, err := http.Get(ts.URL + "/executions/exe_unknown/logs/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown execution status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
@@ -33,6 +33,7 @@ func Logger(logger *logrus.Logger) gin.HandlerFunc {
 			"method":     method,
 			"path":       path,
 			"error":      errorMessage,
+			"request_id": traceIDOf(c),
 		}).Info("Request")
 	}
 }
@@ -0,0 +1,582 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	tarutil "github.com/geraldthewes/python-executor/internal/tar"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxPipelineSteps caps the steps of one pipeline
+const maxPipelineSteps = 32
+
+// pipelineInputsDir is where a step finds the outputs of the steps it
+// depends on, one directory per step, relative to /work
+const pipelineInputsDir = "inputs"
+
+// pipelineStepName matches step names, which become directory names
+var pipelineStepName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// pipeline is a set of executions run in dependency order on this instance
+type pipeline struct {
+	id         string
+	tenant     string
+	apiKeyName string
+	caller     string
+	traceID    string
+	createdAt  time.Time
+
+	// steps are in the order they were submitted, order in the order they
+	// can run: every step after the steps it depends on
+	steps []*pipelineStep
+	order []*pipelineStep
+
+	mu         sync.Mutex
+	cancelled  bool
+	finishedAt *time.Time
+}
+
+// pipelineStep is one step of a pipeline. The fields below mu are guarded
+// by the pipeline's mu.
+type pipelineStep struct {
+	name      string
+	dependsOn []*pipelineStep
+	tarData   []byte
+	metadata  *client.Metadata
+	detected  []string
+
+	execID   string
+	status   client.ExecutionStatus
+	exitCode int
+	err      string
+	output   []byte // the files the step wrote to /work/output, as a tar
+}
+
+// succeeded reports whether a finished step completed with exit code 0
+func (step *pipelineStep) succeeded() bool {
+	return step.status == client.StatusCompleted && step.exitCode == 0 && step.err == ""
+}
+
+// info describes a pipeline; the caller must hold p.mu
+func (p *pipeline) info() *client.Pipeline {
+	info := &client.Pipeline{
+		ID:         p.id,
+		Status:     client.StatusRunning,
+		CreatedAt:  p.createdAt.UTC(),
+		FinishedAt: p.finishedAt,
+	}
+	if p.finishedAt != nil {
+		info.Status = client.StatusCompleted
+	}
+
+	for _, step := range p.steps {
+		status := client.PipelineStepStatus{
+			Name:        step.name,
+			ExecutionID: step.execID,
+			Status:      step.status,
+			ExitCode:    step.exitCode,
+			Error:       step.err,
+		}
+		for _, dep := range step.dependsOn {
+			status.DependsOn = append(status.DependsOn, dep.name)
+		}
+		info.Steps = append(info.Steps, status)
+
+		if p.finishedAt != nil && !step.succeeded() && info.Status == client.StatusCompleted {
+			info.Status = client.StatusFailed
+		}
+	}
+	if p.finishedAt != nil && p.cancelled {
+		info.Status = client.StatusKilled
+	}
+	return info
+}
+
+// newPipeline validates a pipeline request and prepares each step's archive
+// and metadata as /eval does. Errors carry their status as for
+// prepareEval.
+func (s *Server) newPipeline(ctx context.Context, req *client.PipelineRequest) (*pipeline, error) {
+	if len(req.Steps) == 0 {
+		return nil, errors.New("a pipeline needs at least one step")
+	}
+	if len(req.Steps) > maxPipelineSteps {
+		return nil, fmt.Errorf("a pipeline has at most %d steps", maxPipelineSteps)
+	}
+
+	p := &pipeline{
+		id:        fmt.Sprintf("pip_%s", uuid.New().String()),
+		createdAt: time.Now(),
+	}
+	byName := make(map[string]*pipelineStep, len(req.Steps))
+	for _, spec := range req.Steps {
+		if !pipelineStepName.MatchString(spec.Name) {
+			return nil, fmt.Errorf("invalid step name %q: use letters, digits, '.', '_' and '-'", spec.Name)
+		}
+		if byName[spec.Name] != nil {
+			return nil, fmt.Errorf("duplicate step name %q", spec.Name)
+		}
+
+		tarData, metadata, detected, err := s.prepareEval(ctx, &spec.SimpleExecRequest)
+		if err != nil {
+			return nil, fmt.Errorf("step %s: %w", spec.Name, err)
+		}
+		// Steps run on this instance
+		if err := s.checkPlacement(metadata); err != nil {
+			return nil, fmt.Errorf("step %s: %w", spec.Name, err)
+		}
+		step := &pipelineStep{
+			name:     spec.Name,
+			tarData:  tarData,
+			metadata: metadata,
+			detected: detected,
+			status:   client.StatusPending,
+		}
+		byName[spec.Name] = step
+		p.steps = append(p.steps, step)
+	}
+
+	for i, spec := range req.Steps {
+		step := p.steps[i]
+		for _, name := range spec.DependsOn {
+			dep := byName[name]
+			if dep == nil {
+				return nil, fmt.Errorf("step %s depends on unknown step %q", step.name, name)
+			}
+			if dep == step {
+				return nil, fmt.Errorf("step %s depends on itself", step.name)
+			}
+			step.dependsOn = append(step.dependsOn, dep)
+		}
+	}
+
+	order, err := pipelineOrder(p.steps)
+	if err != nil {
+		return nil, err
+	}
+	p.order = order
+	return p, nil
+}
+
+// pipelineOrder sorts steps so that each comes after the steps it depends
+// on, keeping the submitted order where it can. It fails if the
+// dependencies form a cycle.
+func pipelineOrder(steps []*pipelineStep) ([]*pipelineStep, error) {
+	placed := make(map[*pipelineStep]bool, len(steps))
+	var order []*pipelineStep
+	for len(order) < len(steps) {
+		progress := false
+		for _, step := range steps {
+			if placed[step] {
+				continue
+			}
+			ready := true
+			for _, dep := range step.dependsOn {
+				ready = ready && placed[dep]
+			}
+			if ready {
+				placed[step] = true
+				order = append(order, step)
+				progress = true
+			}
+		}
+		if !progress {
+			for _, step := range steps {
+				if !placed[step] {
+					return nil, fmt.Errorf("step dependencies form a cycle through %s", step.name)
+				}
+			}
+		}
+	}
+	return order, nil
+}
+
+// runPipeline runs a pipeline's steps as their dependencies finish, running
+// independent steps in parallel. A step whose dependency didn't succeed is
+// cancelled, as are the steps not yet started when the pipeline is
+// cancelled or the server drains. The caller must hold an in-flight slot,
+// which is released when the last step finishes.
+func (s *Server) runPipeline(p *pipeline) {
+	defer s.release()
+
+	done := make(chan struct{})
+	running := 0
+	for {
+		p.mu.Lock()
+		for _, step := range p.order {
+			if step.status != client.StatusPending {
+				continue
+			}
+			ready, reason := s.stepReady(p, step)
+			switch {
+			case reason != "":
+				step.status = client.StatusCancelled
+				step.err = reason
+			case ready:
+				step.status = client.StatusRunning
+				running++
+				go func() {
+					s.runPipelineStep(p, step)
+					done <- struct{}{}
+				}()
+			}
+		}
+		if running == 0 {
+			finishedAt := time.Now().UTC()
+			p.finishedAt = &finishedAt
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		<-done
+		running--
+	}
+}
+
+// stepReady reports whether a pending step can start, or else why it never
+// will; both are zero while it waits for its dependencies. The caller must
+// hold p.mu.
+func (s *Server) stepReady(p *pipeline, step *pipelineStep) (bool, string) {
+	if p.cancelled {
+		return false, "pipeline cancelled"
+	}
+	if s.Draining() {
+		return false, "server is shutting down"
+	}
+	for _, dep := range step.dependsOn {
+		switch {
+		case dep.status == client.StatusPending || dep.status == client.StatusRunning:
+			return false, ""
+		case !dep.succeeded():
+			return false, fmt.Sprintf("dependency %s did not complete successfully", dep.name)
+		}
+	}
+	return true, ""
+}
+
+// runPipelineStep runs one step as an execution of its own, with the
+// outputs of the steps it depends on added to its archive
+func (s *Server) runPipelineStep(p *pipeline, step *pipelineStep) {
+	ctx := context.Background()
+
+	p.mu.Lock()
+	inputs := make(map[string][]byte, len(step.dependsOn))
+	for _, dep := range step.dependsOn {
+		inputs[dep.name] = dep.output
+	}
+	p.mu.Unlock()
+
+	// Steps wait for a run slot like queued async executions
+	s.takeSlot(ctx)
+	defer s.releaseSlot()
+
+	now := time.Now()
+	exec := &storage.Execution{
+		ID:         fmt.Sprintf("exe_%s", uuid.New().String()),
+		Status:     client.StatusPending,
+		Metadata:   step.metadata,
+		Detected:   step.detected,
+		Tenant:     p.tenant,
+		APIKeyName: p.apiKeyName,
+		Caller:     p.caller,
+		TraceID:    p.traceID,
+		Node:       s.nodeID(),
+		CreatedAt:  now,
+	}
+	if err := s.storage.Create(ctx, exec); err != nil {
+		p.finishStep(step, nil, "failed to create execution")
+		return
+	}
+	s.publishEvent(client.EventSubmitted, exec)
+	p.mu.Lock()
+	step.execID = exec.ID
+	cancelled := p.cancelled
+	p.mu.Unlock()
+
+	// The pipeline may have been cancelled before the step had an
+	// execution to kill
+	if cancelled {
+		s.killExecution(ctx, exec)
+		p.finishStep(step, exec, "")
+		return
+	}
+
+	exec.Status = client.StatusRunning
+	exec.StartedAt = &now
+	s.storage.Update(ctx, exec)
+	s.publishEvent(client.EventStarted, exec)
+
+	tarData, err := pipelineArchive(step.tarData, inputs)
+	if err == nil {
+		err = tarutil.CheckLimits(tarData, s.extractLimits())
+	}
+	if err != nil {
+		s.failExecution(ctx, exec, fmt.Sprintf("adding inputs: %v", err))
+		p.finishStep(step, exec, "")
+		return
+	}
+
+	req := &executor.ExecutionRequest{
+		ID:            exec.ID,
+		TarData:       tarData,
+		Metadata:      step.metadata,
+		CollectOutput: true,
+	}
+	s.runWithRetries(ctx, exec, req)
+	// Finishing moves the archive out of the execution into storage
+	var output []byte
+	for _, a := range exec.Artifacts {
+		if a.Name == outputArchive {
+			output = a.Data
+		}
+	}
+	s.finishExecution(ctx, exec)
+	p.mu.Lock()
+	step.output = output
+	p.mu.Unlock()
+	p.finishStep(step, exec, "")
+}
+
+// finishStep records a step's execution, or the reason it had none
+func (p *pipeline) finishStep(step *pipelineStep, exec *storage.Execution, reason string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if exec == nil {
+		step.status = client.StatusFailed
+		step.err = reason
+		return
+	}
+	step.status = exec.Status
+	step.exitCode = exec.ExitCode
+	step.err = exec.Error
+}
+
+// pipelineArchive returns a step's archive with the outputs of the steps
+// it depends on added under pipelineInputsDir, keyed by step name
+func pipelineArchive(tarData []byte, inputs map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := copyTar(tw, tarData, ""); err != nil {
+		return nil, err
+	}
+	for name, output := range inputs {
+		if err := copyTar(tw, output, pipelineInputsDir+"/"+name+"/"); err != nil {
+			return nil, fmt.Errorf("outputs of %s: %w", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// copyTar writes the entries of an archive to tw, prefixing their names
+func copyTar(tw *tar.Writer, tarData []byte, prefix string) error {
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + hdr.Name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// lookupPipeline returns a pipeline held by this instance
+func (s *Server) lookupPipeline(id string) (*pipeline, bool) {
+	s.pipelinesMu.Lock()
+	defer s.pipelinesMu.Unlock()
+	p, ok := s.pipelines[id]
+	return p, ok
+}
+
+// CreatePipeline starts a pipeline
+// @Summary Run a pipeline
+// @Description Run executions as the steps of a pipeline. Each step takes the
+// @Description fields of an /eval request plus a name and the steps it
+// @Description depends_on. A step starts once those have completed with exit
+// @Description code 0, with the files each wrote to /work/output copied to
+// @Description /work/inputs/{name}; if one didn't, the step is cancelled.
+// @Description Independent steps run in parallel. Poll GET /pipelines/{id} for
+// @Description the aggregate status. Pipelines are held by the instance that
+// @Description runs them.
+// @Tags pipelines
+// @Accept json
+// @Produce json
+// @Param request body client.PipelineRequest true "Pipeline steps"
+// @Param X-Tenant header string false "Tenant the executions are accounted to on servers without API keys (default \"default\")"
+// @Success 202 {object} client.Pipeline "Pipeline started"
+// @Failure 400 {object} gin.H "Invalid step, unknown dependency or dependency cycle"
+// @Failure 403 {object} gin.H "A step matches one of the server's approval rules"
+// @Failure 413 {object} gin.H "A step's code exceeds the size limit"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /pipelines [post]
+func (s *Server) CreatePipeline(c *gin.Context) {
+	var req client.PipelineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+	if !s.limitConcurrency(c, len(req.Steps)) {
+		return
+	}
+	if err := s.admitAsync(c.Request.Context(), 0); err != nil {
+		s.rejectOverloaded(c, err)
+		return
+	}
+
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	p, err := s.newPipeline(c.Request.Context(), &req)
+	if err != nil {
+		s.release()
+		c.JSON(evalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	p.tenant = tenantOf(c)
+	p.apiKeyName = apiKeyOf(c)
+	p.caller = callerOf(c)
+	p.traceID = traceIDOf(c)
+
+	// Steps run as they become ready, so none can wait for approval
+	for _, step := range p.steps {
+		if reason := s.approvalReason(step.metadata, p.tenant); reason != "" {
+			s.release()
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("step %s requires approval (%s); pipelines can't wait for approval", step.name, reason)})
+			return
+		}
+	}
+
+	s.pipelinesMu.Lock()
+	if s.pipelines == nil {
+		s.pipelines = make(map[string]*pipeline)
+	}
+	s.pipelines[p.id] = p
+	s.pipelinesMu.Unlock()
+
+	p.mu.Lock()
+	info := p.info()
+	p.mu.Unlock()
+
+	// The pipeline keeps the in-flight slot until its last step finishes
+	go s.runPipeline(p)
+
+	c.JSON(http.StatusAccepted, info)
+}
+
+// GetPipeline describes a pipeline
+// @Summary Get pipeline status
+// @Description Return a pipeline's aggregate status and the state and
+// @Description execution_id of each step. Fetch a step's full result from
+// @Description /executions/{id}.
+// @Tags pipelines
+// @Produce json
+// @Param id path string true "Pipeline ID"
+// @Success 200 {object} client.Pipeline "Pipeline state"
+// @Failure 404 {object} gin.H "Pipeline not found"
+// @Router /pipelines/{id} [get]
+func (s *Server) GetPipeline(c *gin.Context) {
+	p, ok := s.lookupPipeline(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pipeline not found"})
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.JSON(http.StatusOK, p.info())
+}
+
+// CancelPipeline cancels a running pipeline
+// @Summary Cancel a pipeline
+// @Description Kill a pipeline's running steps and cancel those not yet
+// @Description started. A finished pipeline is returned unchanged.
+// @Tags pipelines
+// @Produce json
+// @Param id path string true "Pipeline ID"
+// @Success 200 {object} client.Pipeline "Pipeline state"
+// @Failure 404 {object} gin.H "Pipeline not found"
+// @Failure 500 {object} gin.H "Failed to kill a step"
+// @Router /pipelines/{id} [delete]
+func (s *Server) CancelPipeline(c *gin.Context) {
+	p, ok := s.lookupPipeline(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "pipeline not found"})
+		return
+	}
+
+	p.mu.Lock()
+	var running []string
+	if p.finishedAt == nil {
+		p.cancelled = true
+		for _, step := range p.steps {
+			if step.status == client.StatusRunning && step.execID != "" {
+				running = append(running, step.execID)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	for _, id := range running {
+		exec, err := s.storage.Get(c.Request.Context(), id)
+		if err != nil {
+			continue
+		}
+		if _, err := s.killExecution(c.Request.Context(), exec); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c.JSON(http.StatusOK, p.info())
+}
+
+// CleanupPipelines forgets the pipelines that finished more than ttl ago,
+// returning how many were removed. Their step executions are left to the
+// execution cleanup.
+func (s *Server) CleanupPipelines(ttl time.Duration) int {
+	cutoff := time.Now().Add(-ttl)
+
+	s.pipelinesMu.Lock()
+	defer s.pipelinesMu.Unlock()
+
+	removed := 0
+	for id, p := range s.pipelines {
+		p.mu.Lock()
+		expired := p.finishedAt != nil && p.finishedAt.Before(cutoff)
+		p.mu.Unlock()
+		if expired {
+			delete(s.pipelines, id)
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	tarutil "github.com/geraldthewes/python-executor/internal/tar"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// pipelineExecutor runs a step by listing the files of its archive into
+// an output file named after its entrypoint. Code containing "fail" exits
+// 1, and code containing "sleep" runs until killed.
+type pipelineExecutor struct {
+	fakeExecutor
+	killedCh chan struct{}
+}
+
+func (f *pipelineExecutor) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	f.fakeExecutor.Execute(ctx, req)
+
+	files := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(req.TarData))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(content)
+	}
+	code := files[req.Metadata.Entrypoint]
+
+	if strings.Contains(code, "sleep") {
+		<-f.killedCh
+		return &executor.ExecutionOutput{ExitCode: 137}, nil
+	}
+	if strings.Contains(code, "fail") {
+		return &executor.ExecutionOutput{ExitCode: 1, Stderr: "failed\n"}, nil
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	listing := strings.Join(names, "\n")
+	tw.WriteHeader(&tar.Header{Name: req.Metadata.Entrypoint + ".out", Mode: 0644, Size: int64(len(listing))})
+	tw.Write([]byte(listing))
+	tw.Close()
+	return &executor.ExecutionOutput{OutputArchive: buf.Bytes()}, nil
+}
+
+func (f *pipelineExecutor) Kill(ctx context.Context, containerID string) error {
+	f.fakeExecutor.Kill(ctx, containerID)
+	close(f.killedCh)
+	return nil
+}
+
+// waitPipeline polls a pipeline until it finishes
+func waitPipeline(t *testing.T, router *gin.Engine, id string) client.Pipeline {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pipelines/"+id, nil))
+		var p client.Pipeline
+		json.Unmarshal(w.Body.Bytes(), &p)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET pipeline = %d %s", w.Code, w.Body.String())
+		}
+		if p.Status != client.StatusRunning {
+			return p
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("pipeline still running: %+v", p)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startPipeline submits a pipeline and returns its ID
+func startPipeline(t *testing.T, router *gin.Engine, body string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(body)))
+	var p client.Pipeline
+	json.Unmarshal(w.Body.Bytes(), &p)
+	if w.Code != http.StatusAccepted || !strings.HasPrefix(p.ID, "pip_") {
+		t.Fatalf("POST pipeline = %d %s", w.Code, w.Body.String())
+	}
+	return p.ID
+}
+
+func newPipelineRouter(server *Server) *gin.Engine {
+	router := gin.New()
+	router.POST("/pipelines", server.CreatePipeline)
+	router.GET("/pipelines/:id", server.GetPipeline)
+	router.DELETE("/pipelines/:id", server.CancelPipeline)
+	return router
+}
+
+func TestPipeline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &pipelineExecutor{}
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+	router := newPipelineRouter(server)
+
+	// Steps are listed out of order; lint fails, so publish never runs
+	id := startPipeline(t, router, `{"steps":[
+		{"name":"report","depends_on":["train"],"files":[{"name":"report.py","content":"report"}]},
+		{"name":"train","depends_on":["preprocess"],"files":[{"name":"train.py","content":"train"}]},
+		{"name":"preprocess","files":[{"name":"prep.py","content":"prep"}]},
+		{"name":"lint","code":"fail"},
+		{"name":"publish","depends_on":["lint","report"],"code":"publish"}
+	]}`)
+	p := waitPipeline(t, router, id)
+
+	if p.Status != client.StatusFailed || p.FinishedAt == nil || len(p.Steps) != 5 {
+		t.Fatalf("pipeline = %+v, want failed with 5 steps", p)
+	}
+	steps := map[string]client.PipelineStepStatus{}
+	for _, step := range p.Steps {
+		steps[step.Name] = step
+	}
+	if p.Steps[0].Name != "report" || strings.Join(steps["publish"].DependsOn, ",") != "lint,report" {
+		t.Errorf("steps = %+v, want the submitted order and dependencies", p.Steps)
+	}
+	for _, name := range []string{"preprocess", "train", "report"} {
+		if step := steps[name]; step.Status != client.StatusCompleted || step.ExitCode != 0 || step.ExecutionID == "" {
+			t.Errorf("step %s = %+v, want completed", name, step)
+		}
+	}
+	if lint := steps["lint"]; lint.Status != client.StatusCompleted || lint.ExitCode != 1 {
+		t.Errorf("lint = %+v, want exit code 1", lint)
+	}
+	if publish := steps["publish"]; publish.Status != client.StatusCancelled || publish.ExecutionID != "" || !strings.Contains(publish.Error, "lint") {
+		t.Errorf("publish = %+v, want cancelled for lint", publish)
+	}
+	if len(fake.requests) != 4 {
+		t.Errorf("ran %d steps, want 4", len(fake.requests))
+	}
+
+	// Each step's outputs are in the next step's /work/inputs
+	archive, err := store.GetArtifact(context.Background(), steps["report"].ExecutionID, outputArchive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	tr.Next()
+	data, _ := io.ReadAll(tr)
+	if listing := string(data); listing != "inputs/train/train.py.out\nreport.py" {
+		t.Errorf("report's archive = %q, want its file and train's output", listing)
+	}
+	for _, req := range fake.requests {
+		if !req.CollectOutput {
+			t.Errorf("step %s didn't collect its output", req.ID)
+		}
+	}
+
+	// Finished pipelines are forgotten after the TTL
+	if removed := server.CleanupPipelines(time.Hour); removed != 0 {
+		t.Errorf("CleanupPipelines(1h) = %d, want 0", removed)
+	}
+	if removed := server.CleanupPipelines(-time.Second); removed != 1 {
+		t.Errorf("CleanupPipelines(0) = %d, want 1", removed)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/pipelines/"+id, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET removed pipeline = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestCancelPipeline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &pipelineExecutor{killedCh: make(chan struct{})}
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+	router := newPipelineRouter(server)
+
+	id := startPipeline(t, router, `{"steps":[
+		{"name":"train","code":"sleep"},
+		{"name":"report","depends_on":["train"],"code":"report"}
+	]}`)
+
+	// Wait for train's container to start
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.pipelinesMu.Lock()
+		p := server.pipelines[id]
+		server.pipelinesMu.Unlock()
+		p.mu.Lock()
+		execID := p.steps[0].execID
+		p.mu.Unlock()
+		if exec, err := store.Get(context.Background(), execID); err == nil && exec.ContainerID != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("train never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/pipelines/"+id, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("DELETE pipeline = %d %s", w.Code, w.Body.String())
+	}
+
+	p := waitPipeline(t, router, id)
+	if p.Status != client.StatusKilled {
+		t.Errorf("status = %s, want killed", p.Status)
+	}
+	if train := p.Steps[0]; train.Status != client.StatusKilled {
+		t.Errorf("train = %+v, want killed", train)
+	}
+	if report := p.Steps[1]; report.Status != client.StatusCancelled || report.Error != "pipeline cancelled" {
+		t.Errorf("report = %+v, want cancelled", report)
+	}
+	if len(fake.killed) != 1 {
+		t.Errorf("killed %v, want train's container", fake.killed)
+	}
+	if server.InFlight() != 0 {
+		t.Errorf("in flight = %d after the pipeline finished", server.InFlight())
+	}
+}
+
+func TestCreatePipeline_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &pipelineExecutor{}, &config.Config{})
+	router := newPipelineRouter(server)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"no steps", `{"steps":[]}`, http.StatusBadRequest, "at least one step"},
+		{"invalid name", `{"steps":[{"name":"../x","code":"1"}]}`, http.StatusBadRequest, "invalid step name"},
+		{"duplicate name", `{"steps":[{"name":"a","code":"1"},{"name":"a","code":"2"}]}`, http.StatusBadRequest, "duplicate step name"},
+		{"unknown dependency", `{"steps":[{"name":"a","depends_on":["b"],"code":"1"}]}`, http.StatusBadRequest, "unknown step"},
+		{"self dependency", `{"steps":[{"name":"a","depends_on":["a"],"code":"1"}]}`, http.StatusBadRequest, "depends on itself"},
+		{"cycle", `{"steps":[{"name":"a","depends_on":["b"],"code":"1"},{"name":"b","depends_on":["a"],"code":"2"}]}`, http.StatusBadRequest, "cycle"},
+		{"invalid step", `{"steps":[{"name":"a"}]}`, http.StatusBadRequest, "step a: either 'code' or 'files'"},
+		{"code too large", `{"steps":[{"name":"a","code":"` + strings.Repeat("x", maxCodeSize+1) + `"}]}`, http.StatusRequestEntityTooLarge, "exceeds limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus || !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("POST pipeline = %d %s, want %d %q", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+	if server.InFlight() != 0 {
+		t.Errorf("in flight = %d after rejected pipelines", server.InFlight())
+	}
+}
+
+func TestPipelineArchive(t *testing.T) {
+	step, _ := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(1)"}})
+	output, _ := buildTarFromFiles([]client.CodeFile{{Name: "data/rows.csv", Content: "a,b\n"}})
+
+	archive, err := pipelineArchive(step, map[string][]byte{"prep": output, "empty": nil})
+	if err != nil {
+		t.Fatalf("pipelineArchive() error = %v", err)
+	}
+	files, err := tarutil.ListFiles(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(files, ",") != "main.py,inputs/prep/data/rows.csv" {
+		t.Errorf("files = %v", files)
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// maxPlacementLabels bounds the labels a placement constraint may require
+const maxPlacementLabels = 16
+
+// validatePlacement checks a request's placement constraint, if any
+func validatePlacement(placement map[string]string) error {
+	if len(placement) > maxPlacementLabels {
+		return fmt.Errorf("too many placement labels: %d, at most %d", len(placement), maxPlacementLabels)
+	}
+	for key, value := range placement {
+		if !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid placement label %q: use up to 63 letters, digits, '.', '_', '/' and '-'", key)
+		}
+		if len(value) > maxLabelValueBytes {
+			return fmt.Errorf("placement label %s: value longer than %d bytes", key, maxLabelValueBytes)
+		}
+	}
+	return nil
+}
+
+// checkPlacement returns why this instance can't run an execution: it
+// lacks one of the labels the execution's placement requires, or the
+// execution's memory limit exceeds the instance's
+func (s *Server) checkPlacement(meta *client.Metadata) error {
+	// Executions handed to runners are matched against the runners' labels
+	if meta == nil || s.config == nil || s.runners != nil {
+		return nil
+	}
+	node := s.config.Server
+
+	for key, want := range meta.Placement {
+		if have, ok := node.NodeLabels[key]; !ok || have != want {
+			return fmt.Errorf("node %s does not satisfy placement %s=%s; submit the execution asynchronously to run it on a node that does", node.NodeID, key, want)
+		}
+	}
+
+	if node.NodeMemoryMB > 0 {
+		memoryMB := s.config.Defaults.MemoryMB
+		if meta.Config != nil && meta.Config.MemoryMB > 0 {
+			memoryMB = meta.Config.MemoryMB
+		}
+		if memoryMB > node.NodeMemoryMB {
+			return fmt.Errorf("node %s runs executions with at most %d MB of memory, not %d; submit the execution asynchronously to run it on a larger node", node.NodeID, node.NodeMemoryMB, memoryMB)
+		}
+	}
+	return nil
+}
+
+// canRun reports whether this instance can run a queued job, so its
+// workers only claim those
+func (s *Server) canRun(job *queue.Job) bool {
+	return s.checkPlacement(job.Metadata) == nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidatePlacement(t *testing.T) {
+	if err := validatePlacement(map[string]string{"gpu": "true", "zone/name": "eu-1"}); err != nil {
+		t.Errorf("valid placement: %v", err)
+	}
+	if err := validatePlacement(map[string]string{"bad key": "x"}); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if err := validatePlacement(map[string]string{"gpu": strings.Repeat("x", maxLabelValueBytes+1)}); err == nil {
+		t.Error("long value accepted")
+	}
+	many := map[string]string{}
+	for i := 0; i <= maxPlacementLabels; i++ {
+		many[strings.Repeat("k", i+1)] = "v"
+	}
+	if err := validatePlacement(many); err == nil {
+		t.Error("too many labels accepted")
+	}
+}
+
+func TestCheckPlacement(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.NodeID = "node-1"
+	cfg.Server.NodeLabels = map[string]string{"gpu": "true"}
+	cfg.Server.NodeMemoryMB = 2048
+	cfg.Defaults.MemoryMB = 1024
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	tests := []struct {
+		name string
+		meta *client.Metadata
+		ok   bool
+	}{
+		{"no constraint", &client.Metadata{}, true},
+		{"matching label", &client.Metadata{Placement: map[string]string{"gpu": "true"}}, true},
+		{"wrong value", &client.Metadata{Placement: map[string]string{"gpu": "false"}}, false},
+		{"missing label", &client.Metadata{Placement: map[string]string{"zone": "eu"}}, false},
+		{"memory fits", &client.Metadata{Config: &client.ExecutionConfig{MemoryMB: 2048}}, true},
+		{"memory too large", &client.Metadata{Config: &client.ExecutionConfig{MemoryMB: 4096}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.checkPlacement(tt.meta)
+			if (err == nil) != tt.ok {
+				t.Errorf("checkPlacement() = %v, want ok %v", err, tt.ok)
+			}
+			if got := server.canRun(&queue.Job{Metadata: tt.meta}); got != tt.ok {
+				t.Errorf("canRun() = %v, want %v", got, tt.ok)
+			}
+		})
+	}
+
+	// The server default memory limit counts when the execution sets none
+	cfg.Defaults.MemoryMB = 4096
+	if err := server.checkPlacement(&client.Metadata{}); err == nil {
+		t.Error("default memory above the node's was accepted")
+	}
+}
+
+func TestSyncPlacementConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)", Placement: map[string]string{"gpu": "true"}})
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusConflict, w.Body.String())
+	}
+	if len(fake.requests) != 0 {
+		t.Error("execution ran on a node that doesn't satisfy its placement")
+	}
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// lookupPreset returns the preset an execution names, or nil if it names
+// none
+func (s *Server) lookupPreset(name string) (*config.Preset, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if s.config != nil {
+		if p, ok := s.config.Defaults.Presets[name]; ok {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown preset %q", name)
+}
+
+// applyPreset fills in the image and limits of an execution that it leaves
+// unset from a preset
+func applyPreset(meta *client.Metadata, p *config.Preset) {
+	if p == nil {
+		return
+	}
+	if meta.DockerImage == "" {
+		meta.DockerImage = p.DockerImage
+	}
+
+	// The request's config may be shared, e.g. by a template
+	var cfg client.ExecutionConfig
+	if meta.Config != nil {
+		cfg = *meta.Config
+	}
+	if cfg.MemoryMB == 0 {
+		cfg.MemoryMB = p.MemoryMB
+	}
+	if cfg.CPUShares == 0 {
+		cfg.CPUShares = p.CPUShares
+	}
+	if cfg.DiskMB == 0 {
+		cfg.DiskMB = p.DiskMB
+	}
+	if cfg.TimeoutSeconds == 0 {
+		cfg.TimeoutSeconds = p.TimeoutSeconds
+	}
+	meta.Config = &cfg
+}
+
+// ListPresets lists the server's resource presets
+// @Summary List resource presets
+// @Description List the named bundles of image, memory, CPU, disk and
+// @Description timeout an execution may select with metadata.preset, as
+// @Description defined by the server's operator.
+// @Tags execution
+// @Produce json
+// @Success 200 {object} client.PresetList "Presets"
+// @Router /presets [get]
+func (s *Server) ListPresets(c *gin.Context) {
+	list := client.PresetList{Presets: []client.Preset{}}
+	if s.config != nil {
+		for name, p := range s.config.Defaults.Presets {
+			list.Presets = append(list.Presets, client.Preset{
+				Name:           name,
+				DockerImage:    p.DockerImage,
+				MemoryMB:       p.MemoryMB,
+				CPUShares:      p.CPUShares,
+				DiskMB:         p.DiskMB,
+				TimeoutSeconds: p.TimeoutSeconds,
+			})
+		}
+	}
+	sort.Slice(list.Presets, func(i, j int) bool {
+		return list.Presets[i].Name < list.Presets[j].Name
+	})
+	c.JSON(http.StatusOK, list)
+}
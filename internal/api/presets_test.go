@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestApplyPreset(t *testing.T) {
+	preset := &config.Preset{DockerImage: "pytorch/pytorch:latest", MemoryMB: 8192, CPUShares: 2048, DiskMB: 10240, TimeoutSeconds: 3600}
+
+	meta := &client.Metadata{}
+	applyPreset(meta, preset)
+	want := client.ExecutionConfig{MemoryMB: 8192, CPUShares: 2048, DiskMB: 10240, TimeoutSeconds: 3600}
+	if meta.DockerImage != "pytorch/pytorch:latest" || *meta.Config != want {
+		t.Errorf("metadata = %+v, config %+v", meta, meta.Config)
+	}
+
+	// The execution's own settings take precedence, and its config is
+	// copied rather than changed
+	own := &client.ExecutionConfig{MemoryMB: 512, NetworkDisabled: true}
+	meta = &client.Metadata{DockerImage: "python:3.12-slim", Config: own}
+	applyPreset(meta, preset)
+	want = client.ExecutionConfig{MemoryMB: 512, NetworkDisabled: true, CPUShares: 2048, DiskMB: 10240, TimeoutSeconds: 3600}
+	if meta.DockerImage != "python:3.12-slim" || *meta.Config != want {
+		t.Errorf("metadata = %+v, config %+v", meta, meta.Config)
+	}
+	if own.CPUShares != 0 {
+		t.Errorf("request config changed: %+v", own)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	cfg := &config.Config{}
+	cfg.Defaults.Presets = map[string]config.Preset{
+		"small":     {MemoryMB: 512, TimeoutSeconds: 60},
+		"gpu-large": {DockerImage: "pytorch/pytorch:latest", MemoryMB: 32768},
+	}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+	router := gin.New()
+	router.GET("/presets", server.ListPresets)
+	router.POST("/eval", server.ExecuteEval)
+	router.POST("/exec/sync", server.ExecuteSync)
+
+	w := sendJSON(router, http.MethodGet, "/presets", "")
+	var list client.PresetList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Presets) != 2 || list.Presets[0].Name != "gpu-large" || list.Presets[1].MemoryMB != 512 {
+		t.Errorf("presets = %+v", list)
+	}
+
+	// /eval takes the preset's image unless python_version is set
+	w = sendJSON(router, http.MethodPost, "/eval", `{"code": "print(1)", "preset": "gpu-large", "config": {"timeout_seconds": 5}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("eval = %d %s", w.Code, w.Body.String())
+	}
+	meta := fake.requests[0].Metadata
+	if meta.DockerImage != "pytorch/pytorch:latest" || meta.Config.MemoryMB != 32768 || meta.Config.TimeoutSeconds != 5 || meta.Preset != "gpu-large" {
+		t.Errorf("eval metadata = %+v, config %+v", meta, meta.Config)
+	}
+	sendJSON(router, http.MethodPost, "/eval", `{"code": "print(1)", "preset": "gpu-large", "python_version": "3.11"}`)
+	if image := fake.requests[1].Metadata.DockerImage; image != pythonVersionImages["3.11"] {
+		t.Errorf("eval with python_version ran in %s", image)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","preset":"small"}`, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec = %d %s", w.Code, w.Body.String())
+	}
+	if cfg := fake.requests[2].Metadata.Config; cfg == nil || cfg.MemoryMB != 512 || cfg.TimeoutSeconds != 60 {
+		t.Errorf("exec config = %+v", cfg)
+	}
+
+	if w := sendJSON(router, http.MethodPost, "/eval", `{"code": "print(1)", "preset": "huge"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("eval with unknown preset = %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","preset":"huge"}`, nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("exec with unknown preset = %d, want 400", w.Code)
+	}
+}
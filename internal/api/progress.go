@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// ProgressTokenHeader carries the per-execution token on progress reports
+const ProgressTokenHeader = "X-Pyexec-Progress-Token"
+
+// errNotRunning refuses progress reports for executions that aren't running
+var errNotRunning = errors.New("not running")
+
+// ReportProgress records progress reported by a running script
+// @Summary Report execution progress
+// @Description Called from inside a running execution to report percent complete
+// @Description and a status message. An empty body acts as a heartbeat.
+// @Description The script finds its URL and token in the PYEXEC_PROGRESS_URL and
+// @Description PYEXEC_PROGRESS_TOKEN environment variables.
+// @Tags execution
+// @Accept json
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Param X-Pyexec-Progress-Token header string true "Progress token from PYEXEC_PROGRESS_TOKEN"
+// @Param request body client.ProgressUpdate false "Progress update"
+// @Success 200 {object} client.Progress "Recorded progress"
+// @Failure 400 {object} gin.H "Invalid progress update"
+// @Failure 403 {object} gin.H "Invalid progress token"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not running"
+// @Router /executions/{id}/progress [post]
+func (s *Server) ReportProgress(c *gin.Context) {
+	id := c.Param("id")
+
+	var update client.ProgressUpdate
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&update); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+			return
+		}
+	}
+	if update.Percent != nil && (*update.Percent < 0 || *update.Percent > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "percent must be between 0 and 100"})
+		return
+	}
+
+	exec, err := s.storage.Get(c.Request.Context(), id)
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return
+	}
+
+	token := c.GetHeader(ProgressTokenHeader)
+	if exec.ProgressToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(exec.ProgressToken)) != 1 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid progress token"})
+		return
+	}
+
+	// Record it only while the execution is still running, should it finish
+	// while the report is being written
+	now := time.Now()
+	var status client.ExecutionStatus
+	exec, err = s.storage.Modify(c.Request.Context(), id, func(exec *storage.Execution) error {
+		if status = exec.Status; status != client.StatusRunning {
+			return errNotRunning
+		}
+		exec.Progress = mergeProgress(exec.Progress, &update, now)
+		return nil
+	})
+	if errors.Is(err, errNotRunning) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("execution is %s", status)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record progress"})
+		return
+	}
+
+	c.JSON(http.StatusOK, exec.Progress)
+}
+
+// mergeProgress applies an update to the previous progress. Fields missing
+// from the update keep their previous values.
+func mergeProgress(prev *client.Progress, update *client.ProgressUpdate, now time.Time) *client.Progress {
+	next := &client.Progress{UpdatedAt: now.UTC()}
+	if prev != nil {
+		next.Percent = prev.Percent
+		next.Message = prev.Message
+	}
+	if update.Percent != nil {
+		percent := *update.Percent
+		next.Percent = &percent
+	}
+	if update.Message != "" {
+		next.Message = update.Message
+	}
+	return next
+}
+
+// progressEnv prepares an execution for progress reporting and returns the
+// environment variables that tell the script how to report
+func (s *Server) progressEnv(exec *storage.Execution) []string {
+	if exec.ProgressToken == "" {
+		exec.ProgressToken = newProgressToken()
+	}
+
+	env := []string{"PYEXEC_PROGRESS_TOKEN=" + exec.ProgressToken}
+	if s.config != nil && s.config.Server.PublicURL != "" {
+		base := strings.TrimSuffix(s.config.Server.PublicURL, "/")
+		env = append(env, fmt.Sprintf("PYEXEC_PROGRESS_URL=%s/api/v1/executions/%s/progress", base, exec.ID))
+	}
+	return env
+}
+
+// newProgressToken returns a random token
+func newProgressToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
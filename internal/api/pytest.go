@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// junitSuite is a <testsuite> element of a JUnit XML report
+type junitSuite struct {
+	Time  float64     `xml:"time,attr"`
+	Cases []junitCase `xml:"testcase"`
+}
+
+// junitCase is a <testcase> element. At most one of Failure, Error and
+// Skipped is normally set.
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitOutcome `xml:"failure"`
+	Error     *junitOutcome `xml:"error"`
+	Skipped   *junitOutcome `xml:"skipped"`
+}
+
+// junitOutcome is a <failure>, <error> or <skipped> element
+type junitOutcome struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// parseJUnitReport converts the JUnit XML report written by pytest into a
+// TestReport. pytest 5.1 and later wrap the suite in <testsuites>; older
+// versions write a bare <testsuite>, which is accepted too.
+func parseJUnitReport(data []byte) (*client.TestReport, error) {
+	var root struct {
+		XMLName xml.Name
+		junitSuite
+		Suites []junitSuite `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing JUnit report: %w", err)
+	}
+
+	suites := root.Suites
+	if root.XMLName.Local == "testsuite" {
+		suites = []junitSuite{root.junitSuite}
+	}
+
+	report := &client.TestReport{}
+	for _, suite := range suites {
+		report.DurationMs += seconds(suite.Time)
+		for _, c := range suite.Cases {
+			tc := client.TestCase{
+				Name:       c.Name,
+				ClassName:  c.ClassName,
+				Status:     client.TestPassed,
+				DurationMs: seconds(c.Time),
+			}
+			switch {
+			case c.Failure != nil:
+				tc.Status = client.TestFailed
+				tc.Message, tc.Details = c.Failure.Message, strings.TrimSpace(c.Failure.Text)
+				report.Failed++
+			case c.Error != nil:
+				tc.Status = client.TestError
+				tc.Message, tc.Details = c.Error.Message, strings.TrimSpace(c.Error.Text)
+				report.Errors++
+			case c.Skipped != nil:
+				tc.Status = client.TestSkipped
+				tc.Message = c.Skipped.Message
+				report.Skipped++
+			default:
+				report.Passed++
+			}
+			report.Cases = append(report.Cases, tc)
+		}
+	}
+	report.Total = len(report.Cases)
+
+	return report, nil
+}
+
+// seconds converts a JUnit time attribute to milliseconds
+func seconds(s float64) int64 {
+	return int64(math.Round(s * 1000))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseJUnitReport(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+	}{
+		{
+			name: "testsuites root",
+			xml: `<?xml version="1.0" encoding="utf-8"?>
+<testsuites><testsuite name="pytest" errors="1" failures="1" skipped="1" tests="4" time="0.250">
+<testcase classname="test_math" name="test_add" time="0.001" />
+<testcase classname="test_math" name="test_sub" time="0.002"><failure message="assert 1 == 2">def test_sub():
+&gt;       assert 1 == 2
+E       assert 1 == 2</failure></testcase>
+<testcase classname="test_math" name="test_fixture" time="0.000"><error message="failed on setup with &quot;ValueError&quot;">ValueError</error></testcase>
+<testcase classname="test_math" name="test_later" time="0.000"><skipped type="pytest.skip" message="not yet">test_math.py:10: not yet</skipped></testcase>
+</testsuite></testsuites>`,
+		},
+		{
+			name: "bare testsuite root",
+			xml: `<testsuite name="pytest" tests="4" time="0.250">
+<testcase classname="test_math" name="test_add" time="0.001" />
+<testcase classname="test_math" name="test_sub" time="0.002"><failure message="assert 1 == 2">details</failure></testcase>
+<testcase classname="test_math" name="test_fixture" time="0.000"><error message="setup failed">ValueError</error></testcase>
+<testcase classname="test_math" name="test_later" time="0.000"><skipped message="not yet" /></testcase>
+</testsuite>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := parseJUnitReport([]byte(tt.xml))
+			if err != nil {
+				t.Fatalf("parseJUnitReport() error = %v", err)
+			}
+
+			if report.Total != 4 || report.Passed != 1 || report.Failed != 1 || report.Errors != 1 || report.Skipped != 1 {
+				t.Errorf("counts = %+v", report)
+			}
+			if report.DurationMs != 250 {
+				t.Errorf("DurationMs = %d, want 250", report.DurationMs)
+			}
+
+			want := []client.TestStatus{client.TestPassed, client.TestFailed, client.TestError, client.TestSkipped}
+			for i, c := range report.Cases {
+				if c.Status != want[i] {
+					t.Errorf("case %s status = %s, want %s", c.Name, c.Status, want[i])
+				}
+			}
+			if sub := report.Cases[1]; sub.Name != "test_sub" || sub.ClassName != "test_math" || sub.Message != "assert 1 == 2" || sub.DurationMs != 2 || sub.Details == "" {
+				t.Errorf("failed case = %+v", sub)
+			}
+			if skipped := report.Cases[3]; skipped.Message != "not yet" {
+				t.Errorf("skip message = %q", skipped.Message)
+			}
+		})
+	}
+}
+
+func TestParseJUnitReport_Invalid(t *testing.T) {
+	if _, err := parseJUnitReport([]byte("not xml <")); err == nil {
+		t.Error("expected an error for a malformed report")
+	}
+}
+
+func TestRecordResult_ParsesTestReport(t *testing.T) {
+	server := &Server{}
+	exec := &storage.Execution{Metadata: &client.Metadata{Mode: client.ModePytest}}
+	output := &executor.ExecutionOutput{
+		ExitCode:    1,
+		JUnitReport: []byte(`<testsuites><testsuite time="0.1"><testcase classname="test_a" name="test_one" time="0.1"><failure message="boom">boom</failure></testcase></testsuite></testsuites>`),
+	}
+
+	server.recordResult(exec, output, nil)
+
+	if exec.Tests == nil || exec.Tests.Total != 1 || exec.Tests.Failed != 1 {
+		t.Errorf("Tests = %+v, want one failed case", exec.Tests)
+	}
+}
+
+func TestExecute_RejectsInvalidMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+
+	tests := []struct {
+		name     string
+		metadata string
+	}{
+		{name: "unknown mode", metadata: `{"entrypoint":"main.py","mode":"unittest"}`},
+		{name: "pytest with eval", metadata: `{"mode":"pytest","eval_last_expr":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", tt.metadata, nil))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
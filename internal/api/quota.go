@@ -0,0 +1,89 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// quotaCaller returns who a request is accounted to for its quotas: its API
+// key, or its address on servers without keys. Executions record it as
+// their Caller.
+func quotaCaller(c *gin.Context) (string, config.APIKey) {
+	k, ok := c.Value(apiKeyContextKey).(config.APIKey)
+	if ok {
+		return "key:" + k.Name, k
+	}
+	return "ip:" + c.ClientIP(), k
+}
+
+// throttle refuses a request over its caller's quota with 429 and the
+// seconds until it may be retried
+func (s *Server) throttle(c *gin.Context, wait time.Duration, message string) {
+	s.throttled.Add(1)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": message})
+}
+
+// RateLimit refuses requests over their caller's, or the server's, requests
+// per minute. It follows Authenticate, so that callers with an API key are
+// told apart by it.
+func (s *Server) RateLimit(c *gin.Context) {
+	if s.limiter == nil {
+		return
+	}
+	caller, k := quotaCaller(c)
+	if wait := s.limiter.Allow(caller, k.RequestsPerMinute, time.Now()); wait > 0 {
+		s.throttle(c, wait, "rate limit exceeded; retry later")
+	}
+}
+
+// LimitConcurrency refuses a submission from a caller that already has its
+// maximum of unfinished executions and sessions. It follows Authenticate.
+// Sweeps and pipelines, which submit several executions, check their
+// count with limitConcurrency once they know it instead.
+func (s *Server) LimitConcurrency(c *gin.Context) {
+	s.limitConcurrency(c, 1)
+}
+
+// limitConcurrency refuses, with 429, a submission of n executions that
+// would take its caller over its maximum of unfinished (pending or
+// running) executions and open sessions, and reports whether it may go
+// ahead. The executions are counted from an index in storage, so the limit
+// holds across instances sharing it; submissions racing each other may
+// still go over it briefly. Sessions are counted on this instance.
+func (s *Server) limitConcurrency(c *gin.Context, n int) bool {
+	if s.config == nil {
+		return true
+	}
+	caller, k := quotaCaller(c)
+	max := k.MaxConcurrent
+	if max <= 0 {
+		max = s.config.Quota.MaxConcurrent
+	}
+	if max <= 0 {
+		return true
+	}
+
+	active, err := s.storage.CountActive(c.Request.Context(), caller)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to count running executions"})
+		return false
+	}
+	active += s.callerSessions(caller)
+	if active+n > max {
+		who := "this address"
+		if k.Name != "" {
+			who = "API key " + k.Name
+		}
+		s.throttle(c, overloadRetryAfter*time.Second,
+			fmt.Sprintf("%s has %d executions or sessions unfinished and may have %d; this submission would add %d", who, active, max, n))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// quotaServer serves the API with quotas and, if keys are given, API keys
+func quotaServer(t *testing.T, quotas config.QuotaConfig, keys ...config.APIKey) (*Server, *httptest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Quota: quotas}
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{Stdout: "1\n"}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+	if err := server.SetAPIKeys(keys); err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	ts := httptest.NewServer(SetupRouter(server, logger))
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+// quotaRequest sends a request with an API key, if given, and returns the
+// response's status and Retry-After header
+func quotaRequest(t *testing.T, method, url, key, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(APIKeyHeader, key)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("Retry-After")
+}
+
+func TestRateLimit(t *testing.T) {
+	server, ts := quotaServer(t, config.QuotaConfig{RequestsPerMinute: 2})
+
+	// Without keys, callers are told apart by address
+	for i := 0; i < 2; i++ {
+		if status, _ := quotaRequest(t, "GET", ts.URL+"/api/v1/presets", "", ""); status != http.StatusOK {
+			t.Fatalf("request %d status = %d", i+1, status)
+		}
+	}
+	status, retryAfter := quotaRequest(t, "GET", ts.URL+"/api/v1/presets", "", "")
+	if status != http.StatusTooManyRequests || retryAfter == "" {
+		t.Errorf("third request = %d with Retry-After %q, want 429 with Retry-After", status, retryAfter)
+	}
+
+	// Health checks aren't limited
+	if status, _ := quotaRequest(t, "GET", ts.URL+"/health", "", ""); status != http.StatusOK {
+		t.Errorf("health status = %d", status)
+	}
+	if got := server.loadStatus(context.Background()).Throttled; got != 1 {
+		t.Errorf("Throttled = %d, want 1", got)
+	}
+}
+
+func TestRateLimit_SpoofedAddress(t *testing.T) {
+	_, ts := quotaServer(t, config.QuotaConfig{RequestsPerMinute: 2})
+
+	// Without trusted proxies, forwarding headers don't make a caller
+	// someone else
+	for i, addr := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		req, _ := http.NewRequest("GET", ts.URL+"/api/v1/presets", nil)
+		req.Header.Set("X-Forwarded-For", addr)
+		req.Header.Set("X-Real-IP", addr)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		want := http.StatusOK
+		if i == 2 {
+			want = http.StatusTooManyRequests
+		}
+		if resp.StatusCode != want {
+			t.Errorf("request %d from %s = %d, want %d", i+1, addr, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRateLimit_PerKey(t *testing.T) {
+	_, ts := quotaServer(t, config.QuotaConfig{RequestsPerMinute: 1},
+		config.APIKey{Name: "ci", Key: "ci-key"},
+		config.APIKey{Name: "batch", Key: "batch-key", RequestsPerMinute: 3},
+	)
+
+	if status, _ := quotaRequest(t, "GET", ts.URL+"/api/v1/presets", "ci-key", ""); status != http.StatusOK {
+		t.Fatalf("status = %d", status)
+	}
+	if status, _ := quotaRequest(t, "GET", ts.URL+"/api/v1/presets", "ci-key", ""); status != http.StatusTooManyRequests {
+		t.Errorf("second request of ci = %d, want 429", status)
+	}
+
+	// Each key has its own bucket, sized by its override
+	for i := 0; i < 3; i++ {
+		if status, _ := quotaRequest(t, "GET", ts.URL+"/api/v1/presets", "batch-key", ""); status != http.StatusOK {
+			t.Errorf("request %d of batch = %d", i+1, status)
+		}
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	server, ts := quotaServer(t, config.QuotaConfig{MaxConcurrent: 1},
+		config.APIKey{Name: "ci", Key: "ci-key", Scopes: []string{config.ScopeRun}},
+		config.APIKey{Name: "batch", Key: "batch-key", Scopes: []string{config.ScopeRun}, MaxConcurrent: 2},
+	)
+	for _, exec := range []*storage.Execution{
+		{ID: "exe_1", Status: client.StatusRunning, APIKeyName: "ci", Caller: "key:ci"},
+		{ID: "exe_2", Status: client.StatusCompleted, APIKeyName: "batch", Caller: "key:batch"},
+		{ID: "exe_3", Status: client.StatusPending, APIKeyName: "batch", Caller: "key:batch"},
+	} {
+		server.storage.Create(context.Background(), exec)
+	}
+
+	eval := `{"code": "print(1)"}`
+	status, retryAfter := quotaRequest(t, "POST", ts.URL+"/api/v1/eval", "ci-key", eval)
+	if status != http.StatusTooManyRequests || retryAfter == "" {
+		t.Errorf("eval of ci = %d with Retry-After %q, want 429 with Retry-After", status, retryAfter)
+	}
+
+	// Finished executions don't count, and keys may have a higher limit
+	if status, _ := quotaRequest(t, "POST", ts.URL+"/api/v1/eval", "batch-key", eval); status != http.StatusOK {
+		t.Errorf("eval of batch = %d, want 200", status)
+	}
+
+	// A pipeline counts every execution it will create
+	pipeline := `{"steps": [{"name": "a", "code": "print(1)"}, {"name": "b", "code": "print(2)"}]}`
+	if status, _ := quotaRequest(t, "POST", ts.URL+"/api/v1/pipelines", "batch-key", pipeline); status != http.StatusTooManyRequests {
+		t.Errorf("pipeline of batch = %d, want 429", status)
+	}
+}
+
+func TestLimitConcurrency_NoKeys(t *testing.T) {
+	server, ts := quotaServer(t, config.QuotaConfig{MaxConcurrent: 1})
+	server.storage.Create(context.Background(), &storage.Execution{ID: "exe_1", Status: client.StatusRunning, Caller: "ip:127.0.0.1"})
+
+	// Without keys, callers are told apart by address, and sessions and
+	// kernels are limited like submissions
+	for _, path := range []string{"/api/v1/eval", "/api/v1/sessions", "/api/kernels"} {
+		if status, _ := quotaRequest(t, "POST", ts.URL+path, "", `{"code": "print(1)"}`); status != http.StatusTooManyRequests {
+			t.Errorf("POST %s = %d, want 429", path, status)
+		}
+	}
+
+	server.storage.Update(context.Background(), &storage.Execution{ID: "exe_1", Status: client.StatusCompleted, Caller: "ip:127.0.0.1"})
+	if status, _ := quotaRequest(t, "POST", ts.URL+"/api/v1/eval", "", `{"code": "print(1)"}`); status != http.StatusOK {
+		t.Errorf("eval once the execution finished = %d, want 200", status)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// RecoveryReport summarizes what RecoverExecutions did
+type RecoveryReport struct {
+	Reattached int // running executions whose container is still alive
+	Failed     int // executions that could not be recovered
+}
+
+// RecoverExecutions reconciles executions left in flight by a previous server
+// process against the containers that still exist. Executions whose container
+// survived are re-attached in the background; the rest are marked failed.
+//
+// Only executions accepted or started by this node are considered, so
+// replicas sharing storage don't fail each other's work. Pending
+// executions, and those awaiting approval, are left alone when the queue is
+// durable, since any replica can still claim or approve them.
+func (s *Server) RecoverExecutions(ctx context.Context) (*RecoveryReport, error) {
+	containers, err := s.executor.ListContainers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	report := &RecoveryReport{}
+
+	for _, status := range []client.ExecutionStatus{client.StatusRunning, client.StatusPending, client.StatusAwaitingApproval} {
+		executions, err := s.storage.List(ctx, &status)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s executions: %w", status, err)
+		}
+
+		for _, exec := range executions {
+			if status != client.StatusRunning && s.queue != nil && s.queue.Durable() {
+				continue
+			}
+			if exec.Node != "" && exec.Node != s.nodeID() {
+				continue
+			}
+
+			// A warm container names its execution in a file the script
+			// could rewrite, so it must also be the container on record
+			containerID, alive := containers[exec.ID]
+			alive = alive && (exec.ContainerID == "" || exec.ContainerID == containerID)
+			if status == client.StatusRunning && alive {
+				exec.ContainerID = containerID
+				s.storage.Update(ctx, exec)
+				go s.reattach(exec)
+				report.Reattached++
+				continue
+			}
+
+			reason := "execution lost: server restarted and its container no longer exists"
+			switch status {
+			case client.StatusPending:
+				reason = "execution lost: server restarted before it started"
+			case client.StatusAwaitingApproval:
+				reason = "execution lost: server restarted before it was approved"
+			}
+			s.failExecution(ctx, exec, reason)
+			report.Failed++
+		}
+	}
+
+	return report, nil
+}
+
+// reattach waits for a recovered container and records its result
+func (s *Server) reattach(exec *storage.Execution) {
+	ctx := context.Background()
+
+	// Honor whatever is left of the original timeout, which does not count
+	// the time the execution spent suspended
+	if exec.Metadata != nil && exec.Metadata.Config != nil && exec.Metadata.Config.TimeoutSeconds > 0 && exec.StartedAt != nil {
+		deadline := exec.StartedAt.Add(time.Duration(exec.Metadata.Config.TimeoutSeconds)*time.Second + time.Duration(exec.PausedMs)*time.Millisecond)
+		if exec.PausedAt != nil {
+			deadline = deadline.Add(time.Since(*exec.PausedAt))
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	output, err := s.executor.Attach(ctx, exec.ContainerID)
+	s.recordResult(exec, output, err)
+	s.finishExecution(context.Background(), exec)
+}
+
+// failExecution marks an execution failed with the given reason
+func (s *Server) failExecution(ctx context.Context, exec *storage.Execution, reason string) {
+	finishedAt := time.Now()
+	exec.Status = client.StatusFailed
+	exec.Phase = ""
+	exec.Error = reason
+	exec.FinishedAt = &finishedAt
+	s.storage.Update(ctx, exec)
+	s.publishEvent(client.EventCompleted, exec)
+	s.recordUsage(ctx, exec)
+}
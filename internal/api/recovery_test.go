@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestRecoverExecutions(t *testing.T) {
+	memStorage := storage.NewMemoryStorage()
+	fake := &fakeExecutor{
+		containers: map[string]string{"exe_alive": "c-alive", "exe_done": "c-done"},
+		output:     &executor.ExecutionOutput{Stdout: "recovered\n", ExitCode: 0},
+	}
+	server := &Server{storage: memStorage, executor: fake}
+	ctx := context.Background()
+
+	started := time.Now()
+	for _, exec := range []*storage.Execution{
+		{ID: "exe_alive", Status: client.StatusRunning, StartedAt: &started},
+		{ID: "exe_lost", Status: client.StatusRunning, StartedAt: &started},
+		{ID: "exe_queued", Status: client.StatusPending},
+		{ID: "exe_elsewhere", Status: client.StatusPending, Node: "node-b"},
+		{ID: "exe_elsewhere_running", Status: client.StatusRunning, Node: "node-b", StartedAt: &started},
+		{ID: "exe_done", Status: client.StatusCompleted},
+	} {
+		if err := memStorage.Create(ctx, exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := server.RecoverExecutions(ctx)
+	if err != nil {
+		t.Fatalf("RecoverExecutions() error = %v", err)
+	}
+	if report.Reattached != 1 || report.Failed != 2 {
+		t.Errorf("report = %+v, want 1 reattached and 2 failed", report)
+	}
+
+	// Lost and queued executions are failed with a reason
+	for _, id := range []string{"exe_lost", "exe_queued"} {
+		got, _ := memStorage.Get(ctx, id)
+		if got.Status != client.StatusFailed || got.Error == "" {
+			t.Errorf("%s: status = %q, error = %q; want failed with reason", id, got.Status, got.Error)
+		}
+	}
+
+	// The live execution completes once the re-attached container finishes
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := memStorage.Get(ctx, "exe_alive")
+		if got.Status == client.StatusCompleted {
+			if got.Stdout != "recovered\n" {
+				t.Errorf("stdout = %q, want %q", got.Stdout, "recovered\n")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("re-attached execution did not complete, status = %q", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Other nodes' executions are theirs to recover
+	for _, id := range []string{"exe_elsewhere", "exe_elsewhere_running"} {
+		if got, _ := memStorage.Get(ctx, id); got.Status.IsTerminal() {
+			t.Errorf("%s of another node: status changed to %q", id, got.Status)
+		}
+	}
+
+	// Completed executions are left alone
+	got, _ := memStorage.Get(ctx, "exe_done")
+	if got.Status != client.StatusCompleted {
+		t.Errorf("completed execution status changed to %q", got.Status)
+	}
+}
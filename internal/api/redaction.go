@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/redact"
+	"github.com/geraldthewes/python-executor/internal/storage"
+)
+
+// SetRedactor makes the server mask secrets in execution output and errors
+// before they are stored
+func (s *Server) SetRedactor(r *redact.Redactor) {
+	s.redactor = r
+}
+
+// redactOutput masks secrets in an execution's captured output and install
+// logs. Structured output and output files are left as the script wrote
+// them.
+func (s *Server) redactOutput(exec *storage.Execution, output *executor.ExecutionOutput) {
+	r := s.outputRedactor(exec)
+	if r == nil {
+		return
+	}
+	output.Stdout = r.String(output.Stdout)
+	output.Stderr = r.String(output.Stderr)
+	output.Combined = r.String(output.Combined)
+	if output.Install != nil {
+		output.Install.Stdout = r.String(output.Install.Stdout)
+		output.Install.Stderr = r.String(output.Install.Stderr)
+	}
+}
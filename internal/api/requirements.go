@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/internal/imports"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// maxPackages is the most packages an /eval request may list
+const maxPackages = 100
+
+// packageRequirements turns the packages of an /eval request into
+// requirements.txt lines. Each must be a single requirement specifier;
+// pip options such as -r and --index-url are refused.
+func packageRequirements(packages []string) (string, error) {
+	if len(packages) > maxPackages {
+		return "", fmt.Errorf("at most %d packages may be listed", maxPackages)
+	}
+	lines := make([]string, 0, len(packages))
+	for _, p := range packages {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "-") || strings.ContainsAny(p, "\r\n") {
+			return "", fmt.Errorf("invalid package %q: use a requirement specifier such as \"requests==2.31\"", p)
+		}
+		lines = append(lines, p)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// imagePythonPattern matches the Python version in official image names
+// such as python:3.12-slim
+var imagePythonPattern = regexp.MustCompile(`(?:^|/)python:(\d+\.\d+)`)
+
+// detectArchiveRequirements adds the dependencies declared by the project
+// files in tarData, or else the third-party packages its .py files import,
+// to meta's requirements, if meta asks for auto_install, and returns the
+// packages it detected. Their versions are
+// recorded with freeze_packages, as the user never pinned them.
+func (s *Server) detectArchiveRequirements(ctx context.Context, tarData []byte, meta *client.Metadata) ([]string, error) {
+	if !meta.AutoInstall {
+		return nil, nil
+	}
+
+	files, err := imports.SourceFiles(tarData)
+	if err != nil {
+		return nil, err
+	}
+	found, err := imports.FileRequirements(files)
+	if err != nil {
+		return nil, err
+	}
+	detected := s.pinRequirements(ctx, found, meta.DockerImage)
+	if detected == "" {
+		return nil, nil
+	}
+
+	meta.RequirementsTxt = imports.MergeRequirements(detected, meta.RequirementsTxt)
+	if meta.Config == nil {
+		meta.Config = &client.ExecutionConfig{}
+	}
+	meta.Config.FreezePackages = true
+	return strings.Split(detected, "\n"), nil
+}
+
+// pinRequirements pins detected requirements to the newest PyPI releases
+// that support the Python in image, or the default image if it is empty.
+// They are returned unchanged if version resolution is off, and any that
+// can't be resolved are left unpinned for pip to choose.
+func (s *Server) pinRequirements(ctx context.Context, requirements, image string) string {
+	if s.resolver == nil || requirements == "" {
+		return requirements
+	}
+	if image == "" && s.config != nil {
+		image = s.config.Defaults.DockerImage
+	}
+
+	var python string
+	if m := imagePythonPattern.FindStringSubmatch(image); m != nil {
+		python = m[1]
+	}
+
+	// Packages the index can't resolve are left for pip to find or report
+	locked, _ := s.resolver.Lock(ctx, requirements, python)
+	return locked
+}
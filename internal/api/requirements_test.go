@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/imports"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestDetectArchiveRequirements(t *testing.T) {
+	tarData, err := buildTarFromFiles([]client.CodeFile{
+		{Name: "main.py", Content: "import helper\nimport numpy"},
+		{Name: "helper.py", Content: "import pandas"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("opted in", func(t *testing.T) {
+		meta := &client.Metadata{Entrypoint: "main.py", RequirementsTxt: "numpy==1.26.4", AutoInstall: true}
+		detected, err := (&Server{}).detectArchiveRequirements(context.Background(), tarData, meta)
+		if err != nil {
+			t.Fatalf("detectArchiveRequirements() error = %v", err)
+		}
+		if want := []string{"numpy", "pandas"}; !reflect.DeepEqual(detected, want) {
+			t.Errorf("detected = %v, want %v", detected, want)
+		}
+		if want := "numpy==1.26.4\npandas"; meta.RequirementsTxt != want {
+			t.Errorf("requirements = %q, want %q", meta.RequirementsTxt, want)
+		}
+		if meta.Config == nil || !meta.Config.FreezePackages {
+			t.Error("freeze_packages not enabled")
+		}
+	})
+
+	t.Run("not opted in", func(t *testing.T) {
+		meta := &client.Metadata{Entrypoint: "main.py"}
+		detected, err := (&Server{}).detectArchiveRequirements(context.Background(), tarData, meta)
+		if err != nil || detected != nil || meta.RequirementsTxt != "" {
+			t.Errorf("detectArchiveRequirements() = %v, %v with requirements %q, want nothing", detected, err, meta.RequirementsTxt)
+		}
+	})
+}
+
+func TestPinRequirements(t *testing.T) {
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"releases": {
+			"1.26.4": [{"requires_python": ">=3.9"}],
+			"2.1.3": [{"requires_python": ">=3.11"}]
+		}}`))
+	}))
+	defer index.Close()
+
+	s := &Server{
+		config:   &config.Config{Defaults: config.DefaultsConfig{DockerImage: "python:3.12-slim"}},
+		resolver: imports.NewResolver(index.URL, 0),
+	}
+	ctx := context.Background()
+
+	if got := s.pinRequirements(ctx, "numpy", "python:3.10-slim"); got != "numpy==1.26.4" {
+		t.Errorf("pinRequirements(3.10) = %q, want numpy==1.26.4", got)
+	}
+	if got := s.pinRequirements(ctx, "numpy", ""); got != "numpy==2.1.3" {
+		t.Errorf("pinRequirements(default image) = %q, want numpy==2.1.3", got)
+	}
+	if got := (&Server{}).pinRequirements(ctx, "numpy", ""); got != "numpy" {
+		t.Errorf("pinRequirements() without a resolver = %q, want numpy", got)
+	}
+}
+
+func TestPrepareEval_Packages(t *testing.T) {
+	s := &Server{config: &config.Config{}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		req     *client.SimpleExecRequest
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "packages",
+			req:  &client.SimpleExecRequest{Code: "import numpy", Packages: []string{"numpy", " requests==2.31 "}},
+			want: "numpy\nrequests==2.31",
+		},
+		{
+			name: "requirements_txt takes precedence",
+			req:  &client.SimpleExecRequest{Code: "import numpy", RequirementsTxt: "numpy==1.26.4", Packages: []string{"numpy", "pandas"}},
+			want: "numpy==1.26.4\npandas",
+		},
+		{
+			name: "detection disabled",
+			req:  &client.SimpleExecRequest{Code: "import numpy", RequirementsTxt: "-", Packages: []string{"pandas"}},
+			want: "pandas",
+		},
+		{
+			name:    "pip option",
+			req:     &client.SimpleExecRequest{Code: "1", Packages: []string{"--index-url=http://evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "several lines",
+			req:     &client.SimpleExecRequest{Code: "1", Packages: []string{"numpy\npandas"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			req:     &client.SimpleExecRequest{Code: "1", Packages: []string{""}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, meta, detected, err := s.prepareEval(ctx, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareEval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if meta.RequirementsTxt != tt.want {
+				t.Errorf("requirements = %q, want %q", meta.RequirementsTxt, tt.want)
+			}
+			if detected != nil {
+				t.Errorf("detected = %v, want the packages treated as the user's", detected)
+			}
+			if meta.Config == nil || meta.Config.NetworkDisabled {
+				t.Error("network not enabled to install the packages")
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// Retry policy defaults, for fields left zero
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// failureKinds are the failures a retry policy can name
+var failureKinds = []client.FailureKind{
+	client.FailureInfraError,
+	client.FailureTimeout,
+	client.FailurePullTimeout,
+	client.FailureInstallTimeout,
+	client.FailureOOM,
+	client.FailureDiskLimit,
+	client.FailureInstallError,
+	client.FailureNonzeroExit,
+}
+
+// validateRetryPolicy checks a request's retry policy, if any, against the
+// server's limit
+func (s *Server) validateRetryPolicy(p *client.RetryPolicy) error {
+	if p == nil {
+		return nil
+	}
+
+	maxRetries := 0
+	if s.config != nil {
+		maxRetries = s.config.Defaults.MaxRetries
+	}
+	if p.MaxRetries < 0 || p.MaxRetries > maxRetries {
+		return fmt.Errorf("retry.max_retries must be between 0 and %d", maxRetries)
+	}
+	if p.BackoffSeconds < 0 || p.MaxBackoffSeconds < 0 {
+		return errors.New("retry backoff must not be negative")
+	}
+	for _, kind := range p.RetryOn {
+		if !slices.Contains(failureKinds, kind) {
+			return fmt.Errorf("unknown retry.retry_on kind %q; supported kinds: infra_error, timeout, pull_timeout, install_timeout, oom, disk_limit_exceeded, install_error, nonzero_exit", kind)
+		}
+	}
+	return nil
+}
+
+// failureKind classifies a recorded attempt, returning "" if it succeeded.
+// err is the executor's error for the attempt.
+func failureKind(exec *storage.Execution, err error) client.FailureKind {
+	switch {
+	case errors.Is(err, executor.ErrTimeout):
+		return client.FailureTimeout
+	case errors.Is(err, executor.ErrPullTimeout):
+		return client.FailurePullTimeout
+	case errors.Is(err, executor.ErrInstallTimeout):
+		return client.FailureInstallTimeout
+	case err != nil:
+		return client.FailureInfraError
+	case exec.Install != nil && exec.Install.ExitCode != 0:
+		return client.FailureInstallError
+	case exec.Termination == client.TerminationOOM:
+		return client.FailureOOM
+	case exec.Termination == client.TerminationDiskLimit:
+		return client.FailureDiskLimit
+	case exec.ExitCode != 0:
+		return client.FailureNonzeroExit
+	}
+	return ""
+}
+
+// retries reports whether a policy retries a kind of failure
+func retries(p *client.RetryPolicy, kind client.FailureKind) bool {
+	if len(p.RetryOn) == 0 {
+		return kind == client.FailureInfraError
+	}
+	return slices.Contains(p.RetryOn, kind)
+}
+
+// retryDelay returns the wait before the nth retry: the backoff, doubled
+// for each retry after the first, up to the policy's maximum
+func retryDelay(p *client.RetryPolicy, n int) time.Duration {
+	delay := defaultRetryBackoff
+	if p.BackoffSeconds > 0 {
+		delay = time.Duration(p.BackoffSeconds * float64(time.Second))
+	}
+	maxDelay := defaultRetryMaxBackoff
+	if p.MaxBackoffSeconds > 0 {
+		maxDelay = time.Duration(p.MaxBackoffSeconds * float64(time.Second))
+	}
+
+	for i := 1; i < n && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// rewindStdin prepares a request's streamed stdin to be read again by the
+// next attempt. It reports false if the stream can't be rewound.
+func rewindStdin(req *executor.ExecutionRequest) bool {
+	if req.Stdin == nil {
+		return true
+	}
+	seeker, ok := req.Stdin.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+// runWithRetries runs an execution and records its result, re-running it
+// while the attempts fail in a way its retry policy retries. Each failed
+// attempt is kept in exec.Attempts and the execution stays running between
+// attempts, so clients polling it only see the final result. No retry is
+// started once the execution is killed, ctx ends or the server drains.
+func (s *Server) runWithRetries(ctx context.Context, exec *storage.Execution, req *executor.ExecutionRequest) {
+	var policy *client.RetryPolicy
+	if exec.Metadata != nil {
+		policy = exec.Metadata.Retry
+	}
+
+	for attempt := 1; ; attempt++ {
+		// runExecution adds to the request's environment, so each attempt
+		// gets its own copy
+		attemptReq := *req
+		startedAt := time.Now()
+		output, err := s.runExecution(ctx, exec, &attemptReq)
+		s.recordResult(exec, output, err)
+
+		kind := failureKind(exec, err)
+		if kind == "" || policy == nil || attempt > policy.MaxRetries || !retries(policy, kind) {
+			return
+		}
+		if ctx.Err() != nil || s.Draining() || s.killed(ctx, exec) || !rewindStdin(req) {
+			return
+		}
+
+		// Keep the failed attempt and show the execution as running again,
+		// still accounted and counted against who submitted it
+		s.keepSuspensions(ctx, exec)
+		failed := *exec
+		exec.Attempts = append(exec.Attempts, client.Attempt{
+			Attempt:     attempt,
+			FailureKind: kind,
+			ExitCode:    exec.ExitCode,
+			Error:       exec.Error,
+			ContainerID: exec.ContainerID,
+			StartedAt:   startedAt.UTC(),
+			FinishedAt:  exec.FinishedAt.UTC(),
+		})
+		*exec = storage.Execution{
+			ID:             exec.ID,
+			Status:         client.StatusRunning,
+			Metadata:       exec.Metadata,
+			Detected:       exec.Detected,
+			StartedAt:      exec.StartedAt,
+			Node:           exec.Node,
+			ProgressToken:  exec.ProgressToken,
+			Attempts:       exec.Attempts,
+			ApprovalReason: exec.ApprovalReason,
+			Tenant:         exec.Tenant,
+			APIKeyName:     exec.APIKeyName,
+			Caller:         exec.Caller,
+			TraceID:        exec.TraceID,
+			PausedMs:       exec.PausedMs,
+			CheckpointedAt: exec.CheckpointedAt,
+			CreatedAt:      exec.CreatedAt,
+		}
+		s.storage.Update(ctx, exec)
+
+		select {
+		case <-time.After(retryDelay(policy, attempt)):
+		case <-ctx.Done():
+			*exec = failed
+			return
+		}
+
+		// Killed while waiting: finishExecution records it as killed
+		if s.killed(ctx, exec) {
+			finishedAt := time.Now()
+			exec.FinishedAt = &finishedAt
+			return
+		}
+	}
+}
+
+// killed reports whether an execution was killed through the API
+func (s *Server) killed(ctx context.Context, exec *storage.Execution) bool {
+	current, err := s.storage.Get(ctx, exec.ID)
+	return err == nil && current.Status == client.StatusKilled
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// flakyExecutor fails its first failures calls, with err if set or else
+// with exitCode, then succeeds
+type flakyExecutor struct {
+	fakeExecutor
+	failures int
+	err      error
+	exitCode int
+}
+
+func (f *flakyExecutor) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	f.fakeExecutor.Execute(ctx, req)
+
+	f.mu.Lock()
+	calls := len(f.requests)
+	f.mu.Unlock()
+	if calls > f.failures {
+		return &executor.ExecutionOutput{Stdout: "ok\n"}, nil
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &executor.ExecutionOutput{ExitCode: f.exitCode, Stderr: "boom\n"}, nil
+}
+
+func TestExecuteSync_Retries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		retry        string
+		fake         *flakyExecutor
+		wantRequests int
+		wantStatus   client.ExecutionStatus
+		wantExitCode int
+		wantAttempts []client.FailureKind
+	}{
+		{
+			name:         "infra errors retried by default",
+			retry:        `{"max_retries":2,"backoff_seconds":0.01}`,
+			fake:         &flakyExecutor{failures: 2, err: errors.New("connection reset by docker daemon")},
+			wantRequests: 3,
+			wantStatus:   client.StatusCompleted,
+			wantAttempts: []client.FailureKind{client.FailureInfraError, client.FailureInfraError},
+		},
+		{
+			name:         "script failures not retried by default",
+			retry:        `{"max_retries":2,"backoff_seconds":0.01}`,
+			fake:         &flakyExecutor{failures: 1, exitCode: 1},
+			wantRequests: 1,
+			wantStatus:   client.StatusCompleted,
+			wantExitCode: 1,
+		},
+		{
+			name:         "listed kinds retried",
+			retry:        `{"max_retries":2,"backoff_seconds":0.01,"retry_on":["nonzero_exit"]}`,
+			fake:         &flakyExecutor{failures: 1, exitCode: 1},
+			wantRequests: 2,
+			wantStatus:   client.StatusCompleted,
+			wantAttempts: []client.FailureKind{client.FailureNonzeroExit},
+		},
+		{
+			name:         "timeouts",
+			retry:        `{"max_retries":1,"backoff_seconds":0.01,"retry_on":["timeout"]}`,
+			fake:         &flakyExecutor{failures: 1, err: executor.ErrTimeout},
+			wantRequests: 2,
+			wantStatus:   client.StatusCompleted,
+			wantAttempts: []client.FailureKind{client.FailureTimeout},
+		},
+		{
+			name:         "pull timeouts are not script timeouts",
+			retry:        `{"max_retries":1,"backoff_seconds":0.01,"retry_on":["pull_timeout"]}`,
+			fake:         &flakyExecutor{failures: 1, err: fmt.Errorf("%w after 10m0s pulling python:3.12-slim", executor.ErrPullTimeout)},
+			wantRequests: 2,
+			wantStatus:   client.StatusCompleted,
+			wantAttempts: []client.FailureKind{client.FailurePullTimeout},
+		},
+		{
+			name:         "retries exhausted",
+			retry:        `{"max_retries":1,"backoff_seconds":0.01}`,
+			fake:         &flakyExecutor{failures: 5, err: errors.New("no such image")},
+			wantRequests: 2,
+			wantStatus:   client.StatusFailed,
+			wantAttempts: []client.FailureKind{client.FailureInfraError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Defaults: config.DefaultsConfig{MaxRetries: 5}}
+			server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), tt.fake, cfg)
+			router := gin.New()
+			router.POST("/exec/sync", server.ExecuteSync)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","retry":`+tt.retry+`}`, []byte("input\n")))
+
+			var result client.ExecutionResult
+			json.Unmarshal(w.Body.Bytes(), &result)
+			if w.Code != http.StatusOK || result.Status != tt.wantStatus || result.ExitCode != tt.wantExitCode {
+				t.Fatalf("response = %d %s", w.Code, w.Body.String())
+			}
+			if len(tt.fake.requests) != tt.wantRequests {
+				t.Errorf("attempts run = %d, want %d", len(tt.fake.requests), tt.wantRequests)
+			}
+			if len(result.Attempts) != len(tt.wantAttempts) {
+				t.Fatalf("attempts = %+v, want %v", result.Attempts, tt.wantAttempts)
+			}
+			for i, a := range result.Attempts {
+				if a.Attempt != i+1 || a.FailureKind != tt.wantAttempts[i] || a.ContainerID == "" || a.FinishedAt.Before(a.StartedAt) {
+					t.Errorf("attempt %d = %+v, want kind %s", i, a, tt.wantAttempts[i])
+				}
+			}
+			// Every attempt reads the whole streamed stdin
+			if string(tt.fake.stdin) != "input\n" {
+				t.Errorf("last attempt's stdin = %q", tt.fake.stdin)
+			}
+		})
+	}
+}
+
+func TestExecuteSync_RetryPolicyValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Defaults: config.DefaultsConfig{MaxRetries: 3}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+	router := gin.New()
+	router.POST("/exec/sync", server.ExecuteSync)
+	router.POST("/eval", server.ExecuteEval)
+
+	for _, retry := range []string{
+		`{"max_retries":4}`,
+		`{"max_retries":-1}`,
+		`{"max_retries":1,"backoff_seconds":-1}`,
+		`{"max_retries":1,"retry_on":["segfault"]}`,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","retry":`+retry+`}`, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("exec with retry %s status = %d, want %d", retry, w.Code, http.StatusBadRequest)
+		}
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/eval", strings.NewReader(`{"code":"1","retry":`+retry+`}`)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("eval with retry %s status = %d, want %d", retry, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		policy client.RetryPolicy
+		n      int
+		want   time.Duration
+	}{
+		{client.RetryPolicy{}, 1, time.Second},
+		{client.RetryPolicy{}, 3, 4 * time.Second},
+		{client.RetryPolicy{}, 30, time.Minute},
+		{client.RetryPolicy{BackoffSeconds: 0.5}, 2, time.Second},
+		{client.RetryPolicy{BackoffSeconds: 10, MaxBackoffSeconds: 15}, 2, 15 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(&tt.policy, tt.n); got != tt.want {
+			t.Errorf("retryDelay(%+v, %d) = %s, want %s", tt.policy, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestExecuteSync_RetryKeepsCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMemoryStorage()
+	cfg := &config.Config{Defaults: config.DefaultsConfig{MaxRetries: 1}}
+	server := NewServer(store, queue.NewMemoryQueue(), &flakyExecutor{failures: 1, err: errors.New("connection reset by docker daemon")}, cfg)
+	router := gin.New()
+	router.POST("/exec/sync", server.AccountUsage, server.ExecuteSync)
+
+	req := multipartExecRequest(t, "/exec/sync", `{"entrypoint":"main.py","retry":{"max_retries":1,"backoff_seconds":0.01}}`, nil)
+	req.Header.Set(TenantHeader, "team-a")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var result client.ExecutionResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Status != client.StatusCompleted || len(result.Attempts) != 1 {
+		t.Fatalf("response = %d %s", w.Code, w.Body.String())
+	}
+
+	// The retried execution is still who submitted it: it no longer counts
+	// against their concurrency limit, and its usage is theirs
+	ctx := context.Background()
+	exec, err := store.Get(ctx, result.ExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Caller == "" || exec.Tenant != "team-a" {
+		t.Errorf("caller = %q, tenant = %q after a retry", exec.Caller, exec.Tenant)
+	}
+	if n, err := store.CountActive(ctx, exec.Caller); err != nil || n != 0 {
+		t.Errorf("CountActive() = %d, %v; want 0", n, err)
+	}
+	day, _ := usagePeriods(*exec.StartedAt)
+	if usage, err := store.GetUsage(ctx, "team-a", day); err != nil || usage.Executions != 1 {
+		t.Errorf("team-a usage = %+v, %v; want the execution", usage, err)
+	}
+	if usage, _ := store.GetUsage(ctx, defaultTenant, day); usage != nil && usage.Executions != 0 {
+		t.Errorf("default tenant charged %d executions", usage.Executions)
+	}
+}
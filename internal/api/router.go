@@ -6,6 +6,8 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 
+	"github.com/geraldthewes/python-executor/internal/config"
+
 	_ "github.com/geraldthewes/python-executor/docs/swagger"
 )
 
@@ -16,29 +18,180 @@ func SetupRouter(server *Server, logger *logrus.Logger) *gin.Engine {
 
 	router := gin.New()
 
+	// Clients' addresses, which tell callers without API keys apart, are
+	// taken from X-Forwarded-For only when the connection comes from a
+	// configured proxy
+	var proxies []string
+	if server.config != nil {
+		proxies = server.config.Server.TrustedProxies
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		logger.WithError(err).Warn("Ignoring invalid PYEXEC_TRUSTED_PROXIES")
+		router.SetTrustedProxies(nil)
+	}
+
 	// Middleware
+	router.Use(RequestID)
 	router.Use(Logger(logger))
 	router.Use(Recovery(logger))
 	router.Use(gin.Recovery())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
+		if server.Draining() {
+			c.JSON(503, gin.H{
+				"status": "draining",
+			})
+			return
+		}
 		c.JSON(200, gin.H{
 			"status": "ok",
 		})
 	})
 
-	// API v1 routes
-	v1 := router.Group("/api/v1")
+	// Prometheus metrics
+	router.GET("/metrics", server.Metrics)
+
+	// Calls that change something need an API key with the scope, if the
+	// server has keys. Any valid key may read.
+	run := server.RequireScope(config.ScopeRun)
+	kill := server.RequireScope(config.ScopeKill)
+	admin := server.RequireScope(config.ScopeAdmin)
+
+	// Instance status and load, for operators. It answers while storage
+	// is failing, reporting why in storage.error.
+	router.GET("/api/v1/admin/status", server.Authenticate, server.RateLimit, admin, server.GetStatus)
+
+	// Runner agents, which claim this server's executions and run them on
+	// their own hosts. They authenticate with the runner token rather than
+	// an API key.
+	runners := router.Group("/api/v1/runners", server.RequireStorage, server.RequireRunner)
 	{
-		// Execution endpoints
-		v1.POST("/exec/sync", server.ExecuteSync)
-		v1.POST("/exec/async", server.ExecuteAsync)
+		runners.GET("", server.ListRunners)
+		runners.POST("", server.RegisterRunner)
+		runners.DELETE("/:id", server.DeregisterRunner)
+		runners.POST("/:id/heartbeat", server.RunnerHeartbeat)
+		runners.POST("/:id/claim", server.ClaimRunnerJob)
+		runners.POST("/:id/jobs/:exec_id/started", server.RunnerJobStarted)
+		runners.POST("/:id/jobs/:exec_id/result", server.CompleteRunnerJob)
+	}
+
+	// Progress reports from inside running executions, which authenticate
+	// with their execution's progress token
+	router.POST("/api/v1/executions/:id/progress", server.RequireStorage, server.ReportProgress)
+
+	// API v1 routes. They are refused with 503 while storage is failing,
+	// and with 429 while their caller is over its request rate.
+	v1 := router.Group("/api/v1", server.RequireStorage, server.Authenticate, server.RateLimit)
+	{
+		// Execution endpoints. Submissions are accounted to a tenant
+		// and refused once it has used up its usage budget, or while
+		// their caller has its most executions and sessions unfinished.
+		// Sweeps and pipelines check the latter themselves, once they
+		// know how many executions they submit.
+		v1.POST("/exec/sync", run, server.AccountUsage, server.LimitConcurrency, server.ExecuteSync)
+		v1.POST("/exec/async", run, server.AccountUsage, server.LimitConcurrency, server.ExecuteAsync)
+		v1.POST("/sweeps", run, server.AccountUsage, server.CreateSweep)
+		v1.GET("/executions", server.ListExecutions)
 		v1.GET("/executions/:id", server.GetExecution)
-		v1.DELETE("/executions/:id", server.KillExecution)
+		v1.GET("/executions/:id/stdout", server.GetStdout)
+		v1.GET("/executions/:id/stderr", server.GetStderr)
+		v1.GET("/executions/:id/logs/stream", server.StreamLogs)
+		v1.GET("/executions/:id/artifacts", server.ListArtifacts)
+		v1.GET("/executions/:id/artifacts/*name", server.GetArtifact)
+		v1.DELETE("/executions/:id", kill, server.KillExecution)
+		v1.POST("/executions/:id/pause", kill, server.PauseExecution)
+		v1.POST("/executions/:id/resume", kill, server.ResumeExecution)
+		v1.POST("/executions/:id/checkpoint", kill, server.CheckpointExecution)
+
+		// Chunked archive uploads and the archive cache, executed by
+		// upload_id or archive_sha256
+		v1.POST("/uploads", run, server.CreateUpload)
+		v1.GET("/uploads/:id", server.GetUpload)
+		v1.PUT("/uploads/:id", run, server.UploadChunk)
+		v1.POST("/uploads/:id/complete", run, server.CompleteUpload)
+		v1.DELETE("/uploads/:id", run, server.DeleteUpload)
+		v1.GET("/archives/:sha256", server.GetArchive)
+		v1.POST("/archives", run, server.CreateArchive)
+
+		// Incremental uploads: only the files the server lacks are sent,
+		// then assembled into a cached archive
+		v1.POST("/files/missing", run, server.FindMissingFiles)
+		v1.PUT("/files/:sha256", run, server.PutFile)
+
+		// Resource presets, selected by name in metadata.preset
+		v1.GET("/presets", server.ListPresets)
+
+		// Names of the server-side secrets executions may ask for in
+		// metadata.secrets
+		v1.GET("/secrets", server.ListSecrets)
+
+		// Describe an archive without running it
+		v1.POST("/inspect", run, server.Inspect)
+
+		// Persistent sessions: code sent to one interpreter keeps its
+		// variables and imports from call to call. Opening one counts
+		// against the caller's budget and concurrency like a submission.
+		v1.POST("/sessions", run, server.AccountUsage, server.LimitConcurrency, server.CreateSession)
+		v1.GET("/sessions/:id", server.GetSession)
+		v1.POST("/sessions/:id/eval", run, server.EvalSession)
+		v1.POST("/sessions/:id/exec", run, server.EvalSession)
+		v1.DELETE("/sessions/:id", run, server.DeleteSession)
+
+		// Groups: the executions submitted with one group_id, followed
+		// and killed together
+		v1.GET("/groups/:id", server.GetGroup)
+		v1.DELETE("/groups/:id", kill, server.KillGroup)
+
+		// Pipelines: executions run in dependency order, each step's
+		// outputs copied into the steps that depend on it
+		v1.POST("/pipelines", run, server.AccountUsage, server.CreatePipeline)
+		v1.GET("/pipelines/:id", server.GetPipeline)
+		v1.DELETE("/pipelines/:id", kill, server.CancelPipeline)
 
 		// Simple JSON execution endpoint (Replit/Piston-compatible)
-		v1.POST("/eval", server.ExecuteEval)
+		v1.POST("/eval", run, server.AccountUsage, server.LimitConcurrency, server.ExecuteEval)
+
+		// Named code templates, stored once and run by name with
+		// parameters
+		v1.GET("/templates", server.ListTemplates)
+		v1.GET("/templates/:name", server.GetTemplate)
+		v1.PUT("/templates/:name", admin, server.PutTemplate)
+		v1.DELETE("/templates/:name", admin, server.DeleteTemplate)
+		v1.POST("/templates/:name/render", run, server.RenderTemplate)
+		v1.POST("/templates/:name/run", run, server.AccountUsage, server.LimitConcurrency, server.RunTemplate)
+
+		// Usage of each tenant per day and month, for chargeback
+		v1.GET("/usage", admin, server.GetUsage)
+
+		// Submissions held by the approval rules, approved or rejected by
+		// an admin
+		v1.GET("/admin/approvals", admin, server.ListApprovals)
+		v1.POST("/admin/approvals/:id/approve", admin, server.ApproveExecution)
+		v1.POST("/admin/approvals/:id/reject", admin, server.RejectExecution)
+
+		// Backups of the execution store, restored into any backend
+		v1.GET("/admin/backup", admin, server.GetBackup)
+		v1.POST("/admin/restore", admin, server.RestoreBackup)
+
+		// /eval as a tool for LLM function calling
+		v1.GET("/tool-schema", server.GetToolSchema)
+	}
+
+	// Jupyter kernel gateway: sessions as remote kernels for notebook
+	// servers (jupyter --gateway-url) and jupyter_client based tools.
+	// Notebook servers send the API key as their gateway auth token.
+	jupyter := router.Group("/api", server.Authenticate, server.RateLimit)
+	{
+		jupyter.GET("/kernelspecs", server.ListKernelSpecs)
+		jupyter.GET("/kernelspecs/:name", server.GetKernelSpec)
+		jupyter.GET("/kernels", server.ListKernels)
+		jupyter.POST("/kernels", run, server.AccountUsage, server.LimitConcurrency, server.StartKernel)
+		jupyter.GET("/kernels/:id", server.GetKernel)
+		jupyter.DELETE("/kernels/:id", run, server.DeleteSession)
+		jupyter.POST("/kernels/:id/interrupt", run, server.InterruptKernel)
+		jupyter.POST("/kernels/:id/restart", run, server.RestartKernel)
+		jupyter.GET("/kernels/:id/channels", run, server.KernelChannels)
 	}
 
 	// Swagger documentation
@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/runner"
+	"github.com/gin-gonic/gin"
+)
+
+// maxClaimWait bounds how long a runner's claim waits for a job
+const maxClaimWait = 60 * time.Second
+
+// maxRunnerSlots bounds the slots a runner may register
+const maxRunnerSlots = 256
+
+// SetRunnerPool makes the server accept runner agents, which claim the
+// executions handed to pool. The pool should also be the server's
+// executor.
+func (s *Server) SetRunnerPool(pool *runner.Pool) {
+	s.runners = pool
+}
+
+// RequireRunner refuses runner requests unless runners are enabled and the
+// request carries the runner token
+func (s *Server) RequireRunner(c *gin.Context) {
+	if s.runners == nil || s.config == nil || s.config.Runners.Token == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "runners are not enabled on this server (PYEXEC_EXECUTOR=runners)"})
+		return
+	}
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Runners.Token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or wrong runner token"})
+		return
+	}
+	c.Next()
+}
+
+// runnerError answers a runner request that failed
+func runnerError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, runner.ErrUnknownRunner):
+		c.JSON(http.StatusNotFound, gin.H{"error": "runner not registered"})
+	case errors.Is(err, runner.ErrUnknownJob):
+		c.JSON(http.StatusConflict, gin.H{"error": "the runner does not hold this execution"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// RegisterRunner registers a runner agent
+// @Summary Register a runner
+// @Description Register a runner agent, which then claims executions with
+// @Description POST /runners/{id}/claim. Requires the runner token.
+// @Tags runners
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param registration body runner.Registration true "The runner's name, labels, memory and slots"
+// @Success 201 {object} runner.Info "Registered runner"
+// @Failure 400 {object} gin.H "Invalid registration"
+// @Failure 401 {object} gin.H "Missing or wrong runner token"
+// @Failure 403 {object} gin.H "Runners are not enabled"
+// @Router /runners [post]
+func (s *Server) RegisterRunner(c *gin.Context) {
+	var reg runner.Registration
+	if err := c.ShouldBindJSON(&reg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if reg.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if reg.Slots < 1 || reg.Slots > maxRunnerSlots {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slots must be between 1 and " + strconv.Itoa(maxRunnerSlots)})
+		return
+	}
+	if err := validatePlacement(reg.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, s.runners.Register(reg))
+}
+
+// ListRunners lists the registered runners
+// @Summary List runners
+// @Description List the runner agents registered with this server, with
+// @Description the executions each is running and when it was last heard from.
+// @Tags runners
+// @Produce json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Success 200 {object} runner.List "Registered runners"
+// @Failure 401 {object} gin.H "Missing or wrong runner token"
+// @Failure 403 {object} gin.H "Runners are not enabled"
+// @Router /runners [get]
+func (s *Server) ListRunners(c *gin.Context) {
+	c.JSON(http.StatusOK, runner.List{Runners: s.runners.Runners()})
+}
+
+// DeregisterRunner removes a runner
+// @Summary Deregister a runner
+// @Description Remove a runner agent. Executions it is still running fail.
+// @Tags runners
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param id path string true "Runner ID"
+// @Success 204 "Runner removed"
+// @Failure 404 {object} gin.H "Runner not registered"
+// @Router /runners/{id} [delete]
+func (s *Server) DeregisterRunner(c *gin.Context) {
+	if err := s.runners.Deregister(c.Param("id")); err != nil {
+		runnerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RunnerHeartbeat records that a runner is alive
+// @Summary Runner heartbeat
+// @Description Record that a runner is alive. The response lists the
+// @Description containers of executions killed since, which the runner kills.
+// @Tags runners
+// @Produce json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param id path string true "Runner ID"
+// @Success 200 {object} runner.Heartbeat "Containers to kill"
+// @Failure 404 {object} gin.H "Runner not registered; register again"
+// @Router /runners/{id}/heartbeat [post]
+func (s *Server) RunnerHeartbeat(c *gin.Context) {
+	hb, err := s.runners.Heartbeat(c.Param("id"))
+	if err != nil {
+		runnerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, hb)
+}
+
+// ClaimRunnerJob hands a runner an execution to run
+// @Summary Claim an execution
+// @Description Wait up to wait seconds for an execution the runner can run
+// @Description (its labels satisfy the execution's placement) and hand it to
+// @Description the runner, with its environment resolved.
+// @Tags runners
+// @Produce json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param id path string true "Runner ID"
+// @Param wait query int false "Seconds to wait for an execution (default 20, at most 60)"
+// @Success 200 {object} runner.Job "Execution to run"
+// @Success 204 "No execution came"
+// @Failure 404 {object} gin.H "Runner not registered; register again"
+// @Router /runners/{id}/claim [post]
+func (s *Server) ClaimRunnerJob(c *gin.Context) {
+	wait := 20 * time.Second
+	if v := c.Query("wait"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wait must be a number of seconds"})
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxClaimWait)
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), wait)
+	defer cancel()
+	job, err := s.runners.Claim(ctx, c.Param("id"))
+	if err != nil {
+		runnerError(c, err)
+		return
+	}
+	if job == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RunnerJobStarted records the container of a runner's execution
+// @Summary Report an execution's container
+// @Description Record the container a runner created for an execution, so
+// @Description the execution can be killed.
+// @Tags runners
+// @Accept json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param id path string true "Runner ID"
+// @Param exec_id path string true "Execution ID"
+// @Param started body runner.Started true "Container ID"
+// @Success 204 "Recorded"
+// @Failure 404 {object} gin.H "Runner not registered"
+// @Failure 409 {object} gin.H "The runner does not hold the execution; kill the container"
+// @Router /runners/{id}/jobs/{exec_id}/started [post]
+func (s *Server) RunnerJobStarted(c *gin.Context) {
+	var started runner.Started
+	if err := c.ShouldBindJSON(&started); err != nil || started.ContainerID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "container_id is required"})
+		return
+	}
+	if err := s.runners.Started(c.Param("id"), c.Param("exec_id"), started.ContainerID); err != nil {
+		runnerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CompleteRunnerJob records the result of a runner's execution
+// @Summary Report an execution's result
+// @Description Report the output of an execution a runner ran, or the error
+// @Description that kept it from running. The server records it as if it
+// @Description had run the execution itself.
+// @Tags runners
+// @Accept json
+// @Param Authorization header string true "Bearer and the runner token"
+// @Param id path string true "Runner ID"
+// @Param exec_id path string true "Execution ID"
+// @Param result body runner.Result true "Output or error"
+// @Success 204 "Recorded"
+// @Failure 400 {object} gin.H "Invalid result"
+// @Failure 404 {object} gin.H "Runner not registered"
+// @Failure 409 {object} gin.H "The runner does not hold the execution"
+// @Router /runners/{id}/jobs/{exec_id}/result [post]
+func (s *Server) CompleteRunnerJob(c *gin.Context) {
+	var result runner.Result
+	if err := c.ShouldBindJSON(&result); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := s.runners.Complete(c.Param("id"), c.Param("exec_id"), result); err != nil {
+		runnerError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
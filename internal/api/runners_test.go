@@ -0,0 +1,117 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/runner"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunnerAgent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Runners.Token = "runner-token"
+	pool := runner.NewPool(time.Minute, 1024)
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), pool, cfg)
+	server.SetRunnerPool(pool)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	ts := httptest.NewServer(SetupRouter(server, logger))
+	defer ts.Close()
+
+	// The runner token is required
+	resp, err := http.Get(ts.URL + "/api/v1/runners")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status without token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{Stdout: "from the runner\n"}}
+	agent, err := runner.NewAgent(ts.URL, "runner-token", runner.Registration{
+		Name:   "gpu-1",
+		Labels: map[string]string{"gpu": "true"},
+		Slots:  2,
+	}, fake, 50*time.Millisecond, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- agent.Run(ctx) }()
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)", Placement: map[string]string{"gpu": "true"}})
+	resp, err = http.Post(ts.URL+"/api/v1/eval", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	var result client.ExecutionResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Stdout != "from the runner\n" || result.Status != client.StatusCompleted {
+		t.Errorf("result = %+v", result)
+	}
+	if env := fake.requests[0].Env; !slices.Contains(env, "PYEXEC_EXECUTION_ID="+result.ExecutionID) {
+		t.Errorf("runner got env %v, want the server's", env)
+	}
+	exec, err := server.storage.Get(context.Background(), result.ExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.ContainerID != "container-"+result.ExecutionID {
+		t.Errorf("container ID = %q, want the runner's", exec.ContainerID)
+	}
+
+	// The runner deregisters once stopped
+	if runners := pool.Runners(); len(runners) != 1 || runners[0].Name != "gpu-1" {
+		t.Errorf("runners = %+v", runners)
+	}
+	stop()
+	if err := <-stopped; err != nil {
+		t.Errorf("Run() = %v", err)
+	}
+	if runners := pool.Runners(); len(runners) != 0 {
+		t.Errorf("runners after stop = %+v", runners)
+	}
+}
+
+func TestRunnersDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{}
+	cfg.Runners.Token = "runner-token"
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, cfg)
+
+	router := gin.New()
+	router.POST("/runners", server.RequireRunner, server.RegisterRunner)
+
+	req := httptest.NewRequest(http.MethodPost, "/runners", bytes.NewReader([]byte(`{"name":"r","slots":1}`)))
+	req.Header.Set("Authorization", "Bearer runner-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
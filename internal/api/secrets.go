@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/geraldthewes/python-executor/internal/redact"
+	"github.com/geraldthewes/python-executor/internal/secrets"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// secretNamePattern matches the secret names executions may ask for: names
+// the script can read as environment variables
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+
+// maxSecrets bounds the secrets one execution may ask for
+const maxSecrets = 32
+
+// validateSecretNames checks the secrets a request asks for, if any
+func validateSecretNames(names []string) error {
+	if len(names) > maxSecrets {
+		return fmt.Errorf("too many secrets: %d, at most %d", len(names), maxSecrets)
+	}
+	for _, name := range names {
+		if !secretNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid secret name %q: use up to 128 letters, digits and '_', not starting with a digit", name)
+		}
+	}
+	return nil
+}
+
+// SetSecretStore makes the server pass the secrets executions name in
+// Metadata.Secrets from store
+func (s *Server) SetSecretStore(store secrets.Store) {
+	s.secrets = store
+}
+
+// secretEnv returns the environment variables holding the secrets an
+// execution asks for. They are read anew for every run and never stored.
+func (s *Server) secretEnv(ctx context.Context, exec *storage.Execution) ([]string, error) {
+	if exec.Metadata == nil || len(exec.Metadata.Secrets) == 0 {
+		return nil, nil
+	}
+	values, err := secrets.Resolve(ctx, s.secrets, exec.Metadata.Secrets)
+	if err != nil {
+		return nil, fmt.Errorf("resolving secrets: %w", err)
+	}
+	env := make([]string, len(values))
+	for i, value := range values {
+		env[i] = exec.Metadata.Secrets[i] + "=" + value
+	}
+	return env, nil
+}
+
+// outputRedactor returns the redactor of an execution's output, which also
+// masks the values of the secrets it was given
+func (s *Server) outputRedactor(exec *storage.Execution) *redact.Redactor {
+	if exec.Metadata == nil || len(exec.Metadata.Secrets) == 0 {
+		return s.redactor
+	}
+	values, _ := secrets.Resolve(context.Background(), s.secrets, exec.Metadata.Secrets)
+	return s.redactor.With(values...)
+}
+
+// ListSecrets lists the names of the server's secrets
+// @Summary List secrets
+// @Description List the names of the secrets registered with the server's
+// @Description secrets backend, which an execution receives as environment
+// @Description variables by naming them in metadata.secrets. Values are
+// @Description never returned.
+// @Tags execution
+// @Produce json
+// @Success 200 {object} client.SecretList "Secret names"
+// @Failure 500 {object} gin.H "Failed to read the secrets backend"
+// @Router /secrets [get]
+func (s *Server) ListSecrets(c *gin.Context) {
+	list := client.SecretList{Secrets: []string{}}
+	if s.secrets != nil {
+		names, err := s.secrets.List(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		list.Secrets = append(list.Secrets, names...)
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/secrets"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExecutionSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TEST_SECRET_API_KEY", "k-0123456789")
+
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{Stdout: "key is k-0123456789\n"}}
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+	server.SetSecretStore(secrets.NewEnvStore("TEST_SECRET_"))
+
+	router := gin.New()
+	router.POST("/eval", server.ExecuteEval)
+	router.GET("/secrets", server.ListSecrets)
+
+	eval := func(names ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)", Secrets: names})
+		req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := eval("API_KEY")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", w.Code, w.Body.String())
+	}
+	if env := fake.requests[0].Env; !slices.Contains(env, "API_KEY=k-0123456789") {
+		t.Errorf("container env %v is missing the secret", env)
+	}
+
+	// The value is masked in the output and stored nowhere
+	var result client.ExecutionResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Stdout != "key is [REDACTED]\n" {
+		t.Errorf("stdout = %q", result.Stdout)
+	}
+	exec, err := store.Get(context.Background(), result.ExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := json.Marshal(exec)
+	if strings.Contains(string(stored), "k-0123456789") {
+		t.Errorf("stored execution holds the secret: %s", stored)
+	}
+
+	// A secret the server doesn't have fails the execution
+	w = eval("MISSING")
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Status != client.StatusFailed || !strings.Contains(result.Error, "MISSING") {
+		t.Errorf("missing secret: status %s, error %q", result.Status, result.Error)
+	}
+
+	if w := eval("not-a-name"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid secret name: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/secrets", nil))
+	var list client.SecretList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Secrets) != 1 || list.Secrets[0] != "API_KEY" {
+		t.Errorf("secrets = %v", list.Secrets)
+	}
+}
@@ -0,0 +1,594 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Errors opening or using a session, mapped to statuses by sessionError
+var (
+	errSessionLimit    = errors.New("too many open sessions")
+	errSessionInvalid  = errors.New("invalid session request")
+	errSessionTooLarge = errors.New("session files too large")
+	errSessionNotFound = errors.New("session not found")
+	errSessionApproval = errors.New("session requires approval")
+)
+
+// installError reports that a session's dependencies failed to install
+type installError struct {
+	install *client.InstallResult
+}
+
+func (e *installError) Error() string {
+	return "installing dependencies failed"
+}
+
+// session is a persistent session open on this instance. info, handle and
+// the kernel fields are guarded by Server.sessionsMu; busy holds a token
+// while code runs, so that evals of one session run one at a time.
+type session struct {
+	handle  *executor.Session
+	start   *executor.SessionRequest // to start the interpreter again on restart
+	info    client.Session
+	timeout time.Duration // default eval timeout; zero means none
+	running bool
+	busy    chan struct{}
+
+	caller string // who opened it, for concurrency quotas (see quotaCaller)
+
+	// Set for sessions started as Jupyter kernels (see jupyter.go)
+	kernelName     string
+	executionCount int
+	connections    int
+}
+
+// touch records that the session ran code. The caller holds sessionsMu.
+func (sess *session) touch(now time.Time) {
+	sess.info.LastUsedAt = now
+	if sess.info.IdleTimeoutSeconds > 0 {
+		expiresAt := now.Add(time.Duration(sess.info.IdleTimeoutSeconds) * time.Second)
+		sess.info.ExpiresAt = &expiresAt
+	}
+}
+
+// callerSessions counts the sessions open on this instance that caller
+// opened
+func (s *Server) callerSessions(caller string) int {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	n := 0
+	for _, sess := range s.sessions {
+		if sess.caller == caller {
+			n++
+		}
+	}
+	return n
+}
+
+// sessionExecutor returns the executor as a SessionExecutor, or false if
+// it can't run sessions
+func (s *Server) sessionExecutor() (executor.SessionExecutor, bool) {
+	sessions, ok := s.executor.(executor.SessionExecutor)
+	return sessions, ok
+}
+
+// sessionError writes the response for an error opening or using a session
+func sessionError(c *gin.Context, err error) {
+	var install *installError
+	switch {
+	case errors.As(err, &install):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "install": install.install})
+	case errors.Is(err, errSessionLimit):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, errSessionInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errSessionTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, errSessionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errSessionApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateSession starts a persistent session
+// @Summary Start a persistent session
+// @Description Start a long-lived container running one Python interpreter.
+// @Description Code sent to /sessions/{id}/eval runs in the same process, so
+// @Description variables and imports persist across calls. The session is
+// @Description closed after idle_timeout_seconds without an eval, or by
+// @Description DELETE /sessions/{id}. Sessions live on the instance that
+// @Description created them.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Param request body client.CreateSessionRequest true "Session request"
+// @Success 201 {object} client.Session "Session started"
+// @Failure 400 {object} gin.H "Invalid request"
+// @Failure 403 {object} gin.H "The session matches an approval rule"
+// @Failure 413 {object} gin.H "Code size exceeds limit"
+// @Failure 422 {object} gin.H "Installing dependencies failed"
+// @Failure 429 {object} gin.H "Too many open sessions, the tenant has used up its usage budget, or the caller has its most executions and sessions unfinished"
+// @Failure 500 {object} gin.H "Starting the session failed"
+// @Failure 501 {object} gin.H "Sessions are not supported"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /sessions [post]
+func (s *Server) CreateSession(c *gin.Context) {
+	if _, ok := s.sessionExecutor(); !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "sessions are not supported by this executor"})
+		return
+	}
+
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
+	var req client.CreateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+
+	sess, err := s.openSession(c.Request.Context(), &req, "", callerOf(c), tenantOf(c))
+	if err != nil {
+		sessionError(c, err)
+		return
+	}
+
+	s.sessionsMu.Lock()
+	info := sess.info
+	s.sessionsMu.Unlock()
+	c.JSON(http.StatusCreated, info)
+}
+
+// openSession validates a session request, starts its interpreter and
+// adds it to the open sessions. kernelName is set for Jupyter kernels.
+// A session can run any code for as long as it stays open, so one that
+// matches an approval rule is refused: it can't be held as executions are.
+func (s *Server) openSession(ctx context.Context, req *client.CreateSessionRequest, kernelName, caller, tenant string) (*session, error) {
+	sessions, _ := s.sessionExecutor()
+
+	var totalSize int
+	for _, f := range req.Files {
+		if _, err := decodeFileContent(f); err != nil {
+			return nil, fmt.Errorf("%w: %w", errSessionInvalid, err)
+		}
+		if _, err := fileMode(f); err != nil {
+			return nil, fmt.Errorf("%w: %w", errSessionInvalid, err)
+		}
+		totalSize += len(f.Content)
+	}
+	if totalSize > maxCodeSize {
+		return nil, fmt.Errorf("%w: total code size %d bytes exceeds limit of %d bytes", errSessionTooLarge, totalSize, maxCodeSize)
+	}
+
+	dockerImage := req.DockerImage
+	if req.PythonVersion != "" {
+		var ok bool
+		dockerImage, ok = pythonVersionImages[req.PythonVersion]
+		if !ok {
+			return nil, fmt.Errorf("%w: unsupported python_version %q; supported versions: 3.10, 3.11, 3.12, 3.13", errSessionInvalid, req.PythonVersion)
+		}
+	}
+
+	idleTimeout := s.config.Session.IdleTimeout
+	if req.IdleTimeoutSeconds > 0 {
+		idleTimeout = time.Duration(req.IdleTimeoutSeconds) * time.Second
+	}
+	if max := s.config.Session.MaxIdleTimeout; max > 0 && idleTimeout > max {
+		idleTimeout = max
+	}
+
+	metadata := &client.Metadata{
+		DockerImage:     dockerImage,
+		RequirementsTxt: req.RequirementsTxt,
+		PreCommands:     req.PreCommands,
+		EnvVars:         req.EnvVars,
+		Config:          req.Config,
+	}
+	if reason := s.approvalReason(metadata, tenant); reason != "" {
+		return nil, fmt.Errorf("%w (%s); run the code as an execution to have it approved", errSessionApproval, reason)
+	}
+
+	tarData, err := buildTarFromFiles(req.Files)
+	if err != nil {
+		return nil, fmt.Errorf("building archive: %w", err)
+	}
+
+	// Hold a place until the container is up, so concurrent requests
+	// can't exceed the limit
+	s.sessionsMu.Lock()
+	if max := s.config.Session.Max; max > 0 && len(s.sessions)+s.sessionsStarting >= max {
+		s.sessionsMu.Unlock()
+		return nil, fmt.Errorf("%w (limit %d); close one first", errSessionLimit, max)
+	}
+	s.sessionsStarting++
+	s.sessionsMu.Unlock()
+	defer func() {
+		s.sessionsMu.Lock()
+		s.sessionsStarting--
+		s.sessionsMu.Unlock()
+	}()
+
+	id := fmt.Sprintf("ses_%s", uuid.New().String())
+	start := &executor.SessionRequest{
+		ID:          id,
+		TarData:     tarData,
+		Metadata:    metadata,
+		IdleTimeout: idleTimeout,
+	}
+
+	handle, err := sessions.StartSession(ctx, start)
+	if err != nil {
+		return nil, fmt.Errorf("starting session: %w", err)
+	}
+	if handle.ContainerID == "" {
+		return nil, &installError{install: handle.Install}
+	}
+
+	now := time.Now().UTC()
+	sess := &session{
+		handle: handle,
+		start:  start,
+		info: client.Session{
+			ID:                 id,
+			DockerImage:        metadata.DockerImage,
+			CreatedAt:          now,
+			IdleTimeoutSeconds: int(idleTimeout / time.Second),
+			Install:            handle.Install,
+		},
+		busy:       make(chan struct{}, 1),
+		caller:     caller,
+		kernelName: kernelName,
+	}
+	if metadata.Config != nil {
+		sess.timeout = time.Duration(metadata.Config.TimeoutSeconds) * time.Second
+	}
+	sess.touch(now)
+
+	s.sessionsMu.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[string]*session)
+	}
+	s.sessions[id] = sess
+	s.sessionsMu.Unlock()
+
+	return sess, nil
+}
+
+// lookupSession returns the open session a request names by ID. Sessions
+// are private to the caller that opened them and to admin keys; other
+// callers' sessions are not found.
+func (s *Server) lookupSession(c *gin.Context) (*session, bool) {
+	s.sessionsMu.Lock()
+	sess, ok := s.sessions[c.Param("id")]
+	s.sessionsMu.Unlock()
+	if !ok || !canUseSession(c, sess) {
+		return nil, false
+	}
+	return sess, true
+}
+
+// canUseSession reports whether a request may see and use sess
+func canUseSession(c *gin.Context, sess *session) bool {
+	caller, k := quotaCaller(c)
+	return caller == sess.caller || k.HasScope(config.ScopeAdmin)
+}
+
+// runInSession runs code in a session once its previous eval is done,
+// with the given timeout, or the session's default if zero
+func (s *Server) runInSession(ctx context.Context, sess *session, code string, timeout time.Duration) (*executor.SessionOutput, error) {
+	sessions, _ := s.sessionExecutor()
+
+	// Wait for the session's previous eval
+	select {
+	case sess.busy <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-sess.busy }()
+
+	// The session may have been closed while waiting
+	s.sessionsMu.Lock()
+	if s.sessions[sess.info.ID] != sess {
+		s.sessionsMu.Unlock()
+		return nil, errSessionNotFound
+	}
+	sess.running = true
+	handle := sess.handle
+	s.sessionsMu.Unlock()
+
+	if timeout == 0 {
+		timeout = sess.timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	output, err := sessions.EvalSession(ctx, handle, code)
+
+	s.sessionsMu.Lock()
+	sess.running = false
+	sess.info.Evals++
+	sess.touch(time.Now().UTC())
+	s.sessionsMu.Unlock()
+
+	return output, err
+}
+
+// interruptSession interrupts the code a session is running, if any
+func (s *Server) interruptSession(ctx context.Context, sess *session) error {
+	sessions, _ := s.sessionExecutor()
+
+	s.sessionsMu.Lock()
+	handle := sess.handle
+	s.sessionsMu.Unlock()
+
+	return sessions.InterruptSession(ctx, handle)
+}
+
+// restartSession replaces a session's interpreter with a fresh one started
+// from the same request, discarding its state
+func (s *Server) restartSession(ctx context.Context, sess *session) error {
+	sessions, _ := s.sessionExecutor()
+
+	// Stop the running code first so the busy token comes free
+	s.interruptSession(ctx, sess)
+	select {
+	case sess.busy <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-sess.busy }()
+
+	s.sessionsMu.Lock()
+	old := sess.handle
+	s.sessionsMu.Unlock()
+	if err := sessions.CloseSession(ctx, old); err != nil {
+		return fmt.Errorf("closing session: %w", err)
+	}
+
+	handle, err := sessions.StartSession(ctx, sess.start)
+	if err == nil && handle.ContainerID == "" {
+		err = &installError{install: handle.Install}
+	}
+	if err != nil {
+		// Without an interpreter the session is gone
+		s.sessionsMu.Lock()
+		if s.sessions[sess.info.ID] == sess {
+			delete(s.sessions, sess.info.ID)
+		}
+		s.sessionsMu.Unlock()
+		return fmt.Errorf("starting session: %w", err)
+	}
+
+	s.sessionsMu.Lock()
+	sess.handle = handle
+	sess.executionCount = 0
+	sess.touch(time.Now().UTC())
+	closed := s.sessions[sess.info.ID] != sess
+	s.sessionsMu.Unlock()
+
+	// The session was closed while restarting
+	if closed {
+		sessions.CloseSession(ctx, handle)
+		return errSessionNotFound
+	}
+	return nil
+}
+
+// GetSession describes a session
+// @Summary Get a session
+// @Description Return a session's state, including when it expires.
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} client.Session "Session"
+// @Failure 404 {object} gin.H "Session not found"
+// @Router /sessions/{id} [get]
+func (s *Server) GetSession(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	s.sessionsMu.Lock()
+	info := sess.info
+	s.sessionsMu.Unlock()
+	c.JSON(http.StatusOK, info)
+}
+
+// EvalSession runs code in a session
+// @Summary Run code in a session
+// @Description Run code in the session's interpreter, where earlier evals'
+// @Description variables and imports are still defined. If the last statement
+// @Description is an expression, the repr() of its value is returned in result.
+// @Description An exception is reported in error and leaves the session usable,
+// @Description as does a timeout, which interrupts the code. Evals of one
+// @Description session run one at a time. /exec is another name for /eval.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ID"
+// @Param request body client.SessionEvalRequest true "Code to run"
+// @Success 200 {object} client.SessionEvalResult "Eval completed"
+// @Failure 400 {object} gin.H "Invalid request"
+// @Failure 404 {object} gin.H "Session not found"
+// @Failure 413 {object} gin.H "Code size exceeds limit"
+// @Failure 500 {object} gin.H "Running the code failed"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /sessions/{id}/eval [post]
+// @Router /sessions/{id}/exec [post]
+func (s *Server) EvalSession(c *gin.Context) {
+	if _, ok := s.sessionExecutor(); !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "sessions are not supported by this executor"})
+		return
+	}
+
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
+	var req client.SessionEvalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'code' must be provided"})
+		return
+	}
+	if len(req.Code) > maxCodeSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("code size %d bytes exceeds limit of %d bytes", len(req.Code), maxCodeSize),
+		})
+		return
+	}
+
+	sess, ok := s.lookupSession(c)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = sess.timeout
+	}
+
+	startTime := time.Now()
+	output, err := s.runInSession(c.Request.Context(), sess, req.Code, timeout)
+	if errors.Is(err, executor.ErrTimeout) {
+		c.JSON(http.StatusOK, client.SessionEvalResult{
+			Error:             fmt.Sprintf("eval timed out after %s and was interrupted", timeout),
+			ErrorType:         "TimeoutError",
+			TerminationReason: client.TerminationTimeout,
+			DurationMs:        time.Since(startTime).Milliseconds(),
+		})
+		return
+	}
+	if errors.Is(err, errSessionNotFound) {
+		sessionError(c, err)
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("running code: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, client.SessionEvalResult{
+		Stdout:     output.Stdout,
+		Stderr:     output.Stderr,
+		Result:     output.Result,
+		Error:      output.Error,
+		ErrorType:  output.ErrorType,
+		DurationMs: output.DurationMs,
+	})
+}
+
+// DeleteSession closes a session
+// @Summary Close a session
+// @Description Stop the session's interpreter and remove its container. An
+// @Description eval still running is cut short.
+// @Tags sessions
+// @Param id path string true "Session ID"
+// @Success 204 "Session closed"
+// @Failure 404 {object} gin.H "Session not found"
+// @Failure 500 {object} gin.H "Removing the container failed"
+// @Router /sessions/{id} [delete]
+func (s *Server) DeleteSession(c *gin.Context) {
+	sess, ok := s.lookupSession(c)
+	if ok {
+		// Another request may have closed it meanwhile
+		s.sessionsMu.Lock()
+		ok = s.sessions[sess.info.ID] == sess
+		delete(s.sessions, sess.info.ID)
+		s.sessionsMu.Unlock()
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err := s.closeSession(c.Request.Context(), sess); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CloseIdleSessions closes the sessions whose idle timeout has passed and
+// returns how many were closed
+func (s *Server) CloseIdleSessions(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	var idle []*session
+	s.sessionsMu.Lock()
+	for id, sess := range s.sessions {
+		// Kernels with a notebook attached stay open
+		if !sess.running && sess.connections == 0 && sess.info.ExpiresAt != nil && now.After(*sess.info.ExpiresAt) {
+			idle = append(idle, sess)
+			delete(s.sessions, id)
+		}
+	}
+	s.sessionsMu.Unlock()
+
+	return len(idle), s.closeSessions(ctx, idle)
+}
+
+// CloseSessions closes every open session, e.g. when the server stops
+func (s *Server) CloseSessions(ctx context.Context) error {
+	s.sessionsMu.Lock()
+	all := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		all = append(all, sess)
+	}
+	s.sessions = nil
+	s.sessionsMu.Unlock()
+
+	return s.closeSessions(ctx, all)
+}
+
+// closeSessions closes sessions already removed from the map
+func (s *Server) closeSessions(ctx context.Context, sessions []*session) error {
+	var errs []error
+	for _, sess := range sessions {
+		if err := s.closeSession(ctx, sess); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", sess.info.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// closeSession removes a session's container
+func (s *Server) closeSession(ctx context.Context, sess *session) error {
+	sessions, ok := s.sessionExecutor()
+	if !ok {
+		return nil
+	}
+	s.sessionsMu.Lock()
+	handle := sess.handle
+	s.sessionsMu.Unlock()
+	return sessions.CloseSession(ctx, handle)
+}
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeSessionExecutor runs sessions by recording the code sent to each
+// container. Code "sleep" runs until the context ends or the session is
+// interrupted, including by an interrupt sent before it started; "1/0"
+// raises an exception.
+type fakeSessionExecutor struct {
+	fakeExecutor
+	started     []*executor.SessionRequest
+	evals       map[string][]string
+	closed      []string
+	interrupted []string
+	interrupt   chan struct{}
+}
+
+func (f *fakeSessionExecutor) StartSession(ctx context.Context, req *executor.SessionRequest) (*executor.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.started = append(f.started, req)
+	return &executor.Session{ContainerID: fmt.Sprintf("container-%d", len(f.started))}, nil
+}
+
+func (f *fakeSessionExecutor) EvalSession(ctx context.Context, session *executor.Session, code string) (*executor.SessionOutput, error) {
+	if code == "sleep" {
+		f.mu.Lock()
+		if f.interrupt == nil {
+			f.interrupt = make(chan struct{})
+		}
+		interrupt := f.interrupt
+		f.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", executor.ErrTimeout, ctx.Err())
+		case <-interrupt:
+			f.mu.Lock()
+			f.interrupt = nil
+			f.mu.Unlock()
+			traceback := "Traceback (most recent call last):\n  File \"<session>\", line 1, in <module>\nKeyboardInterrupt\n"
+			return &executor.SessionOutput{Stderr: traceback, Error: "KeyboardInterrupt", ErrorType: "KeyboardInterrupt", Traceback: traceback}, nil
+		}
+	}
+	if code == "1/0" {
+		traceback := "Traceback (most recent call last):\n  File \"<session>\", line 1, in <module>\nZeroDivisionError: division by zero\n"
+		return &executor.SessionOutput{
+			Stdout:    "before\n",
+			Stderr:    "warning\n" + traceback,
+			Error:     "ZeroDivisionError: division by zero",
+			ErrorType: "ZeroDivisionError",
+			Traceback: traceback,
+		}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.evals == nil {
+		f.evals = make(map[string][]string)
+	}
+	f.evals[session.ContainerID] = append(f.evals[session.ContainerID], code)
+	result := strings.Join(f.evals[session.ContainerID], ";")
+	return &executor.SessionOutput{Result: &result}, nil
+}
+
+func (f *fakeSessionExecutor) InterruptSession(ctx context.Context, session *executor.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.interrupted = append(f.interrupted, session.ContainerID)
+	if f.interrupt == nil {
+		f.interrupt = make(chan struct{})
+	}
+	select {
+	case <-f.interrupt:
+	default:
+		close(f.interrupt)
+	}
+	return nil
+}
+
+func (f *fakeSessionExecutor) CloseSession(ctx context.Context, session *executor.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = append(f.closed, session.ContainerID)
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeSessionExecutor{}
+	cfg := &config.Config{Session: config.SessionConfig{Max: 2, IdleTimeout: time.Minute, MaxIdleTimeout: time.Hour}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/sessions", server.CreateSession)
+	router.GET("/sessions/:id", server.GetSession)
+	router.POST("/sessions/:id/eval", server.EvalSession)
+	router.POST("/sessions/:id/exec", server.EvalSession)
+	router.DELETE("/sessions/:id", server.DeleteSession)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := do(http.MethodPost, "/sessions", `{"files":[{"name":"helpers.py","content":"x = 1"}],"python_version":"3.11","idle_timeout_seconds":7200,"config":{"timeout_seconds":5}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d (body %s)", w.Code, w.Body.String())
+	}
+	var sess client.Session
+	json.Unmarshal(w.Body.Bytes(), &sess)
+	if !strings.HasPrefix(sess.ID, "ses_") || sess.IdleTimeoutSeconds != 3600 || sess.DockerImage != "python:3.11-slim" || sess.ExpiresAt == nil {
+		t.Errorf("session = %+v, want an ID, the capped idle timeout and the 3.11 image", sess)
+	}
+	if len(fake.started[0].TarData) == 0 || fake.started[0].IdleTimeout != time.Hour {
+		t.Errorf("start request = %+v, want the files and the idle timeout", fake.started[0])
+	}
+
+	// Evals run in the same container, one after the other
+	do(http.MethodPost, "/sessions/"+sess.ID+"/exec", `{"code":"x = 2"}`)
+	w = do(http.MethodPost, "/sessions/"+sess.ID+"/eval", `{"code":"x"}`)
+	var result client.SessionEvalResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Result == nil || *result.Result != "x = 2;x" {
+		t.Fatalf("eval = %d %s, want both evals in one session", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodPost, "/sessions/"+sess.ID+"/eval", `{"code":"sleep","timeout_seconds":1}`)
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.TerminationReason != client.TerminationTimeout {
+		t.Errorf("eval past timeout = %d %s, want a timeout result", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/sessions/"+sess.ID, "")
+	json.Unmarshal(w.Body.Bytes(), &sess)
+	if w.Code != http.StatusOK || sess.Evals != 3 {
+		t.Errorf("get = %d %s, want 3 evals", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPost, "/sessions/"+sess.ID+"/eval", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("eval without code status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// The limit counts open sessions
+	do(http.MethodPost, "/sessions", `{}`)
+	if w := do(http.MethodPost, "/sessions", `{}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("create past limit status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+
+	if w := do(http.MethodDelete, "/sessions/"+sess.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if len(fake.closed) != 1 || fake.closed[0] != "container-1" {
+		t.Errorf("closed = %v, want container-1", fake.closed)
+	}
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		if w := do(method, "/sessions/"+sess.ID, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s closed session status = %d, want %d", method, w.Code, http.StatusNotFound)
+		}
+	}
+	if w := do(http.MethodPost, "/sessions/"+sess.ID+"/eval", `{"code":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("eval in closed session status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestCloseIdleSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeSessionExecutor{}
+	cfg := &config.Config{Session: config.SessionConfig{IdleTimeout: time.Minute}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/sessions", server.CreateSession)
+	for _, body := range []string{`{"idle_timeout_seconds":1}`, `{}`} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sessions", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create status = %d (body %s)", w.Code, w.Body.String())
+		}
+	}
+
+	if closed, err := server.CloseIdleSessions(context.Background()); err != nil || closed != 0 {
+		t.Errorf("CloseIdleSessions() = %d, %v before any expired", closed, err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if closed, err := server.CloseIdleSessions(context.Background()); err != nil || closed != 1 {
+		t.Errorf("CloseIdleSessions() = %d, %v, want 1", closed, err)
+	}
+	if len(fake.closed) != 1 || fake.closed[0] != "container-1" {
+		t.Errorf("closed = %v, want the session with the short timeout", fake.closed)
+	}
+
+	if err := server.CloseSessions(context.Background()); err != nil || len(fake.closed) != 2 {
+		t.Errorf("CloseSessions() = %v, closed %v", err, fake.closed)
+	}
+}
+
+func TestSessions_Unsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+	router := gin.New()
+	router.POST("/sessions", server.CreateSession)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/sessions", strings.NewReader(`{}`)))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotImplemented)
+	}
+}
+
+func TestSessions_Approval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeSessionExecutor{}
+	cfg := &config.Config{
+		Approval: config.ApprovalConfig{MemoryMB: 2048, Tenants: []string{"lab"}},
+		Defaults: config.DefaultsConfig{MemoryMB: 1024},
+	}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+	router := gin.New()
+	router.POST("/sessions", server.AccountUsage, server.CreateSession)
+	router.POST("/kernels", server.AccountUsage, server.StartKernel)
+
+	do := func(path, body, tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if tenant != "" {
+			req.Header.Set(TenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Sessions and kernels can't wait for approval, so matching ones are
+	// refused
+	for _, tt := range []struct{ path, body, tenant, reason string }{
+		{"/sessions", `{"config":{"memory_mb":4096}}`, "", "memory_mb above 2048"},
+		{"/kernels", `{"name":"python3"}`, "lab", "tenant lab requires approval"},
+	} {
+		if w := do(tt.path, tt.body, tt.tenant); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), tt.reason) {
+			t.Errorf("POST %s = %d %s, want %d", tt.path, w.Code, w.Body.String(), http.StatusForbidden)
+		}
+	}
+	if len(fake.started) != 0 {
+		t.Errorf("%d sessions started", len(fake.started))
+	}
+
+	// Those within the rules start
+	if w := do("/kernels", `{"name":"python3"}`, "team-a"); w.Code != http.StatusCreated {
+		t.Errorf("POST /kernels = %d %s, want %d", w.Code, w.Body.String(), http.StatusCreated)
+	}
+}
+
+func TestSessions_OtherCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeSessionExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+	if err := server.SetAPIKeys([]config.APIKey{
+		{Name: "alice", Key: "alice-key", Scopes: []string{config.ScopeRun}},
+		{Name: "bob", Key: "bob-key", Scopes: []string{config.ScopeRun}},
+		{Name: "ops", Key: "admin-key", Scopes: []string{config.ScopeAdmin}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(server.Authenticate)
+	router.POST("/sessions", server.CreateSession)
+	router.GET("/sessions/:id", server.GetSession)
+	router.POST("/sessions/:id/eval", server.EvalSession)
+	router.DELETE("/sessions/:id", server.DeleteSession)
+	router.GET("/kernels", server.ListKernels)
+	router.POST("/kernels/:id/interrupt", server.InterruptKernel)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/sessions", "alice-key", `{}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("POST /sessions = %d %s", w.Code, w.Body.String())
+	}
+	var created client.Session
+	json.Unmarshal(w.Body.Bytes(), &created)
+	path := "/sessions/" + created.ID
+
+	// Another key can't see, use or close it
+	for _, tt := range []struct{ method, path, body string }{
+		{http.MethodGet, path, ""},
+		{http.MethodPost, path + "/eval", `{"code": "x = 1"}`},
+		{http.MethodPost, "/kernels/" + created.ID + "/interrupt", ""},
+		{http.MethodDelete, path, ""},
+	} {
+		if w := do(tt.method, tt.path, "bob-key", tt.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s with another key = %d, want %d", tt.method, tt.path, w.Code, http.StatusNotFound)
+		}
+	}
+	if w := do(http.MethodGet, "/kernels", "bob-key", ""); w.Body.String() != "[]" {
+		t.Errorf("GET /kernels with another key = %s, want none", w.Body.String())
+	}
+	if len(fake.evals) != 0 || len(fake.interrupted) != 0 || len(fake.closed) != 0 {
+		t.Errorf("session used by another key: evals %v, interrupted %v, closed %v", fake.evals, fake.interrupted, fake.closed)
+	}
+
+	// Its owner and admin keys can
+	if w := do(http.MethodPost, path+"/eval", "alice-key", `{"code": "x = 1"}`); w.Code != http.StatusOK {
+		t.Errorf("eval by its owner = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, path, "admin-key", ""); w.Code != http.StatusOK {
+		t.Errorf("GET by an admin key = %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, path, "admin-key", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE by an admin key = %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// PauseExecution suspends a running execution
+// @Summary Pause an execution
+// @Description Freeze a running execution's container (docker pause). Its
+// @Description timeout stands still until it is resumed. The execution
+// @Description stays running, with paused_at set.
+// @Tags execution
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Success 200 {object} client.ExecutionResult "Execution, now paused"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not running, or already paused"
+// @Failure 500 {object} gin.H "Pausing the container failed"
+// @Failure 501 {object} gin.H "Pausing is not supported by this executor"
+// @Router /executions/{id}/pause [post]
+func (s *Server) PauseExecution(c *gin.Context) {
+	exec, suspender, ok := s.suspendable(c)
+	if !ok {
+		return
+	}
+	if exec.PausedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "execution is already paused"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := suspender.Pause(ctx, exec.ContainerID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	pausedAt := time.Now()
+	exec.PausedAt = &pausedAt
+	s.storage.Update(ctx, exec)
+	c.JSON(http.StatusOK, exec.ToExecutionResult())
+}
+
+// CheckpointExecution saves a running execution to disk and stops it
+// @Summary Checkpoint an execution
+// @Description Save a running execution's container to disk with CRIU
+// @Description (docker checkpoint) and stop it, e.g. for a maintenance
+// @Description window. It is suspended like a paused execution until
+// @Description resumed, which restores it where it stopped, and is
+// @Description recovered as such after a server restart. Needs
+// @Description PYEXEC_CHECKPOINTS, a Docker daemon with experimental
+// @Description features enabled and CRIU on the host.
+// @Tags execution
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Success 200 {object} client.ExecutionResult "Execution, now suspended"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not running, or is paused"
+// @Failure 500 {object} gin.H "Checkpointing the container failed"
+// @Failure 501 {object} gin.H "Checkpoints are not enabled"
+// @Router /executions/{id}/checkpoint [post]
+func (s *Server) CheckpointExecution(c *gin.Context) {
+	if s.config == nil || !s.config.Docker.Checkpoints {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "checkpoints are not enabled on this server"})
+		return
+	}
+	exec, suspender, ok := s.suspendable(c)
+	if !ok {
+		return
+	}
+	if exec.PausedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "execution is paused; resume it before checkpointing"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	checkpointedAt := time.Now()
+	name := fmt.Sprintf("pyexec-%d", checkpointedAt.Unix())
+	if err := suspender.Checkpoint(ctx, exec.ContainerID, name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	exec.PausedAt = &checkpointedAt
+	exec.Checkpoint = name
+	exec.CheckpointedAt = &checkpointedAt
+	s.storage.Update(ctx, exec)
+	c.JSON(http.StatusOK, exec.ToExecutionResult())
+}
+
+// ResumeExecution resumes a paused or checkpointed execution
+// @Summary Resume an execution
+// @Description Continue a paused execution, or restore a checkpointed one
+// @Description from its checkpoint. Its timeout starts again with what was
+// @Description left of it.
+// @Tags execution
+// @Produce json
+// @Param id path string true "Execution ID"
+// @Success 200 {object} client.ExecutionResult "Execution, running again"
+// @Failure 404 {object} gin.H "Execution not found"
+// @Failure 409 {object} gin.H "Execution is not paused"
+// @Failure 500 {object} gin.H "Resuming the container failed"
+// @Failure 501 {object} gin.H "Pausing is not supported by this executor"
+// @Router /executions/{id}/resume [post]
+func (s *Server) ResumeExecution(c *gin.Context) {
+	exec, suspender, ok := s.suspendable(c)
+	if !ok {
+		return
+	}
+	if exec.PausedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "execution is not paused"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := suspender.Resume(ctx, exec.ContainerID, exec.Checkpoint); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	exec.PausedMs += time.Since(*exec.PausedAt).Milliseconds()
+	exec.PausedAt = nil
+	exec.Checkpoint = ""
+	s.storage.Update(ctx, exec)
+	c.JSON(http.StatusOK, exec.ToExecutionResult())
+}
+
+// suspendable returns the running execution a request names and the
+// executor to suspend it with, or writes the error response
+func (s *Server) suspendable(c *gin.Context) (*storage.Execution, executor.Suspender, bool) {
+	suspender, ok := s.executor.(executor.Suspender)
+	if !ok {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "pausing executions is not supported by this executor"})
+		return nil, nil, false
+	}
+
+	exec, err := s.storage.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		s.executionLookupFailed(c, err)
+		return nil, nil, false
+	}
+	if exec.Status != client.StatusRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("execution is %s, not running", exec.Status)})
+		return nil, nil, false
+	}
+	if exec.ContainerID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "execution has no container yet"})
+		return nil, nil, false
+	}
+	return exec, suspender, true
+}
+
+// keepSuspensions copies the suspensions the pause and resume handlers
+// recorded in storage to exec, whose copy the execution's goroutine kept.
+// A suspension still going on ends with the execution.
+func (s *Server) keepSuspensions(ctx context.Context, exec *storage.Execution) {
+	current, err := s.storage.Get(ctx, exec.ID)
+	if err != nil {
+		return
+	}
+	exec.PausedMs = current.PausedMs
+	exec.CheckpointedAt = current.CheckpointedAt
+	if current.PausedAt != nil {
+		exec.PausedMs += time.Since(*current.PausedAt).Milliseconds()
+	}
+	exec.PausedAt = nil
+	exec.Checkpoint = ""
+}
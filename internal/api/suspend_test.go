@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// suspendingExecutor is a fakeExecutor that records suspensions
+type suspendingExecutor struct {
+	fakeExecutor
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (e *suspendingExecutor) record(call string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, call)
+	return nil
+}
+
+func (e *suspendingExecutor) Pause(ctx context.Context, containerID string) error {
+	return e.record("pause " + containerID)
+}
+
+func (e *suspendingExecutor) Checkpoint(ctx context.Context, containerID, name string) error {
+	return e.record("checkpoint " + containerID)
+}
+
+func (e *suspendingExecutor) Resume(ctx context.Context, containerID, name string) error {
+	return e.record("resume " + containerID + " " + name)
+}
+
+func TestSuspendExecution(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &suspendingExecutor{}
+	store := storage.NewMemoryStorage()
+	cfg := &config.Config{}
+	server := NewServer(store, queue.NewMemoryQueue(), fake, cfg)
+	router := gin.New()
+	router.POST("/executions/:id/pause", server.PauseExecution)
+	router.POST("/executions/:id/resume", server.ResumeExecution)
+	router.POST("/executions/:id/checkpoint", server.CheckpointExecution)
+	ctx := context.Background()
+
+	started := time.Now()
+	store.Create(ctx, &storage.Execution{ID: "exe_running", Status: client.StatusRunning, ContainerID: "c1", StartedAt: &started})
+	store.Create(ctx, &storage.Execution{ID: "exe_pending", Status: client.StatusPending})
+
+	post := func(path string, want int) *client.ExecutionResult {
+		t.Helper()
+		w := sendJSON(router, http.MethodPost, path, "")
+		if w.Code != want {
+			t.Fatalf("POST %s = %d %s, want %d", path, w.Code, w.Body.String(), want)
+		}
+		var result client.ExecutionResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return &result
+	}
+
+	// Pausing stops the container; the execution stays running
+	result := post("/executions/exe_running/pause", http.StatusOK)
+	if result.Status != client.StatusRunning || result.PausedAt == nil {
+		t.Errorf("paused result = %+v", result)
+	}
+	post("/executions/exe_running/pause", http.StatusConflict)
+	post("/executions/exe_pending/pause", http.StatusConflict)
+	post("/executions/exe_missing/pause", http.StatusNotFound)
+
+	// Resuming counts the time spent paused
+	exec, _ := store.Get(ctx, "exe_running")
+	pausedAt := time.Now().Add(-2 * time.Second)
+	exec.PausedAt = &pausedAt
+	store.Update(ctx, exec)
+	result = post("/executions/exe_running/resume", http.StatusOK)
+	if result.PausedAt != nil || result.PausedMs < 2000 {
+		t.Errorf("resumed result = %+v", result)
+	}
+	post("/executions/exe_running/resume", http.StatusConflict)
+
+	// Checkpoints need enabling, and are restored from on resume
+	post("/executions/exe_running/checkpoint", http.StatusNotImplemented)
+	cfg.Docker.Checkpoints = true
+	result = post("/executions/exe_running/checkpoint", http.StatusOK)
+	if result.PausedAt == nil || result.CheckpointedAt == nil {
+		t.Errorf("checkpointed result = %+v", result)
+	}
+	post("/executions/exe_running/checkpoint", http.StatusConflict)
+	exec, _ = store.Get(ctx, "exe_running")
+	post("/executions/exe_running/resume", http.StatusOK)
+	if want := "resume c1 " + exec.Checkpoint; exec.Checkpoint == "" || fake.calls[len(fake.calls)-1] != want {
+		t.Errorf("calls = %v, want the checkpoint restored", fake.calls)
+	}
+
+	// The execution's own copy picks the suspensions up when it finishes,
+	// ending one still going on
+	post("/executions/exe_running/pause", http.StatusOK)
+	stale := &storage.Execution{ID: "exe_running", Status: client.StatusCompleted}
+	server.finishExecution(ctx, stale)
+	exec, _ = store.Get(ctx, "exe_running")
+	if exec.PausedAt != nil || exec.PausedMs < 2000 || exec.CheckpointedAt == nil {
+		t.Errorf("finished execution = %+v, want its suspensions", exec)
+	}
+}
+
+func TestSuspendUnsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+	router := gin.New()
+	router.POST("/executions/:id/pause", server.PauseExecution)
+
+	store.Create(context.Background(), &storage.Execution{ID: "exe_running", Status: client.StatusRunning, ContainerID: "c1"})
+	if w := sendJSON(router, http.MethodPost, "/executions/exe_running/pause", ""); w.Code != http.StatusNotImplemented {
+		t.Errorf("pause = %d, want %d", w.Code, http.StatusNotImplemented)
+	}
+}
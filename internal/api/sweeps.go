@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxSweepSize bounds the executions one sweep may create
+const maxSweepSize = 256
+
+// envNamePattern matches the environment variable names a sweep may set
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sweepCombinations expands a sweep into its parameter sets: every
+// combination of env values, in order of the sorted variable names with the
+// last varying fastest, each run with every args list in turn.
+func sweepCombinations(sweep *client.Sweep) ([]client.SweepExecution, error) {
+	if len(sweep.Env) == 0 && len(sweep.Args) == 0 {
+		return nil, errors.New("sweep has no env or args")
+	}
+
+	names := make([]string, 0, len(sweep.Env))
+	size := 1
+	for name, values := range sweep.Env {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("env %s has no values", name)
+		}
+		names = append(names, name)
+		size *= len(values)
+		if size > maxSweepSize {
+			return nil, fmt.Errorf("sweep has more than %d combinations", maxSweepSize)
+		}
+	}
+	sort.Strings(names)
+	if len(sweep.Args) > 0 {
+		size *= len(sweep.Args)
+		if size > maxSweepSize {
+			return nil, fmt.Errorf("sweep has more than %d combinations", maxSweepSize)
+		}
+	}
+
+	argSets := sweep.Args
+	if len(argSets) == 0 {
+		argSets = [][]string{nil}
+	}
+
+	combos := make([]client.SweepExecution, 0, size)
+	index := make([]int, len(names))
+	for {
+		var env map[string]string
+		if len(names) > 0 {
+			env = make(map[string]string, len(names))
+			for i, name := range names {
+				env[name] = sweep.Env[name][index[i]]
+			}
+		}
+		for _, args := range argSets {
+			combos = append(combos, client.SweepExecution{Env: env, Args: args})
+		}
+
+		// Advance the last variable, carrying into the ones before it
+		i := len(names) - 1
+		for ; i >= 0; i-- {
+			index[i]++
+			if index[i] < len(sweep.Env[names[i]]) {
+				break
+			}
+			index[i] = 0
+		}
+		if i < 0 {
+			return combos, nil
+		}
+	}
+}
+
+// sweepMetadata returns the metadata of one combination of a sweep
+func sweepMetadata(base *client.Metadata, combo client.SweepExecution, groupID string) *client.Metadata {
+	meta := *base
+	meta.GroupID = groupID
+
+	meta.EnvVars = nil
+	for _, kv := range base.EnvVars {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, swept := combo.Env[name]; !swept {
+			meta.EnvVars = append(meta.EnvVars, kv)
+		}
+	}
+	names := make([]string, 0, len(combo.Env))
+	for name := range combo.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		meta.EnvVars = append(meta.EnvVars, name+"="+combo.Env[name])
+	}
+
+	if len(combo.Args) > 0 {
+		meta.ScriptArgs = append(append([]string{}, base.ScriptArgs...), combo.Args...)
+	}
+	return &meta
+}
+
+// CreateSweep runs one archive once per combination of a parameter matrix
+// @Summary Submit a parameter sweep
+// @Description Queue one execution of the archive for every combination of
+// @Description the sweep's parameters and return at once. The executions share
+// @Description a group: the metadata's group_id, or one chosen by the server.
+// @Description Follow them with GET /groups/{id}. Executions matching one of
+// @Description the server's approval rules await an admin's approval.
+// @Tags execution
+// @Accept multipart/form-data
+// @Produce json
+// @Param tar formData file false "Tar archive containing Python files, optionally gzip-compressed. Omitted when the metadata has upload_id or archive_sha256"
+// @Param metadata formData string true "Execution metadata as JSON: {\"entrypoint\":\"main.py\"}"
+// @Param sweep formData string true "Parameter matrix as JSON: {\"env\":{\"LR\":[\"0.1\",\"0.01\"]},\"args\":[[\"--seed\",\"1\"],[\"--seed\",\"2\"]]}"
+// @Param X-Tenant header string false "Tenant the executions are accounted to on servers without API keys (default \"default\")"
+// @Success 202 {object} client.SweepResponse "Executions submitted"
+// @Failure 400 {object} gin.H "Invalid request or sweep"
+// @Failure 404 {object} gin.H "archive_sha256 is not cached; send the tar part instead"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
+// @Failure 500 {object} gin.H "Failed to create or queue an execution"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /sweeps [post]
+func (s *Server) CreateSweep(c *gin.Context) {
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
+	ctx := c.Request.Context()
+
+	tarData, metadata, err := s.parseRequest(c)
+	if err != nil {
+		c.JSON(requestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if form := c.Request.MultipartForm; form != nil && len(form.File["stdin"]) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a stdin part is only supported by /exec/sync; use metadata.stdin for sweeps"})
+		return
+	}
+
+	sweepStr := c.Request.FormValue("sweep")
+	if sweepStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing sweep"})
+		return
+	}
+	var sweep client.Sweep
+	if err := json.Unmarshal([]byte(sweepStr), &sweep); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("parsing sweep: %v", err)})
+		return
+	}
+	combos, err := sweepCombinations(&sweep)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.limitConcurrency(c, len(combos)) {
+		return
+	}
+	if err := s.admitAsync(ctx, len(combos)); err != nil {
+		s.rejectOverloaded(c, err)
+		return
+	}
+
+	detected, err := s.detectArchiveRequirements(ctx, tarData, metadata)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	groupID := metadata.GroupID
+	if groupID == "" {
+		groupID = fmt.Sprintf("swp_%s", uuid.New().String())
+	}
+
+	// Executions queued before a failure keep running; the error names the
+	// group so the caller can follow or kill them
+	for i := range combos {
+		meta := sweepMetadata(metadata, combos[i], groupID)
+		exec := &storage.Execution{
+			ID:         fmt.Sprintf("exe_%s", uuid.New().String()),
+			Status:     client.StatusPending,
+			Metadata:   meta,
+			Detected:   detected,
+			Tenant:     tenantOf(c),
+			APIKeyName: apiKeyOf(c),
+			Caller:     callerOf(c),
+			TraceID:    traceIDOf(c),
+			Node:       s.nodeID(),
+			CreatedAt:  time.Now(),
+		}
+		exec.ApprovalReason = s.approvalReason(meta, exec.Tenant)
+		if exec.ApprovalReason != "" {
+			exec.Status = client.StatusAwaitingApproval
+		}
+		if err := s.storage.Create(ctx, exec); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create execution", "group_id": groupID})
+			return
+		}
+		s.publishEvent(client.EventSubmitted, exec)
+
+		job := &queue.Job{ExecutionID: exec.ID, TarData: tarData, Metadata: meta}
+		submit := s.queue.Enqueue
+		if exec.Status == client.StatusAwaitingApproval {
+			submit = s.queue.Hold
+		}
+		if err := submit(ctx, job); err != nil {
+			s.failExecution(ctx, exec, fmt.Sprintf("queueing execution: %v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue execution", "group_id": groupID})
+			return
+		}
+		combos[i].ExecutionID = exec.ID
+	}
+
+	c.JSON(http.StatusAccepted, client.SweepResponse{
+		GroupID:    groupID,
+		Executions: combos,
+	})
+}
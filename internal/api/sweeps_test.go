@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSweepCombinations(t *testing.T) {
+	combos, err := sweepCombinations(&client.Sweep{
+		Env:  map[string][]string{"LR": {"0.1", "0.01"}, "BATCH": {"32", "64"}},
+		Args: [][]string{{"--seed", "1"}, {"--seed", "2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(combos) != 8 {
+		t.Fatalf("got %d combinations, want 8", len(combos))
+	}
+	// Sorted names, the last varying fastest, then each args list in turn
+	want := []client.SweepExecution{
+		{Env: map[string]string{"BATCH": "32", "LR": "0.1"}, Args: []string{"--seed", "1"}},
+		{Env: map[string]string{"BATCH": "32", "LR": "0.1"}, Args: []string{"--seed", "2"}},
+		{Env: map[string]string{"BATCH": "32", "LR": "0.01"}, Args: []string{"--seed", "1"}},
+	}
+	if !reflect.DeepEqual(combos[:3], want) {
+		t.Errorf("first combinations = %+v, want %+v", combos[:3], want)
+	}
+	if last := combos[7]; last.Env["BATCH"] != "64" || last.Env["LR"] != "0.01" || last.Args[1] != "2" {
+		t.Errorf("last combination = %+v", last)
+	}
+
+	combos, err = sweepCombinations(&client.Sweep{Args: [][]string{{"a"}, {"b"}, {"c"}}})
+	if err != nil || len(combos) != 3 || combos[2].Env != nil || combos[2].Args[0] != "c" {
+		t.Errorf("args-only sweep = %+v, %v", combos, err)
+	}
+
+	for _, sweep := range []client.Sweep{
+		{},
+		{Env: map[string][]string{"1BAD": {"x"}}},
+		{Env: map[string][]string{"EMPTY": {}}},
+		{Env: map[string][]string{"A": make([]string, 20), "B": make([]string, 20)}},
+	} {
+		if _, err := sweepCombinations(&sweep); err == nil {
+			t.Errorf("sweepCombinations(%+v) = nil error", sweep)
+		}
+	}
+}
+
+func TestSweepMetadata(t *testing.T) {
+	base := &client.Metadata{
+		Entrypoint: "train.py",
+		EnvVars:    []string{"LR=1", "MODE=fast"},
+		ScriptArgs: []string{"--epochs", "3"},
+	}
+	meta := sweepMetadata(base, client.SweepExecution{
+		Env:  map[string]string{"LR": "0.1"},
+		Args: []string{"--seed", "7"},
+	}, "grid")
+
+	if want := []string{"MODE=fast", "LR=0.1"}; !reflect.DeepEqual(meta.EnvVars, want) {
+		t.Errorf("EnvVars = %v, want %v", meta.EnvVars, want)
+	}
+	if want := []string{"--epochs", "3", "--seed", "7"}; !reflect.DeepEqual(meta.ScriptArgs, want) {
+		t.Errorf("ScriptArgs = %v, want %v", meta.ScriptArgs, want)
+	}
+	if meta.GroupID != "grid" {
+		t.Errorf("GroupID = %q, want grid", meta.GroupID)
+	}
+	// The base metadata is shared by every combination
+	if len(base.EnvVars) != 2 || base.EnvVars[0] != "LR=1" || len(base.ScriptArgs) != 2 || base.GroupID != "" {
+		t.Errorf("base metadata changed: %+v", base)
+	}
+}
+
+// sweepRequest builds a sweep request with a tar, metadata and sweep part
+func sweepRequest(t *testing.T, metadata, sweep string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(1)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, _ := w.CreateFormFile("tar", "code.tar")
+	part.Write(tarData)
+	w.WriteField("metadata", metadata)
+	if sweep != "" {
+		w.WriteField("sweep", sweep)
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/sweeps", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestCreateSweep(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMemoryStorage()
+	q := queue.NewMemoryQueue()
+	server := NewServer(store, q, &fakeExecutor{}, &config.Config{})
+	router := gin.New()
+	router.POST("/sweeps", server.CreateSweep)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, sweepRequest(t, `{"entrypoint":"main.py"}`, `{"env":{"LR":["0.1","0.01"]},"args":[["--seed","1"],["--seed","2"]]}`))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("POST sweep = %d %s", w.Code, w.Body.String())
+	}
+	var resp client.SweepResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if !strings.HasPrefix(resp.GroupID, "swp_") || len(resp.Executions) != 4 {
+		t.Fatalf("response = %+v", resp)
+	}
+
+	ctx := context.Background()
+	for _, want := range resp.Executions {
+		exec, err := store.Get(ctx, want.ExecutionID)
+		if err != nil {
+			t.Fatalf("execution %s not stored: %v", want.ExecutionID, err)
+		}
+		if exec.Status != client.StatusPending || exec.Metadata.GroupID != resp.GroupID {
+			t.Errorf("execution = %+v", exec)
+		}
+		if exec.Metadata.EnvVars[0] != "LR="+want.Env["LR"] || !reflect.DeepEqual(exec.Metadata.ScriptArgs, want.Args) {
+			t.Errorf("metadata = %+v, want %+v", exec.Metadata, want)
+		}
+
+		job, err := q.Claim(ctx)
+		if err != nil || job.ExecutionID != want.ExecutionID || len(job.TarData) == 0 {
+			t.Errorf("claimed %+v, %v; want %s", job, err, want.ExecutionID)
+		}
+	}
+
+	// A caller-chosen group ID is kept
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, sweepRequest(t, `{"entrypoint":"main.py","group_id":"grid-1"}`, `{"args":[["a"]]}`))
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusAccepted || resp.GroupID != "grid-1" {
+		t.Errorf("POST sweep with group_id = %d %s", w.Code, w.Body.String())
+	}
+
+	for _, sweep := range []string{"", "not json", `{}`} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, sweepRequest(t, `{"entrypoint":"main.py"}`, sweep))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("sweep %q: status = %d, want 400", sweep, w.Code)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// templateNamePattern matches the names templates may have
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// paramNamePattern matches the names template parameters may have
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// placeholderPattern matches a {{name}} placeholder in a template
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// templateRequest returns a copy of a template's request that can be
+// changed without changing the template
+func templateRequest(t *client.Template) client.SimpleExecRequest {
+	req := t.SimpleExecRequest
+	if t.Files != nil {
+		req.Files = append([]client.CodeFile(nil), t.Files...)
+	}
+	if t.Config != nil {
+		cfg := *t.Config
+		req.Config = &cfg
+	}
+	return req
+}
+
+// renderTemplate returns the request a run of a template makes, with each
+// {{name}} of one of its parameters replaced by the parameter's value.
+// Placeholders naming no parameter are left as they are.
+func renderTemplate(t *client.Template, params map[string]string) (*client.SimpleExecRequest, error) {
+	values := make(map[string]string, len(t.Params))
+	for _, p := range t.Params {
+		v, ok := params[p.Name]
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("missing required parameter %q", p.Name)
+			}
+			v = p.Default
+		}
+		values[p.Name] = v
+	}
+	for name := range params {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("template %s has no parameter %q", t.Name, name)
+		}
+	}
+
+	replace := func(text string) string {
+		return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+			if v, ok := values[placeholderPattern.FindStringSubmatch(placeholder)[1]]; ok {
+				return v
+			}
+			return placeholder
+		})
+	}
+
+	req := templateRequest(t)
+	req.Code = replace(req.Code)
+	req.Stdin = replace(req.Stdin)
+	for i, f := range req.Files {
+		if f.Encoding != client.EncodingBase64 {
+			req.Files[i].Content = replace(f.Content)
+		}
+	}
+	return &req, nil
+}
+
+// validateTemplate checks a template's name and parameters
+func validateTemplate(t *client.Template) error {
+	if !templateNamePattern.MatchString(t.Name) {
+		return fmt.Errorf("invalid template name %q: use up to 64 letters, digits, '.', '_' and '-'", t.Name)
+	}
+	seen := make(map[string]bool, len(t.Params))
+	for _, p := range t.Params {
+		if !paramNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	return nil
+}
+
+// lookupTemplate fetches the template a request names, writing the error
+// response if it can't
+func (s *Server) lookupTemplate(c *gin.Context) (*client.Template, bool) {
+	t, err := s.storage.GetTemplate(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, storage.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read template"})
+		return nil, false
+	}
+	return t, true
+}
+
+// renderRequest renders the template a request names with the parameters
+// it gives, writing the error response if it can't
+func (s *Server) renderRequest(c *gin.Context) (*client.TemplateRunRequest, *client.SimpleExecRequest, bool) {
+	t, ok := s.lookupTemplate(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// An empty body runs the template with its defaults
+	var run client.TemplateRunRequest
+	if err := c.ShouldBindJSON(&run); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return nil, nil, false
+	}
+
+	req, err := renderTemplate(t, run.Params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+	if run.GroupID != "" {
+		req.GroupID = run.GroupID
+	}
+	return &run, req, true
+}
+
+// PutTemplate stores a template
+// @Summary Create or replace a template
+// @Description Store a script under a name, to be run by name with
+// @Description parameters. Each {{name}} of a parameter in the code, text
+// @Description files and stdin is replaced with the parameter's value.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param name path string true "Template name"
+// @Param template body client.Template true "Template: the fields of an /eval request, with a description and parameters"
+// @Success 200 {object} client.Template "Template stored"
+// @Failure 400 {object} gin.H "Invalid template"
+// @Failure 413 {object} gin.H "Code size exceeds limit"
+// @Failure 500 {object} gin.H "Failed to store template"
+// @Router /templates/{name} [put]
+func (s *Server) PutTemplate(c *gin.Context) {
+	var t client.Template
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid JSON: %v", err)})
+		return
+	}
+	name := c.Param("name")
+	if t.Name != "" && t.Name != name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("template name %q doesn't match the path", t.Name)})
+		return
+	}
+	t.Name = name
+	if err := validateTemplate(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the request it makes, placeholders and all, as /eval would
+	req := templateRequest(&t)
+	if _, _, _, err := s.prepareEval(c.Request.Context(), &req); err != nil {
+		c.JSON(evalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	t.UpdatedAt = time.Now().UTC()
+	if err := s.storage.PutTemplate(c.Request.Context(), &t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store template"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+// ListTemplates lists the stored templates
+// @Summary List templates
+// @Description List the stored templates by name, with their descriptions
+// @Description and parameters but without their code, files or stdin.
+// @Tags templates
+// @Produce json
+// @Success 200 {object} client.TemplateList "Templates"
+// @Failure 500 {object} gin.H "Failed to list templates"
+// @Router /templates [get]
+func (s *Server) ListTemplates(c *gin.Context) {
+	templates, err := s.storage.ListTemplates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list templates"})
+		return
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	list := client.TemplateList{Templates: make([]client.Template, 0, len(templates))}
+	for _, t := range templates {
+		t.Code = ""
+		t.Files = nil
+		t.Stdin = ""
+		list.Templates = append(list.Templates, *t)
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetTemplate returns a template
+// @Summary Get a template
+// @Tags templates
+// @Produce json
+// @Param name path string true "Template name"
+// @Success 200 {object} client.Template "Template"
+// @Failure 404 {object} gin.H "Template not found"
+// @Router /templates/{name} [get]
+func (s *Server) GetTemplate(c *gin.Context) {
+	if t, ok := s.lookupTemplate(c); ok {
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// DeleteTemplate removes a template
+// @Summary Delete a template
+// @Tags templates
+// @Param name path string true "Template name"
+// @Success 204 "Template deleted"
+// @Failure 404 {object} gin.H "Template not found"
+// @Failure 500 {object} gin.H "Failed to delete template"
+// @Router /templates/{name} [delete]
+func (s *Server) DeleteTemplate(c *gin.Context) {
+	err := s.storage.DeleteTemplate(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, storage.ErrTemplateNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete template"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RenderTemplate shows what a run of a template would execute
+// @Summary Render a template
+// @Description Return the /eval request a run of the template with these
+// @Description parameters would make, without running it.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param name path string true "Template name"
+// @Param request body client.TemplateRunRequest false "Parameter values"
+// @Success 200 {object} client.SimpleExecRequest "Rendered request"
+// @Failure 400 {object} gin.H "Missing or unknown parameter"
+// @Failure 404 {object} gin.H "Template not found"
+// @Router /templates/{name}/render [post]
+func (s *Server) RenderTemplate(c *gin.Context) {
+	if _, req, ok := s.renderRequest(c); ok {
+		c.JSON(http.StatusOK, req)
+	}
+}
+
+// RunTemplate runs a template with parameters
+// @Summary Run a template
+// @Description Render the template with the parameters and run it as /eval
+// @Description would, waiting for the result, or queue it as /exec/async
+// @Description would if async is set.
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Param name path string true "Template name"
+// @Param request body client.TemplateRunRequest false "Parameter values and options"
+// @Param X-Tenant header string false "Tenant the execution is accounted to on servers without API keys (default \"default\")"
+// @Success 200 {object} client.ExecutionResult "Execution completed"
+// @Success 202 {object} client.AsyncResponse "Execution queued or held for approval, or still running after the server's detach threshold"
+// @Failure 400 {object} gin.H "Missing or unknown parameter, or invalid request"
+// @Failure 404 {object} gin.H "Template not found"
+// @Failure 429 {object} gin.H "The tenant has used up its usage budget, or the server is at capacity"
+// @Failure 500 {object} gin.H "Execution failed"
+// @Failure 503 {object} gin.H "Server is shutting down"
+// @Router /templates/{name}/run [post]
+func (s *Server) RunTemplate(c *gin.Context) {
+	run, req, ok := s.renderRequest(c)
+	if !ok {
+		return
+	}
+	if !run.Async {
+		s.evalSync(c, req)
+		return
+	}
+
+	if !s.acquire() {
+		rejectDraining(c)
+		return
+	}
+	defer s.release()
+
+	tarData, metadata, detected, err := s.prepareEval(c.Request.Context(), req)
+	if err != nil {
+		c.JSON(evalErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.submitAsync(c, tarData, metadata, detected)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	tmpl := &client.Template{
+		Name: "report",
+		Params: []client.TemplateParam{
+			{Name: "region", Required: true},
+			{Name: "days", Default: "7"},
+		},
+		SimpleExecRequest: client.SimpleExecRequest{
+			Files: []client.CodeFile{
+				{Name: "main.py", Content: "print('{{region}}', {{ days }}, '{{other}}')"},
+				{Name: "data.bin", Content: "e3tyZWdpb259fQ==", Encoding: client.EncodingBase64},
+			},
+			Stdin:  "{{region}}\n",
+			Config: &client.ExecutionConfig{MemoryMB: 256},
+		},
+	}
+
+	req, err := renderTemplate(tmpl, map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Files[0].Content != "print('eu', 7, '{{other}}')" || req.Stdin != "eu\n" {
+		t.Errorf("rendered = %+v", req)
+	}
+	if req.Files[1].Content != "e3tyZWdpb259fQ==" {
+		t.Errorf("base64 file rendered: %q", req.Files[1].Content)
+	}
+
+	// Rendering leaves the template as it was
+	req.Config.MemoryMB = 1
+	if tmpl.Files[0].Content != "print('{{region}}', {{ days }}, '{{other}}')" || tmpl.Config.MemoryMB != 256 {
+		t.Errorf("template changed: %+v", tmpl)
+	}
+
+	for _, params := range []map[string]string{
+		nil,
+		{"region": "eu", "colour": "red"},
+	} {
+		if _, err := renderTemplate(tmpl, params); err == nil {
+			t.Errorf("renderTemplate(%v) = nil error", params)
+		}
+	}
+}
+
+// sendJSON sends a JSON request to a router
+func sendJSON(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTemplates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	store := storage.NewMemoryStorage()
+	q := queue.NewMemoryQueue()
+	server := NewServer(store, q, fake, &config.Config{})
+	router := gin.New()
+	router.GET("/templates", server.ListTemplates)
+	router.GET("/templates/:name", server.GetTemplate)
+	router.PUT("/templates/:name", server.PutTemplate)
+	router.DELETE("/templates/:name", server.DeleteTemplate)
+	router.POST("/templates/:name/render", server.RenderTemplate)
+	router.POST("/templates/:name/run", server.AccountUsage, server.RunTemplate)
+
+	w := sendJSON(router, http.MethodPut, "/templates/greet", `{
+		"description": "Say hello",
+		"params": [{"name": "who", "required": true}],
+		"code": "print('hello {{who}}')"
+	}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT template = %d %s", w.Code, w.Body.String())
+	}
+	var stored client.Template
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	if stored.Name != "greet" || stored.UpdatedAt.IsZero() {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	for _, tc := range []struct{ path, body string }{
+		{"/templates/-bad", `{"code": "print(1)"}`},
+		{"/templates/greet", `{"name": "other", "code": "print(1)"}`},
+		{"/templates/greet", `{"params": [{"name": "x"}, {"name": "x"}], "code": "print(1)"}`},
+		{"/templates/greet", `{"params": [{"name": "1x"}], "code": "print(1)"}`},
+		{"/templates/greet", `{"description": "no code"}`},
+		{"/templates/greet", `{"code": "print(1)", "python_version": "2.7"}`},
+	} {
+		if w := sendJSON(router, http.MethodPut, tc.path, tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s %s = %d, want 400", tc.path, tc.body, w.Code)
+		}
+	}
+
+	w = sendJSON(router, http.MethodGet, "/templates", "")
+	var list client.TemplateList
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Templates) != 1 || list.Templates[0].Description != "Say hello" || list.Templates[0].Code != "" {
+		t.Errorf("list = %+v", list)
+	}
+	w = sendJSON(router, http.MethodGet, "/templates/greet", "")
+	json.Unmarshal(w.Body.Bytes(), &stored)
+	if w.Code != http.StatusOK || stored.Code != "print('hello {{who}}')" {
+		t.Errorf("GET template = %d %s", w.Code, w.Body.String())
+	}
+
+	w = sendJSON(router, http.MethodPost, "/templates/greet/render", `{"params": {"who": "world"}}`)
+	var rendered client.SimpleExecRequest
+	json.Unmarshal(w.Body.Bytes(), &rendered)
+	if w.Code != http.StatusOK || rendered.Code != "print('hello world')" {
+		t.Errorf("render = %d %s", w.Code, w.Body.String())
+	}
+	if w := sendJSON(router, http.MethodPost, "/templates/greet/render", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("render without a required parameter = %d, want 400", w.Code)
+	}
+
+	// Runs wait for the result, or are queued if async
+	w = sendJSON(router, http.MethodPost, "/templates/greet/run", `{"params": {"who": "world"}}`)
+	if w.Code != http.StatusOK || len(fake.requests) != 1 {
+		t.Fatalf("run = %d %s", w.Code, w.Body.String())
+	}
+	if !bytes.Contains(fake.requests[0].TarData, []byte("print('hello world')")) {
+		t.Error("executed archive lacks the rendered code")
+	}
+
+	w = sendJSON(router, http.MethodPost, "/templates/greet/run", `{"params": {"who": "async"}, "async": true, "group_id": "nightly"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("async run = %d %s", w.Code, w.Body.String())
+	}
+	var async client.AsyncResponse
+	json.Unmarshal(w.Body.Bytes(), &async)
+	ctx := context.Background()
+	job, err := q.Claim(ctx)
+	if err != nil || job.ExecutionID != async.ExecutionID || job.Metadata.GroupID != "nightly" {
+		t.Errorf("claimed %+v, %v; want %s", job, err, async.ExecutionID)
+	}
+
+	if w := sendJSON(router, http.MethodDelete, "/templates/greet", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d", w.Code)
+	}
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodGet, "/templates/greet"},
+		{http.MethodDelete, "/templates/greet"},
+		{http.MethodPost, "/templates/greet/run"},
+	} {
+		if w := sendJSON(router, tc.method, tc.path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s after delete = %d, want 404", tc.method, tc.path, w.Code)
+		}
+	}
+}
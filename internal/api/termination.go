@@ -0,0 +1,28 @@
+package api
+
+// signalNames maps the signals a script is commonly terminated by to their
+// names
+var signalNames = map[int]string{
+	1:  "SIGHUP",
+	2:  "SIGINT",
+	3:  "SIGQUIT",
+	4:  "SIGILL",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	9:  "SIGKILL",
+	11: "SIGSEGV",
+	13: "SIGPIPE",
+	14: "SIGALRM",
+	15: "SIGTERM",
+}
+
+// signalName returns the signal a container's exit code reports. The shell
+// running the script exits with 128+n when the script dies from signal n.
+// Returns "" for ordinary exit codes.
+func signalName(exitCode int) string {
+	if exitCode <= 128 {
+		return ""
+	}
+	return signalNames[exitCode-128]
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestSignalName(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		want     string
+	}{
+		{0, ""},
+		{1, ""},
+		{128, ""},
+		{130, "SIGINT"},
+		{137, "SIGKILL"},
+		{139, "SIGSEGV"},
+		{143, "SIGTERM"},
+		{200, ""},
+	}
+
+	for _, tt := range tests {
+		if got := signalName(tt.exitCode); got != tt.want {
+			t.Errorf("signalName(%d) = %q, want %q", tt.exitCode, got, tt.want)
+		}
+	}
+}
+
+func TestRecordResult_Termination(t *testing.T) {
+	server := &Server{}
+
+	t.Run("timeout", func(t *testing.T) {
+		exec := &storage.Execution{ID: "exe_1", Status: client.StatusRunning}
+		server.recordResult(exec, nil, fmt.Errorf("%w after 5s", executor.ErrTimeout))
+
+		result := exec.ToExecutionResult()
+		if result.Signal != "SIGKILL" || result.TerminationReason != client.TerminationTimeout {
+			t.Errorf("termination = %q (%q), want SIGKILL (timeout)", result.Signal, result.TerminationReason)
+		}
+		if result.Error != "execution timeout after 5s" {
+			t.Errorf("error = %q", result.Error)
+		}
+	})
+
+	t.Run("out of memory", func(t *testing.T) {
+		exec := &storage.Execution{ID: "exe_2", Status: client.StatusRunning}
+		server.recordResult(exec, &executor.ExecutionOutput{ExitCode: 137, OOMKilled: true}, nil)
+
+		result := exec.ToExecutionResult()
+		if result.Signal != "SIGKILL" || result.TerminationReason != client.TerminationOOM {
+			t.Errorf("termination = %q (%q), want SIGKILL (oom)", result.Signal, result.TerminationReason)
+		}
+	})
+
+	t.Run("disk limit", func(t *testing.T) {
+		exec := &storage.Execution{ID: "exe_4", Status: client.StatusRunning}
+		server.recordResult(exec, &executor.ExecutionOutput{ExitCode: 137, DiskLimitExceeded: true}, nil)
+
+		result := exec.ToExecutionResult()
+		if result.Signal != "SIGKILL" || result.TerminationReason != client.TerminationDiskLimit {
+			t.Errorf("termination = %q (%q), want SIGKILL (disk_limit_exceeded)", result.Signal, result.TerminationReason)
+		}
+		if result.Error == "" {
+			t.Error("no error explaining the disk limit")
+		}
+		if kind := failureKind(exec, nil); kind != client.FailureDiskLimit {
+			t.Errorf("failureKind() = %q, want %q", kind, client.FailureDiskLimit)
+		}
+	})
+
+	t.Run("ordinary failure", func(t *testing.T) {
+		exec := &storage.Execution{ID: "exe_3", Status: client.StatusRunning}
+		server.recordResult(exec, &executor.ExecutionOutput{ExitCode: 1}, nil)
+
+		result := exec.ToExecutionResult()
+		if result.Signal != "" || result.TerminationReason != "" {
+			t.Errorf("termination = %q (%q), want none", result.Signal, result.TerminationReason)
+		}
+	})
+}
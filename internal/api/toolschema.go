@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultToolName is the function name a tool schema is served with
+const defaultToolName = "execute_python"
+
+// toolNamePattern matches the function names OpenAI accepts
+var toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// toolSchema describes /eval as a function named name, with this server's
+// Python versions and default timeout
+func (s *Server) toolSchema(name string) *client.Tool {
+	versions := make([]string, 0, len(pythonVersionImages))
+	for version := range pythonVersionImages {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	timeout := 300
+	if s.config != nil && s.config.Defaults.Timeout > 0 {
+		timeout = s.config.Defaults.Timeout
+	}
+
+	description := "Run Python code in an isolated sandbox and return its stdout, stderr and exit code. " +
+		"Each call starts a fresh interpreter, so variables and files do not carry over between calls. "
+	if s.config != nil && s.config.Defaults.AutoDetectImports {
+		description += "Third-party packages the code imports are installed automatically. "
+	}
+	description += "With eval_last_expr, the repr() of the code's last expression is returned in result."
+
+	return &client.Tool{
+		Type: "function",
+		Function: client.ToolFunction{
+			Name:        name,
+			Description: description,
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"code": map[string]any{
+						"type":        "string",
+						"description": "Python source to run as main.py.",
+					},
+					"eval_last_expr": map[string]any{
+						"type":        "boolean",
+						"description": "Return the repr() of the last expression, as a REPL would print it.",
+					},
+					"stdin": map[string]any{
+						"type":        "string",
+						"description": "Data to provide on standard input.",
+					},
+					"requirements_txt": map[string]any{
+						"type":        "string",
+						"description": "Packages to pip install, in requirements.txt format.",
+					},
+					"packages": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Packages to pip install, e.g. [\"numpy\", \"requests==2.31\"].",
+					},
+					"python_version": map[string]any{
+						"type":        "string",
+						"enum":        versions,
+						"description": "Python version to run.",
+					},
+					"config": map[string]any{
+						"type": "object",
+						"properties": map[string]any{
+							"timeout_seconds": map[string]any{
+								"type":        "integer",
+								"description": fmt.Sprintf("Maximum run time in seconds (default %d).", timeout),
+							},
+						},
+					},
+				},
+				"required": []string{"code"},
+			},
+		},
+	}
+}
+
+// GetToolSchema describes /eval for LLM function calling
+// @Summary Get the tool schema
+// @Description Describe the /eval endpoint as a tool in OpenAI's function
+// @Description calling format, so agent frameworks can register the executor
+// @Description without a hand-written schema. The arguments of a call are an
+// @Description /eval request body as they are.
+// @Tags execution
+// @Produce json
+// @Param name query string false "Function name (default execute_python): up to 64 letters, digits, '_' and '-'"
+// @Success 200 {object} client.Tool "Tool definition"
+// @Failure 400 {object} gin.H "Invalid name"
+// @Router /tool-schema [get]
+func (s *Server) GetToolSchema(c *gin.Context) {
+	name := c.DefaultQuery("name", defaultToolName)
+	if !toolNamePattern.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid name %q: use up to 64 letters, digits, '_' and '-'", name)})
+		return
+	}
+	c.JSON(http.StatusOK, s.toolSchema(name))
+}
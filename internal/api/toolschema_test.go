@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetToolSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Defaults: config.DefaultsConfig{Timeout: 60, AutoDetectImports: true}}
+	server := &Server{config: cfg}
+	router := gin.New()
+	router.GET("/tool-schema", server.GetToolSchema)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tool-schema", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET tool-schema = %d %s", w.Code, w.Body.String())
+	}
+
+	var tool client.Tool
+	if err := json.Unmarshal(w.Body.Bytes(), &tool); err != nil {
+		t.Fatal(err)
+	}
+	if tool.Type != "function" || tool.Function.Name != "execute_python" {
+		t.Errorf("tool = %+v", tool)
+	}
+	if !strings.Contains(tool.Function.Description, "installed automatically") {
+		t.Errorf("description = %q, want auto-install mentioned", tool.Function.Description)
+	}
+
+	params := tool.Function.Parameters
+	if !reflect.DeepEqual(params["required"], []any{"code"}) {
+		t.Errorf("required = %v", params["required"])
+	}
+	props := params["properties"].(map[string]any)
+	version := props["python_version"].(map[string]any)
+	if !reflect.DeepEqual(version["enum"], []any{"3.10", "3.11", "3.12", "3.13"}) {
+		t.Errorf("python_version enum = %v", version["enum"])
+	}
+	timeout := props["config"].(map[string]any)["properties"].(map[string]any)["timeout_seconds"].(map[string]any)
+	if !strings.Contains(timeout["description"].(string), "default 60") {
+		t.Errorf("timeout description = %q", timeout["description"])
+	}
+
+	// Every argument is a field of an /eval request
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(client.SimpleExecRequest{})
+	for i := 0; i < typ.NumField(); i++ {
+		fields[strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for name := range props {
+		if !fields[name] {
+			t.Errorf("argument %q is not an /eval field", name)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tool-schema?name=run_py", nil))
+	json.Unmarshal(w.Body.Bytes(), &tool)
+	if tool.Function.Name != "run_py" {
+		t.Errorf("name = %q, want run_py", tool.Function.Name)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tool-schema?name=bad+name", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid name: status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// tracebackHeader starts each traceback Python prints
+const tracebackHeader = "Traceback (most recent call last):"
+
+// tracebackFramePattern matches a frame line like
+// '  File "/work/main.py", line 3, in main'. Syntax errors omit the function.
+var tracebackFramePattern = regexp.MustCompile(`^\s*File "(.*)", line (\d+)(?:, in (.+))?$`)
+
+// tracebackMarkerPattern matches the ^ and ~ lines Python prints under code
+var tracebackMarkerPattern = regexp.MustCompile(`^[\s^~]+$`)
+
+// parseTraceback extracts the frames of the last traceback in stderr, which
+// is the exception that ended the script when exceptions were chained. Frames
+// from the eval wrapper are dropped so only user code remains.
+func parseTraceback(stderr string) []client.TracebackFrame {
+	if idx := strings.LastIndex(stderr, tracebackHeader); idx != -1 {
+		stderr = stderr[idx+len(tracebackHeader):]
+	}
+
+	var frames []client.TracebackFrame
+	lines := strings.Split(stderr, "\n")
+	for i := 0; i < len(lines); i++ {
+		matches := tracebackFramePattern.FindStringSubmatch(lines[i])
+		if matches == nil {
+			continue
+		}
+
+		line, err := strconv.Atoi(matches[2])
+		if err != nil {
+			continue
+		}
+		frame := client.TracebackFrame{
+			File:     matches[1],
+			Line:     line,
+			Function: matches[3],
+		}
+
+		// The source line, if any, follows the frame line
+		if i+1 < len(lines) {
+			next := lines[i+1]
+			if strings.TrimSpace(next) != "" && !tracebackFramePattern.MatchString(next) &&
+				!tracebackMarkerPattern.MatchString(next) && strings.HasPrefix(next, "    ") {
+				frame.Code = strings.TrimSpace(next)
+				i++
+			}
+		}
+
+		if path.Base(frame.File) == executor.EvalWrapperScript {
+			continue
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestParseTraceback(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   []client.TracebackFrame
+	}{
+		{
+			name: "runtime error",
+			stderr: `Traceback (most recent call last):
+  File "/work/main.py", line 5, in <module>
+    run()
+  File "/work/main.py", line 2, in run
+    return 1 / 0
+           ~~^~~
+ZeroDivisionError: division by zero
+`,
+			want: []client.TracebackFrame{
+				{File: "/work/main.py", Line: 5, Function: "<module>", Code: "run()"},
+				{File: "/work/main.py", Line: 2, Function: "run", Code: "return 1 / 0"},
+			},
+		},
+		{
+			name: "syntax error",
+			stderr: `  File "/work/main.py", line 1
+    x = (
+        ^
+SyntaxError: '(' was never closed
+`,
+			want: []client.TracebackFrame{
+				{File: "/work/main.py", Line: 1, Code: "x = ("},
+			},
+		},
+		{
+			name: "chained exceptions keep the last traceback",
+			stderr: `Traceback (most recent call last):
+  File "/work/main.py", line 2, in <module>
+    int("x")
+ValueError: invalid literal for int() with base 10: 'x'
+
+During handling of the above exception, another exception occurred:
+
+Traceback (most recent call last):
+  File "/work/main.py", line 4, in <module>
+    raise RuntimeError("bad input")
+RuntimeError: bad input
+`,
+			want: []client.TracebackFrame{
+				{File: "/work/main.py", Line: 4, Function: "<module>", Code: `raise RuntimeError("bad input")`},
+			},
+		},
+		{
+			name: "eval wrapper frames are dropped",
+			stderr: `Traceback (most recent call last):
+  File "/work/_pyexec_eval.py", line 20, in <module>
+    exec(compile(tree, '<string>', 'exec'))
+  File "<string>", line 1, in <module>
+NameError: name 'x' is not defined
+`,
+			want: []client.TracebackFrame{
+				{File: "<string>", Line: 1, Function: "<module>"},
+			},
+		},
+		{
+			name:   "no traceback",
+			stderr: "warning: something\n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseTraceback(tt.stderr)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTraceback() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID a request is traced by. It is echoed on
+// every response, and executions submitted by the request keep it as their
+// trace ID.
+const RequestIDHeader = "X-Request-ID"
+
+// traceparentHeader is the W3C Trace Context header. The trace ID it
+// carries is used when the request has no X-Request-ID.
+const traceparentHeader = "traceparent"
+
+// requestIDContextKey holds the ID RequestID resolved for a request
+const requestIDContextKey = "request_id"
+
+// requestIDPattern matches the request IDs callers may supply
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]{0,127}$`)
+
+// traceparentPattern matches a version 00 traceparent, capturing its trace ID
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// RequestID resolves the ID a request is traced by: the caller's
+// X-Request-ID, else the trace ID of its traceparent, else a new one
+func RequestID(c *gin.Context) {
+	id := requestID(c)
+	c.Set(requestIDContextKey, id)
+	c.Header(RequestIDHeader, id)
+	c.Next()
+}
+
+// requestID returns the ID a request names, or a new one
+func requestID(c *gin.Context) string {
+	if id := c.GetHeader(RequestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+	if m := traceparentPattern.FindStringSubmatch(strings.TrimSpace(c.GetHeader(traceparentHeader))); m != nil && m[1] != strings.Repeat("0", 32) {
+		return m[1]
+	}
+	return newTraceID()
+}
+
+// traceIDOf returns the ID RequestID resolved for a request, if it ran
+func traceIDOf(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// newTraceID returns a random ID in the form of a W3C trace ID
+func newTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// traceEnv returns the environment variables that tie an execution's
+// container to its record and the request that submitted it
+func traceEnv(execID, traceID string) []string {
+	env := []string{"PYEXEC_EXECUTION_ID=" + execID}
+	if traceID != "" {
+		env = append(env, "PYEXEC_TRACE_ID="+traceID)
+	}
+	return env
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID)
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, traceIDOf(c)) })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"request ID", map[string]string{RequestIDHeader: "req-42"}, "req-42"},
+		{"traceparent", map[string]string{traceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"request ID wins", map[string]string{RequestIDHeader: "req-42", traceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}, "req-42"},
+		{"invalid request ID", map[string]string{RequestIDHeader: "bad id!"}, ""},
+		{"zero trace ID", map[string]string{traceparentHeader: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			got := w.Body.String()
+			if w.Header().Get(RequestIDHeader) != got {
+				t.Errorf("%s header = %q, want %q", RequestIDHeader, w.Header().Get(RequestIDHeader), got)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("request ID = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && len(got) != 32 {
+				t.Errorf("generated request ID = %q, want 32 hex digits", got)
+			}
+		})
+	}
+}
+
+func TestTraceIDReachesContainer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, &config.Config{})
+
+	router := gin.New()
+	router.Use(RequestID)
+	router.POST("/eval", server.ExecuteEval)
+
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)"})
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d (body %s)", w.Code, w.Body.String())
+	}
+
+	var result client.ExecutionResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.TraceID != "req-42" {
+		t.Errorf("trace_id = %q, want req-42", result.TraceID)
+	}
+
+	env := fake.requests[0].Env
+	for _, want := range []string{"PYEXEC_EXECUTION_ID=" + result.ExecutionID, "PYEXEC_TRACE_ID=req-42"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("container env %v is missing %s", env, want)
+		}
+	}
+
+	exec, err := store.Get(req.Context(), result.ExecutionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.TraceID != "req-42" {
+		t.Errorf("stored trace ID = %q, want req-42", exec.TraceID)
+	}
+}
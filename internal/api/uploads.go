@@ -0,0 +1,203 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/geraldthewes/python-executor/internal/upload"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateUpload starts a chunked archive upload
+// @Summary Start a chunked upload
+// @Description Start an upload of an archive too large, or a link too
+// @Description unreliable, to send in one request. Send the archive in order
+// @Description with PUT /uploads/{id}, complete it, then execute it by passing
+// @Description its upload_id in the metadata instead of a tar part. Uploads
+// @Description are stored by the instance that created them and deleted after
+// @Description PYEXEC_UPLOAD_TTL without writes.
+// @Tags uploads
+// @Produce json
+// @Success 201 {object} client.Upload "New upload"
+// @Router /uploads [post]
+func (s *Server) CreateUpload(c *gin.Context) {
+	if s.uploads == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chunked uploads are not enabled"})
+		return
+	}
+
+	u, err := s.uploads.Create()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, u)
+}
+
+// GetUpload returns the state of an upload
+// @Summary Get upload state
+// @Description Return how many bytes of an upload the server has, which is
+// @Description where a client resumes after a failed chunk.
+// @Tags uploads
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Success 200 {object} client.Upload "Upload state"
+// @Failure 404 {object} gin.H "Upload not found"
+// @Router /uploads/{id} [get]
+func (s *Server) GetUpload(c *gin.Context) {
+	if s.uploads == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chunked uploads are not enabled"})
+		return
+	}
+
+	u, err := s.uploads.Get(c.Param("id"))
+	if err != nil {
+		uploadError(c, u, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// UploadChunk appends a chunk to an upload
+// @Summary Upload a chunk
+// @Description Append the request body to an upload. offset must equal the
+// @Description bytes already received; if it doesn't, nothing is written and
+// @Description the response gives the offset to resume from. If the body is cut
+// @Description off, the bytes that arrived are kept.
+// @Tags uploads
+// @Accept octet-stream
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Param offset query int true "Offset of the chunk in the archive"
+// @Param chunk body string true "Chunk bytes"
+// @Success 200 {object} client.Upload "Upload state after the chunk"
+// @Failure 400 {object} gin.H "Missing or invalid offset"
+// @Failure 404 {object} gin.H "Upload not found"
+// @Failure 409 {object} gin.H "Offset mismatch, upload complete, or another chunk in progress"
+// @Failure 413 {object} gin.H "Upload exceeds PYEXEC_MAX_UPLOAD_MB"
+// @Router /uploads/{id} [put]
+func (s *Server) UploadChunk(c *gin.Context) {
+	if s.uploads == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chunked uploads are not enabled"})
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offset query parameter must be a non-negative integer"})
+		return
+	}
+
+	u, err := s.uploads.Append(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		uploadError(c, u, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// CompleteUpload finishes an upload so it can be executed
+// @Summary Complete an upload
+// @Description Mark an upload as complete. If sha256 is given the upload is only
+// @Description completed if it matches the received bytes; otherwise it stays
+// @Description open so the client can check its offset and resend.
+// @Tags uploads
+// @Accept json
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Param request body client.CompleteUploadRequest false "Expected checksum"
+// @Success 200 {object} client.Upload "Completed upload"
+// @Failure 400 {object} gin.H "Invalid request"
+// @Failure 404 {object} gin.H "Upload not found"
+// @Failure 409 {object} gin.H "Another chunk in progress"
+// @Failure 422 {object} gin.H "Checksum mismatch"
+// @Router /uploads/{id}/complete [post]
+func (s *Server) CompleteUpload(c *gin.Context) {
+	if s.uploads == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chunked uploads are not enabled"})
+		return
+	}
+
+	// The body is optional
+	var req client.CompleteUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	u, err := s.uploads.Complete(c.Param("id"), req.SHA256)
+	if err != nil {
+		uploadError(c, u, err)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// DeleteUpload abandons an upload
+// @Summary Delete an upload
+// @Description Delete an upload and the data received for it, complete or not.
+// @Tags uploads
+// @Produce json
+// @Param id path string true "Upload ID"
+// @Success 204 "Upload deleted"
+// @Failure 404 {object} gin.H "Upload not found"
+// @Failure 409 {object} gin.H "A chunk is in progress"
+// @Router /uploads/{id} [delete]
+func (s *Server) DeleteUpload(c *gin.Context) {
+	if s.uploads == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chunked uploads are not enabled"})
+		return
+	}
+
+	if err := s.uploads.Delete(c.Param("id")); err != nil {
+		uploadError(c, nil, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// uploadError writes the response for an upload store error, including
+// the upload's offset when known so the client can resume from it
+func uploadError(c *gin.Context, u *client.Upload, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, upload.ErrOffsetMismatch), errors.Is(err, upload.ErrComplete), errors.Is(err, upload.ErrBusy):
+		status = http.StatusConflict
+	case errors.Is(err, upload.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, upload.ErrChecksum):
+		status = http.StatusUnprocessableEntity
+	}
+
+	body := gin.H{"error": err.Error()}
+	if u != nil {
+		body["upload_id"] = u.UploadID
+		body["offset"] = u.Offset
+		body["complete"] = u.Complete
+	}
+	c.JSON(status, body)
+}
+
+// uploadedArchive returns the archive of a completed upload named by an
+// exec request's metadata
+func (s *Server) uploadedArchive(id string) ([]byte, error) {
+	if s.uploads == nil {
+		return nil, errors.New("chunked uploads are not enabled")
+	}
+	return s.uploads.Read(id)
+}
+
+// CleanupUploads deletes uploads not written to for PYEXEC_UPLOAD_TTL,
+// returning how many it deleted. Uploads are local to each instance, so
+// every replica cleans up its own.
+func (s *Server) CleanupUploads() (int, error) {
+	if s.uploads == nil {
+		return 0, nil
+	}
+	return s.uploads.Cleanup(s.config.Upload.TTL)
+}
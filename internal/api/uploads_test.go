@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// newUploadRouter returns a router with the upload and exec routes of a
+// server storing uploads in a temporary directory
+func newUploadRouter(t *testing.T, fake *fakeExecutor) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Upload: config.UploadConfig{Dir: t.TempDir(), MaxMB: 1}}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/uploads", server.CreateUpload)
+	router.GET("/uploads/:id", server.GetUpload)
+	router.PUT("/uploads/:id", server.UploadChunk)
+	router.POST("/uploads/:id/complete", server.CompleteUpload)
+	router.DELETE("/uploads/:id", server.DeleteUpload)
+	router.POST("/exec/sync", server.ExecuteSync)
+	return router
+}
+
+// doUpload sends a request to router and decodes the Upload it returns
+func doUpload(t *testing.T, router *gin.Engine, method, path string, body []byte, wantStatus int) client.Upload {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	if w.Code != wantStatus {
+		t.Fatalf("%s %s status = %d, want %d (body %s)", method, path, w.Code, wantStatus, w.Body.String())
+	}
+
+	var u client.Upload
+	json.Unmarshal(w.Body.Bytes(), &u)
+	return u
+}
+
+func TestUploads_ChunkedExecution(t *testing.T) {
+	fake := &fakeExecutor{}
+	router := newUploadRouter(t, fake)
+
+	tarData, err := buildTarFromFiles([]client.CodeFile{{Name: "main.py", Content: "print(1)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	half := len(tarData) / 2
+
+	u := doUpload(t, router, http.MethodPost, "/uploads", nil, http.StatusCreated)
+	id := u.UploadID
+
+	doUpload(t, router, http.MethodPut, "/uploads/"+id+"?offset=0", tarData[:half], http.StatusOK)
+
+	// A retried chunk gets the offset to resume from
+	u = doUpload(t, router, http.MethodPut, "/uploads/"+id+"?offset=0", tarData[:half], http.StatusConflict)
+	if u.Offset != int64(half) {
+		t.Errorf("conflict offset = %d, want %d", u.Offset, half)
+	}
+	if u = doUpload(t, router, http.MethodGet, "/uploads/"+id, nil, http.StatusOK); u.Offset != int64(half) {
+		t.Errorf("GET offset = %d, want %d", u.Offset, half)
+	}
+
+	doUpload(t, router, http.MethodPut, "/uploads/"+id+"?offset="+strconv.Itoa(half), tarData[half:], http.StatusOK)
+	doUpload(t, router, http.MethodPut, "/uploads/"+id, nil, http.StatusBadRequest)
+
+	sum := sha256.Sum256(tarData)
+	body, _ := json.Marshal(client.CompleteUploadRequest{SHA256: strings.Repeat("0", 64)})
+	doUpload(t, router, http.MethodPost, "/uploads/"+id+"/complete", body, http.StatusUnprocessableEntity)
+	body, _ = json.Marshal(client.CompleteUploadRequest{SHA256: hex.EncodeToString(sum[:])})
+	if u = doUpload(t, router, http.MethodPost, "/uploads/"+id+"/complete", body, http.StatusOK); !u.Complete {
+		t.Errorf("complete upload = %+v", u)
+	}
+
+	// The exec request names the upload instead of sending a tar part
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, metadataOnlyRequest("/exec/sync", `{"entrypoint":"main.py","upload_id":"`+id+`"}`))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("exec status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	if len(fake.requests) != 1 || !bytes.Equal(fake.requests[0].TarData, tarData) {
+		t.Error("executor did not get the uploaded archive")
+	}
+
+	doUpload(t, router, http.MethodDelete, "/uploads/"+id, nil, http.StatusNoContent)
+	doUpload(t, router, http.MethodGet, "/uploads/"+id, nil, http.StatusNotFound)
+}
+
+func TestUploads_ExecRejections(t *testing.T) {
+	router := newUploadRouter(t, &fakeExecutor{})
+	u := doUpload(t, router, http.MethodPost, "/uploads", nil, http.StatusCreated)
+
+	tests := []struct {
+		name     string
+		metadata string
+		withTar  bool
+	}{
+		{name: "incomplete upload", metadata: `{"entrypoint":"main.py","upload_id":"` + u.UploadID + `"}`},
+		{name: "unknown upload", metadata: `{"entrypoint":"main.py","upload_id":"upl_missing"}`},
+		{name: "tar and upload", metadata: `{"entrypoint":"main.py","upload_id":"` + u.UploadID + `"}`, withTar: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := metadataOnlyRequest("/exec/sync", tt.metadata)
+			if tt.withTar {
+				req = multipartExecRequest(t, "/exec/sync", tt.metadata, nil)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, http.StatusBadRequest, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploads_TooLarge(t *testing.T) {
+	router := newUploadRouter(t, &fakeExecutor{})
+	u := doUpload(t, router, http.MethodPost, "/uploads", nil, http.StatusCreated)
+
+	doUpload(t, router, http.MethodPut, "/uploads/"+u.UploadID+"?offset=0", make([]byte, 1<<20+1), http.StatusRequestEntityTooLarge)
+	if u = doUpload(t, router, http.MethodGet, "/uploads/"+u.UploadID, nil, http.StatusOK); u.Offset != 0 {
+		t.Errorf("offset after rejected chunk = %d, want 0", u.Offset)
+	}
+}
+
+func TestUploads_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+
+	router := gin.New()
+	router.POST("/uploads", server.CreateUpload)
+	doUpload(t, router, http.MethodPost, "/uploads", nil, http.StatusNotFound)
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader names the tenant a submission is accounted to on a server
+// without API keys. With keys, the key's tenant is used and the header is
+// ignored, so that callers can't charge their usage to someone else.
+const TenantHeader = "X-Tenant"
+
+// defaultTenant is the tenant of submissions that name none
+const defaultTenant = "default"
+
+// tenantContextKey holds the tenant AccountUsage resolved for a request
+const tenantContextKey = "tenant"
+
+// tenantPattern matches the tenant names callers may use
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// requestTenant returns the tenant a request is accounted to: its API
+// key's, or the one it names on a server without keys
+func (s *Server) requestTenant(c *gin.Context) (string, error) {
+	if s.apiKeys != nil {
+		k, _ := c.Value(apiKeyContextKey).(config.APIKey)
+		return k.TenantName(), nil
+	}
+	tenant := c.GetHeader(TenantHeader)
+	if tenant == "" {
+		return defaultTenant, nil
+	}
+	if !tenantPattern.MatchString(tenant) {
+		return "", fmt.Errorf("invalid %s %q: use up to 64 letters, digits, '.', '_' and '-'", TenantHeader, tenant)
+	}
+	return tenant, nil
+}
+
+// tenantOf returns the tenant AccountUsage resolved for a request
+func tenantOf(c *gin.Context) string {
+	if tenant := c.GetString(tenantContextKey); tenant != "" {
+		return tenant
+	}
+	return defaultTenant
+}
+
+// usagePeriods returns the UTC day and month t falls in, as usage periods
+func usagePeriods(t time.Time) (day, month string) {
+	t = t.UTC()
+	return t.Format("2006-01-02"), t.Format("2006-01")
+}
+
+// memoryLimitMB returns the memory limit an execution ran with
+func (s *Server) memoryLimitMB(exec *storage.Execution) int {
+	if exec.Manifest != nil && exec.Manifest.Config != nil && exec.Manifest.Config.MemoryMB > 0 {
+		return exec.Manifest.Config.MemoryMB
+	}
+	if exec.Metadata != nil && exec.Metadata.Config != nil && exec.Metadata.Config.MemoryMB > 0 {
+		return exec.Metadata.Config.MemoryMB
+	}
+	if s.config != nil {
+		return s.config.Defaults.MemoryMB
+	}
+	return 0
+}
+
+// executionUsage returns the resources a finished execution consumed
+func (s *Server) executionUsage(exec *storage.Execution) *client.Usage {
+	usage := &client.Usage{
+		Executions:      1,
+		DurationMs:      exec.DurationMs,
+		MemoryMBSeconds: float64(s.memoryLimitMB(exec)) * float64(exec.DurationMs) / 1000,
+	}
+	if exec.CPU != nil {
+		usage.CPUSeconds = float64(exec.CPU.UserMs+exec.CPU.SystemMs) / 1000
+	}
+	if exec.Status != client.StatusCompleted || exec.ExitCode != 0 || exec.Error != "" {
+		usage.Failures = 1
+	}
+	return usage
+}
+
+// recordUsage adds a finished execution to its tenant's usage for the day
+// and month it started in. Executions that never started are not counted.
+func (s *Server) recordUsage(ctx context.Context, exec *storage.Execution) {
+	if exec.StartedAt == nil {
+		return
+	}
+	tenant := exec.Tenant
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+
+	usage := s.executionUsage(exec)
+	day, month := usagePeriods(*exec.StartedAt)
+	s.storage.AddUsage(ctx, tenant, day, usage)
+	s.storage.AddUsage(ctx, tenant, month, usage)
+}
+
+// budgetExceeded describes the first limit of budget that usage has
+// reached, or returns "" if it has reached none
+func budgetExceeded(usage *client.Usage, budget config.UsageBudget) string {
+	switch {
+	case budget.Executions > 0 && usage.Executions >= int64(budget.Executions):
+		return fmt.Sprintf("%d executions", budget.Executions)
+	case budget.CPUSeconds > 0 && usage.CPUSeconds >= float64(budget.CPUSeconds):
+		return fmt.Sprintf("%d CPU-seconds", budget.CPUSeconds)
+	case budget.MemoryMBSeconds > 0 && usage.MemoryMBSeconds >= float64(budget.MemoryMBSeconds):
+		return fmt.Sprintf("%d MB-seconds of memory", budget.MemoryMBSeconds)
+	}
+	return ""
+}
+
+// AccountUsage resolves the tenant a submission is accounted to, from its
+// API key or TenantHeader, and rejects it with 429 if the tenant has used
+// up its daily or monthly budget. Retry-After tells the caller when the
+// budget resets.
+func (s *Server) AccountUsage(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(tenantContextKey, tenant)
+	if s.config == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	day, month := usagePeriods(now)
+	budgets := []struct {
+		name   string
+		period string
+		budget config.UsageBudget
+		resets time.Time
+	}{
+		{"daily", day, s.config.Usage.Daily, time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", month, s.config.Usage.Monthly, time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, b := range budgets {
+		if b.budget == (config.UsageBudget{}) {
+			continue
+		}
+		usage, err := s.storage.GetUsage(c.Request.Context(), tenant, b.period)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to read usage"})
+			return
+		}
+		if limit := budgetExceeded(usage, b.budget); limit != "" {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(b.resets.Sub(now).Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":  fmt.Sprintf("tenant %s has used its %s budget of %s", tenant, b.name, limit),
+				"tenant": tenant,
+				"period": b.period,
+			})
+			return
+		}
+	}
+}
+
+// parseUsagePeriod checks a requested usage period; empty means the
+// current month
+func parseUsagePeriod(period string) (string, error) {
+	if period == "" {
+		_, month := usagePeriods(time.Now())
+		return month, nil
+	}
+	if _, err := time.Parse("2006-01-02", period); err == nil {
+		return period, nil
+	}
+	if _, err := time.Parse("2006-01", period); err == nil {
+		return period, nil
+	}
+	return "", fmt.Errorf("invalid period %q: use a UTC day (2006-01-02) or month (2006-01)", period)
+}
+
+// GetUsage reports tenants' usage
+// @Summary Get usage
+// @Description Report the executions, failures, duration, CPU-seconds and
+// @Description memory-MB-seconds of one tenant, or of every tenant with usage,
+// @Description in a UTC day or month, with their total.
+// @Tags usage
+// @Produce json
+// @Param tenant query string false "Tenant to report; every tenant if omitted"
+// @Param period query string false "UTC day (2006-01-02) or month (2006-01); the current month if omitted"
+// @Success 200 {object} client.UsageReport "Usage in the period"
+// @Failure 400 {object} gin.H "Invalid tenant or period"
+// @Failure 500 {object} gin.H "Failed to read usage"
+// @Router /usage [get]
+func (s *Server) GetUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	period, err := parseUsagePeriod(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tenants []*client.Usage
+	if tenant := c.Query("tenant"); tenant != "" {
+		if !tenantPattern.MatchString(tenant) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid tenant %q", tenant)})
+			return
+		}
+		usage, err := s.storage.GetUsage(ctx, tenant, period)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read usage"})
+			return
+		}
+		tenants = []*client.Usage{usage}
+	} else if tenants, err = s.storage.ListUsage(ctx, period); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read usage"})
+		return
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Tenant < tenants[j].Tenant
+	})
+
+	report := client.UsageReport{
+		Period:  period,
+		Tenants: make([]client.Usage, 0, len(tenants)),
+		Total:   client.Usage{Period: period},
+	}
+	for _, usage := range tenants {
+		report.Tenants = append(report.Tenants, *usage)
+		report.Total.Executions += usage.Executions
+		report.Total.Failures += usage.Failures
+		report.Total.DurationMs += usage.DurationMs
+		report.Total.CPUSeconds += usage.CPUSeconds
+		report.Total.MemoryMBSeconds += usage.MemoryMBSeconds
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/gin-gonic/gin"
+)
+
+// evalAs posts code to /eval with the given tenant header, if any
+func evalAs(router *gin.Engine, tenant, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(client.SimpleExecRequest{Code: code})
+	req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAccountUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{output: &executor.ExecutionOutput{
+		ExitCode:   1,
+		DurationMs: 2000,
+		CPU:        &client.CPUUsage{UserMs: 1200, SystemMs: 300},
+	}}
+	cfg := &config.Config{}
+	cfg.Defaults.MemoryMB = 512
+	cfg.Usage.Daily.Executions = 2
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), fake, cfg)
+
+	router := gin.New()
+	router.POST("/eval", server.AccountUsage, server.ExecuteEval)
+
+	for i := 0; i < 2; i++ {
+		if w := evalAs(router, "team-a", "exit(1)"); w.Code != http.StatusOK {
+			t.Fatalf("run %d: status = %d (body %s)", i, w.Code, w.Body.String())
+		}
+	}
+	if fake.requests[0].Tenant != "team-a" {
+		t.Errorf("executor request tenant = %q, want team-a", fake.requests[0].Tenant)
+	}
+
+	day, month := usagePeriods(time.Now())
+	for _, period := range []string{day, month} {
+		usage, _ := store.GetUsage(context.Background(), "team-a", period)
+		want := client.Usage{Tenant: "team-a", Period: period, Executions: 2, Failures: 2, DurationMs: 4000, CPUSeconds: 3, MemoryMBSeconds: 2048}
+		if *usage != want {
+			t.Errorf("usage for %s = %+v, want %+v", period, *usage, want)
+		}
+	}
+
+	// The budget is used up for team-a, until tomorrow
+	w := evalAs(router, "team-a", "print(1)")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	retryAfter, _ := strconv.Atoi(w.Header().Get("Retry-After"))
+	if retryAfter <= 0 || retryAfter > 86400 {
+		t.Errorf("Retry-After = %q", w.Header().Get("Retry-After"))
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] != "tenant team-a has used its daily budget of 2 executions" || body["period"] != day {
+		t.Errorf("body = %v", body)
+	}
+	if len(fake.requests) != 2 {
+		t.Errorf("rejected submission ran")
+	}
+
+	// Other tenants, including the default one, have their own budget
+	if w := evalAs(router, "", "print(1)"); w.Code != http.StatusOK {
+		t.Errorf("default tenant: status = %d", w.Code)
+	}
+	usage, _ := store.GetUsage(context.Background(), defaultTenant, day)
+	if usage.Executions != 1 || usage.Failures != 1 {
+		t.Errorf("default tenant usage = %+v", usage)
+	}
+
+	if w := evalAs(router, "team a", "print(1)"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tenant: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAccountUsage_APIKeyTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	fake := &fakeExecutor{}
+	server := NewServer(storage.NewMemoryStorage(), queue.NewMemoryQueue(), fake, &config.Config{})
+	server.SetAPIKeys([]config.APIKey{
+		{Name: "ci", Key: "k1", Scopes: []string{config.ScopeRun}, Tenant: "platform"},
+		{Name: "batch", Key: "k2", Scopes: []string{config.ScopeRun}},
+	})
+	router := gin.New()
+	router.POST("/eval", server.Authenticate, server.AccountUsage, server.ExecuteEval)
+
+	// The tenant comes from the key, whatever the header says
+	for _, key := range []string{"k1", "k2"} {
+		body, _ := json.Marshal(client.SimpleExecRequest{Code: "print(1)"})
+		req := httptest.NewRequest(http.MethodPost, "/eval", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(APIKeyHeader, key)
+		req.Header.Set(TenantHeader, "team-a")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d (body %s)", w.Code, w.Body.String())
+		}
+	}
+	if len(fake.requests) != 2 || fake.requests[0].Tenant != "platform" || fake.requests[1].Tenant != "batch" {
+		t.Errorf("executor requests = %+v, want tenants platform and batch", fake.requests)
+	}
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	usage := &client.Usage{Executions: 10, CPUSeconds: 99.5, MemoryMBSeconds: 4096}
+
+	tests := []struct {
+		budget config.UsageBudget
+		want   string
+	}{
+		{config.UsageBudget{}, ""},
+		{config.UsageBudget{Executions: 11, CPUSeconds: 100, MemoryMBSeconds: 5000}, ""},
+		{config.UsageBudget{Executions: 10}, "10 executions"},
+		{config.UsageBudget{CPUSeconds: 99}, "99 CPU-seconds"},
+		{config.UsageBudget{MemoryMBSeconds: 4096}, "4096 MB-seconds of memory"},
+	}
+	for _, tt := range tests {
+		if got := budgetExceeded(usage, tt.budget); got != tt.want {
+			t.Errorf("budgetExceeded(%+v) = %q, want %q", tt.budget, got, tt.want)
+		}
+	}
+}
+
+func TestRecordUsage_NotStarted(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	server := NewServer(store, queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+
+	// A submission that failed to queue never ran, so it is not counted
+	exec := &storage.Execution{ID: "exe_1", Status: client.StatusPending, Tenant: "team-a", CreatedAt: time.Now()}
+	store.Create(context.Background(), exec)
+	server.failExecution(context.Background(), exec, "queueing execution: closed")
+
+	_, month := usagePeriods(time.Now())
+	usage, _ := store.GetUsage(context.Background(), "team-a", month)
+	if usage.Executions != 0 {
+		t.Errorf("usage = %+v, want none", usage)
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store := storage.NewMemoryStorage()
+	ctx := context.Background()
+	store.AddUsage(ctx, "team-b", "2026-10", &client.Usage{Executions: 3, Failures: 1, DurationMs: 3000, CPUSeconds: 1.5, MemoryMBSeconds: 3072})
+	store.AddUsage(ctx, "team-a", "2026-10", &client.Usage{Executions: 1, DurationMs: 500, CPUSeconds: 0.5, MemoryMBSeconds: 512})
+	store.AddUsage(ctx, "team-a", "2026-10-16", &client.Usage{Executions: 1, DurationMs: 500, CPUSeconds: 0.5, MemoryMBSeconds: 512})
+	server := NewServer(store, queue.NewMemoryQueue(), &fakeExecutor{}, &config.Config{})
+
+	router := gin.New()
+	router.GET("/usage", server.GetUsage)
+
+	get := func(query string) (int, client.UsageReport) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usage"+query, nil))
+		var report client.UsageReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	code, report := get("?period=2026-10")
+	if code != http.StatusOK || len(report.Tenants) != 2 || report.Tenants[0].Tenant != "team-a" {
+		t.Fatalf("status %d, report %+v", code, report)
+	}
+	want := client.Usage{Period: "2026-10", Executions: 4, Failures: 1, DurationMs: 3500, CPUSeconds: 2, MemoryMBSeconds: 3584}
+	if report.Total != want {
+		t.Errorf("total = %+v, want %+v", report.Total, want)
+	}
+
+	code, report = get("?period=2026-10-16&tenant=team-b")
+	if code != http.StatusOK || len(report.Tenants) != 1 || report.Tenants[0].Tenant != "team-b" || report.Total.Executions != 0 {
+		t.Errorf("team-b on 2026-10-16: status %d, report %+v", code, report)
+	}
+
+	// The current month by default
+	_, month := usagePeriods(time.Now())
+	if code, report = get(""); code != http.StatusOK || report.Period != month || report.Tenants == nil {
+		t.Errorf("default period: status %d, report %+v", code, report)
+	}
+
+	for _, query := range []string{"?period=2026-13", "?period=last-month", "?tenant=team%20a"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
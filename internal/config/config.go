@@ -1,7 +1,12 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,21 +18,97 @@ type Config struct {
 	Docker  DockerConfig
 	Defaults DefaultsConfig
 	Consul  ConsulConfig
+	Snapshot SnapshotConfig
 	Cleanup CleanupConfig
+	Queue   QueueConfig
+	Upload  UploadConfig
+	Session SessionConfig
+	Pool    PoolConfig
+	Events  EventsConfig
+	Usage   UsageConfig
+	Approval ApprovalConfig
+	Redact  RedactConfig
+	Secrets SecretsConfig
+	Runners RunnersConfig
+	Egress  EgressConfig
+	Auth    AuthConfig
+	Quota   QuotaConfig
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Host     string
-	Port     string
-	LogLevel string
+	Host             string
+	Port             string
+	LogLevel         string
+	ShutdownDrain    time.Duration     // how long to wait for running executions on shutdown
+	NodeID           string            // identifies this instance when replicas share storage
+	NodeLabels       map[string]string // capabilities executions' placement constraints are matched against
+	NodeMemoryMB     int               // largest memory limit this instance runs; 0 means no limit
+	PublicURL        string            // base URL execution containers use to reach the server
+	MaxInlineOutput  int               // bytes of each output stream returned inline; 0 means no limit
+	MaxExtractMB     int               // total size of a request's archive once extracted; 0 means no limit
+	MaxExtractFiles  int               // entries in a request's archive; 0 means no limit
+	MaxExtractFileMB int               // size of any one file in a request's archive; 0 means no limit
+	SyncDisconnect   string            // DisconnectKill or DisconnectDetach: what happens when a sync caller goes away
+	SyncDetachAfter  time.Duration     // sync executions running longer are answered with 202 and run on; 0 means never
+	Executor         string            // ExecutorDocker or ExecutorRunners: where executions run
+	TrustedProxies   []string          // addresses or CIDRs whose X-Forwarded-For is believed; none means the connection's address is the client's
+	WebSocketOrigins []string          // origins, besides the server's own, whose pages may open WebSockets to it
 }
 
+// Executors
+const (
+	// ExecutorDocker runs executions in this instance's Docker
+	ExecutorDocker = "docker"
+	// ExecutorRunners hands them to runner agents on other hosts
+	ExecutorRunners = "runners"
+)
+
+// Sync disconnect policies
+const (
+	// DisconnectKill kills the execution of a sync caller that disconnects
+	DisconnectKill = "kill"
+	// DisconnectDetach lets it run on as if it had been submitted async
+	DisconnectDetach = "detach"
+)
+
 // DockerConfig holds Docker client configuration
 type DockerConfig struct {
-	Socket      string
+	Socket      string // empty finds the daemon as the docker CLI would (see executor.FindDockerHost)
 	DNSServers  []string
 	NetworkMode string // "host" or "bridge" for execution containers
+	// CertPath is a directory of TLS material for tcp:// daemons, as in
+	// DOCKER_CERT_PATH: ca.pem, and cert.pem and key.pem for a client
+	// certificate. TLSVerify checks the daemon's certificate against ca.pem.
+	CertPath  string
+	TLSVerify bool
+	// SELinuxType and SELinuxLevel label execution containers on hosts
+	// with SELinux enforcing, as --security-opt label=type:... and
+	// label=level:... would; SELinuxDisable turns labeling off for them
+	SELinuxType    string
+	SELinuxLevel   string
+	SELinuxDisable bool
+	// BlkioDevices are the block devices, e.g. /dev/sda, that disk read
+	// and write limits apply to: those backing Docker's storage
+	BlkioDevices []string
+	// Checkpoints lets executions be checkpointed to disk with CRIU, which
+	// needs a daemon with experimental features enabled and CRIU installed
+	Checkpoints bool
+	// FakeTimeLib is the path of libfaketime inside execution images,
+	// preloaded into executions that ask for a fake clock
+	FakeTimeLib string
+	// DiskCheckInterval is how often a running execution's disk usage is
+	// measured against its disk limit; 0 leaves the limit unchecked.
+	// Docker measures it by walking the container's files.
+	DiskCheckInterval time.Duration
+}
+
+// EgressConfig configures the egress proxy that limits the bandwidth of
+// executions' network traffic
+type EgressConfig struct {
+	ProxyAddr string // address the proxy listens on; empty disables it
+	ProxyURL  string // the proxy as execution containers reach it; defaults to 127.0.0.1 and ProxyAddr's port
+	Kbps      int    // bandwidth of each execution in kilobits per second, 0 for no limit
 }
 
 // DefaultsConfig holds default execution parameters
@@ -36,8 +117,72 @@ type DefaultsConfig struct {
 	MemoryMB          int
 	DiskMB            int
 	CPUShares         int
+	BlkioWeight       uint16
+	DiskReadBps       int64
+	DiskWriteBps      int64
 	DockerImage       string
 	AutoDetectImports bool
+	// PullTimeout and InstallTimeout bound, in seconds, pulling an
+	// execution's image and installing its dependencies. Timeout covers
+	// only the script's run.
+	PullTimeout    int
+	InstallTimeout int
+	// InstallNetworkOnly forces network-for-install-only mode on every execution
+	InstallNetworkOnly bool
+	// InstallMemoryMB and InstallCPUShares limit the dependency install
+	// container; zero means use the execution's own limits
+	InstallMemoryMB  int
+	InstallCPUShares int
+	// StripANSI removes ANSI escape sequences from every execution's output
+	StripANSI bool
+	// ResolveVersions pins auto-detected packages to the newest release on
+	// PyPIURL that supports the execution's Python, caching each resolution
+	// for ResolveCacheTTL
+	ResolveVersions bool
+	PyPIURL         string
+	ResolveCacheTTL time.Duration
+	// MaxRetries caps the retries an execution's retry policy may ask for
+	MaxRetries int
+	// PresetsFile is a JSON file of named resource presets, read into
+	// Presets at startup
+	PresetsFile string
+	Presets     map[string]Preset
+}
+
+// Preset is a named bundle of resources an execution selects with
+// Metadata.Preset. Zero fields leave the defaults in place, and settings
+// the execution gives itself take precedence.
+type Preset struct {
+	DockerImage    string `json:"docker_image,omitempty"`
+	MemoryMB       int    `json:"memory_mb,omitempty"`
+	CPUShares      int    `json:"cpu_shares,omitempty"`
+	DiskMB         int    `json:"disk_mb,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// presetNamePattern matches the names presets may have
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// LoadPresets reads a presets file: a JSON object mapping each preset's
+// name to its settings, e.g. {"small": {"memory_mb": 512, "cpu_shares": 512}}
+func LoadPresets(path string) (map[string]Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading presets: %w", err)
+	}
+	var presets map[string]Preset
+	if err := json.Unmarshal(data, &presets); err != nil {
+		return nil, fmt.Errorf("parsing presets: %w", err)
+	}
+	for name, p := range presets {
+		if !presetNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid preset name %q: use up to 64 letters, digits, '.', '_' and '-'", name)
+		}
+		if p.MemoryMB < 0 || p.CPUShares < 0 || p.DiskMB < 0 || p.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("preset %s: limits must not be negative", name)
+		}
+	}
+	return presets, nil
 }
 
 // ConsulConfig holds Consul configuration
@@ -46,6 +191,285 @@ type ConsulConfig struct {
 	Token     string
 	KeyPrefix string
 	Enabled   bool
+	// Timeout bounds each call to Consul, which is retried Retries times
+	// if it fails
+	Timeout time.Duration
+	Retries int
+	// After BreakerThreshold consecutive failed calls Consul is not called
+	// for BreakerCooldown, and requests needing it are refused with 503
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// QueueConfig holds async queue and load configuration
+type QueueConfig struct {
+	Workers int // async executions run concurrently by this instance
+	// MaxConcurrent bounds the executions this instance runs at once, sync
+	// and async; 0 means no limit
+	MaxConcurrent int
+	// OverloadPolicy is what happens to submissions once MaxConcurrent
+	// executions are running: OverloadQueue or OverloadReject
+	OverloadPolicy string
+	MaxWaiting     int // sync requests waiting for a slot under OverloadQueue; 0 means no limit
+	MaxLength      int // async jobs waiting in the queue under OverloadQueue; 0 means no limit
+}
+
+// Overload policies
+const (
+	// OverloadQueue makes sync requests wait for a free slot and queues
+	// async submissions
+	OverloadQueue = "queue"
+	// OverloadReject answers 429 to every submission while no slot is free
+	OverloadReject = "reject"
+)
+
+// UploadConfig holds chunked upload configuration
+type UploadConfig struct {
+	Dir           string        // where uploads are stored on this instance
+	MaxMB         int           // size of any one upload; 0 means no limit
+	TTL           time.Duration // uploads and cached archives unused for this long are deleted
+	CacheArchives bool          // keep archives by SHA-256 so clients can run them again without sending them
+}
+
+// SessionConfig holds persistent session configuration
+type SessionConfig struct {
+	Max            int           // sessions open at once on this instance; 0 means no limit
+	IdleTimeout    time.Duration // sessions without an eval for this long are closed; 0 means never
+	MaxIdleTimeout time.Duration // longest idle timeout a session may ask for; 0 means no limit
+}
+
+// EventsConfig holds execution event publishing configuration
+type EventsConfig struct {
+	NATSURL      string // NATS server to publish to, e.g. nats://host:4222; empty disables NATS
+	NATSSubject  string // subject prefix; each event goes to {prefix}.{type}
+	KafkaRESTURL string // Kafka REST Proxy to produce through; empty disables Kafka
+	KafkaTopic   string
+	Buffer       int // events waiting for delivery; more are dropped
+}
+
+// UsageConfig holds the usage budgets applied to every tenant
+type UsageConfig struct {
+	Daily   UsageBudget // per UTC day
+	Monthly UsageBudget // per UTC month
+}
+
+// UsageBudget limits a tenant's usage in a period; zero fields are unlimited
+type UsageBudget struct {
+	Executions      int
+	CPUSeconds      int
+	MemoryMBSeconds int
+}
+
+// ApprovalConfig holds the rules that hold a submission until an admin
+// approves or rejects it; zero fields match nothing
+type ApprovalConfig struct {
+	Network        bool     // scripts that run with network access
+	MemoryMB       int      // memory limits above this many MB
+	CPUShares      int      // CPU shares above this
+	DiskMB         int      // disk limits above this many MB
+	TimeoutSeconds int      // timeouts above this many seconds
+	Tenants        []string // every submission of these tenants
+}
+
+// RedactConfig holds the patterns masked in execution output and server
+// logs before they are stored
+type RedactConfig struct {
+	Builtin      bool   // mask common credential formats such as access keys and private keys
+	PatternsFile string // file of further regular expressions to mask, one per line
+}
+
+// SecretsConfig holds the backend of the named secrets executions ask for
+// in Metadata.Secrets
+type SecretsConfig struct {
+	Backend   string // SecretsEnv, SecretsConsul or SecretsVault
+	EnvPrefix string // SecretsEnv: the secret NAME is the variable {EnvPrefix}NAME
+	// SecretsVault: the secrets are the keys of the secret at VaultPath in
+	// the KV version 2 engine mounted at VaultMount
+	VaultAddr  string
+	VaultToken string
+	VaultMount string
+	VaultPath  string
+}
+
+// Secrets backends
+const (
+	// SecretsEnv reads secrets from the server's environment
+	SecretsEnv = "env"
+	// SecretsConsul reads them from Consul's KV store, under {prefix}/secrets/
+	SecretsConsul = "consul"
+	// SecretsVault reads them from a Vault KV version 2 secret
+	SecretsVault = "vault"
+)
+
+// RunnersConfig holds the settings of runner agents, which register with a
+// control-plane server over its API and run its executions on their own
+// hosts
+type RunnersConfig struct {
+	Token   string        // shared secret runners authenticate with; required by both sides
+	Timeout time.Duration // runners not heard from for this long are dropped and their executions fail
+	// ServerURL and Slots configure a runner agent: the control plane it
+	// registers with and the executions it runs at once
+	ServerURL string
+	Slots     int
+}
+
+// AuthConfig holds the API keys requests authenticate with. Without keys
+// the API is open to anyone who can reach it.
+type AuthConfig struct {
+	// Keys are name:scopes:key entries, the scopes joined by '+', e.g.
+	// "ci:run+kill:s3cret"
+	Keys []string
+	// KeysFile is a JSON file of further keys. Both are read into APIKeys
+	// at startup.
+	KeysFile string
+	APIKeys  []APIKey
+}
+
+// API key scopes. Any valid key may read; writes need a scope.
+const (
+	// ScopeRun submits executions, sessions, pipelines and uploads
+	ScopeRun = "run"
+	// ScopeKill kills, pauses and resumes executions, groups and pipelines
+	ScopeKill = "kill"
+	// ScopeAdmin manages templates, approvals, backups and usage, and
+	// implies the other scopes
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a key a client authenticates with and the scopes it grants.
+// Tenant is who the key's submissions are accounted to, the key's name if
+// empty. RequestsPerMinute and MaxConcurrent override the QuotaConfig
+// defaults for the key; 0 keeps them.
+type APIKey struct {
+	Name              string   `json:"-"`
+	Key               string   `json:"key"`
+	Scopes            []string `json:"scopes"`
+	Tenant            string   `json:"tenant,omitempty"`
+	RequestsPerMinute int      `json:"requests_per_minute,omitempty"`
+	MaxConcurrent     int      `json:"max_concurrent,omitempty"`
+}
+
+// TenantName returns the tenant the key's submissions are accounted to
+func (k APIKey) TenantName() string {
+	if k.Tenant != "" {
+		return k.Tenant
+	}
+	return k.Name
+}
+
+// HasScope reports whether the key grants scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAPIKey checks a key's name, secret and scopes
+func validateAPIKey(k APIKey) error {
+	if !presetNamePattern.MatchString(k.Name) {
+		return fmt.Errorf("invalid API key name %q: use up to 64 letters, digits, '.', '_' and '-'", k.Name)
+	}
+	if k.Key == "" {
+		return fmt.Errorf("API key %s: key is empty", k.Name)
+	}
+	if k.Tenant != "" && !presetNamePattern.MatchString(k.Tenant) {
+		return fmt.Errorf("API key %s: invalid tenant %q: use up to 64 letters, digits, '.', '_' and '-'", k.Name, k.Tenant)
+	}
+	if k.RequestsPerMinute < 0 || k.MaxConcurrent < 0 {
+		return fmt.Errorf("API key %s: quotas must not be negative", k.Name)
+	}
+	for _, s := range k.Scopes {
+		switch s {
+		case ScopeRun, ScopeKill, ScopeAdmin:
+		default:
+			return fmt.Errorf("API key %s: unknown scope %q: use %q, %q or %q", k.Name, s, ScopeRun, ScopeKill, ScopeAdmin)
+		}
+	}
+	return nil
+}
+
+// ParseAPIKeys parses name:scopes:key entries, e.g. "ci:run+kill:s3cret".
+// The key is everything after the second colon.
+func ParseAPIKeys(entries []string) ([]APIKey, error) {
+	keys := make([]APIKey, 0, len(entries))
+	for i, entry := range entries {
+		name, rest, ok1 := strings.Cut(entry, ":")
+		scopes, key, ok2 := strings.Cut(rest, ":")
+		if !ok1 || !ok2 {
+			// The entry may be a bare key, so it isn't quoted
+			return nil, fmt.Errorf("invalid API key entry %d: use name:scopes:key", i+1)
+		}
+		k := APIKey{Name: name, Key: key}
+		if scopes != "" {
+			k.Scopes = strings.Split(scopes, "+")
+		}
+		if err := validateAPIKey(k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// LoadAPIKeys reads an API keys file: a JSON object mapping each key's
+// name to the key and its scopes, e.g.
+// {"ci": {"key": "s3cret", "scopes": ["run", "kill"]}}
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+	var byName map[string]APIKey
+	if err := json.Unmarshal(data, &byName); err != nil {
+		return nil, fmt.Errorf("parsing API keys: %w", err)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keys := make([]APIKey, 0, len(names))
+	for _, name := range names {
+		k := byName[name]
+		k.Name = name
+		if err := validateAPIKey(k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// QuotaConfig holds the limits that keep one caller from saturating the
+// server. Callers are told apart by API key, or by address on servers
+// without keys.
+type QuotaConfig struct {
+	RequestsPerMinute       int // API requests of each caller; 0 means no limit
+	GlobalRequestsPerMinute int // API requests of all callers together; 0 means no limit
+	// MaxConcurrent bounds each caller's unfinished (pending or running)
+	// executions and open sessions; 0 means no limit. The server-wide
+	// bound is QueueConfig.MaxConcurrent.
+	MaxConcurrent int
+}
+
+// PoolConfig holds the warm container pool configuration
+type PoolConfig struct {
+	Size     int      // started containers kept waiting per image; 0 disables the pool
+	Images   []string // images the pool keeps containers of; empty means the default image
+	MaxReuse int      // executions one pooled container runs before it is replaced
+}
+
+// SnapshotConfig holds the persistence settings of in-memory storage,
+// used when Consul is not
+type SnapshotConfig struct {
+	// File is where the storage is saved, periodically and on shutdown,
+	// and reloaded from on start; empty keeps it in memory only
+	File     string
+	Interval time.Duration
 }
 
 // CleanupConfig holds cleanup configuration
@@ -57,35 +481,173 @@ type CleanupConfig struct {
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:     getEnv("PYEXEC_HOST", "0.0.0.0"),
-			Port:     getEnv("PYEXEC_PORT", "8080"),
-			LogLevel: getEnv("PYEXEC_LOG_LEVEL", "info"),
+			Host:             getEnv("PYEXEC_HOST", "0.0.0.0"),
+			Port:             getEnv("PYEXEC_PORT", "8080"),
+			LogLevel:         getEnv("PYEXEC_LOG_LEVEL", "info"),
+			ShutdownDrain:    time.Duration(getEnvInt("PYEXEC_SHUTDOWN_DRAIN", 300)) * time.Second,
+			NodeID:           getEnv("PYEXEC_NODE_ID", hostname()),
+			NodeLabels:       getEnvStringMap("PYEXEC_NODE_LABELS"),
+			NodeMemoryMB:     getEnvInt("PYEXEC_NODE_MEMORY_MB", 0),
+			PublicURL:        getEnv("PYEXEC_PUBLIC_URL", ""),
+			MaxInlineOutput:  getEnvInt("PYEXEC_MAX_INLINE_OUTPUT", 1<<20),
+			MaxExtractMB:     getEnvInt("PYEXEC_MAX_EXTRACT_MB", 1024),
+			MaxExtractFiles:  getEnvInt("PYEXEC_MAX_EXTRACT_FILES", 10000),
+			MaxExtractFileMB: getEnvInt("PYEXEC_MAX_EXTRACT_FILE_MB", 256),
+			SyncDisconnect:   getEnv("PYEXEC_SYNC_DISCONNECT", DisconnectKill),
+			SyncDetachAfter:  time.Duration(getEnvInt("PYEXEC_SYNC_DETACH_AFTER", 0)) * time.Second,
+			Executor:         getEnv("PYEXEC_EXECUTOR", ExecutorDocker),
+			TrustedProxies:   getEnvStringSlice("PYEXEC_TRUSTED_PROXIES", nil),
+			WebSocketOrigins: getEnvStringSlice("PYEXEC_WEBSOCKET_ORIGINS", nil),
 		},
 		Docker: DockerConfig{
-			Socket:      getEnv("PYEXEC_DOCKER_SOCKET", "/var/run/docker.sock"),
-			DNSServers:  getEnvStringSlice("PYEXEC_DNS_SERVERS", []string{"8.8.8.8", "8.8.4.4"}),
-			NetworkMode: getEnv("PYEXEC_NETWORK_MODE", "host"),
+			Socket:         getEnv("PYEXEC_DOCKER_SOCKET", ""),
+			DNSServers:     getEnvStringSlice("PYEXEC_DNS_SERVERS", []string{"8.8.8.8", "8.8.4.4"}),
+			NetworkMode:    getEnv("PYEXEC_NETWORK_MODE", "host"),
+			CertPath:       getEnv("PYEXEC_DOCKER_CERT_PATH", getEnv("DOCKER_CERT_PATH", "")),
+			TLSVerify:      getEnvBool("PYEXEC_DOCKER_TLS_VERIFY", true),
+			SELinuxType:    getEnv("PYEXEC_SELINUX_TYPE", ""),
+			SELinuxLevel:   getEnv("PYEXEC_SELINUX_LEVEL", ""),
+			SELinuxDisable: getEnvBool("PYEXEC_SELINUX_DISABLE", false),
+			BlkioDevices:   getEnvStringSlice("PYEXEC_BLKIO_DEVICES", nil),
+			Checkpoints:    getEnvBool("PYEXEC_CHECKPOINTS", false),
+			FakeTimeLib:    getEnv("PYEXEC_FAKETIME_LIB", "/usr/lib/x86_64-linux-gnu/faketime/libfaketime.so.1"),
+
+			DiskCheckInterval: time.Duration(getEnvInt("PYEXEC_DISK_CHECK_INTERVAL", 15)) * time.Second,
+		},
+		Egress: EgressConfig{
+			ProxyAddr: getEnv("PYEXEC_EGRESS_PROXY_ADDR", ""),
+			ProxyURL:  getEnv("PYEXEC_EGRESS_PROXY_URL", ""),
+			Kbps:      getEnvInt("PYEXEC_EGRESS_KBPS", 0),
 		},
 		Defaults: DefaultsConfig{
-			Timeout:           getEnvInt("PYEXEC_DEFAULT_TIMEOUT", 300),
-			MemoryMB:          getEnvInt("PYEXEC_DEFAULT_MEMORY_MB", 1024),
-			DiskMB:            getEnvInt("PYEXEC_DEFAULT_DISK_MB", 2048),
-			CPUShares:         getEnvInt("PYEXEC_DEFAULT_CPU_SHARES", 1024),
-			DockerImage:       getEnv("PYEXEC_DEFAULT_IMAGE", "python:3.12-slim"),
-			AutoDetectImports: getEnvBool("PYEXEC_AUTO_DETECT_IMPORTS", true),
+			Timeout:            getEnvInt("PYEXEC_DEFAULT_TIMEOUT", 300),
+			PullTimeout:        getEnvInt("PYEXEC_PULL_TIMEOUT", 600),
+			InstallTimeout:     getEnvInt("PYEXEC_INSTALL_TIMEOUT", 600),
+			MemoryMB:           getEnvInt("PYEXEC_DEFAULT_MEMORY_MB", 1024),
+			DiskMB:             getEnvInt("PYEXEC_DEFAULT_DISK_MB", 2048),
+			CPUShares:          getEnvInt("PYEXEC_DEFAULT_CPU_SHARES", 1024),
+			BlkioWeight:        uint16(getEnvInt("PYEXEC_DEFAULT_BLKIO_WEIGHT", 0)),
+			DiskReadBps:        int64(getEnvInt("PYEXEC_DEFAULT_DISK_READ_BPS", 0)),
+			DiskWriteBps:       int64(getEnvInt("PYEXEC_DEFAULT_DISK_WRITE_BPS", 0)),
+			DockerImage:        getEnv("PYEXEC_DEFAULT_IMAGE", "python:3.12-slim"),
+			AutoDetectImports:  getEnvBool("PYEXEC_AUTO_DETECT_IMPORTS", true),
+			InstallNetworkOnly: getEnvBool("PYEXEC_INSTALL_NETWORK_ONLY", false),
+			InstallMemoryMB:    getEnvInt("PYEXEC_INSTALL_MEMORY_MB", 0),
+			InstallCPUShares:   getEnvInt("PYEXEC_INSTALL_CPU_SHARES", 0),
+			StripANSI:          getEnvBool("PYEXEC_STRIP_ANSI", false),
+			ResolveVersions:    getEnvBool("PYEXEC_RESOLVE_VERSIONS", false),
+			PyPIURL:            getEnv("PYEXEC_PYPI_URL", "https://pypi.org/pypi"),
+			ResolveCacheTTL:    time.Duration(getEnvInt("PYEXEC_RESOLVE_CACHE_TTL", 86400)) * time.Second,
+			MaxRetries:         getEnvInt("PYEXEC_MAX_RETRIES", 5),
+			PresetsFile:        getEnv("PYEXEC_PRESETS_FILE", ""),
 		},
 		Consul: ConsulConfig{
 			Address:   getEnv("PYEXEC_CONSUL_ADDR", "localhost:8500"),
 			Token:     getEnv("PYEXEC_CONSUL_TOKEN", ""),
 			KeyPrefix: getEnv("PYEXEC_CONSUL_PREFIX", "python-executor"),
 			Enabled:   getEnv("PYEXEC_CONSUL_ADDR", "") != "",
+			Timeout:   time.Duration(getEnvInt("PYEXEC_CONSUL_TIMEOUT", 5)) * time.Second,
+			Retries:   getEnvInt("PYEXEC_CONSUL_RETRIES", 2),
+
+			BreakerThreshold: getEnvInt("PYEXEC_CONSUL_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  time.Duration(getEnvInt("PYEXEC_CONSUL_BREAKER_COOLDOWN", 30)) * time.Second,
+		},
+		Snapshot: SnapshotConfig{
+			File:     getEnv("PYEXEC_SNAPSHOT_FILE", ""),
+			Interval: time.Duration(getEnvInt("PYEXEC_SNAPSHOT_INTERVAL", 60)) * time.Second,
 		},
 		Cleanup: CleanupConfig{
 			TTL: time.Duration(getEnvInt("PYEXEC_CLEANUP_TTL", 300)) * time.Second,
 		},
+		Queue: QueueConfig{
+			Workers:        getEnvInt("PYEXEC_ASYNC_WORKERS", 8),
+			MaxConcurrent:  getEnvInt("PYEXEC_MAX_CONCURRENT", 0),
+			OverloadPolicy: getEnv("PYEXEC_OVERLOAD_POLICY", OverloadQueue),
+			MaxWaiting:     getEnvInt("PYEXEC_MAX_WAITING", 100),
+			MaxLength:      getEnvInt("PYEXEC_MAX_QUEUE_LENGTH", 0),
+		},
+		Upload: UploadConfig{
+			Dir:           getEnv("PYEXEC_UPLOAD_DIR", filepath.Join(os.TempDir(), "python-executor-uploads")),
+			MaxMB:         getEnvInt("PYEXEC_MAX_UPLOAD_MB", 4096),
+			TTL:           time.Duration(getEnvInt("PYEXEC_UPLOAD_TTL", 86400)) * time.Second,
+			CacheArchives: getEnvBool("PYEXEC_ARCHIVE_CACHE", true),
+		},
+		Session: SessionConfig{
+			Max:            getEnvInt("PYEXEC_MAX_SESSIONS", 16),
+			IdleTimeout:    time.Duration(getEnvInt("PYEXEC_SESSION_IDLE_TIMEOUT", 600)) * time.Second,
+			MaxIdleTimeout: time.Duration(getEnvInt("PYEXEC_SESSION_MAX_IDLE_TIMEOUT", 3600)) * time.Second,
+		},
+		Pool: PoolConfig{
+			Size:     getEnvInt("PYEXEC_WARM_POOL_SIZE", 0),
+			Images:   getEnvStringSlice("PYEXEC_WARM_POOL_IMAGES", nil),
+			MaxReuse: getEnvInt("PYEXEC_WARM_POOL_MAX_REUSE", 1),
+		},
+		Events: EventsConfig{
+			NATSURL:      getEnv("PYEXEC_EVENTS_NATS_URL", ""),
+			NATSSubject:  getEnv("PYEXEC_EVENTS_NATS_SUBJECT", "pyexec.executions"),
+			KafkaRESTURL: getEnv("PYEXEC_EVENTS_KAFKA_REST_URL", ""),
+			KafkaTopic:   getEnv("PYEXEC_EVENTS_KAFKA_TOPIC", "pyexec-executions"),
+			Buffer:       getEnvInt("PYEXEC_EVENTS_BUFFER", 1000),
+		},
+		Usage: UsageConfig{
+			Daily: UsageBudget{
+				Executions:      getEnvInt("PYEXEC_BUDGET_DAILY_EXECUTIONS", 0),
+				CPUSeconds:      getEnvInt("PYEXEC_BUDGET_DAILY_CPU_SECONDS", 0),
+				MemoryMBSeconds: getEnvInt("PYEXEC_BUDGET_DAILY_MEMORY_MB_SECONDS", 0),
+			},
+			Monthly: UsageBudget{
+				Executions:      getEnvInt("PYEXEC_BUDGET_MONTHLY_EXECUTIONS", 0),
+				CPUSeconds:      getEnvInt("PYEXEC_BUDGET_MONTHLY_CPU_SECONDS", 0),
+				MemoryMBSeconds: getEnvInt("PYEXEC_BUDGET_MONTHLY_MEMORY_MB_SECONDS", 0),
+			},
+		},
+		Approval: ApprovalConfig{
+			Network:        getEnvBool("PYEXEC_APPROVAL_NETWORK", false),
+			MemoryMB:       getEnvInt("PYEXEC_APPROVAL_MEMORY_MB", 0),
+			CPUShares:      getEnvInt("PYEXEC_APPROVAL_CPU_SHARES", 0),
+			DiskMB:         getEnvInt("PYEXEC_APPROVAL_DISK_MB", 0),
+			TimeoutSeconds: getEnvInt("PYEXEC_APPROVAL_TIMEOUT", 0),
+			Tenants:        getEnvStringSlice("PYEXEC_APPROVAL_TENANTS", nil),
+		},
+		Redact: RedactConfig{
+			Builtin:      getEnvBool("PYEXEC_REDACT_BUILTIN", true),
+			PatternsFile: getEnv("PYEXEC_REDACT_PATTERNS_FILE", ""),
+		},
+		Secrets: SecretsConfig{
+			Backend:    getEnv("PYEXEC_SECRETS_BACKEND", SecretsEnv),
+			EnvPrefix:  getEnv("PYEXEC_SECRETS_ENV_PREFIX", "PYEXEC_SECRET_"),
+			VaultAddr:  getEnv("PYEXEC_VAULT_ADDR", getEnv("VAULT_ADDR", "")),
+			VaultToken: getEnv("PYEXEC_VAULT_TOKEN", getEnv("VAULT_TOKEN", "")),
+			VaultMount: getEnv("PYEXEC_VAULT_MOUNT", "secret"),
+			VaultPath:  getEnv("PYEXEC_VAULT_PATH", "python-executor"),
+		},
+		Auth: AuthConfig{
+			Keys:     getEnvStringSlice("PYEXEC_API_KEYS", nil),
+			KeysFile: getEnv("PYEXEC_API_KEYS_FILE", ""),
+		},
+		Quota: QuotaConfig{
+			RequestsPerMinute:       getEnvInt("PYEXEC_RATE_LIMIT", 0),
+			GlobalRequestsPerMinute: getEnvInt("PYEXEC_GLOBAL_RATE_LIMIT", 0),
+			MaxConcurrent:           getEnvInt("PYEXEC_KEY_MAX_CONCURRENT", 0),
+		},
+		Runners: RunnersConfig{
+			Token:     getEnv("PYEXEC_RUNNER_TOKEN", ""),
+			Timeout:   time.Duration(getEnvInt("PYEXEC_RUNNER_TIMEOUT", 60)) * time.Second,
+			ServerURL: getEnv("PYEXEC_RUNNER_SERVER", ""),
+			Slots:     getEnvInt("PYEXEC_RUNNER_SLOTS", 4),
+		},
 	}
 }
 
+// hostname returns the machine hostname, used as the default node ID
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "python-executor"
+	}
+	return name
+}
+
 // getEnv retrieves an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -121,6 +683,19 @@ func getEnvStringSlice(key string, defaultValue []string) []string {
 	return defaultValue
 }
 
+// getEnvStringMap retrieves an environment variable as comma-separated
+// key=value pairs, e.g. "gpu=true,zone=a". A key without a value maps to "".
+func getEnvStringMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range getEnvStringSlice(key, nil) {
+		k, v, _ := strings.Cut(pair, "=")
+		if k = strings.TrimSpace(k); k != "" {
+			result[k] = strings.TrimSpace(v)
+		}
+	}
+	return result
+}
+
 // getEnvBool retrieves an environment variable as bool or returns a default value
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -90,6 +92,49 @@ func TestLoad_DNSServers(t *testing.T) {
 	}
 }
 
+func TestLoad_Pool(t *testing.T) {
+	for _, key := range []string{"PYEXEC_WARM_POOL_SIZE", "PYEXEC_WARM_POOL_IMAGES", "PYEXEC_WARM_POOL_MAX_REUSE"} {
+		os.Unsetenv(key)
+		defer os.Unsetenv(key)
+	}
+
+	// The pool is off, and containers single-use, by default
+	cfg := Load()
+	if cfg.Pool.Size != 0 || cfg.Pool.Images != nil || cfg.Pool.MaxReuse != 1 {
+		t.Errorf("Default Pool = %+v", cfg.Pool)
+	}
+
+	os.Setenv("PYEXEC_WARM_POOL_SIZE", "4")
+	os.Setenv("PYEXEC_WARM_POOL_IMAGES", "python:3.12-slim,python:3.11-slim")
+	os.Setenv("PYEXEC_WARM_POOL_MAX_REUSE", "10")
+	cfg = Load()
+	want := PoolConfig{Size: 4, Images: []string{"python:3.12-slim", "python:3.11-slim"}, MaxReuse: 10}
+	if !reflect.DeepEqual(cfg.Pool, want) {
+		t.Errorf("Custom Pool = %+v, want %+v", cfg.Pool, want)
+	}
+}
+
+func TestLoad_Quota(t *testing.T) {
+	keys := []string{"PYEXEC_RATE_LIMIT", "PYEXEC_GLOBAL_RATE_LIMIT", "PYEXEC_KEY_MAX_CONCURRENT"}
+	for _, key := range keys {
+		os.Unsetenv(key)
+		defer os.Unsetenv(key)
+	}
+
+	// Callers aren't limited by default
+	if cfg := Load(); cfg.Quota != (QuotaConfig{}) {
+		t.Errorf("Default Quota = %+v", cfg.Quota)
+	}
+
+	os.Setenv("PYEXEC_RATE_LIMIT", "120")
+	os.Setenv("PYEXEC_GLOBAL_RATE_LIMIT", "6000")
+	os.Setenv("PYEXEC_KEY_MAX_CONCURRENT", "4")
+	want := QuotaConfig{RequestsPerMinute: 120, GlobalRequestsPerMinute: 6000, MaxConcurrent: 4}
+	if cfg := Load(); cfg.Quota != want {
+		t.Errorf("Custom Quota = %+v, want %+v", cfg.Quota, want)
+	}
+}
+
 func TestLoad_NetworkMode(t *testing.T) {
 	// Clean up any existing env vars
 	os.Unsetenv("PYEXEC_NETWORK_MODE")
@@ -108,3 +153,118 @@ func TestLoad_NetworkMode(t *testing.T) {
 		t.Errorf("Custom NetworkMode = %q, want %q", cfg.Docker.NetworkMode, "bridge")
 	}
 }
+
+func TestLoadPresets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "presets.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	presets, err := LoadPresets(write(`{
+		"small": {"memory_mb": 512, "cpu_shares": 512, "timeout_seconds": 60},
+		"gpu-large": {"docker_image": "pytorch/pytorch:latest", "memory_mb": 32768, "disk_mb": 51200}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Preset{
+		"small":     {MemoryMB: 512, CPUShares: 512, TimeoutSeconds: 60},
+		"gpu-large": {DockerImage: "pytorch/pytorch:latest", MemoryMB: 32768, DiskMB: 51200},
+	}
+	if !reflect.DeepEqual(presets, want) {
+		t.Errorf("LoadPresets() = %+v, want %+v", presets, want)
+	}
+
+	for _, content := range []string{
+		`not json`,
+		`{"bad name": {}}`,
+		`{"small": {"memory_mb": -1}}`,
+	} {
+		if _, err := LoadPresets(write(content)); err == nil {
+			t.Errorf("LoadPresets(%s) = nil error", content)
+		}
+	}
+	if _, err := LoadPresets(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("LoadPresets() of a missing file = nil error")
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys([]string{"ci:run+kill:s3cret:with:colons", "ops:admin:k2", "reader::k3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKey{
+		{Name: "ci", Key: "s3cret:with:colons", Scopes: []string{"run", "kill"}},
+		{Name: "ops", Key: "k2", Scopes: []string{"admin"}},
+		{Name: "reader", Key: "k3"},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("ParseAPIKeys() = %+v, want %+v", keys, want)
+	}
+
+	for _, entry := range []string{"s3cret", "ci:run", "ci:deploy:k", "bad name:run:k", "ci:run:"} {
+		_, err := ParseAPIKeys([]string{entry})
+		if err == nil {
+			t.Errorf("ParseAPIKeys(%q) = nil error", entry)
+		} else if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("ParseAPIKeys(%q) error %q shows the key", entry, err)
+		}
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "keys.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	keys, err := LoadAPIKeys(write(`{
+		"ops": {"key": "k2", "scopes": ["admin"]},
+		"ci": {"key": "k1", "scopes": ["run", "kill"], "tenant": "platform", "requests_per_minute": 600, "max_concurrent": 20}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKey{
+		{Name: "ci", Key: "k1", Scopes: []string{"run", "kill"}, Tenant: "platform", RequestsPerMinute: 600, MaxConcurrent: 20},
+		{Name: "ops", Key: "k2", Scopes: []string{"admin"}},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("LoadAPIKeys() = %+v, want %+v", keys, want)
+	}
+
+	for _, content := range []string{
+		`not json`,
+		`{"ci": {"scopes": ["run"]}}`,
+		`{"ci": {"key": "k1", "scopes": ["deploy"]}}`,
+		`{"ci": {"key": "k1", "max_concurrent": -1}}`,
+		`{"ci": {"key": "k1", "tenant": "team a"}}`,
+	} {
+		if _, err := LoadAPIKeys(write(content)); err == nil {
+			t.Errorf("LoadAPIKeys(%s) = nil error", content)
+		}
+	}
+}
+
+func TestAPIKey_HasScope(t *testing.T) {
+	run := APIKey{Scopes: []string{ScopeRun}}
+	admin := APIKey{Scopes: []string{ScopeAdmin}}
+	if !run.HasScope(ScopeRun) || run.HasScope(ScopeKill) || run.HasScope(ScopeAdmin) {
+		t.Errorf("run key scopes wrong")
+	}
+	if !admin.HasScope(ScopeRun) || !admin.HasScope(ScopeKill) || !admin.HasScope(ScopeAdmin) {
+		t.Errorf("admin key does not imply every scope")
+	}
+	if (APIKey{}).HasScope(ScopeRun) {
+		t.Errorf("key without scopes has run")
+	}
+}
@@ -0,0 +1,345 @@
+// Package egress provides a forward HTTP proxy that execution containers
+// send their network traffic through, so that each execution's bandwidth
+// can be limited.
+//
+// Each execution registers with the proxy for the duration of its run and
+// is given credentials for its proxy URL. All the connections made with
+// those credentials share one rate limit, in both directions together.
+package egress
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// chunkSize is the most a connection copies before waiting on its
+// execution's limiter; it is also the limiter's burst
+const chunkSize = 32 * 1024
+
+// dialTimeout bounds connecting to the destination of a request
+const dialTimeout = 30 * time.Second
+
+// hopHeaders are the hop-by-hop headers a proxy does not forward
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is a forward HTTP proxy, tunnelling HTTPS with CONNECT, that only
+// serves registered executions and limits the bandwidth of each
+type Proxy struct {
+	mu         sync.Mutex
+	executions map[string]*execution
+
+	transport *http.Transport
+	dialer    *net.Dialer
+}
+
+// execution is a registered execution's limiter and open connections.
+// ctx ends when the execution is released.
+type execution struct {
+	token   string
+	limiter *rate.Limiter // nil for no limit
+	ctx     context.Context
+	cancel  context.CancelFunc
+	conns   map[net.Conn]struct{}
+	closed  bool
+}
+
+// NewProxy creates a proxy with no executions registered
+func NewProxy() *Proxy {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	return &Proxy{
+		executions: make(map[string]*execution),
+		dialer:     dialer,
+		transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// ProxyURL returns the URL execution containers reach a proxy listening
+// on addr at: proxyURL if set, or else http://127.0.0.1 with addr's port,
+// which suits containers on the host's network
+func ProxyURL(addr, proxyURL string) (*url.URL, error) {
+	if proxyURL == "" {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("proxy address %q: %w", addr, err)
+		}
+		proxyURL = "http://" + net.JoinHostPort("127.0.0.1", port)
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy URL: %w", err)
+	}
+	if u.Scheme != "http" || u.Host == "" {
+		return nil, fmt.Errorf("proxy URL %q must be an http:// URL", proxyURL)
+	}
+	return u, nil
+}
+
+// Register lets an execution use the proxy, at up to kbps kilobits per
+// second (0 for no limit), until release is called. It returns the
+// execution's proxy URL, base with the execution's credentials added.
+// release closes the connections the execution still has open.
+func (p *Proxy) Register(id string, kbps int, base *url.URL) (proxyURL string, release func()) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	e := &execution{
+		token: hex.EncodeToString(b),
+		conns: make(map[net.Conn]struct{}),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+	if kbps > 0 {
+		bytesPerSecond := kbps * 1000 / 8
+		e.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), max(bytesPerSecond, chunkSize))
+	}
+
+	p.mu.Lock()
+	p.executions[id] = e
+	p.mu.Unlock()
+
+	u := *base
+	u.User = url.UserPassword(id, e.token)
+	return u.String(), func() { p.release(id, e) }
+}
+
+// release forgets an execution and closes its connections
+func (p *Proxy) release(id string, e *execution) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.executions[id] == e {
+		delete(p.executions, id)
+	}
+	e.closed = true
+	e.cancel()
+	for conn := range e.conns {
+		conn.Close()
+	}
+	e.conns = nil
+}
+
+// authenticate returns the execution whose credentials a request carries
+func (p *Proxy) authenticate(r *http.Request) *execution {
+	id, token, ok := proxyAuth(r.Header.Get("Proxy-Authorization"))
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	e := p.executions[id]
+	if e == nil || subtle.ConstantTimeCompare([]byte(token), []byte(e.token)) != 1 {
+		return nil
+	}
+	return e
+}
+
+// track adds a connection to an execution's open connections, reporting
+// false (and closing it) if the execution has been released
+func (p *Proxy) track(e *execution, conn net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e.closed {
+		conn.Close()
+		return false
+	}
+	e.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack removes a closed connection from an execution's open ones
+func (p *Proxy) untrack(e *execution, conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(e.conns, conn)
+}
+
+// proxyAuth parses a Basic Proxy-Authorization header
+func proxyAuth(header string) (user, password string, ok bool) {
+	encoded, found := strings.CutPrefix(header, "Basic ")
+	if !found {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
+}
+
+// ServeHTTP proxies a request of a registered execution
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e := p.authenticate(r)
+	if e == nil {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="python-executor"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, e)
+		return
+	}
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "only absolute http:// URLs and CONNECT are proxied", http.StatusBadRequest)
+		return
+	}
+	p.forward(w, r, e)
+}
+
+// tunnel connects a CONNECT request to its destination and copies both
+// ways until either side closes
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request, e *execution) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+
+	dest, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !p.track(e, dest) {
+		http.Error(w, "execution finished", http.StatusForbidden)
+		return
+	}
+	defer p.untrack(e, dest)
+	defer dest.Close()
+
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	if !p.track(e, conn) {
+		return
+	}
+	defer p.untrack(e, conn)
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		e.copy(dest, buffered.Reader)
+		closeWrite(dest)
+		done <- struct{}{}
+	}()
+	go func() {
+		e.copy(conn, dest)
+		closeWrite(conn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// closeWrite tells the other end of a connection that no more data comes,
+// where the connection supports it
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
+
+// forward sends a plain HTTP request on to its destination and copies the
+// response back
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request, e *execution) {
+	// The request ends with the execution
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	defer context.AfterFunc(e.ctx, cancel)()
+
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	if r.Body != nil {
+		out.Body = io.NopCloser(&limitedReader{r: r.Body, e: e})
+	}
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+	e.copy(w, resp.Body)
+}
+
+// removeHopHeaders deletes the hop-by-hop headers, including those the
+// Connection header names
+func removeHopHeaders(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			h.Del(strings.TrimSpace(name))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// copy copies src to dst within the execution's bandwidth
+func (e *execution) copy(dst io.Writer, src io.Reader) {
+	io.Copy(dst, &limitedReader{r: src, e: e})
+}
+
+// limitedReader reads no faster than its execution's limiter allows, and
+// not at all once the execution is released
+type limitedReader struct {
+	r io.Reader
+	e *execution
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if len(b) > chunkSize {
+		b = b[:chunkSize]
+	}
+	n, err := l.r.Read(b)
+	if n > 0 && l.e.limiter != nil {
+		if werr := l.e.limiter.WaitN(l.e.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,125 @@
+package egress
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startProxy serves a new proxy and returns it with its base URL
+func startProxy(t *testing.T) (*Proxy, *url.URL) {
+	t.Helper()
+	p := NewProxy()
+	ts := httptest.NewServer(p)
+	t.Cleanup(ts.Close)
+	base, _ := url.Parse(ts.URL)
+	return p, base
+}
+
+// clientVia returns an HTTP client that sends everything through proxyURL
+// and trusts the TLS test server ts
+func clientVia(t *testing.T, proxyURL string, ts *httptest.Server) *http.Client {
+	t.Helper()
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(u)}
+	if ts != nil && ts.TLS != nil {
+		transport.TLSClientConfig = ts.Client().Transport.(*http.Transport).TLSClientConfig
+	}
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+func TestProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Error("proxy credentials were forwarded")
+		}
+		io.WriteString(w, "plain")
+	}))
+	defer backend.Close()
+	tlsBackend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tunnelled")
+	}))
+	defer tlsBackend.Close()
+
+	p, base := startProxy(t)
+	proxyURL, release := p.Register("exe_1", 0, base)
+
+	get := func(c *http.Client, target string) (int, string) {
+		t.Helper()
+		resp, err := c.Get(target)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, body := get(clientVia(t, proxyURL, nil), backend.URL); code != http.StatusOK || body != "plain" {
+		t.Errorf("plain HTTP = %d %q", code, body)
+	}
+	if code, body := get(clientVia(t, proxyURL, tlsBackend), tlsBackend.URL); code != http.StatusOK || body != "tunnelled" {
+		t.Errorf("HTTPS = %d %q", code, body)
+	}
+
+	// Only registered executions with their own token are served
+	if code, _ := get(clientVia(t, base.String(), nil), backend.URL); code != http.StatusProxyAuthRequired {
+		t.Errorf("without credentials: status = %d, want 407", code)
+	}
+	wrong := *base
+	wrong.User = url.UserPassword("exe_1", "guess")
+	if code, _ := get(clientVia(t, wrong.String(), nil), backend.URL); code != http.StatusProxyAuthRequired {
+		t.Errorf("wrong token: status = %d, want 407", code)
+	}
+	release()
+	if code, _ := get(clientVia(t, proxyURL, nil), backend.URL); code != http.StatusProxyAuthRequired {
+		t.Errorf("after release: status = %d, want 407", code)
+	}
+}
+
+func TestProxyBandwidth(t *testing.T) {
+	payload := strings.Repeat("x", 500*1000)
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, payload)
+	}))
+	defer backend.Close()
+
+	// 2000 kbps is 250 kB/s: after the first second's burst, the rest of
+	// the payload takes about another second
+	p, base := startProxy(t)
+	proxyURL, release := p.Register("exe_1", 2000, base)
+	defer release()
+
+	start := time.Now()
+	resp, err := clientVia(t, proxyURL, backend).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) != len(payload) {
+		t.Fatalf("read %d bytes, want %d", len(body), len(payload))
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("transfer took %v, want the bandwidth limit to slow it", elapsed)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	if u, err := ProxyURL(":3128", ""); err != nil || u.String() != "http://127.0.0.1:3128" {
+		t.Errorf("ProxyURL(:3128) = %v, %v", u, err)
+	}
+	if u, err := ProxyURL(":3128", "http://172.17.0.1:3128"); err != nil || u.Host != "172.17.0.1:3128" {
+		t.Errorf("ProxyURL with a URL = %v, %v", u, err)
+	}
+	if _, err := ProxyURL(":3128", "https://proxy:3128"); err == nil {
+		t.Error("an https:// proxy URL was accepted")
+	}
+}
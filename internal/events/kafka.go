@@ -0,0 +1,85 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// kafkaJSONContentType is the REST Proxy v2 content type for JSON records
+const kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaRESTSink publishes events to a Kafka topic through a Confluent REST
+// Proxy (or a compatible gateway). Each event is a JSON record keyed by its
+// execution ID, so an execution's events stay in order on one partition.
+type KafkaRESTSink struct {
+	endpoint   string
+	httpClient *http.Client
+}
+
+// kafkaRecords is a REST Proxy produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string                 `json:"key"`
+	Value *client.ExecutionEvent `json:"value"`
+}
+
+// NewKafkaRESTSink creates a sink producing to topic through the REST
+// Proxy at baseURL, e.g. http://kafka-rest:8082
+func NewKafkaRESTSink(baseURL, topic string) (*KafkaRESTSink, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL %q", baseURL)
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("no Kafka topic")
+	}
+	return &KafkaRESTSink{
+		endpoint:   strings.TrimSuffix(baseURL, "/") + "/topics/" + url.PathEscape(topic),
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// Send produces an event as one record
+func (s *KafkaRESTSink) Send(ctx context.Context, ev *client.ExecutionEvent) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: ev.ExecutionID, Value: ev}}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaJSONContentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Kafka REST Proxy returned %d: %s", resp.StatusCode, respBody)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close releases idle connections
+func (s *KafkaRESTSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestKafkaRESTSink(t *testing.T) {
+	var got struct {
+		Records []struct {
+			Key   string                `json:"key"`
+			Value client.ExecutionEvent `json:"value"`
+		} `json:"records"`
+	}
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/pyexec-executions" || r.Header.Get("Content-Type") != kafkaJSONContentType {
+			t.Errorf("request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if fail {
+			http.Error(w, `{"error_code":40401,"message":"Topic not found"}`, http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer srv.Close()
+
+	sink, err := NewKafkaRESTSink(srv.URL+"/", "pyexec-executions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ev := &client.ExecutionEvent{Type: client.EventSubmitted, ExecutionID: "exe_1", GroupID: "batch", Status: client.StatusPending}
+	if err := sink.Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 || got.Records[0].Key != "exe_1" || got.Records[0].Value.GroupID != "batch" {
+		t.Errorf("records = %+v", got.Records)
+	}
+
+	fail = true
+	if err := sink.Send(context.Background(), ev); err == nil {
+		t.Error("Send() = nil error for a 404")
+	}
+
+	if _, err := NewKafkaRESTSink("kafka:9092", "t"); err == nil {
+		t.Error("NewKafkaRESTSink() accepted a URL without a scheme")
+	}
+}
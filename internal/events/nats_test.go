@@ -0,0 +1,138 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// natsMessage is a message received by fakeNATS
+type natsMessage struct {
+	subject string
+	payload []byte
+}
+
+// fakeNATS serves the core NATS protocol on a local port, recording the
+// CONNECT options and published messages of each connection
+func fakeNATS(t *testing.T) (addr string, connects chan string, msgs chan natsMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	connects = make(chan string, 10)
+	msgs = make(chan natsMessage, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte(`INFO {"server_id":"fake","max_payload":1048576}` + "\r\n"))
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					line = strings.TrimSpace(line)
+					switch {
+					case strings.HasPrefix(line, "CONNECT "):
+						connects <- strings.TrimPrefix(line, "CONNECT ")
+					case line == "PING":
+						conn.Write([]byte("PONG\r\n"))
+					case strings.HasPrefix(line, "PUB "):
+						fields := strings.Fields(line)
+						n, _ := strconv.Atoi(fields[len(fields)-1])
+						payload := make([]byte, n+2)
+						if _, err := io.ReadFull(r, payload); err != nil {
+							return
+						}
+						msgs <- natsMessage{subject: fields[1], payload: payload[:n]}
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), connects, msgs
+}
+
+func TestNATSSink(t *testing.T) {
+	addr, connects, msgs := fakeNATS(t)
+
+	sink, err := NewNATSSink("nats://alice:secret@"+addr, "pyexec.executions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ev := &client.ExecutionEvent{Type: client.EventCompleted, ExecutionID: "exe_1", Status: client.StatusCompleted,
+		Summary: &client.EventSummary{ExitCode: 0, DurationMs: 12}}
+	if err := sink.Send(ctx, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	var opts map[string]any
+	json.Unmarshal([]byte(<-connects), &opts)
+	if opts["user"] != "alice" || opts["pass"] != "secret" || opts["verbose"] != false {
+		t.Errorf("CONNECT options = %v", opts)
+	}
+
+	msg := <-msgs
+	var got client.ExecutionEvent
+	json.Unmarshal(msg.payload, &got)
+	if msg.subject != "pyexec.executions.completed" || got.ExecutionID != "exe_1" || got.Summary.DurationMs != 12 {
+		t.Errorf("published %s %s", msg.subject, msg.payload)
+	}
+
+	// A dropped connection is reopened on the next event
+	sink.mu.Lock()
+	sink.conn.Close()
+	sink.mu.Unlock()
+	if err := sink.Send(ctx, &client.ExecutionEvent{Type: client.EventStarted, ExecutionID: "exe_2"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg = <-msgs:
+		if msg.subject != "pyexec.executions.started" {
+			t.Errorf("subject = %q", msg.subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message after reconnecting")
+	}
+}
+
+func TestNewNATSSink(t *testing.T) {
+	sink, err := NewNATSSink("nats://tok3n@nats.internal", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.addr != "nats.internal:4222" || !strings.Contains(string(sink.connect), `"auth_token":"tok3n"`) {
+		t.Errorf("sink = %s %s", sink.addr, sink.connect)
+	}
+
+	for _, tc := range []struct{ url, subject string }{
+		{"tcp://nats:4222", "events"},
+		{"nats://", "events"},
+		{"nats://nats:4222", ""},
+		{"nats://nats:4222", "events.>"},
+	} {
+		if _, err := NewNATSSink(tc.url, tc.subject); err == nil {
+			t.Errorf("NewNATSSink(%q, %q) = nil error", tc.url, tc.subject)
+		}
+	}
+}
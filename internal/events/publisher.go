@@ -0,0 +1,148 @@
+// Package events publishes execution lifecycle events to message brokers.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// sendTimeout bounds the delivery of one event to one sink
+const sendTimeout = 5 * time.Second
+
+// Sink delivers events to one broker
+type Sink interface {
+	// Send delivers an event
+	Send(ctx context.Context, ev *client.ExecutionEvent) error
+
+	// Close releases the sink's connections
+	Close() error
+}
+
+// Publisher delivers events to its sinks in the background, so a slow or
+// unreachable broker never holds up an execution. Events published while
+// its buffer is full are dropped. A nil Publisher drops every event.
+type Publisher struct {
+	sinks   []Sink
+	events  chan *client.ExecutionEvent
+	onError func(error)
+	done    chan struct{}
+
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+// NewPublisher starts a publisher holding up to buffer undelivered events.
+// onError, if not nil, is called with each delivery failure.
+func NewPublisher(sinks []Sink, buffer int, onError func(error)) *Publisher {
+	p := &Publisher{
+		sinks:   sinks,
+		events:  make(chan *client.ExecutionEvent, buffer),
+		onError: onError,
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// New creates a publisher for the brokers cfg configures, or returns nil
+// if it configures none.
+func New(cfg config.EventsConfig, onError func(error)) (*Publisher, error) {
+	var sinks []Sink
+	if cfg.NATSURL != "" {
+		sink, err := NewNATSSink(cfg.NATSURL, cfg.NATSSubject)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if cfg.KafkaRESTURL != "" {
+		sink, err := NewKafkaRESTSink(cfg.KafkaRESTURL, cfg.KafkaTopic)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	return NewPublisher(sinks, cfg.Buffer, onError), nil
+}
+
+// Publish queues an event for delivery without waiting for it
+func (p *Publisher) Publish(ev *client.ExecutionEvent) {
+	if p == nil {
+		return
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return
+	}
+	select {
+	case p.events <- ev:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events dropped because the buffer was
+// full or the publisher closed
+func (p *Publisher) Dropped() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.dropped.Load()
+}
+
+// Close stops accepting events, delivers those already queued until ctx
+// ends, and closes the sinks
+func (p *Publisher) Close(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	p.mu.Unlock()
+
+	var err error
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%d events not delivered: %w", len(p.events), ctx.Err())
+	}
+
+	for _, sink := range p.sinks {
+		err = errors.Join(err, sink.Close())
+	}
+	return err
+}
+
+// run delivers queued events until the publisher closes
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	for ev := range p.events {
+		for _, sink := range p.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			err := sink.Send(ctx, ev)
+			cancel()
+			if err != nil && p.onError != nil {
+				p.onError(fmt.Errorf("publishing %s event for %s: %w", ev.Type, ev.ExecutionID, err))
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// recordSink records the events it is sent, failing while err is set
+type recordSink struct {
+	mu     sync.Mutex
+	events []*client.ExecutionEvent
+	err    error
+	block  chan struct{}
+	closed bool
+}
+
+func (r *recordSink) Send(ctx context.Context, ev *client.ExecutionEvent) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recordSink) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	sink := &recordSink{}
+	var errs []error
+	p := NewPublisher([]Sink{sink}, 10, func(err error) { errs = append(errs, err) })
+
+	for _, typ := range []client.EventType{client.EventSubmitted, client.EventStarted, client.EventCompleted} {
+		p.Publish(&client.ExecutionEvent{Type: typ, ExecutionID: "exe_1"})
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.events) != 3 || sink.events[2].Type != client.EventCompleted || !sink.closed {
+		t.Errorf("sink got %d events, closed %v", len(sink.events), sink.closed)
+	}
+	if len(errs) != 0 {
+		t.Errorf("errors = %v", errs)
+	}
+
+	// Events published after Close are dropped
+	p.Publish(&client.ExecutionEvent{Type: client.EventSubmitted})
+	if p.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", p.Dropped())
+	}
+}
+
+func TestPublisher_DropsWhenFull(t *testing.T) {
+	sink := &recordSink{block: make(chan struct{})}
+	p := NewPublisher([]Sink{sink}, 1, nil)
+
+	// The first event is taken by the delivery loop and blocks it, the
+	// second fills the buffer, the rest are dropped
+	p.Publish(&client.ExecutionEvent{ExecutionID: "exe_1"})
+	deadline := time.Now().Add(time.Second)
+	for len(p.events) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		p.Publish(&client.ExecutionEvent{ExecutionID: "exe_2"})
+	}
+	if p.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", p.Dropped())
+	}
+
+	close(sink.block)
+	p.Close(context.Background())
+	if len(sink.events) != 2 {
+		t.Errorf("delivered %d events, want 2", len(sink.events))
+	}
+}
+
+func TestPublisher_ReportsErrors(t *testing.T) {
+	sink := &recordSink{err: errors.New("broker down")}
+	errs := make(chan error, 1)
+	p := NewPublisher([]Sink{sink}, 10, func(err error) { errs <- err })
+
+	p.Publish(&client.ExecutionEvent{Type: client.EventStarted, ExecutionID: "exe_1"})
+	select {
+	case err := <-errs:
+		if err.Error() != "publishing started event for exe_1: broker down" {
+			t.Errorf("error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error reported")
+	}
+	p.Close(context.Background())
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(config.EventsConfig{}, nil)
+	if p != nil || err != nil {
+		t.Errorf("New() with no brokers = %v, %v; want nil, nil", p, err)
+	}
+	// A nil publisher accepts events and closes
+	p.Publish(&client.ExecutionEvent{})
+	if err := p.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := New(config.EventsConfig{NATSURL: "http://nats:4222", NATSSubject: "x"}, nil); err == nil {
+		t.Error("New() accepted a NATS URL without the nats scheme")
+	}
+	p, err = New(config.EventsConfig{KafkaRESTURL: "http://kafka-rest:8082", KafkaTopic: "t", Buffer: 1}, nil)
+	if err != nil || p == nil || len(p.sinks) != 1 {
+		t.Fatalf("New() with Kafka = %v, %v", p, err)
+	}
+	p.Close(context.Background())
+}
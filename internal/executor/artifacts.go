@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// MaxArtifactsSize caps the total size of the files collected from an
+// execution's output directory when it sets CollectArtifacts (50MB). Files
+// past the cap are left out.
+const MaxArtifactsSize = 50 << 20
+
+// artifactsDir returns the directory an execution's artifacts are
+// collected from: its OutputDir, relative to /work unless absolute, or
+// OutputDir by default
+func artifactsDir(cfg *clientpkg.ExecutionConfig) string {
+	switch {
+	case cfg.OutputDir == "":
+		return OutputDir
+	case path.IsAbs(cfg.OutputDir):
+		return path.Clean(cfg.OutputDir)
+	default:
+		return path.Join("/work", cfg.OutputDir)
+	}
+}
+
+// artifactsDirTar returns a tar archive, relative to /, that creates dir
+// so that scripts can write to it straight away
+func artifactsDirTar(dir string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name:     strings.TrimPrefix(dir, "/") + "/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	})
+	tw.Close()
+	return buf.Bytes()
+}
+
+// readArtifacts copies the files under dir out of a stopped container. It
+// returns nil if the directory doesn't exist, and the files read so far
+// along with any error.
+func (e *DockerExecutor) readArtifacts(ctx context.Context, containerID, dir string) ([]clientpkg.Artifact, error) {
+	rc, _, err := e.client.CopyFromContainer(ctx, containerID, dir)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("copying %s: %w", dir, err)
+	}
+	defer rc.Close()
+
+	return parseArtifacts(rc, dir)
+}
+
+// parseArtifacts collects the regular files from a tar stream of dir, in
+// archive order, until MaxArtifactsSize is reached. Files under /work are
+// named by their path relative to it, others by their absolute path
+// without the leading slash.
+func parseArtifacts(r io.Reader, dir string) ([]clientpkg.Artifact, error) {
+	var artifacts []clientpkg.Artifact
+	var total int64
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return artifacts, fmt.Errorf("reading %s: %w", dir, err)
+		}
+		if hdr.Typeflag != tar.TypeReg || total+hdr.Size > MaxArtifactsSize {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return artifacts, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		total += int64(len(data))
+
+		// The archive's top-level entry is the directory itself
+		_, rel, _ := strings.Cut(hdr.Name, "/")
+		name := path.Join(dir, rel)
+		if rest, ok := strings.CutPrefix(name, "/work/"); ok {
+			name = rest
+		} else {
+			name = strings.TrimPrefix(name, "/")
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		artifacts = append(artifacts, clientpkg.Artifact{
+			Name:        name,
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			Data:        data,
+		})
+	}
+	return artifacts, nil
+}
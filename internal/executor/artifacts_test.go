@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestArtifactsDir(t *testing.T) {
+	tests := []struct {
+		outputDir string
+		want      string
+	}{
+		{"", OutputDir},
+		{"results", "/work/results"},
+		{"results/../plots/", "/work/plots"},
+		{"/tmp/results/", "/tmp/results"},
+	}
+
+	for _, tt := range tests {
+		if got := artifactsDir(&clientpkg.ExecutionConfig{OutputDir: tt.outputDir}); got != tt.want {
+			t.Errorf("artifactsDir(%q) = %q, want %q", tt.outputDir, got, tt.want)
+		}
+	}
+}
+
+func TestParseArtifacts(t *testing.T) {
+	archive := func(dir string, files map[string]int) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: dir + "/", Typeflag: tar.TypeDir, Mode: 0755})
+		for _, name := range []string{"results.png", "plots/", "plots/loss.svg", "model.bin", "big.csv"} {
+			size, ok := files[name]
+			if !ok {
+				continue
+			}
+			if size < 0 {
+				tw.WriteHeader(&tar.Header{Name: dir + "/" + name, Typeflag: tar.TypeDir, Mode: 0755})
+				continue
+			}
+			tw.WriteHeader(&tar.Header{Name: dir + "/" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(size)})
+			tw.Write(bytes.Repeat([]byte("x"), size))
+		}
+		tw.Close()
+		return &buf
+	}
+
+	// Directories are skipped, and files past the cap are left out
+	files := map[string]int{
+		"results.png":    3,
+		"plots/":         -1,
+		"plots/loss.svg": 4,
+		"model.bin":      5,
+		"big.csv":        MaxArtifactsSize,
+	}
+	artifacts, err := parseArtifacts(archive("output", files), "/work/output")
+	if err != nil {
+		t.Fatalf("parseArtifacts() error = %v", err)
+	}
+	want := []clientpkg.Artifact{
+		{Name: "output/results.png", ContentType: "image/png", Size: 3},
+		{Name: "output/plots/loss.svg", ContentType: "image/svg+xml", Size: 4},
+		{Name: "output/model.bin", ContentType: "application/octet-stream", Size: 5},
+	}
+	if len(artifacts) != len(want) {
+		t.Fatalf("artifacts = %+v", artifacts)
+	}
+	for i, a := range artifacts {
+		if a.Name != want[i].Name || a.ContentType != want[i].ContentType || a.Size != want[i].Size || len(a.Data) != int(a.Size) {
+			t.Errorf("artifact %d = {%s %s %d}, want %+v", i, a.Name, a.ContentType, a.Size, want[i])
+		}
+	}
+
+	// Outside /work files keep their absolute path
+	artifacts, err = parseArtifacts(archive("results", map[string]int{"model.bin": 1}), "/tmp/results")
+	if err != nil || len(artifacts) != 1 || artifacts[0].Name != "tmp/results/model.bin" {
+		t.Errorf("artifacts outside /work = %+v, %v", artifacts, err)
+	}
+}
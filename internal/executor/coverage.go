@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// Files written by coverage.py when an execution asks for coverage. They
+// are outside OutputDir so they are not collected as images.
+const (
+	CoverageDataFile = "/work/.pyexec_coverage"
+	CoverageXMLFile  = "/work/_pyexec_coverage.xml"
+	CoverageHTMLDir  = "/work/_pyexec_htmlcov"
+)
+
+// MaxCoverageReportSize caps each coverage report that is returned (10MB).
+// For the HTML report it applies to the uncompressed files.
+const MaxCoverageReportSize = 10 << 20
+
+// coverageRun runs Python under coverage.py, measuring the files in /work
+// but not the wrappers this package adds there
+const coverageRun = "python -m coverage run --source=/work --omit='/work/_pyexec_*'"
+
+// withCoverageReports extends a command run under coverageRun so it writes
+// the XML and HTML reports afterwards, keeping the command's exit code.
+// coverage.py's own messages are discarded so the script's output is
+// unchanged.
+func withCoverageReports(cmd string) string {
+	return fmt.Sprintf("export COVERAGE_FILE=%s; %s; status=$?; "+
+		"python -m coverage xml -q -o %s >/dev/null 2>&1; "+
+		"python -m coverage html -q -d %s >/dev/null 2>&1; "+
+		"exit $status",
+		CoverageDataFile, cmd, CoverageXMLFile, CoverageHTMLDir)
+}
+
+// coverageReports holds the reports copied out of a container
+type coverageReports struct {
+	xml       []byte
+	artifacts []clientpkg.Artifact
+}
+
+// readCoverageReports copies the coverage reports out of a stopped
+// container: the XML report as coverage.xml and the HTML report as
+// htmlcov.tar.gz. Reports that are missing, e.g. because coverage.py is not
+// installed, or too large are left out.
+func (e *DockerExecutor) readCoverageReports(ctx context.Context, containerID string) coverageReports {
+	var reports coverageReports
+
+	if rc, err := e.copyFile(ctx, containerID, CoverageXMLFile, MaxCoverageReportSize); rc != nil && err == nil {
+		data, err := untarFile(rc, CoverageXMLFile, MaxCoverageReportSize)
+		rc.Close()
+		if err == nil {
+			reports.xml = data
+			reports.artifacts = append(reports.artifacts, clientpkg.Artifact{
+				Name:        "coverage.xml",
+				ContentType: "application/xml",
+				Size:        int64(len(data)),
+				Data:        data,
+			})
+		}
+	}
+
+	if rc, _, err := e.client.CopyFromContainer(ctx, containerID, CoverageHTMLDir); err == nil {
+		data, err := gzipLimited(rc, MaxCoverageReportSize)
+		rc.Close()
+		if err == nil {
+			reports.artifacts = append(reports.artifacts, clientpkg.Artifact{
+				Name:        "htmlcov.tar.gz",
+				ContentType: "application/gzip",
+				Size:        int64(len(data)),
+				Data:        data,
+			})
+		}
+	}
+
+	return reports
+}
+
+// gzipLimited compresses r, failing if it holds more than max bytes
+func gzipLimited(r io.Reader, max int64) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	n, err := io.Copy(zw, io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > max {
+		return nil, fmt.Errorf("over the %d byte limit", max)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// cpuMonitor follows a container's stats stream and keeps the latest CPU
+// counters. Docker samples roughly once per second, so the final figures
+// can miss up to a second of usage at the end of the run.
+type cpuMonitor struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	usage *clientpkg.CPUUsage
+}
+
+// monitorCPU starts following the stats of a started container
+func (e *DockerExecutor) monitorCPU(ctx context.Context, containerID string) *cpuMonitor {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &cpuMonitor{cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(m.done)
+
+		stats, err := e.client.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			return
+		}
+		defer stats.Body.Close()
+
+		dec := json.NewDecoder(stats.Body)
+		for {
+			var s container.StatsResponse
+			if err := dec.Decode(&s); err != nil {
+				return
+			}
+			if usage := cpuUsage(&s); usage != nil {
+				m.mu.Lock()
+				m.usage = usage
+				m.mu.Unlock()
+			}
+		}
+	}()
+
+	return m
+}
+
+// Stop ends monitoring and returns the last sample, or nil if none arrived
+func (m *cpuMonitor) Stop() *clientpkg.CPUUsage {
+	m.cancel()
+	<-m.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// cpuUsage converts Docker's nanosecond CPU counters. Samples taken after
+// the container stopped are all zero and are ignored.
+func cpuUsage(s *container.StatsResponse) *clientpkg.CPUUsage {
+	cpu := s.CPUStats
+	if cpu.CPUUsage.TotalUsage == 0 {
+		return nil
+	}
+	return &clientpkg.CPUUsage{
+		UserMs:      int64(cpu.CPUUsage.UsageInUsermode / 1e6),
+		SystemMs:    int64(cpu.CPUUsage.UsageInKernelmode / 1e6),
+		ThrottledMs: int64(cpu.ThrottlingData.ThrottledTime / 1e6),
+	}
+}
@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"strconv"
+	"time"
+
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// SeedModuleDir holds the sitecustomize module that seeds deterministic
+// executions. Python imports it at startup from PYTHONPATH.
+const SeedModuleDir = "/work/_pyexec_seed"
+
+// seedModuleCode seeds random at startup, and numpy's global generator
+// when numpy is first imported, so that importing numpy costs nothing for
+// scripts that don't use it.
+const seedModuleCode = `import importlib.util
+import os
+import random
+import sys
+
+_seed = int(os.environ.get("PYEXEC_SEED", "0"))
+random.seed(_seed)
+
+
+class _SeedNumpy:
+    def find_spec(self, name, path=None, target=None):
+        if name != "numpy":
+            return None
+        sys.meta_path.remove(self)
+        spec = importlib.util.find_spec(name)
+        if spec is None or spec.loader is None:
+            return spec
+        exec_module = spec.loader.exec_module
+
+        def seeded(module):
+            exec_module(module)
+            module.random.seed(_seed)
+
+        spec.loader.exec_module = seeded
+        return spec
+
+
+sys.meta_path.insert(0, _SeedNumpy())
+`
+
+// seedModuleTar is a tar archive holding the seed module, relative to /work
+var seedModuleTar = func() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name:     "_pyexec_seed/",
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	})
+	tw.WriteHeader(&tar.Header{
+		Name: "_pyexec_seed/sitecustomize.py",
+		Mode: 0644,
+		Size: int64(len(seedModuleCode)),
+	})
+	tw.Write([]byte(seedModuleCode))
+	tw.Close()
+	return buf.Bytes()
+}()
+
+// seedEnv returns the environment that seeds a deterministic execution
+func seedEnv(cfg *clientpkg.ExecutionConfig) []string {
+	seed := strconv.FormatUint(uint64(cfg.Seed), 10)
+	return []string{
+		"PYTHONHASHSEED=" + seed,
+		"PYEXEC_SEED=" + seed,
+	}
+}
+
+// fakeTimeEnv returns the environment that freezes the clock at
+// cfg.FakeTime with libfaketime, or nil if it isn't set. Monotonic clocks
+// are left alone so that sleeps and timeouts still end.
+func fakeTimeEnv(cfg *clientpkg.ExecutionConfig, lib string) []string {
+	if cfg.FakeTime == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, cfg.FakeTime)
+	if err != nil {
+		// Validated by the API; an unparseable time runs with the real clock
+		return nil
+	}
+	return []string{
+		"LD_PRELOAD=" + lib,
+		"FAKETIME=" + t.UTC().Format("2006-01-02 15:04:05"),
+		"FAKETIME_DONT_FAKE_MONOTONIC=1",
+		"TZ=UTC",
+	}
+}
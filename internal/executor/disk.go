@@ -0,0 +1,82 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// diskWatchdog stops a container once the files it has written exceed its
+// disk limit. Docker leaves the limit unenforced on most storage drivers,
+// and a full disk would otherwise surface as OSErrors deep inside user code;
+// stopping the container gives the execution a clear termination reason.
+type diskWatchdog struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	exceeded atomic.Bool
+}
+
+// watchDisk starts measuring a started container's writable layer against
+// its disk limit in MB, every PYEXEC_DISK_CHECK_INTERVAL. A limit or
+// interval of zero disables the watchdog.
+func (e *DockerExecutor) watchDisk(ctx context.Context, containerID string, limitMB int) *diskWatchdog {
+	usage := func(ctx context.Context) (int64, error) {
+		return e.containerDiskUsage(ctx, containerID)
+	}
+	kill := func() {
+		e.client.ContainerKill(context.Background(), containerID, "SIGKILL")
+	}
+	return newDiskWatchdog(ctx, usage, int64(limitMB)<<20, e.config.Docker.DiskCheckInterval, kill)
+}
+
+// newDiskWatchdog calls kill once usage reports more than limit bytes,
+// checking every interval until ctx ends. Failed measurements are skipped.
+func newDiskWatchdog(ctx context.Context, usage func(context.Context) (int64, error), limit int64, interval time.Duration, kill func()) *diskWatchdog {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &diskWatchdog{cancel: cancel, done: make(chan struct{})}
+	if limit <= 0 || interval <= 0 {
+		close(w.done)
+		return w
+	}
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if used, err := usage(ctx); err == nil && used > limit {
+				w.exceeded.Store(true)
+				kill()
+				return
+			}
+		}
+	}()
+
+	return w
+}
+
+// Stop ends the watchdog and reports whether it stopped the container
+func (w *diskWatchdog) Stop() bool {
+	w.cancel()
+	<-w.done
+	return w.exceeded.Load()
+}
+
+// containerDiskUsage returns the size of a container's writable layer: the
+// files copied into /work and everything written outside tmpfs mounts
+func (e *DockerExecutor) containerDiskUsage(ctx context.Context, containerID string) (int64, error) {
+	info, _, err := e.client.ContainerInspectWithRaw(ctx, containerID, true)
+	if err != nil {
+		return 0, err
+	}
+	if info.SizeRw == nil {
+		return 0, fmt.Errorf("container %s reported no size", containerID)
+	}
+	return *info.SizeRw, nil
+}
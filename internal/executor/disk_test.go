@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDiskWatchdog(t *testing.T) {
+	// Usage grows past the limit on the third check; a failed check is
+	// skipped
+	var checks atomic.Int64
+	usage := func(ctx context.Context) (int64, error) {
+		switch checks.Add(1) {
+		case 1:
+			return 0, errors.New("inspect failed")
+		case 2:
+			return 50, nil
+		}
+		return 150, nil
+	}
+	killed := make(chan struct{})
+	w := newDiskWatchdog(context.Background(), usage, 100, time.Millisecond, func() { close(killed) })
+
+	select {
+	case <-killed:
+	case <-time.After(time.Second):
+		t.Fatal("container was not killed")
+	}
+	if !w.Stop() || checks.Load() != 3 {
+		t.Errorf("exceeded = false or checks = %d, want true after 3", checks.Load())
+	}
+
+	// Within the limit, nothing happens
+	w = newDiskWatchdog(context.Background(), func(context.Context) (int64, error) { return 50, nil }, 100, time.Millisecond, func() {
+		t.Error("killed within the limit")
+	})
+	time.Sleep(10 * time.Millisecond)
+	if w.Stop() {
+		t.Error("exceeded within the limit")
+	}
+
+	// No limit, no watchdog
+	w = newDiskWatchdog(context.Background(), usage, 0, time.Millisecond, func() {
+		t.Error("killed without a limit")
+	})
+	if w.Stop() {
+		t.Error("exceeded without a limit")
+	}
+
+	// Nor without an interval
+	w = newDiskWatchdog(context.Background(), usage, 100, 0, func() {
+		t.Error("killed without an interval")
+	})
+	if w.Stop() {
+		t.Error("exceeded without an interval")
+	}
+}
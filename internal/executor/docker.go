@@ -1,18 +1,25 @@
 package executor
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"al.essio.dev/pkg/shellescape"
+	"github.com/docker/docker/api/types/blkiodev"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/geraldthewes/python-executor/internal/config"
 	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
 )
@@ -23,6 +30,27 @@ const EvalWrapperScript = "_pyexec_eval.py"
 // ResultMarker is the delimiter used to identify the expression result in stdout
 const ResultMarker = "___PYEXEC_RESULT___"
 
+// PackagesMarker separates install output from the pip freeze listing
+const PackagesMarker = "___PYEXEC_PACKAGES___"
+
+// Labels applied to every execution container so that `docker ps`, cAdvisor
+// and Prometheus can be correlated with execution records.
+const (
+	LabelManaged     = "python-executor.managed"
+	LabelExecutionID = "python-executor.execution-id"
+	LabelTenant      = "python-executor.tenant"
+	LabelImage       = "python-executor.image"
+	LabelAPIKey      = "python-executor.api-key"
+	LabelPhase       = "python-executor.phase"
+
+	// LabelTimestamps marks containers whose output lines are read with
+	// their times, so that Attach reads them the same way
+	LabelTimestamps = "python-executor.timestamps"
+)
+
+// PhaseInstall is the LabelPhase value of dependency install containers
+const PhaseInstall = "install"
+
 // evalWrapperCode is the Python wrapper that enables REPL-style expression evaluation.
 // It parses the user's code, and if the last statement is an expression, evaluates it
 // separately and outputs the result with a special marker.
@@ -61,27 +89,84 @@ except Exception:
     raise  # Let normal error handling capture it
 `
 
+// dockerPingTimeout bounds the check that the Docker daemon is reachable
+const dockerPingTimeout = 10 * time.Second
+
 // DockerExecutor implements the Executor interface using Docker
 type DockerExecutor struct {
 	client  *client.Client
 	config  *config.Config
+	host    DockerHost
+	// securityOpt holds the SELinux label options of every container
+	securityOpt []string
+	// runs holds the timeout clocks of running containers by ID (see
+	// suspend.go)
+	runsMu sync.Mutex
+	runs   map[string]*runClock
+	// pool keeps containers waiting for executions, if configured
+	pool *warmPool
 }
 
 // NewDockerExecutor creates a new Docker-based executor
 func NewDockerExecutor(cfg *config.Config) (*DockerExecutor, error) {
-	cli, err := client.NewClientWithOpts(
-		client.FromEnv,
-		client.WithHost("unix://"+cfg.Docker.Socket),
-		client.WithAPIVersionNegotiation(),
-	)
+	securityOpt, err := selinuxOptions(cfg.Docker)
+	if err != nil {
+		return nil, err
+	}
+
+	host, err := FindDockerHost(cfg.Docker.Socket, os.Getenv)
 	if err != nil {
-		return nil, fmt.Errorf("creating docker client: %w", err)
+		return nil, err
+	}
+
+	// TLS material configured for the server wins over the context's
+	certPath, verify := cfg.Docker.CertPath, cfg.Docker.TLSVerify
+	if certPath == "" {
+		certPath, verify = host.CertPath, !host.SkipTLSVerify
+	}
+	tlsConfig, err := dockerTLSConfig(host.Host, certPath, verify)
+	if err != nil {
+		return nil, fmt.Errorf("configuring TLS for Docker at %s: %w", host.Host, err)
+	}
+
+	opts := []client.Opt{client.FromEnv}
+	if tlsConfig != nil {
+		// Before WithHost, which configures the transport for the host
+		opts = append(opts, client.WithHTTPClient(&http.Client{
+			Transport:     &http.Transport{TLSClientConfig: tlsConfig},
+			CheckRedirect: client.CheckRedirect,
+		}))
+	}
+	opts = append(opts, client.WithHost(host.Host), client.WithAPIVersionNegotiation())
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating docker client for %s (%s): %w", host.Host, host.Source, err)
+	}
+
+	// Fail at startup, not on the first execution, if the daemon is not there
+	ctx, cancel := context.WithTimeout(context.Background(), dockerPingTimeout)
+	defer cancel()
+	if _, err := cli.Ping(ctx); err != nil {
+		cli.Close()
+		return nil, fmt.Errorf("cannot reach Docker at %s (%s): %w", host.Host, host.Source, err)
 	}
 
-	return &DockerExecutor{
-		client: cli,
-		config: cfg,
-	}, nil
+	e := &DockerExecutor{
+		client:      cli,
+		config:      cfg,
+		host:        host,
+		securityOpt: securityOpt,
+	}
+	if cfg.Pool.Size > 0 {
+		e.startPool()
+	}
+	return e, nil
+}
+
+// Host returns the Docker daemon the executor uses
+func (e *DockerExecutor) Host() DockerHost {
+	return e.host
 }
 
 // Execute runs code in a Docker container
@@ -91,80 +176,528 @@ func (e *DockerExecutor) Execute(ctx context.Context, req *ExecutionRequest) (*E
 	// Apply defaults
 	meta := applyDefaults(req.Metadata, e.config)
 
-	// Set timeout
+	// Pull Docker image if needed, within the pull timeout: a cold pull
+	// does not eat into the script's own timeout
+	timings := &clientpkg.Timings{}
+	pullStart := time.Now()
+	req.enterPhase(clientpkg.PhasePulling)
+	pullTimeout := time.Duration(e.config.Defaults.PullTimeout) * time.Second
+	pullCtx, cancelPull := phaseContext(ctx, pullTimeout)
+	err := e.ensureImage(pullCtx, meta.DockerImage)
+	cancelPull()
+	if err != nil {
+		if ctx.Err() == nil && pullCtx.Err() != nil {
+			return nil, fmt.Errorf("%w after %v pulling %s", ErrPullTimeout, pullTimeout, meta.DockerImage)
+		}
+		return nil, fmt.Errorf("ensuring image: %w", err)
+	}
+	timings.PullMs = time.Since(pullStart).Milliseconds()
+	manifest := e.manifest(ctx, meta)
+
+	// Install dependencies in a container of their own, then run the
+	// script in a container created from the result
+	runImage := meta.DockerImage
+	var install *clientpkg.InstallResult
+	if needsInstall(meta) {
+		req.enterPhase(clientpkg.PhaseInstalling)
+		installTimeout := time.Duration(meta.Config.InstallTimeoutSeconds) * time.Second
+		installCtx, cancelInstall := phaseContext(ctx, installTimeout)
+		installed, result, err := e.installDependencies(installCtx, req, meta)
+		cancelInstall()
+		if err != nil {
+			if ctx.Err() == nil && installCtx.Err() != nil {
+				return nil, fmt.Errorf("%w after %v", ErrInstallTimeout, installTimeout)
+			}
+			return nil, fmt.Errorf("installing dependencies: %w", err)
+		}
+		install = result
+		timings.InstallMs = result.DurationMs
+		if result.ExitCode != 0 {
+			return &ExecutionOutput{
+				ExitCode:   result.ExitCode,
+				DurationMs: time.Since(startTime).Milliseconds(),
+				Install:    result,
+				Manifest:   manifest,
+				Timings:    timings,
+			}, nil
+		}
+		defer e.client.ImageRemove(context.Background(), installed, image.RemoveOptions{Force: true, PruneChildren: true})
+		runImage = installed
+	}
+
+	// The script's timeout starts once its environment is ready, and
+	// stands still while the execution is suspended
 	timeout := time.Duration(meta.Config.TimeoutSeconds) * time.Second
-	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	clock, execCtx, cancel := newRunClock(ctx, timeout)
 	defer cancel()
-
-	// Pull Docker image if needed
-	if err := e.ensureImage(execCtx, meta.DockerImage); err != nil {
-		return nil, fmt.Errorf("ensuring image: %w", err)
+	req.enterPhase(clientpkg.PhaseRunning)
+
+	// Run in a waiting container of the pool if one fits, or create a
+	// container and copy tar data into it. A pooled container that ran the
+	// script to the end goes back to the pool.
+	var containerID, logsSince string
+	var warm *warmContainer
+	reusable := false
+	if e.fitsPool(meta, install != nil) {
+		warm = e.claimWarm(execCtx, req, meta)
+	}
+	if warm != nil {
+		containerID, logsSince = warm.ID, warm.StartedAt
+		defer func() { e.pool.put(warm, reusable) }()
+	} else {
+		containerID, err = e.createContainer(execCtx, req, meta, runImage, install != nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating container: %w", err)
+		}
+		defer e.client.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
 	}
+	e.track(containerID, clock)
+	defer e.untrack(containerID)
 
-	// Create container and copy tar data into it
-	containerID, err := e.createContainer(execCtx, meta, req.TarData)
-	if err != nil {
-		return nil, fmt.Errorf("creating container: %w", err)
+	if req.OnContainerCreated != nil {
+		req.OnContainerCreated(containerID)
 	}
-	defer e.client.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
 
 	// If stdin is provided, attach to container before starting
-	if meta.Stdin != "" {
-		if err := e.attachAndWriteStdin(execCtx, containerID, meta.Stdin); err != nil {
+	stdin := req.Stdin
+	if stdin == nil && meta.Stdin != "" {
+		stdin = strings.NewReader(meta.Stdin)
+	}
+	// A waiting container is already started: its script runs once it
+	// reads a line
+	if warm != nil {
+		if stdin == nil {
+			stdin = strings.NewReader("")
+		}
+		stdin = io.MultiReader(strings.NewReader("\n"), stdin)
+	}
+	if stdin != nil {
+		if err := e.attachAndWriteStdin(execCtx, containerID, stdin); err != nil {
 			return nil, fmt.Errorf("attaching stdin: %w", err)
 		}
 	}
 
 	// Start container
-	if err := e.client.ContainerStart(execCtx, containerID, container.StartOptions{}); err != nil {
-		return nil, fmt.Errorf("starting container: %w", err)
+	runStart := time.Now()
+	if warm == nil {
+		if err := e.client.ContainerStart(execCtx, containerID, container.StartOptions{}); err != nil {
+			return nil, fmt.Errorf("starting container: %w", err)
+		}
 	}
+	cpu := e.monitorCPU(execCtx, containerID)
+	disk := e.watchDisk(execCtx, containerID, meta.Config.DiskMB)
+	waitOutput := e.followOutput(execCtx, containerID, logsSince, req.OnOutput)
 
 	// Wait for container to finish
-	statusCh, errCh := e.client.ContainerWait(execCtx, containerID, container.WaitConditionNotRunning)
-
-	var exitCode int64
-	select {
-	case err := <-errCh:
-		if err != nil {
-			return nil, fmt.Errorf("waiting for container: %w", err)
+	exitCode, err := e.waitContainer(execCtx, containerID)
+	timings.RunMs = time.Since(runStart).Milliseconds()
+	waitOutput()
+	cpuUsage := cpu.Stop()
+	diskExceeded := disk.Stop()
+	if err != nil {
+		if execCtx.Err() != nil {
+			return nil, fmt.Errorf("%w after %v", ErrTimeout, timeout)
 		}
-	case status := <-statusCh:
-		exitCode = status.StatusCode
-	case <-execCtx.Done():
-		// Timeout - kill container
-		e.client.ContainerKill(context.Background(), containerID, "SIGKILL")
-		return nil, fmt.Errorf("execution timeout after %v", timeout)
+		return nil, err
 	}
 
 	// Get logs
-	stdout, stderr, err := e.getLogs(context.Background(), containerID)
+	logs, err := e.getLogs(context.Background(), containerID, logsSince, req.Stdout, req.Stderr, meta.Config.CombinedOutput, meta.Config.RecordTimestamps)
 	if err != nil {
 		return nil, fmt.Errorf("getting logs: %w", err)
 	}
+	if meta.Config.StripANSI {
+		logs.stripANSI()
+	}
 
 	duration := time.Since(startTime)
 
-	return &ExecutionOutput{
-		Stdout:     stdout,
-		Stderr:     stderr,
-		ExitCode:   int(exitCode),
-		DurationMs: duration.Milliseconds(),
-	}, nil
+	// Tell an out-of-memory kill apart from other failures
+	oomKilled := false
+	if exitCode != 0 {
+		if info, err := e.client.ContainerInspect(context.Background(), containerID); err == nil && info.State != nil {
+			oomKilled = info.State.OOMKilled
+		}
+	}
+	// Only a pooled container whose script exited by itself is reused
+	reusable = exitCode < 128 && !oomKilled && !diskExceeded
+
+	output := &ExecutionOutput{
+		Stdout:            logs.Stdout,
+		Stderr:            logs.Stderr,
+		StdoutTimes:       logs.StdoutTimes,
+		StderrTimes:       logs.StderrTimes,
+		Combined:          logs.Combined,
+		ExitCode:          exitCode,
+		DurationMs:        duration.Milliseconds(),
+		Install:           install,
+		Manifest:          manifest,
+		OOMKilled:         oomKilled,
+		DiskLimitExceeded: diskExceeded,
+		CPU:               cpuUsage,
+		Timings:           timings,
+	}
+
+	// Collect the script's structured result, if it wrote one
+	if structured, err := e.readResultFile(context.Background(), containerID); err != nil {
+		output.StructuredOutputError = err.Error()
+	} else {
+		output.StructuredOutput = structured
+	}
+
+	// Collect the test report, if pytest wrote one
+	if meta.Mode == clientpkg.ModePytest {
+		output.JUnitReport, _ = e.readJUnitReport(context.Background(), containerID)
+	}
+
+	// Collect images on a best-effort basis, keeping any read before an
+	// error
+	if meta.Config.CaptureImages {
+		output.Artifacts, _ = e.readImages(context.Background(), containerID)
+	}
+
+	// Collect the coverage reports, if coverage.py wrote them
+	if meta.Config.Coverage {
+		reports := e.readCoverageReports(context.Background(), containerID)
+		output.CoverageXML = reports.xml
+		output.Artifacts = append(output.Artifacts, reports.artifacts...)
+	}
+
+	// Collect the files the execution asked to keep, on a best-effort basis
+	if meta.Config.CollectArtifacts {
+		output.Files, _ = e.readArtifacts(context.Background(), containerID, artifactsDir(meta.Config))
+	}
+
+	// Collect all output files for the caller, on a best-effort basis
+	if req.CollectOutput {
+		output.OutputArchive, _ = e.readOutputArchive(context.Background(), containerID)
+	}
+
+	return output, nil
+}
+
+// installDependencies runs pre-commands and pip install in separate
+// containers and commits the result to an image for the script to run in.
+// A non-zero install exit code is reported in the result, not as an error;
+// the image ID is empty in that case.
+func (e *DockerExecutor) installDependencies(ctx context.Context, req *ExecutionRequest, meta *clientpkg.Metadata) (string, *clientpkg.InstallResult, error) {
+	startTime := time.Now()
+
+	// Each stage runs in a container created from the one before
+	result := &clientpkg.InstallResult{}
+	base := meta.DockerImage
+	for _, stage := range e.installStages(meta) {
+		committed, exitCode, err := e.runInstallStage(ctx, req, meta, base, stage, result)
+		if base != meta.DockerImage && committed == "" {
+			e.client.ImageRemove(context.Background(), base, image.RemoveOptions{Force: true, PruneChildren: true})
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		result.ExitCode = exitCode
+		if exitCode != 0 {
+			result.DurationMs = time.Since(startTime).Milliseconds()
+			return "", result, nil
+		}
+		base = committed
+	}
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	return base, result, nil
+}
+
+// installStage is one container of the dependency install
+type installStage struct {
+	cmd     string
+	network bool // whether it may reach the network
+	files   bool // whether the user's files are copied in
+}
+
+// installStages plans the dependency install. It is one container, with
+// the network if the script has it. With install_network_only, pip install
+// runs with the network in a container without the user's files, and
+// pre-commands run after it offline, so that no user code runs while the
+// network is reachable.
+func (e *DockerExecutor) installStages(meta *clientpkg.Metadata) []installStage {
+	network := !meta.Config.NetworkDisabled && !meta.Config.InstallNetworkOnly
+	if !meta.Config.InstallNetworkOnly || meta.RequirementsTxt == "" {
+		return []installStage{{cmd: e.installCommand(meta), network: network, files: true}}
+	}
+
+	offline := append(append([]string{}, meta.PreCommands...), freezeCommands(meta)...)
+	if len(offline) == 0 {
+		offline = []string{"true"}
+	}
+	return []installStage{
+		{cmd: strings.Join(pipCommands(meta), " && "), network: true},
+		{cmd: strings.Join(offline, " && "), files: true},
+	}
+}
+
+// runInstallStage runs one stage of the install in a container created
+// from base, appends its output to result and commits the container. The
+// committed image ID is empty if the stage failed.
+func (e *DockerExecutor) runInstallStage(ctx context.Context, req *ExecutionRequest, meta *clientpkg.Metadata, base string, stage installStage, result *clientpkg.InstallResult) (string, int, error) {
+	networkMode := "none"
+	if stage.network {
+		networkMode = e.config.Docker.NetworkMode
+	}
+
+	resources := e.resources(meta)
+	if e.config.Defaults.InstallMemoryMB > 0 {
+		resources.Memory = int64(e.config.Defaults.InstallMemoryMB) * 1024 * 1024
+	}
+	if e.config.Defaults.InstallCPUShares > 0 {
+		resources.CPUShares = int64(e.config.Defaults.InstallCPUShares)
+	}
+
+	labels := containerLabels(req, meta)
+	labels[LabelPhase] = PhaseInstall
+
+	containerConfig := &container.Config{
+		Image:        base,
+		Cmd:          []string{"sh", "-c", stage.cmd},
+		WorkingDir:   "/work",
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          append(append([]string{}, meta.EnvVars...), req.Env...),
+		Labels:       labels,
+	}
+
+	resp, err := e.client.ContainerCreate(ctx, containerConfig, e.hostConfig(networkMode, resources), nil, nil, "")
+	if err != nil {
+		return "", 0, fmt.Errorf("creating install container: %w", err)
+	}
+	containerID := resp.ID
+	defer e.client.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+
+	if stage.files {
+		if err := e.client.CopyToContainer(ctx, containerID, "/work", bytes.NewReader(req.TarData), container.CopyToContainerOptions{}); err != nil {
+			return "", 0, fmt.Errorf("copying files to install container: %w", err)
+		}
+	}
+
+	// Let callers kill the execution while it is still installing
+	if req.OnContainerCreated != nil {
+		req.OnContainerCreated(containerID)
+	}
+
+	if err := e.client.ContainerStart(ctx, containerID, container.StartOptions{}); err != nil {
+		return "", 0, fmt.Errorf("starting install container: %w", err)
+	}
+
+	exitCode, err := e.waitContainer(ctx, containerID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	logs, err := e.getLogs(context.Background(), containerID, "", nil, nil, false, false)
+	if err != nil {
+		return "", 0, fmt.Errorf("getting install logs: %w", err)
+	}
+	if meta.Config.StripANSI {
+		logs.stripANSI()
+	}
+
+	stdout := logs.Stdout
+	if freezePackages(meta) {
+		stdout, result.Packages = splitPackages(logs.Stdout)
+	}
+	result.Stdout += stdout
+	result.Stderr += logs.Stderr
+	if exitCode != 0 {
+		return "", exitCode, nil
+	}
+
+	committed, err := e.client.ContainerCommit(ctx, containerID, container.CommitOptions{
+		Changes: []string{fmt.Sprintf("LABEL %s=true", LabelManaged)},
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("committing installed environment: %w", err)
+	}
+	return committed.ID, 0, nil
+}
+
+// phaseContext bounds ctx by a phase's timeout; zero means no bound
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// waitContainer waits for a started container to exit and returns its exit
+// code. The container is killed if ctx ends first. A container that stops
+// because it was checkpointed is waited for again once restored.
+func (e *DockerExecutor) waitContainer(ctx context.Context, containerID string) (int, error) {
+	for {
+		statusCh, errCh := e.client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+
+		select {
+		case err := <-errCh:
+			if ctx.Err() != nil {
+				e.client.ContainerKill(context.Background(), containerID, "SIGKILL")
+				return 0, ctx.Err()
+			}
+			if err != nil {
+				return 0, fmt.Errorf("waiting for container: %w", err)
+			}
+			return 0, nil
+		case status := <-statusCh:
+			if c := e.clock(containerID); c != nil {
+				if restored := c.checkpointed(); restored != nil {
+					select {
+					case <-restored:
+						continue
+					case <-ctx.Done():
+						return 0, ctx.Err()
+					}
+				}
+			}
+			return int(status.StatusCode), nil
+		case <-ctx.Done():
+			// Timeout - kill container
+			e.client.ContainerKill(context.Background(), containerID, "SIGKILL")
+			return 0, ctx.Err()
+		}
+	}
 }
 
-// Kill terminates a running container
+// Kill terminates a running container. A checkpointed container is
+// already stopped; it is just not restored.
 func (e *DockerExecutor) Kill(ctx context.Context, containerID string) error {
+	if c := e.clock(containerID); c != nil && c.endCheckpoint(false) {
+		return nil
+	}
 	return e.client.ContainerKill(ctx, containerID, "SIGKILL")
 }
 
-// Close closes the Docker client
+// ListContainers returns managed containers (running or exited) keyed by execution ID
+func (e *DockerExecutor) ListContainers(ctx context.Context) (map[string]string, error) {
+	containers, err := e.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelManaged+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+
+	result := make(map[string]string, len(containers))
+	for _, c := range containers {
+		// Install containers can't be re-attached; their executions are lost.
+		// Session containers aren't executions.
+		if c.Labels[LabelPhase] == PhaseInstall || c.Labels[LabelPhase] == PhaseSession {
+			continue
+		}
+		// Warm containers record the execution they were handed in their
+		// claim
+		if c.Labels[LabelPhase] == PhaseWarm {
+			claim, _ := e.readWarmClaim(ctx, c.ID)
+			if execID := claim[LabelExecutionID]; execID != "" {
+				result[execID] = c.ID
+			}
+			continue
+		}
+		if execID := c.Labels[LabelExecutionID]; execID != "" {
+			result[execID] = c.ID
+		}
+	}
+
+	return result, nil
+}
+
+// Attach waits for an existing container to exit and returns its output.
+// ctx's deadline, if any, is what is left of the script's timeout; like
+// Execute's, it stands still while the container is suspended.
+func (e *DockerExecutor) Attach(ctx context.Context, containerID string) (*ExecutionOutput, error) {
+	defer e.client.ContainerRemove(context.Background(), containerID, container.RemoveOptions{Force: true})
+
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = max(time.Until(deadline), time.Nanosecond)
+	}
+	clock, waitCtx, cancel := newRunClock(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		if ctx.Err() != context.DeadlineExceeded {
+			cancel()
+		}
+	})
+	defer stop()
+
+	// The container may have been suspended before the restart. A warm
+	// container's logs hold its earlier executions' output too; only what
+	// followed its last start is this execution's.
+	var logsSince string
+	var timestamps bool
+	if info, err := e.client.ContainerInspect(ctx, containerID); err == nil && info.State != nil {
+		if info.Config != nil && info.Config.Labels[LabelPhase] == PhaseWarm {
+			logsSince = info.State.StartedAt
+		}
+		if info.Config != nil {
+			timestamps = info.Config.Labels[LabelTimestamps] == "true"
+		}
+		switch {
+		case info.State.Paused:
+			clock.stop()
+		case !info.State.Running && e.hasCheckpoint(ctx, containerID):
+			clock.checkpoint()
+		}
+	}
+	e.track(containerID, clock)
+	defer e.untrack(containerID)
+
+	exitCode, err := e.waitContainer(waitCtx, containerID)
+	if err != nil {
+		if waitCtx.Err() != nil {
+			return nil, fmt.Errorf("%w while recovering: %w", ErrTimeout, context.Cause(waitCtx))
+		}
+		return nil, err
+	}
+
+	logs, err := e.getLogs(context.Background(), containerID, logsSince, nil, nil, false, timestamps)
+	if err != nil {
+		return nil, fmt.Errorf("getting logs: %w", err)
+	}
+
+	output := &ExecutionOutput{
+		Stdout:      logs.Stdout,
+		Stderr:      logs.Stderr,
+		StdoutTimes: logs.StdoutTimes,
+		StderrTimes: logs.StderrTimes,
+		ExitCode:    exitCode,
+	}
+
+	// Derive duration from the container's own timestamps
+	if info, err := e.client.ContainerInspect(context.Background(), containerID); err == nil && info.State != nil {
+		started, errStart := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+		finished, errFinish := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		if errStart == nil && errFinish == nil && finished.After(started) {
+			output.DurationMs = finished.Sub(started).Milliseconds()
+			output.Timings = &clientpkg.Timings{RunMs: output.DurationMs}
+		}
+		output.OOMKilled = info.State.OOMKilled
+	}
+
+	if structured, err := e.readResultFile(context.Background(), containerID); err != nil {
+		output.StructuredOutputError = err.Error()
+	} else {
+		output.StructuredOutput = structured
+	}
+
+	return output, nil
+}
+
+// Close removes the waiting containers of the pool, if any, and closes the
+// Docker client
 func (e *DockerExecutor) Close() error {
+	if e.pool != nil {
+		e.pool.close()
+	}
 	return e.client.Close()
 }
 
-// attachAndWriteStdin attaches to the container's stdin and writes data
-func (e *DockerExecutor) attachAndWriteStdin(ctx context.Context, containerID string, stdinData string) error {
+// attachAndWriteStdin attaches to the container's stdin and streams data to it
+func (e *DockerExecutor) attachAndWriteStdin(ctx context.Context, containerID string, stdin io.Reader) error {
 	// Attach to container with stdin
 	attachResp, err := e.client.ContainerAttach(ctx, containerID, container.AttachOptions{
 		Stream: true,
@@ -178,7 +711,7 @@ func (e *DockerExecutor) attachAndWriteStdin(ctx context.Context, containerID st
 	// This runs concurrently with container execution
 	go func() {
 		defer attachResp.Close()
-		io.WriteString(attachResp.Conn, stdinData)
+		io.Copy(attachResp.Conn, stdin)
 		// Close the write side to send EOF
 		if closer, ok := attachResp.Conn.(interface{ CloseWrite() error }); ok {
 			closer.CloseWrite()
@@ -207,80 +740,222 @@ func (e *DockerExecutor) ensureImage(ctx context.Context, imageName string) erro
 	return err
 }
 
+// manifest describes the image and effective configuration of an execution.
+// Image details are left out if the image can't be inspected.
+func (e *DockerExecutor) manifest(ctx context.Context, meta *clientpkg.Metadata) *clientpkg.Manifest {
+	inspect, _, err := e.client.ImageInspectWithRaw(ctx, meta.DockerImage)
+	if err != nil {
+		return newManifest(meta, nil)
+	}
+	return newManifest(meta, &inspect)
+}
+
+// newManifest builds a manifest from metadata and, if known, the inspected image
+func newManifest(meta *clientpkg.Metadata, inspect *image.InspectResponse) *clientpkg.Manifest {
+	cfg := *meta.Config
+	m := &clientpkg.Manifest{
+		Image:  meta.DockerImage,
+		Config: &cfg,
+	}
+	if inspect == nil {
+		return m
+	}
+
+	m.ImageID = inspect.ID
+	if len(inspect.RepoDigests) > 0 {
+		m.ImageDigest = inspect.RepoDigests[0]
+	}
+	if inspect.Os != "" && inspect.Architecture != "" {
+		m.Platform = inspect.Os + "/" + inspect.Architecture
+		if inspect.Variant != "" {
+			m.Platform += "/" + inspect.Variant
+		}
+	}
+	if inspect.Config != nil {
+		for _, env := range inspect.Config.Env {
+			if v, ok := strings.CutPrefix(env, "PYTHON_VERSION="); ok {
+				m.PythonVersion = v
+			}
+		}
+	}
+	return m
+}
+
 // createContainer creates a Docker container with security constraints
-func (e *DockerExecutor) createContainer(ctx context.Context, meta *clientpkg.Metadata, tarData []byte) (string, error) {
+func (e *DockerExecutor) createContainer(ctx context.Context, req *ExecutionRequest, meta *clientpkg.Metadata, imageName string, installed bool) (string, error) {
 	// Build command
 	cmd := e.buildCommand(meta)
 
 	// Network mode
 	networkMode := "none"
-	if !meta.Config.NetworkDisabled {
+	if !meta.Config.NetworkDisabled && !meta.Config.InstallNetworkOnly {
 		networkMode = e.config.Docker.NetworkMode
 	}
 
 	// Resource limits
-	resources := container.Resources{
-		Memory:    int64(meta.Config.MemoryMB) * 1024 * 1024,
-		CPUShares: int64(meta.Config.CPUShares),
-	}
+	resources := e.resources(meta)
 
 	// Create container config
 	containerConfig := &container.Config{
-		Image:        meta.DockerImage,
+		Image:        imageName,
 		Cmd:          []string{"sh", "-c", cmd},
 		WorkingDir:   "/work",
 		AttachStdout: true,
 		AttachStderr: true,
-		Env:          meta.EnvVars,
+		Env:          e.containerEnv(req, meta),
+		Labels:       containerLabels(req, meta),
 	}
 
 	// Add stdin if provided
-	if meta.Stdin != "" {
+	if meta.Stdin != "" || req.Stdin != nil {
 		containerConfig.OpenStdin = true
 		containerConfig.StdinOnce = true
 	}
 
-	// Host config with security
-	hostConfig := &container.HostConfig{
+	// Create container
+	resp, err := e.client.ContainerCreate(ctx, containerConfig, e.hostConfig(networkMode, resources), nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	// Copy tar data directly to /work in the container, unless the
+	// installed image already contains the files
+	if !installed {
+		tarReader := bytes.NewReader(req.TarData)
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/work", tarReader, container.CopyToContainerOptions{}); err != nil {
+			e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", fmt.Errorf("copying files to container: %w", err)
+		}
+	}
+
+	// Add the REPL wrapper next to the user's files
+	if meta.EvalLastExpr {
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/work", bytes.NewReader(evalWrapperTar), container.CopyToContainerOptions{}); err != nil {
+			e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", fmt.Errorf("copying eval wrapper to container: %w", err)
+		}
+	}
+
+	// Add the headless matplotlib backend
+	if meta.Config.CaptureImages {
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/work", bytes.NewReader(plotBackendTar), container.CopyToContainerOptions{}); err != nil {
+			e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", fmt.Errorf("copying plot backend to container: %w", err)
+		}
+	}
+
+	// Add the module that seeds deterministic runs
+	if meta.Config.Deterministic {
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/work", bytes.NewReader(seedModuleTar), container.CopyToContainerOptions{}); err != nil {
+			e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", fmt.Errorf("copying seed module to container: %w", err)
+		}
+	}
+
+	// Create the directory artifacts are collected from
+	if meta.Config.CollectArtifacts {
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/", bytes.NewReader(artifactsDirTar(artifactsDir(meta.Config))), container.CopyToContainerOptions{}); err != nil {
+			e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+			return "", fmt.Errorf("creating output directory: %w", err)
+		}
+	}
+
+	return resp.ID, nil
+}
+
+// resources returns the resource limits of an execution's containers
+func (e *DockerExecutor) resources(meta *clientpkg.Metadata) container.Resources {
+	resources := container.Resources{
+		Memory:      int64(meta.Config.MemoryMB) * 1024 * 1024,
+		CPUShares:   int64(meta.Config.CPUShares),
+		BlkioWeight: meta.Config.BlkioWeight,
+	}
+	// Bandwidth limits apply per device, to those backing Docker's storage
+	for _, device := range e.config.Docker.BlkioDevices {
+		if meta.Config.DiskReadBps > 0 {
+			resources.BlkioDeviceReadBps = append(resources.BlkioDeviceReadBps, &blkiodev.ThrottleDevice{Path: device, Rate: uint64(meta.Config.DiskReadBps)})
+		}
+		if meta.Config.DiskWriteBps > 0 {
+			resources.BlkioDeviceWriteBps = append(resources.BlkioDeviceWriteBps, &blkiodev.ThrottleDevice{Path: device, Rate: uint64(meta.Config.DiskWriteBps)})
+		}
+	}
+	return resources
+}
+
+// hostConfig returns the host configuration shared by install and
+// execution containers
+func (e *DockerExecutor) hostConfig(networkMode string, resources container.Resources) *container.HostConfig {
+	return &container.HostConfig{
 		NetworkMode: container.NetworkMode(networkMode),
 		Resources:   resources,
 		DNS:         e.config.Docker.DNSServers,
+		SecurityOpt: e.securityOpt,
 		Tmpfs: map[string]string{
 			"/tmp": "size=100m",
 		},
 	}
+}
 
-	// Create container
-	resp, err := e.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
-	if err != nil {
-		return "", err
+// containerEnv builds the environment of an execution container: the
+// variables of the options it asked for, then the user's, then the server's
+func (e *DockerExecutor) containerEnv(req *ExecutionRequest, meta *clientpkg.Metadata) []string {
+	var env, pythonPath []string
+	if req.OnOutput != nil {
+		// Output followed live is worth little if it arrives in blocks
+		env = append(env, "PYTHONUNBUFFERED=1")
 	}
-
-	// Copy tar data directly to /work in the container
-	// Note: We copy to /work which is a tmpfs, so the files are written to memory
-	tarReader := bytes.NewReader(tarData)
-	if err := e.client.CopyToContainer(ctx, resp.ID, "/work", tarReader, container.CopyToContainerOptions{}); err != nil {
-		e.client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
-		return "", fmt.Errorf("copying files to container: %w", err)
+	if meta.Config.CaptureImages {
+		env = append(env, plotEnv()...)
+		pythonPath = append(pythonPath, "/work")
+	}
+	if meta.Config.Deterministic {
+		env = append(env, seedEnv(meta.Config)...)
+		pythonPath = append(pythonPath, SeedModuleDir)
+	}
+	env = append(env, fakeTimeEnv(meta.Config, e.config.Docker.FakeTimeLib)...)
+	if meta.Config.CollectArtifacts {
+		env = append(env, "PYEXEC_OUTPUT_DIR="+artifactsDir(meta.Config))
+	}
+	if len(pythonPath) > 0 {
+		env = append(env, "PYTHONPATH="+strings.Join(pythonPath, ":"))
 	}
+	env = append(env, meta.EnvVars...)
+	return append(env, req.Env...)
+}
 
-	return resp.ID, nil
+// containerLabels builds the Docker labels identifying an execution container
+func containerLabels(req *ExecutionRequest, meta *clientpkg.Metadata) map[string]string {
+	labels := map[string]string{
+		LabelManaged:     "true",
+		LabelExecutionID: req.ID,
+		LabelImage:       meta.DockerImage,
+	}
+	if req.Tenant != "" {
+		labels[LabelTenant] = req.Tenant
+	}
+	if req.APIKeyName != "" {
+		labels[LabelAPIKey] = req.APIKeyName
+	}
+	if meta.Config != nil && meta.Config.RecordTimestamps {
+		labels[LabelTimestamps] = "true"
+	}
+	return labels
 }
 
-// buildCommand creates the shell command to run inside the container
+// buildCommand creates the shell command that runs the script
 func (e *DockerExecutor) buildCommand(meta *clientpkg.Metadata) string {
-	var parts []string
-
-	// Run pre-commands
-	for _, cmd := range meta.PreCommands {
-		parts = append(parts, cmd)
+	coverage := meta.Config != nil && meta.Config.Coverage
+	python := "python"
+	if coverage {
+		python = coverageRun
 	}
 
-	// Install requirements
-	if meta.RequirementsTxt != "" {
-		reqFile := filepath.Join("/work", "requirements.txt")
-		parts = append(parts, fmt.Sprintf("echo '%s' > %s", strings.ReplaceAll(meta.RequirementsTxt, "'", "'\\''"), reqFile))
-		parts = append(parts, fmt.Sprintf("pip install --no-cache-dir -r %s", reqFile))
+	if meta.Mode == clientpkg.ModePytest {
+		cmd := pytestCommand(meta, python)
+		if coverage {
+			cmd = withCoverageReports(cmd)
+		}
+		return cmd
 	}
 
 	// Run Python script with arguments
@@ -290,82 +965,192 @@ func (e *DockerExecutor) buildCommand(meta *clientpkg.Metadata) string {
 	if meta.EvalLastExpr {
 		// Use the eval wrapper script, passing the original entrypoint as argument
 		wrapperPath := filepath.Join("/work", EvalWrapperScript)
-		pythonCmd = fmt.Sprintf("python %s %s", shellescape.Quote(wrapperPath), shellescape.Quote(scriptPath))
+		pythonCmd = fmt.Sprintf("%s %s %s", python, shellescape.Quote(wrapperPath), shellescape.Quote(scriptPath))
 	} else {
-		pythonCmd = fmt.Sprintf("python %s", shellescape.Quote(scriptPath))
+		pythonCmd = fmt.Sprintf("%s %s", python, shellescape.Quote(scriptPath))
 	}
 
 	for _, arg := range meta.ScriptArgs {
 		pythonCmd += " " + shellescape.Quote(arg)
 	}
-	parts = append(parts, pythonCmd)
+
+	if coverage {
+		pythonCmd = withCoverageReports(pythonCmd)
+	}
+	return pythonCmd
+}
+
+// installCommand builds the shell command for the dependency install stage
+func (e *DockerExecutor) installCommand(meta *clientpkg.Metadata) string {
+	var parts []string
+
+	// Run pre-commands
+	for _, cmd := range meta.PreCommands {
+		parts = append(parts, cmd)
+	}
+
+	// Install requirements, then snapshot the resulting environment
+	parts = append(parts, pipCommands(meta)...)
+	parts = append(parts, freezeCommands(meta)...)
 
 	return strings.Join(parts, " && ")
 }
 
+// pipCommands installs an execution's requirements, if it has any
+func pipCommands(meta *clientpkg.Metadata) []string {
+	if meta.RequirementsTxt == "" {
+		return nil
+	}
+	reqFile := filepath.Join("/work", "requirements.txt")
+	return []string{
+		fmt.Sprintf("echo '%s' > %s", strings.ReplaceAll(meta.RequirementsTxt, "'", "'\\''"), reqFile),
+		fmt.Sprintf("pip install --no-cache-dir -r %s", reqFile),
+	}
+}
+
+// freezeCommands lists the installed packages after a marker, if the
+// execution records them
+func freezeCommands(meta *clientpkg.Metadata) []string {
+	if !freezePackages(meta) {
+		return nil
+	}
+	return []string{"echo " + PackagesMarker, "pip freeze"}
+}
+
+// needsInstall reports whether an execution has a dependency install stage
+func needsInstall(meta *clientpkg.Metadata) bool {
+	return meta.RequirementsTxt != "" || len(meta.PreCommands) > 0 || freezePackages(meta)
+}
+
+// freezePackages reports whether the installed packages should be recorded
+func freezePackages(meta *clientpkg.Metadata) bool {
+	return meta.Config != nil && meta.Config.FreezePackages
+}
+
+// splitPackages separates the pip freeze listing from install stdout
+func splitPackages(stdout string) (string, []string) {
+	idx := strings.LastIndex(stdout, PackagesMarker+"\n")
+	if idx == -1 {
+		return stdout, nil
+	}
+
+	var packages []string
+	for _, line := range strings.Split(stdout[idx+len(PackagesMarker)+1:], "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			packages = append(packages, line)
+		}
+	}
+	return stdout[:idx], packages
+}
+
 // GetEvalWrapperCode returns the Python wrapper code for REPL-style evaluation
 func GetEvalWrapperCode() string {
 	return evalWrapperCode
 }
 
-// getLogs retrieves stdout and stderr from a container
-func (e *DockerExecutor) getLogs(ctx context.Context, containerID string) (string, string, error) {
+// evalWrapperTar is a tar archive holding the eval wrapper script
+var evalWrapperTar = func() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name: EvalWrapperScript,
+		Mode: 0644,
+		Size: int64(len(evalWrapperCode)),
+	})
+	tw.Write([]byte(evalWrapperCode))
+	tw.Close()
+	return buf.Bytes()
+}()
+
+// getLogs retrieves stdout and stderr from a container, copying them to the
+// optional writers as they are read. If combined is set the interleaved
+// output is kept too, and if timestamps is set the time of each line. A
+// non-empty since, in the daemon's clock, leaves out earlier output.
+func (e *DockerExecutor) getLogs(ctx context.Context, containerID, since string, stdoutW, stderrW io.Writer, combined, timestamps bool) (*capturedLogs, error) {
 	options := container.LogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
+		Timestamps: timestamps,
+		Since:      since,
 	}
 
 	logs, err := e.client.ContainerLogs(ctx, containerID, options)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	defer logs.Close()
 
 	// Docker multiplexes stdout/stderr - we need to demultiplex
-	stdout, stderr, err := demuxLogs(logs)
-	if err != nil {
-		return "", "", err
-	}
-
-	return stdout, stderr, nil
+	return demuxLogs(logs, stdoutW, stderrW, combined, timestamps)
 }
 
-// demuxLogs separates stdout and stderr from Docker's multiplexed stream
-func demuxLogs(logs io.Reader) (string, string, error) {
-	var stdoutBuf, stderrBuf strings.Builder
+// maxPooledLogBuffer is the largest buffer returned to logBufferPool, so one
+// huge output doesn't stay resident for the life of the process
+const maxPooledLogBuffer = 1 << 20
 
-	// Docker uses an 8-byte header for each frame
-	// [stream_type, 0, 0, 0, size1, size2, size3, size4]
-	header := make([]byte, 8)
+// logBufferPool holds reusable buffers for collecting container output
+var logBufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
 
-	for {
-		_, err := io.ReadFull(logs, header)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return "", "", err
-		}
+func getLogBuffer() *bytes.Buffer {
+	buf := logBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
 
-		// Parse size (big-endian uint32)
-		size := uint32(header[4])<<24 | uint32(header[5])<<16 | uint32(header[6])<<8 | uint32(header[7])
+func putLogBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledLogBuffer {
+		logBufferPool.Put(buf)
+	}
+}
 
-		// Read payload
-		payload := make([]byte, size)
-		if _, err := io.ReadFull(logs, payload); err != nil {
-			return "", "", err
-		}
+// demuxLogs separates stdout and stderr from Docker's multiplexed stream.
+// Each frame is written straight to pooled buffers and the optional writers.
+// With timestamps set, the timestamp in front of each frame is stripped and
+// kept per line. Frames arrive in the order they were written, so with
+// combined set they are also collected into a single interleaved stream.
+func demuxLogs(logs io.Reader, stdoutW, stderrW io.Writer, combined, timestamps bool) (*capturedLogs, error) {
+	stdoutBuf, stderrBuf := getLogBuffer(), getLogBuffer()
+	defer putLogBuffer(stdoutBuf)
+	defer putLogBuffer(stderrBuf)
+
+	var stdout, stderr io.Writer = stdoutBuf, stderrBuf
+	if stdoutW != nil {
+		stdout = io.MultiWriter(stdout, stdoutW)
+	}
+	if stderrW != nil {
+		stderr = io.MultiWriter(stderr, stderrW)
+	}
 
-		// Stream type: 1=stdout, 2=stderr
-		switch header[0] {
-		case 1:
-			stdoutBuf.Write(payload)
-		case 2:
-			stderrBuf.Write(payload)
-		}
+	var combinedBuf *bytes.Buffer
+	if combined {
+		combinedBuf = getLogBuffer()
+		defer putLogBuffer(combinedBuf)
+		stdout = io.MultiWriter(stdout, combinedBuf)
+		stderr = io.MultiWriter(stderr, combinedBuf)
+	}
+
+	var stdoutTS, stderrTS *timestampWriter
+	if timestamps {
+		stdoutTS, stderrTS = &timestampWriter{out: stdout}, &timestampWriter{out: stderr}
+		stdout, stderr = stdoutTS, stderrTS
+	}
+	if _, err := stdcopy.StdCopy(stdout, stderr, logs); err != nil {
+		return nil, err
 	}
 
-	return stdoutBuf.String(), stderrBuf.String(), nil
+	captured := &capturedLogs{
+		Stdout: stdoutBuf.String(),
+		Stderr: stderrBuf.String(),
+	}
+	if timestamps {
+		captured.StdoutTimes, captured.StderrTimes = stdoutTS.times, stderrTS.times
+	}
+	if combinedBuf != nil {
+		captured.Combined = combinedBuf.String()
+	}
+	return captured, nil
 }
 
 // applyDefaults fills in missing configuration values
@@ -381,6 +1166,9 @@ func applyDefaults(meta *clientpkg.Metadata, cfg *config.Config) *clientpkg.Meta
 	if meta.Config.TimeoutSeconds == 0 {
 		meta.Config.TimeoutSeconds = cfg.Defaults.Timeout
 	}
+	if meta.Config.InstallTimeoutSeconds == 0 {
+		meta.Config.InstallTimeoutSeconds = cfg.Defaults.InstallTimeout
+	}
 	if meta.Config.MemoryMB == 0 {
 		meta.Config.MemoryMB = cfg.Defaults.MemoryMB
 	}
@@ -390,6 +1178,21 @@ func applyDefaults(meta *clientpkg.Metadata, cfg *config.Config) *clientpkg.Meta
 	if meta.Config.CPUShares == 0 {
 		meta.Config.CPUShares = cfg.Defaults.CPUShares
 	}
+	if meta.Config.BlkioWeight == 0 {
+		meta.Config.BlkioWeight = cfg.Defaults.BlkioWeight
+	}
+	if meta.Config.DiskReadBps == 0 {
+		meta.Config.DiskReadBps = cfg.Defaults.DiskReadBps
+	}
+	if meta.Config.DiskWriteBps == 0 {
+		meta.Config.DiskWriteBps = cfg.Defaults.DiskWriteBps
+	}
+	if cfg.Defaults.InstallNetworkOnly {
+		meta.Config.InstallNetworkOnly = true
+	}
+	if cfg.Defaults.StripANSI {
+		meta.Config.StripANSI = true
+	}
 
 	return meta
 }
@@ -3,14 +3,24 @@ package executor
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"io"
 	"os"
+	"path"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/geraldthewes/python-executor/internal/config"
 	"github.com/geraldthewes/python-executor/pkg/client"
+	dockerspec "github.com/moby/docker-image-spec/specs-go/v1"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 func TestApplyDefaults_PreservesNetworkDisabled(t *testing.T) {
@@ -133,7 +143,34 @@ func TestApplyDefaults_DoesNotOverrideExplicitValues(t *testing.T) {
 	}
 }
 
-func TestBuildCommand_WithRequirements(t *testing.T) {
+func TestResources_DiskIO(t *testing.T) {
+	cfg := &config.Config{Docker: config.DockerConfig{BlkioDevices: []string{"/dev/sda", "/dev/nvme0n1"}}}
+	executor := &DockerExecutor{config: cfg}
+
+	meta := &client.Metadata{Config: &client.ExecutionConfig{
+		MemoryMB:     256,
+		BlkioWeight:  100,
+		DiskWriteBps: 10 << 20,
+	}}
+	resources := executor.resources(meta)
+
+	if resources.Memory != 256<<20 || resources.BlkioWeight != 100 {
+		t.Errorf("resources = %+v", resources)
+	}
+	if len(resources.BlkioDeviceReadBps) != 0 {
+		t.Errorf("read limits %v set without a read rate", resources.BlkioDeviceReadBps)
+	}
+	if len(resources.BlkioDeviceWriteBps) != 2 {
+		t.Fatalf("write limits = %v, want one per device", resources.BlkioDeviceWriteBps)
+	}
+	for i, device := range cfg.Docker.BlkioDevices {
+		if got := resources.BlkioDeviceWriteBps[i]; got.Path != device || got.Rate != 10<<20 {
+			t.Errorf("write limit %d = %+v", i, got)
+		}
+	}
+}
+
+func TestInstallCommand_WithRequirements(t *testing.T) {
 	cfg := &config.Config{}
 	executor := &DockerExecutor{config: cfg}
 
@@ -142,7 +179,7 @@ func TestBuildCommand_WithRequirements(t *testing.T) {
 		RequirementsTxt: "requests\nnumpy",
 	}
 
-	cmd := executor.buildCommand(meta)
+	cmd := executor.installCommand(meta)
 
 	// Should contain echo to create requirements.txt
 	if !strings.Contains(cmd, "echo") {
@@ -155,9 +192,14 @@ func TestBuildCommand_WithRequirements(t *testing.T) {
 	if !strings.Contains(cmd, "pip install") {
 		t.Error("Command should contain pip install")
 	}
-	// Should contain python execution
-	if !strings.Contains(cmd, "python") && !strings.Contains(cmd, "main.py") {
-		t.Error("Command should contain python main.py")
+
+	// The script runs in its own container
+	runCmd := executor.buildCommand(meta)
+	if strings.Contains(runCmd, "pip install") {
+		t.Errorf("Run command should not install requirements, got: %s", runCmd)
+	}
+	if !strings.Contains(runCmd, "python") || !strings.Contains(runCmd, "main.py") {
+		t.Errorf("Run command should contain python main.py, got: %s", runCmd)
 	}
 }
 
@@ -181,7 +223,60 @@ func TestBuildCommand_WithoutRequirements(t *testing.T) {
 	}
 }
 
-func TestBuildCommand_WithPreCommands(t *testing.T) {
+func TestNeedsInstall(t *testing.T) {
+	tests := []struct {
+		name string
+		meta *client.Metadata
+		want bool
+	}{
+		{name: "nothing to install", meta: &client.Metadata{Entrypoint: "main.py"}, want: false},
+		{name: "requirements", meta: &client.Metadata{RequirementsTxt: "requests"}, want: true},
+		{name: "pre-commands", meta: &client.Metadata{PreCommands: []string{"apt-get update"}}, want: true},
+		{name: "freeze only", meta: &client.Metadata{Config: &client.ExecutionConfig{FreezePackages: true}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsInstall(tt.meta); got != tt.want {
+				t.Errorf("needsInstall() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPackages(t *testing.T) {
+	stdout := "Successfully installed requests-2.32.3\n" + PackagesMarker + "\nrequests==2.32.3\nurllib3==2.2.3\n"
+
+	rest, packages := splitPackages(stdout)
+	if rest != "Successfully installed requests-2.32.3\n" {
+		t.Errorf("stdout = %q, want install output only", rest)
+	}
+	want := []string{"requests==2.32.3", "urllib3==2.2.3"}
+	if strings.Join(packages, ",") != strings.Join(want, ",") {
+		t.Errorf("packages = %v, want %v", packages, want)
+	}
+
+	rest, packages = splitPackages("no marker\n")
+	if rest != "no marker\n" || packages != nil {
+		t.Errorf("splitPackages without marker = %q, %v", rest, packages)
+	}
+}
+
+func TestInstallCommand_FreezePackages(t *testing.T) {
+	executor := &DockerExecutor{config: &config.Config{}}
+
+	meta := &client.Metadata{
+		RequirementsTxt: "requests",
+		Config:          &client.ExecutionConfig{FreezePackages: true},
+	}
+
+	cmd := executor.installCommand(meta)
+	if !strings.HasSuffix(cmd, "echo "+PackagesMarker+" && pip freeze") {
+		t.Errorf("Command should end with pip freeze, got: %s", cmd)
+	}
+}
+
+func TestInstallCommand_WithPreCommands(t *testing.T) {
 	cfg := &config.Config{}
 	executor := &DockerExecutor{config: cfg}
 
@@ -190,7 +285,7 @@ func TestBuildCommand_WithPreCommands(t *testing.T) {
 		PreCommands: []string{"echo 'setup'", "mkdir -p /data"},
 	}
 
-	cmd := executor.buildCommand(meta)
+	cmd := executor.installCommand(meta)
 
 	// Should contain pre-commands
 	if !strings.Contains(cmd, "echo 'setup'") {
@@ -201,7 +296,43 @@ func TestBuildCommand_WithPreCommands(t *testing.T) {
 	}
 }
 
-func TestBuildCommand_RequirementsEscapesSingleQuotes(t *testing.T) {
+func TestInstallStages(t *testing.T) {
+	executor := &DockerExecutor{config: &config.Config{}}
+
+	// Without install_network_only, one container installs everything
+	meta := &client.Metadata{
+		RequirementsTxt: "requests",
+		PreCommands:     []string{"python setup_data.py"},
+		Config:          &client.ExecutionConfig{},
+	}
+	stages := executor.installStages(meta)
+	if len(stages) != 1 || !stages[0].network || !stages[0].files || stages[0].cmd != executor.installCommand(meta) {
+		t.Errorf("stages = %+v, want one networked stage with the files", stages)
+	}
+
+	// With it, pip install gets the network without the user's files, and
+	// pre-commands run offline with them
+	meta.Config = &client.ExecutionConfig{InstallNetworkOnly: true, FreezePackages: true}
+	stages = executor.installStages(meta)
+	if len(stages) != 2 {
+		t.Fatalf("stages = %+v, want 2", stages)
+	}
+	if !stages[0].network || stages[0].files || !strings.Contains(stages[0].cmd, "pip install") || strings.Contains(stages[0].cmd, "setup_data.py") {
+		t.Errorf("first stage = %+v, want pip install alone with the network", stages[0])
+	}
+	if stages[1].network || !stages[1].files || stages[1].cmd != "python setup_data.py && echo "+PackagesMarker+" && pip freeze" {
+		t.Errorf("second stage = %+v, want pre-commands offline", stages[1])
+	}
+
+	// Pre-commands alone run offline
+	meta.RequirementsTxt = ""
+	stages = executor.installStages(meta)
+	if len(stages) != 1 || stages[0].network {
+		t.Errorf("stages = %+v, want one offline stage", stages)
+	}
+}
+
+func TestInstallCommand_RequirementsEscapesSingleQuotes(t *testing.T) {
 	cfg := &config.Config{}
 	executor := &DockerExecutor{config: cfg}
 
@@ -210,7 +341,7 @@ func TestBuildCommand_RequirementsEscapesSingleQuotes(t *testing.T) {
 		RequirementsTxt: "package[extra]>=1.0",
 	}
 
-	cmd := executor.buildCommand(meta)
+	cmd := executor.installCommand(meta)
 
 	// Command should be properly escaped for shell
 	if !strings.Contains(cmd, "package[extra]>=1.0") {
@@ -342,6 +473,94 @@ func TestBuildCommand_WithoutEvalLastExpr(t *testing.T) {
 	}
 }
 
+func TestBuildCommand_Pytest(t *testing.T) {
+	cfg := &config.Config{}
+	executor := &DockerExecutor{config: cfg}
+
+	tests := []struct {
+		name string
+		meta *client.Metadata
+		want string
+	}{
+		{
+			name: "whole directory",
+			meta: &client.Metadata{Mode: client.ModePytest},
+			want: "python -m pytest -p no:cacheprovider --junitxml=" + JUnitReportFile,
+		},
+		{
+			name: "path and arguments",
+			meta: &client.Metadata{Mode: client.ModePytest, Entrypoint: "tests", ScriptArgs: []string{"-k", "add or sub"}},
+			want: "python -m pytest -p no:cacheprovider --junitxml=" + JUnitReportFile + " tests -k 'add or sub'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cmd := executor.buildCommand(tt.meta); cmd != tt.want {
+				t.Errorf("buildCommand() = %q, want %q", cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCommand_Coverage(t *testing.T) {
+	cfg := &config.Config{}
+	executor := &DockerExecutor{config: cfg}
+
+	tests := []struct {
+		name    string
+		meta    *client.Metadata
+		wantRun string
+	}{
+		{
+			name:    "script",
+			meta:    &client.Metadata{Entrypoint: "main.py", ScriptArgs: []string{"x"}, Config: &client.ExecutionConfig{Coverage: true}},
+			wantRun: coverageRun + " /work/main.py x;",
+		},
+		{
+			name:    "pytest",
+			meta:    &client.Metadata{Mode: client.ModePytest, Config: &client.ExecutionConfig{Coverage: true}},
+			wantRun: coverageRun + " -m pytest",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := executor.buildCommand(tt.meta)
+			if !strings.HasPrefix(cmd, "export COVERAGE_FILE="+CoverageDataFile+"; ") {
+				t.Errorf("command should set the data file first, got: %s", cmd)
+			}
+			if !strings.Contains(cmd, tt.wantRun) {
+				t.Errorf("command should contain %q, got: %s", tt.wantRun, cmd)
+			}
+			if !strings.Contains(cmd, "coverage xml") || !strings.Contains(cmd, "coverage html") {
+				t.Errorf("command should write both reports, got: %s", cmd)
+			}
+			if !strings.HasSuffix(cmd, "exit $status") {
+				t.Errorf("command should keep the exit code, got: %s", cmd)
+			}
+		})
+	}
+}
+
+func TestGzipLimited(t *testing.T) {
+	data, err := gzipLimited(strings.NewReader("report"), 10)
+	if err != nil {
+		t.Fatalf("gzipLimited() error = %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != "report" {
+		t.Errorf("decompressed = %q, want %q", got, "report")
+	}
+
+	if _, err := gzipLimited(strings.NewReader("a much longer report"), 10); err == nil {
+		t.Error("expected an error over the limit")
+	}
+}
+
 func TestGetEvalWrapperCode(t *testing.T) {
 	code := GetEvalWrapperCode()
 
@@ -360,6 +579,422 @@ func TestGetEvalWrapperCode(t *testing.T) {
 	}
 }
 
+func TestEvalWrapperTar(t *testing.T) {
+	tr := tar.NewReader(bytes.NewReader(evalWrapperTar))
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("reading wrapper tar: %v", err)
+	}
+	if hdr.Name != EvalWrapperScript {
+		t.Errorf("name = %q, want %q", hdr.Name, EvalWrapperScript)
+	}
+
+	var buf bytes.Buffer
+	buf.ReadFrom(tr)
+	if buf.String() != GetEvalWrapperCode() {
+		t.Error("wrapper tar content does not match the wrapper code")
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	meta := &client.Metadata{
+		DockerImage: "python:3.12-slim",
+		Config:      &client.ExecutionConfig{TimeoutSeconds: 300, MemoryMB: 1024},
+	}
+	inspect := &image.InspectResponse{
+		ID:           "sha256:abc",
+		RepoDigests:  []string{"python@sha256:def"},
+		Os:           "linux",
+		Architecture: "arm64",
+		Variant:      "v8",
+		Config: &dockerspec.DockerOCIImageConfig{
+			ImageConfig: ocispec.ImageConfig{Env: []string{"PATH=/usr/local/bin", "PYTHON_VERSION=3.12.7"}},
+		},
+	}
+
+	m := newManifest(meta, inspect)
+	if m.Image != "python:3.12-slim" || m.ImageDigest != "python@sha256:def" || m.ImageID != "sha256:abc" {
+		t.Errorf("image fields = %+v", m)
+	}
+	if m.Platform != "linux/arm64/v8" {
+		t.Errorf("platform = %q, want linux/arm64/v8", m.Platform)
+	}
+	if m.PythonVersion != "3.12.7" {
+		t.Errorf("python version = %q, want 3.12.7", m.PythonVersion)
+	}
+	if m.Config == meta.Config || m.Config.TimeoutSeconds != 300 {
+		t.Errorf("config should be a copy of the effective config, got %+v", m.Config)
+	}
+
+	m = newManifest(meta, nil)
+	if m.Image != "python:3.12-slim" || m.ImageDigest != "" || m.Config == nil {
+		t.Errorf("manifest without inspect = %+v", m)
+	}
+}
+
+func TestCPUUsage(t *testing.T) {
+	s := &container.StatsResponse{}
+	if cpuUsage(s) != nil {
+		t.Error("empty sample should be ignored")
+	}
+
+	s.CPUStats.CPUUsage = container.CPUUsage{
+		TotalUsage:        1_500_000_000,
+		UsageInUsermode:   1_200_000_000,
+		UsageInKernelmode: 300_000_000,
+	}
+	s.CPUStats.ThrottlingData.ThrottledTime = 50_000_000
+
+	got := cpuUsage(s)
+	want := client.CPUUsage{UserMs: 1200, SystemMs: 300, ThrottledMs: 50}
+	if got == nil || *got != want {
+		t.Errorf("cpuUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDemuxLogs_Combined(t *testing.T) {
+	var stream bytes.Buffer
+	stdoutW := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderrW := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+
+	stdoutW.Write([]byte("loading\n"))
+	stderrW.Write([]byte("Traceback (most recent call last):\n"))
+	stdoutW.Write([]byte("cleanup\n"))
+
+	logs, err := demuxLogs(&stream, nil, nil, true, false)
+	if err != nil {
+		t.Fatalf("demuxLogs() error = %v", err)
+	}
+
+	if want := "loading\nTraceback (most recent call last):\ncleanup\n"; logs.Combined != want {
+		t.Errorf("combined = %q, want %q", logs.Combined, want)
+	}
+	if logs.Stdout != "loading\ncleanup\n" {
+		t.Errorf("stdout = %q", logs.Stdout)
+	}
+}
+
+func TestStreamOutput(t *testing.T) {
+	var stream bytes.Buffer
+	stdoutW := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderrW := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+
+	stdoutW.Write([]byte("epoch 1\n"))
+	stderrW.Write([]byte("warning\n"))
+	stdoutW.Write([]byte("epoch 2\n"))
+
+	// Each frame arrives on its own, in order
+	var frames []string
+	err := streamOutput(&stream, func(stream client.OutputStream, data []byte) {
+		frames = append(frames, string(stream)+": "+string(data))
+	})
+	if err != nil {
+		t.Fatalf("streamOutput() error = %v", err)
+	}
+
+	want := []string{"stdout: epoch 1\n", "stderr: warning\n", "stdout: epoch 2\n"}
+	if strings.Join(frames, "|") != strings.Join(want, "|") {
+		t.Errorf("frames = %q, want %q", frames, want)
+	}
+}
+
+func TestContainerEnv_FollowedOutput(t *testing.T) {
+	req := &ExecutionRequest{OnOutput: func(client.OutputStream, []byte) {}}
+	meta := &client.Metadata{Config: &client.ExecutionConfig{}}
+	executor := &DockerExecutor{config: &config.Config{}}
+
+	// Python buffers output to a pipe unless told otherwise
+	env := executor.containerEnv(req, meta)
+	if len(env) != 1 || env[0] != "PYTHONUNBUFFERED=1" {
+		t.Errorf("env = %v, want PYTHONUNBUFFERED=1", env)
+	}
+}
+
+func TestCapturedLogs_StripANSI(t *testing.T) {
+	logs := &capturedLogs{
+		Stdout:   "\x1b[1;32mok\x1b[0m\n\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\\n",
+		Stderr:   " 50%|\x1b[32m█████\x1b[0m| 5/10\r\x1b[2K\n",
+		Combined: "\x1b[31merror\x1b[0m\n",
+	}
+
+	logs.stripANSI()
+
+	if logs.Stdout != "ok\nlink\n" {
+		t.Errorf("stdout = %q", logs.Stdout)
+	}
+	if logs.Stderr != " 50%|█████| 5/10\r\n" {
+		t.Errorf("stderr = %q", logs.Stderr)
+	}
+	if logs.Combined != "error\n" {
+		t.Errorf("combined = %q", logs.Combined)
+	}
+}
+
+func TestDemuxLogs_Timestamps(t *testing.T) {
+	var stream bytes.Buffer
+	stdoutW := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+
+	stdoutW.Write([]byte("2024-01-15T10:30:01.000000001Z line 1\n"))
+	// A long line Docker split into two frames
+	stdoutW.Write([]byte("2024-01-15T10:30:02.000000001Z long "))
+	stdoutW.Write([]byte("2024-01-15T10:30:03.000000001Z line\n"))
+
+	logs, err := demuxLogs(&stream, nil, nil, false, true)
+	if err != nil {
+		t.Fatalf("demuxLogs() error = %v", err)
+	}
+
+	if logs.Stdout != "line 1\nlong line\n" {
+		t.Errorf("stdout = %q, want timestamps stripped", logs.Stdout)
+	}
+	if len(logs.StdoutTimes) != 2 {
+		t.Fatalf("got %d stdout times, want one per line", len(logs.StdoutTimes))
+	}
+	if want := time.Date(2024, 1, 15, 10, 30, 2, 1, time.UTC); !logs.StdoutTimes[1].Equal(want) {
+		t.Errorf("second line time = %v, want %v", logs.StdoutTimes[1], want)
+	}
+
+	// Unless they were asked for, output that looks like a timestamp is
+	// the script's own
+	stream.Reset()
+	stdoutW.Write([]byte("2024-01-15T10:30:01.000000001Z started\n"))
+	logs, err = demuxLogs(&stream, nil, nil, false, false)
+	if err != nil {
+		t.Fatalf("demuxLogs() error = %v", err)
+	}
+	if logs.Stdout != "2024-01-15T10:30:01.000000001Z started\n" || logs.StdoutTimes != nil {
+		t.Errorf("stdout = %q with %d times, want it as written", logs.Stdout, len(logs.StdoutTimes))
+	}
+}
+
+func TestContainerLabels(t *testing.T) {
+	req := &ExecutionRequest{ID: "exe_123", Tenant: "team-a", APIKeyName: "ci"}
+	meta := &client.Metadata{DockerImage: "python:3.12-slim"}
+
+	labels := containerLabels(req, meta)
+
+	expected := map[string]string{
+		LabelManaged:     "true",
+		LabelExecutionID: "exe_123",
+		LabelImage:       "python:3.12-slim",
+		LabelTenant:      "team-a",
+		LabelAPIKey:      "ci",
+	}
+	for k, v := range expected {
+		if labels[k] != v {
+			t.Errorf("label %s = %q, want %q", k, labels[k], v)
+		}
+	}
+}
+
+func TestContainerLabels_OmitsEmptyIdentity(t *testing.T) {
+	req := &ExecutionRequest{ID: "exe_123"}
+	meta := &client.Metadata{DockerImage: "python:3.12-slim"}
+
+	labels := containerLabels(req, meta)
+
+	if _, ok := labels[LabelTenant]; ok {
+		t.Error("tenant label should be omitted when empty")
+	}
+	if _, ok := labels[LabelAPIKey]; ok {
+		t.Error("api key label should be omitted when empty")
+	}
+}
+
+func TestDemuxLogs(t *testing.T) {
+	var stream bytes.Buffer
+	stdoutW := stdcopy.NewStdWriter(&stream, stdcopy.Stdout)
+	stderrW := stdcopy.NewStdWriter(&stream, stdcopy.Stderr)
+
+	stdoutW.Write([]byte("line 1\n"))
+	stderrW.Write([]byte("warning\n"))
+	stdoutW.Write([]byte("line 2\n"))
+
+	var sink bytes.Buffer
+	logs, err := demuxLogs(&stream, &sink, nil, false, false)
+	if err != nil {
+		t.Fatalf("demuxLogs() error = %v", err)
+	}
+	stdout, stderr := logs.Stdout, logs.Stderr
+
+	if stdout != "line 1\nline 2\n" {
+		t.Errorf("stdout = %q", stdout)
+	}
+	if stderr != "warning\n" {
+		t.Errorf("stderr = %q", stderr)
+	}
+	if sink.String() != stdout {
+		t.Errorf("stdout writer got %q, want %q", sink.String(), stdout)
+	}
+}
+
+func TestParseResultFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{name: "object", content: `{"accuracy": 0.93}`, want: `{"accuracy": 0.93}`},
+		{name: "array", content: `[1, 2, 3]`, want: `[1, 2, 3]`},
+		{name: "invalid JSON", content: `{"accuracy":`, wantErr: true},
+		{name: "too large", content: `"` + strings.Repeat("x", MaxResultFileSize) + `"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := createTar(map[string]string{"result.json": tt.content})
+			if err != nil {
+				t.Fatalf("createTar() error = %v", err)
+			}
+
+			got, err := parseResultFile(bytes.NewReader(data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResultFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parseResultFile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImages(t *testing.T) {
+	data, err := createTar(map[string]string{
+		"output/figure_1.png":  "png data",
+		"output/sub/chart.SVG": "<svg/>",
+		"output/result.json":   "{}",
+		"output/notes.txt":     "text",
+	})
+	if err != nil {
+		t.Fatalf("createTar() error = %v", err)
+	}
+
+	images, err := parseImages(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("parseImages() error = %v", err)
+	}
+
+	got := map[string]client.Artifact{}
+	for _, img := range images {
+		got[img.Name] = img
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d images, want 2: %v", len(got), images)
+	}
+	if png := got["figure_1.png"]; png.ContentType != "image/png" || string(png.Data) != "png data" || png.Size != 8 {
+		t.Errorf("figure_1.png = %+v", png)
+	}
+	if svg := got["sub/chart.SVG"]; svg.ContentType != "image/svg+xml" {
+		t.Errorf("sub/chart.SVG content type = %q", svg.ContentType)
+	}
+}
+
+func TestRepackOutput(t *testing.T) {
+	data, err := createTar(map[string]string{
+		"output/model.pkl":     "weights",
+		"output/data/rows.csv": "a,b\n",
+	})
+	if err != nil {
+		t.Fatalf("createTar() error = %v", err)
+	}
+
+	archive, err := repackOutput(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("repackOutput() error = %v", err)
+	}
+
+	got := map[string]string{}
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("reading repacked archive: %v", err)
+		}
+		content, _ := io.ReadAll(tr)
+		got[hdr.Name] = string(content)
+	}
+	if len(got) != 2 || got["model.pkl"] != "weights" || got["data/rows.csv"] != "a,b\n" {
+		t.Errorf("repacked files = %v, want them relative to the output directory", got)
+	}
+}
+
+func TestContainerEnv_CaptureImages(t *testing.T) {
+	req := &ExecutionRequest{Env: []string{"SERVER=1"}}
+	meta := &client.Metadata{
+		EnvVars: []string{"MPLBACKEND=Agg"},
+		Config:  &client.ExecutionConfig{CaptureImages: true},
+	}
+
+	executor := &DockerExecutor{config: &config.Config{}}
+	env := executor.containerEnv(req, meta)
+
+	// The user's MPLBACKEND must come after ours so it takes precedence
+	want := []string{"MPLBACKEND=module://" + PlotBackendModule, "PYTHONPATH=/work", "MPLBACKEND=Agg", "SERVER=1"}
+	if strings.Join(env, " ") != strings.Join(want, " ") {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+
+	meta.Config.CaptureImages = false
+	if env := executor.containerEnv(req, meta); len(env) != 2 {
+		t.Errorf("env without capture = %v", env)
+	}
+}
+
+func TestContainerEnv_Deterministic(t *testing.T) {
+	req := &ExecutionRequest{}
+	meta := &client.Metadata{
+		EnvVars: []string{"TZ=Europe/Paris"},
+		Config: &client.ExecutionConfig{
+			CaptureImages: true,
+			Deterministic: true,
+			Seed:          42,
+			FakeTime:      "2024-01-01T12:00:00+02:00",
+		},
+	}
+	executor := &DockerExecutor{config: &config.Config{Docker: config.DockerConfig{FakeTimeLib: "/lib/libfaketime.so.1"}}}
+
+	// Both modules' directories are on the path, and the clock is frozen in UTC
+	env := executor.containerEnv(req, meta)
+	want := []string{
+		"MPLBACKEND=module://" + PlotBackendModule,
+		"PYTHONHASHSEED=42",
+		"PYEXEC_SEED=42",
+		"LD_PRELOAD=/lib/libfaketime.so.1",
+		"FAKETIME=2024-01-01 10:00:00",
+		"FAKETIME_DONT_FAKE_MONOTONIC=1",
+		"TZ=UTC",
+		"PYTHONPATH=/work:" + SeedModuleDir,
+		"TZ=Europe/Paris",
+	}
+	if strings.Join(env, " ") != strings.Join(want, " ") {
+		t.Errorf("env = %v, want %v", env, want)
+	}
+
+	// The seed module is installed next to the user's files
+	tr := tar.NewReader(bytes.NewReader(seedModuleTar))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if want := "_pyexec_seed/sitecustomize.py"; !slices.Contains(names, want) || "/work/"+path.Dir(want) != SeedModuleDir {
+		t.Errorf("seed module tar = %v, want %s", names, want)
+	}
+
+	// A fake clock works on its own
+	meta.Config = &client.ExecutionConfig{FakeTime: "2024-01-01T00:00:00Z"}
+	if env := executor.containerEnv(req, meta); len(env) != 5 || env[1] != "FAKETIME=2024-01-01 00:00:00" {
+		t.Errorf("env with only a fake clock = %v", env)
+	}
+}
+
 // Helper function to create a tar archive from file contents
 func createTar(files map[string]string) ([]byte, error) {
 	var buf bytes.Buffer
@@ -581,3 +1216,86 @@ func TestExecute_WithoutStdin(t *testing.T) {
 		t.Errorf("Expected stdout to contain greeting, got: %s", output.Stdout)
 	}
 }
+
+func TestParseSessionReply(t *testing.T) {
+	output, err := parseSessionReply([]byte(`{"result": "42", "stdout": "hi\n", "stderr": ""}`))
+	if err != nil {
+		t.Fatalf("parseSessionReply() error = %v", err)
+	}
+	if output.Result == nil || *output.Result != "42" || output.Stdout != "hi\n" {
+		t.Errorf("parseSessionReply() = %+v", output)
+	}
+
+	output, _ = parseSessionReply([]byte(`{"error": "NameError: name 'y' is not defined", "error_type": "NameError", "traceback": "Traceback", "stdout": "", "stderr": "Traceback"}`))
+	if output.Result != nil || output.ErrorType != "NameError" || output.Traceback != "Traceback" {
+		t.Errorf("parseSessionReply() of error = %+v", output)
+	}
+
+	if _, err := parseSessionReply(nil); err == nil {
+		t.Error("parseSessionReply() of empty reply succeeded")
+	}
+}
+
+func TestSession_KeepsState(t *testing.T) {
+	skipIfNoDocker(t)
+
+	cfg := &config.Config{
+		Docker: config.DockerConfig{
+			Socket:      "/var/run/docker.sock",
+			NetworkMode: "bridge",
+		},
+		Defaults: config.DefaultsConfig{
+			Timeout:     30,
+			MemoryMB:    512,
+			DiskMB:      1024,
+			CPUShares:   512,
+			DockerImage: "python:3.12-slim",
+		},
+	}
+
+	executor, err := NewDockerExecutor(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	defer executor.Close()
+
+	tarData, err := createTar(map[string]string{"helpers.py": "def double(x):\n    return 2 * x\n"})
+	if err != nil {
+		t.Fatalf("Failed to create tar: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	session, err := executor.StartSession(ctx, &SessionRequest{
+		TarData:     tarData,
+		Metadata:    &client.Metadata{},
+		IdleTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("StartSession failed: %v", err)
+	}
+	defer executor.CloseSession(context.Background(), session)
+
+	if _, err := executor.EvalSession(ctx, session, "from helpers import double\nx = 21"); err != nil {
+		t.Fatalf("EvalSession failed: %v", err)
+	}
+	output, err := executor.EvalSession(ctx, session, "print('x is', x)\ndouble(x)")
+	if err != nil {
+		t.Fatalf("EvalSession failed: %v", err)
+	}
+	if output.Result == nil || *output.Result != "42" || output.Stdout != "x is 21\n" {
+		t.Errorf("EvalSession() = %+v, want result 42 and the printed x", output)
+	}
+
+	// An interrupted call leaves the state in place
+	evalCtx, cancelEval := context.WithTimeout(ctx, time.Second)
+	defer cancelEval()
+	if _, err := executor.EvalSession(evalCtx, session, "import time\ntime.sleep(30)"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("EvalSession() of a sleep error = %v, want ErrTimeout", err)
+	}
+	output, err = executor.EvalSession(ctx, session, "x")
+	if err != nil || output.Result == nil || *output.Result != "21" {
+		t.Errorf("EvalSession() after timeout = %+v, %v", output, err)
+	}
+}
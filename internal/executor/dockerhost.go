@@ -0,0 +1,201 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerHost is the Docker daemon address an executor uses, and where it
+// was found
+type DockerHost struct {
+	Host   string // e.g. unix:///var/run/docker.sock or tcp://docker:2376
+	Source string // e.g. "DOCKER_HOST" or "colima socket"
+
+	// CertPath and SkipTLSVerify are the TLS settings of the docker CLI
+	// context the host came from, if it has TLS material
+	CertPath      string
+	SkipTLSVerify bool
+}
+
+// wellKnownSockets are the sockets of the usual Docker installations,
+// relative to the home directory unless absolute, in the order tried
+var wellKnownSockets = []struct {
+	path   string
+	source string
+}{
+	{"/var/run/docker.sock", "Docker Engine socket"},
+	{".docker/run/docker.sock", "Docker Desktop socket"},
+	{".docker/desktop/docker.sock", "Docker Desktop socket"},
+	{".colima/default/docker.sock", "colima socket"},
+	{".colima/docker.sock", "colima socket"},
+	{".rd/docker.sock", "Rancher Desktop socket"},
+}
+
+// FindDockerHost works out the Docker daemon to use, the way the docker CLI
+// does: socket (PYEXEC_DOCKER_SOCKET) if set, then the DOCKER_CONTEXT
+// context, DOCKER_HOST and the CLI's current context. Failing those, the
+// first of the well-known sockets of Docker Engine, Docker Desktop, colima,
+// Rancher Desktop and rootless Docker that exists. The error lists what was
+// tried.
+func FindDockerHost(socket string, getenv func(string) string) (DockerHost, error) {
+	if socket != "" {
+		if !strings.Contains(socket, "://") {
+			socket = "unix://" + socket
+		}
+		return DockerHost{Host: socket, Source: "PYEXEC_DOCKER_SOCKET"}, nil
+	}
+
+	configDir := getenv("DOCKER_CONFIG")
+	home := getenv("HOME")
+	if configDir == "" && home != "" {
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	if name := getenv("DOCKER_CONTEXT"); name != "" && name != "default" {
+		host, err := contextHost(configDir, name)
+		if err != nil {
+			return DockerHost{}, fmt.Errorf("DOCKER_CONTEXT %s: %w", name, err)
+		}
+		return host, nil
+	}
+	if host := getenv("DOCKER_HOST"); host != "" {
+		return DockerHost{Host: host, Source: "DOCKER_HOST"}, nil
+	}
+
+	tried := []string{"DOCKER_HOST (unset)"}
+	if name := currentContext(configDir); name != "" && name != "default" {
+		host, err := contextHost(configDir, name)
+		if err == nil {
+			return host, nil
+		}
+		tried = append(tried, fmt.Sprintf("docker context %s (%v)", name, err))
+	}
+
+	type candidate struct{ path, source string }
+	var candidates []candidate
+	for _, s := range wellKnownSockets {
+		path := s.path
+		if !filepath.IsAbs(path) {
+			if home == "" {
+				continue
+			}
+			path = filepath.Join(home, path)
+		}
+		candidates = append(candidates, candidate{path, s.source})
+	}
+	if dir := getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, candidate{filepath.Join(dir, "docker.sock"), "rootless Docker socket"})
+	}
+	for _, c := range candidates {
+		if info, err := os.Stat(c.path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return DockerHost{Host: "unix://" + c.path, Source: c.source}, nil
+		}
+		tried = append(tried, c.path)
+	}
+	return DockerHost{}, fmt.Errorf("no Docker daemon found; set DOCKER_HOST or PYEXEC_DOCKER_SOCKET (tried %s)", strings.Join(tried, ", "))
+}
+
+// currentContext returns the docker CLI's current context, "" if it has
+// none
+func currentContext(configDir string) string {
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	json.Unmarshal(data, &cfg)
+	return cfg.CurrentContext
+}
+
+// contextHost returns the Docker endpoint of a docker CLI context, read
+// from its metadata under contexts/meta/<sha256 of the name>/, with the
+// TLS material under contexts/tls/<sha256 of the name>/docker/ if any
+func contextHost(configDir, name string) (DockerHost, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := hex.EncodeToString(sum[:])
+	data, err := os.ReadFile(filepath.Join(configDir, "contexts", "meta", id, "meta.json"))
+	if err != nil {
+		return DockerHost{}, fmt.Errorf("reading context: %w", err)
+	}
+	var meta struct {
+		Endpoints struct {
+			Docker struct {
+				Host          string `json:"Host"`
+				SkipTLSVerify bool   `json:"SkipTLSVerify"`
+			} `json:"docker"`
+		} `json:"Endpoints"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return DockerHost{}, fmt.Errorf("reading context: %w", err)
+	}
+	if meta.Endpoints.Docker.Host == "" {
+		return DockerHost{}, fmt.Errorf("context has no Docker endpoint")
+	}
+
+	host := DockerHost{
+		Host:          meta.Endpoints.Docker.Host,
+		Source:        "docker context " + name,
+		SkipTLSVerify: meta.Endpoints.Docker.SkipTLSVerify,
+	}
+	if dir := filepath.Join(configDir, "contexts", "tls", id, "docker"); isDir(dir) {
+		host.CertPath = dir
+	}
+	return host, nil
+}
+
+// isDir reports whether path is a directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dockerTLSConfig returns the TLS configuration of a connection to a
+// tcp:// daemon, nil for other daemons or without TLS material. certPath
+// holds the material as in DOCKER_CERT_PATH: ca.pem, the CA the daemon's
+// certificate is verified against (the system's roots without it), and
+// cert.pem and key.pem, the client certificate the daemon may require.
+func dockerTLSConfig(host, certPath string, verify bool) (*tls.Config, error) {
+	if certPath == "" || !(strings.HasPrefix(host, "tcp://") || strings.HasPrefix(host, "https://")) {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: !verify,
+	}
+
+	caFile := filepath.Join(certPath, "ca.pem")
+	ca, err := os.ReadFile(caFile)
+	switch {
+	case err == nil:
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	certFile, keyFile := filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem")
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil || keyErr == nil {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
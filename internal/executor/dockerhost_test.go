@@ -0,0 +1,180 @@
+package executor
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenUnix creates a unix socket at path
+func listenUnix(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("cannot create unix socket: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+}
+
+// writeContext stores a docker CLI context whose endpoint is host
+func writeContext(t *testing.T, configDir, name, host string) {
+	t.Helper()
+	sum := sha256.Sum256([]byte(name))
+	dir := filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(sum[:]))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	meta := `{"Name":"` + name + `","Endpoints":{"docker":{"Host":"` + host + `","SkipTLSVerify":false}}}`
+	if err := os.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDockerHost(t *testing.T) {
+	home := t.TempDir()
+	env := map[string]string{"HOME": home}
+	getenv := func(key string) string { return env[key] }
+	dockerDir := filepath.Join(home, ".docker")
+
+	find := func() DockerHost {
+		t.Helper()
+		host, err := FindDockerHost("", getenv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return host
+	}
+
+	// Nothing found: the error lists what was tried
+	if _, err := os.Stat("/var/run/docker.sock"); err != nil {
+		_, err := FindDockerHost("", getenv)
+		if err == nil || !strings.Contains(err.Error(), ".colima/default/docker.sock") {
+			t.Errorf("error = %v, want the sockets tried", err)
+		}
+
+		colima := filepath.Join(home, ".colima", "default", "docker.sock")
+		listenUnix(t, colima)
+		if got := find(); got.Host != "unix://"+colima || got.Source != "colima socket" {
+			t.Errorf("found %+v, want colima's socket", got)
+		}
+	}
+
+	// The CLI's current context
+	writeContext(t, dockerDir, "remote", "tcp://remote:2376")
+	os.WriteFile(filepath.Join(dockerDir, "config.json"), []byte(`{"currentContext":"remote"}`), 0o644)
+	if got := find(); got.Host != "tcp://remote:2376" || got.Source != "docker context remote" {
+		t.Errorf("found %+v, want the current context", got)
+	}
+
+	// DOCKER_HOST wins over the current context, DOCKER_CONTEXT over both
+	env["DOCKER_HOST"] = "tcp://docker:2375"
+	if got := find(); got.Host != "tcp://docker:2375" {
+		t.Errorf("found %+v, want DOCKER_HOST", got)
+	}
+	writeContext(t, dockerDir, "colima", "unix:///colima.sock")
+	env["DOCKER_CONTEXT"] = "colima"
+	if got := find(); got.Host != "unix:///colima.sock" {
+		t.Errorf("found %+v, want DOCKER_CONTEXT", got)
+	}
+	env["DOCKER_CONTEXT"] = "missing"
+	if _, err := FindDockerHost("", getenv); err == nil {
+		t.Error("a missing DOCKER_CONTEXT was accepted")
+	}
+
+	// PYEXEC_DOCKER_SOCKET wins over everything
+	got, err := FindDockerHost("/run/docker.sock", getenv)
+	if err != nil || got.Host != "unix:///run/docker.sock" {
+		t.Errorf("found %+v, %v, want the configured socket", got, err)
+	}
+}
+
+// writeCert writes a self-signed certificate and its key to certFile and
+// keyFile
+func writeCert(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "docker"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644)
+	if keyFile != "" {
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	}
+}
+
+func TestDockerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, filepath.Join(dir, "ca.pem"), "")
+	writeCert(t, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+
+	cfg, err := dockerTLSConfig("tcp://docker:2376", dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg == nil || cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.InsecureSkipVerify {
+		t.Errorf("config = %+v, want the CA and client certificate, verified", cfg)
+	}
+	if cfg, _ := dockerTLSConfig("tcp://docker:2376", dir, false); cfg == nil || !cfg.InsecureSkipVerify {
+		t.Error("verification was not turned off")
+	}
+
+	// TLS is for tcp:// daemons with TLS material only
+	if cfg, _ := dockerTLSConfig("unix:///var/run/docker.sock", dir, true); cfg != nil {
+		t.Error("TLS configured for a unix socket")
+	}
+	if cfg, _ := dockerTLSConfig("tcp://docker:2375", "", true); cfg != nil {
+		t.Error("TLS configured without material")
+	}
+
+	// A certificate without its key is an error, as is a CA file without
+	// certificates
+	os.Remove(filepath.Join(dir, "key.pem"))
+	if _, err := dockerTLSConfig("tcp://docker:2376", dir, true); err == nil {
+		t.Error("a certificate without its key was accepted")
+	}
+	os.WriteFile(filepath.Join(dir, "ca.pem"), []byte("not a certificate"), 0o644)
+	if _, err := dockerTLSConfig("tcp://docker:2376", dir, true); err == nil {
+		t.Error("an empty CA file was accepted")
+	}
+
+	// A context's TLS material is found with its endpoint
+	configDir := t.TempDir()
+	writeContext(t, configDir, "remote", "tcp://remote:2376")
+	sum := sha256.Sum256([]byte("remote"))
+	tlsDir := filepath.Join(configDir, "contexts", "tls", hex.EncodeToString(sum[:]), "docker")
+	os.MkdirAll(tlsDir, 0o755)
+	host, err := contextHost(configDir, "remote")
+	if err != nil || host.CertPath != tlsDir || host.SkipTLSVerify {
+		t.Errorf("context = %+v, %v, want its TLS material", host, err)
+	}
+}
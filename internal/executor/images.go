@@ -0,0 +1,135 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// OutputDir is the directory scripts write files to for collection
+const OutputDir = "/work/output"
+
+// MaxImagesSize caps the total size of the images returned from OutputDir
+// (5MB). Images past the cap are left out.
+const MaxImagesSize = 5 << 20
+
+// PlotBackendModule is the name of the matplotlib backend module installed
+// when images are captured
+const PlotBackendModule = "_pyexec_mpl"
+
+// plotBackendCode is a headless matplotlib backend. It renders with Agg and
+// saves every open figure to OutputDir when the script calls plt.show(),
+// so scripts written for interactive use still produce images.
+const plotBackendCode = `import os
+
+from matplotlib._pylab_helpers import Gcf
+from matplotlib.backends.backend_agg import FigureCanvasAgg as FigureCanvas  # noqa: F401
+
+_count = 0
+
+
+def show(*args, **kwargs):
+    global _count
+    os.makedirs("` + OutputDir + `", exist_ok=True)
+    for manager in Gcf.get_all_fig_managers():
+        _count += 1
+        manager.canvas.figure.savefig(os.path.join("` + OutputDir + `", "figure_%d.png" % _count))
+    Gcf.destroy_all()
+`
+
+// plotBackendTar is a tar archive holding the matplotlib backend module
+var plotBackendTar = func() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name: PlotBackendModule + ".py",
+		Mode: 0644,
+		Size: int64(len(plotBackendCode)),
+	})
+	tw.Write([]byte(plotBackendCode))
+	tw.Close()
+	return buf.Bytes()
+}()
+
+// plotEnv returns the environment that selects the headless backend. It
+// goes before the user's variables so they can override it; the backend
+// module is found through /work on PYTHONPATH (see containerEnv).
+func plotEnv() []string {
+	return []string{"MPLBACKEND=module://" + PlotBackendModule}
+}
+
+// imageTypes maps the file extensions collected from OutputDir to their
+// content types
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".svg":  "image/svg+xml",
+}
+
+// readImages copies the images under OutputDir out of a stopped container.
+// It returns nil if the directory doesn't exist, and the images read so far
+// along with any error.
+func (e *DockerExecutor) readImages(ctx context.Context, containerID string) ([]clientpkg.Artifact, error) {
+	rc, _, err := e.client.CopyFromContainer(ctx, containerID, OutputDir)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("copying %s: %w", OutputDir, err)
+	}
+	defer rc.Close()
+
+	return parseImages(rc)
+}
+
+// parseImages collects the image files from a tar stream of OutputDir, in
+// archive order, until MaxImagesSize is reached. Names are relative to
+// OutputDir.
+func parseImages(r io.Reader) ([]clientpkg.Artifact, error) {
+	var images []clientpkg.Artifact
+	var total int64
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return images, fmt.Errorf("reading %s: %w", OutputDir, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		contentType, ok := imageTypes[strings.ToLower(path.Ext(hdr.Name))]
+		if !ok || total+hdr.Size > MaxImagesSize {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return images, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		total += int64(len(data))
+
+		// The archive's top-level entry is the directory itself
+		_, name, _ := strings.Cut(hdr.Name, "/")
+		images = append(images, clientpkg.Artifact{
+			Name:        name,
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			Data:        data,
+		})
+	}
+	return images, nil
+}
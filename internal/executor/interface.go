@@ -2,15 +2,75 @@ package executor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
 
 	"github.com/geraldthewes/python-executor/pkg/client"
 )
 
+// ErrTimeout is returned (wrapped) when an execution exceeds its timeout
+var ErrTimeout = errors.New("execution timeout")
+
+// ErrPullTimeout is returned (wrapped) when pulling an execution's image
+// takes longer than the server's pull timeout
+var ErrPullTimeout = errors.New("image pull timeout")
+
+// ErrInstallTimeout is returned (wrapped) when an execution's dependency
+// install takes longer than its install timeout
+var ErrInstallTimeout = errors.New("dependency install timeout")
+
 // ExecutionRequest contains all data needed for execution
 type ExecutionRequest struct {
 	ID        string
 	TarData   []byte
 	Metadata  *client.Metadata
+
+	// Tenant and APIKeyName identify the submitter. They are only used to
+	// label the container and may be empty.
+	Tenant     string
+	APIKeyName string
+
+	// Env holds server-provided environment variables ("KEY=value") added
+	// to the user's EnvVars.
+	Env []string
+
+	// Stdin, if set, is streamed to the container's standard input and
+	// takes precedence over Metadata.Stdin. It is read only once, so it can
+	// be backed by a file too large to hold in memory.
+	Stdin io.Reader
+
+	// Stdout and Stderr, if set, receive the container's output as it is
+	// demultiplexed, in addition to the copy returned in ExecutionOutput.
+	// They let callers persist large outputs without a second buffer.
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// CollectOutput returns every file the script wrote under OutputDir in
+	// ExecutionOutput.OutputArchive, e.g. for the next step of a pipeline.
+	CollectOutput bool
+
+	// OnContainerCreated, if set, is called with the container ID as soon
+	// as the container exists so callers can record it (e.g. for Kill).
+	OnContainerCreated func(containerID string)
+
+	// OnPhase, if set, is called as the execution enters each phase:
+	// pulling its image, installing dependencies, running the script.
+	OnPhase func(phase client.ExecutionPhase)
+
+	// OnOutput, if set, is called with the script's output as it is
+	// written, one Docker log frame at a time, while the container runs.
+	// data is only valid during the call. The output is still returned in
+	// ExecutionOutput once the container has stopped.
+	OnOutput func(stream client.OutputStream, data []byte)
+}
+
+// enterPhase reports that req entered phase, if anyone is listening
+func (req *ExecutionRequest) enterPhase(phase client.ExecutionPhase) {
+	if req.OnPhase != nil {
+		req.OnPhase(phase)
+	}
 }
 
 // ExecutionOutput contains the execution results
@@ -19,6 +79,65 @@ type ExecutionOutput struct {
 	Stderr     string
 	ExitCode   int
 	DurationMs int64
+
+	// StdoutTimes and StderrTimes hold when each line of Stdout and Stderr
+	// was emitted, one entry per line. Either may be empty.
+	StdoutTimes []time.Time
+	StderrTimes []time.Time
+
+	// Combined is stdout and stderr interleaved in emission order, set when
+	// the execution asked for combined output
+	Combined string
+
+	// Install is the dependency installation stage, nil if nothing was
+	// installed. When it failed the script did not run and the fields
+	// above are empty.
+	Install *client.InstallResult
+
+	// Manifest describes the image and configuration the execution used
+	Manifest *client.Manifest
+
+	// OOMKilled is true if the container was killed for exceeding its
+	// memory limit
+	OOMKilled bool
+
+	// DiskLimitExceeded is true if the container was killed for writing
+	// more than its disk limit (see diskWatchdog)
+	DiskLimitExceeded bool
+
+	// CPU is the script's CPU time, nil if it could not be measured
+	CPU *client.CPUUsage
+
+	// Timings holds the duration of the pull, install and run phases. The
+	// queue wait is up to the caller.
+	Timings *client.Timings
+
+	// StructuredOutput is the JSON the script wrote to ResultFile, nil if
+	// it wrote none. StructuredOutputError says why a file that was
+	// written could not be returned, e.g. because it was too large.
+	StructuredOutput      json.RawMessage
+	StructuredOutputError string
+
+	// JUnitReport is the JUnit XML report written by pytest in pytest
+	// mode, nil if there is none
+	JUnitReport []byte
+
+	// CoverageXML is the Cobertura XML report written by coverage.py when
+	// the execution asked for coverage, nil if there is none
+	CoverageXML []byte
+
+	// Artifacts are the files the execution asked to collect: images from
+	// OutputDir and coverage reports
+	Artifacts []client.Artifact
+
+	// Files are the files under the execution's output directory, when it
+	// set CollectArtifacts, named relative to /work (see parseArtifacts)
+	Files []client.Artifact
+
+	// OutputArchive is a tar archive of the files under OutputDir, named
+	// relative to it, when the request set CollectOutput. It is nil if the
+	// script wrote nothing there.
+	OutputArchive []byte
 }
 
 // Executor defines the interface for code execution
@@ -29,6 +148,14 @@ type Executor interface {
 	// Kill terminates a running execution
 	Kill(ctx context.Context, containerID string) error
 
+	// ListContainers returns the containers created by this executor that
+	// still exist, keyed by execution ID
+	ListContainers(ctx context.Context) (map[string]string, error)
+
+	// Attach waits for an existing container to finish, collects its output
+	// and removes it. Used to recover executions after a restart.
+	Attach(ctx context.Context, containerID string) (*ExecutionOutput, error)
+
 	// Close cleans up executor resources
 	Close() error
 }
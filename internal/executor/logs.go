@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// ansiPattern matches ANSI escape sequences: CSI sequences such as colors
+// and cursor movement, OSC sequences such as hyperlinks and window titles,
+// and two-character escapes
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b\n]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// capturedLogs is a container's demultiplexed output
+type capturedLogs struct {
+	Stdout string
+	Stderr string
+
+	// Combined is stdout and stderr interleaved in the order they were
+	// written, if requested
+	Combined string
+
+	// StdoutTimes and StderrTimes hold when each output line was emitted,
+	// one entry per line
+	StdoutTimes []time.Time
+	StderrTimes []time.Time
+}
+
+// stripANSI removes ANSI escape sequences from the captured output. They
+// never contain newlines, so per-line timestamps still line up.
+func (l *capturedLogs) stripANSI() {
+	l.Stdout = ansiPattern.ReplaceAllString(l.Stdout, "")
+	l.Stderr = ansiPattern.ReplaceAllString(l.Stderr, "")
+	l.Combined = ansiPattern.ReplaceAllString(l.Combined, "")
+}
+
+// timestampWriter strips the timestamp Docker puts in front of each log
+// frame and records it once per output line. stdcopy writes each frame with
+// a single Write, so every Write starts with a timestamp.
+type timestampWriter struct {
+	out     io.Writer
+	times   []time.Time
+	midLine bool // the last frame did not end with a newline
+}
+
+func (w *timestampWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	ts, rest, ok := bytes.Cut(p, []byte(" "))
+	if !ok {
+		_, err := w.out.Write(p)
+		return n, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, string(ts))
+	if err != nil {
+		_, err := w.out.Write(p)
+		return n, err
+	}
+	p = rest
+
+	// A frame continuing a long line doesn't start a new one
+	if !w.midLine && len(p) > 0 {
+		w.times = append(w.times, t)
+	}
+	for i, b := range p {
+		if b == '\n' && i < len(p)-1 {
+			w.times = append(w.times, t)
+		}
+	}
+	if len(p) > 0 {
+		w.midLine = p[len(p)-1] != '\n'
+	}
+
+	if _, err := w.out.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// followGrace is how long the output stream may take to drain once the
+// container has stopped
+const followGrace = 2 * time.Second
+
+// followOutput passes a started container's output since the given time,
+// if any, to onOutput as it is written, until the container stops or ctx
+// ends. The returned function waits for the stream to drain, then stops
+// it. A nil onOutput follows nothing.
+func (e *DockerExecutor) followOutput(ctx context.Context, containerID, since string, onOutput func(clientpkg.OutputStream, []byte)) (wait func()) {
+	if onOutput == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logs, err := e.client.ContainerLogs(ctx, containerID, container.LogsOptions{
+			ShowStdout: true,
+			ShowStderr: true,
+			Follow:     true,
+			Since:      since,
+		})
+		if err != nil {
+			return
+		}
+		defer logs.Close()
+		streamOutput(logs, onOutput)
+	}()
+
+	return func() {
+		select {
+		case <-done:
+		case <-time.After(followGrace):
+		}
+		cancel()
+		<-done
+	}
+}
+
+// streamOutput demultiplexes Docker's log stream, calling onOutput with
+// each frame as it is read
+func streamOutput(logs io.Reader, onOutput func(clientpkg.OutputStream, []byte)) error {
+	_, err := stdcopy.StdCopy(outputFunc{clientpkg.StreamStdout, onOutput}, outputFunc{clientpkg.StreamStderr, onOutput}, logs)
+	return err
+}
+
+// outputFunc is a writer passing what is written to it, as one stream, to
+// a callback
+type outputFunc struct {
+	stream clientpkg.OutputStream
+	fn     func(clientpkg.OutputStream, []byte)
+}
+
+func (w outputFunc) Write(p []byte) (int, error) {
+	w.fn(w.stream, p)
+	return len(p), nil
+}
@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	cerrdefs "github.com/containerd/errdefs"
+)
+
+// MaxOutputArchiveSize caps the total size of the files collected from
+// OutputDir when a request sets CollectOutput (50MB). Files past the cap
+// are left out.
+const MaxOutputArchiveSize = 50 << 20
+
+// readOutputArchive copies everything under OutputDir out of a stopped
+// container. It returns nil if the directory doesn't exist.
+func (e *DockerExecutor) readOutputArchive(ctx context.Context, containerID string) ([]byte, error) {
+	rc, _, err := e.client.CopyFromContainer(ctx, containerID, OutputDir)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("copying %s: %w", OutputDir, err)
+	}
+	defer rc.Close()
+
+	return repackOutput(rc)
+}
+
+// repackOutput rewrites a tar stream of OutputDir as an archive of its
+// directories and regular files, named relative to OutputDir, until
+// MaxOutputArchiveSize is reached
+func repackOutput(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	var total int64
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", OutputDir, err)
+		}
+
+		// The archive's top-level entry is the directory itself
+		_, name, _ := strings.Cut(hdr.Name, "/")
+		if name == "" || (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeDir) {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeReg && total+hdr.Size > MaxOutputArchiveSize {
+			continue
+		}
+		total += hdr.Size
+
+		out := &tar.Header{
+			Name:     name,
+			Typeflag: hdr.Typeflag,
+			Mode:     hdr.Mode & 0777,
+			Size:     hdr.Size,
+			ModTime:  hdr.ModTime,
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			out.Size = 0
+		}
+		if err := tw.WriteHeader(out); err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, tr); err != nil {
+				return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,490 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"al.essio.dev/pkg/shellescape"
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// PhaseWarm is the LabelPhase value of warm pool containers
+const PhaseWarm = "warm"
+
+// LabelNode names the instance a warm pool container belongs to
+const LabelNode = "python-executor.node"
+
+// warmScript is the script that runs an execution in a warm container. It
+// is outside /work so clearing /work between executions leaves it alone.
+const warmScript = "/_pyexec/run.sh"
+
+// warmClaim holds the labels of the execution a warm container was handed
+// to, as JSON. Containers can't be relabelled, so this is what tells a
+// restarted server which execution a warm container is running.
+const warmClaim = "/_pyexec/claim.json"
+
+// warmCommand is the main process of a warm container. It clears /work of
+// what the previous execution left, and the claim of that execution, then
+// waits for a line on stdin and runs the execution's command in its place,
+// so that the command's exit code, output and OOM kill are the
+// container's own. The rest of stdin is the command's. The script, which
+// holds the execution's environment and secrets, is deleted before it
+// runs. /tmp is a tmpfs, emptied by the restart itself.
+const warmCommand = `rm -rf /work/* /work/.[!.]* /work/..?* ` + warmClaim + ` 2>/dev/null; read -r _ && s=$(cat ` + warmScript + `) && rm -f ` + warmScript + ` && eval "$s"`
+
+// warmContainer is a started container of the pool, waiting for an
+// execution or running one
+type warmContainer struct {
+	ID    string
+	Image string
+
+	// StartedAt is when the daemon last started the container, in its own
+	// clock. Logs from before it belong to earlier executions.
+	StartedAt string
+
+	// Uses counts the executions given the container, including the one
+	// it is running
+	Uses int
+
+	// Owner is the API key whose executions the container runs, once it
+	// has been handed out. Only executions of the same key reuse it, so
+	// that nothing one caller leaves behind runs in another's code.
+	Owner string
+}
+
+// warmPool keeps started containers of each pooled image waiting, so that
+// an execution only has to copy its files in rather than create and start
+// a container. A container that ran an execution cleanly is restarted and
+// reused by executions of the same API key, up to maxReuse executions;
+// those of no key never reuse one. Starting and restarting happen in the
+// background; an execution never waits for the pool.
+type warmPool struct {
+	size     int
+	maxReuse int
+	images   []string
+
+	// start creates and starts a waiting container; restart restarts one
+	// that ran an execution; remove removes one
+	start   func(ctx context.Context, image string) (*warmContainer, error)
+	restart func(ctx context.Context, c *warmContainer) error
+	remove  func(c *warmContainer)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	idle map[string][]*warmContainer
+	// pending counts the containers being started or restarted, and busy
+	// those running an execution that can be reused afterwards, by image.
+	// Both count towards size.
+	pending map[string]int
+	busy    map[string]int
+	closed  bool
+}
+
+func newWarmPool(size, maxReuse int, images []string) *warmPool {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &warmPool{
+		size:     size,
+		maxReuse: max(maxReuse, 1),
+		images:   images,
+		ctx:      ctx,
+		cancel:   cancel,
+		idle:     map[string][]*warmContainer{},
+		pending:  map[string]int{},
+		busy:     map[string]int{},
+	}
+}
+
+// pools reports whether the pool keeps containers of image
+func (p *warmPool) pools(image string) bool {
+	for _, i := range p.images {
+		if i == image {
+			return true
+		}
+	}
+	return false
+}
+
+// fill starts containers until every image has size of them
+func (p *warmPool) fill() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, image := range p.images {
+		p.fillLocked(image)
+	}
+}
+
+func (p *warmPool) fillLocked(image string) {
+	if p.closed {
+		return
+	}
+	for n := len(p.idle[image]) + p.pending[image] + p.busy[image]; n < p.size; n++ {
+		p.pending[image]++
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			c, err := p.start(p.ctx, image)
+
+			p.mu.Lock()
+			p.pending[image]--
+			closed := p.closed
+			// A failed start is retried on the next take rather than at
+			// once, so a missing image doesn't spin
+			if err == nil && !closed {
+				p.idle[image] = append(p.idle[image], c)
+			}
+			p.mu.Unlock()
+
+			if err == nil && closed {
+				p.remove(c)
+			}
+		}()
+	}
+}
+
+// keeps reports whether a container handed out by take goes back to the
+// pool after its execution
+func (p *warmPool) keeps(c *warmContainer) bool {
+	return c.Owner != "" && c.Uses < p.maxReuse
+}
+
+// take hands out a waiting container of image for an execution of the
+// owner API key: one the key's executions ran in before, or else a fresh
+// one. It returns nil if none is waiting. The pool is topped up in the
+// background either way.
+func (p *warmPool) take(image, owner string) *warmContainer {
+	if !p.pools(image) {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	idle := p.idle[image]
+	i := -1
+	if owner != "" {
+		i = slices.IndexFunc(idle, func(c *warmContainer) bool { return c.Owner == owner })
+	}
+	if i < 0 {
+		i = slices.IndexFunc(idle, func(c *warmContainer) bool { return c.Owner == "" })
+	}
+
+	var c *warmContainer
+	switch {
+	case i >= 0:
+		c = idle[i]
+		p.idle[image] = slices.Delete(idle, i, i+1)
+		c.Owner = owner
+		c.Uses++
+		if p.keeps(c) {
+			p.busy[image]++
+		}
+	case len(idle) > 0:
+		// Every waiting container belongs to other keys: replace the one
+		// waiting longest, so that fresh containers come back
+		stale := idle[0]
+		p.idle[image] = idle[1:]
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.remove(stale)
+		}()
+	}
+	p.fillLocked(image)
+	return c
+}
+
+// put returns a container handed out by take once its execution is over.
+// A reusable container its owner may use again is restarted to wait for
+// the owner's next execution; any other is removed and replaced.
+func (p *warmPool) put(c *warmContainer, reusable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keep := p.keeps(c)
+	if keep {
+		p.busy[c.Image]--
+	}
+	if !reusable || !keep || p.closed {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.remove(c)
+		}()
+		p.fillLocked(c.Image)
+		return
+	}
+
+	p.pending[c.Image]++
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := p.restart(p.ctx, c)
+
+		p.mu.Lock()
+		p.pending[c.Image]--
+		ok := err == nil && !p.closed
+		if ok {
+			p.idle[c.Image] = append(p.idle[c.Image], c)
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			p.remove(c)
+			p.mu.Lock()
+			p.fillLocked(c.Image)
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// close stops filling the pool and removes the waiting containers, once
+// those being started are done
+func (p *warmPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	var idle []*warmContainer
+	for image, cs := range p.idle {
+		idle = append(idle, cs...)
+		delete(p.idle, image)
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+	for _, c := range idle {
+		p.remove(c)
+	}
+	p.wg.Wait()
+}
+
+// startPool starts keeping warm containers of the configured images, after
+// removing any a previous run of this instance left behind
+func (e *DockerExecutor) startPool() {
+	images := e.config.Pool.Images
+	if len(images) == 0 {
+		images = []string{e.config.Defaults.DockerImage}
+	}
+	p := newWarmPool(e.config.Pool.Size, e.config.Pool.MaxReuse, images)
+	p.start = e.startWarm
+	p.restart = e.restartWarm
+	p.remove = func(c *warmContainer) {
+		e.client.ContainerRemove(context.Background(), c.ID, container.RemoveOptions{Force: true})
+	}
+	e.pool = p
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		e.removeStaleWarm(p.ctx)
+		p.fill()
+	}()
+}
+
+// removeStaleWarm removes the warm containers labelled with this
+// instance's node ID, except those claimed by an execution, which restart
+// recovery re-attaches like any execution container
+func (e *DockerExecutor) removeStaleWarm(ctx context.Context) {
+	containers, err := e.client.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", LabelPhase+"="+PhaseWarm),
+			filters.Arg("label", LabelNode+"="+e.config.Server.NodeID),
+		),
+	})
+	if err != nil {
+		return
+	}
+	for _, c := range containers {
+		if claim, err := e.readWarmClaim(ctx, c.ID); err != nil || claim != nil {
+			continue
+		}
+		e.client.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true})
+	}
+}
+
+// readWarmClaim returns the labels of the execution a warm container was
+// handed to, or nil if it is waiting for one
+func (e *DockerExecutor) readWarmClaim(ctx context.Context, containerID string) (map[string]string, error) {
+	rc, _, err := e.client.CopyFromContainer(ctx, containerID, warmClaim)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading claim: %w", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	if _, err := tr.Next(); err != nil {
+		return nil, fmt.Errorf("reading claim: %w", err)
+	}
+	var labels map[string]string
+	if err := json.NewDecoder(tr).Decode(&labels); err != nil {
+		return nil, fmt.Errorf("reading claim: %w", err)
+	}
+	return labels, nil
+}
+
+// startWarm creates and starts a waiting container of image, with the
+// default resource limits and no network
+func (e *DockerExecutor) startWarm(ctx context.Context, imageName string) (*warmContainer, error) {
+	if err := e.ensureImage(ctx, imageName); err != nil {
+		return nil, fmt.Errorf("ensuring image: %w", err)
+	}
+
+	meta := applyDefaults(&clientpkg.Metadata{DockerImage: imageName}, e.config)
+	containerConfig := &container.Config{
+		Image:        imageName,
+		Cmd:          []string{"sh", "-c", warmCommand},
+		WorkingDir:   "/work",
+		AttachStdout: true,
+		AttachStderr: true,
+		OpenStdin:    true,
+		StdinOnce:    true,
+		Labels: map[string]string{
+			LabelManaged: "true",
+			LabelImage:   imageName,
+			LabelPhase:   PhaseWarm,
+			LabelNode:    e.config.Server.NodeID,
+		},
+	}
+	resp, err := e.client.ContainerCreate(ctx, containerConfig, e.hostConfig("none", e.resources(meta)), nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("creating warm container: %w", err)
+	}
+
+	c := &warmContainer{ID: resp.ID, Image: imageName}
+	if err := e.restartWarm(ctx, c); err != nil {
+		e.client.ContainerRemove(context.Background(), resp.ID, container.RemoveOptions{Force: true})
+		return nil, err
+	}
+	return c, nil
+}
+
+// restartWarm starts a stopped warm container, which clears what its last
+// execution left, and records when it started
+func (e *DockerExecutor) restartWarm(ctx context.Context, c *warmContainer) error {
+	if err := e.client.ContainerStart(ctx, c.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("starting warm container: %w", err)
+	}
+	info, err := e.client.ContainerInspect(ctx, c.ID)
+	if err != nil {
+		return fmt.Errorf("inspecting warm container: %w", err)
+	}
+	if info.State == nil || !info.State.Running {
+		return fmt.Errorf("warm container exited")
+	}
+	c.StartedAt = info.State.StartedAt
+	return nil
+}
+
+// fitsPool reports whether an execution can run in a warm container: its
+// image is pooled, it has no installed environment of its own, it has no
+// network access and it has the default resource limits. Executions
+// collecting artifacts from outside /work are left out too, since only
+// /work and /tmp are cleared between the executions of a container.
+func (e *DockerExecutor) fitsPool(meta *clientpkg.Metadata, installed bool) bool {
+	if e.pool == nil || installed || !e.pool.pools(meta.DockerImage) {
+		return false
+	}
+	if !meta.Config.NetworkDisabled && !meta.Config.InstallNetworkOnly {
+		return false
+	}
+	if meta.Config.CollectArtifacts {
+		if dir := artifactsDir(meta.Config); !strings.HasPrefix(dir, "/work/") && !strings.HasPrefix(dir, "/tmp/") {
+			return false
+		}
+	}
+	defaults := applyDefaults(&clientpkg.Metadata{DockerImage: meta.DockerImage}, e.config).Config
+	return meta.Config.MemoryMB == defaults.MemoryMB &&
+		meta.Config.CPUShares == defaults.CPUShares &&
+		meta.Config.BlkioWeight == defaults.BlkioWeight &&
+		meta.Config.DiskReadBps == defaults.DiskReadBps &&
+		meta.Config.DiskWriteBps == defaults.DiskWriteBps
+}
+
+// claimWarm takes a waiting container for an execution and copies its
+// files in. It returns nil if no container is waiting or the one taken
+// can't be used, in which case the execution creates its own.
+func (e *DockerExecutor) claimWarm(ctx context.Context, req *ExecutionRequest, meta *clientpkg.Metadata) *warmContainer {
+	c := e.pool.take(meta.DockerImage, req.APIKeyName)
+	if c == nil {
+		return nil
+	}
+
+	// A waiting container may have stopped, e.g. if the daemon restarted
+	if info, err := e.client.ContainerInspect(ctx, c.ID); err != nil || info.State == nil || !info.State.Running {
+		e.pool.put(c, false)
+		return nil
+	}
+
+	copies := [][]byte{req.TarData}
+	if meta.EvalLastExpr {
+		copies = append(copies, evalWrapperTar)
+	}
+	if meta.Config.CaptureImages {
+		copies = append(copies, plotBackendTar)
+	}
+	if meta.Config.Deterministic {
+		copies = append(copies, seedModuleTar)
+	}
+	for _, data := range copies {
+		if err := e.client.CopyToContainer(ctx, c.ID, "/work", bytes.NewReader(data), container.CopyToContainerOptions{}); err != nil {
+			e.pool.put(c, false)
+			return nil
+		}
+	}
+	if meta.Config.CollectArtifacts {
+		if err := e.client.CopyToContainer(ctx, c.ID, "/", bytes.NewReader(artifactsDirTar(artifactsDir(meta.Config))), container.CopyToContainerOptions{}); err != nil {
+			e.pool.put(c, false)
+			return nil
+		}
+	}
+	script := warmScriptTar(e.containerEnv(req, meta), e.buildCommand(meta), containerLabels(req, meta))
+	if err := e.client.CopyToContainer(ctx, c.ID, "/", bytes.NewReader(script), container.CopyToContainerOptions{}); err != nil {
+		e.pool.put(c, false)
+		return nil
+	}
+	return c
+}
+
+// warmScriptTar returns a tar archive, relative to /, holding the script
+// that runs an execution's command with its environment in a warm
+// container, and the claim recording the execution's labels
+func warmScriptTar(env []string, cmd string, labels map[string]string) []byte {
+	script := "exec env"
+	for _, kv := range env {
+		script += " " + shellescape.Quote(kv)
+	}
+	script += " sh -c " + shellescape.Quote(cmd) + "\n"
+	claim, _ := json.Marshal(labels)
+
+	dir, _ := path.Split(strings.TrimPrefix(warmScript, "/"))
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0755})
+	for _, f := range []struct {
+		name string
+		data []byte
+		mode int64
+	}{
+		{warmScript, []byte(script), 0600},
+		{warmClaim, claim, 0644},
+	} {
+		tw.WriteHeader(&tar.Header{Name: strings.TrimPrefix(f.name, "/"), Mode: f.mode, Size: int64(len(f.data))})
+		tw.Write(f.data)
+	}
+	tw.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,250 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// fakeDocker starts, restarts and removes pretend warm containers
+type fakeDocker struct {
+	mu        sync.Mutex
+	started   int
+	restarted []string
+	removed   []string
+	failStart bool
+}
+
+func (f *fakeDocker) pool(size, maxReuse int) *warmPool {
+	p := newWarmPool(size, maxReuse, []string{"python:3.12-slim"})
+	p.start = func(ctx context.Context, image string) (*warmContainer, error) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.failStart {
+			return nil, fmt.Errorf("no such image")
+		}
+		f.started++
+		return &warmContainer{ID: fmt.Sprintf("c%d", f.started), Image: image}, nil
+	}
+	p.restart = func(ctx context.Context, c *warmContainer) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.restarted = append(f.restarted, c.ID)
+		return nil
+	}
+	p.remove = func(c *warmContainer) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.removed = append(f.removed, c.ID)
+	}
+	return p
+}
+
+// waitIdle waits until the pool has n waiting containers of the image and
+// nothing pending
+func waitIdle(t *testing.T, p *warmPool, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		idle, pending := len(p.idle["python:3.12-slim"]), p.pending["python:3.12-slim"]
+		p.mu.Unlock()
+		if idle == n && pending == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("pool did not settle at %d waiting containers", n)
+}
+
+func TestWarmPool(t *testing.T) {
+	f := &fakeDocker{}
+	p := f.pool(1, 2)
+	p.fill()
+	waitIdle(t, p, 1)
+
+	if c := p.take("python:3.11-slim", "ci"); c != nil {
+		t.Errorf("take() of an image not pooled = %+v", c)
+	}
+
+	// A container that can be reused isn't replaced while it runs
+	c1 := p.take("python:3.12-slim", "ci")
+	if c1 == nil || c1.Uses != 1 {
+		t.Fatalf("take() = %+v", c1)
+	}
+	waitIdle(t, p, 0)
+
+	// Once back it is restarted for its second and last execution, and
+	// replaced while that runs
+	p.put(c1, true)
+	waitIdle(t, p, 1)
+	if c := p.take("python:3.12-slim", "ci"); c != c1 || c.Uses != 2 {
+		t.Fatalf("second take() = %+v, want %s again", c, c1.ID)
+	}
+	waitIdle(t, p, 1)
+	p.put(c1, true)
+
+	// A container whose script didn't exit cleanly is replaced
+	c2 := p.take("python:3.12-slim", "ci")
+	if c2 == nil || c2 == c1 {
+		t.Fatalf("third take() = %+v, want a new container", c2)
+	}
+	p.put(c2, false)
+	waitIdle(t, p, 1)
+
+	p.close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.started != 3 || len(f.restarted) != 1 || f.restarted[0] != c1.ID {
+		t.Errorf("started %d, restarted %v; want 3 started and %s restarted", f.started, f.restarted, c1.ID)
+	}
+	// The waiting container is removed on close
+	if len(f.removed) != 3 {
+		t.Errorf("removed = %v, want all 3 containers", f.removed)
+	}
+	if c := p.take("python:3.12-slim", "ci"); c != nil {
+		t.Errorf("take() after close = %+v", c)
+	}
+}
+
+func TestWarmPool_Owners(t *testing.T) {
+	f := &fakeDocker{}
+	p := f.pool(1, 5)
+	p.fill()
+	waitIdle(t, p, 1)
+
+	// Executions of no API key never reuse a container
+	c1 := p.take("python:3.12-slim", "")
+	if c1 == nil {
+		t.Fatal("take() = nil")
+	}
+	waitIdle(t, p, 1)
+	p.put(c1, true)
+	waitIdle(t, p, 1)
+
+	// A container goes back to executions of the key it ran
+	c2 := p.take("python:3.12-slim", "ci")
+	if c2 == nil || c2 == c1 {
+		t.Fatalf("take() = %+v, want a fresh container", c2)
+	}
+	p.put(c2, true)
+	waitIdle(t, p, 1)
+	if c := p.take("python:3.12-slim", "ci"); c != c2 || c.Uses != 2 {
+		t.Fatalf("take() for the same key = %+v, want %s", c, c2.ID)
+	}
+	p.put(c2, true)
+	waitIdle(t, p, 1)
+
+	// but not to another key's: it is replaced by a fresh one
+	if c := p.take("python:3.12-slim", "nightly"); c != nil {
+		t.Fatalf("take() for another key = %+v, want none", c)
+	}
+	waitIdle(t, p, 1)
+	c3 := p.take("python:3.12-slim", "nightly")
+	if c3 == nil || c3 == c2 || c3.Uses != 1 {
+		t.Fatalf("take() = %+v, want a fresh container", c3)
+	}
+
+	p.close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !slices.Equal(f.removed, []string{c1.ID, c2.ID}) {
+		t.Errorf("removed = %v, want %s and %s", f.removed, c1.ID, c2.ID)
+	}
+}
+
+func TestWarmPool_FailedStart(t *testing.T) {
+	f := &fakeDocker{failStart: true}
+	p := f.pool(1, 1)
+	defer p.close()
+	p.fill()
+	waitIdle(t, p, 0)
+
+	// Starting is retried when an execution asks for a container
+	f.mu.Lock()
+	f.failStart = false
+	f.mu.Unlock()
+	if c := p.take("python:3.12-slim", ""); c != nil {
+		t.Errorf("take() = %+v, want none while the pool is empty", c)
+	}
+	waitIdle(t, p, 1)
+}
+
+func TestFitsPool(t *testing.T) {
+	cfg := &config.Config{
+		Defaults: config.DefaultsConfig{
+			MemoryMB:    1024,
+			DiskMB:      2048,
+			CPUShares:   1024,
+			DockerImage: "python:3.12-slim",
+		},
+	}
+	e := &DockerExecutor{config: cfg, pool: newWarmPool(1, 1, []string{"python:3.12-slim"})}
+
+	tests := []struct {
+		name      string
+		image     string
+		cfg       clientpkg.ExecutionConfig
+		installed bool
+		want      bool
+	}{
+		{name: "defaults", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true}, want: true},
+		{name: "network only to install", cfg: clientpkg.ExecutionConfig{InstallNetworkOnly: true}, want: true},
+		{name: "artifacts under /work", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true, CollectArtifacts: true}, want: true},
+		{name: "image not pooled", image: "python:3.11-slim", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true}},
+		{name: "installed", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true}, installed: true},
+		{name: "network", cfg: clientpkg.ExecutionConfig{}},
+		{name: "memory", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true, MemoryMB: 2048}},
+		{name: "artifacts elsewhere", cfg: clientpkg.ExecutionConfig{NetworkDisabled: true, CollectArtifacts: true, OutputDir: "/data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.cfg
+			meta := applyDefaults(&clientpkg.Metadata{DockerImage: tt.image, Config: &c}, cfg)
+			if got := e.fitsPool(meta, tt.installed); got != tt.want {
+				t.Errorf("fitsPool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if (&DockerExecutor{config: cfg}).fitsPool(applyDefaults(&clientpkg.Metadata{}, cfg), false) {
+		t.Error("fitsPool() without a pool = true")
+	}
+}
+
+func TestWarmScriptTar(t *testing.T) {
+	tr := tar.NewReader(bytes.NewReader(warmScriptTar([]string{"A=it's", "PYTHONPATH=/work"}, "python /work/main.py", map[string]string{LabelExecutionID: "exe_1"})))
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[hdr.Name] = string(data)
+	}
+
+	want := `exec env 'A=it'"'"'s' PYTHONPATH=/work sh -c 'python /work/main.py'` + "\n"
+	if got, ok := files["_pyexec/run.sh"]; !ok || got != want {
+		t.Errorf("run.sh = %q, want %q (archive %v)", got, want, files)
+	}
+	if got := files["_pyexec/claim.json"]; got != `{"`+LabelExecutionID+`":"exe_1"}` {
+		t.Errorf("claim.json = %q", got)
+	}
+	if _, ok := files["_pyexec/"]; !ok {
+		t.Errorf("archive %v has no _pyexec/ directory", files)
+	}
+}
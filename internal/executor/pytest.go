@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"al.essio.dev/pkg/shellescape"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// JUnitReportFile is where pytest writes its JUnit XML report in pytest
+// mode. It is outside OutputDir so it is not collected as an artifact.
+const JUnitReportFile = "/work/_pyexec_junit.xml"
+
+// MaxJUnitReportSize is the largest JUnit report that is returned (10MB)
+const MaxJUnitReportSize = 10 << 20
+
+// pytestCommand builds the shell command that runs pytest with the given
+// interpreter command on the entrypoint, or on the working directory if
+// there is none. The cache plugin is disabled since the container is
+// thrown away.
+func pytestCommand(meta *clientpkg.Metadata, python string) string {
+	cmd := fmt.Sprintf("%s -m pytest -p no:cacheprovider --junitxml=%s", python, JUnitReportFile)
+	if meta.Entrypoint != "" {
+		cmd += " " + shellescape.Quote(meta.Entrypoint)
+	}
+	for _, arg := range meta.ScriptArgs {
+		cmd += " " + shellescape.Quote(arg)
+	}
+	return cmd
+}
+
+// readJUnitReport copies JUnitReportFile out of a stopped container. It
+// returns nil and no error if pytest didn't write one, e.g. because it is
+// not installed.
+func (e *DockerExecutor) readJUnitReport(ctx context.Context, containerID string) ([]byte, error) {
+	rc, err := e.copyFile(ctx, containerID, JUnitReportFile, MaxJUnitReportSize)
+	if rc == nil || err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return untarFile(rc, JUnitReportFile, MaxJUnitReportSize)
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	cerrdefs "github.com/containerd/errdefs"
+)
+
+// ResultFile is where a script can write a JSON document to have it
+// returned as structured output, separate from anything it prints
+const ResultFile = OutputDir + "/result.json"
+
+// MaxResultFileSize is the largest ResultFile that is returned (1MB)
+const MaxResultFileSize = 1 << 20
+
+// readResultFile copies ResultFile out of a stopped container. It returns
+// nil and no error if the script didn't write one.
+func (e *DockerExecutor) readResultFile(ctx context.Context, containerID string) (json.RawMessage, error) {
+	rc, err := e.copyFile(ctx, containerID, ResultFile, MaxResultFileSize)
+	if rc == nil || err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return parseResultFile(rc)
+}
+
+// parseResultFile reads ResultFile from a tar stream from
+// CopyFromContainer and checks that it holds valid JSON
+func parseResultFile(r io.Reader) (json.RawMessage, error) {
+	data, err := untarFile(r, ResultFile, MaxResultFileSize)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("%s is not valid JSON", ResultFile)
+	}
+	return json.RawMessage(data), nil
+}
+
+// copyFile starts copying a file of at most max bytes out of a stopped
+// container, as a tar stream. It returns nil and no error if the file
+// doesn't exist.
+func (e *DockerExecutor) copyFile(ctx context.Context, containerID, path string, max int64) (io.ReadCloser, error) {
+	rc, stat, err := e.client.CopyFromContainer(ctx, containerID, path)
+	if err != nil {
+		if cerrdefs.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("copying %s: %w", path, err)
+	}
+
+	if stat.Size > max {
+		rc.Close()
+		return nil, fmt.Errorf("%s is %d bytes, over the %d byte limit", path, stat.Size, max)
+	}
+	return rc, nil
+}
+
+// untarFile reads the single file in a tar stream from CopyFromContainer,
+// refusing anything but a regular file of at most max bytes
+func untarFile(r io.Reader, path string, max int64) ([]byte, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(tr, max+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s is over the %d byte limit", path, max)
+	}
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"errors"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+)
+
+// selinuxOptions returns the security options that give execution
+// containers the configured SELinux label, as docker run's
+// --security-opt label=... would. Without SELinux settings the daemon's
+// default label applies.
+func selinuxOptions(cfg config.DockerConfig) ([]string, error) {
+	if cfg.SELinuxDisable {
+		if cfg.SELinuxType != "" || cfg.SELinuxLevel != "" {
+			return nil, errors.New("PYEXEC_SELINUX_DISABLE cannot be combined with PYEXEC_SELINUX_TYPE or PYEXEC_SELINUX_LEVEL")
+		}
+		return []string{"label=disable"}, nil
+	}
+
+	var opts []string
+	if cfg.SELinuxType != "" {
+		opts = append(opts, "label=type:"+cfg.SELinuxType)
+	}
+	if cfg.SELinuxLevel != "" {
+		opts = append(opts, "label=level:"+cfg.SELinuxLevel)
+	}
+	return opts, nil
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+)
+
+func TestSELinuxOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.DockerConfig
+		want    []string
+		wantErr bool
+	}{
+		{name: "daemon default"},
+		{
+			name: "disabled",
+			cfg:  config.DockerConfig{SELinuxDisable: true},
+			want: []string{"label=disable"},
+		},
+		{
+			name: "type and level",
+			cfg:  config.DockerConfig{SELinuxType: "container_t", SELinuxLevel: "s0:c100,c200"},
+			want: []string{"label=type:container_t", "label=level:s0:c100,c200"},
+		},
+		{
+			name:    "disabled with a type",
+			cfg:     config.DockerConfig{SELinuxDisable: true, SELinuxType: "spc_t"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selinuxOptions(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selinuxOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selinuxOptions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,409 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/stdcopy"
+	clientpkg "github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// SessionScript is the name of the script that runs a session's
+// interpreter and relays code to it
+const SessionScript = "_pyexec_session.py"
+
+// PhaseSession is the LabelPhase value of session containers
+const PhaseSession = "session"
+
+// sessionSocket is where a session's interpreter listens for code
+const sessionSocket = "/tmp/_pyexec_session.sock"
+
+// sessionCode is the interpreter of a persistent session. "serve" runs it
+// as the container's main process: it executes each block of code it
+// receives in one namespace, so variables and imports carry over, and
+// replies with the captured output and the repr() of a trailing
+// expression. It exits after idle seconds without code, so a container
+// left behind by a stopped server removes itself. "eval" is run with
+// docker exec for each call; it sends its stdin to the interpreter and
+// prints the reply. SIGINT interrupts the running code with a
+// KeyboardInterrupt and leaves the interpreter usable.
+const sessionCode = `import ast
+import io
+import json
+import signal
+import socket
+import sys
+import time
+import traceback
+from contextlib import redirect_stderr, redirect_stdout
+
+SOCKET = "` + sessionSocket + `"
+
+running = False
+
+
+def interrupt(signum, frame):
+    if running:
+        raise KeyboardInterrupt
+
+
+def run(code, namespace):
+    global running
+    out, err = io.StringIO(), io.StringIO()
+    reply = {}
+    with redirect_stdout(out), redirect_stderr(err):
+        running = True
+        try:
+            tree = ast.parse(code, "<session>", "exec")
+            last = None
+            if tree.body and isinstance(tree.body[-1], ast.Expr):
+                last = ast.Expression(body=tree.body.pop().value)
+            exec(compile(tree, "<session>", "exec"), namespace)
+            if last is not None:
+                result = eval(compile(last, "<session>", "eval"), namespace)
+                if result is not None:
+                    reply["result"] = repr(result)
+        except BaseException as e:
+            running = False
+            # Leave out this script's frames
+            tb = None if isinstance(e, SyntaxError) else e.__traceback__.tb_next
+            reply["traceback"] = "".join(traceback.format_exception(type(e), e, tb))
+            err.write(reply["traceback"])
+            reply["error"] = traceback.format_exception_only(type(e), e)[-1].strip()
+            reply["error_type"] = type(e).__name__
+        finally:
+            running = False
+    reply["stdout"] = out.getvalue()
+    reply["stderr"] = err.getvalue()
+    return reply
+
+
+def serve(idle):
+    signal.signal(signal.SIGINT, interrupt)
+    namespace = {"__name__": "__main__", "__builtins__": __builtins__}
+    server = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+    server.bind(SOCKET)
+    server.listen(1)
+    server.settimeout(idle)
+    while True:
+        try:
+            conn, _ = server.accept()
+        except socket.timeout:
+            return
+        with conn:
+            conn.settimeout(None)
+            chunks = []
+            while True:
+                chunk = conn.recv(65536)
+                if not chunk:
+                    break
+                chunks.append(chunk)
+            reply = run(b"".join(chunks).decode("utf-8", "replace"), namespace)
+            try:
+                conn.sendall(json.dumps(reply).encode())
+            except OSError:
+                pass  # the caller gave up, e.g. after a timeout
+
+
+def send():
+    code = sys.stdin.buffer.read()
+    for _ in range(100):
+        try:
+            conn = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+            conn.connect(SOCKET)
+            break
+        except (FileNotFoundError, ConnectionRefusedError):
+            conn.close()
+            time.sleep(0.1)
+    else:
+        sys.exit("session interpreter is not running")
+    conn.sendall(code)
+    conn.shutdown(socket.SHUT_WR)
+    while True:
+        chunk = conn.recv(65536)
+        if not chunk:
+            break
+        sys.stdout.buffer.write(chunk)
+
+
+if __name__ == "__main__":
+    if sys.argv[1] == "serve":
+        serve(float(sys.argv[2]) or None)
+    else:
+        send()
+`
+
+// sessionTar is a tar archive holding the session script
+var sessionTar = func() []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{
+		Name: SessionScript,
+		Mode: 0644,
+		Size: int64(len(sessionCode)),
+	})
+	tw.Write([]byte(sessionCode))
+	tw.Close()
+	return buf.Bytes()
+}()
+
+// SessionRequest contains the data needed to start a session
+type SessionRequest struct {
+	ID string
+
+	// TarData holds the files copied to /work before the interpreter starts
+	TarData []byte
+
+	// Metadata selects the image, dependencies, environment and limits.
+	// Entrypoint and Stdin are not used.
+	Metadata *clientpkg.Metadata
+
+	// Tenant and APIKeyName identify the submitter. They are only used to
+	// label the container and may be empty.
+	Tenant     string
+	APIKeyName string
+
+	// Env holds server-provided environment variables ("KEY=value") added
+	// to the user's EnvVars.
+	Env []string
+
+	// IdleTimeout is how long the interpreter waits for code before it
+	// exits, zero for no limit. It is a safety net; callers close idle
+	// sessions themselves.
+	IdleTimeout time.Duration
+}
+
+// Session is a running session container
+type Session struct {
+	ContainerID string
+
+	// Install is the dependency installation stage, nil if nothing was
+	// installed. When it failed no container was started and ContainerID
+	// is empty.
+	Install *clientpkg.InstallResult
+
+	// image is the installed image to remove with the container, if any
+	image string
+}
+
+// SessionOutput is the outcome of running code in a session
+type SessionOutput struct {
+	Stdout     string  `json:"stdout"`
+	Stderr     string  `json:"stderr"`
+	Result     *string `json:"result"`
+	Error      string  `json:"error"`
+	ErrorType  string  `json:"error_type"`
+	DurationMs int64   `json:"-"`
+
+	// Traceback is the formatted traceback of Error, which also ends Stderr
+	Traceback string `json:"traceback"`
+}
+
+// SessionExecutor is implemented by executors that can keep an interpreter
+// running between calls, so that state persists across them
+type SessionExecutor interface {
+	// StartSession starts a session container and its interpreter
+	StartSession(ctx context.Context, req *SessionRequest) (*Session, error)
+
+	// EvalSession runs code in a session's interpreter. If ctx ends first
+	// the code is interrupted and an error wrapping ErrTimeout is returned;
+	// the session stays usable.
+	EvalSession(ctx context.Context, session *Session, code string) (*SessionOutput, error)
+
+	// InterruptSession interrupts the code a session is running, which
+	// then returns with a KeyboardInterrupt
+	InterruptSession(ctx context.Context, session *Session) error
+
+	// CloseSession removes a session's container and installed image
+	CloseSession(ctx context.Context, session *Session) error
+}
+
+// StartSession installs the session's dependencies, if any, and starts a
+// container running the session interpreter
+func (e *DockerExecutor) StartSession(ctx context.Context, req *SessionRequest) (*Session, error) {
+	meta := applyDefaults(req.Metadata, e.config)
+
+	if err := e.ensureImage(ctx, meta.DockerImage); err != nil {
+		return nil, fmt.Errorf("pulling image: %w", err)
+	}
+
+	execReq := &ExecutionRequest{
+		ID:         req.ID,
+		TarData:    req.TarData,
+		Metadata:   meta,
+		Tenant:     req.Tenant,
+		APIKeyName: req.APIKeyName,
+		Env:        req.Env,
+	}
+
+	session := &Session{}
+	runImage := meta.DockerImage
+	if needsInstall(meta) {
+		installed, result, err := e.installDependencies(ctx, execReq, meta)
+		if err != nil {
+			return nil, err
+		}
+		session.Install = result
+		if installed == "" {
+			return session, nil
+		}
+		session.image = installed
+		runImage = installed
+	}
+
+	networkMode := "none"
+	if !meta.Config.NetworkDisabled && !meta.Config.InstallNetworkOnly {
+		networkMode = e.config.Docker.NetworkMode
+	}
+	hostConfig := e.hostConfig(networkMode, e.resources(meta))
+	hostConfig.AutoRemove = true
+
+	labels := containerLabels(execReq, meta)
+	labels[LabelPhase] = PhaseSession
+
+	idle := strconv.FormatFloat(req.IdleTimeout.Seconds(), 'f', -1, 64)
+	containerConfig := &container.Config{
+		Image:      runImage,
+		Cmd:        []string{"python", "/work/" + SessionScript, "serve", idle},
+		WorkingDir: "/work",
+		Env:        e.containerEnv(execReq, meta),
+		Labels:     labels,
+	}
+
+	resp, err := e.client.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		e.removeSessionImage(session)
+		return nil, fmt.Errorf("creating session container: %w", err)
+	}
+	session.ContainerID = resp.ID
+
+	copies := [][]byte{sessionTar}
+	if session.image == "" {
+		copies = append(copies, req.TarData)
+	}
+	if meta.Config.CaptureImages {
+		copies = append(copies, plotBackendTar)
+	}
+	if meta.Config.Deterministic {
+		copies = append(copies, seedModuleTar)
+	}
+	for _, data := range copies {
+		if err := e.client.CopyToContainer(ctx, resp.ID, "/work", bytes.NewReader(data), container.CopyToContainerOptions{}); err != nil {
+			e.CloseSession(context.Background(), session)
+			return nil, fmt.Errorf("copying files to session container: %w", err)
+		}
+	}
+
+	if err := e.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		e.CloseSession(context.Background(), session)
+		return nil, fmt.Errorf("starting session container: %w", err)
+	}
+
+	return session, nil
+}
+
+// EvalSession sends code to a session's interpreter through docker exec
+func (e *DockerExecutor) EvalSession(ctx context.Context, session *Session, code string) (*SessionOutput, error) {
+	startTime := time.Now()
+
+	execResp, err := e.client.ContainerExecCreate(ctx, session.ContainerID, container.ExecOptions{
+		Cmd:          []string{"python", "/work/" + SessionScript, "eval"},
+		WorkingDir:   "/work",
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating session exec: %w", err)
+	}
+
+	attach, err := e.client.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("attaching to session exec: %w", err)
+	}
+	defer attach.Close()
+
+	go func() {
+		io.WriteString(attach.Conn, code)
+		attach.CloseWrite()
+	}()
+
+	var stdout, stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(&stdout, &stderr, attach.Reader)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("reading session reply: %w", err)
+		}
+	case <-ctx.Done():
+		// Interrupt the code; the interpreter keeps its state
+		e.InterruptSession(context.Background(), session)
+		return nil, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	}
+
+	output, err := parseSessionReply(stdout.Bytes())
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("session interpreter: %s", msg)
+		}
+		return nil, err
+	}
+	output.DurationMs = time.Since(startTime).Milliseconds()
+	return output, nil
+}
+
+// InterruptSession sends SIGINT to a session's interpreter, which raises
+// KeyboardInterrupt in the running code and ignores it between evals
+func (e *DockerExecutor) InterruptSession(ctx context.Context, session *Session) error {
+	return e.client.ContainerKill(ctx, session.ContainerID, "SIGINT")
+}
+
+// parseSessionReply decodes the interpreter's reply to a block of code
+func parseSessionReply(data []byte) (*SessionOutput, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("session interpreter sent no reply")
+	}
+	var output SessionOutput
+	if err := json.Unmarshal(data, &output); err != nil {
+		return nil, fmt.Errorf("parsing session reply: %w", err)
+	}
+	return &output, nil
+}
+
+// CloseSession removes a session's container and its installed image
+func (e *DockerExecutor) CloseSession(ctx context.Context, session *Session) error {
+	defer e.removeSessionImage(session)
+
+	if session.ContainerID == "" {
+		return nil
+	}
+	err := e.client.ContainerRemove(ctx, session.ContainerID, container.RemoveOptions{Force: true})
+	// A container whose interpreter exited on its own removes itself
+	if err != nil && !cerrdefs.IsNotFound(err) && !cerrdefs.IsConflict(err) {
+		return fmt.Errorf("removing session container: %w", err)
+	}
+	return nil
+}
+
+// removeSessionImage removes the image a session's dependencies were
+// installed in, if any
+func (e *DockerExecutor) removeSessionImage(session *Session) {
+	if session.image != "" {
+		e.client.ImageRemove(context.Background(), session.image, image.RemoveOptions{Force: true, PruneChildren: true})
+	}
+}
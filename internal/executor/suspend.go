@@ -0,0 +1,223 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/checkpoint"
+	"github.com/docker/docker/api/types/container"
+)
+
+// Suspender is implemented by executors that can suspend a running
+// execution and resume it later. An execution's timeout stands still while
+// it is suspended.
+type Suspender interface {
+	// Pause freezes the processes of an execution's container
+	Pause(ctx context.Context, containerID string) error
+
+	// Checkpoint saves the state of an execution's container to disk with
+	// CRIU, as the checkpoint name, and stops the container
+	Checkpoint(ctx context.Context, containerID, name string) error
+
+	// Resume continues a paused container or, if name is not empty,
+	// restores a checkpointed one from that checkpoint
+	Resume(ctx context.Context, containerID, name string) error
+}
+
+// runClock is the timeout of a running container. It only counts while
+// the container runs: it stands still while the container is paused or
+// checkpointed.
+type runClock struct {
+	mu        sync.Mutex
+	remaining time.Duration
+	unbounded bool        // the clock never runs out
+	since     time.Time   // when the clock last started
+	timer     *time.Timer // nil while the clock is stopped
+	expire    func()
+
+	// restored is closed when a checkpointed container is restored, or
+	// will not be; nil unless the container is checkpointed
+	restored chan struct{}
+}
+
+// newRunClock starts a clock with timeout left, none if it is zero or
+// less, and returns it with a context that ends when the clock runs out
+// or parent ends
+func newRunClock(parent context.Context, timeout time.Duration) (*runClock, context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	c := &runClock{
+		remaining: timeout,
+		unbounded: timeout <= 0,
+		expire:    func() { cancel(context.DeadlineExceeded) },
+	}
+	c.start()
+	return c, ctx, func() {
+		c.stop()
+		cancel(nil)
+	}
+}
+
+// start starts a stopped clock
+func (c *runClock) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer == nil && !c.unbounded {
+		c.since = time.Now()
+		c.timer = time.AfterFunc(c.remaining, c.expire)
+	}
+}
+
+// stop stops the clock, keeping the time left. A clock that ran out stays
+// run out.
+func (c *runClock) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil && c.timer.Stop() {
+		c.remaining -= time.Since(c.since)
+		c.timer = nil
+	}
+}
+
+// left returns the time left on the clock
+func (c *runClock) left() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer == nil {
+		return c.remaining
+	}
+	return c.remaining - time.Since(c.since)
+}
+
+// checkpoint stops the clock of a container being checkpointed
+func (c *runClock) checkpoint() {
+	c.stop()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restored == nil {
+		c.restored = make(chan struct{})
+	}
+}
+
+// endCheckpoint releases those waiting for a checkpointed container to be
+// restored, and starts the clock again if it was. It reports false if the
+// container was not checkpointed.
+func (c *runClock) endCheckpoint(restored bool) bool {
+	c.mu.Lock()
+	if c.restored == nil {
+		c.mu.Unlock()
+		return false
+	}
+	close(c.restored)
+	c.restored = nil
+	c.mu.Unlock()
+
+	if restored {
+		c.start()
+	}
+	return true
+}
+
+// checkpointed returns a channel closed when a checkpointed container is
+// restored, nil if the container is not checkpointed
+func (c *runClock) checkpointed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.restored == nil {
+		return nil
+	}
+	return c.restored
+}
+
+// track records the clock of a running container, for Pause, Checkpoint
+// and Resume to stop and start
+func (e *DockerExecutor) track(containerID string, clock *runClock) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	if e.runs == nil {
+		e.runs = make(map[string]*runClock)
+	}
+	e.runs[containerID] = clock
+}
+
+// untrack forgets the clock of a container that finished
+func (e *DockerExecutor) untrack(containerID string) {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	delete(e.runs, containerID)
+}
+
+// clock returns the clock of a running container, nil if it has none,
+// e.g. because it is installing dependencies
+func (e *DockerExecutor) clock(containerID string) *runClock {
+	e.runsMu.Lock()
+	defer e.runsMu.Unlock()
+	return e.runs[containerID]
+}
+
+// Pause freezes a container's processes and stops its timeout
+func (e *DockerExecutor) Pause(ctx context.Context, containerID string) error {
+	if err := e.client.ContainerPause(ctx, containerID); err != nil {
+		return fmt.Errorf("pausing container: %w", err)
+	}
+	if c := e.clock(containerID); c != nil {
+		c.stop()
+	}
+	return nil
+}
+
+// Checkpoint saves a running container's state with CRIU and stops it.
+// The container is not removed while it waits to be restored.
+func (e *DockerExecutor) Checkpoint(ctx context.Context, containerID, name string) error {
+	// The clock stops first, so that the container stopping is not taken
+	// for the script ending
+	c := e.clock(containerID)
+	if c != nil {
+		c.checkpoint()
+	}
+	err := e.client.CheckpointCreate(ctx, containerID, checkpoint.CreateOptions{CheckpointID: name, Exit: true})
+	if err != nil {
+		if c != nil {
+			c.endCheckpoint(true)
+		}
+		return fmt.Errorf("checkpointing container: %w", err)
+	}
+	return nil
+}
+
+// Resume unpauses a container, or restores it from the checkpoint name,
+// and starts its timeout again
+func (e *DockerExecutor) Resume(ctx context.Context, containerID, name string) error {
+	c := e.clock(containerID)
+	if name == "" {
+		if err := e.client.ContainerUnpause(ctx, containerID); err != nil {
+			return fmt.Errorf("unpausing container: %w", err)
+		}
+		if c != nil {
+			c.start()
+		}
+		return nil
+	}
+
+	if err := e.client.ContainerStart(ctx, containerID, container.StartOptions{CheckpointID: name}); err != nil {
+		return fmt.Errorf("restoring checkpoint %s: %w", name, err)
+	}
+	// The checkpoint is spent. Deleting it also tells a stopped container
+	// that finished apart from one waiting to be restored when recovering.
+	e.client.CheckpointDelete(context.Background(), containerID, checkpoint.DeleteOptions{CheckpointID: name})
+	if c != nil {
+		c.endCheckpoint(true)
+	}
+	return nil
+}
+
+// hasCheckpoint reports whether a container has a checkpoint to be
+// restored from
+func (e *DockerExecutor) hasCheckpoint(ctx context.Context, containerID string) bool {
+	if !e.config.Docker.Checkpoints {
+		return false
+	}
+	checkpoints, err := e.client.CheckpointList(ctx, containerID, checkpoint.ListOptions{})
+	return err == nil && len(checkpoints) > 0
+}
@@ -0,0 +1,76 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunClock(t *testing.T) {
+	clock, ctx, cancel := newRunClock(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// A stopped clock keeps its time and does not run out
+	clock.stop()
+	left := clock.left()
+	if left <= 0 || left > 100*time.Millisecond {
+		t.Errorf("left = %v", left)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if ctx.Err() != nil || clock.left() != left {
+		t.Fatalf("stopped clock ran: left %v, err %v", clock.left(), ctx.Err())
+	}
+
+	// Started again, it runs out with what was left
+	clock.start()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("clock did not run out")
+	}
+	if context.Cause(ctx) != context.DeadlineExceeded {
+		t.Errorf("cause = %v, want a deadline", context.Cause(ctx))
+	}
+
+	// No timeout never runs out
+	unbounded, ctx, cancel := newRunClock(context.Background(), 0)
+	defer cancel()
+	unbounded.stop()
+	unbounded.start()
+	time.Sleep(10 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Error("a clock without timeout ran out")
+	}
+}
+
+func TestRunClockCheckpoint(t *testing.T) {
+	clock, ctx, cancel := newRunClock(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if clock.checkpointed() != nil || clock.endCheckpoint(true) {
+		t.Fatal("clock checkpointed before a checkpoint")
+	}
+	clock.checkpoint()
+	restored := clock.checkpointed()
+	if restored == nil {
+		t.Fatal("no checkpoint to wait for")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("clock ran while checkpointed")
+	}
+
+	if !clock.endCheckpoint(true) {
+		t.Error("endCheckpoint() = false")
+	}
+	select {
+	case <-restored:
+	default:
+		t.Error("waiters were not released")
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("clock did not start again")
+	}
+}
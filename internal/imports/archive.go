@@ -0,0 +1,40 @@
+package imports
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxSourceSize is the largest source file read from an archive for import
+// detection (1MB). Larger files are skipped; they are rarely hand-written
+// code.
+const MaxSourceSize = 1 << 20
+
+// SourceFiles returns the contents of the .py files, .ipynb notebooks and
+// top-level project files (pyproject.toml, Pipfile) in a tar archive, keyed
+// by their path in it
+func SourceFiles(tarData []byte) (map[string]string, error) {
+	files := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !(strings.HasSuffix(hdr.Name, ".py") || strings.HasSuffix(hdr.Name, NotebookExt) || isProjectFile(hdr.Name)) || hdr.Size > MaxSourceSize {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
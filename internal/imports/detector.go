@@ -1,6 +1,7 @@
 package imports
 
 import (
+	"path"
 	"sort"
 	"strings"
 )
@@ -14,22 +15,74 @@ import (
 // 3. Maps module names to pip package names (e.g., PIL -> Pillow)
 // 4. Returns a newline-separated list of packages
 //
+// Requirements declared in "# requires:" comments are included too, and
+// their version specifiers replace the bare names of detected packages.
+//
 // If no third-party packages are detected, an empty string is returned.
 func DetectRequirements(code string) string {
-	// Parse all imports from the code
-	modules := ParseImports(code)
+	return requirementsFor(ParseImports(code), nil, ParseRequiresComments(code))
+}
+
+// DetectRequirementsInFiles is like DetectRequirements for a multi-file
+// project, keyed by path relative to the working directory. It merges the
+// imports of every .py file and the code cells of every .ipynb notebook,
+// and leaves out modules the project provides itself, such as "helper" for
+// helper.py or "pkg" for pkg/__init__.py.
+func DetectRequirementsInFiles(files map[string]string) string {
+	var modules, declared []string
+	local := make(map[string]bool)
+	for name, code := range files {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+		// Scripts may import siblings from any directory they run in, so
+		// every directory and module name on the path counts as local.
+		// Notebooks can't be imported, so only their directories do.
+		var localPath string
+		switch {
+		case strings.HasSuffix(name, ".py"):
+			localPath = strings.TrimSuffix(name, ".py")
+		case strings.HasSuffix(name, NotebookExt):
+			// Notebooks that aren't valid JSON are left to fail when run
+			nb, err := NotebookCode(code)
+			if err != nil {
+				continue
+			}
+			code = nb
+			localPath = path.Dir(name)
+		default:
+			continue
+		}
 
-	// Filter and map to package names
-	packages := make(map[string]bool)
+		modules = append(modules, ParseImports(code)...)
+		declared = append(declared, ParseRequiresComments(code)...)
+		for _, part := range strings.Split(localPath, "/") {
+			if part != "." {
+				local[part] = true
+			}
+		}
+	}
+	return requirementsFor(modules, local, declared)
+}
+
+// requirementsFor maps imported modules to a sorted, newline-separated list
+// of pip packages, skipping the standard library and local modules, and
+// adds the declared requirements, which replace detected packages of the
+// same name
+func requirementsFor(modules []string, local map[string]bool, declared []string) string {
+	// Requirement lines keyed by lower-cased package name
+	packages := make(map[string]string)
 	for _, module := range modules {
-		// Skip stdlib modules
-		if IsStdlib(module) {
+		// Skip stdlib and local modules
+		if IsStdlib(module) || local[module] {
 			continue
 		}
 
 		// Map to pip package name
 		pkg := GetPackageName(module)
-		packages[pkg] = true
+		packages[strings.ToLower(pkg)] = pkg
+	}
+	for _, req := range declared {
+		packages[strings.ToLower(extractPackageName(req))] = req
 	}
 
 	if len(packages) == 0 {
@@ -38,8 +91,8 @@ func DetectRequirements(code string) string {
 
 	// Convert to sorted slice for deterministic output
 	result := make([]string, 0, len(packages))
-	for pkg := range packages {
-		result = append(result, pkg)
+	for _, req := range packages {
+		result = append(result, req)
 	}
 	sort.Strings(result)
 
@@ -90,9 +143,11 @@ func MergeRequirements(detected, userProvided string) string {
 // extractPackageName extracts the package name from a requirements line.
 // e.g., "requests>=2.28.0" -> "requests"
 func extractPackageName(line string) string {
+	line = strings.TrimSpace(line)
+
 	// Find first occurrence of version specifiers
 	for i, c := range line {
-		if c == '=' || c == '>' || c == '<' || c == '!' || c == '[' || c == ';' {
+		if c == '=' || c == '>' || c == '<' || c == '!' || c == '~' || c == '[' || c == ';' || c == '@' || c == ' ' {
 			return strings.TrimSpace(line[:i])
 		}
 	}
@@ -1,6 +1,9 @@
 package imports
 
 import (
+	"archive/tar"
+	"bytes"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -89,6 +92,31 @@ from sympy import symbols, sqrt, pi, Rational`,
 			code:     "from tensorflow.keras.layers import Dense",
 			expected: []string{"tensorflow"},
 		},
+		{
+			name:     "importlib.import_module",
+			code:     "import importlib\nyaml = importlib.import_module(\"yaml\")\nplt = importlib.import_module('matplotlib.pyplot')",
+			expected: []string{"importlib", "yaml", "matplotlib"},
+		},
+		{
+			name:     "from importlib import import_module",
+			code:     "from importlib import import_module\nmod = import_module( \"requests\" )",
+			expected: []string{"importlib", "requests"},
+		},
+		{
+			name:     "__import__",
+			code:     "np = __import__(\"numpy\")",
+			expected: []string{"numpy"},
+		},
+		{
+			name:     "dynamic import of a variable or relative name is ignored",
+			code:     "importlib.import_module(name)\nimportlib.import_module(\".plugins\", __package__)",
+			expected: []string{},
+		},
+		{
+			name:     "dynamic import in comment or docstring is ignored",
+			code:     "# importlib.import_module(\"fake\")\n\"\"\"__import__(\"fake2\")\"\"\"",
+			expected: []string{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -335,6 +363,8 @@ func TestExtractPackageName(t *testing.T) {
 		{"package[extra]", "package"},
 		{"package; python_version >= '3.8'", "package"},
 		{"  spaces  ", "spaces"},
+		{"attrs~=23.1", "attrs"},
+		{"tool @ git+https://example.com/tool.git", "tool"},
 	}
 
 	for _, tt := range tests {
@@ -347,6 +377,27 @@ func TestExtractPackageName(t *testing.T) {
 	}
 }
 
+func TestParseRequiresComments(t *testing.T) {
+	code := `# requires: numpy==1.26, requests>=2.31
+#Requires: pandas>=2,<3,scikit-learn
+import numpy
+# requires:
+x = 1  # requires: not-a-line-comment
+`
+	want := []string{"numpy==1.26", "requests>=2.31", "pandas>=2,<3", "scikit-learn"}
+	if got := ParseRequiresComments(code); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRequiresComments() = %q, want %q", got, want)
+	}
+}
+
+func TestDetectRequirements_RequiresComments(t *testing.T) {
+	code := "# requires: numpy==1.26, pyyaml>=6\nimport numpy\nimport requests\nimport yaml"
+	want := "numpy==1.26\npyyaml>=6\nrequests"
+	if got := DetectRequirements(code); got != want {
+		t.Errorf("DetectRequirements() = %q, want %q", got, want)
+	}
+}
+
 func TestIsValidModuleName(t *testing.T) {
 	validNames := []string{
 		"numpy", "pandas", "PIL", "_private", "mod123", "my_module",
@@ -369,3 +420,48 @@ func TestIsValidModuleName(t *testing.T) {
 		}
 	}
 }
+
+func TestDetectRequirementsInFiles(t *testing.T) {
+	files := map[string]string{
+		"main.py":             "import numpy\nfrom helper import greet\nfrom app.models import User",
+		"helper.py":           "import requests\nimport os",
+		"app/__init__.py":     "",
+		"app/models.py":       "from sqlalchemy import Column\nfrom . import db",
+		"./scripts/report.py": "import yaml\nimport util",
+		"scripts/util.py":     "import json",
+		"README.md":           "import notpython",
+	}
+
+	want := "PyYAML\nSQLAlchemy\nnumpy\nrequests"
+	if got := DetectRequirementsInFiles(files); got != want {
+		t.Errorf("DetectRequirementsInFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestSourceFiles(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"main.py":        "import numpy",
+		"lib/util.py":    "import pandas",
+		"data.csv":       "a,b",
+		"pyproject.toml": "[project]",
+		"lib/Pipfile":    "[packages]",
+		"nb/demo.ipynb":  "{}",
+		"big/large.py":   strings.Repeat("#", MaxSourceSize+1),
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.WriteHeader(&tar.Header{Name: "lib/", Typeflag: tar.TypeDir, Mode: 0755})
+	tw.Close()
+
+	files, err := SourceFiles(buf.Bytes())
+	if err != nil {
+		t.Fatalf("SourceFiles() error = %v", err)
+	}
+	want := map[string]string{"main.py": "import numpy", "lib/util.py": "import pandas", "pyproject.toml": "[project]", "nb/demo.ipynb": "{}"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("SourceFiles() = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,53 @@
+package imports
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// NotebookExt is the file extension of Jupyter notebooks
+const NotebookExt = ".ipynb"
+
+// notebook is the part of a Jupyter notebook (nbformat 4) holding code
+type notebook struct {
+	Cells []struct {
+		CellType string          `json:"cell_type"`
+		Source   json.RawMessage `json:"source"`
+	} `json:"cells"`
+}
+
+// NotebookCode returns the source of a Jupyter notebook's code cells, one
+// after another. IPython magics and shell escapes (lines starting with %
+// or !) are left out, as they aren't Python.
+func NotebookCode(data string) (string, error) {
+	var nb notebook
+	if err := json.Unmarshal([]byte(data), &nb); err != nil {
+		return "", fmt.Errorf("parsing notebook: %w", err)
+	}
+
+	var code strings.Builder
+	for _, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+
+		// A cell's source is a string or a list of lines
+		var source string
+		var lines []string
+		if err := json.Unmarshal(cell.Source, &lines); err == nil {
+			source = strings.Join(lines, "")
+		} else if err := json.Unmarshal(cell.Source, &source); err != nil {
+			return "", fmt.Errorf("parsing notebook cell: %w", err)
+		}
+
+		for _, line := range strings.Split(source, "\n") {
+			if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "%") || strings.HasPrefix(trimmed, "!") {
+				continue
+			}
+			code.WriteString(line)
+			code.WriteString("\n")
+		}
+	}
+	return code.String(), nil
+}
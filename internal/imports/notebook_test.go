@@ -0,0 +1,41 @@
+package imports
+
+import "testing"
+
+const testNotebook = `{
+ "cells": [
+  {"cell_type": "markdown", "source": ["import fake_markdown\n"]},
+  {"cell_type": "code", "source": ["%matplotlib inline\n", "import pandas as pd\n", "!pip install fake_shell\n", "df = pd.DataFrame()"]},
+  {"cell_type": "code", "source": "from sklearn import datasets"}
+ ],
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestNotebookCode(t *testing.T) {
+	got, err := NotebookCode(testNotebook)
+	if err != nil {
+		t.Fatalf("NotebookCode() error = %v", err)
+	}
+	want := "import pandas as pd\ndf = pd.DataFrame()\nfrom sklearn import datasets\n"
+	if got != want {
+		t.Errorf("NotebookCode() = %q, want %q", got, want)
+	}
+
+	if _, err := NotebookCode("not json"); err == nil {
+		t.Error("NotebookCode() with invalid JSON succeeded, want error")
+	}
+}
+
+func TestDetectRequirementsInFiles_Notebook(t *testing.T) {
+	files := map[string]string{
+		"analysis/report.ipynb": testNotebook,
+		"analysis/helpers.py":   "import numpy",
+		"broken.ipynb":          "{",
+	}
+
+	want := "numpy\npandas\nscikit-learn"
+	if got := DetectRequirementsInFiles(files); got != want {
+		t.Errorf("DetectRequirementsInFiles() = %q, want %q", got, want)
+	}
+}
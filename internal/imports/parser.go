@@ -19,6 +19,19 @@ var stringPattern = regexp.MustCompile(`(?s)'''.*?'''|""".*?"""|'[^'\n]*'|"[^"\n
 // commentPattern matches comments (to exclude imports in comments)
 var commentPattern = regexp.MustCompile(`(?m)#.*$`)
 
+// tripleQuotedPattern matches triple-quoted strings such as docstrings
+var tripleQuotedPattern = regexp.MustCompile(`(?s)'''.*?'''|""".*?"""`)
+
+// dynamicImportPattern matches importlib.import_module("X") and
+// __import__("X") called with a string literal
+// Captures the module name in either kind of quotes
+var dynamicImportPattern = regexp.MustCompile(`\b(?:import_module|__import__)\(\s*(?:'([^'\n]*)'|"([^"\n]*)")`)
+
+// requiresPattern matches "# requires: X, Y" comments that declare
+// requirements in the code itself
+// Captures the list after "requires:"
+var requiresPattern = regexp.MustCompile(`(?mi)^[ \t]*#[ \t]*requires:[ \t]*(.*)$`)
+
 // ParseImports extracts all imported module names from Python code.
 // It handles:
 // - import X
@@ -26,17 +39,29 @@ var commentPattern = regexp.MustCompile(`(?m)#.*$`)
 // - import X, Y, Z
 // - from X import Y
 // - from X.submodule import Y
+// - importlib.import_module("X") and __import__("X")
 //
-// It ignores imports inside string literals and comments.
+// It ignores imports inside string literals and comments, except that a
+// dynamic import in a single-line string is still counted.
 func ParseImports(code string) []string {
+	modules := make(map[string]bool)
+
+	// Dynamic imports name their module in a string literal, so look for
+	// them before strings are removed
+	dynamicCode := commentPattern.ReplaceAllString(tripleQuotedPattern.ReplaceAllString(code, ""), "")
+	for _, match := range dynamicImportPattern.FindAllStringSubmatch(dynamicCode, -1) {
+		module := match[1] + match[2]
+		if isValidModuleName(module) {
+			modules[extractTopLevel(module)] = true
+		}
+	}
+
 	// Remove string literals first to avoid matching imports inside strings
 	cleanCode := stringPattern.ReplaceAllString(code, "")
 
 	// Remove comments to avoid matching imports in comments
 	cleanCode = commentPattern.ReplaceAllString(cleanCode, "")
 
-	modules := make(map[string]bool)
-
 	// Match "import X" patterns
 	matches := importPattern.FindAllStringSubmatch(cleanCode, -1)
 	for _, match := range matches {
@@ -114,3 +139,24 @@ func isValidModuleName(name string) bool {
 
 	return true
 }
+
+// ParseRequiresComments extracts the requirements declared by
+// "# requires: numpy==1.26, requests>=2.31" comments, in requirements
+// format. Commas separate requirements unless the next part is another
+// version specifier, so "# requires: pandas>=2,<3" is one requirement.
+func ParseRequiresComments(code string) []string {
+	var reqs []string
+	for _, match := range requiresPattern.FindAllStringSubmatch(code, -1) {
+		for _, part := range strings.Split(match[1], ",") {
+			part = strings.TrimSpace(part)
+			switch {
+			case part == "":
+			case strings.TrimLeft(part, "<>=!~") != part && len(reqs) > 0:
+				reqs[len(reqs)-1] += "," + part
+			case isValidModuleName(strings.ReplaceAll(extractPackageName(part), "-", "_")):
+				reqs = append(reqs, part)
+			}
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,254 @@
+package imports
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Project files whose declared dependencies are used instead of scanning
+// imports, when found at the top of a project
+const (
+	PyprojectFile = "pyproject.toml"
+	PipfileFile   = "Pipfile"
+)
+
+// isProjectFile reports whether a path relative to the working directory
+// is a top-level project file
+func isProjectFile(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	return name == PyprojectFile || name == PipfileFile
+}
+
+// FileRequirements returns the requirements for a multi-file project,
+// keyed by path relative to the working directory. If a top-level
+// pyproject.toml or Pipfile declares dependencies they are used, as that
+// is how the project itself is installed; otherwise they are detected from
+// the imports of the .py files, as by DetectRequirementsInFiles.
+func FileRequirements(files map[string]string) (string, error) {
+	var declared []string
+	found := false
+	for name, content := range files {
+		if !isProjectFile(name) {
+			continue
+		}
+
+		var deps []string
+		var ok bool
+		var err error
+		if path.Base(name) == PyprojectFile {
+			deps, ok, err = ParsePyproject(content)
+		} else {
+			deps, ok, err = ParsePipfile(content)
+		}
+		if err != nil {
+			return "", err
+		}
+		found = found || ok
+		declared = append(declared, deps...)
+	}
+	if !found {
+		return DetectRequirementsInFiles(files), nil
+	}
+
+	sort.Strings(declared)
+	return strings.Join(declared, "\n"), nil
+}
+
+// pyproject is the part of pyproject.toml holding dependencies: PEP 621's
+// [project] table and Poetry's [tool.poetry] table
+type pyproject struct {
+	Project struct {
+		Dependencies []string `toml:"dependencies"`
+	} `toml:"project"`
+	Tool struct {
+		Poetry struct {
+			Dependencies map[string]any `toml:"dependencies"`
+		} `toml:"poetry"`
+	} `toml:"tool"`
+}
+
+// ParsePyproject returns the runtime dependencies declared in a
+// pyproject.toml, in requirements format. PEP 621 dependencies are used as
+// they are; Poetry's are converted from its constraint syntax.
+// Development and optional dependencies are left out. ok is false if the
+// file has no dependency table, e.g. because it only configures tools.
+func ParsePyproject(content string) (deps []string, ok bool, err error) {
+	var p pyproject
+	if err := toml.Unmarshal([]byte(content), &p); err != nil {
+		return nil, false, fmt.Errorf("parsing %s: %w", PyprojectFile, err)
+	}
+	ok = p.Project.Dependencies != nil || p.Tool.Poetry.Dependencies != nil
+
+	deps = append(deps, p.Project.Dependencies...)
+	for name, spec := range p.Tool.Poetry.Dependencies {
+		// Poetry lists the supported Python among the dependencies
+		if strings.EqualFold(name, "python") {
+			continue
+		}
+		if req, ok := dependencyRequirement(name, spec, poetryConstraint); ok {
+			deps = append(deps, req)
+		}
+	}
+	return deps, ok, nil
+}
+
+// pipfile is the part of a Pipfile holding runtime dependencies
+type pipfile struct {
+	Packages map[string]any `toml:"packages"`
+}
+
+// ParsePipfile returns the [packages] declared in a Pipfile, in
+// requirements format. [dev-packages] are left out. ok is false if the
+// file has no [packages] table.
+func ParsePipfile(content string) (deps []string, ok bool, err error) {
+	var p pipfile
+	if err := toml.Unmarshal([]byte(content), &p); err != nil {
+		return nil, false, fmt.Errorf("parsing %s: %w", PipfileFile, err)
+	}
+
+	for name, spec := range p.Packages {
+		if req, ok := dependencyRequirement(name, spec, pipfileConstraint); ok {
+			deps = append(deps, req)
+		}
+	}
+	return deps, p.Packages != nil, nil
+}
+
+// dependencyRequirement turns a Poetry or Pipfile dependency into a
+// requirement line. spec is either a version constraint, converted with
+// constraint, or a table with version, extras, markers and git keys. ok is
+// false for dependencies pip can't install from a requirement line, such
+// as local paths, and for optional ones.
+func dependencyRequirement(name string, spec any, constraint func(string) string) (req string, ok bool) {
+	switch spec := spec.(type) {
+	case string:
+		return name + constraint(spec), true
+
+	case map[string]any:
+		if optional, _ := spec["optional"].(bool); optional {
+			return "", false
+		}
+
+		req = name
+		if extras, ok := spec["extras"].([]any); ok && len(extras) > 0 {
+			names := make([]string, 0, len(extras))
+			for _, e := range extras {
+				if s, ok := e.(string); ok {
+					names = append(names, s)
+				}
+			}
+			req += "[" + strings.Join(names, ",") + "]"
+		}
+
+		if git, ok := spec["git"].(string); ok {
+			req += " @ git+" + git
+			for _, key := range []string{"rev", "tag", "branch", "ref"} {
+				if ref, ok := spec[key].(string); ok {
+					req += "@" + ref
+					break
+				}
+			}
+		} else if url, ok := spec["url"].(string); ok {
+			req += " @ " + url
+		} else if version, ok := spec["version"].(string); ok {
+			req += constraint(version)
+		} else if _, ok := spec["path"]; ok {
+			return "", false
+		}
+
+		if markers, ok := spec["markers"].(string); ok && markers != "" {
+			req += "; " + markers
+		}
+		return req, true
+	}
+	return "", false
+}
+
+// pipfileConstraint returns a Pipfile version, which is already a PEP 440
+// specifier, with "*" meaning any version
+func pipfileConstraint(version string) string {
+	version = strings.TrimSpace(version)
+	if version == "*" {
+		return ""
+	}
+	return version
+}
+
+// poetryConstraint converts a Poetry version constraint to a PEP 440
+// specifier: "^1.2" becomes ">=1.2,<2.0", "~1.2" becomes ">=1.2,<1.3", a
+// bare version is pinned and "*" means any version
+func poetryConstraint(constraint string) string {
+	var specs []string
+	for _, c := range strings.Split(constraint, ",") {
+		c = strings.TrimSpace(c)
+		switch {
+		case c == "" || c == "*":
+		case strings.HasPrefix(c, "^"):
+			specs = append(specs, caretRange(strings.TrimPrefix(c, "^"))...)
+		case strings.HasPrefix(c, "~") && !strings.HasPrefix(c, "~="):
+			specs = append(specs, tildeRange(strings.TrimPrefix(c, "~"))...)
+		case strings.TrimLeft(c, "<>=!~") != c:
+			specs = append(specs, strings.ReplaceAll(c, " ", ""))
+		default:
+			specs = append(specs, "=="+c)
+		}
+	}
+	return strings.Join(specs, ",")
+}
+
+// caretRange expands Poetry's ^version: anything up to, but excluding, the
+// next increment of the first non-zero number
+func caretRange(version string) []string {
+	release, _, ok := parseVersion(version)
+	if !ok {
+		return []string{">=" + version}
+	}
+
+	bump := len(release) - 1
+	for i, n := range release {
+		if n != 0 {
+			bump = i
+			break
+		}
+	}
+	return []string{">=" + version, "<" + upperBound(release, bump)}
+}
+
+// tildeRange expands Poetry's ~version: patch updates if a minor version
+// is given, else minor updates
+func tildeRange(version string) []string {
+	release, _, ok := parseVersion(version)
+	if !ok {
+		return []string{">=" + version}
+	}
+
+	bump := 1
+	if len(release) == 1 {
+		bump = 0
+	}
+	return []string{">=" + version, "<" + upperBound(release, bump)}
+}
+
+// upperBound returns release with the number at index i incremented and
+// everything after it zeroed, e.g. 1.2.3 at 1 gives 1.3.0
+func upperBound(release []int, i int) string {
+	parts := make([]string, 0, len(release))
+	for j := range release {
+		n := release[j]
+		switch {
+		case j == i:
+			n++
+		case j > i:
+			n = 0
+		}
+		parts = append(parts, fmt.Sprint(n))
+	}
+	if len(parts) == 1 {
+		parts = append(parts, "0")
+	}
+	return strings.Join(parts, ".")
+}
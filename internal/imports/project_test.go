@@ -0,0 +1,121 @@
+package imports
+
+import "testing"
+
+func TestFileRequirements(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "pep 621",
+			files: map[string]string{
+				"main.py": "import yaml",
+				"pyproject.toml": `[project]
+name = "demo"
+dependencies = [
+    "requests>=2.31",  # HTTP
+    "numpy",
+]
+`,
+			},
+			want: "numpy\nrequests>=2.31",
+		},
+		{
+			name: "poetry",
+			files: map[string]string{
+				"pyproject.toml": `[tool.poetry.dependencies]
+python = "^3.10"
+pandas = "^2.1"
+attrs = "~23.1.0"
+click = "*"
+rich = { version = "13.7.0", extras = ["jupyter"] }
+mylib = { path = "../mylib" }
+extra = { version = "^1.0", optional = true }
+tool = { git = "https://github.com/example/tool.git", tag = "v1.0" }
+
+[tool.poetry.group.dev.dependencies]
+pytest = "^8.0"
+`,
+			},
+			want: "attrs>=23.1.0,<23.2.0\nclick\npandas>=2.1,<3.0\nrich[jupyter]==13.7.0\ntool @ git+https://github.com/example/tool.git@v1.0",
+		},
+		{
+			name: "pipfile",
+			files: map[string]string{
+				"./Pipfile": `[packages]
+requests = "*"
+django = "==4.2"
+flask = {version = ">=3.0", markers = "python_version >= '3.9'"}
+
+[dev-packages]
+pytest = "*"
+`,
+			},
+			want: "django==4.2\nflask>=3.0; python_version >= '3.9'\nrequests",
+		},
+		{
+			name: "tool config only falls back to imports",
+			files: map[string]string{
+				"main.py":        "import numpy",
+				"pyproject.toml": "[tool.black]\nline-length = 100\n",
+			},
+			want: "numpy",
+		},
+		{
+			name: "nested project file is ignored",
+			files: map[string]string{
+				"main.py":            "import numpy",
+				"vendor/lib/Pipfile": "[packages]\nrequests = \"*\"\n",
+			},
+			want: "numpy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileRequirements(tt.files)
+			if err != nil {
+				t.Fatalf("FileRequirements() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("FileRequirements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := FileRequirements(map[string]string{"pyproject.toml": "[project"}); err == nil {
+		t.Error("FileRequirements() with invalid TOML succeeded, want error")
+	}
+}
+
+func TestPoetryConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"^1.2.3", ">=1.2.3,<2.0.0"},
+		{"^0.2.3", ">=0.2.3,<0.3.0"},
+		{"^0.0.3", ">=0.0.3,<0.0.4"},
+		{"^2", ">=2,<3.0"},
+		{"~1.2.3", ">=1.2.3,<1.3.0"},
+		{"~1", ">=1,<2.0"},
+		{"~=1.4", "~=1.4"},
+		{">= 1.0, < 2.0", ">=1.0,<2.0"},
+		{"1.5.0", "==1.5.0"},
+		{"*", ""},
+	}
+	for _, tt := range tests {
+		if got := poetryConstraint(tt.constraint); got != tt.want {
+			t.Errorf("poetryConstraint(%q) = %q, want %q", tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestParsePipfile_NoPackages(t *testing.T) {
+	deps, ok, err := ParsePipfile("[dev-packages]\npytest = \"*\"\n")
+	if err != nil || ok || len(deps) != 0 {
+		t.Errorf("ParsePipfile() = %v, %v, %v, want no packages", deps, ok, err)
+	}
+}
@@ -0,0 +1,271 @@
+package imports
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultIndexURL is the PyPI JSON API that packages are resolved against
+const DefaultIndexURL = "https://pypi.org/pypi"
+
+// Resolver pins packages to their newest release on a PyPI-compatible
+// index that supports a given Python version. Resolutions are cached, so
+// repeated auto-installs of the same imports get the same versions until
+// the cache entry expires.
+type Resolver struct {
+	indexURL string
+	ttl      time.Duration
+	client   *http.Client
+
+	mu    sync.Mutex
+	cache map[resolveKey]resolution
+}
+
+// resolveKey identifies a cached resolution
+type resolveKey struct {
+	pkg    string
+	python string
+}
+
+// resolution is a cached version and when it was resolved
+type resolution struct {
+	version    string
+	resolvedAt time.Time
+}
+
+// NewResolver creates a Resolver for the JSON API at indexURL (see
+// DefaultIndexURL). Resolutions are kept for ttl; 0 keeps them for the
+// life of the Resolver.
+func NewResolver(indexURL string, ttl time.Duration) *Resolver {
+	return &Resolver{
+		indexURL: strings.TrimSuffix(indexURL, "/"),
+		ttl:      ttl,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		cache:    make(map[resolveKey]resolution),
+	}
+}
+
+// pypiProject is the part of the PyPI JSON API's project response the
+// resolver reads
+type pypiProject struct {
+	Releases map[string][]struct {
+		RequiresPython string `json:"requires_python"`
+		Yanked         bool   `json:"yanked"`
+	} `json:"releases"`
+}
+
+// Resolve returns the newest final release of pkg that has a file which is
+// not yanked and whose requires_python admits python, e.g. "3.12". An
+// empty python accepts any release.
+func (r *Resolver) Resolve(ctx context.Context, pkg, python string) (string, error) {
+	key := resolveKey{pkg: strings.ToLower(pkg), python: python}
+
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && (r.ttl == 0 || time.Since(cached.resolvedAt) < r.ttl) {
+		return cached.version, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", r.indexURL+"/"+url.PathEscape(pkg)+"/json", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("resolving %s: %w", pkg, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resolving %s: index returned %d", pkg, resp.StatusCode)
+	}
+	var project pypiProject
+	if err := json.NewDecoder(resp.Body).Decode(&project); err != nil {
+		return "", fmt.Errorf("resolving %s: %w", pkg, err)
+	}
+
+	pyVersion, _, _ := parseVersion(python)
+	var best string
+	var bestRelease []int
+	var bestPost int
+	for version, files := range project.Releases {
+		release, post, ok := parseVersion(version)
+		if !ok {
+			continue
+		}
+		if best != "" && compareVersions(release, post, bestRelease, bestPost) <= 0 {
+			continue
+		}
+		for _, f := range files {
+			if !f.Yanked && (pyVersion == nil || matchesSpecifiers(pyVersion, f.RequiresPython)) {
+				best, bestRelease, bestPost = version, release, post
+				break
+			}
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no release of %s supports Python %s", pkg, python)
+	}
+
+	r.mu.Lock()
+	r.cache[key] = resolution{version: best, resolvedAt: time.Now()}
+	r.mu.Unlock()
+	return best, nil
+}
+
+// Lock pins every requirement in a requirements.txt string that has no
+// version specifier to its resolved version, e.g. "numpy" becomes
+// "numpy==2.1.3". Other lines are kept as they are, as are requirements
+// that fail to resolve; the first resolution error is returned along with
+// the partly pinned requirements.
+func (r *Resolver) Lock(ctx context.Context, requirements, python string) (string, error) {
+	var firstErr error
+	lines := strings.Split(requirements, "\n")
+	for i, line := range lines {
+		name := strings.TrimSpace(line)
+		if name == "" || strings.HasPrefix(name, "#") || strings.HasPrefix(name, "-") || extractPackageName(name) != name {
+			continue
+		}
+
+		version, err := r.Resolve(ctx, name, python)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		lines[i] = name + "==" + version
+	}
+	return strings.Join(lines, "\n"), firstErr
+}
+
+// parseVersion splits a final release version such as "2.1.0" or
+// "1.0.post2" into its release numbers and post-release number. ok is false
+// for pre-releases, dev releases, local versions and anything else it can't
+// parse, which the resolver never picks.
+func parseVersion(v string) (release []int, post int, ok bool) {
+	v, postPart, hasPost := strings.Cut(strings.ToLower(strings.TrimSpace(v)), ".post")
+	if hasPost {
+		n, err := strconv.Atoi(postPart)
+		if err != nil {
+			return nil, 0, false
+		}
+		post = n
+	}
+	if v == "" {
+		return nil, 0, false
+	}
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, 0, false
+		}
+		release = append(release, n)
+	}
+	return release, post, true
+}
+
+// compareVersions orders two parsed versions, padding the shorter release
+// with zeros, then by post-release
+func compareVersions(a []int, aPost int, b []int, bPost int) int {
+	if c := compareRelease(a, b); c != 0 {
+		return c
+	}
+	switch {
+	case aPost < bPost:
+		return -1
+	case aPost > bPost:
+		return 1
+	}
+	return 0
+}
+
+// compareRelease orders two release number lists, padding the shorter one
+// with zeros
+func compareRelease(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// matchesSpecifiers reports whether a Python version satisfies a
+// requires_python specifier set such as ">=3.9,<3.13" or "!=3.0.*".
+// Clauses it can't parse are treated as satisfied, so an unusual
+// specifier never rules out a release.
+func matchesSpecifiers(python []int, specifiers string) bool {
+	for _, clause := range strings.Split(specifiers, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+
+		op := clause[:len(clause)-len(strings.TrimLeft(clause, "<>=!~"))]
+		operand := strings.TrimSpace(clause[len(op):])
+
+		// "==3.*" and "!=3.0.*" compare a prefix of the version
+		if prefix, wildcard := strings.CutSuffix(operand, ".*"); wildcard && (op == "==" || op == "!=") {
+			want, _, ok := parseVersion(prefix)
+			if !ok {
+				continue
+			}
+			matches := len(python) >= len(want) && compareRelease(python[:len(want)], want) == 0
+			if matches != (op == "==") {
+				return false
+			}
+			continue
+		}
+
+		want, _, ok := parseVersion(operand)
+		if !ok {
+			continue
+		}
+		c := compareRelease(python, want)
+		var satisfied bool
+		switch op {
+		case ">=":
+			satisfied = c >= 0
+		case "<=":
+			satisfied = c <= 0
+		case ">":
+			satisfied = c > 0
+		case "<":
+			satisfied = c < 0
+		case "==", "===":
+			satisfied = c == 0
+		case "!=":
+			satisfied = c != 0
+		case "~=":
+			// Compatible release: at least want, with the same prefix
+			// but for its last number
+			satisfied = c >= 0 && len(want) > 1 &&
+				len(python) >= len(want)-1 && compareRelease(python[:len(want)-1], want[:len(want)-1]) == 0
+		default:
+			satisfied = true
+		}
+		if !satisfied {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package imports
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestIndex serves a PyPI JSON API with one project, counting requests
+func newTestIndex(t *testing.T, hits *int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if r.URL.Path != "/numpy/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"releases": {
+			"1.26.4": [{"requires_python": ">=3.9", "yanked": false}],
+			"2.0.0": [{"requires_python": ">=3.9", "yanked": true}],
+			"2.1.3": [{"requires_python": ">=3.10", "yanked": false}],
+			"2.2.0rc1": [{"requires_python": ">=3.10", "yanked": false}],
+			"2.3.0": []
+		}}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	var hits int32
+	r := NewResolver(newTestIndex(t, &hits).URL+"/", 0)
+	ctx := context.Background()
+
+	tests := []struct {
+		python string
+		want   string
+	}{
+		{"3.12", "2.1.3"},
+		{"3.9", "1.26.4"},
+		{"", "2.1.3"},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(ctx, "numpy", tt.python)
+		if err != nil {
+			t.Fatalf("Resolve(numpy, %q) error = %v", tt.python, err)
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(numpy, %q) = %q, want %q", tt.python, got, tt.want)
+		}
+	}
+
+	if _, err := r.Resolve(ctx, "numpy", "3.8"); err == nil {
+		t.Error("Resolve(numpy, 3.8) succeeded, want no compatible release")
+	}
+	if _, err := r.Resolve(ctx, "missing", "3.12"); err == nil {
+		t.Error("Resolve(missing) succeeded, want error")
+	}
+
+	// Cached resolutions don't go back to the index
+	before := atomic.LoadInt32(&hits)
+	if got, _ := r.Resolve(ctx, "NumPy", "3.12"); got != "2.1.3" {
+		t.Errorf("cached Resolve = %q, want 2.1.3", got)
+	}
+	if after := atomic.LoadInt32(&hits); after != before {
+		t.Errorf("cached Resolve made %d requests", after-before)
+	}
+}
+
+func TestResolver_Lock(t *testing.T) {
+	var hits int32
+	r := NewResolver(newTestIndex(t, &hits).URL, 0)
+
+	got, err := r.Lock(context.Background(), "numpy\nrequests>=2\n# comment\nmissing", "3.12")
+	if err == nil {
+		t.Error("Lock() error = nil, want error for missing")
+	}
+	if want := "numpy==2.1.3\nrequests>=2\n# comment\nmissing"; got != want {
+		t.Errorf("Lock() = %q, want %q", got, want)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		release []int
+		post    int
+		ok      bool
+	}{
+		{"2.1.0", []int{2, 1, 0}, 0, true},
+		{"1.0.post2", []int{1, 0}, 2, true},
+		{"3.12", []int{3, 12}, 0, true},
+		{"2.0.0rc1", nil, 0, false},
+		{"1.0.dev3", nil, 0, false},
+		{"1.0+local", nil, 0, false},
+		{"", nil, 0, false},
+	}
+	for _, tt := range tests {
+		release, post, ok := parseVersion(tt.version)
+		if ok != tt.ok || post != tt.post || len(release) != len(tt.release) {
+			t.Errorf("parseVersion(%q) = %v, %d, %v, want %v, %d, %v", tt.version, release, post, ok, tt.release, tt.post, tt.ok)
+			continue
+		}
+		for i := range release {
+			if release[i] != tt.release[i] {
+				t.Errorf("parseVersion(%q) = %v, want %v", tt.version, release, tt.release)
+				break
+			}
+		}
+	}
+}
+
+func TestMatchesSpecifiers(t *testing.T) {
+	py312 := []int{3, 12}
+	tests := []struct {
+		specifiers string
+		want       bool
+	}{
+		{"", true},
+		{">=3.9", true},
+		{">=3.9, <3.12", false},
+		{">=3.9,<3.13", true},
+		{"!=3.12.*", false},
+		{"!=3.0.*,!=3.1.*", true},
+		{"==3.*", true},
+		{"==2.*", false},
+		{"~=3.8", true},
+		{"~=3.8.1", false},
+		{">3.12", false},
+		{"<=3.12", true},
+		{">=3.9; weird", true},
+	}
+	for _, tt := range tests {
+		if got := matchesSpecifiers(py312, tt.specifiers); got != tt.want {
+			t.Errorf("matchesSpecifiers(3.12, %q) = %v, want %v", tt.specifiers, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// consulChunkSize keeps each KV value below Consul's 512KB limit
+const consulChunkSize = 400 * 1024
+
+// consulSessionTTL bounds how long a dead replica's claims stay locked
+const consulSessionTTL = "30s"
+
+// consulWaitTime is the blocking-query wait used while polling for jobs
+const consulWaitTime = 30 * time.Second
+
+// consulJob is the JSON stored at a job key; the archive is stored in chunks
+type consulJob struct {
+	ExecutionID string           `json:"execution_id"`
+	Metadata    *client.Metadata `json:"metadata"`
+	Chunks      int              `json:"chunks"`
+}
+
+// ConsulQueue implements a queue shared by every replica pointing at the same
+// Consul key prefix. Each replica holds a Consul session; claiming a job
+// acquires its key with that session, so if a replica dies its claims are
+// released when the session expires.
+type ConsulQueue struct {
+	client    *consulapi.Client
+	keyPrefix string
+	sessionID string
+	stopRenew chan struct{}
+
+	mu      sync.Mutex
+	claimed map[string]string // execution ID -> job key
+}
+
+// NewConsulQueue creates a Consul-backed queue and its worker session
+func NewConsulQueue(address, token, keyPrefix string) (*ConsulQueue, error) {
+	config := consulapi.DefaultConfig()
+	config.Address = address
+	if token != "" {
+		config.Token = token
+	}
+
+	c, err := consulapi.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating consul client: %w", err)
+	}
+
+	sessionID, _, err := c.Session().Create(&consulapi.SessionEntry{
+		Name:      "python-executor-queue",
+		TTL:       consulSessionTTL,
+		Behavior:  consulapi.SessionBehaviorRelease,
+		LockDelay: time.Second,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating consul session: %w", err)
+	}
+
+	q := &ConsulQueue{
+		client:    c,
+		keyPrefix: keyPrefix,
+		sessionID: sessionID,
+		stopRenew: make(chan struct{}),
+		claimed:   make(map[string]string),
+	}
+
+	go c.Session().RenewPeriodic(consulSessionTTL, sessionID, nil, q.stopRenew)
+
+	return q, nil
+}
+
+// Enqueue stores the archive chunks first and then the job key, so workers
+// never see a job whose payload is incomplete
+func (q *ConsulQueue) Enqueue(ctx context.Context, job *Job) error {
+	data, err := q.storePayload(ctx, job)
+	if err != nil {
+		return err
+	}
+	if _, err := q.client.KV().Put(&consulapi.KVPair{Key: q.jobKey(job.ExecutionID), Value: data}, (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("storing job: %w", err)
+	}
+
+	return nil
+}
+
+// Hold stores the job's payload like Enqueue, but its job key outside the
+// queue until it is approved
+func (q *ConsulQueue) Hold(ctx context.Context, job *Job) error {
+	data, err := q.storePayload(ctx, job)
+	if err != nil {
+		return err
+	}
+	if _, err := q.client.KV().Put(&consulapi.KVPair{Key: q.heldKey(job.ExecutionID), Value: data}, (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("storing held job: %w", err)
+	}
+
+	return nil
+}
+
+// Approve moves a held job key into the queue. The held key is removed with
+// a check-and-set, so a job approved by two replicas at once runs once.
+func (q *ConsulQueue) Approve(ctx context.Context, executionID string) error {
+	pair, err := q.takeHeld(ctx, executionID)
+	if err != nil {
+		return err
+	}
+	if _, err := q.client.KV().Put(&consulapi.KVPair{Key: q.jobKey(executionID), Value: pair.Value}, (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("storing job: %w", err)
+	}
+
+	return nil
+}
+
+// Discard deletes a held job and its payload
+func (q *ConsulQueue) Discard(ctx context.Context, executionID string) error {
+	if _, err := q.takeHeld(ctx, executionID); err != nil {
+		return err
+	}
+	if _, err := q.client.KV().DeleteTree(q.dataPrefix(executionID), (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("deleting job payload: %w", err)
+	}
+
+	return nil
+}
+
+// takeHeld removes a held job key and returns it
+func (q *ConsulQueue) takeHeld(ctx context.Context, executionID string) (*consulapi.KVPair, error) {
+	kv := q.client.KV()
+	pair, _, err := kv.Get(q.heldKey(executionID), (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("getting held job: %w", err)
+	}
+	if pair == nil {
+		return nil, ErrNotHeld
+	}
+
+	deleted, _, err := kv.DeleteCAS(pair, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("deleting held job: %w", err)
+	}
+	if !deleted {
+		return nil, ErrNotHeld
+	}
+	return pair, nil
+}
+
+// storePayload stores a job's archive chunks and returns the value for its
+// job key
+func (q *ConsulQueue) storePayload(ctx context.Context, job *Job) ([]byte, error) {
+	kv := q.client.KV()
+	opts := (&consulapi.WriteOptions{}).WithContext(ctx)
+
+	chunks := 0
+	for offset := 0; offset < len(job.TarData); offset += consulChunkSize {
+		end := min(offset+consulChunkSize, len(job.TarData))
+		p := &consulapi.KVPair{
+			Key:   q.chunkKey(job.ExecutionID, chunks),
+			Value: job.TarData[offset:end],
+		}
+		if _, err := kv.Put(p, opts); err != nil {
+			return nil, fmt.Errorf("storing job payload: %w", err)
+		}
+		chunks++
+	}
+
+	data, err := json.Marshal(&consulJob{
+		ExecutionID: job.ExecutionID,
+		Metadata:    job.Metadata,
+		Chunks:      chunks,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling job: %w", err)
+	}
+	return data, nil
+}
+
+// Claim waits for an unclaimed job and acquires it with this replica's session
+func (q *ConsulQueue) Claim(ctx context.Context) (*Job, error) {
+	return q.ClaimMatching(ctx, nil)
+}
+
+// ClaimMatching waits for an unclaimed job match accepts and acquires it
+// with this replica's session; a nil match accepts every job. Jobs are
+// matched on their metadata before their archive is read.
+func (q *ConsulQueue) ClaimMatching(ctx context.Context, match func(*Job) bool) (*Job, error) {
+	kv := q.client.KV()
+	prefix := q.keyPrefix + "/queue/jobs/"
+	var waitIndex uint64
+
+	for {
+		opts := (&consulapi.QueryOptions{WaitIndex: waitIndex, WaitTime: consulWaitTime}).WithContext(ctx)
+		pairs, meta, err := kv.List(prefix, opts)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		waitIndex = meta.LastIndex
+
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+		for _, pair := range pairs {
+			if pair.Session != "" {
+				continue // claimed by another worker
+			}
+			if match != nil {
+				var stored consulJob
+				if err := json.Unmarshal(pair.Value, &stored); err == nil &&
+					!match(&Job{ExecutionID: stored.ExecutionID, Metadata: stored.Metadata}) {
+					continue // left for a worker that can run it
+				}
+			}
+
+			pair.Session = q.sessionID
+			acquired, _, err := kv.Acquire(pair, (&consulapi.WriteOptions{}).WithContext(ctx))
+			if err != nil || !acquired {
+				continue
+			}
+
+			job, err := q.loadJob(ctx, pair.Value)
+			if err != nil {
+				// Unreadable job; drop it so it doesn't block the queue
+				kv.Delete(pair.Key, nil)
+				continue
+			}
+
+			q.mu.Lock()
+			q.claimed[job.ExecutionID] = pair.Key
+			q.mu.Unlock()
+
+			return job, nil
+		}
+	}
+}
+
+// Complete deletes a claimed job and its payload
+func (q *ConsulQueue) Complete(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	key, ok := q.claimed[executionID]
+	delete(q.claimed, executionID)
+	q.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("job %s is not claimed", executionID)
+	}
+
+	kv := q.client.KV()
+	opts := (&consulapi.WriteOptions{}).WithContext(ctx)
+	if _, err := kv.Delete(key, opts); err != nil {
+		return fmt.Errorf("deleting job: %w", err)
+	}
+	if _, err := kv.DeleteTree(q.dataPrefix(executionID), opts); err != nil {
+		return fmt.Errorf("deleting job payload: %w", err)
+	}
+
+	return nil
+}
+
+// Release gives up the claim so another replica can run the job
+func (q *ConsulQueue) Release(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	key, ok := q.claimed[executionID]
+	delete(q.claimed, executionID)
+	q.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("job %s is not claimed", executionID)
+	}
+
+	kv := q.client.KV()
+	pair, _, err := kv.Get(key, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("getting job: %w", err)
+	}
+	if pair == nil {
+		return nil
+	}
+
+	pair.Session = q.sessionID
+	if _, _, err := kv.Release(pair, (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("releasing job: %w", err)
+	}
+
+	return nil
+}
+
+// Remove deletes a job no replica has claimed, and its payload. The job
+// key is removed with a check-and-set, so a job claimed meanwhile is left
+// to its worker.
+func (q *ConsulQueue) Remove(ctx context.Context, executionID string) error {
+	kv := q.client.KV()
+	pairs, _, err := kv.List(q.keyPrefix+"/queue/jobs/", (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("listing jobs: %w", err)
+	}
+	var pair *consulapi.KVPair
+	for _, p := range pairs {
+		if strings.HasSuffix(p.Key, "-"+executionID) {
+			pair = p
+		}
+	}
+	if pair == nil || pair.Session != "" {
+		return nil
+	}
+
+	deleted, _, err := kv.DeleteCAS(pair, (&consulapi.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("deleting job: %w", err)
+	}
+	if !deleted {
+		return nil
+	}
+	if _, err := kv.DeleteTree(q.dataPrefix(executionID), (&consulapi.WriteOptions{}).WithContext(ctx)); err != nil {
+		return fmt.Errorf("deleting job payload: %w", err)
+	}
+
+	return nil
+}
+
+// Len returns the number of jobs no replica has claimed
+func (q *ConsulQueue) Len(ctx context.Context) (int, error) {
+	pairs, _, err := q.client.KV().List(q.keyPrefix+"/queue/jobs/", (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("listing jobs: %w", err)
+	}
+
+	n := 0
+	for _, pair := range pairs {
+		if pair.Session == "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Position returns a job's place among the jobs no replica has claimed, in
+// the order they are claimed, or 0 if it isn't one of them
+func (q *ConsulQueue) Position(ctx context.Context, executionID string) (int, error) {
+	pairs, _, err := q.client.KV().List(q.keyPrefix+"/queue/jobs/", (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("listing jobs: %w", err)
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	n := 0
+	for _, pair := range pairs {
+		if pair.Session != "" {
+			continue
+		}
+		n++
+		if strings.HasSuffix(pair.Key, "-"+executionID) {
+			return n, nil
+		}
+	}
+	return 0, nil
+}
+
+// Durable is true: jobs are stored in Consul and outlive any replica
+func (q *ConsulQueue) Durable() bool {
+	return true
+}
+
+// Close stops session renewal and destroys the session, releasing any claims
+func (q *ConsulQueue) Close() error {
+	close(q.stopRenew)
+	_, err := q.client.Session().Destroy(q.sessionID, nil)
+	return err
+}
+
+// loadJob decodes a job key value and reassembles its archive
+func (q *ConsulQueue) loadJob(ctx context.Context, value []byte) (*Job, error) {
+	var stored consulJob
+	if err := json.Unmarshal(value, &stored); err != nil {
+		return nil, fmt.Errorf("unmarshaling job: %w", err)
+	}
+
+	pairs, _, err := q.client.KV().List(q.dataPrefix(stored.ExecutionID), (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("listing job payload: %w", err)
+	}
+	if len(pairs) != stored.Chunks {
+		return nil, fmt.Errorf("job %s has %d of %d payload chunks", stored.ExecutionID, len(pairs), stored.Chunks)
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	var buf bytes.Buffer
+	for _, p := range pairs {
+		buf.Write(p.Value)
+	}
+
+	return &Job{
+		ExecutionID: stored.ExecutionID,
+		TarData:     buf.Bytes(),
+		Metadata:    stored.Metadata,
+	}, nil
+}
+
+// jobKey is a new key for a job in the queue. Keys sort by enqueue time,
+// giving FIFO order across replicas.
+func (q *ConsulQueue) jobKey(executionID string) string {
+	return fmt.Sprintf("%s/queue/jobs/%020d-%s", q.keyPrefix, time.Now().UnixNano(), executionID)
+}
+
+// heldKey is the key of a held job
+func (q *ConsulQueue) heldKey(executionID string) string {
+	return fmt.Sprintf("%s/queue/held/%s", q.keyPrefix, executionID)
+}
+
+// dataPrefix is the key prefix holding a job's archive chunks
+func (q *ConsulQueue) dataPrefix(executionID string) string {
+	return fmt.Sprintf("%s/queue/data/%s/", q.keyPrefix, executionID)
+}
+
+// chunkKey is the key of a single archive chunk
+func (q *ConsulQueue) chunkKey(executionID string, n int) string {
+	return fmt.Sprintf("%s%06d", q.dataPrefix(executionID), n)
+}
@@ -0,0 +1,72 @@
+// Package queue provides the async job queue shared by server replicas.
+package queue
+
+import (
+	"context"
+	"errors"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// ErrClosed is returned by Claim once the queue has been closed
+var ErrClosed = errors.New("queue closed")
+
+// ErrNotHeld is returned by Approve and Discard for a job that is not held
+var ErrNotHeld = errors.New("job not held")
+
+// Job is an async execution waiting for a worker
+type Job struct {
+	ExecutionID string
+	TarData     []byte
+	Metadata    *client.Metadata
+}
+
+// Queue defines the interface for the async execution queue.
+//
+// A claimed job is leased to the claiming worker until it calls Complete
+// (the job is done) or Release (the job goes back to the queue). A held job
+// waits outside the queue until it is approved (it joins the back of the
+// queue) or discarded.
+type Queue interface {
+	// Enqueue adds a job to the queue
+	Enqueue(ctx context.Context, job *Job) error
+
+	// Claim blocks until a job is available and leases it to the caller
+	Claim(ctx context.Context) (*Job, error)
+
+	// ClaimMatching is Claim for the jobs match accepts, in queue order.
+	// The others are left for workers that can run them.
+	ClaimMatching(ctx context.Context, match func(*Job) bool) (*Job, error)
+
+	// Complete removes a claimed job from the queue
+	Complete(ctx context.Context, executionID string) error
+
+	// Release returns a claimed job to the queue for another worker
+	Release(ctx context.Context, executionID string) error
+
+	// Remove takes a job out of the queue before a worker claims it. A
+	// claimed or unknown job is left alone.
+	Remove(ctx context.Context, executionID string) error
+
+	// Hold stores a job that may not be claimed until it is approved
+	Hold(ctx context.Context, job *Job) error
+
+	// Approve moves a held job to the back of the queue
+	Approve(ctx context.Context, executionID string) error
+
+	// Discard removes a held job
+	Discard(ctx context.Context, executionID string) error
+
+	// Len returns the number of jobs waiting to be claimed
+	Len(ctx context.Context) (int, error)
+
+	// Position returns a job's place among the jobs waiting to be claimed,
+	// 1 for the next, or 0 if it is not waiting: claimed, held or unknown
+	Position(ctx context.Context, executionID string) (int, error)
+
+	// Durable reports whether queued jobs survive a server restart
+	Durable() bool
+
+	// Close releases queue resources
+	Close() error
+}
@@ -0,0 +1,197 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryQueue implements an in-process FIFO queue. Jobs are only visible to
+// the server instance that enqueued them and are lost on restart.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	jobs    []*Job
+	claimed map[string]*Job
+	held    map[string]*Job
+	notify  chan struct{}
+	closed  bool
+}
+
+// NewMemoryQueue creates a new in-memory queue
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		claimed: make(map[string]*Job),
+		held:    make(map[string]*Job),
+		notify:  make(chan struct{}),
+	}
+}
+
+// Enqueue adds a job to the back of the queue
+func (q *MemoryQueue) Enqueue(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.jobs = append(q.jobs, job)
+	q.wake()
+	return nil
+}
+
+// Claim waits for the next job
+func (q *MemoryQueue) Claim(ctx context.Context) (*Job, error) {
+	return q.ClaimMatching(ctx, nil)
+}
+
+// ClaimMatching waits for the next job match accepts; a nil match accepts
+// every job
+func (q *MemoryQueue) ClaimMatching(ctx context.Context, match func(*Job) bool) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+		for i, job := range q.jobs {
+			if match != nil && !match(job) {
+				continue
+			}
+			q.jobs = append(q.jobs[:i:i], q.jobs[i+1:]...)
+			q.claimed[job.ExecutionID] = job
+			q.mu.Unlock()
+			return job, nil
+		}
+		notify := q.notify
+		q.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Complete forgets a claimed job
+func (q *MemoryQueue) Complete(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.claimed, executionID)
+	return nil
+}
+
+// Release puts a claimed job back at the front of the queue
+func (q *MemoryQueue) Release(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.claimed[executionID]
+	if !ok {
+		return fmt.Errorf("job %s is not claimed", executionID)
+	}
+	delete(q.claimed, executionID)
+
+	q.jobs = append([]*Job{job}, q.jobs...)
+	q.wake()
+	return nil
+}
+
+// Remove drops a job waiting to be claimed
+func (q *MemoryQueue) Remove(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, job := range q.jobs {
+		if job.ExecutionID == executionID {
+			q.jobs = append(q.jobs[:i:i], q.jobs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Hold keeps a job aside until it is approved or discarded
+func (q *MemoryQueue) Hold(ctx context.Context, job *Job) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	q.held[job.ExecutionID] = job
+	return nil
+}
+
+// Approve adds a held job to the back of the queue
+func (q *MemoryQueue) Approve(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.held[executionID]
+	if !ok {
+		return ErrNotHeld
+	}
+	delete(q.held, executionID)
+
+	q.jobs = append(q.jobs, job)
+	q.wake()
+	return nil
+}
+
+// Discard forgets a held job
+func (q *MemoryQueue) Discard(ctx context.Context, executionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.held[executionID]; !ok {
+		return ErrNotHeld
+	}
+	delete(q.held, executionID)
+	return nil
+}
+
+// Len returns the number of unclaimed jobs
+func (q *MemoryQueue) Len(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs), nil
+}
+
+// Position returns a job's place in the queue, or 0 if it isn't queued
+func (q *MemoryQueue) Position(ctx context.Context, executionID string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, job := range q.jobs {
+		if job.ExecutionID == executionID {
+			return i + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Durable is false: jobs live only in this process
+func (q *MemoryQueue) Durable() bool {
+	return false
+}
+
+// Close wakes any waiting Claim calls
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		q.wake()
+	}
+	return nil
+}
+
+// wake notifies waiting claimers; callers must hold q.mu
+func (q *MemoryQueue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryQueue_FIFO(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_2"}))
+
+	first, err := q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_1", first.ExecutionID)
+
+	second, err := q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_2", second.ExecutionID)
+}
+
+func TestMemoryQueue_ClaimWaitsForEnqueue(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	claimed := make(chan *Job, 1)
+	go func() {
+		job, err := q.Claim(ctx)
+		if err == nil {
+			claimed <- job
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+
+	select {
+	case job := <-claimed:
+		assert.Equal(t, "exe_1", job.ExecutionID)
+	case <-time.After(time.Second):
+		t.Fatal("Claim() did not return after Enqueue")
+	}
+}
+
+func TestMemoryQueue_ClaimHonorsContext(t *testing.T) {
+	q := NewMemoryQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := q.Claim(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMemoryQueue_ClaimMatching(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_2"}))
+
+	// Jobs that don't match are skipped, and stay queued in order
+	job, err := q.ClaimMatching(ctx, func(j *Job) bool { return j.ExecutionID == "exe_2" })
+	require.NoError(t, err)
+	assert.Equal(t, "exe_2", job.ExecutionID)
+
+	job, err = q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_1", job.ExecutionID)
+
+	// With no matching job, it waits
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_3"}))
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = q.ClaimMatching(waitCtx, func(*Job) bool { return false })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMemoryQueue_Len(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_2"}))
+	n, err := q.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Claimed jobs are no longer waiting
+	job, err := q.Claim(ctx)
+	require.NoError(t, err)
+	n, _ = q.Len(ctx)
+	assert.Equal(t, 1, n)
+
+	require.NoError(t, q.Release(ctx, job.ExecutionID))
+	n, _ = q.Len(ctx)
+	assert.Equal(t, 2, n)
+}
+
+func TestMemoryQueue_Position(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	for _, id := range []string{"exe_1", "exe_2", "exe_3"} {
+		require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: id}))
+	}
+	require.NoError(t, q.Hold(ctx, &Job{ExecutionID: "exe_held"}))
+	pos, err := q.Position(ctx, "exe_3")
+	require.NoError(t, err)
+	assert.Equal(t, 3, pos)
+
+	// Jobs move up as those ahead are claimed, and claimed, held and
+	// unknown jobs have no place
+	_, err = q.Claim(ctx)
+	require.NoError(t, err)
+	for id, want := range map[string]int{"exe_1": 0, "exe_2": 1, "exe_3": 2, "exe_held": 0, "exe_unknown": 0} {
+		pos, _ := q.Position(ctx, id)
+		assert.Equal(t, want, pos, id)
+	}
+}
+
+func TestMemoryQueue_Release(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_2"}))
+
+	job, err := q.Claim(ctx)
+	require.NoError(t, err)
+	require.NoError(t, q.Release(ctx, job.ExecutionID))
+
+	// Released job goes back to the front
+	again, err := q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_1", again.ExecutionID)
+
+	// Releasing an unclaimed job is an error
+	assert.Error(t, q.Release(ctx, "exe_unknown"))
+}
+
+func TestMemoryQueue_Remove(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_2"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_3"}))
+
+	job, err := q.Claim(ctx)
+	require.NoError(t, err)
+
+	// Waiting jobs are dropped; claimed and unknown ones are left alone
+	require.NoError(t, q.Remove(ctx, "exe_2"))
+	require.NoError(t, q.Remove(ctx, job.ExecutionID))
+	require.NoError(t, q.Remove(ctx, "exe_unknown"))
+	n, _ := q.Len(ctx)
+	assert.Equal(t, 1, n)
+	require.NoError(t, q.Release(ctx, job.ExecutionID))
+
+	job, err = q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_1", job.ExecutionID)
+	job, err = q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_3", job.ExecutionID)
+}
+
+func TestMemoryQueue_Hold(t *testing.T) {
+	q := NewMemoryQueue()
+	ctx := context.Background()
+
+	require.NoError(t, q.Hold(ctx, &Job{ExecutionID: "exe_1"}))
+	require.NoError(t, q.Hold(ctx, &Job{ExecutionID: "exe_2"}))
+	require.NoError(t, q.Enqueue(ctx, &Job{ExecutionID: "exe_3"}))
+
+	// Held jobs are not waiting until approved, then join the back
+	n, _ := q.Len(ctx)
+	assert.Equal(t, 1, n)
+	require.NoError(t, q.Approve(ctx, "exe_1"))
+	n, _ = q.Len(ctx)
+	assert.Equal(t, 2, n)
+
+	job, err := q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_3", job.ExecutionID)
+	job, err = q.Claim(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "exe_1", job.ExecutionID)
+
+	require.NoError(t, q.Discard(ctx, "exe_2"))
+	assert.ErrorIs(t, q.Approve(ctx, "exe_2"), ErrNotHeld)
+	assert.ErrorIs(t, q.Discard(ctx, "exe_1"), ErrNotHeld)
+}
+
+func TestMemoryQueue_Close(t *testing.T) {
+	q := NewMemoryQueue()
+	require.NoError(t, q.Close())
+
+	_, err := q.Claim(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.ErrorIs(t, q.Enqueue(context.Background(), &Job{ExecutionID: "exe_1"}), ErrClosed)
+}
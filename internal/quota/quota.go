@@ -0,0 +1,104 @@
+// Package quota limits how many API requests each caller, and all callers
+// together, may make per minute, so that one misbehaving client can't
+// saturate the server.
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleAfter is how long a caller's bucket is kept unused. By then it has
+// refilled, so dropping it changes nothing.
+const idleAfter = time.Minute
+
+// Limiter holds a token bucket per caller and one shared by all callers,
+// each refilled at its requests per minute and holding a minute's worth of
+// requests. Its zero value is not usable; create it with New.
+type Limiter struct {
+	perMinute int           // default rate of each caller; 0 means no limit
+	global    *rate.Limiter // nil for no limit
+
+	mu      sync.Mutex
+	callers map[string]*caller
+	pruned  time.Time
+}
+
+// caller is one caller's bucket
+type caller struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New creates a limiter allowing each caller perMinute requests a minute
+// and all of them together globalPerMinute; 0 means no limit
+func New(perMinute, globalPerMinute int) *Limiter {
+	l := &Limiter{
+		perMinute: perMinute,
+		callers:   make(map[string]*caller),
+	}
+	if globalPerMinute > 0 {
+		l.global = newBucket(globalPerMinute)
+	}
+	return l
+}
+
+// newBucket returns a token bucket of perMinute requests a minute
+func newBucket(perMinute int) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)
+}
+
+// Allow takes a request from the caller's bucket and the global one. It
+// returns 0 if the request may go ahead, or else how long until it may be
+// retried, in which case neither bucket is charged. perMinute overrides the
+// limiter's default rate for the caller if positive.
+func (l *Limiter) Allow(key string, perMinute int, now time.Time) time.Duration {
+	if perMinute <= 0 {
+		perMinute = l.perMinute
+	}
+
+	var reservations []*rate.Reservation
+	if l.global != nil {
+		reservations = append(reservations, l.global.ReserveN(now, 1))
+	}
+	if perMinute > 0 {
+		reservations = append(reservations, l.bucket(key, perMinute, now).ReserveN(now, 1))
+	}
+
+	var wait time.Duration
+	for _, r := range reservations {
+		wait = max(wait, r.DelayFrom(now))
+	}
+	if wait > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+	return wait
+}
+
+// bucket returns the caller's bucket, creating it if the caller is new or
+// its rate changed, and drops the buckets of callers gone idle
+func (l *Limiter) bucket(key string, perMinute int, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) >= idleAfter {
+		for k, c := range l.callers {
+			if now.Sub(c.lastSeen) >= idleAfter {
+				delete(l.callers, k)
+			}
+		}
+		l.pruned = now
+	}
+
+	c, ok := l.callers[key]
+	if !ok || c.limiter.Burst() != perMinute {
+		c = &caller{limiter: newBucket(perMinute)}
+		l.callers[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
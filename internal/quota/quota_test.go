@@ -0,0 +1,76 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(2, 0)
+	now := time.Now()
+
+	// A minute's worth of requests may be made at once
+	for i := 0; i < 2; i++ {
+		if wait := l.Allow("a", 0, now); wait != 0 {
+			t.Fatalf("request %d waits %v", i+1, wait)
+		}
+	}
+	wait := l.Allow("a", 0, now)
+	if wait <= 0 || wait > 30*time.Second {
+		t.Errorf("third request waits %v, want up to 30s", wait)
+	}
+
+	// Other callers have their own buckets, and rates may be overridden
+	if wait := l.Allow("b", 0, now); wait != 0 {
+		t.Errorf("another caller waits %v", wait)
+	}
+	for i := 0; i < 5; i++ {
+		if wait := l.Allow("c", 5, now); wait != 0 {
+			t.Errorf("request %d of a caller allowed 5 waits %v", i+1, wait)
+		}
+	}
+
+	// The bucket refills at the rate
+	if wait := l.Allow("a", 0, now.Add(30*time.Second)); wait != 0 {
+		t.Errorf("request after 30s waits %v", wait)
+	}
+
+	// Idle callers are forgotten
+	l.Allow("d", 0, now.Add(5*time.Minute))
+	if len(l.callers) != 1 {
+		t.Errorf("callers = %v, want only the last one", l.callers)
+	}
+}
+
+func TestLimiter_Global(t *testing.T) {
+	l := New(0, 3)
+	now := time.Now()
+
+	for _, key := range []string{"a", "b", "c"} {
+		if wait := l.Allow(key, 0, now); wait != 0 {
+			t.Errorf("request of %s waits %v", key, wait)
+		}
+	}
+	if wait := l.Allow("d", 0, now); wait <= 0 {
+		t.Error("request over the global limit was allowed")
+	}
+
+	// A request refused by the caller's bucket doesn't use up the global one
+	l = New(1, 2)
+	l.Allow("a", 0, now)
+	if wait := l.Allow("a", 0, now); wait <= 0 {
+		t.Error("second request of a was allowed")
+	}
+	if wait := l.Allow("b", 0, now); wait != 0 {
+		t.Errorf("request of b waits %v after a's refused request", wait)
+	}
+}
+
+func TestLimiter_NoLimit(t *testing.T) {
+	l := New(0, 0)
+	for i := 0; i < 1000; i++ {
+		if wait := l.Allow("a", 0, time.Now()); wait != 0 {
+			t.Fatalf("request %d waits %v", i+1, wait)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Package redact masks secrets in execution output and server logs before
+// they are stored.
+package redact
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mask replaces each secret found
+const Mask = "[REDACTED]"
+
+// minSecretLength is the shortest secret value masked: shorter values
+// would mask unrelated text
+const minSecretLength = 4
+
+// Builtin matches common credential formats: private key blocks, cloud and
+// code-hosting access keys, bearer tokens, and the values of assignments to
+// names like password or api_key
+var Builtin = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,
+	`\bxox[abprs]-[A-Za-z0-9-]{10,}`,
+	`\bsk-[A-Za-z0-9_-]{20,}`,
+	`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`,
+	`(?i)\b(?:password|passwd|secret|api_?key|access_?token|auth_?token)["']?\s*[:=]\s*["']?([^\s"',;]{4,})`,
+}
+
+// Redactor masks the matches of its patterns and its secret values. A
+// pattern with capture groups masks only what the groups match. Masking
+// keeps every newline, so output lines keep their line numbers. A nil
+// Redactor masks nothing.
+type Redactor struct {
+	patterns []*regexp.Regexp
+	secrets  []string // longest first, so no secret masks part of another
+}
+
+// New compiles a redactor for the patterns
+func New(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// LoadPatterns reads a patterns file: one regular expression per line.
+// Blank lines and lines starting with # are ignored.
+func LoadPatterns(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading redaction patterns: %w", err)
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(line); err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", line, err)
+		}
+		patterns = append(patterns, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading redaction patterns: %w", err)
+	}
+	return patterns, nil
+}
+
+// With returns a redactor that also masks the secret values, wherever they
+// appear
+func (r *Redactor) With(secrets ...string) *Redactor {
+	w := &Redactor{}
+	if r != nil {
+		w.patterns = r.patterns
+		w.secrets = append(w.secrets, r.secrets...)
+	}
+	for _, s := range secrets {
+		if len(s) >= minSecretLength {
+			w.secrets = append(w.secrets, s)
+		}
+	}
+	sort.SliceStable(w.secrets, func(i, j int) bool { return len(w.secrets[i]) > len(w.secrets[j]) })
+	return w
+}
+
+// String returns s with every secret masked
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, mask(secret))
+		}
+	}
+	for _, re := range r.patterns {
+		s = replace(re, s)
+	}
+	return s
+}
+
+// replace masks the matches of re in s, or only their groups if re has any
+func replace(re *regexp.Regexp, s string) string {
+	matches := re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		spans := [][2]int{{m[0], m[1]}}
+		if len(m) > 2 {
+			spans = spans[:0]
+			for g := 2; g < len(m); g += 2 {
+				if m[g] >= 0 {
+					spans = append(spans, [2]int{m[g], m[g+1]})
+				}
+			}
+		}
+		for _, span := range spans {
+			if span[0] < last {
+				continue
+			}
+			b.WriteString(s[last:span[0]])
+			b.WriteString(mask(s[span[0]:span[1]]))
+			last = span[1]
+		}
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// mask returns what replaces a secret: the mask, followed by the newlines
+// the secret spanned
+func mask(secret string) string {
+	return Mask + strings.Repeat("\n", strings.Count(secret, "\n"))
+}
+
+// Levels makes the redactor a logrus hook for every level
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire masks secrets in a log entry's message and its string and error
+// fields
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.String(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = r.String(v)
+		case error:
+			if msg := r.String(v.Error()); msg != v.Error() {
+				entry.Data[key] = errors.New(msg)
+			}
+		}
+	}
+	return nil
+}
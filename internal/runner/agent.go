@@ -0,0 +1,285 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// claimWait is how long a claim waits on the control plane for a job
+	claimWait = 20 * time.Second
+	// retryDelay is how long the agent waits after a failed call
+	retryDelay = 5 * time.Second
+	// resultAttempts bounds the attempts to report a result
+	resultAttempts = 5
+)
+
+// Agent is a runner: it registers with the control plane, claims jobs with
+// each of its slots, runs them with a local executor and reports their
+// results
+type Agent struct {
+	server     string // control plane base URL
+	token      string
+	reg        Registration
+	exec       executor.Executor
+	logger     *logrus.Logger
+	httpClient *http.Client
+	heartbeat  time.Duration
+
+	mu sync.Mutex
+	id string // assigned by the control plane; empty until registered
+}
+
+// NewAgent creates an agent for the control plane at server, e.g.
+// http://pyexec:8080, which authenticates with token. heartbeat is how
+// often the agent tells the control plane it is alive.
+func NewAgent(server, token string, reg Registration, exec executor.Executor, heartbeat time.Duration, logger *logrus.Logger) (*Agent, error) {
+	u, err := url.Parse(server)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid control plane URL %q", server)
+	}
+	if reg.Slots < 1 {
+		return nil, fmt.Errorf("a runner needs at least one slot, not %d", reg.Slots)
+	}
+	return &Agent{
+		server:     strings.TrimSuffix(server, "/"),
+		token:      token,
+		reg:        reg,
+		exec:       exec,
+		logger:     logger,
+		httpClient: &http.Client{},
+		heartbeat:  heartbeat,
+	}, nil
+}
+
+// Run registers the agent and runs jobs until ctx is cancelled, then waits
+// for the running ones to finish and deregisters
+func (a *Agent) Run(ctx context.Context) error {
+	if err := a.register(ctx, ""); err != nil {
+		return err
+	}
+
+	go a.beat(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.reg.Slots; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(ctx)
+		}()
+	}
+	wg.Wait()
+
+	deregisterCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return a.call(deregisterCtx, http.MethodDelete, "/runners/"+a.runnerID(), nil, nil)
+}
+
+// runnerID returns the ID the control plane assigned the agent
+func (a *Agent) runnerID() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.id
+}
+
+// register registers the agent, retrying until it succeeds or ctx is
+// cancelled. stale is the ID the control plane no longer knows; if another
+// slot has already replaced it, register does nothing.
+func (a *Agent) register(ctx context.Context, stale string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.id != stale {
+		return nil
+	}
+
+	for {
+		var info Info
+		err := a.call(ctx, http.MethodPost, "/runners", a.reg, &info)
+		if err == nil {
+			a.id = info.ID
+			a.logger.WithFields(logrus.Fields{"runner_id": info.ID, "server": a.server}).Info("Registered with the control plane")
+			return nil
+		}
+		a.logger.WithError(err).Warn("Failed to register with the control plane")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// beat sends heartbeats until ctx is cancelled, killing the containers the
+// control plane answers with
+func (a *Agent) beat(ctx context.Context) {
+	ticker := time.NewTicker(a.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		id := a.runnerID()
+		var hb Heartbeat
+		err := a.call(ctx, http.MethodPost, "/runners/"+id+"/heartbeat", nil, &hb)
+		if errors.Is(err, ErrUnknownRunner) {
+			a.register(ctx, id)
+			continue
+		}
+		if err != nil {
+			a.logger.WithError(err).Warn("Failed to send heartbeat")
+			continue
+		}
+		for _, containerID := range hb.Kill {
+			a.kill(containerID)
+		}
+	}
+}
+
+// work claims and runs jobs one at a time until ctx is cancelled
+func (a *Agent) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		id := a.runnerID()
+		var job Job
+		claimCtx, cancel := context.WithTimeout(ctx, claimWait+30*time.Second)
+		err := a.call(claimCtx, http.MethodPost, fmt.Sprintf("/runners/%s/claim?wait=%d", id, int(claimWait/time.Second)), nil, &job)
+		cancel()
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, ErrUnknownRunner):
+			a.register(ctx, id)
+		case err != nil:
+			a.logger.WithError(err).Warn("Failed to claim a job")
+			time.Sleep(retryDelay)
+		case job.ExecutionID != "":
+			// Jobs run to the end even once ctx is cancelled
+			a.run(id, &job)
+		}
+	}
+}
+
+// run runs a claimed job and reports its result
+func (a *Agent) run(id string, job *Job) {
+	logger := a.logger.WithField("execution_id", job.ExecutionID)
+	logger.Info("Running execution")
+	ctx := context.Background()
+
+	req := &executor.ExecutionRequest{
+		ID:            job.ExecutionID,
+		TarData:       job.TarData,
+		Metadata:      job.Metadata,
+		Tenant:        job.Tenant,
+		APIKeyName:    job.APIKeyName,
+		Env:           job.Env,
+		CollectOutput: job.CollectOutput,
+		OnContainerCreated: func(containerID string) {
+			err := a.call(ctx, http.MethodPost, a.jobPath(id, job, "started"), Started{ContainerID: containerID}, nil)
+			if errors.Is(err, ErrUnknownJob) || errors.Is(err, ErrUnknownRunner) {
+				// Nobody waits for the execution any more
+				a.kill(containerID)
+			} else if err != nil {
+				logger.WithError(err).Warn("Failed to report the execution's container")
+			}
+		},
+	}
+	if job.Stdin != nil {
+		req.Stdin = bytes.NewReader(job.Stdin)
+	}
+
+	var result Result
+	output, err := a.exec.Execute(ctx, req)
+	if err != nil {
+		result.Error = err.Error()
+		result.Timeout = errors.Is(err, executor.ErrTimeout) || errors.Is(err, executor.ErrPullTimeout) || errors.Is(err, executor.ErrInstallTimeout)
+	} else {
+		result.Output = output
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := a.call(ctx, http.MethodPost, a.jobPath(id, job, "result"), result, nil)
+		if err == nil || errors.Is(err, ErrUnknownJob) || errors.Is(err, ErrUnknownRunner) {
+			return
+		}
+		if attempt == resultAttempts {
+			logger.WithError(err).Error("Failed to report the execution's result")
+			return
+		}
+		time.Sleep(retryDelay)
+	}
+}
+
+// jobPath returns the path of a job's endpoint
+func (a *Agent) jobPath(id string, job *Job, endpoint string) string {
+	return fmt.Sprintf("/runners/%s/jobs/%s/%s", id, job.ExecutionID, endpoint)
+}
+
+// kill kills a container of this host
+func (a *Agent) kill(containerID string) {
+	if err := a.exec.Kill(context.Background(), containerID); err != nil {
+		a.logger.WithError(err).WithField("container_id", containerID).Warn("Failed to kill container")
+	}
+}
+
+// call sends a request to the control plane's API and decodes the response
+// into out. A 204 response leaves out untouched. 404 and 409 responses are
+// ErrUnknownRunner and ErrUnknownJob.
+func (a *Agent) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.server+"/api/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrUnknownRunner
+	case resp.StatusCode == http.StatusConflict:
+		return ErrUnknownJob
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("control plane returned %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
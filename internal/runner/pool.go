@@ -0,0 +1,420 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/google/uuid"
+)
+
+// errPoolClosed is returned by Execute once the pool has been closed
+var errPoolClosed = errors.New("runner pool closed")
+
+// Pool is the control plane's side of the runners: an executor.Executor
+// whose executions wait until a registered runner claims them, and return
+// when it reports their result. Runners not heard from within the pool's
+// timeout are dropped, failing the executions they held.
+type Pool struct {
+	timeout         time.Duration
+	defaultMemoryMB int // memory limit of executions that set none, for runners' MemoryMB
+
+	mu      sync.Mutex
+	runners map[string]*runnerState
+	pending []*dispatch          // waiting for a runner, in submission order
+	active  map[string]*dispatch // claimed, by execution ID
+	wake    chan struct{}        // closed when a dispatch becomes pending
+	closed  bool
+}
+
+// runnerState is a registered runner
+type runnerState struct {
+	info  Info
+	kills []string // containers to kill, sent with the next heartbeat
+}
+
+// dispatch is an execution handed to the pool
+type dispatch struct {
+	job            *Job
+	onCreated      func(containerID string)
+	stdout, stderr io.Writer
+	runner         string // ID of the runner that claimed it
+	container      string
+	done           chan Result
+}
+
+// NewPool creates a pool that drops runners not heard from for timeout.
+// defaultMemoryMB is the memory limit of executions that set none.
+func NewPool(timeout time.Duration, defaultMemoryMB int) *Pool {
+	return &Pool{
+		timeout:         timeout,
+		defaultMemoryMB: defaultMemoryMB,
+		runners:         make(map[string]*runnerState),
+		active:          make(map[string]*dispatch),
+		wake:            make(chan struct{}),
+	}
+}
+
+// Register adds a runner and returns its description
+func (p *Pool) Register(reg Registration) Info {
+	now := time.Now()
+	info := Info{
+		ID:           fmt.Sprintf("run_%s", uuid.New().String()),
+		Registration: reg,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.runners[info.ID] = &runnerState{info: info}
+	return info
+}
+
+// Deregister removes a runner. Executions it still holds fail.
+func (p *Pool) Deregister(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.runners[id]
+	if !ok {
+		return ErrUnknownRunner
+	}
+	p.drop(r, fmt.Sprintf("runner %s deregistered while running the execution", r.info.Name))
+	return nil
+}
+
+// Runners returns the registered runners, by name
+func (p *Pool) Runners() []Info {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	infos := make([]Info, 0, len(p.runners))
+	for _, r := range p.runners {
+		infos = append(infos, r.info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Heartbeat records that a runner is alive and returns the containers it
+// must kill
+func (p *Pool) Heartbeat(id string) (*Heartbeat, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.runners[id]
+	if !ok {
+		return nil, ErrUnknownRunner
+	}
+	r.info.LastSeen = time.Now()
+	hb := &Heartbeat{Kill: r.kills}
+	r.kills = nil
+	return hb, nil
+}
+
+// Claim waits until ctx is done for an execution the runner can run, and
+// hands it to the runner. It returns nil if none came.
+func (p *Pool) Claim(ctx context.Context, id string) (*Job, error) {
+	for {
+		p.mu.Lock()
+		r, ok := p.runners[id]
+		if !ok {
+			p.mu.Unlock()
+			return nil, ErrUnknownRunner
+		}
+		r.info.LastSeen = time.Now()
+
+		for i, d := range p.pending {
+			if !p.matches(&r.info, d.job) {
+				continue
+			}
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			d.runner = id
+			p.active[d.job.ExecutionID] = d
+			r.info.Running++
+			p.mu.Unlock()
+			return d.job, nil
+		}
+		wake := p.wake
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-wake:
+		}
+	}
+}
+
+// matches reports whether a runner can run a job: it has the labels the
+// job's placement requires, and the job's memory limit is within its own
+func (p *Pool) matches(info *Info, job *Job) bool {
+	meta := job.Metadata
+	if meta == nil {
+		return true
+	}
+	for key, want := range meta.Placement {
+		if have, ok := info.Labels[key]; !ok || have != want {
+			return false
+		}
+	}
+	if info.MemoryMB > 0 {
+		memoryMB := p.defaultMemoryMB
+		if meta.Config != nil && meta.Config.MemoryMB > 0 {
+			memoryMB = meta.Config.MemoryMB
+		}
+		if memoryMB > info.MemoryMB {
+			return false
+		}
+	}
+	return true
+}
+
+// Started records the container a runner created for a job it claimed
+func (p *Pool) Started(id, executionID, containerID string) error {
+	p.mu.Lock()
+	d, err := p.claimed(id, executionID)
+	if err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	d.container = containerID
+	p.mu.Unlock()
+
+	if d.onCreated != nil {
+		d.onCreated(containerID)
+	}
+	return nil
+}
+
+// Complete reports the result of a job a runner claimed
+func (p *Pool) Complete(id, executionID string, result Result) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, err := p.claimed(id, executionID)
+	if err != nil {
+		return err
+	}
+	p.finish(d, result)
+	return nil
+}
+
+// claimed returns the dispatch of a job a runner holds. The caller must
+// hold p.mu.
+func (p *Pool) claimed(id, executionID string) (*dispatch, error) {
+	r, ok := p.runners[id]
+	if !ok {
+		return nil, ErrUnknownRunner
+	}
+	r.info.LastSeen = time.Now()
+
+	d, ok := p.active[executionID]
+	if !ok || d.runner != id {
+		return nil, ErrUnknownJob
+	}
+	return d, nil
+}
+
+// finish removes a claimed dispatch and delivers its result. The caller
+// must hold p.mu.
+func (p *Pool) finish(d *dispatch, result Result) {
+	delete(p.active, d.job.ExecutionID)
+	if r, ok := p.runners[d.runner]; ok {
+		r.info.Running--
+	}
+	d.done <- result
+}
+
+// drop removes a runner, failing the executions it holds. The caller must
+// hold p.mu.
+func (p *Pool) drop(r *runnerState, reason string) {
+	for _, d := range p.active {
+		if d.runner == r.info.ID {
+			p.finish(d, Result{Error: reason})
+		}
+	}
+	delete(p.runners, r.info.ID)
+}
+
+// Expire drops the runners not heard from within the timeout, failing the
+// executions they held, and returns their names
+func (p *Pool) Expire(now time.Time) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var names []string
+	for _, r := range p.runners {
+		if now.Sub(r.info.LastSeen) > p.timeout {
+			p.drop(r, fmt.Sprintf("runner %s stopped responding while running the execution", r.info.Name))
+			names = append(names, r.info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Monitor expires quiet runners until ctx is cancelled, passing the names
+// of those dropped to onExpired
+func (p *Pool) Monitor(ctx context.Context, onExpired func(names []string)) {
+	ticker := time.NewTicker(p.timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if names := p.Expire(now); len(names) > 0 && onExpired != nil {
+				onExpired(names)
+			}
+		}
+	}
+}
+
+// Execute waits for a runner to claim and run the request. Stdin is read
+// into memory, and Stdout and Stderr receive the output once it is back.
+func (p *Pool) Execute(ctx context.Context, req *executor.ExecutionRequest) (*executor.ExecutionOutput, error) {
+	job := &Job{
+		ExecutionID:   req.ID,
+		TarData:       req.TarData,
+		Metadata:      req.Metadata,
+		Tenant:        req.Tenant,
+		APIKeyName:    req.APIKeyName,
+		Env:           req.Env,
+		CollectOutput: req.CollectOutput,
+	}
+	if req.Stdin != nil {
+		stdin, err := io.ReadAll(req.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading stdin: %w", err)
+		}
+		job.Stdin = stdin
+	}
+
+	d := &dispatch{
+		job:       job,
+		onCreated: req.OnContainerCreated,
+		stdout:    req.Stdout,
+		stderr:    req.Stderr,
+		done:      make(chan Result, 1),
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+	p.pending = append(p.pending, d)
+	close(p.wake)
+	p.wake = make(chan struct{})
+	p.mu.Unlock()
+
+	select {
+	case result := <-d.done:
+		return d.output(result)
+	case <-ctx.Done():
+		p.abandon(d)
+		return nil, ctx.Err()
+	}
+}
+
+// abandon withdraws a dispatch whose caller went away. A runner running it
+// is told to kill its container.
+func (p *Pool) abandon(d *dispatch) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, pending := range p.pending {
+		if pending == d {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return
+		}
+	}
+	if p.active[d.job.ExecutionID] != d {
+		return
+	}
+	if r, ok := p.runners[d.runner]; ok && d.container != "" {
+		r.kills = append(r.kills, d.container)
+	}
+	p.finish(d, Result{Error: "abandoned"})
+}
+
+// output converts a runner's result into what the executor returns
+func (d *dispatch) output(result Result) (*executor.ExecutionOutput, error) {
+	if result.Error != "" {
+		if result.Timeout {
+			for _, sentinel := range []error{executor.ErrPullTimeout, executor.ErrInstallTimeout, executor.ErrTimeout} {
+				if rest, ok := strings.CutPrefix(result.Error, sentinel.Error()); ok {
+					return nil, fmt.Errorf("%w%s", sentinel, rest)
+				}
+			}
+			return nil, fmt.Errorf("%w: %s", executor.ErrTimeout, result.Error)
+		}
+		return nil, errors.New(result.Error)
+	}
+	if result.Output == nil {
+		return nil, errors.New("runner returned no output")
+	}
+
+	if d.stdout != nil {
+		io.Copy(d.stdout, strings.NewReader(result.Output.Stdout))
+	}
+	if d.stderr != nil {
+		io.Copy(d.stderr, strings.NewReader(result.Output.Stderr))
+	}
+	return result.Output, nil
+}
+
+// Kill tells the runner running a container to kill it
+func (p *Pool) Kill(ctx context.Context, containerID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, d := range p.active {
+		if d.container != containerID {
+			continue
+		}
+		if r, ok := p.runners[d.runner]; ok {
+			r.kills = append(r.kills, containerID)
+		}
+		return nil
+	}
+	return fmt.Errorf("no runner is running container %s", containerID)
+}
+
+// ListContainers returns no containers: those on runners are not
+// recovered by the control plane after a restart
+func (p *Pool) ListContainers(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// Attach is not supported: see ListContainers
+func (p *Pool) Attach(ctx context.Context, containerID string) (*executor.ExecutionOutput, error) {
+	return nil, fmt.Errorf("container %s runs on a runner and cannot be attached", containerID)
+}
+
+// Close fails the executions no runner has claimed yet
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, d := range p.pending {
+		d.done <- Result{Error: errPoolClosed.Error()}
+	}
+	p.pending = nil
+	return nil
+}
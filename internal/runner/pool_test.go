@@ -0,0 +1,228 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// submit runs Execute in the background and returns where its result
+// arrives
+func submit(p *Pool, ctx context.Context, req *executor.ExecutionRequest) chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Execute(ctx, req)
+		done <- err
+	}()
+	return done
+}
+
+// claim claims a job, failing the test if none comes within a second
+func claim(t *testing.T, p *Pool, id string) *Job {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := p.Claim(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil {
+		t.Fatal("no job was claimed")
+	}
+	return job
+}
+
+func TestPoolExecute(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	r := p.Register(Registration{Name: "runner-1", Slots: 1})
+
+	var containers []string
+	var stdout strings.Builder
+	req := &executor.ExecutionRequest{
+		ID:                 "exe_1",
+		Env:                []string{"PYEXEC_EXECUTION_ID=exe_1"},
+		Stdin:              strings.NewReader("input"),
+		Stdout:             &stdout,
+		OnContainerCreated: func(id string) { containers = append(containers, id) },
+	}
+
+	outputs := make(chan *executor.ExecutionOutput, 1)
+	go func() {
+		out, _ := p.Execute(context.Background(), req)
+		outputs <- out
+	}()
+
+	job := claim(t, p, r.ID)
+	if job.ExecutionID != "exe_1" || string(job.Stdin) != "input" || len(job.Env) != 1 {
+		t.Errorf("claimed job = %+v", job)
+	}
+	if err := p.Started(r.ID, "exe_1", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Runners()[0].Running; got != 1 {
+		t.Errorf("running = %d, want 1", got)
+	}
+
+	// Only the runner holding the job may report it
+	other := p.Register(Registration{Name: "runner-2", Slots: 1})
+	if err := p.Complete(other.ID, "exe_1", Result{}); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Complete() by another runner = %v, want ErrUnknownJob", err)
+	}
+	if err := p.Complete(r.ID, "exe_1", Result{Output: &executor.ExecutionOutput{Stdout: "hello\n", ExitCode: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	out := <-outputs
+	if out == nil || out.ExitCode != 3 {
+		t.Fatalf("output = %+v", out)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("stdout writer got %q", stdout.String())
+	}
+	if len(containers) != 1 || containers[0] != "c1" {
+		t.Errorf("containers = %v", containers)
+	}
+	if err := p.Complete(r.ID, "exe_1", Result{}); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("second Complete() = %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestPoolErrors(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	r := p.Register(Registration{Name: "runner-1", Slots: 1})
+
+	done := submit(p, context.Background(), &executor.ExecutionRequest{ID: "exe_1"})
+	claim(t, p, r.ID)
+	p.Complete(r.ID, "exe_1", Result{Error: "execution timeout after 1s", Timeout: true})
+	err := <-done
+	if !errors.Is(err, executor.ErrTimeout) || err.Error() != "execution timeout after 1s" {
+		t.Errorf("error = %v, want the runner's timeout", err)
+	}
+
+	done = submit(p, context.Background(), &executor.ExecutionRequest{ID: "exe_install"})
+	claim(t, p, r.ID)
+	p.Complete(r.ID, "exe_install", Result{Error: "dependency install timeout after 10m0s", Timeout: true})
+	err = <-done
+	if !errors.Is(err, executor.ErrInstallTimeout) || err.Error() != "dependency install timeout after 10m0s" {
+		t.Errorf("error = %v, want the runner's install timeout", err)
+	}
+
+	done = submit(p, context.Background(), &executor.ExecutionRequest{ID: "exe_2"})
+	claim(t, p, r.ID)
+	p.Complete(r.ID, "exe_2", Result{Error: "ensuring image: not found"})
+	if err := <-done; err == nil || errors.Is(err, executor.ErrTimeout) || err.Error() != "ensuring image: not found" {
+		t.Errorf("error = %v, want the runner's error", err)
+	}
+}
+
+func TestPoolPlacement(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	cpu := p.Register(Registration{Name: "cpu", MemoryMB: 2048, Slots: 1})
+	gpu := p.Register(Registration{Name: "gpu", Labels: map[string]string{"gpu": "true"}, Slots: 1})
+
+	submit(p, context.Background(), &executor.ExecutionRequest{
+		ID:       "exe_gpu",
+		Metadata: &client.Metadata{Placement: map[string]string{"gpu": "true"}},
+	})
+	submit(p, context.Background(), &executor.ExecutionRequest{
+		ID:       "exe_big",
+		Metadata: &client.Metadata{Config: &client.ExecutionConfig{MemoryMB: 4096}},
+	})
+	time.Sleep(10 * time.Millisecond)
+
+	// Neither job fits the CPU runner
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if job, err := p.Claim(ctx, cpu.ID); err != nil || job != nil {
+		t.Errorf("CPU runner claimed %+v, %v", job, err)
+	}
+
+	got := map[string]bool{claim(t, p, gpu.ID).ExecutionID: true, claim(t, p, gpu.ID).ExecutionID: true}
+	if !got["exe_gpu"] || !got["exe_big"] {
+		t.Errorf("GPU runner claimed %v", got)
+	}
+}
+
+func TestPoolKill(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	r := p.Register(Registration{Name: "runner-1", Slots: 1})
+
+	submit(p, context.Background(), &executor.ExecutionRequest{ID: "exe_1"})
+	claim(t, p, r.ID)
+	p.Started(r.ID, "exe_1", "c1")
+
+	if err := p.Kill(context.Background(), "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Kill(context.Background(), "c2"); err == nil {
+		t.Error("Kill() of an unknown container succeeded")
+	}
+	hb, err := p.Heartbeat(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hb.Kill) != 1 || hb.Kill[0] != "c1" {
+		t.Errorf("heartbeat kills %v, want [c1]", hb.Kill)
+	}
+	if hb, _ := p.Heartbeat(r.ID); len(hb.Kill) != 0 {
+		t.Errorf("kills sent twice: %v", hb.Kill)
+	}
+}
+
+func TestPoolAbandon(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	r := p.Register(Registration{Name: "runner-1", Slots: 1})
+
+	// A pending execution whose caller goes away is never claimed
+	ctx, cancel := context.WithCancel(context.Background())
+	done := submit(p, ctx, &executor.ExecutionRequest{ID: "exe_1"})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+	claimCtx, cancelClaim := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelClaim()
+	if job, _ := p.Claim(claimCtx, r.ID); job != nil {
+		t.Errorf("claimed abandoned job %s", job.ExecutionID)
+	}
+
+	// A running one is killed
+	ctx, cancel = context.WithCancel(context.Background())
+	done = submit(p, ctx, &executor.ExecutionRequest{ID: "exe_2"})
+	claim(t, p, r.ID)
+	p.Started(r.ID, "exe_2", "c2")
+	cancel()
+	<-done
+	if hb, _ := p.Heartbeat(r.ID); len(hb.Kill) != 1 || hb.Kill[0] != "c2" {
+		t.Errorf("heartbeat kills %v, want [c2]", hb.Kill)
+	}
+	if err := p.Complete(r.ID, "exe_2", Result{}); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Complete() of an abandoned job = %v, want ErrUnknownJob", err)
+	}
+}
+
+func TestPoolExpire(t *testing.T) {
+	p := NewPool(time.Minute, 1024)
+	r := p.Register(Registration{Name: "runner-1", Slots: 1})
+
+	done := submit(p, context.Background(), &executor.ExecutionRequest{ID: "exe_1"})
+	claim(t, p, r.ID)
+
+	if names := p.Expire(time.Now()); len(names) != 0 {
+		t.Errorf("Expire() dropped live runners %v", names)
+	}
+	if names := p.Expire(time.Now().Add(2 * time.Minute)); len(names) != 1 || names[0] != "runner-1" {
+		t.Errorf("Expire() = %v, want [runner-1]", names)
+	}
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "stopped responding") {
+		t.Errorf("error = %v, want the runner to have stopped responding", err)
+	}
+	if _, err := p.Heartbeat(r.ID); !errors.Is(err, ErrUnknownRunner) {
+		t.Errorf("Heartbeat() of a dropped runner = %v, want ErrUnknownRunner", err)
+	}
+}
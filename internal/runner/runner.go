@@ -0,0 +1,78 @@
+// Package runner splits the service into a control plane and runner agents.
+// The control-plane server hands its executions to a Pool instead of its
+// own Docker; agents on the sandbox hosts register with it over the API,
+// claim the executions they can run, run them in their host's Docker and
+// send the results back. Runners only need to reach the control plane's
+// API, so one endpoint can fan executions out across many hosts without
+// sharing a Docker socket.
+package runner
+
+import (
+	"errors"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// ErrUnknownRunner is returned for a runner that is not registered, e.g.
+// because it was dropped after going quiet; the runner registers again
+var ErrUnknownRunner = errors.New("unknown runner")
+
+// ErrUnknownJob is returned for a job the runner no longer holds, e.g.
+// because its execution was abandoned; the runner drops it
+var ErrUnknownJob = errors.New("unknown job")
+
+// Registration is what a runner tells the control plane about itself
+type Registration struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`    // matched against executions' placement
+	MemoryMB int               `json:"memory_mb,omitempty"` // largest memory limit it runs; 0 means no limit
+	Slots    int               `json:"slots"`               // executions it runs at once
+}
+
+// Info describes a registered runner
+type Info struct {
+	ID string `json:"id"`
+	Registration
+	Running      int       `json:"running"`
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+}
+
+// List is the control plane's list of its runners
+type List struct {
+	Runners []Info `json:"runners"`
+}
+
+// Job is an execution handed to a runner: the request the control plane
+// would have run itself, with the server-provided environment (secrets,
+// trace and progress variables) already resolved
+type Job struct {
+	ExecutionID   string           `json:"execution_id"`
+	TarData       []byte           `json:"tar_data"`
+	Metadata      *client.Metadata `json:"metadata"`
+	Tenant        string           `json:"tenant,omitempty"`
+	APIKeyName    string           `json:"api_key_name,omitempty"`
+	Env           []string         `json:"env,omitempty"`
+	Stdin         []byte           `json:"stdin,omitempty"`
+	CollectOutput bool             `json:"collect_output,omitempty"`
+}
+
+// Result is a runner's report of a job it ran: the executor's output, or
+// the error it returned
+type Result struct {
+	Output  *executor.ExecutionOutput `json:"output,omitempty"`
+	Error   string                    `json:"error,omitempty"`
+	Timeout bool                      `json:"timeout,omitempty"` // Error wraps one of the executor's timeout errors
+}
+
+// Heartbeat is the control plane's answer to a runner's heartbeat
+type Heartbeat struct {
+	Kill []string `json:"kill,omitempty"` // containers of killed executions
+}
+
+// Started reports the container a runner created for a job
+type Started struct {
+	ContainerID string `json:"container_id"`
+}
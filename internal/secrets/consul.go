@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// ConsulStore holds the secrets in Consul's KV store: the secret NAME is
+// the key {prefix}/NAME
+type ConsulStore struct {
+	kv     *consulapi.KV
+	prefix string
+}
+
+// NewConsulStore creates a store for the keys under prefix
+func NewConsulStore(address, token, prefix string) (*ConsulStore, error) {
+	cfg := consulapi.DefaultConfig()
+	cfg.Address = address
+	if token != "" {
+		cfg.Token = token
+	}
+
+	client, err := consulapi.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating consul client: %w", err)
+	}
+	return &ConsulStore{kv: client.KV(), prefix: strings.TrimSuffix(prefix, "/")}, nil
+}
+
+// Get returns the value of a secret
+func (c *ConsulStore) Get(ctx context.Context, name string) (string, error) {
+	pair, _, err := c.kv.Get(c.prefix+"/"+name, (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	if pair == nil {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return string(pair.Value), nil
+}
+
+// List returns the names of the secrets the store holds, sorted
+func (c *ConsulStore) List(ctx context.Context) ([]string, error) {
+	keys, _, err := c.kv.Keys(c.prefix+"/", "/", (&consulapi.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("listing secrets: %w", err)
+	}
+
+	var names []string
+	for _, key := range keys {
+		if name := strings.TrimPrefix(key, c.prefix+"/"); name != "" && !strings.HasSuffix(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,96 @@
+// Package secrets resolves the named secrets executions ask for. Operators
+// register secrets in a backend, and executions name the ones they need in
+// Metadata.Secrets; the values are only read when the container starts, so
+// they never pass through clients or get stored with executions.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+)
+
+// ErrNotFound is returned (wrapped) for a secret the store doesn't have
+var ErrNotFound = errors.New("secret not found")
+
+// Store holds named secrets
+type Store interface {
+	// Get returns the value of a secret
+	Get(ctx context.Context, name string) (string, error)
+
+	// List returns the names of the secrets the store holds, sorted
+	List(ctx context.Context) ([]string, error)
+}
+
+// New creates the store cfg selects: config.SecretsEnv, config.SecretsConsul
+// or config.SecretsVault. consul gives the Consul agent of the Consul store.
+func New(cfg config.SecretsConfig, consul config.ConsulConfig) (Store, error) {
+	switch cfg.Backend {
+	case config.SecretsEnv:
+		return NewEnvStore(cfg.EnvPrefix), nil
+	case config.SecretsConsul:
+		return NewConsulStore(consul.Address, consul.Token, consul.KeyPrefix+"/secrets")
+	case config.SecretsVault:
+		return NewVaultStore(cfg.VaultAddr, cfg.VaultToken, cfg.VaultMount, cfg.VaultPath)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", cfg.Backend)
+	}
+}
+
+// Resolve returns the values of the named secrets, in order
+func Resolve(ctx context.Context, store Store, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	if store == nil {
+		return nil, fmt.Errorf("%w: %s (no secrets backend is configured)", ErrNotFound, names[0])
+	}
+
+	values := make([]string, len(names))
+	for i, name := range names {
+		value, err := store.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// EnvStore holds the secrets in the server's environment: the secret NAME
+// is the variable {prefix}NAME
+type EnvStore struct {
+	prefix string
+}
+
+// NewEnvStore creates a store for the variables starting with prefix
+func NewEnvStore(prefix string) *EnvStore {
+	return &EnvStore{prefix: prefix}
+}
+
+// Get returns the value of a secret
+func (e *EnvStore) Get(ctx context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(e.prefix + name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return value, nil
+}
+
+// List returns the names of the secrets the store holds, sorted
+func (e *EnvStore) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(key, e.prefix); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnvStore(t *testing.T) {
+	t.Setenv("TEST_SECRET_API_KEY", "k-123")
+	t.Setenv("TEST_SECRET_DB", "")
+	store := NewEnvStore("TEST_SECRET_")
+	ctx := context.Background()
+
+	values, err := Resolve(ctx, store, []string{"API_KEY", "DB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != "k-123" || values[1] != "" {
+		t.Errorf("Resolve() = %q", values)
+	}
+	if _, err := Resolve(ctx, store, []string{"API_KEY", "MISSING"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve() error = %v, want ErrNotFound", err)
+	}
+
+	names, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "API_KEY,DB" {
+		t.Errorf("List() = %v", names)
+	}
+}
+
+func TestResolveWithoutStore(t *testing.T) {
+	if values, err := Resolve(context.Background(), nil, nil); err != nil || values != nil {
+		t.Errorf("Resolve(no names) = %v, %v", values, err)
+	}
+	if _, err := Resolve(context.Background(), nil, []string{"A"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConsulStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Consul-Index", "1")
+		switch {
+		case r.URL.Path == "/v1/kv/pyexec/secrets/" && r.URL.Query().Has("keys"):
+			json.NewEncoder(w).Encode([]string{"pyexec/secrets/TOKEN", "pyexec/secrets/API_KEY", "pyexec/secrets/nested/"})
+		case r.URL.Path == "/v1/kv/pyexec/secrets/TOKEN":
+			json.NewEncoder(w).Encode([]map[string]any{{
+				"Key":   "pyexec/secrets/TOKEN",
+				"Value": base64.StdEncoding.EncodeToString([]byte("t-456")),
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store, err := NewConsulStore(srv.URL, "", "pyexec/secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if value, err := store.Get(ctx, "TOKEN"); err != nil || value != "t-456" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+	if _, err := store.Get(ctx, "MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	names, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "API_KEY,TOKEN" {
+		t.Errorf("List() = %v", names)
+	}
+}
+
+func TestVaultStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/pyexec" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"OPENAI_API_KEY": "sk-1", "PORT": 5432}, "metadata": {"version": 3}}}`))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	store, err := NewVaultStore(srv.URL, "root", "secret", "pyexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := store.Get(ctx, "OPENAI_API_KEY"); err != nil || value != "sk-1" {
+		t.Errorf("Get() = %q, %v", value, err)
+	}
+	if value, err := store.Get(ctx, "PORT"); err != nil || value != "5432" {
+		t.Errorf("Get(non-string) = %q, %v", value, err)
+	}
+	if _, err := store.Get(ctx, "MISSING"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	if names, err := store.List(ctx); err != nil || strings.Join(names, ",") != "OPENAI_API_KEY,PORT" {
+		t.Errorf("List() = %v, %v", names, err)
+	}
+
+	// A missing secret holds nothing; a refused token is an error
+	empty, _ := NewVaultStore(srv.URL, "root", "secret", "other")
+	if names, err := empty.List(ctx); err != nil || len(names) != 0 {
+		t.Errorf("List() of a missing secret = %v, %v", names, err)
+	}
+	denied, _ := NewVaultStore(srv.URL, "wrong", "secret", "pyexec")
+	if _, err := denied.Get(ctx, "OPENAI_API_KEY"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() with a bad token error = %v", err)
+	}
+
+	if _, err := NewVaultStore("vault:8200", "", "secret", "pyexec"); err == nil {
+		t.Error("NewVaultStore accepted an address without a scheme")
+	}
+}
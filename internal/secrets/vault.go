@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// vaultTimeout bounds each read from Vault
+const vaultTimeout = 10 * time.Second
+
+// VaultStore holds the secrets in one secret of a Vault KV version 2
+// engine: the secret NAME is its key NAME
+type VaultStore struct {
+	endpoint   string
+	token      string
+	httpClient *http.Client
+}
+
+// vaultResponse is a KV version 2 read response
+type vaultResponse struct {
+	Data struct {
+		Data map[string]any `json:"data"`
+	} `json:"data"`
+}
+
+// NewVaultStore creates a store for the secret at path of the KV engine
+// mounted at mount, read from the Vault server at address, e.g.
+// http://vault:8200
+func NewVaultStore(address, token, mount, path string) (*VaultStore, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Vault address %q", address)
+	}
+	if mount == "" || path == "" {
+		return nil, fmt.Errorf("no Vault mount or secret path")
+	}
+	return &VaultStore{
+		endpoint:   fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(address, "/"), strings.Trim(mount, "/"), strings.Trim(path, "/")),
+		token:      token,
+		httpClient: &http.Client{Timeout: vaultTimeout},
+	}, nil
+}
+
+// Get returns the value of a secret
+func (v *VaultStore) Get(ctx context.Context, name string) (string, error) {
+	data, err := v.read(ctx)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	// Non-string values are passed as their JSON
+	b, _ := json.Marshal(value)
+	return string(b), nil
+}
+
+// List returns the names of the secrets the store holds, sorted
+func (v *VaultStore) List(ctx context.Context) ([]string, error) {
+	data, err := v.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// read returns the key/value pairs of the secret. A secret that doesn't
+// exist holds no pairs.
+func (v *VaultStore) read(ctx context.Context) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("reading Vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Vault returned %d: %s", resp.StatusCode, body)
+	}
+
+	var vr vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&vr); err != nil {
+		return nil, fmt.Errorf("reading Vault secret: %w", err)
+	}
+	return vr.Data.Data, nil
+}
@@ -0,0 +1,445 @@
+// Package server wires the python-executor API server together from its
+// configuration: storage, the async queue, the executor and the HTTP
+// listeners, and the background routines that go with them. Both the
+// server command and the CLI's server subcommand run it.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/api"
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/egress"
+	"github.com/geraldthewes/python-executor/internal/events"
+	"github.com/geraldthewes/python-executor/internal/executor"
+	"github.com/geraldthewes/python-executor/internal/queue"
+	"github.com/geraldthewes/python-executor/internal/redact"
+	"github.com/geraldthewes/python-executor/internal/runner"
+	"github.com/geraldthewes/python-executor/internal/secrets"
+	"github.com/geraldthewes/python-executor/internal/storage"
+	"github.com/sirupsen/logrus"
+)
+
+// NewLogger creates the server's logger at the configured level
+func NewLogger(cfg *config.Config) *logrus.Logger {
+	logger := logrus.New()
+	level, err := logrus.ParseLevel(cfg.Server.LogLevel)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+	logger.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+	return logger
+}
+
+// Run starts the server and serves until ctx ends, then shuts it down
+// gracefully: running executions get the configured drain period to
+// finish. It returns an error if the configuration is invalid or a
+// listener fails.
+func Run(ctx context.Context, cfg *config.Config, logger *logrus.Logger) error {
+	logger.WithFields(logrus.Fields{
+		"host":      cfg.Server.Host,
+		"port":      cfg.Server.Port,
+		"node_id":   cfg.Server.NodeID,
+		"log_level": cfg.Server.LogLevel,
+	}).Info("Starting python-executor server")
+
+	switch cfg.Queue.OverloadPolicy {
+	case config.OverloadQueue, config.OverloadReject:
+	default:
+		return fmt.Errorf("invalid PYEXEC_OVERLOAD_POLICY %q: use %q or %q",
+			cfg.Queue.OverloadPolicy, config.OverloadQueue, config.OverloadReject)
+	}
+	switch cfg.Server.SyncDisconnect {
+	case config.DisconnectKill, config.DisconnectDetach:
+	default:
+		return fmt.Errorf("invalid PYEXEC_SYNC_DISCONNECT %q: use %q or %q",
+			cfg.Server.SyncDisconnect, config.DisconnectKill, config.DisconnectDetach)
+	}
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid PYEXEC_TRUSTED_PROXIES entry %q: use an address or CIDR", proxy)
+		}
+	}
+
+	if cfg.Defaults.PresetsFile != "" {
+		presets, err := config.LoadPresets(cfg.Defaults.PresetsFile)
+		if err != nil {
+			return fmt.Errorf("invalid PYEXEC_PRESETS_FILE %s: %w", cfg.Defaults.PresetsFile, err)
+		}
+		cfg.Defaults.Presets = presets
+		logger.WithField("presets", len(cfg.Defaults.Presets)).Info("Loaded resource presets")
+	}
+
+	// API keys clients authenticate with
+	apiKeys, err := config.ParseAPIKeys(cfg.Auth.Keys)
+	if err != nil {
+		return fmt.Errorf("invalid PYEXEC_API_KEYS: %w", err)
+	}
+	if cfg.Auth.KeysFile != "" {
+		fileKeys, err := config.LoadAPIKeys(cfg.Auth.KeysFile)
+		if err != nil {
+			return fmt.Errorf("invalid PYEXEC_API_KEYS_FILE %s: %w", cfg.Auth.KeysFile, err)
+		}
+		apiKeys = append(apiKeys, fileKeys...)
+	}
+	cfg.Auth.APIKeys = apiKeys
+	if len(apiKeys) > 0 {
+		logger.WithField("keys", len(apiKeys)).Info("Requiring API keys")
+	} else {
+		logger.Warn("No API keys configured (PYEXEC_API_KEYS): the API is open to anyone who can reach it")
+	}
+
+	// Mask secrets in execution output and in the server's own logs
+	var redactPatterns []string
+	if cfg.Redact.Builtin {
+		redactPatterns = append(redactPatterns, redact.Builtin...)
+	}
+	if cfg.Redact.PatternsFile != "" {
+		patterns, err := redact.LoadPatterns(cfg.Redact.PatternsFile)
+		if err != nil {
+			return fmt.Errorf("invalid PYEXEC_REDACT_PATTERNS_FILE %s: %w", cfg.Redact.PatternsFile, err)
+		}
+		redactPatterns = append(redactPatterns, patterns...)
+	}
+	redactor, err := redact.New(redactPatterns)
+	if err != nil {
+		return fmt.Errorf("invalid redaction pattern: %w", err)
+	}
+	logger.AddHook(redactor)
+
+	// Secrets executions ask for by name
+	secretStore, err := secrets.New(cfg.Secrets, cfg.Consul)
+	if err != nil {
+		return fmt.Errorf("invalid secrets configuration: %w", err)
+	}
+	logger.WithField("backend", cfg.Secrets.Backend).Info("Using secrets backend")
+
+	// Initialize storage and the async queue
+	var store storage.Storage
+	var jobQueue queue.Queue
+	if cfg.Consul.Enabled {
+		logger.Info("Using Consul storage")
+		consulStore, err := storage.NewConsulStorage(
+			cfg.Consul.Address,
+			cfg.Consul.Token,
+			cfg.Consul.KeyPrefix,
+			storage.ConsulOptions{
+				Timeout:          cfg.Consul.Timeout,
+				Retries:          cfg.Consul.Retries,
+				BreakerThreshold: cfg.Consul.BreakerThreshold,
+				BreakerCooldown:  cfg.Consul.BreakerCooldown,
+			},
+		)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to connect to Consul, falling back to in-memory storage")
+			store = storage.NewMemoryStorage()
+		} else {
+			store = consulStore
+
+			// Replicas sharing the prefix also share the async queue
+			consulQueue, err := queue.NewConsulQueue(
+				cfg.Consul.Address,
+				cfg.Consul.Token,
+				cfg.Consul.KeyPrefix,
+			)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to create Consul queue, falling back to in-memory queue")
+			} else {
+				jobQueue = consulQueue
+			}
+		}
+	} else {
+		logger.Info("Using in-memory storage")
+		store = storage.NewMemoryStorage()
+	}
+	defer store.Close()
+
+	// In-memory storage may be persisted to a snapshot file
+	var snapshotStore *storage.MemoryStorage
+	if memStore, ok := store.(*storage.MemoryStorage); ok && cfg.Snapshot.File != "" {
+		snapshotStore = memStore
+		if err := memStore.Load(cfg.Snapshot.File); err == nil {
+			logger.WithField("file", cfg.Snapshot.File).Info("Loaded storage snapshot")
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("loading storage snapshot: %w", err)
+		}
+	}
+
+	if jobQueue == nil {
+		jobQueue = queue.NewMemoryQueue()
+	}
+	defer jobQueue.Close()
+
+	// Initialize executor: this host's Docker, or runner agents that
+	// claim the executions over the API
+	var exec executor.Executor
+	var pool *runner.Pool
+	switch cfg.Server.Executor {
+	case config.ExecutorDocker:
+		dockerExec, err := executor.NewDockerExecutor(cfg)
+		if err != nil {
+			return fmt.Errorf("creating executor: %w", err)
+		}
+		host := dockerExec.Host()
+		logger.WithFields(logrus.Fields{"docker_host": host.Host, "source": host.Source}).Info("Using Docker")
+		exec = dockerExec
+	case config.ExecutorRunners:
+		if cfg.Runners.Token == "" {
+			return errors.New("PYEXEC_EXECUTOR=runners requires PYEXEC_RUNNER_TOKEN")
+		}
+		pool = runner.NewPool(cfg.Runners.Timeout, cfg.Defaults.MemoryMB)
+		exec = pool
+		logger.Info("Running executions on runner agents")
+	default:
+		return fmt.Errorf("invalid PYEXEC_EXECUTOR %q: use %q or %q",
+			cfg.Server.Executor, config.ExecutorDocker, config.ExecutorRunners)
+	}
+	defer exec.Close()
+
+	// Create API server
+	apiServer := api.NewServer(store, jobQueue, exec, cfg)
+	apiServer.SetRedactor(redactor)
+	apiServer.SetSecretStore(secretStore)
+	if err := apiServer.SetAPIKeys(cfg.Auth.APIKeys); err != nil {
+		return fmt.Errorf("invalid API keys: %w", err)
+	}
+	if pool != nil {
+		apiServer.SetRunnerPool(pool)
+	}
+	router := api.SetupRouter(apiServer, logger)
+
+	// Listener errors end the server
+	serveErr := make(chan error, 2)
+
+	// Send executions' traffic through the egress proxy, if configured,
+	// to limit their bandwidth
+	var egressSrv *http.Server
+	if cfg.Egress.ProxyAddr != "" {
+		proxyURL, err := egress.ProxyURL(cfg.Egress.ProxyAddr, cfg.Egress.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid egress proxy configuration: %w", err)
+		}
+		ln, err := net.Listen("tcp", cfg.Egress.ProxyAddr)
+		if err != nil {
+			return fmt.Errorf("starting egress proxy: %w", err)
+		}
+		proxy := egress.NewProxy()
+		apiServer.SetEgressProxy(proxy, proxyURL)
+		egressSrv = &http.Server{Handler: proxy}
+		go serve(egressSrv, ln, "egress proxy", serveErr)
+		defer egressSrv.Close()
+		logger.WithFields(logrus.Fields{
+			"addr": ln.Addr().String(),
+			"url":  proxyURL.String(),
+			"kbps": cfg.Egress.Kbps,
+		}).Info("Egress proxy listening")
+	}
+
+	// Publish execution lifecycle events, if a broker is configured
+	publisher, err := events.New(cfg.Events, func(err error) {
+		logger.WithError(err).Warn("Failed to publish execution event")
+	})
+	if err != nil {
+		return fmt.Errorf("creating event publisher: %w", err)
+	}
+	if publisher != nil {
+		logger.WithFields(logrus.Fields{
+			"nats":  cfg.Events.NATSURL != "",
+			"kafka": cfg.Events.KafkaRESTURL != "",
+		}).Info("Publishing execution events")
+		apiServer.SetEventPublisher(publisher)
+	}
+
+	// Reconcile executions left in flight by a previous process
+	if report, err := apiServer.RecoverExecutions(context.Background()); err != nil {
+		logger.WithError(err).Warn("Failed to recover in-flight executions")
+	} else if report.Reattached > 0 || report.Failed > 0 {
+		logger.WithFields(logrus.Fields{
+			"reattached": report.Reattached,
+			"failed":     report.Failed,
+		}).Info("Recovered in-flight executions")
+	}
+
+	// Start HTTP server
+	addr := net.JoinHostPort(cfg.Server.Host, cfg.Server.Port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("starting server: %w", err)
+	}
+	srv := &http.Server{Handler: router}
+	go serve(srv, ln, "server", serveErr)
+	logger.WithField("addr", ln.Addr().String()).Info("Server listening")
+
+	// Start async workers, and the background routines that stop with
+	// them
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	apiServer.StartWorkers(workerCtx, cfg.Queue.Workers)
+
+	go runCleanup(workerCtx, store, cfg.Cleanup.TTL, cleanupInterval, logger)
+	go runUploadCleanup(workerCtx, apiServer, cleanupInterval, logger)
+	go runPipelineCleanup(workerCtx, apiServer, cfg.Cleanup.TTL, cleanupInterval, logger)
+	go runSessionReaper(workerCtx, apiServer, sessionReapInterval, logger)
+	if snapshotStore != nil && cfg.Snapshot.Interval > 0 {
+		go runSnapshots(workerCtx, snapshotStore, cfg.Snapshot.File, cfg.Snapshot.Interval, logger)
+	}
+	if pool != nil {
+		go pool.Monitor(workerCtx, func(names []string) {
+			logger.WithField("runners", names).Warn("Dropped runners that stopped responding")
+		})
+	}
+
+	// Serve until told to stop, or a listener fails
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serveErr:
+		logger.WithError(runErr).Error("Listener failed")
+	}
+
+	logger.WithFields(logrus.Fields{
+		"in_flight": apiServer.InFlight(),
+		"drain":     cfg.Server.ShutdownDrain,
+	}).Info("Shutting down server, draining executions...")
+
+	// Stop claiming queued jobs, then wait for running executions
+	stopWorkers()
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Server.ShutdownDrain)
+	defer cancelDrain()
+
+	if err := apiServer.Drain(drainCtx); err != nil {
+		// Leftover executions keep their running state and containers and are
+		// re-attached by RecoverExecutions on the next start
+		logger.WithField("in_flight", apiServer.InFlight()).Warn("Drain period expired; leaving executions for restart recovery")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Server forced to shutdown")
+	}
+
+	// Sessions live in this process's memory, so they end with it
+	if err := apiServer.CloseSessions(shutdownCtx); err != nil {
+		logger.WithError(err).Error("Failed to close sessions")
+	}
+
+	// Executions that finished while draining are in the final snapshot;
+	// those still running are recovered from it on the next start
+	if snapshotStore != nil {
+		if err := snapshotStore.Save(cfg.Snapshot.File); err != nil {
+			logger.WithError(err).Error("Failed to save storage snapshot")
+		}
+	}
+
+	// Deliver the events of the executions that finished while draining
+	if err := publisher.Close(shutdownCtx); err != nil {
+		logger.WithError(err).Warn("Failed to deliver execution events")
+	}
+	if dropped := publisher.Dropped(); dropped > 0 {
+		logger.WithField("dropped", dropped).Warn("Execution events were dropped")
+	}
+
+	logger.Info("Server exited")
+	return runErr
+}
+
+// serve serves HTTP on ln, reporting a failure other than being shut down
+func serve(srv *http.Server, ln net.Listener, name string, errs chan<- error) {
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		errs <- fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// cleanupInterval is how often expired executions are removed
+const cleanupInterval = 5 * time.Minute
+
+// every calls fn every interval until ctx ends
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runCleanup periodically cleans up old executions. With shared storage only
+// one replica performs the cleanup each interval.
+func runCleanup(ctx context.Context, store storage.Storage, ttl, interval time.Duration, logger *logrus.Logger) {
+	every(ctx, interval, func() {
+		ran, err := storage.RunExclusive(context.Background(), store, "cleanup", interval, func(ctx context.Context) error {
+			logger.Info("Running cleanup")
+			return store.Cleanup(ctx, ttl)
+		})
+		if err != nil {
+			logger.WithError(err).Error("Cleanup failed")
+		} else if !ran {
+			logger.Debug("Cleanup skipped; another replica ran it")
+		}
+	})
+}
+
+// runUploadCleanup periodically deletes abandoned chunked uploads. Uploads
+// are stored on local disk, so every replica cleans up its own.
+func runUploadCleanup(ctx context.Context, apiServer *api.Server, interval time.Duration, logger *logrus.Logger) {
+	every(ctx, interval, func() {
+		deleted, err := apiServer.CleanupUploads()
+		if err != nil {
+			logger.WithError(err).Error("Upload cleanup failed")
+		} else if deleted > 0 {
+			logger.WithField("deleted", deleted).Info("Deleted expired uploads")
+		}
+	})
+}
+
+// runPipelineCleanup periodically forgets pipelines that finished longer
+// ago than the execution TTL. Pipelines belong to the instance that ran them.
+func runPipelineCleanup(ctx context.Context, apiServer *api.Server, ttl, interval time.Duration, logger *logrus.Logger) {
+	every(ctx, interval, func() {
+		if removed := apiServer.CleanupPipelines(ttl); removed > 0 {
+			logger.WithField("removed", removed).Info("Removed finished pipelines")
+		}
+	})
+}
+
+// runSnapshots periodically saves in-memory storage to its snapshot file
+func runSnapshots(ctx context.Context, store *storage.MemoryStorage, file string, interval time.Duration, logger *logrus.Logger) {
+	every(ctx, interval, func() {
+		if err := store.Save(file); err != nil {
+			logger.WithError(err).Error("Failed to save storage snapshot")
+		}
+	})
+}
+
+// sessionReapInterval is how often idle sessions are closed
+const sessionReapInterval = 30 * time.Second
+
+// runSessionReaper periodically closes sessions past their idle timeout.
+// Sessions belong to the instance that created them.
+func runSessionReaper(ctx context.Context, apiServer *api.Server, interval time.Duration, logger *logrus.Logger) {
+	every(ctx, interval, func() {
+		closed, err := apiServer.CloseIdleSessions(context.Background())
+		if err != nil {
+			logger.WithError(err).Error("Closing idle sessions failed")
+		}
+		if closed > 0 {
+			logger.WithField("closed", closed).Info("Closed idle sessions")
+		}
+	})
+}
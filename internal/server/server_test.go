@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// testConfig returns a configuration that runs without Docker or Consul
+func testConfig() *config.Config {
+	cfg := config.Load()
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Server.Port = "0"
+	cfg.Server.Executor = config.ExecutorRunners
+	cfg.Server.ShutdownDrain = time.Second
+	cfg.Runners.Token = "runner-token"
+	cfg.Consul.Enabled = false
+	cfg.Snapshot.File = ""
+	cfg.Egress.ProxyAddr = ""
+	return cfg
+}
+
+func TestRun(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// The server runs until its context ends
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, testConfig(), logger) }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Run() returned early: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after its context ended")
+	}
+
+	// Invalid configuration is reported, not fatal
+	cfg := testConfig()
+	cfg.Server.Executor = "kubernetes"
+	if err := Run(context.Background(), cfg, logger); err == nil || !strings.Contains(err.Error(), "PYEXEC_EXECUTOR") {
+		t.Errorf("Run() with an invalid executor = %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// ErrInvalidBackup is returned (wrapped) by Import for data that isn't a
+// backup it can read
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// backupVersion is the version of the backup format written by Export
+const backupVersion = 1
+
+// Backup is the contents of a backup archive: every execution and template
+// of a store, in the form every backend stores them
+type Backup struct {
+	Version    int                `json:"version"`
+	CreatedAt  time.Time          `json:"created_at"`
+	Executions []*Execution       `json:"executions"`
+	Templates  []*client.Template `json:"templates"`
+	// Artifacts holds the contents of the executions' artifacts stored
+	// apart from their records, by execution ID and name
+	Artifacts map[string]map[string][]byte `json:"artifacts,omitempty"`
+}
+
+// Export writes a gzip-compressed JSON backup of a store's executions and
+// templates to w
+func Export(ctx context.Context, store Storage, w io.Writer) error {
+	executions, err := store.List(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("listing executions: %w", err)
+	}
+	templates, err := store.ListTemplates(ctx)
+	if err != nil {
+		return fmt.Errorf("listing templates: %w", err)
+	}
+
+	backup := Backup{
+		Version:    backupVersion,
+		CreatedAt:  time.Now().UTC(),
+		Executions: executions,
+		Templates:  templates,
+		Artifacts:  make(map[string]map[string][]byte),
+	}
+	for _, exec := range executions {
+		for _, a := range exec.Artifacts {
+			if a.URL == "" {
+				continue
+			}
+			data, err := store.GetArtifact(ctx, exec.ID, a.Name)
+			if errors.Is(err, ErrArtifactNotFound) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("reading artifact %s of %s: %w", a.Name, exec.ID, err)
+			}
+			if backup.Artifacts[exec.ID] == nil {
+				backup.Artifacts[exec.ID] = make(map[string][]byte)
+			}
+			backup.Artifacts[exec.ID][a.Name] = data
+		}
+	}
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(&backup); err != nil {
+		return fmt.Errorf("writing backup: %w", err)
+	}
+	return gz.Close()
+}
+
+// Import restores a backup written by Export, compressed or not, into a
+// store. Executions and templates the store already has are skipped unless
+// overwrite is set. Executions that were still in flight are restored as
+// failed, since nothing will run them.
+func Import(ctx context.Context, store Storage, r io.Reader, overwrite bool) (*client.RestoreResult, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	var backup Backup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	if backup.Version != backupVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidBackup, backup.Version)
+	}
+
+	result := &client.RestoreResult{}
+	for _, exec := range backup.Executions {
+		if exec == nil || exec.ID == "" {
+			continue
+		}
+		if !exec.Status.IsTerminal() {
+			finishedAt := backup.CreatedAt
+			exec.Status = client.StatusFailed
+			exec.Error = "execution lost: restored from a backup before it finished"
+			exec.FinishedAt = &finishedAt
+		}
+
+		_, err := store.Get(ctx, exec.ID)
+		switch {
+		case err != nil:
+			err = store.Create(ctx, exec)
+		case overwrite:
+			err = store.Update(ctx, exec)
+		default:
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("restoring execution %s: %w", exec.ID, err)
+		}
+		for name, data := range backup.Artifacts[exec.ID] {
+			if err := store.PutArtifact(ctx, exec.ID, name, data); err != nil {
+				return result, fmt.Errorf("restoring artifact %s of %s: %w", name, exec.ID, err)
+			}
+		}
+		result.Executions++
+	}
+
+	for _, t := range backup.Templates {
+		if t == nil || t.Name == "" {
+			continue
+		}
+		if !overwrite {
+			if _, err := store.GetTemplate(ctx, t.Name); err == nil {
+				result.Skipped++
+				continue
+			}
+		}
+		if err := store.PutTemplate(ctx, t); err != nil {
+			return result, fmt.Errorf("restoring template %s: %w", t.Name, err)
+		}
+		result.Templates++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemoryStorage()
+	require.NoError(t, src.Create(ctx, &Execution{ID: "exec-1", Status: client.StatusCompleted, Stdout: "hello\n", CreatedAt: time.Now()}))
+	require.NoError(t, src.Create(ctx, &Execution{ID: "exec-2", Status: client.StatusRunning, CreatedAt: time.Now()}))
+	require.NoError(t, src.PutTemplate(ctx, &client.Template{Name: "report"}))
+	require.NoError(t, src.Update(ctx, &Execution{ID: "exec-1", Status: client.StatusCompleted, Stdout: "hello\n", CreatedAt: time.Now(),
+		Artifacts: []client.Artifact{{Name: "stdout.log", URL: "/api/v1/executions/exec-1/artifacts/stdout.log"}}}))
+	require.NoError(t, src.PutArtifact(ctx, "exec-1", "stdout.log", []byte("hello\n")))
+
+	var buf bytes.Buffer
+	require.NoError(t, Export(ctx, src, &buf))
+	archive := buf.Bytes()
+
+	dst := NewMemoryStorage()
+	require.NoError(t, dst.Create(ctx, &Execution{ID: "exec-1", Status: client.StatusFailed, CreatedAt: time.Now()}))
+	result, err := Import(ctx, dst, bytes.NewReader(archive), false)
+	require.NoError(t, err)
+	assert.Equal(t, client.RestoreResult{Executions: 1, Templates: 1, Skipped: 1}, *result)
+
+	// Executions that were in flight won't be run by anything
+	exec, err := dst.Get(ctx, "exec-2")
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusFailed, exec.Status)
+	assert.NotNil(t, exec.FinishedAt)
+	exec, _ = dst.Get(ctx, "exec-1")
+	assert.Equal(t, client.StatusFailed, exec.Status)
+
+	// Overwriting replaces what the store had; an uncompressed backup
+	// is read too
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	result, err = Import(ctx, dst, bytes.NewReader(plain), true)
+	require.NoError(t, err)
+	assert.Equal(t, client.RestoreResult{Executions: 2, Templates: 1}, *result)
+	exec, _ = dst.Get(ctx, "exec-1")
+	assert.Equal(t, client.StatusCompleted, exec.Status)
+	assert.Equal(t, "hello\n", exec.Stdout)
+	log, err := dst.GetArtifact(ctx, "exec-1", "stdout.log")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(log))
+
+	_, err = Import(ctx, dst, strings.NewReader(`{"version": 9}`), false)
+	assert.ErrorIs(t, err, ErrInvalidBackup)
+	_, err = Import(ctx, dst, strings.NewReader("not a backup"), false)
+	assert.ErrorIs(t, err, ErrInvalidBackup)
+}
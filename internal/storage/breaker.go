@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned (wrapped) while a storage backend's circuit
+// breaker is open and calls to it are refused without being made
+var ErrUnavailable = errors.New("storage unavailable")
+
+// Breaker is implemented by storage backends that stop calling a backend
+// that keeps failing. Handlers use it to answer 503 at once rather than
+// waiting on calls that would time out.
+type Breaker interface {
+	// Unavailable reports whether calls are being refused, and how long
+	// until the backend is tried again
+	Unavailable() (time.Duration, bool)
+}
+
+// Unavailable reports whether the store's Breaker is refusing calls.
+// Backends without one are always available.
+func Unavailable(store Storage) (time.Duration, bool) {
+	if b, ok := store.(Breaker); ok {
+		return b.Unavailable()
+	}
+	return 0, false
+}
+
+// breaker is a circuit breaker. It opens after threshold consecutive
+// failures and refuses calls for the cooldown; then one call is let through
+// to test the backend, closing the breaker if it succeeds.
+type breaker struct {
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns ErrUnavailable if a call may not be made. A nil error
+// must be followed by a call to record.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrUnavailable
+	}
+	b.probing = true
+	return nil
+}
+
+// record counts the outcome of a call that allow let through
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// unavailable reports whether the breaker is open and for how long
+func (b *breaker) unavailable() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return 0, false
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return wait, true
+	}
+	return 0, b.probing
+}
+
+// retryBackoff is the wait before the first retry of a failed call; it
+// doubles with each retry
+const retryBackoff = 100 * time.Millisecond
+
+// do runs fn with a per-attempt timeout, retrying it up to retries times,
+// through the breaker. Calls abandoned by the caller are not counted as
+// failures of the backend.
+func (b *breaker) do(ctx context.Context, timeout time.Duration, retries int, fn func(ctx context.Context) error) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(retryBackoff << (attempt - 1)):
+			case <-ctx.Done():
+				b.release()
+				return ctx.Err()
+			}
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		err = fn(callCtx)
+		cancel()
+
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			b.release()
+			return err
+		}
+	}
+	b.record(err)
+	return err
+}
+
+// release ends a call let through by allow without counting its outcome
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
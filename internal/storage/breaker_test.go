@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConsulStorage_Breaker(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "rpc error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Consul-Index", "1")
+		w.WriteHeader(http.StatusNotFound) // the key doesn't exist
+	}))
+	defer srv.Close()
+
+	store, err := NewConsulStorage(srv.URL, "", "test", ConsulOptions{
+		Timeout:          time.Second,
+		Retries:          1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Each failed call is retried once
+	for i := 0; i < 2; i++ {
+		if _, err := store.Get(ctx, "exe_1"); err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("Get() error = %v, want a Consul error", err)
+		}
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Consul called %d times, want 4", n)
+	}
+
+	// The breaker is open: calls fail without reaching Consul
+	if _, down := Unavailable(store); !down {
+		t.Error("breaker not open")
+	}
+	if _, err := store.Get(ctx, "exe_1"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get() error = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("Consul called %d times with the breaker open", n)
+	}
+
+	// After the cooldown a successful call closes it
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := store.Get(ctx, "exe_1"); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Errorf("Get() error = %v, want not found", err)
+	}
+	if _, down := Unavailable(store); down {
+		t.Error("breaker still open")
+	}
+}
+
+func TestConsulStorage_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	store, err := NewConsulStorage(srv.URL, "", "test", ConsulOptions{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := store.Get(context.Background(), "exe_1"); err == nil {
+		t.Error("Get() of a hung Consul succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get() took %s", elapsed)
+	}
+}
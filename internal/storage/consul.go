@@ -4,20 +4,53 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
-	consulapi "github.com/hashicorp/consul/api"
 	"github.com/geraldthewes/python-executor/pkg/client"
+	consulapi "github.com/hashicorp/consul/api"
 )
 
+// ConsulOptions bounds the time spent on Consul calls, so that a slow
+// Consul doesn't hold up every request waiting on it
+type ConsulOptions struct {
+	Timeout time.Duration // per attempt; 0 means no timeout
+	Retries int           // further attempts after a failed call
+	// BreakerThreshold is the consecutive failed calls after which Consul
+	// is no longer called for BreakerCooldown; 0 disables the breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
 // ConsulStorage implements storage using Consul KV
 type ConsulStorage struct {
 	client    *consulapi.Client
 	keyPrefix string
+	opts      ConsulOptions
+	breaker   *breaker
+
+	indexMu sync.Mutex
+	indexed bool // the status index is known to be built
+}
+
+// indexedStatuses are the statuses with an index under <prefix>/status/.
+// Executions pass through them and don't stay, so the index stays small
+// however many finished executions are kept.
+var indexedStatuses = []client.ExecutionStatus{
+	client.StatusAwaitingApproval,
+	client.StatusPending,
+	client.StatusRunning,
 }
 
+// consulTxnOps is the most operations written per transaction, under
+// Consul's limit of 128
+const consulTxnOps = 64
+
 // NewConsulStorage creates a new Consul-backed storage
-func NewConsulStorage(address, token, keyPrefix string) (*ConsulStorage, error) {
+func NewConsulStorage(address, token, keyPrefix string, opts ConsulOptions) (*ConsulStorage, error) {
 	config := consulapi.DefaultConfig()
 	config.Address = address
 	if token != "" {
@@ -32,6 +65,8 @@ func NewConsulStorage(address, token, keyPrefix string) (*ConsulStorage, error)
 	return &ConsulStorage{
 		client:    client,
 		keyPrefix: keyPrefix,
+		opts:      opts,
+		breaker:   &breaker{threshold: opts.BreakerThreshold, cooldown: opts.BreakerCooldown},
 	}, nil
 }
 
@@ -40,8 +75,7 @@ func (c *ConsulStorage) Create(ctx context.Context, exec *Execution) error {
 	key := c.executionKey(exec.ID)
 
 	// Check if exists
-	kv := c.client.KV()
-	existing, _, err := kv.Get(key, nil)
+	existing, err := c.get(ctx, key)
 	if err != nil {
 		return fmt.Errorf("checking existing key: %w", err)
 	}
@@ -49,19 +83,7 @@ func (c *ConsulStorage) Create(ctx context.Context, exec *Execution) error {
 		return fmt.Errorf("execution %s already exists", exec.ID)
 	}
 
-	// Serialize and store
-	data, err := json.Marshal(exec)
-	if err != nil {
-		return fmt.Errorf("marshaling execution: %w", err)
-	}
-
-	p := &consulapi.KVPair{
-		Key:   key,
-		Value: data,
-	}
-
-	_, err = kv.Put(p, nil)
-	if err != nil {
+	if err := c.putExecution(ctx, exec); err != nil {
 		return fmt.Errorf("storing execution: %w", err)
 	}
 
@@ -72,8 +94,7 @@ func (c *ConsulStorage) Create(ctx context.Context, exec *Execution) error {
 func (c *ConsulStorage) Get(ctx context.Context, id string) (*Execution, error) {
 	key := c.executionKey(id)
 
-	kv := c.client.KV()
-	pair, _, err := kv.Get(key, nil)
+	pair, err := c.get(ctx, key)
 	if err != nil {
 		return nil, fmt.Errorf("getting key: %w", err)
 	}
@@ -91,46 +112,132 @@ func (c *ConsulStorage) Get(ctx context.Context, id string) (*Execution, error)
 
 // Update updates an existing execution
 func (c *ConsulStorage) Update(ctx context.Context, exec *Execution) error {
-	key := c.executionKey(exec.ID)
+	if err := c.putExecution(ctx, exec); err != nil {
+		return fmt.Errorf("updating execution: %w", err)
+	}
 
-	data, err := json.Marshal(exec)
-	if err != nil {
-		return fmt.Errorf("marshaling execution: %w", err)
+	return nil
+}
+
+// maxExecutionModifies bounds the attempts to modify an execution that
+// other replicas keep changing
+const maxExecutionModifies = 10
+
+// Modify applies fn to an execution and stores the result. Replicas change
+// the same executions, so the write is a check-and-set, and fn is applied
+// again to the new version if it loses.
+func (c *ConsulStorage) Modify(ctx context.Context, id string, fn func(exec *Execution) error) (*Execution, error) {
+	key := c.executionKey(id)
+
+	for attempt := 0; attempt < maxExecutionModifies; attempt++ {
+		pair, err := c.get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("getting key: %w", err)
+		}
+		if pair == nil {
+			return nil, fmt.Errorf("execution %s not found", id)
+		}
+
+		var exec Execution
+		if err := json.Unmarshal(pair.Value, &exec); err != nil {
+			return nil, fmt.Errorf("unmarshaling execution: %w", err)
+		}
+		if err := fn(&exec); err != nil {
+			return nil, err
+		}
+
+		ops, err := c.executionOps(&exec)
+		if err != nil {
+			return nil, err
+		}
+		ops[0].KV.Verb = consulapi.KVCAS
+		ops[0].KV.Index = pair.ModifyIndex
+
+		// Not retried: a write that succeeded but timed out would lose
+		// the next attempt's check-and-set to itself
+		var ok bool
+		err = c.breaker.do(ctx, c.opts.Timeout, 0, func(ctx context.Context) (err error) {
+			ok, _, _, err = c.client.Txn().Txn(ops, (&consulapi.QueryOptions{}).WithContext(ctx))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("updating execution: %w", err)
+		}
+		if ok {
+			return &exec, nil
+		}
 	}
+	return nil, fmt.Errorf("updating execution: %d concurrent updates lost", maxExecutionModifies)
+}
 
-	p := &consulapi.KVPair{
-		Key:   key,
-		Value: data,
+// putExecution writes an execution and its index entries
+func (c *ConsulStorage) putExecution(ctx context.Context, exec *Execution) error {
+	ops, err := c.executionOps(exec)
+	if err != nil {
+		return err
 	}
+	return c.txn(ctx, ops)
+}
 
-	kv := c.client.KV()
-	_, err = kv.Put(p, nil)
+// executionOps returns the transaction that writes an execution, first,
+// and its entries in the indexes: in its caller's index of active
+// executions while it is pending or running, and in the index of its
+// status while that is an indexed one
+func (c *ConsulStorage) executionOps(exec *Execution) (consulapi.TxnOps, error) {
+	data, err := json.Marshal(exec)
 	if err != nil {
-		return fmt.Errorf("updating execution: %w", err)
+		return nil, fmt.Errorf("marshaling execution: %w", err)
 	}
 
-	return nil
+	ops := consulapi.TxnOps{
+		{KV: &consulapi.KVTxnOp{Verb: consulapi.KVSet, Key: c.executionKey(exec.ID), Value: data}},
+	}
+	if exec.Caller != "" {
+		verb := consulapi.KVDelete
+		if exec.active() {
+			verb = consulapi.KVSet
+		}
+		ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: verb, Key: c.activeKey(exec.Caller, exec.ID)}})
+	}
+	for _, status := range indexedStatuses {
+		verb := consulapi.KVDelete
+		if exec.Status == status {
+			verb = consulapi.KVSet
+		}
+		ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: verb, Key: c.statusKey(status, exec.ID)}})
+	}
+	return ops, nil
 }
 
-// Delete removes an execution
+// Delete removes an execution, its status index entries and its artifacts
 func (c *ConsulStorage) Delete(ctx context.Context, id string) error {
-	key := c.executionKey(id)
-
-	kv := c.client.KV()
-	_, err := kv.Delete(key, nil)
-	if err != nil {
+	ops := consulapi.TxnOps{
+		{KV: &consulapi.KVTxnOp{Verb: consulapi.KVDelete, Key: c.executionKey(id)}},
+	}
+	for _, status := range indexedStatuses {
+		ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: consulapi.KVDelete, Key: c.statusKey(status, id)}})
+	}
+	if err := c.txn(ctx, ops); err != nil {
 		return fmt.Errorf("deleting execution: %w", err)
 	}
+	if err := c.deleteTree(ctx, c.artifactsPrefix(id)); err != nil {
+		return fmt.Errorf("deleting artifacts: %w", err)
+	}
 
 	return nil
 }
 
-// List returns all executions (optionally filtered by status)
+// List returns all executions (optionally filtered by status). Executions
+// in an indexed status are read through the index; any other status reads
+// every execution.
 func (c *ConsulStorage) List(ctx context.Context, status *client.ExecutionStatus) ([]*Execution, error) {
+	if status != nil && slices.Contains(indexedStatuses, *status) {
+		return c.listIndexed(ctx, []client.ExecutionStatus{*status})
+	}
+
 	prefix := c.keyPrefix + "/executions/"
 
-	kv := c.client.KV()
-	pairs, _, err := kv.List(prefix, nil)
+	pairs, err := c.list(ctx, prefix)
 	if err != nil {
 		return nil, fmt.Errorf("listing executions: %w", err)
 	}
@@ -151,6 +258,121 @@ func (c *ConsulStorage) List(ctx context.Context, status *client.ExecutionStatus
 	return result, nil
 }
 
+// CountActive counts the pending and running executions submitted by
+// caller, from the keys of its index
+func (c *ConsulStorage) CountActive(ctx context.Context, caller string) (int, error) {
+	keys, err := c.keys(ctx, c.activeKey(caller, ""))
+	if err != nil {
+		return 0, fmt.Errorf("counting active executions: %w", err)
+	}
+	return len(keys), nil
+}
+
+// Search returns the executions matching a query, newest first. A query
+// for indexed statuses only reads the executions in them; any other query
+// reads every execution and filters it, as Consul KV can't filter on
+// values.
+func (c *ConsulStorage) Search(ctx context.Context, q *Query) ([]*Execution, error) {
+	var all []*Execution
+	var err error
+	if len(q.Statuses) > 0 && !slices.ContainsFunc(q.Statuses, func(s client.ExecutionStatus) bool {
+		return !slices.Contains(indexedStatuses, s)
+	}) {
+		all, err = c.listIndexed(ctx, q.Statuses)
+	} else {
+		all, err = c.List(ctx, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Execution
+	for _, exec := range all {
+		if q.Matches(exec) {
+			result = append(result, exec)
+		}
+	}
+	sortNewestFirst(result)
+	return result, nil
+}
+
+// listIndexed returns the executions in the given indexed statuses. An
+// entry whose execution has since moved on, which building the index
+// alongside running servers can leave behind, is skipped.
+func (c *ConsulStorage) listIndexed(ctx context.Context, statuses []client.ExecutionStatus) ([]*Execution, error) {
+	if err := c.buildStatusIndex(ctx); err != nil {
+		return nil, err
+	}
+
+	var result []*Execution
+	for _, status := range statuses {
+		prefix := c.statusKey(status, "")
+		keys, err := c.keys(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s executions: %w", status, err)
+		}
+		for _, key := range keys {
+			pair, err := c.get(ctx, c.executionKey(strings.TrimPrefix(key, prefix)))
+			if err != nil {
+				return nil, fmt.Errorf("getting execution: %w", err)
+			}
+			if pair == nil {
+				continue
+			}
+			var exec Execution
+			if err := json.Unmarshal(pair.Value, &exec); err != nil || exec.Status != status {
+				continue
+			}
+			result = append(result, &exec)
+		}
+	}
+	return result, nil
+}
+
+// buildStatusIndex indexes the executions stored before the status index
+// existed, once per prefix: the first server to find no
+// <prefix>/indexes/status marker reads every execution, indexes the ones
+// in an indexed status and sets the marker. Executions written since are
+// indexed as they are written.
+func (c *ConsulStorage) buildStatusIndex(ctx context.Context) error {
+	c.indexMu.Lock()
+	defer c.indexMu.Unlock()
+	if c.indexed {
+		return nil
+	}
+
+	marker := c.keyPrefix + "/indexes/status"
+	pair, err := c.get(ctx, marker)
+	if err != nil {
+		return fmt.Errorf("checking status index: %w", err)
+	}
+	if pair == nil {
+		all, err := c.List(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("building status index: %w", err)
+		}
+		var ops consulapi.TxnOps
+		for _, exec := range all {
+			if slices.Contains(indexedStatuses, exec.Status) {
+				ops = append(ops, &consulapi.TxnOp{KV: &consulapi.KVTxnOp{Verb: consulapi.KVSet, Key: c.statusKey(exec.Status, exec.ID)}})
+			}
+		}
+		for len(ops) > 0 {
+			n := min(len(ops), consulTxnOps)
+			if err := c.txn(ctx, ops[:n]); err != nil {
+				return fmt.Errorf("building status index: %w", err)
+			}
+			ops = ops[n:]
+		}
+		if err := c.put(ctx, &consulapi.KVPair{Key: marker}); err != nil {
+			return fmt.Errorf("building status index: %w", err)
+		}
+	}
+
+	c.indexed = true
+	return nil
+}
+
 // Cleanup removes executions older than the given duration
 func (c *ConsulStorage) Cleanup(ctx context.Context, olderThan time.Duration) error {
 	cutoff := time.Now().Add(-olderThan)
@@ -161,10 +383,8 @@ func (c *ConsulStorage) Cleanup(ctx context.Context, olderThan time.Duration) er
 	}
 
 	for _, exec := range executions {
-		// Only cleanup completed/failed/killed executions
-		if exec.Status == client.StatusCompleted ||
-			exec.Status == client.StatusFailed ||
-			exec.Status == client.StatusKilled {
+		// Only cleanup executions in a terminal state
+		if exec.Status.IsTerminal() {
 
 			if exec.CreatedAt.Before(cutoff) {
 				if err := c.Delete(ctx, exec.ID); err != nil {
@@ -178,6 +398,272 @@ func (c *ConsulStorage) Cleanup(ctx context.Context, olderThan time.Duration) er
 	return nil
 }
 
+// consulChunkSize is the most bytes of an artifact stored under one key,
+// well within the 512KB Consul allows a value by default
+const consulChunkSize = 256 << 10
+
+// PutArtifact stores the contents of an execution's artifact, split over
+// keys of at most consulChunkSize bytes
+func (c *ConsulStorage) PutArtifact(ctx context.Context, execID, name string, data []byte) error {
+	prefix := c.artifactKey(execID, name)
+	if err := c.deleteTree(ctx, prefix); err != nil {
+		return fmt.Errorf("replacing artifact: %w", err)
+	}
+
+	for i := 0; i == 0 || i*consulChunkSize < len(data); i++ {
+		p := &consulapi.KVPair{
+			Key:   fmt.Sprintf("%s%06d", prefix, i),
+			Value: data[i*consulChunkSize : min((i+1)*consulChunkSize, len(data))],
+		}
+		if err := c.put(ctx, p); err != nil {
+			return fmt.Errorf("storing artifact: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetArtifact returns the contents of an execution's artifact
+func (c *ConsulStorage) GetArtifact(ctx context.Context, execID, name string) ([]byte, error) {
+	pairs, err := c.list(ctx, c.artifactKey(execID, name))
+	if err != nil {
+		return nil, fmt.Errorf("getting artifact: %w", err)
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: %s of execution %s", ErrArtifactNotFound, name, execID)
+	}
+
+	slices.SortFunc(pairs, func(a, b *consulapi.KVPair) int { return strings.Compare(a.Key, b.Key) })
+	var data []byte
+	for _, pair := range pairs {
+		data = append(data, pair.Value...)
+	}
+	return data, nil
+}
+
+// RunExclusive runs fn while holding a Consul lock for the task, skipping it
+// if another replica already ran it within the interval
+func (c *ConsulStorage) RunExclusive(ctx context.Context, task string, interval time.Duration, fn func(ctx context.Context) error) (bool, error) {
+	base := fmt.Sprintf("%s/tasks/%s", c.keyPrefix, task)
+
+	lock, err := c.client.LockOpts(&consulapi.LockOptions{
+		Key:          base + "/lock",
+		SessionName:  "python-executor-" + task,
+		SessionTTL:   "60s",
+		LockTryOnce:  true,
+		LockWaitTime: time.Second,
+	})
+	if err != nil {
+		return false, fmt.Errorf("creating lock: %w", err)
+	}
+
+	lost, err := lock.Lock(ctx.Done())
+	if err != nil {
+		return false, fmt.Errorf("acquiring lock: %w", err)
+	}
+	if lost == nil {
+		return false, nil // another replica holds the lock
+	}
+	defer lock.Unlock()
+
+	// Tickers on different replicas drift, so allow some slack before
+	// treating the previous run as recent
+	lastRunKey := base + "/last-run"
+	if pair, err := c.get(ctx, lastRunKey); err == nil && pair != nil {
+		if lastRun, err := time.Parse(time.RFC3339Nano, string(pair.Value)); err == nil {
+			if time.Since(lastRun) < interval*9/10 {
+				return false, nil
+			}
+		}
+	}
+
+	// Stop if the lock is lost mid-run
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-lost:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	runErr := fn(runCtx)
+
+	p := &consulapi.KVPair{Key: lastRunKey, Value: []byte(time.Now().Format(time.RFC3339Nano))}
+	if err := c.put(ctx, p); err != nil && runErr == nil {
+		runErr = fmt.Errorf("recording last run: %w", err)
+	}
+
+	return true, runErr
+}
+
+// maxUsageUpdates bounds the attempts to add to a usage record that other
+// replicas keep changing
+const maxUsageUpdates = 10
+
+// AddUsage adds delta to a tenant's usage in a period. Replicas update the
+// same record, so the write is a check-and-set, retried if it loses.
+func (c *ConsulStorage) AddUsage(ctx context.Context, tenant, period string, delta *client.Usage) error {
+	key := c.usageKey(tenant, period)
+
+	for attempt := 0; attempt < maxUsageUpdates; attempt++ {
+		pair, err := c.get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("getting usage: %w", err)
+		}
+
+		usage := client.Usage{Tenant: tenant, Period: period}
+		var index uint64 // 0 makes the check-and-set create the key
+		if pair != nil {
+			if err := json.Unmarshal(pair.Value, &usage); err != nil {
+				return fmt.Errorf("unmarshaling usage: %w", err)
+			}
+			index = pair.ModifyIndex
+		}
+		addUsage(&usage, delta)
+
+		data, err := json.Marshal(&usage)
+		if err != nil {
+			return fmt.Errorf("marshaling usage: %w", err)
+		}
+		// Not retried: a write that succeeded but timed out would be added
+		// again by the next attempt
+		var ok bool
+		err = c.breaker.do(ctx, c.opts.Timeout, 0, func(ctx context.Context) (err error) {
+			ok, _, err = c.client.KV().CAS(&consulapi.KVPair{Key: key, Value: data, ModifyIndex: index}, (&consulapi.WriteOptions{}).WithContext(ctx))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("storing usage: %w", err)
+		}
+		if ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("storing usage: %d concurrent updates lost", maxUsageUpdates)
+}
+
+// GetUsage returns a tenant's usage in a period
+func (c *ConsulStorage) GetUsage(ctx context.Context, tenant, period string) (*client.Usage, error) {
+	pair, err := c.get(ctx, c.usageKey(tenant, period))
+	if err != nil {
+		return nil, fmt.Errorf("getting usage: %w", err)
+	}
+
+	usage := client.Usage{Tenant: tenant, Period: period}
+	if pair != nil {
+		if err := json.Unmarshal(pair.Value, &usage); err != nil {
+			return nil, fmt.Errorf("unmarshaling usage: %w", err)
+		}
+	}
+	return &usage, nil
+}
+
+// ListUsage returns the usage of every tenant with usage in a period
+func (c *ConsulStorage) ListUsage(ctx context.Context, period string) ([]*client.Usage, error) {
+	pairs, err := c.list(ctx, fmt.Sprintf("%s/usage/%s/", c.keyPrefix, period))
+	if err != nil {
+		return nil, fmt.Errorf("listing usage: %w", err)
+	}
+
+	var result []*client.Usage
+	for _, pair := range pairs {
+		var usage client.Usage
+		if err := json.Unmarshal(pair.Value, &usage); err != nil {
+			continue // Skip malformed entries
+		}
+		result = append(result, &usage)
+	}
+	return result, nil
+}
+
+// Stats counts the stored executions and the size of their records
+func (c *ConsulStorage) Stats(ctx context.Context) (*client.StorageStats, error) {
+	pairs, err := c.list(ctx, c.keyPrefix+"/executions/")
+	if err != nil {
+		return nil, fmt.Errorf("listing executions: %w", err)
+	}
+
+	stats := newStats()
+	for _, pair := range pairs {
+		var exec Execution
+		if err := json.Unmarshal(pair.Value, &exec); err != nil {
+			continue // Skip malformed entries
+		}
+		addStats(stats, &exec, len(pair.Value))
+	}
+	return stats, nil
+}
+
+// PutTemplate stores a template, replacing any of the same name
+func (c *ConsulStorage) PutTemplate(ctx context.Context, t *client.Template) error {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("marshaling template: %w", err)
+	}
+
+	if err := c.put(ctx, &consulapi.KVPair{Key: c.templateKey(t.Name), Value: data}); err != nil {
+		return fmt.Errorf("storing template: %w", err)
+	}
+	return nil
+}
+
+// GetTemplate returns a template by name
+func (c *ConsulStorage) GetTemplate(ctx context.Context, name string) (*client.Template, error) {
+	pair, err := c.get(ctx, c.templateKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("getting template: %w", err)
+	}
+	if pair == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	var t client.Template
+	if err := json.Unmarshal(pair.Value, &t); err != nil {
+		return nil, fmt.Errorf("unmarshaling template: %w", err)
+	}
+	return &t, nil
+}
+
+// ListTemplates returns every template
+func (c *ConsulStorage) ListTemplates(ctx context.Context) ([]*client.Template, error) {
+	pairs, err := c.list(ctx, c.keyPrefix+"/templates/")
+	if err != nil {
+		return nil, fmt.Errorf("listing templates: %w", err)
+	}
+
+	var result []*client.Template
+	for _, pair := range pairs {
+		var t client.Template
+		if err := json.Unmarshal(pair.Value, &t); err != nil {
+			continue // Skip malformed entries
+		}
+		result = append(result, &t)
+	}
+	return result, nil
+}
+
+// DeleteTemplate removes a template
+func (c *ConsulStorage) DeleteTemplate(ctx context.Context, name string) error {
+	key := c.templateKey(name)
+	pair, err := c.get(ctx, key)
+	if err != nil {
+		return fmt.Errorf("getting template: %w", err)
+	}
+	if pair == nil {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if err := c.delete(ctx, key); err != nil {
+		return fmt.Errorf("deleting template: %w", err)
+	}
+	return nil
+}
+
+// Unavailable reports whether the circuit breaker is refusing Consul calls
+func (c *ConsulStorage) Unavailable() (time.Duration, bool) {
+	return c.breaker.unavailable()
+}
+
 // Close closes the Consul client
 func (c *ConsulStorage) Close() error {
 	return nil // Consul client doesn't need explicit closing
@@ -187,3 +673,106 @@ func (c *ConsulStorage) Close() error {
 func (c *ConsulStorage) executionKey(id string) string {
 	return fmt.Sprintf("%s/executions/%s", c.keyPrefix, id)
 }
+
+// artifactsPrefix generates the Consul prefix of an execution's artifacts
+func (c *ConsulStorage) artifactsPrefix(id string) string {
+	return fmt.Sprintf("%s/artifacts/%s/", c.keyPrefix, id)
+}
+
+// artifactKey generates the Consul prefix of the chunks of an artifact.
+// Names may contain slashes, so they are escaped to keep one artifact's
+// prefix from covering another's.
+func (c *ConsulStorage) artifactKey(id, name string) string {
+	return c.artifactsPrefix(id) + url.PathEscape(name) + "/"
+}
+
+// activeKey generates the Consul key of an active execution in its
+// caller's index. Callers may be addresses with colons, so they are
+// escaped.
+func (c *ConsulStorage) activeKey(caller, id string) string {
+	return fmt.Sprintf("%s/active/%s/%s", c.keyPrefix, url.PathEscape(caller), id)
+}
+
+// statusKey generates the Consul key of an execution in the index of its
+// status
+func (c *ConsulStorage) statusKey(status client.ExecutionStatus, id string) string {
+	return fmt.Sprintf("%s/status/%s/%s", c.keyPrefix, status, id)
+}
+
+// usageKey generates the Consul key for a tenant's usage in a period
+func (c *ConsulStorage) usageKey(tenant, period string) string {
+	return fmt.Sprintf("%s/usage/%s/%s", c.keyPrefix, period, tenant)
+}
+
+// templateKey generates the Consul key for a template
+func (c *ConsulStorage) templateKey(name string) string {
+	return fmt.Sprintf("%s/templates/%s", c.keyPrefix, name)
+}
+
+// get reads a key, returning nil if it doesn't exist
+func (c *ConsulStorage) get(ctx context.Context, key string) (*consulapi.KVPair, error) {
+	var pair *consulapi.KVPair
+	err := c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) (err error) {
+		pair, _, err = c.client.KV().Get(key, (&consulapi.QueryOptions{}).WithContext(ctx))
+		return err
+	})
+	return pair, err
+}
+
+// list reads the keys under a prefix
+func (c *ConsulStorage) list(ctx context.Context, prefix string) (consulapi.KVPairs, error) {
+	var pairs consulapi.KVPairs
+	err := c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) (err error) {
+		pairs, _, err = c.client.KV().List(prefix, (&consulapi.QueryOptions{}).WithContext(ctx))
+		return err
+	})
+	return pairs, err
+}
+
+// keys lists the keys under a prefix, without their values
+func (c *ConsulStorage) keys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) (err error) {
+		keys, _, err = c.client.KV().Keys(prefix, "", (&consulapi.QueryOptions{}).WithContext(ctx))
+		return err
+	})
+	return keys, err
+}
+
+// txn applies KV operations atomically
+func (c *ConsulStorage) txn(ctx context.Context, ops consulapi.TxnOps) error {
+	return c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) error {
+		ok, resp, _, err := c.client.Txn().Txn(ops, (&consulapi.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if !ok && resp != nil && len(resp.Errors) > 0 {
+			return fmt.Errorf("transaction rolled back: %s", resp.Errors[0].What)
+		}
+		return nil
+	})
+}
+
+// put writes a key
+func (c *ConsulStorage) put(ctx context.Context, p *consulapi.KVPair) error {
+	return c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) error {
+		_, err := c.client.KV().Put(p, (&consulapi.WriteOptions{}).WithContext(ctx))
+		return err
+	})
+}
+
+// delete removes a key
+func (c *ConsulStorage) delete(ctx context.Context, key string) error {
+	return c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) error {
+		_, err := c.client.KV().Delete(key, (&consulapi.WriteOptions{}).WithContext(ctx))
+		return err
+	})
+}
+
+// deleteTree removes the keys under a prefix
+func (c *ConsulStorage) deleteTree(ctx context.Context, prefix string) error {
+	return c.breaker.do(ctx, c.opts.Timeout, c.opts.Retries, func(ctx context.Context) error {
+		_, err := c.client.KV().DeleteTree(prefix, (&consulapi.WriteOptions{}).WithContext(ctx))
+		return err
+	})
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsul serves the parts of the Consul KV and transaction APIs that
+// ConsulStorage uses, from a map
+type fakeConsul struct {
+	mu      sync.Mutex
+	kv      map[string][]byte
+	indexes map[string]uint64 // modify index of each key written through the API
+	index   uint64
+	gets    int // reads of single keys
+
+	// beforeTxn, if set, is called before a transaction is applied
+	beforeTxn func()
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *ConsulStorage) {
+	t.Helper()
+	f := &fakeConsul{kv: map[string][]byte{}, indexes: map[string]uint64{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	store, err := NewConsulStorage(srv.URL, "", "test", ConsulOptions{Timeout: time.Second})
+	require.NoError(t, err)
+	return f, store
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("X-Consul-Index", "1")
+
+	if r.URL.Path == "/v1/txn" {
+		var ops consulapi.TxnOps
+		if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if f.beforeTxn != nil {
+			f.beforeTxn()
+		}
+		for _, op := range ops {
+			if op.KV.Verb == consulapi.KVCAS && f.indexes[op.KV.Key] != op.KV.Index {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(consulapi.TxnResponse{Errors: consulapi.TxnErrors{{What: "index mismatch"}}})
+				return
+			}
+		}
+		for _, op := range ops {
+			f.apply(op.KV.Verb, op.KV.Key, op.KV.Value)
+		}
+		json.NewEncoder(w).Encode(consulapi.TxnResponse{})
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		var pairs consulapi.KVPairs
+		var keys []string
+		for k, v := range f.kv {
+			if k == key || (query.Has("recurse") || query.Has("keys")) && strings.HasPrefix(k, key) {
+				pairs = append(pairs, &consulapi.KVPair{Key: k, Value: v, ModifyIndex: f.indexes[k]})
+				keys = append(keys, k)
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if query.Has("keys") {
+			json.NewEncoder(w).Encode(keys)
+			return
+		}
+		if !query.Has("recurse") {
+			f.gets++
+		}
+		json.NewEncoder(w).Encode(pairs)
+	case http.MethodPut:
+		value, _ := io.ReadAll(r.Body)
+		f.apply(consulapi.KVSet, key, value)
+		w.Write([]byte("true"))
+	case http.MethodDelete:
+		verb := consulapi.KVDelete
+		if query.Has("recurse") {
+			verb = consulapi.KVDeleteTree
+		}
+		f.apply(verb, key, nil)
+		w.Write([]byte("true"))
+	}
+}
+
+func (f *fakeConsul) apply(verb consulapi.KVOp, key string, value []byte) {
+	switch verb {
+	case consulapi.KVSet, consulapi.KVCAS:
+		f.index++
+		f.kv[key] = value
+		f.indexes[key] = f.index
+	case consulapi.KVDelete:
+		delete(f.kv, key)
+		delete(f.indexes, key)
+	case consulapi.KVDeleteTree:
+		for k := range f.kv {
+			if strings.HasPrefix(k, key) {
+				delete(f.kv, k)
+				delete(f.indexes, k)
+			}
+		}
+	}
+}
+
+func (f *fakeConsul) keys(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.kv {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestConsulStorage_StatusIndex(t *testing.T) {
+	f, store := newFakeConsul(t)
+	ctx := context.Background()
+
+	created := time.Now()
+	for i, status := range []client.ExecutionStatus{
+		client.StatusCompleted, client.StatusRunning, client.StatusPending, client.StatusFailed, client.StatusCompleted,
+	} {
+		require.NoError(t, store.Create(ctx, &Execution{
+			ID:        "exe_" + string(rune('1'+i)),
+			Status:    status,
+			CreatedAt: created.Add(time.Duration(i) * time.Second),
+		}))
+	}
+	assert.Equal(t, []string{"test/status/pending/exe_3", "test/status/running/exe_2"}, f.keys("test/status/"))
+
+	// An execution leaves the index as it finishes
+	exec, err := store.Get(ctx, "exe_2")
+	require.NoError(t, err)
+	exec.Status = client.StatusCompleted
+	require.NoError(t, store.Update(ctx, exec))
+	assert.Equal(t, []string{"test/status/pending/exe_3"}, f.keys("test/status/"))
+
+	ids := func(execs []*Execution) []string {
+		var ids []string
+		for _, exec := range execs {
+			ids = append(ids, exec.ID)
+		}
+		return ids
+	}
+
+	// Searching indexed statuses reads only their executions
+	f.gets = 0
+	found, err := store.Search(ctx, &Query{Statuses: []client.ExecutionStatus{client.StatusPending, client.StatusRunning}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exe_3"}, ids(found))
+	assert.Equal(t, 1, f.gets) // exe_3
+
+	// Any other status reads every execution
+	found, err = store.Search(ctx, &Query{Statuses: []client.ExecutionStatus{client.StatusCompleted, client.StatusPending}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exe_5", "exe_3", "exe_2", "exe_1"}, ids(found))
+
+	status := client.StatusPending
+	listed, err := store.List(ctx, &status)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"exe_3"}, ids(listed))
+
+	require.NoError(t, store.Delete(ctx, "exe_3"))
+	assert.Empty(t, f.keys("test/status/"))
+}
+
+func TestConsulStorage_StatusIndexBuild(t *testing.T) {
+	f, store := newFakeConsul(t)
+	ctx := context.Background()
+
+	// Executions stored before the index existed
+	for id, status := range map[string]client.ExecutionStatus{
+		"exe_1": client.StatusRunning,
+		"exe_2": client.StatusCompleted,
+		"exe_3": client.StatusAwaitingApproval,
+	} {
+		data, err := json.Marshal(&Execution{ID: id, Status: status})
+		require.NoError(t, err)
+		f.kv["test/executions/"+id] = data
+	}
+
+	status := client.StatusRunning
+	listed, err := store.List(ctx, &status)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "exe_1", listed[0].ID)
+	assert.Equal(t, []string{"test/status/awaiting_approval/exe_3", "test/status/running/exe_1"}, f.keys("test/status/"))
+	assert.Equal(t, []string{"test/indexes/status"}, f.keys("test/indexes/"))
+
+	// A stale entry, as one written while building the index alongside an
+	// update can be, is skipped
+	f.kv["test/status/running/exe_2"] = nil
+	listed, err = store.List(ctx, &status)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, "exe_1", listed[0].ID)
+}
+
+func TestConsulStorage_Modify(t *testing.T) {
+	f, store := newFakeConsul(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.Create(ctx, &Execution{ID: "exe_1", Status: client.StatusRunning, Caller: "key:ci"}))
+
+	// A write that lands between the read and the check-and-set makes fn
+	// run again on the new version
+	calls := 0
+	f.beforeTxn = func() {
+		f.beforeTxn = nil
+		data, _ := json.Marshal(&Execution{ID: "exe_1", Status: client.StatusCompleted, Caller: "key:ci"})
+		f.apply(consulapi.KVSet, "test/executions/exe_1", data)
+		delete(f.kv, "test/active/key:ci/exe_1")
+		delete(f.kv, "test/status/running/exe_1")
+	}
+	errFinished := errors.New("finished")
+	_, err := store.Modify(ctx, "exe_1", func(exec *Execution) error {
+		calls++
+		if exec.Status != client.StatusRunning {
+			return errFinished
+		}
+		exec.Progress = &client.Progress{Message: "halfway"}
+		return nil
+	})
+	assert.ErrorIs(t, err, errFinished)
+	assert.Equal(t, 2, calls)
+
+	exec, err := store.Get(ctx, "exe_1")
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusCompleted, exec.Status)
+	assert.Nil(t, exec.Progress)
+	assert.Empty(t, f.keys("test/status/"))
+
+	// Without one, the result is stored with its index entries
+	exec, err = store.Modify(ctx, "exe_1", func(exec *Execution) error {
+		exec.Status = client.StatusPending
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusPending, exec.Status)
+	assert.Equal(t, []string{"test/status/pending/exe_1"}, f.keys("test/status/"))
+	assert.Equal(t, []string{"test/active/key:ci/exe_1"}, f.keys("test/active/"))
+
+	_, err = store.Modify(ctx, "exe_2", func(*Execution) error { return nil })
+	assert.Error(t, err)
+}
@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Coordinator is implemented by storage backends shared between server
+// replicas. It lets periodic maintenance run on one replica per interval
+// instead of on every replica at once.
+type Coordinator interface {
+	// RunExclusive runs fn unless another instance holds the task's lock or
+	// ran it within the interval. It reports whether fn was run.
+	RunExclusive(ctx context.Context, task string, interval time.Duration, fn func(ctx context.Context) error) (bool, error)
+}
+
+// RunExclusive runs fn through the store's Coordinator if it has one.
+// Backends local to a single instance simply run fn.
+func RunExclusive(ctx context.Context, store Storage, task string, interval time.Duration, fn func(ctx context.Context) error) (bool, error) {
+	if coord, ok := store.(Coordinator); ok {
+		return coord.RunExclusive(ctx, task, interval, fn)
+	}
+	return true, fn(ctx)
+}
@@ -2,28 +2,67 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/geraldthewes/python-executor/pkg/client"
 )
 
+// ErrTemplateNotFound is returned (wrapped) for templates that don't exist
+var ErrTemplateNotFound = errors.New("template not found")
+
+// ErrArtifactNotFound is returned (wrapped) for artifact contents that
+// aren't stored
+var ErrArtifactNotFound = errors.New("artifact not found")
+
 // Execution represents a stored execution state
 type Execution struct {
-	ID          string
-	Status      client.ExecutionStatus
-	Metadata    *client.Metadata
-	Stdout      string
-	Stderr      string
-	ExitCode    int
-	Error       string
-	ErrorType   string  // Python error type (e.g., "SyntaxError", "NameError")
-	ErrorLine   int     // Line number where error occurred
-	Result      *string // REPL-style result of last expression
-	StartedAt   *time.Time
-	FinishedAt  *time.Time
-	DurationMs  int64
-	ContainerID string // Docker container ID for running executions
-	CreatedAt   time.Time
+	ID                    string
+	Status                client.ExecutionStatus
+	Phase                 client.ExecutionPhase // stage of a running execution
+	Metadata              *client.Metadata
+	Stdout                string
+	Stderr                string
+	StdoutTimes           []time.Time // emission time of each Stdout line
+	StderrTimes           []time.Time // emission time of each Stderr line
+	Output                string      // stdout and stderr interleaved, if requested
+	ExitCode              int
+	Error                 string
+	ErrorType             string // Python error type (e.g., "SyntaxError", "NameError")
+	ErrorLine             int    // Line number where error occurred
+	Traceback             []client.TracebackFrame
+	Signal                string // signal that terminated the script (e.g. "SIGKILL")
+	Termination           client.TerminationReason
+	ApprovalReason        string          // the approval rule that held the execution, if any
+	Result                *string         // REPL-style result of last expression
+	StructuredOutput      json.RawMessage // contents of the script's result.json
+	StructuredOutputError string
+	Tests                 *client.TestReport // parsed pytest results in pytest mode
+	Coverage              *client.CoverageReport
+	Artifacts             []client.Artifact // images and coverage reports inline; others by URL, stored with PutArtifact
+	StartedAt             *time.Time
+	FinishedAt            *time.Time
+	DurationMs            int64
+	PausedAt              *time.Time // when the execution was suspended, nil unless it is
+	PausedMs              int64      // time spent suspended, not counting a suspension going on
+	Checkpoint            string     // checkpoint to restore the suspended execution from, if any
+	CheckpointedAt        *time.Time
+	CPU                   *client.CPUUsage
+	Timings               *client.Timings
+	ContainerID           string // Docker container ID for running executions
+	Node                  string // ID of the server instance running the execution, or that accepted it until one does
+	Progress              *client.Progress
+	ProgressToken         string // secret the container uses to report progress
+	Install               *client.InstallResult
+	Detected              []string // packages added to the requirements by import detection
+	Manifest              *client.Manifest
+	Attempts              []client.Attempt // failed attempts before the current one
+	Tenant                string           // who submitted the execution, for usage accounting
+	APIKeyName            string           // name of the API key it was submitted with, if any
+	Caller                string           // who submitted it, for concurrency quotas: "key:<name>" or "ip:<address>"
+	TraceID               string           // request ID of the submission, passed to the container
+	CreatedAt             time.Time
 }
 
 // Storage defines the interface for execution state storage
@@ -37,15 +76,62 @@ type Storage interface {
 	// Update updates an existing execution
 	Update(ctx context.Context, exec *Execution) error
 
+	// Modify applies fn to an execution and stores the result, unless fn
+	// returns an error, which Modify returns as is. The write takes effect
+	// only if the execution wasn't changed since it was read; otherwise fn
+	// is applied again to the new version.
+	Modify(ctx context.Context, id string, fn func(exec *Execution) error) (*Execution, error)
+
 	// Delete removes an execution
 	Delete(ctx context.Context, id string) error
 
 	// List returns all executions (optionally filtered by status)
 	List(ctx context.Context, status *client.ExecutionStatus) ([]*Execution, error)
 
+	// Search returns the executions matching a query, newest first
+	Search(ctx context.Context, q *Query) ([]*Execution, error)
+
+	// CountActive counts the pending and running executions submitted by
+	// caller, from an index rather than by reading every execution
+	CountActive(ctx context.Context, caller string) (int, error)
+
 	// Cleanup removes executions older than the given duration
 	Cleanup(ctx context.Context, olderThan time.Duration) error
 
+	// PutArtifact stores the contents of an execution's artifact apart
+	// from its record, which holds only the artifact's metadata. They are
+	// removed with the execution.
+	PutArtifact(ctx context.Context, execID, name string, data []byte) error
+
+	// GetArtifact returns the contents of an execution's artifact, or
+	// ErrArtifactNotFound
+	GetArtifact(ctx context.Context, execID, name string) ([]byte, error)
+
+	// AddUsage adds delta to a tenant's usage in a period
+	AddUsage(ctx context.Context, tenant, period string, delta *client.Usage) error
+
+	// GetUsage returns a tenant's usage in a period, zero if it has none
+	GetUsage(ctx context.Context, tenant, period string) (*client.Usage, error)
+
+	// ListUsage returns the usage of every tenant with usage in a period
+	ListUsage(ctx context.Context, period string) ([]*client.Usage, error)
+
+	// Stats counts the stored executions by status and reports the oldest
+	// and their total size
+	Stats(ctx context.Context) (*client.StorageStats, error)
+
+	// PutTemplate stores a template, replacing any of the same name
+	PutTemplate(ctx context.Context, t *client.Template) error
+
+	// GetTemplate returns a template by name, or ErrTemplateNotFound
+	GetTemplate(ctx context.Context, name string) (*client.Template, error)
+
+	// ListTemplates returns every template
+	ListTemplates(ctx context.Context) ([]*client.Template, error)
+
+	// DeleteTemplate removes a template, or returns ErrTemplateNotFound
+	DeleteTemplate(ctx context.Context, name string) error
+
 	// Close closes the storage backend
 	Close() error
 }
@@ -53,17 +139,110 @@ type Storage interface {
 // ToExecutionResult converts a storage Execution to a client ExecutionResult
 func (e *Execution) ToExecutionResult() *client.ExecutionResult {
 	return &client.ExecutionResult{
-		ExecutionID: e.ID,
-		Status:      e.Status,
-		Stdout:      e.Stdout,
-		Stderr:      e.Stderr,
-		ExitCode:    e.ExitCode,
-		Error:       e.Error,
-		ErrorType:   e.ErrorType,
-		ErrorLine:   e.ErrorLine,
-		StartedAt:   e.StartedAt,
-		FinishedAt:  e.FinishedAt,
-		DurationMs:  e.DurationMs,
-		Result:      e.Result,
+		ExecutionID:           e.ID,
+		GroupID:               groupID(e.Metadata),
+		Labels:                labels(e.Metadata),
+		TraceID:               e.TraceID,
+		Status:                e.Status,
+		Phase:                 e.Phase,
+		Stdout:                e.Stdout,
+		Stderr:                e.Stderr,
+		Output:                e.Output,
+		ExitCode:              e.ExitCode,
+		Error:                 e.Error,
+		ErrorType:             e.ErrorType,
+		ErrorLine:             e.ErrorLine,
+		Traceback:             e.Traceback,
+		Signal:                e.Signal,
+		TerminationReason:     e.Termination,
+		ApprovalReason:        e.ApprovalReason,
+		StartedAt:             e.StartedAt,
+		FinishedAt:            e.FinishedAt,
+		DurationMs:            e.DurationMs,
+		PausedAt:              e.PausedAt,
+		PausedMs:              e.PausedMs,
+		CheckpointedAt:        e.CheckpointedAt,
+		CPU:                   e.CPU,
+		Timings:               e.Timings,
+		Result:                e.Result,
+		StructuredOutput:      e.StructuredOutput,
+		StructuredOutputError: e.StructuredOutputError,
+		Tests:                 e.Tests,
+		Coverage:              e.Coverage,
+		Artifacts:             inlineArtifacts(e.Artifacts),
+		Progress:              e.Progress,
+		Install:               e.Install,
+		Manifest:              e.Manifest,
+		Attempts:              e.Attempts,
+	}
+}
+
+// active reports whether an execution counts against its caller's
+// concurrency quota
+func (e *Execution) active() bool {
+	return e.Caller != "" && (e.Status == client.StatusPending || e.Status == client.StatusRunning)
+}
+
+// inlineArtifacts returns artifacts as they appear in a result: those with
+// a URL are downloaded separately, so their data is left out
+func inlineArtifacts(artifacts []client.Artifact) []client.Artifact {
+	if artifacts == nil {
+		return nil
+	}
+	inline := make([]client.Artifact, len(artifacts))
+	for i, a := range artifacts {
+		if a.URL != "" {
+			a.Data = nil
+		}
+		inline[i] = a
+	}
+	return inline
+}
+
+// addUsage adds delta's counters to u
+func addUsage(u, delta *client.Usage) {
+	u.Executions += delta.Executions
+	u.Failures += delta.Failures
+	u.DurationMs += delta.DurationMs
+	u.CPUSeconds += delta.CPUSeconds
+	u.MemoryMBSeconds += delta.MemoryMBSeconds
+}
+
+// newStats returns statistics of an empty storage
+func newStats() *client.StorageStats {
+	return &client.StorageStats{ByStatus: make(map[client.ExecutionStatus]int)}
+}
+
+// addStats counts an execution whose record takes size bytes into stats
+func addStats(stats *client.StorageStats, exec *Execution, size int) {
+	stats.Executions++
+	stats.ByStatus[exec.Status]++
+	stats.Bytes += int64(size)
+	if stats.Oldest == nil || exec.CreatedAt.Before(*stats.Oldest) {
+		createdAt := exec.CreatedAt.UTC()
+		stats.Oldest = &createdAt
+	}
+	if exec.Status.IsTerminal() && exec.StartedAt != nil {
+		stats.Finished++
+		stats.DurationMs += exec.DurationMs
+		if exec.Status != client.StatusCompleted || exec.ExitCode != 0 || exec.Error != "" {
+			stats.Failures++
+		}
+	}
+}
+
+// groupID returns the group an execution was submitted to
+func groupID(meta *client.Metadata) string {
+	if meta == nil {
+		return ""
+	}
+	return meta.GroupID
+}
+
+// labels returns the labels an execution was submitted with
+func labels(meta *client.Metadata) map[string]string {
+	if meta == nil {
+		return nil
 	}
+	return meta.Labels
 }
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -9,16 +11,25 @@ import (
 	"github.com/geraldthewes/python-executor/pkg/client"
 )
 
-// MemoryStorage implements in-memory storage with mutex protection
+// MemoryStorage implements in-memory storage with mutex protection.
+// Records are copied on the way in and out so callers never share state.
 type MemoryStorage struct {
 	mu         sync.RWMutex
 	executions map[string]*Execution
+	index      map[string]map[string]struct{} // execution IDs by status, label and active caller term
+	usage      map[string]*client.Usage       // by period and tenant
+	templates  map[string]*client.Template
+	artifacts  map[string]map[string][]byte // artifact contents by execution ID and name
 }
 
 // NewMemoryStorage creates a new in-memory storage backend
 func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		executions: make(map[string]*Execution),
+		index:      make(map[string]map[string]struct{}),
+		usage:      make(map[string]*client.Usage),
+		templates:  make(map[string]*client.Template),
+		artifacts:  make(map[string]map[string][]byte),
 	}
 }
 
@@ -31,7 +42,7 @@ func (m *MemoryStorage) Create(ctx context.Context, exec *Execution) error {
 		return fmt.Errorf("execution %s already exists", exec.ID)
 	}
 
-	m.executions[exec.ID] = exec
+	m.put(exec)
 	return nil
 }
 
@@ -45,7 +56,7 @@ func (m *MemoryStorage) Get(ctx context.Context, id string) (*Execution, error)
 		return nil, fmt.Errorf("execution %s not found", id)
 	}
 
-	return exec, nil
+	return copyExecution(exec), nil
 }
 
 // Update updates an existing execution
@@ -53,20 +64,41 @@ func (m *MemoryStorage) Update(ctx context.Context, exec *Execution) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, exists := m.executions[exec.ID]; !exists {
+	old, exists := m.executions[exec.ID]
+	if !exists {
 		return fmt.Errorf("execution %s not found", exec.ID)
 	}
 
-	m.executions[exec.ID] = exec
+	m.unindex(old)
+	m.put(exec)
 	return nil
 }
 
+// Modify applies fn to an execution and stores the result
+func (m *MemoryStorage) Modify(ctx context.Context, id string, fn func(exec *Execution) error) (*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, exists := m.executions[id]
+	if !exists {
+		return nil, fmt.Errorf("execution %s not found", id)
+	}
+
+	exec := copyExecution(old)
+	if err := fn(exec); err != nil {
+		return nil, err
+	}
+	m.unindex(old)
+	m.put(exec)
+	return copyExecution(exec), nil
+}
+
 // Delete removes an execution
 func (m *MemoryStorage) Delete(ctx context.Context, id string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	delete(m.executions, id)
+	m.remove(id)
 	return nil
 }
 
@@ -79,13 +111,64 @@ func (m *MemoryStorage) List(ctx context.Context, status *client.ExecutionStatus
 
 	for _, exec := range m.executions {
 		if status == nil || exec.Status == *status {
-			result = append(result, exec)
+			result = append(result, copyExecution(exec))
+		}
+	}
+
+	return result, nil
+}
+
+// Search returns the executions matching a query, newest first. A query
+// on labels or a single status only looks at the executions indexed under
+// its most selective term.
+func (m *MemoryStorage) Search(ctx context.Context, q *Query) ([]*Execution, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var terms []string
+	for key, value := range q.Labels {
+		terms = append(terms, labelTerm(key, value))
+	}
+	if len(q.Statuses) == 1 {
+		terms = append(terms, statusTerm(q.Statuses[0]))
+	}
+
+	var candidates map[string]struct{}
+	for i, term := range terms {
+		if ids := m.index[term]; i == 0 || len(ids) < len(candidates) {
+			candidates = ids
+		}
+	}
+
+	var result []*Execution
+	match := func(exec *Execution) {
+		if q.Matches(exec) {
+			result = append(result, copyExecution(exec))
+		}
+	}
+	if terms == nil {
+		for _, exec := range m.executions {
+			match(exec)
+		}
+	} else {
+		for id := range candidates {
+			match(m.executions[id])
 		}
 	}
 
+	sortNewestFirst(result)
 	return result, nil
 }
 
+// CountActive counts the pending and running executions submitted by
+// caller
+func (m *MemoryStorage) CountActive(ctx context.Context, caller string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.index[callerTerm(caller)]), nil
+}
+
 // Cleanup removes executions older than the given duration
 func (m *MemoryStorage) Cleanup(ctx context.Context, olderThan time.Duration) error {
 	m.mu.Lock()
@@ -94,13 +177,11 @@ func (m *MemoryStorage) Cleanup(ctx context.Context, olderThan time.Duration) er
 	cutoff := time.Now().Add(-olderThan)
 
 	for id, exec := range m.executions {
-		// Only cleanup completed/failed/killed executions
-		if exec.Status == client.StatusCompleted ||
-			exec.Status == client.StatusFailed ||
-			exec.Status == client.StatusKilled {
+		// Only cleanup executions in a terminal state
+		if exec.Status.IsTerminal() {
 
 			if exec.CreatedAt.Before(cutoff) {
-				delete(m.executions, id)
+				m.remove(id)
 			}
 		}
 	}
@@ -108,7 +189,209 @@ func (m *MemoryStorage) Cleanup(ctx context.Context, olderThan time.Duration) er
 	return nil
 }
 
+// PutArtifact stores the contents of an execution's artifact
+func (m *MemoryStorage) PutArtifact(ctx context.Context, execID, name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.executions[execID]; !exists {
+		return fmt.Errorf("execution %s not found", execID)
+	}
+	if m.artifacts[execID] == nil {
+		m.artifacts[execID] = make(map[string][]byte)
+	}
+	m.artifacts[execID][name] = bytes.Clone(data)
+	return nil
+}
+
+// GetArtifact returns the contents of an execution's artifact
+func (m *MemoryStorage) GetArtifact(ctx context.Context, execID, name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, exists := m.artifacts[execID][name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s of execution %s", ErrArtifactNotFound, name, execID)
+	}
+	return bytes.Clone(data), nil
+}
+
+// AddUsage adds delta to a tenant's usage in a period
+func (m *MemoryStorage) AddUsage(ctx context.Context, tenant, period string, delta *client.Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := period + "/" + tenant
+	u, ok := m.usage[key]
+	if !ok {
+		u = &client.Usage{Tenant: tenant, Period: period}
+		m.usage[key] = u
+	}
+	addUsage(u, delta)
+	return nil
+}
+
+// GetUsage returns a tenant's usage in a period
+func (m *MemoryStorage) GetUsage(ctx context.Context, tenant, period string) (*client.Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if u, ok := m.usage[period+"/"+tenant]; ok {
+		cp := *u
+		return &cp, nil
+	}
+	return &client.Usage{Tenant: tenant, Period: period}, nil
+}
+
+// ListUsage returns the usage of every tenant with usage in a period
+func (m *MemoryStorage) ListUsage(ctx context.Context, period string) ([]*client.Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var result []*client.Usage
+	for _, u := range m.usage {
+		if u.Period == period {
+			cp := *u
+			result = append(result, &cp)
+		}
+	}
+	return result, nil
+}
+
+// Stats counts the stored executions. Their size is that of the JSON
+// records Consul would store.
+func (m *MemoryStorage) Stats(ctx context.Context) (*client.StorageStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := newStats()
+	for _, exec := range m.executions {
+		data, err := json.Marshal(exec)
+		if err != nil {
+			return nil, fmt.Errorf("marshaling execution: %w", err)
+		}
+		addStats(stats, exec, len(data))
+	}
+	return stats, nil
+}
+
+// PutTemplate stores a template, replacing any of the same name
+func (m *MemoryStorage) PutTemplate(ctx context.Context, t *client.Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := *t
+	m.templates[t.Name] = &cp
+	return nil
+}
+
+// GetTemplate returns a template by name
+func (m *MemoryStorage) GetTemplate(ctx context.Context, name string) (*client.Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	t, ok := m.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	cp := *t
+	return &cp, nil
+}
+
+// ListTemplates returns every template
+func (m *MemoryStorage) ListTemplates(ctx context.Context) ([]*client.Template, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]*client.Template, 0, len(m.templates))
+	for _, t := range m.templates {
+		cp := *t
+		result = append(result, &cp)
+	}
+	return result, nil
+}
+
+// DeleteTemplate removes a template
+func (m *MemoryStorage) DeleteTemplate(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.templates[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	delete(m.templates, name)
+	return nil
+}
+
 // Close is a no-op for memory storage
 func (m *MemoryStorage) Close() error {
 	return nil
 }
+
+// put stores a copy of an execution and indexes it. The caller holds the
+// write lock and has unindexed any previous version.
+func (m *MemoryStorage) put(exec *Execution) {
+	cp := copyExecution(exec)
+	m.executions[exec.ID] = cp
+	for _, term := range indexTerms(cp) {
+		ids, ok := m.index[term]
+		if !ok {
+			ids = make(map[string]struct{})
+			m.index[term] = ids
+		}
+		ids[cp.ID] = struct{}{}
+	}
+}
+
+// remove deletes an execution and its index entries. The caller holds the
+// write lock.
+func (m *MemoryStorage) remove(id string) {
+	if exec, ok := m.executions[id]; ok {
+		m.unindex(exec)
+		delete(m.executions, id)
+	}
+	delete(m.artifacts, id)
+}
+
+// unindex removes an execution's index entries
+func (m *MemoryStorage) unindex(exec *Execution) {
+	for _, term := range indexTerms(exec) {
+		delete(m.index[term], exec.ID)
+		if len(m.index[term]) == 0 {
+			delete(m.index, term)
+		}
+	}
+}
+
+// indexTerms returns the index terms an execution is found under
+func indexTerms(exec *Execution) []string {
+	terms := []string{statusTerm(exec.Status)}
+	for key, value := range labels(exec.Metadata) {
+		terms = append(terms, labelTerm(key, value))
+	}
+	if exec.active() {
+		terms = append(terms, callerTerm(exec.Caller))
+	}
+	return terms
+}
+
+// statusTerm is the index term of executions in a status
+func statusTerm(status client.ExecutionStatus) string {
+	return "status:" + string(status)
+}
+
+// callerTerm is the index term of a caller's active executions
+func callerTerm(caller string) string {
+	return "caller:" + caller
+}
+
+// labelTerm is the index term of executions with a label
+func labelTerm(key, value string) string {
+	return "label:" + key + "=" + value
+}
+
+// copyExecution returns a shallow copy of an execution record
+func copyExecution(exec *Execution) *Execution {
+	cp := *exec
+	return &cp
+}
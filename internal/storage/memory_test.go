@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -74,6 +75,36 @@ func TestMemoryStorage_Update(t *testing.T) {
 	assert.Equal(t, client.StatusRunning, retrieved.Status)
 }
 
+func TestMemoryStorage_Modify(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	require.NoError(t, store.Create(ctx, &Execution{ID: "test-1", Status: client.StatusPending, Caller: "ip:1.2.3.4"}))
+
+	// An error from fn leaves the execution as it was
+	errRunning := errors.New("not running")
+	_, err := store.Modify(ctx, "test-1", func(exec *Execution) error {
+		exec.Status = client.StatusCancelled
+		return errRunning
+	})
+	assert.ErrorIs(t, err, errRunning)
+
+	retrieved, err := store.Get(ctx, "test-1")
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusPending, retrieved.Status)
+
+	// Otherwise the result is stored and reindexed
+	modified, err := store.Modify(ctx, "test-1", func(exec *Execution) error {
+		exec.Status = client.StatusCancelled
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusCancelled, modified.Status)
+	active, err := store.CountActive(ctx, "ip:1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, 0, active)
+}
+
 func TestMemoryStorage_Delete(t *testing.T) {
 	store := NewMemoryStorage()
 	ctx := context.Background()
@@ -170,3 +201,234 @@ func TestMemoryStorage_Cleanup(t *testing.T) {
 	_, err = store.Get(ctx, "running-1")
 	assert.NoError(t, err)
 }
+
+func TestMemoryStorage_ReturnsCopies(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	exec := &Execution{
+		ID:        "test-1",
+		Status:    client.StatusRunning,
+		CreatedAt: time.Now(),
+	}
+	require.NoError(t, store.Create(ctx, exec))
+
+	// Mutating the caller's record must not affect storage until Update
+	exec.Status = client.StatusCompleted
+	retrieved, err := store.Get(ctx, "test-1")
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusRunning, retrieved.Status)
+
+	// Mutating a retrieved record must not affect storage either
+	retrieved.Status = client.StatusKilled
+	again, err := store.Get(ctx, "test-1")
+	require.NoError(t, err)
+	assert.Equal(t, client.StatusRunning, again.Status)
+}
+
+func TestRunExclusive_LocalStorageAlwaysRuns(t *testing.T) {
+	store := NewMemoryStorage()
+
+	calls := 0
+	for i := 0; i < 2; i++ {
+		ran, err := RunExclusive(context.Background(), store, "cleanup", time.Minute, func(ctx context.Context) error {
+			calls++
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, ran)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestMemoryStorage_Usage(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	// A tenant without usage has zero usage
+	usage, err := store.GetUsage(ctx, "team-a", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, &client.Usage{Tenant: "team-a", Period: "2026-10"}, usage)
+
+	delta := &client.Usage{Executions: 1, Failures: 1, DurationMs: 1500, CPUSeconds: 1.25, MemoryMBSeconds: 768}
+	require.NoError(t, store.AddUsage(ctx, "team-a", "2026-10", delta))
+	require.NoError(t, store.AddUsage(ctx, "team-a", "2026-10", delta))
+	require.NoError(t, store.AddUsage(ctx, "team-b", "2026-10", delta))
+
+	usage, err = store.GetUsage(ctx, "team-a", "2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, &client.Usage{
+		Tenant: "team-a", Period: "2026-10",
+		Executions: 2, Failures: 2, DurationMs: 3000, CPUSeconds: 2.5, MemoryMBSeconds: 1536,
+	}, usage)
+
+	// Returned records are copies
+	usage.Executions = 100
+	usage, _ = store.GetUsage(ctx, "team-a", "2026-10")
+	assert.Equal(t, int64(2), usage.Executions)
+
+	usage, _ = store.GetUsage(ctx, "team-a", "2026-11")
+	assert.Equal(t, int64(0), usage.Executions)
+
+	all, err := store.ListUsage(ctx, "2026-10")
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	all, err = store.ListUsage(ctx, "2026-10-16")
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestMemoryStorage_Templates(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	_, err := store.GetTemplate(ctx, "report")
+	assert.ErrorIs(t, err, ErrTemplateNotFound)
+
+	tmpl := &client.Template{
+		Name:              "report",
+		Params:            []client.TemplateParam{{Name: "day", Required: true}},
+		SimpleExecRequest: client.SimpleExecRequest{Code: "print('{{day}}')"},
+	}
+	require.NoError(t, store.PutTemplate(ctx, tmpl))
+
+	// Stored templates are copies
+	tmpl.Code = "changed"
+	got, err := store.GetTemplate(ctx, "report")
+	require.NoError(t, err)
+	assert.Equal(t, "print('{{day}}')", got.Code)
+
+	// Putting a template of the same name replaces it
+	require.NoError(t, store.PutTemplate(ctx, &client.Template{Name: "report", SimpleExecRequest: client.SimpleExecRequest{Code: "print(2)"}}))
+	require.NoError(t, store.PutTemplate(ctx, &client.Template{Name: "cleanup"}))
+	all, err := store.ListTemplates(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	got, _ = store.GetTemplate(ctx, "report")
+	assert.Equal(t, "print(2)", got.Code)
+
+	require.NoError(t, store.DeleteTemplate(ctx, "report"))
+	assert.ErrorIs(t, store.DeleteTemplate(ctx, "report"), ErrTemplateNotFound)
+	all, _ = store.ListTemplates(ctx)
+	assert.Len(t, all, 1)
+}
+
+func TestMemoryStorage_CountActive(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	for _, exec := range []*Execution{
+		{ID: "test-1", Status: client.StatusRunning, Caller: "key:ci"},
+		{ID: "test-2", Status: client.StatusPending, Caller: "key:ci"},
+		{ID: "test-3", Status: client.StatusCompleted, Caller: "key:ci"},
+		{ID: "test-4", Status: client.StatusRunning, Caller: "ip:10.0.0.1"},
+	} {
+		require.NoError(t, store.Create(ctx, exec))
+	}
+	n, err := store.CountActive(ctx, "key:ci")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Executions leave the count as they finish
+	require.NoError(t, store.Update(ctx, &Execution{ID: "test-1", Status: client.StatusKilled, Caller: "key:ci"}))
+	n, _ = store.CountActive(ctx, "key:ci")
+	assert.Equal(t, 1, n)
+	n, _ = store.CountActive(ctx, "key:batch")
+	assert.Equal(t, 0, n)
+}
+
+func TestMemoryStorage_Artifacts(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	assert.Error(t, store.PutArtifact(ctx, "test-1", "stdout.log", []byte("x")))
+	require.NoError(t, store.Create(ctx, &Execution{ID: "test-1", Status: client.StatusCompleted}))
+	_, err := store.GetArtifact(ctx, "test-1", "stdout.log")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+
+	data := []byte("full log")
+	require.NoError(t, store.PutArtifact(ctx, "test-1", "stdout.log", data))
+	data[0] = 'X'
+	got, err := store.GetArtifact(ctx, "test-1", "stdout.log")
+	require.NoError(t, err)
+	assert.Equal(t, "full log", string(got))
+
+	// Artifacts go with their execution
+	require.NoError(t, store.Delete(ctx, "test-1"))
+	_, err = store.GetArtifact(ctx, "test-1", "stdout.log")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+}
+
+func TestMemoryStorage_Stats(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	stats, err := store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Executions)
+	assert.Nil(t, stats.Oldest)
+
+	oldest := time.Now().Add(-time.Hour)
+	started := time.Now()
+	require.NoError(t, store.Create(ctx, &Execution{ID: "exec-1", Status: client.StatusCompleted, CreatedAt: oldest, StartedAt: &started, DurationMs: 1000}))
+	require.NoError(t, store.Create(ctx, &Execution{ID: "exec-2", Status: client.StatusCompleted, ExitCode: 1, CreatedAt: time.Now(), StartedAt: &started, DurationMs: 3000}))
+	require.NoError(t, store.Create(ctx, &Execution{ID: "exec-3", Status: client.StatusRunning, Stdout: "output", CreatedAt: time.Now(), StartedAt: &started}))
+
+	stats, err = store.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Executions)
+	assert.Equal(t, map[client.ExecutionStatus]int{client.StatusCompleted: 2, client.StatusRunning: 1}, stats.ByStatus)
+	require.NotNil(t, stats.Oldest)
+	assert.True(t, stats.Oldest.Equal(oldest))
+	assert.Greater(t, stats.Bytes, int64(0))
+
+	// Only finished executions count towards failures and duration
+	assert.Equal(t, 2, stats.Finished)
+	assert.Equal(t, 1, stats.Failures)
+	assert.Equal(t, int64(4000), stats.DurationMs)
+}
+
+func TestMemoryStorage_Search(t *testing.T) {
+	store := NewMemoryStorage()
+	ctx := context.Background()
+
+	now := time.Now()
+	nightly := map[string]string{"job": "nightly"}
+	for _, exec := range []*Execution{
+		{ID: "exec-1", Status: client.StatusCompleted, Metadata: &client.Metadata{Entrypoint: "report.py", Labels: nightly}, CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: "exec-2", Status: client.StatusFailed, Error: "ModuleNotFoundError: pandas", Metadata: &client.Metadata{Entrypoint: "main.py", Labels: nightly}, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "exec-3", Status: client.StatusRunning, Metadata: &client.Metadata{Entrypoint: "main.py", Labels: map[string]string{"job": "adhoc"}}, APIKeyName: "ci", CreatedAt: now.Add(-time.Hour)},
+		{ID: "exec-4", Status: client.StatusPending, APIKeyName: "ci", CreatedAt: now},
+	} {
+		require.NoError(t, store.Create(ctx, exec))
+	}
+
+	ids := func(q Query) []string {
+		execs, err := store.Search(ctx, &q)
+		require.NoError(t, err)
+		var result []string
+		for _, exec := range execs {
+			result = append(result, exec.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"exec-4", "exec-3", "exec-2", "exec-1"}, ids(Query{}))
+	assert.Equal(t, []string{"exec-2", "exec-1"}, ids(Query{Labels: nightly}))
+	assert.Equal(t, []string{"exec-2"}, ids(Query{Labels: nightly, Statuses: []client.ExecutionStatus{client.StatusFailed}}))
+	assert.Equal(t, []string{"exec-3", "exec-2"}, ids(Query{Statuses: []client.ExecutionStatus{client.StatusFailed, client.StatusRunning}}))
+	assert.Equal(t, []string{"exec-3", "exec-2"}, ids(Query{Since: now.Add(-2 * time.Hour), Until: now}))
+	assert.Equal(t, []string{"exec-2"}, ids(Query{Text: "PANDAS"}))
+	assert.Equal(t, []string{"exec-1"}, ids(Query{Text: "report"}))
+	assert.Equal(t, []string{"exec-4", "exec-3"}, ids(Query{APIKeyName: "ci"}))
+	assert.Empty(t, ids(Query{Labels: map[string]string{"job": "weekly"}}))
+
+	// The index follows updates and deletes
+	exec, err := store.Get(ctx, "exec-3")
+	require.NoError(t, err)
+	exec.Status = client.StatusFailed
+	require.NoError(t, store.Update(ctx, exec))
+	require.NoError(t, store.Delete(ctx, "exec-2"))
+	assert.Equal(t, []string{"exec-3"}, ids(Query{Statuses: []client.ExecutionStatus{client.StatusFailed}}))
+	assert.Empty(t, ids(Query{Statuses: []client.ExecutionStatus{client.StatusRunning}}))
+}
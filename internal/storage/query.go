@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// Query selects executions by any combination of filters. Zero fields
+// match every execution.
+type Query struct {
+	// Statuses matches executions in any of the statuses
+	Statuses []client.ExecutionStatus
+	// Labels matches executions with every one of the labels
+	Labels map[string]string
+	// APIKeyName matches executions submitted with the API key
+	APIKeyName string
+	// Since and Until bound when executions were created: Since inclusive,
+	// Until exclusive
+	Since time.Time
+	Until time.Time
+	// Text matches executions whose entrypoint or error contains it,
+	// ignoring case
+	Text string
+}
+
+// Matches reports whether an execution passes every filter of the query
+func (q *Query) Matches(exec *Execution) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, exec.Status) {
+		return false
+	}
+	if q.APIKeyName != "" && exec.APIKeyName != q.APIKeyName {
+		return false
+	}
+	if !q.Since.IsZero() && exec.CreatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !exec.CreatedAt.Before(q.Until) {
+		return false
+	}
+	execLabels := labels(exec.Metadata)
+	for key, value := range q.Labels {
+		if v, ok := execLabels[key]; !ok || v != value {
+			return false
+		}
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		var entrypoint string
+		if exec.Metadata != nil {
+			entrypoint = exec.Metadata.Entrypoint
+		}
+		if !strings.Contains(strings.ToLower(entrypoint), text) && !strings.Contains(strings.ToLower(exec.Error), text) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortNewestFirst orders search results, most recently created first
+func sortNewestFirst(execs []*Execution) {
+	sort.Slice(execs, func(i, j int) bool {
+		if !execs[i].CreatedAt.Equal(execs[j].CreatedAt) {
+			return execs[i].CreatedAt.After(execs[j].CreatedAt)
+		}
+		return execs[i].ID < execs[j].ID
+	})
+}
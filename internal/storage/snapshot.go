@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// snapshotVersion is the version of the snapshot format written by Save
+const snapshotVersion = 1
+
+// memorySnapshot is the contents of a MemoryStorage snapshot file
+type memorySnapshot struct {
+	Version    int                `json:"version"`
+	SavedAt    time.Time          `json:"saved_at"`
+	Executions []*Execution       `json:"executions"`
+	Usage      []*client.Usage    `json:"usage"`
+	Templates  []*client.Template `json:"templates"`
+	// Artifacts holds artifact contents by execution ID and name
+	Artifacts map[string]map[string][]byte `json:"artifacts,omitempty"`
+}
+
+// Save writes the storage's contents to a JSON file. The file is replaced
+// with a rename, so a crash mid-save leaves the previous snapshot intact.
+func (m *MemoryStorage) Save(path string) error {
+	m.mu.RLock()
+	snap := memorySnapshot{
+		Version:    snapshotVersion,
+		SavedAt:    time.Now().UTC(),
+		Executions: make([]*Execution, 0, len(m.executions)),
+		Usage:      make([]*client.Usage, 0, len(m.usage)),
+		Templates:  make([]*client.Template, 0, len(m.templates)),
+		Artifacts:  m.artifacts,
+	}
+	for _, exec := range m.executions {
+		snap.Executions = append(snap.Executions, exec)
+	}
+	for _, u := range m.usage {
+		snap.Usage = append(snap.Usage, u)
+	}
+	for _, t := range m.templates {
+		snap.Templates = append(snap.Templates, t)
+	}
+	data, err := json.Marshal(&snap)
+	m.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("marshaling snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load replaces the storage's contents with a snapshot written by Save. It
+// returns an error satisfying errors.Is(err, fs.ErrNotExist) if there is no
+// snapshot yet, leaving the storage as it was.
+func (m *MemoryStorage) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var snap memorySnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("reading snapshot: unsupported version %d", snap.Version)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.executions = make(map[string]*Execution, len(snap.Executions))
+	m.index = make(map[string]map[string]struct{})
+	for _, exec := range snap.Executions {
+		if exec != nil && exec.ID != "" {
+			m.put(exec)
+		}
+	}
+	m.usage = make(map[string]*client.Usage, len(snap.Usage))
+	for _, u := range snap.Usage {
+		if u != nil {
+			m.usage[u.Period+"/"+u.Tenant] = u
+		}
+	}
+	m.templates = make(map[string]*client.Template, len(snap.Templates))
+	for _, t := range snap.Templates {
+		if t != nil && t.Name != "" {
+			m.templates[t.Name] = t
+		}
+	}
+	m.artifacts = make(map[string]map[string][]byte, len(snap.Artifacts))
+	for id, artifacts := range snap.Artifacts {
+		if _, ok := m.executions[id]; ok {
+			m.artifacts[id] = artifacts
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	store := NewMemoryStorage()
+	assert.ErrorIs(t, store.Load(path), fs.ErrNotExist)
+
+	labels := map[string]string{"job": "nightly"}
+	require.NoError(t, store.Create(ctx, &Execution{ID: "exec-1", Status: client.StatusCompleted, Stdout: "hello\n", Metadata: &client.Metadata{Labels: labels}, CreatedAt: time.Now()}))
+	require.NoError(t, store.AddUsage(ctx, "team-a", "2026-01", &client.Usage{Executions: 1}))
+	require.NoError(t, store.PutTemplate(ctx, &client.Template{Name: "report"}))
+	require.NoError(t, store.Save(path))
+
+	// Saving again replaces the file without leaving temporary files
+	require.NoError(t, store.Save(path))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	restored := NewMemoryStorage()
+	require.NoError(t, restored.Load(path))
+	exec, err := restored.Get(ctx, "exec-1")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", exec.Stdout)
+	usage, err := restored.GetUsage(ctx, "team-a", "2026-01")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), usage.Executions)
+	_, err = restored.GetTemplate(ctx, "report")
+	assert.NoError(t, err)
+
+	// The search index is rebuilt
+	found, err := restored.Search(ctx, &Query{Labels: labels})
+	require.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0o644))
+	assert.Error(t, restored.Load(path))
+}
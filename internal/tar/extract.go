@@ -3,17 +3,144 @@ package tar
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-// ExtractToDir extracts a tar archive to a directory with path sanitization
-func ExtractToDir(tarData []byte, destDir string) error {
+// Limits caps what an archive may extract to, protecting the disk from
+// archive bombs. Zero fields are unlimited.
+type Limits struct {
+	MaxTotalBytes int64 // sum of all file sizes
+	MaxFiles      int   // entries of any type, including directories
+	MaxFileBytes  int64 // size of any one file
+}
+
+// LimitError reports an archive that is over one of its Limits
+type LimitError struct {
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	return "archive exceeds extraction limits: " + e.Reason
+}
+
+// limitCounter tracks an archive's entries against Limits
+type limitCounter struct {
+	limits Limits
+	files  int
+	total  int64
+}
+
+// add counts an entry, failing with a *LimitError if it goes over a limit
+func (c *limitCounter) add(header *tar.Header) error {
+	c.files++
+	if c.limits.MaxFiles > 0 && c.files > c.limits.MaxFiles {
+		return &LimitError{Reason: fmt.Sprintf("more than %d files", c.limits.MaxFiles)}
+	}
+	if header.Typeflag != tar.TypeReg {
+		return nil
+	}
+
+	if c.limits.MaxFileBytes > 0 && header.Size > c.limits.MaxFileBytes {
+		return &LimitError{Reason: fmt.Sprintf("%s is %d bytes, over the %d byte file limit", header.Name, header.Size, c.limits.MaxFileBytes)}
+	}
+	c.total += header.Size
+	if c.limits.MaxTotalBytes > 0 && c.total > c.limits.MaxTotalBytes {
+		return &LimitError{Reason: fmt.Sprintf("more than %d bytes in total", c.limits.MaxTotalBytes)}
+	}
+	return nil
+}
+
+// MaxArchiveBytes returns the size of the largest tar archive whose
+// entries could be within l, allowing for each entry's headers and
+// padding, or 0 if l doesn't bound it
+func (l Limits) MaxArchiveBytes() int64 {
+	if l.MaxTotalBytes == 0 || l.MaxFiles == 0 {
+		return 0
+	}
+	// Long names can take extra header blocks, so allow 4KB per entry
+	return l.MaxTotalBytes + int64(l.MaxFiles+1)*4096
+}
+
+// IsGzip reports whether data starts with the gzip magic number
+func IsGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// Decompress returns data as an uncompressed tar archive, decompressing it
+// if it is gzipped (.tar.gz or .tgz). It fails with a *LimitError rather
+// than decompress more than max bytes, so a small upload can't expand
+// without bound; 0 means no limit.
+func Decompress(data []byte, max int64) ([]byte, error) {
+	if !IsGzip(data) {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip: %w", err)
+	}
+	defer zr.Close()
+
+	var r io.Reader = zr
+	if max > 0 {
+		r = io.LimitReader(zr, max+1)
+	}
+	tarData, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading gzip: %w", err)
+	}
+	if max > 0 && int64(len(tarData)) > max {
+		return nil, &LimitError{Reason: fmt.Sprintf("more than %d bytes once decompressed", max)}
+	}
+	return tarData, nil
+}
+
+// CheckLimits reads an archive's headers without extracting it and returns
+// a *LimitError if extracting it would go over limits
+func CheckLimits(tarData []byte, limits Limits) error {
+	reader := tar.NewReader(bytes.NewReader(tarData))
+	counter := limitCounter{limits: limits}
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %w", err)
+		}
+		if err := counter.add(header); err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractToDir extracts a tar archive to a directory with path sanitization.
+// It stops with a *LimitError as soon as the archive goes over limits,
+// leaving what was extracted so far for the caller to remove.
+//
+// Symlinks and hard links are extracted if they resolve inside destDir;
+// links that would reach outside it are rejected. Devices and other special
+// files are skipped.
+func ExtractToDir(tarData []byte, destDir string, limits Limits) error {
 	reader := tar.NewReader(bytes.NewReader(tarData))
+	counter := limitCounter{limits: limits}
 
+	// All writes go through root, so they can't follow a link out of destDir
+	root, err := os.OpenRoot(destDir)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", destDir, err)
+	}
+	defer root.Close()
+
+	var symlinks []string
 	for {
 		header, err := reader.Next()
 		if err == io.EOF {
@@ -22,6 +149,9 @@ func ExtractToDir(tarData []byte, destDir string) error {
 		if err != nil {
 			return fmt.Errorf("reading tar: %w", err)
 		}
+		if err := counter.add(header); err != nil {
+			return err
+		}
 
 		// Sanitize path - reject any path traversal attempts
 		if err := validatePath(header.Name); err != nil {
@@ -36,39 +166,95 @@ func ExtractToDir(tarData []byte, destDir string) error {
 			return fmt.Errorf("invalid path: %s (path traversal detected)", header.Name)
 		}
 
+		// Path relative to root
+		name := filepath.Clean(header.Name)
+
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// Create directory
-			if err := os.MkdirAll(targetPath, 0755); err != nil {
+			if err := root.MkdirAll(name, 0755); err != nil {
 				return fmt.Errorf("creating directory %s: %w", targetPath, err)
 			}
 
 		case tar.TypeReg:
 			// Create parent directory if needed
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
 				return fmt.Errorf("creating parent directory for %s: %w", targetPath, err)
 			}
 
 			// Create file
-			outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			outFile, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
 			if err != nil {
 				return fmt.Errorf("creating file %s: %w", targetPath, err)
 			}
 
-			// Copy file contents
-			if _, err := io.Copy(outFile, reader); err != nil {
+			// Copy file contents, no more than the header promised
+			if _, err := io.Copy(outFile, io.LimitReader(reader, header.Size)); err != nil {
 				outFile.Close()
 				return fmt.Errorf("writing file %s: %w", targetPath, err)
 			}
 
 			outFile.Close()
 
+			// The file's mode was masked by the umask, or left as it was if
+			// the file already existed
+			if err := root.Chmod(name, os.FileMode(header.Mode).Perm()); err != nil {
+				return fmt.Errorf("setting mode of %s: %w", targetPath, err)
+			}
+
+		case tar.TypeSymlink:
+			if err := validateSymlink(header.Name, header.Linkname); err != nil {
+				return err
+			}
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return fmt.Errorf("creating parent directory for %s: %w", targetPath, err)
+			}
+			if err := root.Symlink(header.Linkname, name); err != nil {
+				return fmt.Errorf("creating symlink %s: %w", targetPath, err)
+			}
+			symlinks = append(symlinks, name)
+
+		case tar.TypeLink:
+			// Hard link targets are other entries of the archive
+			if err := validatePath(header.Linkname); err != nil {
+				return err
+			}
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return fmt.Errorf("creating parent directory for %s: %w", targetPath, err)
+			}
+			if err := root.Link(filepath.Clean(header.Linkname), name); err != nil {
+				return fmt.Errorf("creating hard link %s: %w", targetPath, err)
+			}
+
 		default:
-			// Skip symlinks, devices, etc. for security
+			// Skip devices, FIFOs, etc. for security
 			continue
 		}
 	}
 
+	// A symlink target that stays inside destDir on paper can still leave
+	// it through another symlink, so resolve each one now that everything
+	// it may pass through exists. Targets that don't exist are allowed.
+	for _, name := range symlinks {
+		if _, err := root.Stat(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("invalid symlink: %s (%w)", name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateSymlink checks that a symlink's target is relative and, resolved
+// from the link's directory, inside the extraction root
+func validateSymlink(name, target string) error {
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return fmt.Errorf("invalid symlink: %s -> %s (absolute target not allowed)", name, target)
+	}
+
+	resolved := filepath.Join(filepath.Dir(filepath.Clean(name)), target)
+	if resolved == ".." || strings.HasPrefix(resolved, ".."+string(os.PathSeparator)) {
+		return fmt.Errorf("invalid symlink: %s -> %s (points outside the archive)", name, target)
+	}
 	return nil
 }
 
@@ -3,8 +3,10 @@ package tar
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -53,7 +55,7 @@ func TestExtractToDir(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(tmpDir)
 
-	err = ExtractToDir(buf.Bytes(), tmpDir)
+	err = ExtractToDir(buf.Bytes(), tmpDir, Limits{})
 	require.NoError(t, err)
 
 	// Verify files exist
@@ -69,6 +71,171 @@ func TestExtractToDir(t *testing.T) {
 	assert.FileExists(t, utilsPath)
 }
 
+func TestExtractToDir_Modes(t *testing.T) {
+	tarData := buildTar(t, []*tar.Header{
+		{Name: "main.py", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "bin/run.sh", Typeflag: tar.TypeReg, Mode: 0775},
+	}, map[string]string{"main.py": "print(1)", "bin/run.sh": "#!/bin/sh"})
+
+	tmpDir := t.TempDir()
+	require.NoError(t, ExtractToDir(tarData, tmpDir, Limits{}))
+
+	for name, want := range map[string]os.FileMode{"main.py": 0644, "bin/run.sh": 0775} {
+		info, err := os.Stat(filepath.Join(tmpDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, want, info.Mode().Perm(), name)
+	}
+}
+
+func TestExtractToDir_Limits(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a.py", "b.py", "c.py"} {
+		content := []byte("print('hello')")
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		wantErr bool
+	}{
+		{"unlimited", Limits{}, false},
+		{"within limits", Limits{MaxTotalBytes: 42, MaxFiles: 3, MaxFileBytes: 14}, false},
+		{"too many files", Limits{MaxFiles: 2}, true},
+		{"file too large", Limits{MaxFileBytes: 13}, true},
+		{"too many bytes", Limits{MaxTotalBytes: 41}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckLimits(buf.Bytes(), tt.limits)
+			extractErr := ExtractToDir(buf.Bytes(), t.TempDir(), tt.limits)
+
+			var limitErr *LimitError
+			if tt.wantErr {
+				assert.ErrorAs(t, err, &limitErr)
+				assert.ErrorAs(t, extractErr, &limitErr)
+			} else {
+				assert.NoError(t, err)
+				assert.NoError(t, extractErr)
+			}
+		})
+	}
+}
+
+// buildTar builds an archive from headers, writing content for regular files
+func buildTar(t *testing.T, headers []*tar.Header, content map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(content[h.Name]))
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(content[h.Name]))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestExtractToDir_Links(t *testing.T) {
+	tarData := buildTar(t, []*tar.Header{
+		{Name: "data/config.json", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "app/config.json", Typeflag: tar.TypeSymlink, Linkname: "../data/config.json"},
+		{Name: "resources", Typeflag: tar.TypeSymlink, Linkname: "data"},
+		{Name: "copy.json", Typeflag: tar.TypeLink, Linkname: "data/config.json"},
+		{Name: "later", Typeflag: tar.TypeSymlink, Linkname: "not/yet/there"},
+	}, map[string]string{"data/config.json": `{"ok": true}`})
+
+	tmpDir := t.TempDir()
+	require.NoError(t, ExtractToDir(tarData, tmpDir, Limits{}))
+
+	for _, name := range []string{"app/config.json", "resources/config.json", "copy.json"} {
+		data, err := os.ReadFile(filepath.Join(tmpDir, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, `{"ok": true}`, string(data), name)
+	}
+	target, err := os.Readlink(filepath.Join(tmpDir, "app/config.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "../data/config.json", target)
+}
+
+func TestExtractToDir_RejectsEscapingLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{"absolute symlink", []*tar.Header{
+			{Name: "passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		}},
+		{"relative symlink out", []*tar.Header{
+			{Name: "sub/link", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+		}},
+		{"escape through another symlink", []*tar.Header{
+			{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "here", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: "here/sub/up/../outside"},
+		}},
+		{"write through symlink", []*tar.Header{
+			{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "esc", Typeflag: tar.TypeSymlink, Linkname: "sub/up/.."},
+			{Name: "esc/outside.py", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"hard link out", []*tar.Header{
+			{Name: "link", Typeflag: tar.TypeLink, Linkname: "../outside"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(parent, "outside"), []byte("secret"), 0644))
+			destDir := filepath.Join(parent, "dest")
+			require.NoError(t, os.Mkdir(destDir, 0755))
+
+			err := ExtractToDir(buildTar(t, tt.headers, nil), destDir, Limits{})
+			assert.Error(t, err)
+			assert.NoFileExists(t, filepath.Join(parent, "outside.py"))
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	tarData := buildTar(t, []*tar.Header{
+		{Name: "main.py", Typeflag: tar.TypeReg, Mode: 0644},
+	}, map[string]string{"main.py": strings.Repeat("print(1)\n", 1000)})
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.True(t, IsGzip(buf.Bytes()))
+
+	got, err := Decompress(buf.Bytes(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, tarData, got)
+
+	// Uncompressed archives are returned as they are
+	got, err = Decompress(tarData, 0)
+	require.NoError(t, err)
+	assert.Equal(t, tarData, got)
+
+	var limitErr *LimitError
+	_, err = Decompress(buf.Bytes(), int64(len(tarData)-1))
+	assert.ErrorAs(t, err, &limitErr)
+}
+
 func TestValidatePath_RejectsTraversal(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -0,0 +1,159 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrArchiveNotFound is returned for an archive the cache doesn't hold
+var ErrArchiveNotFound = errors.New("archive not found")
+
+// archiveDir is the subdirectory of the store holding archives by hash
+const archiveDir = "archives"
+
+// isSHA256 reports whether sum is a hex SHA-256 digest, so that it can
+// name a file in the store
+func isSHA256(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
+
+// archivePath returns the cache file of the archive with the given hex
+// SHA-256, or ErrArchiveNotFound if sum isn't one
+func (s *Store) archivePath(sum string) (string, error) {
+	if !isSHA256(sum) {
+		return "", ErrArchiveNotFound
+	}
+	return filepath.Join(s.dir, archiveDir, sum+".tar"), nil
+}
+
+// PutArchive adds an archive to the cache, keyed by its SHA-256, and
+// returns the hex digest. Adding an archive that is already cached only
+// marks it as used.
+func (s *Store) PutArchive(data []byte) (string, error) {
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+	p, _ := s.archivePath(sum)
+
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err == nil {
+		return sum, nil
+	}
+
+	err := writeFile(p, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("caching archive: %w", err)
+	}
+	return sum, nil
+}
+
+// writeFile creates p with the contents written by write. The file is
+// written under a temporary name and renamed, so readers never see part
+// of it; if write fails nothing is left behind.
+func writeFile(p string, write func(*os.File) error) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// linkArchive adds a completed upload to the cache without copying it
+func (s *Store) linkArchive(tarPath, sum string) error {
+	p, _ := s.archivePath(sum)
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("creating archive cache: %w", err)
+	}
+	if err := os.Link(tarPath, p); err != nil && !errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("caching upload: %w", err)
+	}
+	return nil
+}
+
+// ArchiveSize returns the size of a cached archive, marking it as used so
+// that it isn't expired between a client finding it and executing it
+func (s *Store) ArchiveSize(sum string) (int64, error) {
+	p, err := s.archivePath(sum)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err != nil {
+		return 0, ErrArchiveNotFound
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, ErrArchiveNotFound
+	}
+	return info.Size(), nil
+}
+
+// Archive returns a cached archive by its hex SHA-256, marking it as used
+func (s *Store) Archive(sum string) ([]byte, error) {
+	p, err := s.archivePath(sum)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrArchiveNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return data, nil
+}
+
+// cleanupHashed deletes the files in a subdirectory of content stored by
+// hash that haven't been used for ttl, along with temporary files left by
+// interrupted writes
+func (s *Store) cleanupHashed(name string, ttl time.Duration) (int, error) {
+	dir := filepath.Join(s.dir, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("reading %s cache: %w", name, err)
+	}
+
+	deleted := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return deleted, fmt.Errorf("deleting from %s cache: %w", name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,86 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_ArchiveCache(t *testing.T) {
+	s := NewStore(t.TempDir(), 0)
+	data := []byte("archive contents")
+	digest := sha256.Sum256(data)
+	want := hex.EncodeToString(digest[:])
+
+	if _, err := s.Archive(want); !errors.Is(err, ErrArchiveNotFound) {
+		t.Fatalf("Archive() before Put error = %v, want ErrArchiveNotFound", err)
+	}
+
+	sum, err := s.PutArchive(data)
+	if err != nil || sum != want {
+		t.Fatalf("PutArchive() = %q, %v, want %q", sum, err, want)
+	}
+	if sum, err = s.PutArchive(data); err != nil || sum != want {
+		t.Errorf("PutArchive() again = %q, %v, want %q", sum, err, want)
+	}
+
+	if size, err := s.ArchiveSize(want); err != nil || size != int64(len(data)) {
+		t.Errorf("ArchiveSize() = %d, %v, want %d", size, err, len(data))
+	}
+	if got, err := s.Archive(want); err != nil || string(got) != string(data) {
+		t.Errorf("Archive() = %q, %v", got, err)
+	}
+
+	for _, sum := range []string{"", "abc", strings.Repeat("z", 64), "../" + want[3:]} {
+		if _, err := s.Archive(sum); !errors.Is(err, ErrArchiveNotFound) {
+			t.Errorf("Archive(%q) error = %v, want ErrArchiveNotFound", sum, err)
+		}
+	}
+}
+
+func TestStore_CompletedUploadsAreCached(t *testing.T) {
+	s := NewStore(t.TempDir(), 0)
+	u, _ := s.Create()
+	if _, err := s.Append(u.UploadID, 0, strings.NewReader("uploaded")); err != nil {
+		t.Fatal(err)
+	}
+	u, err := s.Complete(u.UploadID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cached copy outlives the upload
+	if err := s.Delete(u.UploadID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Archive(u.SHA256); err != nil || string(got) != "uploaded" {
+		t.Errorf("Archive() = %q, %v, want the upload", got, err)
+	}
+}
+
+func TestStore_CleanupArchives(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir, 0)
+	stale, _ := s.PutArchive([]byte("stale"))
+	fresh, _ := s.PutArchive([]byte("fresh"))
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, archiveDir, stale+".tar"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.Cleanup(time.Hour); err != nil || n != 1 {
+		t.Fatalf("Cleanup() = %d, %v, want 1", n, err)
+	}
+	if _, err := s.Archive(stale); !errors.Is(err, ErrArchiveNotFound) {
+		t.Errorf("Archive(stale) error = %v, want ErrArchiveNotFound", err)
+	}
+	if _, err := s.Archive(fresh); err != nil {
+		t.Errorf("Archive(fresh) error = %v", err)
+	}
+}
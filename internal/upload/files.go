@@ -0,0 +1,106 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrFileNotFound is returned for a file the store doesn't hold
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrInvalidHash is returned for a file hash that isn't a hex SHA-256
+var ErrInvalidHash = errors.New("invalid sha256")
+
+// filesDir is the subdirectory of the store holding single files by hash,
+// from which incremental uploads are assembled into archives
+const filesDir = "files"
+
+// filePath returns the file with the given hex SHA-256
+func (s *Store) filePath(sum string) (string, error) {
+	if !isSHA256(sum) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidHash, sum)
+	}
+	return filepath.Join(s.dir, filesDir, strings.ToLower(sum)), nil
+}
+
+// MissingFiles returns the hashes in sums that the store doesn't hold, in
+// order. Files it does hold are marked as used, so that they aren't
+// expired before the client builds an archive from them.
+func (s *Store) MissingFiles(sums []string) ([]string, error) {
+	missing := []string{}
+	now := time.Now()
+	for _, sum := range sums {
+		p, err := s.filePath(sum)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chtimes(p, now, now); err != nil {
+			missing = append(missing, sum)
+		}
+	}
+	return missing, nil
+}
+
+// PutFile stores the contents of r under sum, failing with ErrChecksum if
+// they don't hash to it. Storing a file that is already held only marks
+// it as used.
+func (s *Store) PutFile(sum string, r io.Reader) error {
+	p, err := s.filePath(sum)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(p, now, now); err == nil {
+		return nil
+	}
+
+	err = writeFile(p, func(f *os.File) error {
+		hash := sha256.New()
+		src := r
+		if s.maxSize > 0 {
+			src = io.LimitReader(r, s.maxSize+1)
+		}
+		n, err := io.Copy(io.MultiWriter(f, hash), src)
+		if err != nil {
+			return err
+		}
+		if s.maxSize > 0 && n > s.maxSize {
+			return ErrTooLarge
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != strings.ToLower(sum) {
+			return ErrChecksum
+		}
+		return nil
+	})
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrChecksum) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("storing file: %w", err)
+	}
+	return nil
+}
+
+// File returns the contents of a stored file by its hex SHA-256
+func (s *Store) File(sum string) ([]byte, error) {
+	p, err := s.filePath(sum)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,76 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hashOf(data string) string {
+	digest := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(digest[:])
+}
+
+func TestStore_Files(t *testing.T) {
+	s := NewStore(t.TempDir(), 10)
+	held, other := hashOf("held"), hashOf("other")
+
+	if err := s.PutFile(held, strings.NewReader("held")); err != nil {
+		t.Fatalf("PutFile() error = %v", err)
+	}
+	if err := s.PutFile(held, strings.NewReader("held")); err != nil {
+		t.Errorf("PutFile() again error = %v", err)
+	}
+	if got, err := s.File(held); err != nil || string(got) != "held" {
+		t.Errorf("File() = %q, %v, want held", got, err)
+	}
+	if _, err := s.File(other); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("File() of missing file error = %v, want ErrFileNotFound", err)
+	}
+
+	missing, err := s.MissingFiles([]string{held, other})
+	if err != nil || !reflect.DeepEqual(missing, []string{other}) {
+		t.Errorf("MissingFiles() = %v, %v, want [%s]", missing, err, other)
+	}
+	if _, err := s.MissingFiles([]string{"../" + held[3:]}); !errors.Is(err, ErrInvalidHash) {
+		t.Errorf("MissingFiles() of bad hash error = %v, want ErrInvalidHash", err)
+	}
+
+	if err := s.PutFile(other, strings.NewReader("not other")); !errors.Is(err, ErrChecksum) {
+		t.Errorf("PutFile() with wrong contents error = %v, want ErrChecksum", err)
+	}
+	big := "0123456789X"
+	if err := s.PutFile(hashOf(big), strings.NewReader(big)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("PutFile() over limit error = %v, want ErrTooLarge", err)
+	}
+	// Rejected files leave nothing behind
+	if entries, _ := os.ReadDir(filepath.Join(s.dir, filesDir)); len(entries) != 1 {
+		t.Errorf("files dir has %d entries, want 1", len(entries))
+	}
+}
+
+func TestStore_CleanupFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir, 0)
+	stale, fresh := hashOf("stale"), hashOf("fresh")
+	s.PutFile(stale, strings.NewReader("stale"))
+	s.PutFile(fresh, strings.NewReader("fresh"))
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, filesDir, stale), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.Cleanup(time.Hour); err != nil || n != 1 {
+		t.Fatalf("Cleanup() = %d, %v, want 1", n, err)
+	}
+	if missing, _ := s.MissingFiles([]string{stale, fresh}); !reflect.DeepEqual(missing, []string{stale}) {
+		t.Errorf("MissingFiles() after Cleanup = %v, want [%s]", missing, stale)
+	}
+}
@@ -0,0 +1,330 @@
+// Package upload stores archives sent in chunks, so that a large upload
+// over an unreliable link can resume from where it stopped instead of
+// starting over, and caches archives by SHA-256 so that clients can run
+// one again without sending it. Single files are also kept by SHA-256, so
+// that a client can send only the files of a project that changed and
+// have the archive assembled from them.
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/google/uuid"
+)
+
+// Errors returned by Store, which the API maps to status codes
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("chunk offset does not match upload size")
+	ErrComplete       = errors.New("upload is already complete")
+	ErrIncomplete     = errors.New("upload is not complete")
+	ErrBusy           = errors.New("upload is being written by another request")
+	ErrTooLarge       = errors.New("upload exceeds maximum size")
+	ErrChecksum       = errors.New("upload checksum does not match")
+)
+
+// idPrefix starts every upload ID, as exe_ starts execution IDs
+const idPrefix = "upl_"
+
+// Store keeps uploads as files in a directory. An upload in progress is
+// <id>.part; completing it renames it to <id>.tar, with its SHA-256 in
+// <id>.sha256. Uploads are only visible to the server that received them.
+type Store struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewStore creates a Store in dir, which is created when the first upload
+// is. Uploads larger than maxSize bytes are rejected; 0 means no limit.
+func NewStore(dir string, maxSize int64) *Store {
+	return &Store{
+		dir:     dir,
+		maxSize: maxSize,
+		busy:    make(map[string]bool),
+	}
+}
+
+// path returns the file of upload id with the given extension, or
+// ErrNotFound if id is not an upload ID, so that a crafted ID can't name a
+// file outside the store
+func (s *Store) path(id, ext string) (string, error) {
+	raw, ok := strings.CutPrefix(id, idPrefix)
+	if !ok {
+		return "", ErrNotFound
+	}
+	if _, err := uuid.Parse(raw); err != nil {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.dir, id+ext), nil
+}
+
+// Create starts a new, empty upload
+func (s *Store) Create() (*client.Upload, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating upload directory: %w", err)
+	}
+
+	id := idPrefix + uuid.New().String()
+	part, _ := s.path(id, ".part")
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating upload: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("creating upload: %w", err)
+	}
+	return &client.Upload{UploadID: id}, nil
+}
+
+// Get returns the state of an upload
+func (s *Store) Get(id string) (*client.Upload, error) {
+	part, err := s.path(id, ".part")
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(part); err == nil {
+		return &client.Upload{UploadID: id, Offset: info.Size()}, nil
+	}
+
+	tarPath, _ := s.path(id, ".tar")
+	info, err := os.Stat(tarPath)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	sumPath, _ := s.path(id, ".sha256")
+	sum, err := os.ReadFile(sumPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading upload checksum: %w", err)
+	}
+	return &client.Upload{UploadID: id, Offset: info.Size(), Complete: true, SHA256: string(sum)}, nil
+}
+
+// acquire marks an upload as being written, failing with ErrBusy if it
+// already is, so that concurrent chunks can't interleave
+func (s *Store) acquire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.busy[id] {
+		return ErrBusy
+	}
+	s.busy[id] = true
+	return nil
+}
+
+// release undoes acquire
+func (s *Store) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busy, id)
+}
+
+// Append writes a chunk read from r to an upload. offset must be the
+// upload's current size, so a client that lost track after a failure asks
+// Get where to resume. If r fails partway, whatever was received is kept
+// and the error returned along with the new state.
+func (s *Store) Append(id string, offset int64, r io.Reader) (*client.Upload, error) {
+	if err := s.acquire(id); err != nil {
+		return nil, err
+	}
+	defer s.release(id)
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Complete {
+		return upload, ErrComplete
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	part, _ := s.path(id, ".part")
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	src := r
+	if s.maxSize > 0 {
+		// Read one byte past the limit to tell reaching it from exceeding it
+		src = io.LimitReader(r, s.maxSize-offset+1)
+	}
+	n, copyErr := io.Copy(f, src)
+	if s.maxSize > 0 && offset+n > s.maxSize {
+		if err := f.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("truncating upload: %w", err)
+		}
+		return upload, ErrTooLarge
+	}
+
+	upload.Offset = offset + n
+	if copyErr != nil {
+		return upload, fmt.Errorf("receiving chunk: %w", copyErr)
+	}
+	return upload, nil
+}
+
+// Complete finishes an upload so it can be executed. If sha256sum is not
+// empty it must be the hex SHA-256 of the whole upload, else the upload
+// is left open and ErrChecksum returned.
+func (s *Store) Complete(id, sha256sum string) (*client.Upload, error) {
+	if err := s.acquire(id); err != nil {
+		return nil, err
+	}
+	defer s.release(id)
+
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Complete {
+		if sha256sum != "" && !strings.EqualFold(sha256sum, upload.SHA256) {
+			return upload, ErrChecksum
+		}
+		return upload, nil
+	}
+
+	part, _ := s.path(id, ".part")
+	f, err := os.Open(part)
+	if err != nil {
+		return nil, fmt.Errorf("opening upload: %w", err)
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("hashing upload: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if sha256sum != "" && !strings.EqualFold(sha256sum, sum) {
+		return upload, ErrChecksum
+	}
+
+	// The checksum is written first so a completed upload always has one
+	sumPath, _ := s.path(id, ".sha256")
+	if err := os.WriteFile(sumPath, []byte(sum), 0600); err != nil {
+		return nil, fmt.Errorf("writing upload checksum: %w", err)
+	}
+	tarPath, _ := s.path(id, ".tar")
+	if err := os.Rename(part, tarPath); err != nil {
+		return nil, fmt.Errorf("completing upload: %w", err)
+	}
+	// Caching is an optimisation, so the upload is usable even if it fails
+	_ = s.linkArchive(tarPath, sum)
+
+	upload.Complete = true
+	upload.SHA256 = sum
+	return upload, nil
+}
+
+// Read returns the contents of a completed upload
+func (s *Store) Read(id string) ([]byte, error) {
+	tarPath, err := s.path(id, ".tar")
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(tarPath)
+	if err == nil {
+		return data, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading upload: %w", err)
+	}
+
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	return nil, ErrIncomplete
+}
+
+// Delete removes an upload, complete or not
+func (s *Store) Delete(id string) error {
+	if err := s.acquire(id); err != nil {
+		return err
+	}
+	defer s.release(id)
+
+	return s.remove(id)
+}
+
+// remove deletes the files of an upload the caller has acquired
+func (s *Store) remove(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+
+	for _, ext := range []string{".part", ".tar", ".sha256"} {
+		p, _ := s.path(id, ext)
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("deleting upload: %w", err)
+		}
+	}
+	return nil
+}
+
+// Cleanup deletes uploads that haven't been written to, and cached
+// archives and files that haven't been used, for ttl, returning how many
+// it deleted. Completed uploads expire the same way, as they are only kept
+// to be executed.
+func (s *Store) Cleanup(ttl time.Duration) (int, error) {
+	deleted := 0
+	for _, name := range []string{archiveDir, filesDir} {
+		n, err := s.cleanupHashed(name, ttl)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return deleted, nil
+		}
+		return deleted, fmt.Errorf("reading upload directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if ext != ".part" && ext != ".tar" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ext)
+		if err := s.acquire(id); err != nil {
+			continue
+		}
+		err = s.remove(id)
+		s.release(id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
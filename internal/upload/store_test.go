@@ -0,0 +1,171 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingReader returns its data and then an error, like a dropped
+// connection partway through a chunk
+type failingReader struct {
+	data string
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("connection reset")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestStore_ResumableUpload(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "uploads"), 0)
+
+	u, err := s.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(u.UploadID, "upl_") || u.Offset != 0 || u.Complete {
+		t.Fatalf("Create() = %+v", u)
+	}
+
+	if u, err = s.Append(u.UploadID, 0, strings.NewReader("hello ")); err != nil || u.Offset != 6 {
+		t.Fatalf("Append() = %+v, %v, want offset 6", u, err)
+	}
+
+	// A chunk that breaks off keeps what arrived
+	u, err = s.Append(u.UploadID, 6, &failingReader{data: "wor"})
+	if err == nil {
+		t.Fatal("Append() with failing reader succeeded, want error")
+	}
+	if u.Offset != 9 {
+		t.Errorf("Append() offset after failure = %d, want 9", u.Offset)
+	}
+
+	// Resending from the old offset is refused with the current state
+	u, err = s.Append(u.UploadID, 6, strings.NewReader("world"))
+	if !errors.Is(err, ErrOffsetMismatch) || u.Offset != 9 {
+		t.Fatalf("Append() at stale offset = %+v, %v, want ErrOffsetMismatch at 9", u, err)
+	}
+	if _, err = s.Append(u.UploadID, 9, strings.NewReader("ld")); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if _, err := s.Read(u.UploadID); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Read() before Complete error = %v, want ErrIncomplete", err)
+	}
+	if _, err := s.Complete(u.UploadID, strings.Repeat("0", 64)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Complete() with wrong checksum error = %v, want ErrChecksum", err)
+	}
+
+	sum := sha256.Sum256([]byte("hello world"))
+	want := hex.EncodeToString(sum[:])
+	u, err = s.Complete(u.UploadID, strings.ToUpper(want))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if !u.Complete || u.SHA256 != want || u.Offset != 11 {
+		t.Errorf("Complete() = %+v", u)
+	}
+	if got, _ := s.Get(u.UploadID); got == nil || *got != *u {
+		t.Errorf("Get() = %+v, want %+v", got, u)
+	}
+
+	data, err := s.Read(u.UploadID)
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("Read() = %q, %v, want hello world", data, err)
+	}
+	if _, err := s.Append(u.UploadID, 11, strings.NewReader("!")); !errors.Is(err, ErrComplete) {
+		t.Errorf("Append() after Complete error = %v, want ErrComplete", err)
+	}
+
+	if err := s.Delete(u.UploadID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Get(u.UploadID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_MaxSize(t *testing.T) {
+	s := NewStore(t.TempDir(), 10)
+	u, err := s.Create()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := s.Append(u.UploadID, 0, strings.NewReader("123456")); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if _, err := s.Append(u.UploadID, 6, strings.NewReader("7890X")); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Append() over limit error = %v, want ErrTooLarge", err)
+	}
+	// The rejected chunk is discarded, so a smaller one can follow
+	if u, err = s.Append(u.UploadID, 6, strings.NewReader("7890")); err != nil || u.Offset != 10 {
+		t.Errorf("Append() up to limit = %+v, %v, want offset 10", u, err)
+	}
+}
+
+func TestStore_InvalidIDs(t *testing.T) {
+	s := NewStore(t.TempDir(), 0)
+	for _, id := range []string{"", "upl_", "upl_../../etc/passwd", "exe_" + strings.Repeat("a", 36)} {
+		if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", id, err)
+		}
+		if _, err := s.Append(id, 0, strings.NewReader("x")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Append(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestStore_Cleanup(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir, 0)
+
+	stale, _ := s.Create()
+	done, _ := s.Create()
+	if _, err := s.Complete(done.UploadID, ""); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	fresh, _ := s.Create()
+
+	old := time.Now().Add(-2 * time.Hour)
+	for _, name := range []string{stale.UploadID + ".part", done.UploadID + ".tar"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The completed upload's cached archive is a link to the same file, so
+	// it is as old and goes too
+	n, err := s.Cleanup(time.Hour)
+	if err != nil || n != 3 {
+		t.Fatalf("Cleanup() = %d, %v, want 3", n, err)
+	}
+	for _, id := range []string{stale.UploadID, done.UploadID} {
+		if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%s) after Cleanup error = %v, want ErrNotFound", id, err)
+		}
+	}
+	if _, err := s.Get(fresh.UploadID); err != nil {
+		t.Errorf("Get(fresh) after Cleanup error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, fresh.UploadID+".part")); err != nil {
+		t.Errorf("Cleanup() deleted the fresh upload: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, archiveDir)); len(entries) != 0 {
+		t.Errorf("Cleanup() left %d cached archives, want 0", len(entries))
+	}
+
+	if n, err := NewStore(filepath.Join(dir, "missing"), 0).Cleanup(time.Hour); n != 0 || err != nil {
+		t.Errorf("Cleanup() of missing dir = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,1160 @@
+// Package cli is the python-executor command line: the command tree the
+// python-executor binary runs, importable so that the documentation and
+// other programs use the very same commands and flags.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// options holds the flag values of one root command, so that the commands
+// of separate NewRootCmd calls don't share them
+type options struct {
+	// Global flags
+	serverURL          string
+	apiKey             string
+	timeout            int
+	memoryMB           int
+	diskMB             int
+	cpuShares          int
+	network            bool
+	installNetworkOnly bool
+	freezePackages     bool
+	combinedOutput     bool
+	stripANSI          bool
+	recordTimestamps   bool
+	captureImages      bool
+	artifactsOut       string
+	coverage           bool
+	deterministic      bool
+	seed               uint32
+	fakeTime           string
+	retries            int
+	retryOn            []string
+	group              string
+	labels             map[string]string
+	secretNames        []string
+	placement          map[string]string
+	preset             string
+	image              string
+	async              bool
+	quiet              bool
+	verbose            bool
+	noProgress         bool
+
+	// run command flags
+	files            []string
+	entrypoint       string
+	requirementsFile string
+	envVars          []string
+	stdinFile        string
+	evalLastExpr     bool
+	pytestMode       bool
+	autoInstall      bool
+	excludes         []string
+	dryRun           bool
+	showFiles        bool
+	parallel         int
+
+	// follow command flags
+	timestamps bool
+	followLogs bool
+
+	// eval command flags
+	pythonVersion string
+	noResult      bool
+	packages      []string
+
+	// list, server and stats command flags
+	list   listOptions
+	server serverOptions
+	stats  statsOptions
+}
+
+// NewRootCmd creates and returns the root cobra command. The
+// python-executor binary executes it; cmd/gendocs generates the CLI
+// reference from it, and other programs can embed it as a subcommand.
+// Each call's commands have flag values of their own.
+func NewRootCmd() *cobra.Command {
+	o := &options{}
+	rootCmd := &cobra.Command{
+		Use:   "python-executor",
+		Short: "Remote Python code execution CLI",
+		Long: `Execute Python code remotely in isolated containers.
+
+The python-executor CLI provides command-line access to execute Python code
+on a remote server in sandboxed Docker containers.
+
+Environment Variables:
+  PYEXEC_SERVER    Server URL (default: http://localhost:8080)
+  PYEXEC_API_KEY   API key, for servers that require one
+
+Exit Codes:
+  run, follow and eval exit with the script's exit code, except:
+  124              The script timed out, or the server did not answer in time
+  125              The server could not be reached or could not run the script
+  137              The execution was killed, cancelled or rejected
+  1                Invalid arguments or local errors
+
+Documentation:     https://github.com/geraldthewes/python-executor/blob/main/README.md
+Configuration:     https://github.com/geraldthewes/python-executor/blob/main/docs/configuration.md`,
+	}
+
+	// Global flags
+	rootCmd.PersistentFlags().StringVar(&o.serverURL, "server", getEnv("PYEXEC_SERVER", "http://localhost:8080"), "Server URL (env: PYEXEC_SERVER)")
+	rootCmd.PersistentFlags().StringVar(&o.apiKey, "api-key", "", "API key for servers that require one (env: PYEXEC_API_KEY)")
+	rootCmd.PersistentFlags().IntVar(&o.timeout, "timeout", 0, "Execution timeout in seconds (0 = server default)")
+	rootCmd.PersistentFlags().IntVar(&o.memoryMB, "memory", 0, "Memory limit in MB (0 = server default)")
+	rootCmd.PersistentFlags().IntVar(&o.diskMB, "disk", 0, "Disk limit in MB (0 = server default)")
+	rootCmd.PersistentFlags().IntVar(&o.cpuShares, "cpu", 0, "CPU shares (0 = server default)")
+	rootCmd.PersistentFlags().BoolVar(&o.network, "network", false, "Allow network access (required for pip install)")
+	rootCmd.PersistentFlags().BoolVar(&o.installNetworkOnly, "install-network-only", false, "Allow network only while installing requirements, not while the script runs")
+	rootCmd.PersistentFlags().BoolVar(&o.freezePackages, "freeze-packages", false, "Record installed package versions (pip freeze) in the result")
+	rootCmd.PersistentFlags().BoolVar(&o.combinedOutput, "combined-output", false, "Print stdout and stderr interleaved in the order they were written")
+	rootCmd.PersistentFlags().BoolVar(&o.stripANSI, "strip-ansi", false, "Remove ANSI escape codes (colors, progress bars) from captured output")
+	rootCmd.PersistentFlags().BoolVar(&o.recordTimestamps, "record-timestamps", false, "Record when each output line is emitted, for follow --timestamps")
+	rootCmd.PersistentFlags().BoolVar(&o.captureImages, "capture-images", false, "Save matplotlib figures and collect images written to /work/output")
+	rootCmd.PersistentFlags().StringVar(&o.artifactsOut, "artifacts", "", "Collect the files the script writes to /work/output and save them under this directory")
+	rootCmd.PersistentFlags().BoolVar(&o.coverage, "coverage", false, "Measure line coverage with coverage.py and report the percentage")
+	rootCmd.PersistentFlags().BoolVar(&o.deterministic, "deterministic", false, "Seed PYTHONHASHSEED, random and numpy so runs are reproducible (see --seed)")
+	rootCmd.PersistentFlags().Uint32Var(&o.seed, "seed", 0, "Seed for --deterministic; a non-zero seed implies it")
+	rootCmd.PersistentFlags().StringVar(&o.fakeTime, "fake-time", "", "Freeze the script's clock at this RFC 3339 time, e.g. 2024-01-01T00:00:00Z (needs libfaketime in the image)")
+	rootCmd.PersistentFlags().IntVar(&o.retries, "retries", 0, "Re-run a failed execution up to this many times (see --retry-on)")
+	rootCmd.PersistentFlags().StringSliceVar(&o.retryOn, "retry-on", nil, "Failures to retry: infra_error (default), timeout, pull_timeout, install_timeout, oom, disk_limit_exceeded, install_error, nonzero_exit")
+	rootCmd.PersistentFlags().StringVar(&o.group, "group", "", "Add the execution to this group (see kill --group)")
+	rootCmd.PersistentFlags().StringToStringVar(&o.labels, "label", nil, "Label the execution KEY=value, to search executions by (can be repeated)")
+	rootCmd.PersistentFlags().StringSliceVar(&o.secretNames, "secret", nil, "Pass a secret registered on the server as the environment variable of its name (can be repeated)")
+	rootCmd.PersistentFlags().StringToStringVar(&o.placement, "placement", nil, "Run only on a server with the label KEY=value, e.g. gpu=true (can be repeated)")
+	rootCmd.PersistentFlags().StringVar(&o.preset, "preset", "", "Server resource preset for the image and limits the other flags leave unset")
+	rootCmd.PersistentFlags().StringVar(&o.image, "image", "", "Docker image to use")
+	rootCmd.PersistentFlags().BoolVar(&o.async, "async", false, "Submit asynchronously and return execution ID")
+	rootCmd.PersistentFlags().BoolVarP(&o.quiet, "quiet", "q", false, "Quiet mode: only output stdout on success")
+	rootCmd.PersistentFlags().BoolVarP(&o.verbose, "verbose", "v", false, "Verbose mode: show execution details")
+	rootCmd.PersistentFlags().BoolVar(&o.noProgress, "no-progress", false, "Don't show the upload progress bar and status spinner on a terminal")
+
+	// Commands
+	rootCmd.AddCommand(o.runCmd())
+	rootCmd.AddCommand(o.submitCmd())
+	rootCmd.AddCommand(o.followCmd())
+	rootCmd.AddCommand(o.killCmd())
+	rootCmd.AddCommand(o.listCmd())
+	rootCmd.AddCommand(o.evalCmd())
+	rootCmd.AddCommand(o.serverCmd())
+	rootCmd.AddCommand(o.statsCmd())
+	rootCmd.AddCommand(versionCmd())
+
+	return rootCmd
+}
+
+func (o *options) runCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run [file|directory|tar] [-- script-args...]",
+		Short: "Execute code synchronously",
+		Long: `Execute Python code and wait for the result.
+
+Input can be provided via:
+  - stdin:     echo 'print("hi")' | python-executor run
+  - file:      python-executor run script.py
+  - directory: python-executor run ./myproject/
+  - tar:       python-executor run code.tar (or code.tar.gz, code.tgz)
+
+Arguments after -- are passed to the Python script as sys.argv.
+
+With --parallel, every file, directory or tar given, or matched by a quoted
+glob pattern, runs as its own execution. A status table is shown while they
+run, then each one's output in turn; the exit code is the highest of theirs.
+
+Examples:
+  # Run code from stdin
+  echo 'print("Hello")' | python-executor run
+
+  # Run a Python file
+  python-executor run script.py
+
+  # Run a directory (uses main.py or __main__.py as entrypoint)
+  python-executor run ./myproject/
+
+  # Pass arguments to the script
+  python-executor run script.py -- --verbose input.txt
+
+  # Run with dependencies
+  python-executor run --requirements requirements.txt script.py
+
+  # Forward environment variables
+  python-executor run -e API_KEY -e DEBUG=true script.py
+
+  # Stream a large file to the script's stdin
+  python-executor run --stdin-file data.csv script.py
+
+  # Run a project's tests with pytest
+  python-executor run --pytest --requirements requirements.txt ./myproject/
+
+  # Check what a directory would send, without running it
+  python-executor run --dry-run --exclude venv --exclude '*.csv' ./myproject/
+
+  # Run every script in jobs/ as its own execution, 4 at a time
+  python-executor run --parallel 4 'jobs/*.py'`,
+		RunE: o.runExecution,
+	}
+
+	cmd.Flags().StringSliceVar(&o.files, "file", nil, "Additional file to include (can be repeated)")
+	cmd.Flags().StringVar(&o.entrypoint, "entrypoint", "", "Override the entrypoint script (default: auto-detect)")
+	cmd.Flags().StringVar(&o.requirementsFile, "requirements", "", "Path to requirements.txt (enables network)")
+	cmd.Flags().StringArrayVarP(&o.envVars, "env", "e", nil, "Environment variable: VAR (from env) or VAR=value")
+	cmd.Flags().BoolVar(&o.evalLastExpr, "eval-last-expr", false, "Print the value of the script's last expression")
+	cmd.Flags().BoolVar(&o.pytestMode, "pytest", false, "Run the files' tests with pytest (the entrypoint, if given, selects the tests)")
+	cmd.Flags().BoolVar(&o.autoInstall, "auto-install", false, "Detect imported third-party packages and install them")
+	cmd.Flags().StringArrayVar(&o.excludes, "exclude", nil, "Leave matching files and directories out of a directory (can be repeated; .git, __pycache__ and *.pyc always are)")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "Show the files that would be sent, the ignored entries and the entrypoint, then exit without running")
+	cmd.Flags().BoolVar(&o.showFiles, "show-files", false, "Show the files being sent, the ignored entries and the entrypoint before running")
+	cmd.Flags().StringVar(&o.stdinFile, "stdin-file", "", "Stream this file to the script's stdin (sync only)")
+	cmd.Flags().IntVar(&o.parallel, "parallel", 0, "Run each file, directory or glob match as its own execution, this many at a time")
+
+	return cmd
+}
+
+func (o *options) submitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "submit [file|directory|tar] [-- script-args...]",
+		Short: "Submit code asynchronously",
+		Long: `Submit code for execution and return immediately with an execution ID.
+
+Use this for long-running tasks. The execution ID can be used to:
+  - Check status: python-executor follow <id>
+  - Kill:         python-executor kill <id>
+
+Examples:
+  # Submit and get execution ID
+  EXEC_ID=$(python-executor submit long_task.py)
+  echo "Submitted: $EXEC_ID"
+
+  # Later, follow the execution
+  python-executor follow $EXEC_ID`,
+		RunE: o.submitExecution,
+	}
+
+	cmd.Flags().StringSliceVar(&o.files, "file", nil, "Additional file to include (can be repeated)")
+	cmd.Flags().StringVar(&o.entrypoint, "entrypoint", "", "Override the entrypoint script (default: auto-detect)")
+	cmd.Flags().StringVar(&o.requirementsFile, "requirements", "", "Path to requirements.txt (enables network)")
+	cmd.Flags().StringArrayVarP(&o.envVars, "env", "e", nil, "Environment variable: VAR (from env) or VAR=value")
+	cmd.Flags().BoolVar(&o.evalLastExpr, "eval-last-expr", false, "Print the value of the script's last expression")
+	cmd.Flags().BoolVar(&o.pytestMode, "pytest", false, "Run the files' tests with pytest (the entrypoint, if given, selects the tests)")
+	cmd.Flags().BoolVar(&o.autoInstall, "auto-install", false, "Detect imported third-party packages and install them")
+	cmd.Flags().StringArrayVar(&o.excludes, "exclude", nil, "Leave matching files and directories out of a directory (can be repeated; .git, __pycache__ and *.pyc always are)")
+	cmd.Flags().BoolVar(&o.dryRun, "dry-run", false, "Show the files that would be sent, the ignored entries and the entrypoint, then exit without running")
+	cmd.Flags().BoolVar(&o.showFiles, "show-files", false, "Show the files being sent, the ignored entries and the entrypoint before running")
+
+	return cmd
+}
+
+func (o *options) followCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "follow <execution-id>",
+		Short: "Follow an async execution",
+		Long: `Poll an asynchronous execution until complete and display the result.
+
+The command polls the server every 2 seconds until the execution finishes,
+then prints stdout/stderr and exits with the script's exit code. Output is
+downloaded in chunks, and a chunk that fails is retried from where the last
+one ended, so a dropped connection neither repeats nor loses output.
+
+With --follow-logs, output is printed as the script writes it, over a
+WebSocket, instead of once it has finished. A late start may skip earlier
+output of a very chatty script; follow without the flag shows it all.
+
+Example:
+  # Submit and follow
+  EXEC_ID=$(python-executor submit script.py)
+  python-executor follow $EXEC_ID
+
+  # Watch the output of a long-running script as it is written
+  python-executor follow --follow-logs $EXEC_ID`,
+		Args: cobra.ExactArgs(1),
+		RunE: o.followExecution,
+	}
+
+	cmd.Flags().BoolVar(&o.timestamps, "timestamps", false, "Prefix each output line with the time it was emitted, if submitted with --record-timestamps")
+	cmd.Flags().BoolVar(&o.followLogs, "follow-logs", false, "Print output live as the script writes it")
+
+	return cmd
+}
+
+func (o *options) killCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "kill <execution-id>",
+		Short: "Kill a running execution",
+		Long: `Terminate a running execution.
+
+The Docker container running the Python code will be forcefully stopped.
+A pending (queued) execution is cancelled before it starts.
+
+With --group and no execution ID, every execution submitted with that
+group is killed.
+
+Examples:
+  python-executor kill exe_550e8400-e29b-41d4-a716-446655440000
+  python-executor kill --group batch-42`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: o.killExecution,
+	}
+}
+
+func (o *options) evalCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "eval [code]",
+		Short: "Evaluate code with REPL-style expression results",
+		Long: `Execute Python code and return the value of the last expression.
+
+This command uses the simplified JSON API with REPL-style evaluation.
+If the last statement is an expression, its value is printed after any
+stdout output.
+
+Input can be provided via:
+  - argument:  python-executor eval '2 + 2'
+  - stdin:     echo '2 + 2' | python-executor eval
+
+Examples:
+  # Simple expression
+  python-executor eval '2 + 2'
+  # Output: 4
+
+  # Multi-line code (use single quotes to preserve newlines)
+  python-executor eval 'x = 5
+  x * 2'
+  # Output: 10
+
+  # Using imports
+  python-executor eval 'import math; math.sqrt(16)'
+  # Output: 4.0
+
+  # From stdin
+  echo 'import sys; sys.version' | python-executor eval
+
+  # Specify Python version
+  python-executor eval --python 3.11 'import sys; sys.version'
+
+  # Disable result output (only show stdout)
+  python-executor eval --no-result 'print("hello"); 42'
+  # Output: hello
+
+  # Install imported packages even if the server doesn't by default
+  python-executor eval --auto-install 'import numpy; numpy.arange(3).sum()'
+  # Output: 3
+
+  # Install packages by name
+  python-executor eval --package numpy --package 'requests==2.31' 'import numpy; numpy.__version__'`,
+		RunE: o.evalExecution,
+	}
+
+	cmd.Flags().StringVar(&o.pythonVersion, "python", "", "Python version (3.10, 3.11, 3.12, 3.13)")
+	cmd.Flags().BoolVar(&o.noResult, "no-result", false, "Disable expression evaluation (just run code)")
+	cmd.Flags().BoolVar(&o.autoInstall, "auto-install", false, "Install imported third-party packages (default: server setting)")
+	cmd.Flags().StringArrayVar(&o.packages, "package", nil, "Package to install, e.g. numpy or 'requests==2.31' (can be repeated)")
+
+	return cmd
+}
+
+func versionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Show version information",
+		Long:  `Display the version of the python-executor CLI.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println("python-executor v1.0.0")
+		},
+	}
+}
+
+func (o *options) runExecution(cmd *cobra.Command, args []string) error {
+	// Separate positional args from script args
+	positionalArgs, scriptArgs := splitArgsAtDash(cmd, args)
+	if o.parallel < 0 {
+		return fmt.Errorf("--parallel must be positive")
+	}
+	if o.parallel > 0 {
+		return o.runParallel(positionalArgs, scriptArgs)
+	}
+
+	tarData, ignored, meta, err := o.prepareExecution(positionalArgs, scriptArgs)
+	if err != nil {
+		return err
+	}
+	if done, err := o.previewExecution(tarData, ignored, meta); done || err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if o.async {
+		if o.stdinFile != "" {
+			return fmt.Errorf("--stdin-file is not supported with --async")
+		}
+		return o.submitArchive(ctx, tarData, meta)
+	}
+
+	var f *os.File
+	if o.stdinFile != "" {
+		if f, err = os.Open(o.stdinFile); err != nil {
+			return fmt.Errorf("opening stdin file: %w", err)
+		}
+		defer f.Close()
+	}
+
+	// The server doesn't say what a sync execution is doing, only how long
+	// the wait has been
+	status := o.startStatus("Uploading")
+	c := o.newClient(client.WithUploadProgress(status.uploading("Running")))
+	var result *client.ExecutionResult
+	if f != nil {
+		result, err = c.ExecuteSyncWithStdin(ctx, tarData, meta, f)
+	} else {
+		result, err = c.ExecuteSync(ctx, tarData, meta)
+	}
+	status.close()
+	if err != nil {
+		return infraError(err)
+	}
+	if err := o.saveArtifacts(ctx, c, result.ExecutionID); err != nil {
+		return infraError(err)
+	}
+
+	o.printResult(result)
+	os.Exit(resultExitCode(result))
+	return nil
+}
+
+func (o *options) submitExecution(cmd *cobra.Command, args []string) error {
+	// Separate positional args from script args
+	positionalArgs, scriptArgs := splitArgsAtDash(cmd, args)
+
+	tarData, ignored, meta, err := o.prepareExecution(positionalArgs, scriptArgs)
+	if err != nil {
+		return err
+	}
+	if done, err := o.previewExecution(tarData, ignored, meta); done || err != nil {
+		return err
+	}
+
+	return o.submitArchive(context.Background(), tarData, meta)
+}
+
+// submitArchive submits an execution asynchronously and prints its ID
+func (o *options) submitArchive(ctx context.Context, tarData []byte, meta *client.Metadata) error {
+	status := o.startStatus("Uploading")
+	c := o.newClient(client.WithUploadProgress(status.uploading("Submitting")))
+	execID, err := c.ExecuteAsync(ctx, tarData, meta)
+	status.close()
+	if err != nil {
+		return infraError(err)
+	}
+
+	fmt.Println(execID)
+	return nil
+}
+
+func (o *options) followExecution(cmd *cobra.Command, args []string) error {
+	execID := args[0]
+
+	c := o.newClient()
+	ctx := context.Background()
+
+	if o.followLogs && o.timestamps {
+		return fmt.Errorf("--timestamps is not supported with --follow-logs")
+	}
+	if !o.quiet {
+		fmt.Fprintf(os.Stderr, "Following execution %s...\n", execID)
+	}
+	if o.followLogs {
+		return o.streamExecution(ctx, c, execID)
+	}
+
+	// On a terminal the status line shows progress; elsewhere each update
+	// is printed on a line of its own
+	status := o.startStatus("Waiting")
+	defer status.close()
+	var last *client.Progress
+	result, err := c.WatchExecution(ctx, execID, 2*time.Second, func(r *client.ExecutionResult) {
+		if status != nil {
+			status.set(executionStatus(r))
+			return
+		}
+		if o.quiet || r.Progress == nil || (last != nil && r.Progress.UpdatedAt.Equal(last.UpdatedAt)) {
+			return
+		}
+		last = r.Progress
+		fmt.Fprintf(os.Stderr, "Progress: %s\n", formatProgress(r.Progress))
+	})
+	if err != nil {
+		return infraError(err)
+	}
+
+	// Read the full logs in chunks that can be retried, with line timestamps
+	// if asked
+	status.set("Reading output")
+	if result.Stdout, err = o.readLog(ctx, c, execID, client.StreamStdout); err != nil {
+		return infraError(err)
+	}
+	if result.Stderr, err = o.readLog(ctx, c, execID, client.StreamStderr); err != nil {
+		return infraError(err)
+	}
+	status.close()
+	if err := o.saveArtifacts(ctx, c, execID); err != nil {
+		return infraError(err)
+	}
+
+	o.printResult(result)
+	os.Exit(resultExitCode(result))
+	return nil
+}
+
+// streamExecution prints an execution's output as the script writes it,
+// then the rest of its result
+func (o *options) streamExecution(ctx context.Context, c *client.Client, execID string) error {
+	_, err := c.StreamLogs(ctx, execID, func(f *client.LogFrame) {
+		if f.Skipped > 0 && !o.quiet {
+			fmt.Fprintf(os.Stderr, "[%d bytes of earlier output skipped]\n", f.Skipped)
+		}
+		switch {
+		case f.Stream == client.StreamStderr && !o.quiet:
+			fmt.Fprint(os.Stderr, f.Data)
+		case f.Stream == client.StreamStdout:
+			fmt.Print(f.Data)
+		}
+	})
+	if err != nil {
+		return infraError(err)
+	}
+
+	result, err := c.GetExecution(ctx, execID)
+	if err != nil {
+		return infraError(err)
+	}
+	if err := o.saveArtifacts(ctx, c, execID); err != nil {
+		return infraError(err)
+	}
+	// The output has been printed already
+	result.Stdout, result.Stderr, result.Output = "", "", ""
+	o.printResult(result)
+	os.Exit(resultExitCode(result))
+	return nil
+}
+
+// logChunkSize is how many bytes of a log follow reads per request
+const logChunkSize = 1 << 20
+
+// logReadRetries is how many times follow retries a failed log read before
+// giving up
+const logReadRetries = 5
+
+// readLog reads one of an execution's output streams in full, chunk by
+// chunk. A failed read is retried from where the last chunk ended, so a
+// dropped connection neither repeats nor loses output.
+func (o *options) readLog(ctx context.Context, c *client.Client, execID string, stream client.OutputStream) (string, error) {
+	var b strings.Builder
+	opts := &client.ReadOutputOptions{Limit: logChunkSize, WithTimestamps: o.timestamps}
+	failures := 0
+	for {
+		chunk, err := c.ReadOutput(ctx, execID, stream, opts)
+		if err != nil {
+			failures++
+			if failures > logReadRetries || ctx.Err() != nil {
+				return "", fmt.Errorf("reading %s: %w", stream, err)
+			}
+			time.Sleep(time.Duration(failures) * time.Second)
+			continue
+		}
+		failures = 0
+
+		b.WriteString(chunk.Data)
+		if chunk.Complete || chunk.NextOffset == opts.Offset {
+			return b.String(), nil
+		}
+		opts.Offset = chunk.NextOffset
+	}
+}
+
+func (o *options) killExecution(cmd *cobra.Command, args []string) error {
+	c := o.newClient()
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		if o.group == "" {
+			return fmt.Errorf("specify an execution ID or --group")
+		}
+		return o.killGroup(ctx, c)
+	}
+	execID := args[0]
+
+	if err := c.KillExecution(ctx, execID); err != nil {
+		return infraError(err)
+	}
+
+	if !o.quiet {
+		fmt.Println("Execution killed")
+	}
+
+	return nil
+}
+
+// killGroup kills every execution of the --group group
+func (o *options) killGroup(ctx context.Context, c *client.Client) error {
+	g, err := c.KillGroup(ctx, o.group)
+	if err != nil {
+		return infraError(err)
+	}
+
+	if !o.quiet {
+		fmt.Printf("Group %s: %s (%d executions)\n", g.ID, g.Status, g.Total)
+	}
+
+	return nil
+}
+
+func (o *options) evalExecution(cmd *cobra.Command, args []string) error {
+	var code string
+
+	if len(args) >= 1 {
+		code = args[0]
+	} else {
+		// Read from stdin
+		stdinData, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("reading stdin: %w", err)
+		}
+		if len(stdinData) == 0 {
+			return fmt.Errorf("no input provided: either specify code as an argument or pipe via stdin")
+		}
+		code = string(stdinData)
+	}
+
+	c := o.newClient()
+	ctx := context.Background()
+
+	req := &client.SimpleExecRequest{
+		Code:         code,
+		EvalLastExpr: !o.noResult,
+		Packages:     o.packages,
+	}
+
+	if o.pythonVersion != "" {
+		req.PythonVersion = o.pythonVersion
+	}
+
+	// Leave detection to the server unless the flag was given
+	if cmd.Flags().Changed("auto-install") {
+		req.AutoInstall = &o.autoInstall
+	}
+
+	if o.timeout > 0 || o.isDeterministic() || o.fakeTime != "" || o.artifactsOut != "" {
+		req.Config = &client.ExecutionConfig{
+			TimeoutSeconds:   o.timeout,
+			Deterministic:    o.isDeterministic(),
+			Seed:             o.seed,
+			FakeTime:         o.fakeTime,
+			CollectArtifacts: o.artifactsOut != "",
+		}
+	}
+	req.Retry = o.retryPolicy()
+	req.GroupID = o.group
+	req.Labels = o.labels
+	req.Secrets = o.secretNames
+	req.Placement = o.placement
+	req.Preset = o.preset
+
+	status := o.startStatus("Running")
+	result, err := c.Eval(ctx, req)
+	status.close()
+	if err != nil {
+		return infraError(err)
+	}
+	if err := o.saveArtifacts(ctx, c, result.ExecutionID); err != nil {
+		return infraError(err)
+	}
+
+	o.printEvalResult(result)
+	os.Exit(resultExitCode(result))
+	return nil
+}
+
+func (o *options) printEvalResult(result *client.ExecutionResult) {
+	if o.quiet {
+		if result.ExitCode == 0 {
+			// In quiet mode, prefer result over stdout for eval
+			if result.Result != nil && *result.Result != "" {
+				fmt.Println(*result.Result)
+			} else if result.Stdout != "" {
+				fmt.Print(result.Stdout)
+			}
+		}
+		return
+	}
+
+	if o.verbose {
+		fmt.Fprintf(os.Stderr, "Execution ID: %s\n", result.ExecutionID)
+		fmt.Fprintf(os.Stderr, "Status: %s\n", result.Status)
+		if result.DurationMs > 0 {
+			fmt.Fprintf(os.Stderr, "Duration: %dms\n", result.DurationMs)
+		}
+		if result.CPU != nil {
+			fmt.Fprintf(os.Stderr, "CPU: %dms user, %dms system, %dms throttled\n", result.CPU.UserMs, result.CPU.SystemMs, result.CPU.ThrottledMs)
+		}
+		if t := result.Timings; t != nil {
+			fmt.Fprintf(os.Stderr, "Timings: %dms queued, %dms pull, %dms install, %dms run\n", t.QueueMs, t.PullMs, t.InstallMs, t.RunMs)
+		}
+		if result.Install != nil {
+			fmt.Fprintf(os.Stderr, "Install: %dms (exit code %d)\n", result.Install.DurationMs, result.Install.ExitCode)
+			if len(result.Install.Detected) > 0 {
+				fmt.Fprintf(os.Stderr, "Detected: %s\n", strings.Join(result.Install.Detected, ", "))
+			}
+			for _, pkg := range result.Install.Packages {
+				fmt.Fprintf(os.Stderr, "  %s\n", pkg)
+			}
+		}
+		if m := result.Manifest; m != nil {
+			fmt.Fprintf(os.Stderr, "Image: %s\n", formatManifest(m))
+		}
+		for _, a := range result.Attempts {
+			line := fmt.Sprintf("Attempt %d: %s (exit code %d)", a.Attempt, a.FailureKind, a.ExitCode)
+			if a.Error != "" {
+				line += ": " + a.Error
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+		if result.ErrorType != "" {
+			fmt.Fprintf(os.Stderr, "Error Type: %s\n", result.ErrorType)
+		}
+		if result.ErrorLine > 0 {
+			fmt.Fprintf(os.Stderr, "Error Line: %d\n", result.ErrorLine)
+		}
+		for _, a := range result.Artifacts {
+			fmt.Fprintf(os.Stderr, "Artifact: %s (%s, %d bytes)\n", a.Name, a.ContentType, a.Size)
+		}
+		if len(result.StructuredOutput) > 0 {
+			fmt.Fprintf(os.Stderr, "Structured Output: %s\n", result.StructuredOutput)
+		}
+		fmt.Fprintf(os.Stderr, "---\n")
+	}
+
+	// Show why the script never ran
+	if result.Install != nil && result.Install.ExitCode != 0 {
+		fmt.Fprint(os.Stderr, result.Install.Stdout)
+		fmt.Fprint(os.Stderr, result.Install.Stderr)
+	}
+
+	// Print stdout first
+	if result.Stdout != "" {
+		fmt.Print(result.Stdout)
+	}
+
+	// Print result (expression value)
+	if result.Result != nil && *result.Result != "" {
+		fmt.Println(*result.Result)
+	}
+
+	// Print stderr
+	if result.Stderr != "" {
+		fmt.Fprint(os.Stderr, result.Stderr)
+	}
+
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
+	}
+
+	if t := result.Tests; t != nil {
+		fmt.Fprintf(os.Stderr, "Tests: %d passed, %d failed, %d errors, %d skipped in %dms\n", t.Passed, t.Failed, t.Errors, t.Skipped, t.DurationMs)
+	}
+
+	if cov := result.Coverage; cov != nil {
+		fmt.Fprintf(os.Stderr, "Coverage: %.2f%% (%d/%d lines)\n", cov.Percent, cov.LinesCovered, cov.LinesValid)
+	}
+
+	// Point at the full logs of streams cut to the inline limit
+	for _, a := range result.Artifacts {
+		if a.URL != "" && isLog(a.Name) {
+			fmt.Fprintf(os.Stderr, "Truncated: full %s (%d bytes) at %s%s\n", a.Name, a.Size, strings.TrimSuffix(o.serverURL, "/"), a.URL)
+		}
+	}
+
+	if result.StructuredOutputError != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", result.StructuredOutputError)
+	}
+
+	if result.Signal != "" || result.TerminationReason != "" {
+		fmt.Fprintf(os.Stderr, "Terminated: %s\n", formatTermination(result))
+	}
+}
+
+// isLog reports whether an artifact holds the full log of a stream cut to
+// the inline limit
+func isLog(name string) bool {
+	switch name {
+	case "stdout.log", "stderr.log", "output.log":
+		return true
+	}
+	return false
+}
+
+// saveArtifacts downloads an execution's artifacts under the --artifacts
+// directory, if it was given
+func (o *options) saveArtifacts(ctx context.Context, c *client.Client, execID string) error {
+	if o.artifactsOut == "" {
+		return nil
+	}
+	artifacts, err := c.DownloadArtifacts(ctx, execID, o.artifactsOut)
+	if err != nil {
+		return fmt.Errorf("saving artifacts: %w", err)
+	}
+	if !o.quiet {
+		fmt.Fprintf(os.Stderr, "Saved %d artifacts to %s\n", len(artifacts), o.artifactsOut)
+	}
+	return nil
+}
+
+// splitArgsAtDash separates positional args from script args at the -- separator
+func splitArgsAtDash(cmd *cobra.Command, args []string) ([]string, []string) {
+	dashIdx := cmd.ArgsLenAtDash()
+	if dashIdx == -1 {
+		return args, nil
+	}
+	return args[:dashIdx], args[dashIdx:]
+}
+
+// resolveEnvVars processes --env flags, resolving VAR to VAR=value from environment
+func resolveEnvVars(envFlags []string) ([]string, error) {
+	result := make([]string, 0, len(envFlags))
+
+	for _, env := range envFlags {
+		if strings.Contains(env, "=") {
+			// Explicit value: VAR=value
+			result = append(result, env)
+		} else {
+			// Forward from environment: VAR
+			value, exists := os.LookupEnv(env)
+			if !exists {
+				return nil, fmt.Errorf("environment variable %q not set", env)
+			}
+			result = append(result, fmt.Sprintf("%s=%s", env, value))
+		}
+	}
+
+	return result, nil
+}
+
+// prepareExecution creates tar and metadata from inputs, also returning
+// the entries left out of a directory
+func (o *options) prepareExecution(args []string, scriptArgs []string) ([]byte, []string, *client.Metadata, error) {
+	var tarData []byte
+	var ignored []string
+	var err error
+
+	// Priority 1: --file flags
+	if len(o.files) > 0 {
+		tarData, err = client.TarFromFiles(o.files)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("creating tar from files: %w", err)
+		}
+	} else if len(args) == 1 {
+		// Check what kind of argument it is
+		arg := args[0]
+
+		if strings.HasSuffix(arg, ".tar") || strings.HasSuffix(arg, ".tar.gz") || strings.HasSuffix(arg, ".tgz") {
+			// Priority 2: Explicit tar file, sent compressed if it is
+			// gzipped
+			tarData, err = os.ReadFile(arg)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("reading tar file: %w", err)
+			}
+		} else {
+			info, err := os.Stat(arg)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("stat %s: %w", arg, err)
+			}
+
+			if info.IsDir() {
+				// Priority 3: Directory
+				tarData, ignored, err = client.TarFromDirectoryExcluding(arg, slices.Concat(defaultExcludes, o.excludes))
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("creating tar from directory: %w", err)
+				}
+			} else {
+				// Priority 4: Single file
+				tarData, err = client.TarFromFiles([]string{arg})
+				if err != nil {
+					return nil, nil, nil, fmt.Errorf("creating tar from file: %w", err)
+				}
+			}
+		}
+	} else if len(args) == 0 {
+		// Priority 5: Stdin
+		stdinData, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading stdin: %w", err)
+		}
+
+		// Validate stdin is not empty
+		if len(stdinData) == 0 {
+			return nil, nil, nil, fmt.Errorf("no input provided: either specify a file/directory argument or pipe code via stdin")
+		}
+
+		tarData, err = client.TarFromReader(strings.NewReader(string(stdinData)), "main.py")
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("creating tar from stdin: %w", err)
+		}
+	} else {
+		return nil, nil, nil, fmt.Errorf("invalid arguments")
+	}
+
+	// Detect entrypoint if not specified. pytest discovers the tests itself.
+	entry := o.entrypoint
+	if entry == "" && !o.pytestMode {
+		entry, err = client.DetectEntrypoint(tarData)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("detecting entrypoint: %w", err)
+		}
+	}
+
+	// Resolve environment variables
+	resolvedEnvVars, err := resolveEnvVars(o.envVars)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Build metadata
+	meta := &client.Metadata{
+		Entrypoint:   entry,
+		DockerImage:  o.image,
+		GroupID:      o.group,
+		Labels:       o.labels,
+		Secrets:      o.secretNames,
+		Placement:    o.placement,
+		Preset:       o.preset,
+		EnvVars:      resolvedEnvVars,
+		ScriptArgs:   scriptArgs,
+		EvalLastExpr: o.evalLastExpr,
+		AutoInstall:  o.autoInstall,
+		Config: &client.ExecutionConfig{
+			TimeoutSeconds:     o.timeout,
+			NetworkDisabled:    !o.network,
+			InstallNetworkOnly: o.installNetworkOnly,
+			FreezePackages:     o.freezePackages,
+			CombinedOutput:     o.combinedOutput,
+			StripANSI:          o.stripANSI,
+			RecordTimestamps:   o.recordTimestamps,
+			CaptureImages:      o.captureImages,
+			CollectArtifacts:   o.artifactsOut != "",
+			Coverage:           o.coverage,
+			Deterministic:      o.isDeterministic(),
+			Seed:               o.seed,
+			FakeTime:           o.fakeTime,
+			MemoryMB:           o.memoryMB,
+			DiskMB:             o.diskMB,
+			CPUShares:          o.cpuShares,
+		},
+	}
+	if o.pytestMode {
+		meta.Mode = client.ModePytest
+	}
+	meta.Retry = o.retryPolicy()
+
+	// Detected packages need the network to install, but the script doesn't
+	if o.autoInstall && !o.network {
+		meta.Config.InstallNetworkOnly = true
+	}
+
+	// Read requirements file if specified
+	if o.requirementsFile != "" {
+		reqData, err := os.ReadFile(o.requirementsFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("reading requirements file: %w", err)
+		}
+		meta.RequirementsTxt = string(reqData)
+
+		// Enable network access for pip install
+		if !o.network && !o.installNetworkOnly {
+			o.network = true
+			meta.Config.NetworkDisabled = false
+			if !o.quiet {
+				fmt.Fprintln(os.Stderr, "Network access enabled for package installation")
+			}
+		}
+	}
+
+	return tarData, ignored, meta, nil
+}
+
+// retryPolicy returns the retry policy asked for by --retries and
+// --retry-on, or nil to run once
+func (o *options) retryPolicy() *client.RetryPolicy {
+	if o.retries == 0 {
+		return nil
+	}
+	policy := &client.RetryPolicy{MaxRetries: o.retries}
+	for _, kind := range o.retryOn {
+		policy.RetryOn = append(policy.RetryOn, client.FailureKind(kind))
+	}
+	return policy
+}
+
+// isDeterministic reports whether --deterministic was asked for, directly
+// or through --seed
+func (o *options) isDeterministic() bool {
+	return o.deterministic || o.seed != 0
+}
+
+// formatTermination describes the signal and reason that stopped a script
+func formatTermination(result *client.ExecutionResult) string {
+	switch {
+	case result.Signal == "":
+		return string(result.TerminationReason)
+	case result.TerminationReason == "":
+		return result.Signal
+	default:
+		return fmt.Sprintf("%s (%s)", result.Signal, result.TerminationReason)
+	}
+}
+
+// formatManifest describes the image an execution ran on
+func formatManifest(m *client.Manifest) string {
+	s := m.Image
+	if m.ImageDigest != "" {
+		s = m.ImageDigest
+	}
+	var details []string
+	if m.PythonVersion != "" {
+		details = append(details, "Python "+m.PythonVersion)
+	}
+	if m.Platform != "" {
+		details = append(details, m.Platform)
+	}
+	if len(details) > 0 {
+		s += " (" + strings.Join(details, ", ") + ")"
+	}
+	return s
+}
+
+func (o *options) printResult(result *client.ExecutionResult) {
+	if o.quiet {
+		if result.ExitCode == 0 {
+			fmt.Print(result.Stdout)
+			if result.Result != nil && *result.Result != "" {
+				fmt.Println(*result.Result)
+			}
+		}
+		return
+	}
+
+	if o.verbose {
+		fmt.Fprintf(os.Stderr, "Execution ID: %s\n", result.ExecutionID)
+		fmt.Fprintf(os.Stderr, "Status: %s\n", result.Status)
+		if result.DurationMs > 0 {
+			fmt.Fprintf(os.Stderr, "Duration: %dms\n", result.DurationMs)
+		}
+		if result.CPU != nil {
+			fmt.Fprintf(os.Stderr, "CPU: %dms user, %dms system, %dms throttled\n", result.CPU.UserMs, result.CPU.SystemMs, result.CPU.ThrottledMs)
+		}
+		if t := result.Timings; t != nil {
+			fmt.Fprintf(os.Stderr, "Timings: %dms queued, %dms pull, %dms install, %dms run\n", t.QueueMs, t.PullMs, t.InstallMs, t.RunMs)
+		}
+		if result.Install != nil {
+			fmt.Fprintf(os.Stderr, "Install: %dms (exit code %d)\n", result.Install.DurationMs, result.Install.ExitCode)
+			for _, pkg := range result.Install.Packages {
+				fmt.Fprintf(os.Stderr, "  %s\n", pkg)
+			}
+		}
+		if m := result.Manifest; m != nil {
+			fmt.Fprintf(os.Stderr, "Image: %s\n", formatManifest(m))
+		}
+		if result.ErrorType != "" {
+			fmt.Fprintf(os.Stderr, "Error Type: %s\n", result.ErrorType)
+		}
+		if result.ErrorLine > 0 {
+			fmt.Fprintf(os.Stderr, "Error Line: %d\n", result.ErrorLine)
+		}
+		for _, a := range result.Artifacts {
+			fmt.Fprintf(os.Stderr, "Artifact: %s (%s, %d bytes)\n", a.Name, a.ContentType, a.Size)
+		}
+		if len(result.StructuredOutput) > 0 {
+			fmt.Fprintf(os.Stderr, "Structured Output: %s\n", result.StructuredOutput)
+		}
+		fmt.Fprintf(os.Stderr, "---\n")
+	}
+
+	// Show why the script never ran
+	if result.Install != nil && result.Install.ExitCode != 0 {
+		fmt.Fprint(os.Stderr, result.Install.Stdout)
+		fmt.Fprint(os.Stderr, result.Install.Stderr)
+	}
+
+	// Combined output already holds both streams in order
+	if result.Output != "" {
+		fmt.Print(result.Output)
+	} else if result.Stdout != "" {
+		fmt.Print(result.Stdout)
+	}
+
+	// Print result (expression value)
+	if result.Result != nil && *result.Result != "" {
+		fmt.Println(*result.Result)
+	}
+
+	if result.Stderr != "" && result.Output == "" {
+		fmt.Fprint(os.Stderr, result.Stderr)
+	}
+
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", result.Error)
+	}
+
+	if result.StructuredOutputError != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", result.StructuredOutputError)
+	}
+
+	if result.Signal != "" || result.TerminationReason != "" {
+		fmt.Fprintf(os.Stderr, "Terminated: %s\n", formatTermination(result))
+	}
+}
+
+// newClient creates a client of the server, sending the API key if one is
+// given. The key's default comes from the environment here rather than in
+// the flag, so that help doesn't print it.
+func (o *options) newClient(opts ...client.Option) *client.Client {
+	key := o.apiKey
+	if key == "" {
+		key = os.Getenv("PYEXEC_API_KEY")
+	}
+	if key != "" {
+		opts = append(opts, client.WithAPIKey(key))
+	}
+	return client.New(o.serverURL, opts...)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// formatProgress renders a progress report as "42% message"
+func formatProgress(p *client.Progress) string {
+	var parts []string
+	if p.Percent != nil {
+		parts = append(parts, fmt.Sprintf("%.0f%%", *p.Percent))
+	}
+	if p.Message != "" {
+		parts = append(parts, p.Message)
+	}
+	if len(parts) == 0 {
+		return "heartbeat"
+	}
+	return strings.Join(parts, " ")
+}
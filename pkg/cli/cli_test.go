@@ -1,4 +1,4 @@
-package main
+package cli
 
 import (
 	"os"
@@ -78,3 +78,16 @@ func TestResolveEnvVars_ValueWithEquals(t *testing.T) {
 		t.Errorf("got %v, want %v", result, expected)
 	}
 }
+
+func TestNewRootCmd_OwnFlags(t *testing.T) {
+	// Root commands built in one process don't share flag values
+	first, second := NewRootCmd(), NewRootCmd()
+	if err := first.PersistentFlags().Parse([]string{"--timeout", "60", "--label", "team=ml"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"timeout", "label"} {
+		if got := second.PersistentFlags().Lookup(name); got.Changed || got.Value.String() == first.PersistentFlags().Lookup(name).Value.String() {
+			t.Errorf("--%s of the second command = %q, want its default", name, got.Value)
+		}
+	}
+}
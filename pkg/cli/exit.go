@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// Exit codes the CLI reserves for outcomes other than the script's own
+// exit, following the conventions of timeout(1) and docker run.
+const (
+	// ExitTimeout means the script ran past its timeout, or the server did
+	// not answer in time.
+	ExitTimeout = 124
+	// ExitInfraError means the script could not be run: the server could
+	// not be reached, rejected the request, or failed to execute it.
+	ExitInfraError = 125
+	// ExitKilled means the execution was killed, cancelled or rejected
+	// before the script finished.
+	ExitKilled = 137
+)
+
+// ExitError is an error that ends the CLI with a specific exit code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// ExitCode returns the exit code the CLI ends with for an error returned by
+// its commands: the code of an ExitError, or 1 for usage and local errors.
+func ExitCode(err error) int {
+	var exitErr *ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	}
+	return 1
+}
+
+// infraError marks an error talking to the server, so the CLI exits with
+// ExitTimeout or ExitInfraError rather than a code the script could have
+// returned.
+func infraError(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := ExitInfraError
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout() {
+		code = ExitTimeout
+	}
+	return &ExitError{Code: code, Err: err}
+}
+
+// resultExitCode returns the exit code the CLI ends with for a finished
+// execution: the script's own, unless the script did not run to its end.
+func resultExitCode(result *client.ExecutionResult) int {
+	switch {
+	case result.TerminationReason == client.TerminationTimeout:
+		return ExitTimeout
+	case result.Status == client.StatusKilled, result.Status == client.StatusCancelled:
+		return ExitKilled
+	case result.Status == client.StatusFailed:
+		return ExitInfraError
+	}
+	return result.ExitCode
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, 0},
+		{"usage error", errors.New("no input provided"), 1},
+		{"server error", infraError(errors.New("server error (status 503)")), ExitInfraError},
+		{"client timeout", infraError(fmt.Errorf("executing: %w", context.DeadlineExceeded)), ExitTimeout},
+		{"wrapped", fmt.Errorf("follow: %w", infraError(errors.New("connection refused"))), ExitInfraError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.err); got != tt.want {
+				t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		result client.ExecutionResult
+		want   int
+	}{
+		{"completed", client.ExecutionResult{Status: client.StatusCompleted}, 0},
+		{"script failed", client.ExecutionResult{Status: client.StatusCompleted, ExitCode: 3}, 3},
+		{"out of memory", client.ExecutionResult{Status: client.StatusCompleted, ExitCode: 137, TerminationReason: client.TerminationOOM}, 137},
+		{"timed out", client.ExecutionResult{Status: client.StatusFailed, TerminationReason: client.TerminationTimeout}, ExitTimeout},
+		{"infra error", client.ExecutionResult{Status: client.StatusFailed, Error: "pulling image"}, ExitInfraError},
+		{"killed", client.ExecutionResult{Status: client.StatusKilled, ExitCode: 0}, ExitKilled},
+		{"cancelled", client.ExecutionResult{Status: client.StatusCancelled}, ExitKilled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resultExitCode(&tt.result); got != tt.want {
+				t.Errorf("resultExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
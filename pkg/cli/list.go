@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// listOptions holds the list command's flag values
+type listOptions struct {
+	statuses []string
+	since    string
+	until    string
+	search   string
+	limit    int
+	cursor   string
+	all      bool
+	json     bool
+}
+
+// listFields are the result fields the list table shows
+var listFields = []string{"exit_code", "started_at", "duration_ms", "labels"}
+
+func (o *options) listCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List executions",
+		Long: `List the executions stored on the server, newest first.
+
+Filters combine: only executions matching all of them are listed. --label
+matches executions with the label, and can be repeated. --since and
+--until take an RFC 3339 time or a duration before now, e.g. 24h.
+
+At most --limit executions are listed; when there are more, the cursor of
+the next page is printed to stderr. --all lists every page.
+
+Examples:
+  python-executor list
+  python-executor list --status failed --since 24h
+  python-executor list --label team=ml --search train.py --all
+  python-executor list --json --limit 100 | jq -r '.executions[].execution_id'`,
+		Args: cobra.NoArgs,
+		RunE: o.listExecutions,
+	}
+
+	cmd.Flags().StringSliceVar(&o.list.statuses, "status", nil, "Only executions in these statuses, e.g. running,pending")
+	cmd.Flags().StringVar(&o.list.since, "since", "", "Only executions created at or after this time or duration ago")
+	cmd.Flags().StringVar(&o.list.until, "until", "", "Only executions created before this time or duration ago")
+	cmd.Flags().StringVar(&o.list.search, "search", "", "Only executions whose entrypoint or error contains this text")
+	cmd.Flags().IntVar(&o.list.limit, "limit", 20, "Most executions to list per page")
+	cmd.Flags().StringVar(&o.list.cursor, "cursor", "", "Continue from the cursor a previous list printed")
+	cmd.Flags().BoolVar(&o.list.all, "all", false, "List every page")
+	cmd.Flags().BoolVar(&o.list.json, "json", false, "Print the full results as JSON")
+
+	return cmd
+}
+
+func (o *options) listExecutions(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+	opts := &client.ListExecutionsOptions{
+		Labels: o.labels,
+		Text:   o.list.search,
+		Limit:  o.list.limit,
+		Cursor: o.list.cursor,
+	}
+	for _, status := range o.list.statuses {
+		opts.Statuses = append(opts.Statuses, client.ExecutionStatus(status))
+	}
+	var err error
+	if opts.Since, err = parseTimeFlag("since", o.list.since, now); err != nil {
+		return err
+	}
+	if opts.Until, err = parseTimeFlag("until", o.list.until, now); err != nil {
+		return err
+	}
+	if o.list.json {
+		opts.IncludeOutput = true
+	} else {
+		opts.Fields = listFields
+	}
+
+	c := o.newClient()
+	ctx := context.Background()
+
+	list := &client.ExecutionList{Executions: []client.ExecutionResult{}}
+	for {
+		page, err := c.ListExecutions(ctx, opts)
+		if err != nil {
+			return infraError(err)
+		}
+		list.Executions = append(list.Executions, page.Executions...)
+		list.NextCursor = page.NextCursor
+		if !o.list.all || page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	if o.list.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	}
+	printExecutions(os.Stdout, list.Executions)
+	if list.NextCursor != "" && !o.quiet {
+		fmt.Fprintf(os.Stderr, "More executions: --cursor %s\n", list.NextCursor)
+	}
+	return nil
+}
+
+// parseTimeFlag parses a --since or --until value: an RFC 3339 time, or a
+// duration before now. Empty means no bound.
+func parseTimeFlag(name, value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s %q: use an RFC 3339 time (2024-01-15T10:30:00Z) or a duration (24h)", name, value)
+	}
+	return t, nil
+}
+
+// printExecutions writes a table of executions, one per line
+func printExecutions(w io.Writer, results []client.ExecutionResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXECUTION ID\tSTATUS\tEXIT\tSTARTED\tDURATION\tLABELS")
+	for _, r := range results {
+		exit, started, duration := "-", "-", "-"
+		if r.Status == client.StatusCompleted || r.Status == client.StatusFailed {
+			exit = fmt.Sprint(r.ExitCode)
+		}
+		if r.StartedAt != nil {
+			started = r.StartedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		if r.DurationMs > 0 {
+			duration = (time.Duration(r.DurationMs) * time.Millisecond).String()
+		}
+
+		var pairs []string
+		for key, value := range r.Labels {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ExecutionID, r.Status, exit, started, duration, strings.Join(pairs, ","))
+	}
+	tw.Flush()
+}
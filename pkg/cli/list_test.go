@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestPrintExecutions(t *testing.T) {
+	started := time.Date(2026, 1, 15, 10, 30, 0, 0, time.Local)
+	results := []client.ExecutionResult{
+		{ExecutionID: "exe_2", Status: client.StatusPending},
+		{ExecutionID: "exe_1", Status: client.StatusFailed, ExitCode: 1, StartedAt: &started, DurationMs: 1500, Labels: map[string]string{"team": "ml", "run": "7"}},
+	}
+
+	var buf bytes.Buffer
+	printExecutions(&buf, results)
+	want := "EXECUTION ID  STATUS   EXIT  STARTED              DURATION  LABELS\n" +
+		"exe_2         pending  -     -                    -         \n" +
+		"exe_1         failed   1     2026-01-15 10:30:00  1.5s      run=7,team=ml\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"", time.Time{}},
+		{"24h", now.Add(-24 * time.Hour)},
+		{"2026-01-01T00:00:00Z", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeFlag("since", tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTimeFlag(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if _, err := parseTimeFlag("since", "yesterday", now); err == nil || !strings.Contains(err.Error(), "--since") {
+		t.Errorf("parseTimeFlag(yesterday) error = %v, want one naming --since", err)
+	}
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// parallelRun is one input of run --parallel and how its execution went
+type parallelRun struct {
+	input   string
+	tarData []byte
+	meta    *client.Metadata
+
+	status   string // "waiting", "running", then the final status
+	started  time.Time
+	duration time.Duration
+	result   *client.ExecutionResult
+	err      error
+}
+
+// exitCode returns the exit code the CLI would end with for the run alone
+func (r *parallelRun) exitCode() int {
+	if r.err != nil {
+		return ExitCode(infraError(r.err))
+	}
+	return resultExitCode(r.result)
+}
+
+// runParallel runs every input matched by patterns as its own execution,
+// --parallel at a time. A status table is kept on stderr while they run;
+// then each execution's output is printed in input order, and the CLI exits
+// with the highest exit code among them.
+func (o *options) runParallel(patterns, scriptArgs []string) error {
+	switch {
+	case o.async:
+		return fmt.Errorf("--async is not supported with --parallel")
+	case o.stdinFile != "":
+		return fmt.Errorf("--stdin-file is not supported with --parallel")
+	case len(o.files) > 0:
+		return fmt.Errorf("--file is not supported with --parallel; pass the files as arguments")
+	case o.dryRun || o.showFiles:
+		return fmt.Errorf("--dry-run and --show-files are not supported with --parallel")
+	}
+
+	inputs, err := expandInputs(patterns)
+	if err != nil {
+		return err
+	}
+
+	// Prepare every input first, so that a bad one fails before any runs
+	runs := make([]*parallelRun, len(inputs))
+	for i, input := range inputs {
+		tarData, _, meta, err := o.prepareExecution([]string{input}, scriptArgs)
+		if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		runs[i] = &parallelRun{input: input, tarData: tarData, meta: meta, status: "waiting"}
+	}
+
+	// Quiet mode shows no table
+	var table *runTable
+	if o.quiet {
+		table = newRunTable(io.Discard, runs, false)
+	} else {
+		table = newRunTable(os.Stderr, runs, isTerminal(os.Stderr) && !o.noProgress)
+	}
+	table.start()
+
+	c := o.newClient()
+	ctx := context.Background()
+	next := make(chan *parallelRun)
+	var wg sync.WaitGroup
+	for range min(o.parallel, len(runs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range next {
+				table.update(run, func() {
+					run.status = "running"
+					run.started = time.Now()
+				})
+				result, err := c.ExecuteSync(ctx, run.tarData, run.meta)
+				table.update(run, func() {
+					run.duration = time.Since(run.started)
+					run.result, run.err = result, err
+					if err != nil {
+						run.status = "error"
+					} else {
+						run.status = string(result.Status)
+					}
+				})
+			}
+		}()
+	}
+	for _, run := range runs {
+		next <- run
+	}
+	close(next)
+	wg.Wait()
+	table.stop()
+
+	code := 0
+	for _, run := range runs {
+		if !o.quiet {
+			fmt.Printf("==> %s <==\n", run.input)
+		}
+		if run.err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", run.err)
+		} else {
+			o.printResult(run.result)
+		}
+		code = max(code, run.exitCode())
+	}
+	if code != 0 {
+		os.Exit(code)
+	}
+	return nil
+}
+
+// expandInputs expands glob patterns to the inputs they match, in order and
+// without duplicates. A pattern that matches nothing is an error.
+func expandInputs(patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("--parallel needs files, directories or patterns to run, e.g. 'jobs/*.py'")
+	}
+	var inputs []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		for _, m := range matches {
+			if !slices.Contains(inputs, m) {
+				inputs = append(inputs, m)
+			}
+		}
+	}
+	return inputs, nil
+}
+
+// runTable shows the status of parallel executions. Live, it is redrawn in
+// place on every change and every second; otherwise a row is printed as
+// each execution finishes.
+type runTable struct {
+	w     io.Writer
+	live  bool
+	runs  []*parallelRun
+	width int // of the input column
+
+	mu     sync.Mutex
+	drawn  bool
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+func newRunTable(w io.Writer, runs []*parallelRun, live bool) *runTable {
+	width := len("INPUT")
+	for _, run := range runs {
+		width = max(width, len(run.input))
+	}
+	return &runTable{w: w, live: live, runs: runs, width: width, done: make(chan struct{})}
+}
+
+// start prints the header, or starts redrawing the live table
+func (t *runTable) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.live {
+		fmt.Fprintln(t.w, t.header())
+		return
+	}
+	t.draw()
+	t.ticker = time.NewTicker(time.Second)
+	go func() {
+		for {
+			select {
+			case <-t.done:
+				return
+			case <-t.ticker.C:
+				t.mu.Lock()
+				t.draw()
+				t.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// update changes a run under the table's lock and shows the change
+func (t *runTable) update(run *parallelRun, change func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	change()
+	switch {
+	case t.live:
+		t.draw()
+	case run.status != "running":
+		fmt.Fprintln(t.w, t.row(run))
+	}
+}
+
+// stop stops redrawing, leaving the final table in place
+func (t *runTable) stop() {
+	if !t.live {
+		return
+	}
+	t.ticker.Stop()
+	close(t.done)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draw()
+}
+
+// draw draws the whole table over the previous one. Callers hold t.mu.
+func (t *runTable) draw() {
+	var b strings.Builder
+	if t.drawn {
+		fmt.Fprintf(&b, "\x1b[%dA", len(t.runs)+1)
+	}
+	b.WriteString("\r\x1b[K" + t.header() + "\n")
+	for _, run := range t.runs {
+		b.WriteString("\r\x1b[K" + t.row(run) + "\n")
+	}
+	io.WriteString(t.w, b.String())
+	t.drawn = true
+}
+
+func (t *runTable) header() string {
+	return fmt.Sprintf("%-*s  %-10s  %4s  %s", t.width, "INPUT", "STATUS", "EXIT", "TIME")
+}
+
+func (t *runTable) row(run *parallelRun) string {
+	exit, elapsed := "", ""
+	switch run.status {
+	case "waiting":
+	case "running":
+		elapsed = time.Since(run.started).Round(time.Second).String()
+	default:
+		exit = fmt.Sprint(run.exitCode())
+		elapsed = run.duration.Round(100 * time.Millisecond).String()
+	}
+	return fmt.Sprintf("%-*s  %-10s  %4s  %s", t.width, run.input, run.status, exit, elapsed)
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.py", "b.py", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("print(1)"), 0644)
+	}
+	a, b := filepath.Join(dir, "a.py"), filepath.Join(dir, "b.py")
+
+	// Matches are kept in order, once each
+	got, err := expandInputs([]string{filepath.Join(dir, "*.py"), a})
+	if err != nil || !slices.Equal(got, []string{a, b}) {
+		t.Errorf("expandInputs() = %v, %v", got, err)
+	}
+
+	if _, err := expandInputs([]string{filepath.Join(dir, "*.ipynb")}); err == nil {
+		t.Error("expandInputs() with a pattern matching nothing = nil error")
+	}
+	if _, err := expandInputs(nil); err == nil {
+		t.Error("expandInputs() with no patterns = nil error")
+	}
+}
+
+func TestRunTable(t *testing.T) {
+	runs := []*parallelRun{
+		{input: "jobs/first.py", status: "waiting"},
+		{input: "jobs/second.py", status: "waiting"},
+	}
+	var out bytes.Buffer
+	table := newRunTable(&out, runs, false)
+	table.start()
+
+	// Rows are printed as executions finish, with the exit code the CLI
+	// would end with
+	table.update(runs[1], func() { runs[1].status = "running" })
+	table.update(runs[1], func() {
+		runs[1].status, runs[1].duration = "completed", 1500*time.Millisecond
+		runs[1].result = &client.ExecutionResult{Status: client.StatusCompleted, ExitCode: 2}
+	})
+	table.update(runs[0], func() {
+		runs[0].status, runs[0].err = "error", errors.New("connection refused")
+	})
+	table.stop()
+
+	want := []string{
+		"INPUT           STATUS      EXIT  TIME",
+		"jobs/second.py  completed      2  1.5s",
+		"jobs/first.py   error        125  0s",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("table =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
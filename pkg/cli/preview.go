@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// defaultExcludes are left out of directories sent to the server, as
+// they are never needed to run the code
+var defaultExcludes = []string{".git", "__pycache__", "*.pyc"}
+
+// secretPatterns match names of files that usually hold credentials
+var secretPatterns = []string{
+	".env", ".env.*", "*.pem", "*.key", "*.p12", "id_rsa*", "id_ecdsa*", "id_ed25519*",
+	".netrc", ".pypirc", ".npmrc", "credentials*", "*secret*",
+}
+
+// previewExecution prints what --dry-run and --show-files ask for, and
+// reports whether the command is done. --show-files writes to stderr so
+// that the script's output stays clean.
+func (o *options) previewExecution(tarData []byte, ignored []string, meta *client.Metadata) (bool, error) {
+	switch {
+	case o.dryRun:
+		return true, printPreview(os.Stdout, tarData, ignored, meta)
+	case o.showFiles:
+		return false, printPreview(os.Stderr, tarData, ignored, meta)
+	}
+	return false, nil
+}
+
+// printPreview describes an archive before it is sent: its files and
+// sizes, what was left out, the entrypoint, and files that look like
+// secrets or virtualenvs
+func printPreview(w io.Writer, tarData []byte, ignored []string, meta *client.Metadata) error {
+	entries, err := client.ListArchive(tarData)
+	if err != nil {
+		return fmt.Errorf("reading archive: %w", err)
+	}
+
+	var files []client.ArchiveEntry
+	var total int64
+	for _, e := range entries {
+		if e.Mode.IsDir() {
+			continue
+		}
+		files = append(files, e)
+		total += e.Size
+	}
+
+	fmt.Fprintf(w, "Files (%d, %s):\n", len(files), formatSize(total))
+	for _, e := range files {
+		name := e.Name
+		if e.Linkname != "" {
+			name += " -> " + e.Linkname
+		}
+		fmt.Fprintf(w, "  %s %9s  %s\n", e.Mode, formatSize(e.Size), name)
+	}
+
+	if len(ignored) > 0 {
+		fmt.Fprintf(w, "Ignored (%d):\n", len(ignored))
+		for _, name := range ignored {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+
+	switch {
+	case meta.Entrypoint != "":
+		fmt.Fprintf(w, "Entrypoint: %s\n", meta.Entrypoint)
+	case meta.Mode == client.ModePytest:
+		fmt.Fprintln(w, "Entrypoint: none (pytest discovers the tests)")
+	}
+
+	for _, warning := range previewWarnings(files) {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	return nil
+}
+
+// previewWarnings flags files that look like secrets, and directories
+// that hold virtualenvs, which are rarely meant to be sent
+func previewWarnings(files []client.ArchiveEntry) []string {
+	var warnings []string
+	for _, e := range files {
+		name := filepath.Base(e.Name)
+		if name == "pyvenv.cfg" {
+			dir := filepath.Dir(e.Name)
+			if dir == "." {
+				warnings = append(warnings, "the archive is a virtualenv (pyvenv.cfg)")
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%s/ is a virtualenv; exclude it with --exclude %s", dir, dir))
+			}
+			continue
+		}
+		for _, pattern := range secretPatterns {
+			if ok, _ := filepath.Match(pattern, strings.ToLower(name)); ok {
+				warnings = append(warnings, fmt.Sprintf("%s may hold secrets", e.Name))
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// formatSize renders a byte count as B, KB or MB
+func formatSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestPrintPreview(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.py"), []byte("print('hi')"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("TOKEN=x"), 0644)
+	os.MkdirAll(filepath.Join(dir, "venv"), 0755)
+	os.WriteFile(filepath.Join(dir, "venv", "pyvenv.cfg"), []byte("home = /usr"), 0644)
+	os.MkdirAll(filepath.Join(dir, "__pycache__"), 0755)
+	os.WriteFile(filepath.Join(dir, "__pycache__", "main.pyc"), []byte("x"), 0644)
+
+	tarData, ignored, err := client.TarFromDirectoryExcluding(dir, defaultExcludes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := printPreview(&out, tarData, ignored, &client.Metadata{Entrypoint: "main.py"}); err != nil {
+		t.Fatalf("printPreview() error = %v", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"Files (3, 29 B):",
+		"-rw-r--r--      11 B  main.py",
+		"Ignored (1):\n  __pycache__/\n",
+		"Entrypoint: main.py\n",
+		"Warning: .env may hold secrets\n",
+		"Warning: venv/ is a virtualenv; exclude it with --exclude venv\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("preview missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPrepareExecution_Excludes(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.py"), []byte("print('hi')"), 0644)
+	os.WriteFile(filepath.Join(dir, "data.csv"), []byte("a,b"), 0644)
+
+	o := &options{excludes: []string{"*.csv"}}
+	tarData, ignored, meta, err := o.prepareExecution([]string{dir}, nil)
+	if err != nil {
+		t.Fatalf("prepareExecution() error = %v", err)
+	}
+	if !slices.Equal(ignored, []string{"data.csv"}) || meta.Entrypoint != "main.py" {
+		t.Errorf("prepareExecution() ignored %v, entrypoint %q", ignored, meta.Entrypoint)
+	}
+	entries, _ := client.ListArchive(tarData)
+	if len(entries) != 1 || entries[0].Name != "main.py" {
+		t.Errorf("archive = %+v, want only main.py", entries)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KB", 5 << 20: "5.0 MB"}
+	for n, want := range tests {
+		if got := formatSize(n); got != want {
+			t.Errorf("formatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"os/signal"
+	"syscall"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+	"github.com/geraldthewes/python-executor/internal/server"
+	"github.com/spf13/cobra"
+)
+
+// serverOptions holds the server command's flag values. Each overrides its
+// environment variable only when given, so the server's own defaults stay
+// in internal/config.
+type serverOptions struct {
+	host          string
+	port          string
+	logLevel      string
+	nodeID        string
+	executor      string
+	dockerSocket  string
+	networkMode   string
+	publicURL     string
+	workers       int
+	maxConcurrent int
+	consulAddr    string
+	snapshotFile  string
+	timeout       int
+	memoryMB      int
+	image         string
+}
+
+func (o *options) serverCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "server",
+		Short: "Run the python-executor server",
+		Long: `Start the python-executor HTTP server in this process, so that one binary
+serves both roles.
+
+The server is configured by the PYEXEC_* environment variables described in
+docs/configuration.md, as the standalone server is. The flags below
+override the most common of them. It shuts down gracefully on SIGINT or
+SIGTERM, giving running executions PYEXEC_SHUTDOWN_DRAIN to finish.
+
+Examples:
+  # Serve on port 9999, running at most 4 executions at once
+  python-executor server --port 9999 --max-concurrent 4
+
+  # Try it out from another terminal
+  python-executor server
+  python-executor eval '2 + 2'`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         o.runServer,
+	}
+
+	cmd.Flags().StringVar(&o.server.host, "host", "", "Address to listen on (env: PYEXEC_HOST, default 0.0.0.0)")
+	cmd.Flags().StringVar(&o.server.port, "port", "", "Port to listen on (env: PYEXEC_PORT, default 8080)")
+	cmd.Flags().StringVar(&o.server.logLevel, "log-level", "", "Log level: debug, info, warn or error (env: PYEXEC_LOG_LEVEL, default info)")
+	cmd.Flags().StringVar(&o.server.nodeID, "node-id", "", "Name of this instance among replicas (env: PYEXEC_NODE_ID, default the hostname)")
+	cmd.Flags().StringVar(&o.server.executor, "executor", "", "Where executions run: docker or runners (env: PYEXEC_EXECUTOR, default docker)")
+	cmd.Flags().StringVar(&o.server.dockerSocket, "docker-socket", "", "Docker socket or daemon address (env: PYEXEC_DOCKER_SOCKET, default detected)")
+	cmd.Flags().StringVar(&o.server.networkMode, "network-mode", "", "Network mode of execution containers: host or bridge (env: PYEXEC_NETWORK_MODE, default host)")
+	cmd.Flags().StringVar(&o.server.publicURL, "public-url", "", "Base URL execution containers reach the server at (env: PYEXEC_PUBLIC_URL)")
+	cmd.Flags().IntVar(&o.server.workers, "workers", 0, "Async execution workers (env: PYEXEC_ASYNC_WORKERS, default 8)")
+	cmd.Flags().IntVar(&o.server.maxConcurrent, "max-concurrent", 0, "Executions running at once, 0 for no limit (env: PYEXEC_MAX_CONCURRENT)")
+	cmd.Flags().StringVar(&o.server.consulAddr, "consul-addr", "", "Consul address for shared storage (env: PYEXEC_CONSUL_ADDR, default in-memory storage)")
+	cmd.Flags().StringVar(&o.server.snapshotFile, "snapshot-file", "", "File in-memory storage is saved to and restored from (env: PYEXEC_SNAPSHOT_FILE)")
+	cmd.Flags().IntVar(&o.server.timeout, "default-timeout", 0, "Default execution timeout in seconds (env: PYEXEC_DEFAULT_TIMEOUT, default 300)")
+	cmd.Flags().IntVar(&o.server.memoryMB, "default-memory", 0, "Default memory limit in MB (env: PYEXEC_DEFAULT_MEMORY_MB, default 1024)")
+	cmd.Flags().StringVar(&o.server.image, "default-image", "", "Default Docker image (env: PYEXEC_DEFAULT_IMAGE, default python:3.12-slim)")
+
+	return cmd
+}
+
+func (o *options) runServer(cmd *cobra.Command, args []string) error {
+	cfg := config.Load()
+	o.applyServerFlags(cmd, cfg)
+	logger := server.NewLogger(cfg)
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return server.Run(ctx, cfg, logger)
+}
+
+// applyServerFlags overrides cfg with the server flags that were given
+func (o *options) applyServerFlags(cmd *cobra.Command, cfg *config.Config) {
+	set := cmd.Flags().Changed
+	if set("host") {
+		cfg.Server.Host = o.server.host
+	}
+	if set("port") {
+		cfg.Server.Port = o.server.port
+	}
+	if set("log-level") {
+		cfg.Server.LogLevel = o.server.logLevel
+	}
+	if set("node-id") {
+		cfg.Server.NodeID = o.server.nodeID
+	}
+	if set("executor") {
+		cfg.Server.Executor = o.server.executor
+	}
+	if set("docker-socket") {
+		cfg.Docker.Socket = o.server.dockerSocket
+	}
+	if set("network-mode") {
+		cfg.Docker.NetworkMode = o.server.networkMode
+	}
+	if set("public-url") {
+		cfg.Server.PublicURL = o.server.publicURL
+	}
+	if set("workers") {
+		cfg.Queue.Workers = o.server.workers
+	}
+	if set("max-concurrent") {
+		cfg.Queue.MaxConcurrent = o.server.maxConcurrent
+	}
+	if set("consul-addr") {
+		cfg.Consul.Address = o.server.consulAddr
+		cfg.Consul.Enabled = o.server.consulAddr != ""
+	}
+	if set("snapshot-file") {
+		cfg.Snapshot.File = o.server.snapshotFile
+	}
+	if set("default-timeout") {
+		cfg.Defaults.Timeout = o.server.timeout
+	}
+	if set("default-memory") {
+		cfg.Defaults.MemoryMB = o.server.memoryMB
+	}
+	if set("default-image") {
+		cfg.Defaults.DockerImage = o.server.image
+	}
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/geraldthewes/python-executor/internal/config"
+)
+
+func TestApplyServerFlags(t *testing.T) {
+	o := &options{}
+	cmd := o.serverCmd()
+	if err := cmd.ParseFlags([]string{"--port", "9999", "--consul-addr", "consul:8500", "--default-timeout", "60"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Server.Host = "0.0.0.0"
+	o.applyServerFlags(cmd, cfg)
+
+	if cfg.Server.Port != "9999" || cfg.Defaults.Timeout != 60 {
+		t.Errorf("config = %+v, want the flags applied", cfg)
+	}
+	if !cfg.Consul.Enabled || cfg.Consul.Address != "consul:8500" {
+		t.Errorf("consul = %+v, want it enabled", cfg.Consul)
+	}
+	// Flags not given leave the environment's values alone
+	if cfg.Server.Host != "0.0.0.0" {
+		t.Errorf("host = %q, want the configured one", cfg.Server.Host)
+	}
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+// statsOptions holds the stats command's flag values
+type statsOptions struct {
+	json bool
+}
+
+func (o *options) statsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show server health and throughput",
+		Long: `Summarize the state of the server instance that answers: running, waiting
+and queued executions against its limits, the stored executions' success
+rate and average duration, and the health of its storage backend.
+
+Behind a load balancer, each call may reach a different replica; the
+storage figures are shared by replicas using the same Consul storage.
+
+Examples:
+  python-executor stats
+  python-executor stats --json | jq .load.saturation`,
+		Args: cobra.NoArgs,
+		RunE: o.showStats,
+	}
+
+	cmd.Flags().BoolVar(&o.stats.json, "json", false, "Print the server's status as JSON")
+
+	return cmd
+}
+
+func (o *options) showStats(cmd *cobra.Command, args []string) error {
+	c := o.newClient()
+	status, err := c.GetStatus(context.Background())
+	if err != nil {
+		return infraError(err)
+	}
+
+	if o.stats.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	printStats(os.Stdout, status)
+	return nil
+}
+
+// printStats writes a summary of a server's status
+func printStats(w io.Writer, s *client.ServerStatus) {
+	node := s.Node
+	if s.Draining {
+		node += " (draining)"
+	}
+	fmt.Fprintf(w, "Node:      %s\n", node)
+
+	load := s.Load
+	running := fmt.Sprint(load.Running)
+	if load.MaxConcurrent > 0 {
+		running = fmt.Sprintf("%d / %d (%.0f%% saturated)", load.Running, load.MaxConcurrent, load.Saturation*100)
+	}
+	fmt.Fprintf(w, "Running:   %s\n", running)
+	fmt.Fprintf(w, "Waiting:   %s\n", withLimit(int(load.Waiting), load.MaxWaiting))
+	if load.QueueError != "" {
+		fmt.Fprintf(w, "Queued:    unknown (%s)\n", load.QueueError)
+	} else {
+		fmt.Fprintf(w, "Queued:    %s\n", withLimit(load.Queued, load.MaxQueueLength))
+	}
+	fmt.Fprintf(w, "Rejected:  %d since start (%s policy)\n", load.Rejected, load.OverloadPolicy)
+	if load.Throttled > 0 {
+		fmt.Fprintf(w, "Throttled: %d since start (over quota)\n", load.Throttled)
+	}
+
+	st := s.Storage
+	if st.Error != "" {
+		fmt.Fprintf(w, "Storage:   unavailable (%s)\n", st.Error)
+		return
+	}
+	storage := fmt.Sprintf("ok, %d executions, %s", st.Executions, formatSize(st.Bytes))
+	if st.Oldest != nil {
+		storage += ", oldest " + st.Oldest.Local().Format("2006-01-02 15:04")
+	}
+	fmt.Fprintf(w, "Storage:   %s\n", storage)
+	if st.Finished > 0 {
+		succeeded := float64(st.Finished-st.Failures) / float64(st.Finished) * 100
+		avg := time.Duration(st.DurationMs/int64(st.Finished)) * time.Millisecond
+		fmt.Fprintf(w, "Finished:  %d, %.1f%% succeeded, %s average\n", st.Finished, succeeded, avg.Round(time.Millisecond))
+	}
+	if len(st.ByStatus) > 0 {
+		var counts []string
+		for _, status := range []client.ExecutionStatus{
+			client.StatusAwaitingApproval,
+			client.StatusPending,
+			client.StatusRunning,
+			client.StatusCompleted,
+			client.StatusFailed,
+			client.StatusKilled,
+			client.StatusCancelled,
+		} {
+			if n := st.ByStatus[status]; n > 0 {
+				counts = append(counts, fmt.Sprintf("%s %d", status, n))
+			}
+		}
+		fmt.Fprintf(w, "By status: %s\n", strings.Join(counts, ", "))
+	}
+}
+
+// withLimit renders a count against its limit, 0 meaning none
+func withLimit(n, limit int) string {
+	if limit <= 0 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%d / %d", n, limit)
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestPrintStats(t *testing.T) {
+	status := &client.ServerStatus{
+		Node:     "node-1",
+		Draining: true,
+		Load: client.LoadStatus{
+			Running:        4,
+			MaxConcurrent:  8,
+			Saturation:     0.5,
+			OverloadPolicy: "queue",
+			Queued:         12,
+			MaxQueueLength: 500,
+			Rejected:       3,
+			Throttled:      5,
+		},
+		Storage: client.StorageStats{
+			Executions: 10,
+			ByStatus:   map[client.ExecutionStatus]int{client.StatusCompleted: 7, client.StatusFailed: 1, client.StatusRunning: 2},
+			Bytes:      2048,
+			Finished:   8,
+			Failures:   2,
+			DurationMs: 12000,
+		},
+	}
+
+	var buf bytes.Buffer
+	printStats(&buf, status)
+	out := buf.String()
+	for _, want := range []string{
+		"Node:      node-1 (draining)\n",
+		"Running:   4 / 8 (50% saturated)\n",
+		"Waiting:   0\n",
+		"Queued:    12 / 500\n",
+		"Throttled: 5 since start (over quota)\n",
+		"Storage:   ok, 10 executions, 2.0 KB\n",
+		"Finished:  8, 75.0% succeeded, 1.5s average\n",
+		"By status: running 2, completed 7, failed 1\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	// Failing storage is reported, not its stale figures
+	status.Storage = client.StorageStats{Error: "listing executions: storage unavailable"}
+	buf.Reset()
+	printStats(&buf, status)
+	if out := buf.String(); !strings.Contains(out, "Storage:   unavailable (listing executions: storage unavailable)") || strings.Contains(out, "Finished") {
+		t.Errorf("output with failing storage:\n%s", out)
+	}
+}
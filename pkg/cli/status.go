@@ -0,0 +1,192 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+// statusDelay is how long the CLI waits before drawing the status line, so
+// quick executions print nothing but their output
+const statusDelay = 500 * time.Millisecond
+
+// statusInterval is how often the status line is redrawn
+const statusInterval = 100 * time.Millisecond
+
+// uploadBarMin is the size from which an upload shows a progress bar
+const uploadBarMin = 1 << 20
+
+// uploadBarWidth is the number of characters of the upload progress bar
+const uploadBarWidth = 30
+
+// spinnerFrames are drawn in turn at the start of the status line
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// statusLine draws an upload progress bar, or a spinner with what the
+// execution is doing, on one line redrawn in place. Its methods may be
+// called from any goroutine; a nil statusLine draws nothing.
+type statusLine struct {
+	w     io.Writer
+	mu    sync.Mutex
+	text  string
+	since time.Time // when text last changed
+	frame int
+	width int // length of the line drawn last, to erase it
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// startStatus starts drawing a status line on stderr, or returns nil if
+// there should be none: in quiet mode, with --no-progress, or when stderr
+// is not a terminal
+func (o *options) startStatus(text string) *statusLine {
+	if o.quiet || o.noProgress || !isTerminal(os.Stderr) {
+		return nil
+	}
+	s := newStatusLine(os.Stderr, text)
+	go s.run()
+	return s
+}
+
+func newStatusLine(w io.Writer, text string) *statusLine {
+	return &statusLine{
+		w:     w,
+		text:  text,
+		since: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// run redraws the status line until close is called
+func (s *statusLine) run() {
+	defer close(s.done)
+
+	delay := time.NewTimer(statusDelay)
+	defer delay.Stop()
+	select {
+	case <-s.stop:
+		return
+	case <-delay.C:
+	}
+
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		s.draw()
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// draw draws the status line over the previous one
+func (s *statusLine) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	line := fmt.Sprintf("%s %s (%s)", spinnerFrames[s.frame%len(spinnerFrames)], s.text, time.Since(s.since).Round(time.Second))
+	s.frame++
+	pad := ""
+	if len(line) < s.width {
+		pad = strings.Repeat(" ", s.width-len(line))
+	}
+	fmt.Fprintf(s.w, "\r%s%s", line, pad)
+	s.width = len(line)
+}
+
+// set changes what the status line says
+func (s *statusLine) set(text string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if text != s.text {
+		s.text = text
+		s.since = time.Now()
+	}
+}
+
+// uploading returns a client.WithUploadProgress callback that shows the
+// progress of large uploads, then next once the upload is sent
+func (s *statusLine) uploading(next string) func(sent, total int64) {
+	if s == nil {
+		return nil
+	}
+	return func(sent, total int64) {
+		switch {
+		case total >= 0 && sent >= total:
+			s.set(next)
+		case total < 0:
+			s.set("Uploading " + formatSize(sent))
+		case total >= uploadBarMin:
+			s.set(formatUpload(sent, total))
+		}
+	}
+}
+
+// close stops drawing and erases the status line. Calls after the first
+// do nothing.
+func (s *statusLine) close() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.width > 0 {
+			fmt.Fprintf(s.w, "\r%s\r", strings.Repeat(" ", s.width))
+		}
+	})
+}
+
+// formatUpload renders an upload's progress as a bar
+func formatUpload(sent, total int64) string {
+	done := int(sent * uploadBarWidth / total)
+	return fmt.Sprintf("Uploading [%s%s] %3d%% %s of %s",
+		strings.Repeat("=", done), strings.Repeat(" ", uploadBarWidth-done),
+		sent*100/total, formatSize(sent), formatSize(total))
+}
+
+// executionStatus describes what an execution is doing
+func executionStatus(r *client.ExecutionResult) string {
+	var s string
+	switch {
+	case r.PausedAt != nil:
+		s = "Paused"
+	case r.Status == client.StatusPending && r.QueuePosition > 0:
+		s = fmt.Sprintf("Queued (position %d)", r.QueuePosition)
+	case r.Status == client.StatusPending:
+		s = "Queued"
+	case r.Status == client.StatusAwaitingApproval:
+		s = "Awaiting approval"
+	case r.Phase == client.PhasePulling:
+		s = "Pulling image"
+	case r.Phase == client.PhaseInstalling:
+		s = "Installing dependencies"
+	default:
+		s = "Running"
+	}
+	if p := r.Progress; p != nil && (p.Percent != nil || p.Message != "") {
+		s += ": " + formatProgress(p)
+	}
+	return s
+}
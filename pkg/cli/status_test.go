@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/geraldthewes/python-executor/pkg/client"
+)
+
+func TestStatusLine(t *testing.T) {
+	var out bytes.Buffer
+	s := newStatusLine(&out, "Uploading")
+
+	// Large uploads show a bar, then the next status once sent
+	upload := s.uploading("Running")
+	upload(3<<20, 4<<20)
+	s.draw()
+	first := out.Len()
+	if got := out.String(); !strings.HasPrefix(got, "\r| Uploading [======================        ]  75% 3.0 MB of 4.0 MB (0s)") {
+		t.Errorf("upload line = %q", got)
+	}
+	upload(4<<20, 4<<20)
+	out.Reset()
+	s.draw()
+	if got := out.String(); !strings.HasPrefix(got, "\r/ Running (0s)") || len(got) != first {
+		t.Errorf("status line = %q, want the upload line erased", got)
+	}
+
+	// A nil status line draws nothing
+	var none *statusLine
+	none.set("Running")
+	if none.uploading("Running") != nil {
+		t.Error("nil status line returned an upload callback")
+	}
+	none.close()
+}
+
+func TestExecutionStatus(t *testing.T) {
+	percent := 40.0
+	tests := []struct {
+		result client.ExecutionResult
+		want   string
+	}{
+		{client.ExecutionResult{Status: client.StatusPending}, "Queued"},
+		{client.ExecutionResult{Status: client.StatusPending, QueuePosition: 3}, "Queued (position 3)"},
+		{client.ExecutionResult{Status: client.StatusRunning, Phase: client.PhasePulling}, "Pulling image"},
+		{client.ExecutionResult{Status: client.StatusRunning, Phase: client.PhaseInstalling}, "Installing dependencies"},
+		{client.ExecutionResult{Status: client.StatusRunning}, "Running"},
+		{client.ExecutionResult{Status: client.StatusRunning, Phase: client.PhaseRunning, Progress: &client.Progress{Percent: &percent, Message: "training"}}, "Running: 40% training"},
+		{client.ExecutionResult{Status: client.StatusRunning, Progress: &client.Progress{}}, "Running"},
+	}
+	for _, tt := range tests {
+		if got := executionStatus(&tt.result); got != tt.want {
+			t.Errorf("executionStatus(%+v) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
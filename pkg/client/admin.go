@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// GetStatus returns the state and load of the server instance that answers,
+// which behind a load balancer may be any replica.
+//
+// Example:
+//
+//	status, err := c.GetStatus(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("%s: %.0f%% saturated, %d queued\n", status.Node, status.Load.Saturation*100, status.Load.Queued)
+func (c *Client) GetStatus(ctx context.Context) (*ServerStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v1/admin/status", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var status ServerStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ListApprovals returns the executions held by the server's approval rules,
+// oldest first.
+func (c *Client) ListApprovals(ctx context.Context) ([]Approval, error) {
+	var list ApprovalList
+	if err := c.doAdmin(ctx, "GET", "/api/v1/admin/approvals", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Approvals, nil
+}
+
+// ApproveExecution queues an execution awaiting approval and returns it,
+// now pending.
+func (c *Client) ApproveExecution(ctx context.Context, executionID string) (*ExecutionResult, error) {
+	var result ExecutionResult
+	path := "/api/v1/admin/approvals/" + url.PathEscape(executionID) + "/approve"
+	if err := c.doAdmin(ctx, "POST", path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// RejectExecution cancels an execution awaiting approval and returns it.
+// The reason, if not empty, is added to the execution's error.
+//
+// Example:
+//
+//	_, err := c.RejectExecution(ctx, execID, "network access is not allowed for this project")
+func (c *Client) RejectExecution(ctx context.Context, executionID, reason string) (*ExecutionResult, error) {
+	var result ExecutionResult
+	path := "/api/v1/admin/approvals/" + url.PathEscape(executionID) + "/reject"
+	if err := c.doAdmin(ctx, "POST", path, &RejectRequest{Reason: reason}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Backup writes a gzip-compressed backup of the server's executions and
+// templates to w, for [Client.Restore] on any server.
+//
+// Example:
+//
+//	f, err := os.Create("backup.json.gz")
+//	if err != nil {
+//	    return err
+//	}
+//	defer f.Close()
+//	err = c.Backup(ctx, f)
+func (c *Client) Backup(ctx context.Context, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v1/admin/backup", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Restore loads a backup written by [Client.Backup] into the server.
+// Executions and templates the server already has are skipped unless
+// overwrite is set; executions that had not finished are restored as
+// failed.
+func (c *Client) Restore(ctx context.Context, r io.Reader, overwrite bool) (*RestoreResult, error) {
+	path := "/api/v1/admin/restore?overwrite=" + strconv.FormatBool(overwrite)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var result RestoreResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// doAdmin sends an admin request with an optional JSON body and decodes the
+// JSON response into out
+func (c *Client) doAdmin(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/admin/status" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(ServerStatus{
+			Node: "node-1",
+			Load: LoadStatus{Running: 2, MaxConcurrent: 4, Saturation: 0.5, OverloadPolicy: "queue", Queued: 3},
+		})
+	}))
+	defer srv.Close()
+
+	status, err := New(srv.URL).GetStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Node != "node-1" || status.Load.Saturation != 0.5 || status.Load.Queued != 3 {
+		t.Errorf("GetStatus() = %+v", status)
+	}
+
+	if _, err := New(srv.URL + "/missing").GetStatus(context.Background()); err == nil {
+		t.Error("GetStatus() = nil error for a 404")
+	}
+}
+
+func TestApprovals(t *testing.T) {
+	var rejected RejectRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/admin/approvals":
+			json.NewEncoder(w).Encode(ApprovalList{Approvals: []Approval{{ExecutionID: "exe_1", Tenant: "interns", Reason: "network access enabled"}}})
+		case r.Method == "POST" && r.URL.Path == "/api/v1/admin/approvals/exe_1/approve":
+			json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusPending})
+		case r.Method == "POST" && r.URL.Path == "/api/v1/admin/approvals/exe_2/reject":
+			json.NewDecoder(r.Body).Decode(&rejected)
+			json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_2", Status: StatusCancelled, TerminationReason: TerminationRejected})
+		default:
+			http.Error(w, `{"error":"execution is completed, not awaiting approval"}`, http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	list, err := c.ListApprovals(ctx)
+	if err != nil || len(list) != 1 || list[0].Reason != "network access enabled" {
+		t.Errorf("ListApprovals() = %+v, %v", list, err)
+	}
+	result, err := c.ApproveExecution(ctx, "exe_1")
+	if err != nil || result.Status != StatusPending {
+		t.Errorf("ApproveExecution() = %+v, %v", result, err)
+	}
+	result, err = c.RejectExecution(ctx, "exe_2", "too big")
+	if err != nil || result.TerminationReason != TerminationRejected || rejected.Reason != "too big" {
+		t.Errorf("RejectExecution() = %+v, %v; sent %+v", result, err, rejected)
+	}
+	if _, err := c.ApproveExecution(ctx, "exe_3"); err == nil {
+		t.Error("ApproveExecution() = nil error for a 409")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	var restored []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v1/admin/backup":
+			w.Header().Set("Content-Type", "application/gzip")
+			w.Write([]byte("archive"))
+		case r.Method == "POST" && r.URL.Path == "/api/v1/admin/restore":
+			if r.URL.Query().Get("overwrite") != "true" {
+				http.Error(w, `{"error":"overwrite not set"}`, http.StatusBadRequest)
+				return
+			}
+			restored, _ = io.ReadAll(r.Body)
+			json.NewEncoder(w).Encode(RestoreResult{Executions: 3, Templates: 1})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if err := c.Backup(ctx, &buf); err != nil || buf.String() != "archive" {
+		t.Fatalf("Backup() = %q, %v", buf.String(), err)
+	}
+	result, err := c.Restore(ctx, &buf, true)
+	if err != nil || result.Executions != 3 || string(restored) != "archive" {
+		t.Errorf("Restore() = %+v, %v; server got %q", result, err, restored)
+	}
+	if _, err := c.Restore(ctx, bytes.NewReader(nil), false); err == nil {
+		t.Error("Restore() of a rejected backup succeeded")
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrArchiveNotCached is returned, wrapped, when an execution names an
+// archive by [Metadata.ArchiveSHA256] that the server doesn't have.
+var ErrArchiveNotCached = errors.New("archive is not cached on the server")
+
+// ArchiveSHA256 returns the hex SHA-256 of an archive, which identifies it
+// in the server's cache.
+func ArchiveSHA256(tarData []byte) string {
+	sum := sha256.Sum256(tarData)
+	return hex.EncodeToString(sum[:])
+}
+
+// HasArchive reports whether the server has cached the archive with the
+// given hex SHA-256 (see [ArchiveSHA256]) from an earlier execution or
+// upload. A cached archive is run by setting [Metadata.ArchiveSHA256] and
+// passing a nil tarData. Looking an archive up keeps it cached for longer.
+func (c *Client) HasArchive(ctx context.Context, sha256 string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v1/archives/"+sha256, nil)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return false, fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+}
+
+// withCachedArchive calls send with tarData replaced by its hash if the
+// client uses the archive cache and the server has it, and with tarData
+// itself otherwise, including when the cached copy expired between the
+// lookup and the execution.
+func (c *Client) withCachedArchive(ctx context.Context, tarData []byte, metadata *Metadata, send func([]byte, *Metadata) error) error {
+	if !c.archiveCache || tarData == nil || metadata == nil || metadata.UploadID != "" || metadata.ArchiveSHA256 != "" {
+		return send(tarData, metadata)
+	}
+
+	sum := ArchiveSHA256(tarData)
+	// A failed lookup just means sending the archive
+	if cached, _ := c.HasArchive(ctx, sum); cached {
+		byHash := *metadata
+		byHash.ArchiveSHA256 = sum
+		if err := send(nil, &byHash); !errors.Is(err, ErrArchiveNotCached) {
+			return err
+		}
+	}
+	return send(tarData, metadata)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeCacheServer serves the archive lookup and sync exec endpoints,
+// recording whether each execution sent a tar part
+type fakeCacheServer struct {
+	mu     sync.Mutex
+	cached map[string]bool
+	// expired makes lookups succeed but executions by hash miss, as when
+	// the archive is evicted in between
+	expired bool
+	sent    []bool
+}
+
+func (f *fakeCacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if sum, ok := strings.CutPrefix(r.URL.Path, "/api/v1/archives/"); ok {
+		if !f.cached[sum] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(Archive{SHA256: sum})
+		return
+	}
+
+	r.ParseMultipartForm(1 << 20)
+	var meta Metadata
+	json.Unmarshal([]byte(r.FormValue("metadata")), &meta)
+	tarFile, _, err := r.FormFile("tar")
+	hasTar := err == nil
+	f.sent = append(f.sent, hasTar)
+
+	if !hasTar && (f.expired || !f.cached[meta.ArchiveSHA256]) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if hasTar {
+		data, _ := io.ReadAll(tarFile)
+		f.cached[ArchiveSHA256(data)] = true
+	}
+	json.NewEncoder(w).Encode(ExecutionResult{Status: StatusCompleted})
+}
+
+func TestWithArchiveCache(t *testing.T) {
+	fake := &fakeCacheServer{cached: map[string]bool{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	c := New(srv.URL, WithArchiveCache())
+	tarData, _ := TarFromMap(map[string]string{"main.py": "print(1)"})
+	meta := &Metadata{Entrypoint: "main.py"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ExecuteSync(ctx, tarData, meta); err != nil {
+			t.Fatalf("ExecuteSync() error = %v", err)
+		}
+	}
+	// The second run finds the archive and only sends its hash
+	if len(fake.sent) != 2 || !fake.sent[0] || fake.sent[1] {
+		t.Errorf("tar parts sent = %v, want [true false]", fake.sent)
+	}
+	if meta.ArchiveSHA256 != "" {
+		t.Error("ExecuteSync() modified the caller's metadata")
+	}
+
+	// If the cached copy is gone by the time it runs, the archive is sent
+	fake.expired = true
+	fake.sent = nil
+	if _, err := c.ExecuteSync(ctx, tarData, meta); err != nil {
+		t.Fatalf("ExecuteSync() after expiry error = %v", err)
+	}
+	if len(fake.sent) != 2 || fake.sent[0] || !fake.sent[1] {
+		t.Errorf("tar parts sent after expiry = %v, want [false true]", fake.sent)
+	}
+}
+
+func TestHasArchive(t *testing.T) {
+	sum := ArchiveSHA256([]byte("data"))
+	srv := httptest.NewServer(&fakeCacheServer{cached: map[string]bool{sum: true}})
+	defer srv.Close()
+
+	c := New(srv.URL)
+	if ok, err := c.HasArchive(context.Background(), sum); err != nil || !ok {
+		t.Errorf("HasArchive(cached) = %v, %v, want true", ok, err)
+	}
+	if ok, err := c.HasArchive(context.Background(), ArchiveSHA256([]byte("other"))); err != nil || ok {
+		t.Errorf("HasArchive(missing) = %v, %v, want false", ok, err)
+	}
+}
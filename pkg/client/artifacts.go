@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ListArtifacts lists an execution's artifacts without their contents:
+// the files it collected from its output directory (see
+// [ExecutionConfig.CollectArtifacts]) along with any plots, tracebacks and
+// spilled logs. Each is fetched with [Client.GetArtifact].
+func (c *Client) ListArtifacts(ctx context.Context, executionID string) ([]Artifact, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/executions/%s/artifacts", c.baseURL, executionID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("execution not found")
+	default:
+		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+
+	var list ArtifactList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Artifacts, nil
+}
+
+// DownloadArtifacts saves all of an execution's artifacts under dir,
+// creating it and any subdirectories as needed, and returns the artifacts
+// saved. A file collected from /work/output/plots/loss.png is saved as
+// dir/output/plots/loss.png.
+//
+// Example:
+//
+//	artifacts, err := c.DownloadArtifacts(ctx, execID, "results")
+//	if err != nil {
+//	    return err
+//	}
+//	for _, a := range artifacts {
+//	    fmt.Printf("%s (%d bytes)\n", a.Name, a.Size)
+//	}
+func (c *Client) DownloadArtifacts(ctx context.Context, executionID, dir string) ([]Artifact, error) {
+	artifacts, err := c.ListArtifacts(ctx, executionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, a := range artifacts {
+		if !filepath.IsLocal(filepath.FromSlash(a.Name)) {
+			return artifacts[:i], fmt.Errorf("artifact %q: invalid name", a.Name)
+		}
+		if err := c.downloadArtifact(ctx, executionID, a.Name, filepath.Join(dir, filepath.FromSlash(a.Name))); err != nil {
+			return artifacts[:i], fmt.Errorf("artifact %q: %w", a.Name, err)
+		}
+	}
+	return artifacts, nil
+}
+
+// downloadArtifact saves one artifact to dest
+func (c *Client) downloadArtifact(ctx context.Context, executionID, name, dest string) error {
+	body, err := c.GetArtifact(ctx, executionID, name)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
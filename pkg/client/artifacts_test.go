@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadArtifacts(t *testing.T) {
+	files := map[string]string{
+		"output/results.csv":    "a,b\n1,2\n",
+		"output/plots/loss.svg": "<svg/>",
+		"figure_1.png":          "png",
+	}
+	names := []string{"output/results.csv", "output/plots/loss.svg", "figure_1.png"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/executions/exe_1/artifacts" {
+			var list ArtifactList
+			for _, name := range names {
+				list.Artifacts = append(list.Artifacts, Artifact{Name: name, Size: int64(len(files[name])), URL: "/api/v1/executions/exe_1/artifacts/" + name})
+			}
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+		if name, ok := strings.CutPrefix(r.URL.Path, "/api/v1/executions/exe_1/artifacts/"); ok {
+			if data, ok := files[name]; ok {
+				w.Write([]byte(data))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	dir := t.TempDir()
+	artifacts, err := c.DownloadArtifacts(context.Background(), "exe_1", dir)
+	if err != nil {
+		t.Fatalf("DownloadArtifacts() error = %v", err)
+	}
+	if len(artifacts) != len(names) {
+		t.Errorf("artifacts = %+v", artifacts)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := c.DownloadArtifacts(context.Background(), "exe_2", dir); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("DownloadArtifacts() of an unknown execution = %v", err)
+	}
+}
+
+func TestDownloadArtifacts_InvalidName(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ArtifactList{Artifacts: []Artifact{{Name: "../escape.txt"}}})
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	if _, err := New(srv.URL).DownloadArtifacts(context.Background(), "exe_1", filepath.Join(dir, "out")); err == nil {
+		t.Error("DownloadArtifacts() saved an artifact outside the directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+		t.Error("escape.txt was written")
+	}
+}
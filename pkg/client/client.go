@@ -39,6 +39,8 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -48,8 +50,20 @@ import (
 // Create a new client with [New] and use methods like [Client.ExecuteSync]
 // and [Client.ExecuteAsync] to execute Python code remotely.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL      string
+	httpClient   *http.Client
+	syncClient   *http.Client // calls that wait for an execution to finish
+	uploadClient *http.Client // calls that send archives and files
+	archiveCache bool
+	fileHashes   fileHashCache
+	tenant       string
+	apiKey       string
+
+	uploadProgress func(sent, total int64)
+
+	syncTimeout   *time.Duration
+	uploadTimeout *time.Duration
+	transport     []func(*http.Transport)
 }
 
 // New creates a new python-executor client.
@@ -73,6 +87,17 @@ func New(baseURL string, opts ...Option) *Client {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if len(c.transport) > 0 {
+		c.httpClient = withTransport(c.httpClient, c.transport)
+	}
+	if c.tenant != "" {
+		c.httpClient = withHeader(c.httpClient, tenantHeader, c.tenant)
+	}
+	if c.apiKey != "" {
+		c.httpClient = withHeader(c.httpClient, apiKeyHeader, c.apiKey)
+	}
+	c.syncClient = withTimeout(c.httpClient, c.syncTimeout)
+	c.uploadClient = withTimeout(c.httpClient, c.uploadTimeout)
 
 	return c
 }
@@ -80,7 +105,8 @@ func New(baseURL string, opts ...Option) *Client {
 // ExecuteSync executes Python code and waits for the result.
 //
 // This method blocks until execution completes. Use [Client.ExecuteAsync]
-// for long-running scripts.
+// for long-running scripts. If the server answers that the execution is
+// still running after its detach threshold, it is polled until it finishes.
 //
 // Example:
 //
@@ -98,23 +124,63 @@ func New(baseURL string, opts ...Option) *Client {
 //	fmt.Printf("Exit code: %d\n", result.ExitCode)
 //	fmt.Printf("Output: %s\n", result.Stdout)
 func (c *Client) ExecuteSync(ctx context.Context, tarData []byte, metadata *Metadata) (*ExecutionResult, error) {
-	body, contentType, err := c.buildMultipartRequest(tarData, metadata)
-	if err != nil {
-		return nil, err
-	}
+	var result *ExecutionResult
+	err := c.withCachedArchive(ctx, tarData, metadata, func(tarData []byte, metadata *Metadata) error {
+		body, contentType, err := c.buildMultipartRequest(tarData, metadata)
+		if err != nil {
+			return err
+		}
+
+		result, err = c.postSync(ctx, body, contentType, metadataConfig(metadata))
+		return err
+	})
+	return result, err
+}
+
+// ExecuteSyncWithStdin is like [Client.ExecuteSync] but streams stdin to the
+// script from r instead of sending metadata.Stdin. The request body is
+// written as r is read, so the input can be larger than available memory.
+//
+// Example:
+//
+//	f, _ := os.Open("input.csv")
+//	defer f.Close()
+//	result, err := c.ExecuteSyncWithStdin(ctx, tarData, metadata, f)
+func (c *Client) ExecuteSyncWithStdin(ctx context.Context, tarData []byte, metadata *Metadata, stdin io.Reader) (*ExecutionResult, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMultipart(writer, tarData, metadata, stdin))
+	}()
+
+	result, err := c.postSync(ctx, pr, writer.FormDataContentType(), metadataConfig(metadata))
+	pr.Close()
+	return result, err
+}
 
+// postSync sends a multipart body to the sync endpoint and decodes the result.
+// config is the execution's, which bounds how long the call may take.
+func (c *Client) postSync(ctx context.Context, body io.Reader, contentType string, config *ExecutionConfig) (*ExecutionResult, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/exec/sync", body)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", contentType)
+	c.trackUpload(req)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.syncClientFor(ctx, config).Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("server returned %d: %w", resp.StatusCode, ErrArchiveNotCached)
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		return c.followDetached(ctx, resp.Body)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
 	}
@@ -127,6 +193,95 @@ func (c *Client) ExecuteSync(ctx context.Context, tarData []byte, metadata *Meta
 	return &result, nil
 }
 
+// syncMargin is how much longer than an execution may run a sync call waits
+// for its result, for pulling the image, starting containers and sending the
+// result back
+const syncMargin = 2 * time.Minute
+
+// syncClientFor returns the HTTP client for a sync call, made with ctx, of
+// an execution with the given config. Unless WithSyncTimeout set the
+// timeout of sync calls, it is raised to the execution's timeout and
+// install timeout plus syncMargin, so that the call does not give up
+// before the server does. A call whose context has a deadline is bounded
+// by that deadline instead.
+func (c *Client) syncClientFor(ctx context.Context, config *ExecutionConfig) *http.Client {
+	var d time.Duration
+	if config != nil && config.TimeoutSeconds > 0 {
+		d = time.Duration(config.TimeoutSeconds+config.InstallTimeoutSeconds) * time.Second
+	}
+	return c.syncClientWithin(ctx, d)
+}
+
+// syncClientWithin returns the HTTP client for a sync call that may run for
+// d before answering, or an unknown time if 0, raising its timeout as
+// syncClientFor does
+func (c *Client) syncClientWithin(ctx context.Context, d time.Duration) *http.Client {
+	if c.syncTimeout != nil || c.syncClient.Timeout == 0 {
+		return c.syncClient
+	}
+	if _, ok := ctx.Deadline(); ok {
+		var none time.Duration
+		return withTimeout(c.syncClient, &none)
+	}
+	timeout := d + syncMargin
+	if d == 0 || timeout <= c.syncClient.Timeout {
+		return c.syncClient
+	}
+	return withTimeout(c.syncClient, &timeout)
+}
+
+// metadataConfig returns the execution config of metadata, which may be nil
+func metadataConfig(metadata *Metadata) *ExecutionConfig {
+	if metadata == nil {
+		return nil
+	}
+	return metadata.Config
+}
+
+// trackUpload makes req report the progress of sending its body to the
+// WithUploadProgress callback, if there is one
+func (c *Client) trackUpload(req *http.Request) {
+	if c.uploadProgress == nil || req.Body == nil {
+		return
+	}
+	total := req.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	req.Body = &progressReader{ReadCloser: req.Body, total: total, report: c.uploadProgress}
+}
+
+// progressReader reports how much of a request body has been read
+type progressReader struct {
+	io.ReadCloser
+	sent   int64
+	total  int64
+	report func(sent, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.sent += int64(n)
+		r.report(r.sent, r.total)
+	}
+	return n, err
+}
+
+// detachedPollInterval is how often a sync execution the server detached
+// is polled
+const detachedPollInterval = time.Second
+
+// followDetached waits for a sync execution the server answered with 202
+// because it ran past its detach threshold
+func (c *Client) followDetached(ctx context.Context, body io.Reader) (*ExecutionResult, error) {
+	var accepted AsyncResponse
+	if err := json.NewDecoder(body).Decode(&accepted); err != nil {
+		return nil, err
+	}
+	return c.WaitForCompletion(ctx, accepted.ExecutionID, detachedPollInterval)
+}
+
 // ExecuteAsync submits Python code for asynchronous execution.
 //
 // Returns an execution ID immediately. Use [Client.GetExecution] to check
@@ -144,6 +299,18 @@ func (c *Client) ExecuteSync(ctx context.Context, tarData []byte, metadata *Meta
 //	// Later, wait for completion
 //	result, err := c.WaitForCompletion(ctx, execID, 2*time.Second)
 func (c *Client) ExecuteAsync(ctx context.Context, tarData []byte, metadata *Metadata) (string, error) {
+	var execID string
+	err := c.withCachedArchive(ctx, tarData, metadata, func(tarData []byte, metadata *Metadata) error {
+		var err error
+		execID, err = c.postAsync(ctx, tarData, metadata)
+		return err
+	})
+	return execID, err
+}
+
+// postAsync submits a multipart request to the async endpoint and returns
+// the execution ID
+func (c *Client) postAsync(ctx context.Context, tarData []byte, metadata *Metadata) (string, error) {
 	body, contentType, err := c.buildMultipartRequest(tarData, metadata)
 	if err != nil {
 		return "", err
@@ -154,13 +321,17 @@ func (c *Client) ExecuteAsync(ctx context.Context, tarData []byte, metadata *Met
 		return "", err
 	}
 	req.Header.Set("Content-Type", contentType)
+	c.trackUpload(req)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.uploadClient.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("server returned %d: %w", resp.StatusCode, ErrArchiveNotCached)
+	}
 	if resp.StatusCode != http.StatusAccepted {
 		return "", fmt.Errorf("server returned %d", resp.StatusCode)
 	}
@@ -179,9 +350,18 @@ func (c *Client) ExecuteAsync(ctx context.Context, tarData []byte, metadata *Met
 // failed, or killed. Once completed, the result includes stdout, stderr,
 // and exit code.
 func (c *Client) GetExecution(ctx context.Context, executionID string) (*ExecutionResult, error) {
-	url := fmt.Sprintf("%s/api/v1/executions/%s", c.baseURL, executionID)
+	return c.GetExecutionWithOptions(ctx, executionID, nil)
+}
+
+// GetExecutionWithOptions is like [Client.GetExecution] but lets the caller
+// change how the result is rendered. A nil opts is the same as GetExecution.
+func (c *Client) GetExecutionWithOptions(ctx context.Context, executionID string, opts *GetExecutionOptions) (*ExecutionResult, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/executions/%s", c.baseURL, executionID)
+	if q := opts.query(); len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -208,9 +388,163 @@ func (c *Client) GetExecution(ctx context.Context, executionID string) (*Executi
 	return &result, nil
 }
 
+// GetOutput streams an execution's stdout or stderr as plain text, starting
+// at byte offset. Unlike [Client.GetExecution] it doesn't hold the output in
+// memory, so it suits very large logs; pass the number of bytes already read
+// as offset to resume. The caller must close the returned reader.
+func (c *Client) GetOutput(ctx context.Context, executionID string, stream OutputStream, offset int64) (io.ReadCloser, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/executions/%s/%s", c.baseURL, executionID, stream)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Nothing past offset yet
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("execution not found")
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+}
+
+// ReadOutput returns a chunk of an execution's stdout or stderr, selected by
+// opts. Pass each chunk's NextOffset as the next Offset to read a log
+// piece by piece: after an error, reading again from the last NextOffset
+// continues exactly where the previous chunk ended, without repeating or
+// skipping output. A nil opts returns the whole stream.
+//
+// Example:
+//
+//	opts := &client.ReadOutputOptions{Limit: 1 << 20}
+//	for {
+//	    chunk, err := c.ReadOutput(ctx, execID, client.StreamStdout, opts)
+//	    if err != nil {
+//	        return err // or retry with the same opts
+//	    }
+//	    fmt.Print(chunk.Data)
+//	    if chunk.Complete {
+//	        break
+//	    }
+//	    opts.Offset = chunk.NextOffset
+//	}
+func (c *Client) ReadOutput(ctx context.Context, executionID string, stream OutputStream, opts *ReadOutputOptions) (*OutputChunk, error) {
+	if opts == nil {
+		opts = &ReadOutputOptions{}
+	}
+	q := url.Values{}
+	q.Set("offset", strconv.FormatInt(opts.Offset, 10))
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.FormatInt(opts.Limit, 10))
+	}
+	if opts.Unit != "" {
+		q.Set("unit", string(opts.Unit))
+	}
+	if opts.WithTimestamps {
+		q.Set("with_timestamps", "true")
+	}
+	endpoint := fmt.Sprintf("%s/api/v1/executions/%s/%s?%s", c.baseURL, executionID, stream, q.Encode())
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("execution not found")
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	next, err := strconv.ParseInt(resp.Header.Get("X-Next-Offset"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid X-Next-Offset header: %w", err)
+	}
+	complete, _ := strconv.ParseBool(resp.Header.Get("X-Output-Complete"))
+
+	return &OutputChunk{Data: string(data), NextOffset: next, Complete: complete}, nil
+}
+
+// GetArtifact streams one of an execution's artifacts, such as a log that
+// was spilled because it exceeded the server's inline limit. name is the
+// artifact's Name. The caller must close the returned reader.
+func (c *Client) GetArtifact(ctx context.Context, executionID, name string) (io.ReadCloser, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/executions/%s/artifacts/%s", c.baseURL, executionID, name)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("artifact not found")
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+}
+
+// pollOptions fetches just enough of an execution to tell whether it has
+// finished, and what it is doing.
+var pollOptions = &GetExecutionOptions{Fields: []string{"phase", "progress", "paused_at"}}
+
+// query encodes the options as URL query parameters
+func (o *GetExecutionOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.WithTimestamps {
+		q.Set("with_timestamps", "true")
+	}
+	if len(o.Fields) > 0 {
+		q.Set("fields", strings.Join(o.Fields, ","))
+	}
+	return q
+}
+
 // KillExecution terminates a running execution.
 //
 // The Docker container running the Python code will be forcefully stopped.
+// A pending (queued) execution is cancelled before it starts.
 func (c *Client) KillExecution(ctx context.Context, executionID string) error {
 	url := fmt.Sprintf("%s/api/v1/executions/%s", c.baseURL, executionID)
 
@@ -232,10 +566,92 @@ func (c *Client) KillExecution(ctx context.Context, executionID string) error {
 	return nil
 }
 
+// PauseExecution freezes a running execution and returns it, with PausedAt
+// set. Its timeout stands still until [Client.ResumeExecution].
+func (c *Client) PauseExecution(ctx context.Context, executionID string) (*ExecutionResult, error) {
+	return c.suspend(ctx, executionID, "pause")
+}
+
+// CheckpointExecution saves a running execution to disk and stops it until
+// [Client.ResumeExecution] restores it, e.g. across a maintenance window.
+// The server must have checkpoints enabled.
+func (c *Client) CheckpointExecution(ctx context.Context, executionID string) (*ExecutionResult, error) {
+	return c.suspend(ctx, executionID, "checkpoint")
+}
+
+// ResumeExecution continues a paused or checkpointed execution and returns
+// it.
+func (c *Client) ResumeExecution(ctx context.Context, executionID string) (*ExecutionResult, error) {
+	return c.suspend(ctx, executionID, "resume")
+}
+
+// suspend posts a pause, checkpoint or resume action for an execution
+func (c *Client) suspend(ctx context.Context, executionID, action string) (*ExecutionResult, error) {
+	url := fmt.Sprintf("%s/api/v1/executions/%s/%s", c.baseURL, executionID, action)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+	}
+
+	var result ExecutionResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ReportProgress reports progress for a running execution.
+//
+// It is meant to be called from inside the execution, using the token the
+// server passes in the PYEXEC_PROGRESS_TOKEN environment variable. A nil
+// update sends a heartbeat.
+func (c *Client) ReportProgress(ctx context.Context, executionID, token string, update *ProgressUpdate) error {
+	if update == nil {
+		update = &ProgressUpdate{}
+	}
+	reqBody, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("marshaling progress: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/v1/executions/%s/progress", c.baseURL, executionID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Pyexec-Progress-Token", token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
 // WaitForCompletion polls the server until the execution completes.
 //
 // The method polls at the specified interval until the execution reaches
-// a terminal state (completed, failed, or killed).
+// a terminal state (completed, failed, killed, or cancelled).
 //
 // Example:
 //
@@ -249,6 +665,17 @@ func (c *Client) KillExecution(ctx context.Context, executionID string) error {
 //
 //	fmt.Println(result.Stdout)
 func (c *Client) WaitForCompletion(ctx context.Context, executionID string, pollInterval time.Duration) (*ExecutionResult, error) {
+	return c.WatchExecution(ctx, executionID, pollInterval, nil)
+}
+
+// WatchExecution polls like [Client.WaitForCompletion] and calls onPoll with
+// every result it fetches, including the final one. Use it to show progress
+// reported by long-running scripts.
+//
+// While the execution is running, only its status, phase and progress are
+// fetched, so intermediate results passed to onPoll carry no output. The final result
+// is complete.
+func (c *Client) WatchExecution(ctx context.Context, executionID string, pollInterval time.Duration, onPoll func(*ExecutionResult)) (*ExecutionResult, error) {
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
 
@@ -257,17 +684,25 @@ func (c *Client) WaitForCompletion(ctx context.Context, executionID string, poll
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		case <-ticker.C:
-			result, err := c.GetExecution(ctx, executionID)
+			result, err := c.GetExecutionWithOptions(ctx, executionID, pollOptions)
 			if err != nil {
 				return nil, err
 			}
 
 			// Check if finished
-			if result.Status == StatusCompleted ||
-			   result.Status == StatusFailed ||
-			   result.Status == StatusKilled {
+			if result.Status.IsTerminal() {
+				result, err = c.GetExecution(ctx, executionID)
+				if err != nil {
+					return nil, err
+				}
+				if onPoll != nil {
+					onPoll(result)
+				}
 				return result, nil
 			}
+			if onPoll != nil {
+				onPoll(result)
+			}
 		}
 	}
 }
@@ -302,7 +737,7 @@ func (c *Client) Eval(ctx context.Context, req *SimpleExecRequest) (*ExecutionRe
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.syncClientFor(ctx, req.Config).Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
@@ -322,6 +757,10 @@ func (c *Client) Eval(ctx context.Context, req *SimpleExecRequest) (*ExecutionRe
 		return nil, fmt.Errorf("code exceeds maximum size limit")
 	}
 
+	if resp.StatusCode == http.StatusAccepted {
+		return c.followDetached(ctx, resp.Body)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server returned %d", resp.StatusCode)
 	}
@@ -334,33 +773,96 @@ func (c *Client) Eval(ctx context.Context, req *SimpleExecRequest) (*ExecutionRe
 	return &result, nil
 }
 
+// Inspect describes an archive without running it: its files, total size,
+// the entrypoint that would run and the third-party packages its code
+// imports. metadata is optional; pass it to inspect an upload or cached
+// archive, or to see what an entrypoint or mode would change.
+//
+// Example:
+//
+//	info, err := c.Inspect(ctx, tarData, nil)
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Println(info.Entrypoint, info.Requirements)
+func (c *Client) Inspect(ctx context.Context, tarData []byte, metadata *Metadata) (*InspectResult, error) {
+	body, contentType, err := c.buildMultipartRequest(tarData, metadata)
+	if err != nil {
+		return nil, fmt.Errorf("building request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/inspect", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var result InspectResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
 // buildMultipartRequest creates a multipart form request
 func (c *Client) buildMultipartRequest(tarData []byte, metadata *Metadata) (io.Reader, string, error) {
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
-	// Add tar file
-	tarPart, err := writer.CreateFormFile("tar", "code.tar")
-	if err != nil {
+	if err := writeMultipart(writer, tarData, metadata, nil); err != nil {
 		return nil, "", err
 	}
-	if _, err := io.Copy(tarPart, bytes.NewReader(tarData)); err != nil {
-		return nil, "", err
+
+	return body, writer.FormDataContentType(), nil
+}
+
+// writeMultipart writes the tar, metadata and optional stdin parts and
+// closes the writer. The tar part is left out when the metadata names an
+// upload or cached archive and tarData is nil.
+func writeMultipart(writer *multipart.Writer, tarData []byte, metadata *Metadata, stdin io.Reader) error {
+	// Add tar file
+	if tarData != nil || metadata == nil || (metadata.UploadID == "" && metadata.ArchiveSHA256 == "") {
+		tarPart, err := writer.CreateFormFile("tar", "code.tar")
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(tarPart, bytes.NewReader(tarData)); err != nil {
+			return err
+		}
 	}
 
 	// Add metadata
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		return nil, "", err
+		return err
 	}
 
 	if err := writer.WriteField("metadata", string(metadataJSON)); err != nil {
-		return nil, "", err
+		return err
 	}
 
-	if err := writer.Close(); err != nil {
-		return nil, "", err
+	// Add stdin last so the server has the metadata before the bulk data
+	if stdin != nil {
+		stdinPart, err := writer.CreateFormFile("stdin", "stdin")
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(stdinPart, stdin); err != nil {
+			return fmt.Errorf("streaming stdin: %w", err)
+		}
 	}
 
-	return body, writer.FormDataContentType(), nil
+	return writer.Close()
 }
@@ -1,6 +1,13 @@
 package client
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
 
 func TestNewClient_TrailingSlash(t *testing.T) {
 	tests := []struct {
@@ -23,3 +30,222 @@ func TestNewClient_TrailingSlash(t *testing.T) {
 		})
 	}
 }
+
+func TestExecutionStatus_IsTerminal(t *testing.T) {
+	tests := []struct {
+		status   ExecutionStatus
+		terminal bool
+	}{
+		{StatusPending, false},
+		{StatusRunning, false},
+		{StatusCompleted, true},
+		{StatusFailed, true},
+		{StatusKilled, true},
+		{StatusCancelled, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.terminal {
+			t.Errorf("%s.IsTerminal() = %v, want %v", tt.status, got, tt.terminal)
+		}
+	}
+}
+
+func TestWithTenant(t *testing.T) {
+	var tenants []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants = append(tenants, r.Header.Get("X-Tenant"))
+		json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusCompleted})
+	}))
+	defer srv.Close()
+
+	// The header is added to a caller's HTTP client without changing it
+	hc := &http.Client{}
+	c := New(srv.URL, WithHTTPClient(hc), WithTenant("team-a"))
+	if _, err := c.GetExecution(context.Background(), "exe_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(srv.URL).GetExecution(context.Background(), "exe_1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 2 || tenants[0] != "team-a" || tenants[1] != "" {
+		t.Errorf("X-Tenant headers = %q", tenants)
+	}
+	if hc.Transport != nil {
+		t.Errorf("WithTenant changed the caller's HTTP client")
+	}
+}
+
+func TestWithAPIKey(t *testing.T) {
+	var keys, tenants []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("X-API-Key"))
+		tenants = append(tenants, r.Header.Get("X-Tenant"))
+		json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusCompleted})
+	}))
+	defer srv.Close()
+
+	// The key is sent alongside the tenant, and by the sync client too
+	c := New(srv.URL, WithAPIKey("s3cret"), WithTenant("team-a"))
+	if _, err := c.GetExecution(context.Background(), "exe_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Eval(context.Background(), &SimpleExecRequest{Code: "print(1)"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "s3cret" || keys[1] != "s3cret" || tenants[1] != "team-a" {
+		t.Errorf("X-API-Key headers = %q, X-Tenant headers = %q", keys, tenants)
+	}
+}
+
+func TestWithSyncTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusCompleted})
+	}))
+	defer srv.Close()
+
+	// Sync executions outlive the client timeout; other calls don't
+	c := New(srv.URL, WithTimeout(20*time.Millisecond), WithSyncTimeout(0))
+	ctx := context.Background()
+	if _, err := c.Eval(ctx, &SimpleExecRequest{Code: "print(1)"}); err != nil {
+		t.Errorf("Eval() = %v", err)
+	}
+	if _, err := c.GetExecution(ctx, "exe_1"); err == nil {
+		t.Error("GetExecution() = nil error past the client timeout")
+	}
+
+	c = New(srv.URL, WithUploadTimeout(20*time.Millisecond))
+	if _, err := c.ExecuteAsync(ctx, []byte("tar"), &Metadata{Entrypoint: "main.py"}); err == nil {
+		t.Error("ExecuteAsync() = nil error past the upload timeout")
+	}
+	if _, err := c.Eval(ctx, &SimpleExecRequest{Code: "print(1)"}); err != nil {
+		t.Errorf("Eval() = %v", err)
+	}
+}
+
+func TestSyncTimeoutFollowsExecution(t *testing.T) {
+	long := &ExecutionConfig{TimeoutSeconds: 600, InstallTimeoutSeconds: 60}
+
+	// Sync calls of long executions wait for them, with a margin
+	ctx := context.Background()
+	c := New("http://localhost:8080")
+	if got := c.syncClientFor(ctx, long).Timeout; got != 11*time.Minute+syncMargin {
+		t.Errorf("timeout for a 10m execution = %v", got)
+	}
+	if c.syncClientFor(ctx, &ExecutionConfig{TimeoutSeconds: 10}) != c.syncClient || c.syncClientFor(ctx, nil) != c.syncClient {
+		t.Error("timeout changed for a short execution")
+	}
+
+	// A deadline of the call's own bounds it instead
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	for _, config := range []*ExecutionConfig{long, nil} {
+		if got := c.syncClientFor(deadlineCtx, config).Timeout; got != 0 {
+			t.Errorf("timeout with a context deadline = %v, want none", got)
+		}
+	}
+	if c.httpClient.Timeout != 5*time.Minute {
+		t.Errorf("client timeout = %v, want it unchanged", c.httpClient.Timeout)
+	}
+
+	// A sync timeout that was set is kept
+	for _, timeout := range []time.Duration{0, 30 * time.Second} {
+		c = New("http://localhost:8080", WithSyncTimeout(timeout))
+		if got := c.syncClientFor(deadlineCtx, long).Timeout; got != timeout {
+			t.Errorf("WithSyncTimeout(%v): timeout = %v", timeout, got)
+		}
+	}
+}
+
+func TestWithUploadProgress(t *testing.T) {
+	var received int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.ContentLength
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(AsyncResponse{ExecutionID: "exe_1"})
+	}))
+	defer srv.Close()
+
+	var sent, total int64
+	c := New(srv.URL, WithUploadProgress(func(s, t int64) { sent, total = s, t }))
+	if _, err := c.ExecuteAsync(context.Background(), make([]byte, 1<<20), &Metadata{Entrypoint: "main.py"}); err != nil {
+		t.Fatal(err)
+	}
+	if received <= 1<<20 || sent != received || total != received {
+		t.Errorf("progress = %d of %d, server received %d bytes", sent, total, received)
+	}
+}
+
+func TestTransportOptions(t *testing.T) {
+	c := New("http://localhost:8080", WithConnectionPool(32, 64), WithKeepAlive(-1), WithHTTP2(false))
+	tr, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("transport = %T", c.httpClient.Transport)
+	}
+	if tr.MaxIdleConnsPerHost != 32 || tr.MaxConnsPerHost != 64 || !tr.DisableKeepAlives || tr.Protocols.HTTP2() {
+		t.Errorf("transport = %+v", tr)
+	}
+	if http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost == 32 {
+		t.Error("options changed http.DefaultTransport")
+	}
+	if c.syncClient.Transport != tr || c.uploadClient.Transport != tr {
+		t.Error("sync and upload calls don't share the transport")
+	}
+
+	c = New("http://localhost:8080", WithKeepAlive(time.Minute))
+	if tr := c.httpClient.Transport.(*http.Transport); tr.IdleConnTimeout != time.Minute || tr.DisableKeepAlives {
+		t.Errorf("transport = %+v", tr)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/inspect" {
+			http.NotFound(w, r)
+			return
+		}
+		if _, _, err := r.FormFile("tar"); err != nil {
+			http.Error(w, "missing tar", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(InspectResult{
+			Files:      []InspectedFile{{Name: "main.py", Size: 5, Mode: "0644"}},
+			TotalSize:  5,
+			Entrypoint: "main.py",
+		})
+	}))
+	defer srv.Close()
+
+	tarData, _ := TarFromMap(map[string]string{"main.py": "pass\n"})
+	info, err := New(srv.URL).Inspect(context.Background(), tarData, nil)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	if info.Entrypoint != "main.py" || len(info.Files) != 1 || info.TotalSize != 5 {
+		t.Errorf("Inspect() = %+v", info)
+	}
+}
+
+func TestEval_FollowsDetachedExecution(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/eval":
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(AsyncResponse{ExecutionID: "exe_1"})
+		case "/api/v1/executions/exe_1":
+			json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusCompleted, Stdout: "done\n"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	result, err := New(srv.URL).Eval(context.Background(), &SimpleExecRequest{Code: "print('done')"})
+	if err != nil {
+		t.Fatalf("Eval() error = %v", err)
+	}
+	if result.ExecutionID != "exe_1" || result.Stdout != "done\n" {
+		t.Errorf("Eval() = %+v, want the detached execution's result", result)
+	}
+}
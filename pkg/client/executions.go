@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListExecutions returns a page of the stored executions matching opts,
+// newest first. A nil opts returns the first page of every execution.
+//
+// Example:
+//
+//	opts := &client.ListExecutionsOptions{Statuses: []client.ExecutionStatus{client.StatusFailed}}
+//	for {
+//	    page, err := c.ListExecutions(ctx, opts)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    for _, r := range page.Executions {
+//	        fmt.Println(r.ExecutionID, r.Error)
+//	    }
+//	    if page.NextCursor == "" {
+//	        break
+//	    }
+//	    opts.Cursor = page.NextCursor
+//	}
+func (c *Client) ListExecutions(ctx context.Context, opts *ListExecutionsOptions) (*ExecutionList, error) {
+	endpoint := c.baseURL + "/api/v1/executions"
+	if q := opts.query(); len(q) > 0 {
+		endpoint += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var list ExecutionList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// query encodes the options as GET /executions parameters
+func (o *ListExecutionsOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if len(o.Statuses) > 0 {
+		statuses := make([]string, len(o.Statuses))
+		for i, s := range o.Statuses {
+			statuses[i] = string(s)
+		}
+		q.Set("status", strings.Join(statuses, ","))
+	}
+	for key, value := range o.Labels {
+		q.Add("label", key+"="+value)
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.Format(time.RFC3339Nano))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.Format(time.RFC3339Nano))
+	}
+	if o.Text != "" {
+		q.Set("q", o.Text)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	if len(o.Fields) > 0 {
+		q.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if o.IncludeOutput {
+		q.Set("include", "output")
+	}
+	return q
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListExecutions(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/executions" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("status") == "bad" {
+			http.Error(w, `{"error":"unknown status"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ExecutionList{
+			Executions: []ExecutionResult{{ExecutionID: "exe_2", Status: StatusFailed}, {ExecutionID: "exe_1", Status: StatusCompleted}},
+			NextCursor: "next",
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	list, err := c.ListExecutions(context.Background(), nil)
+	if err != nil || query != "" || len(list.Executions) != 2 || list.NextCursor != "next" {
+		t.Fatalf("ListExecutions(nil) = %+v, %v (query %q)", list, err, query)
+	}
+
+	opts := &ListExecutionsOptions{
+		Statuses:      []ExecutionStatus{StatusFailed, StatusKilled},
+		Labels:        map[string]string{"team": "ml"},
+		Since:         time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC),
+		Text:          "train",
+		Limit:         10,
+		Cursor:        "next",
+		Fields:        []string{"exit_code", "error"},
+		IncludeOutput: true,
+	}
+	want := "cursor=next&fields=exit_code%2Cerror&include=output&label=team%3Dml&limit=10&q=train&since=2026-01-15T10%3A00%3A00Z&status=failed%2Ckilled"
+	if _, err := c.ListExecutions(context.Background(), opts); err != nil || query != want {
+		t.Errorf("ListExecutions(opts): %v, query %q, want %q", err, query, want)
+	}
+
+	if _, err := c.ListExecutions(context.Background(), &ListExecutionsOptions{Statuses: []ExecutionStatus{"bad"}}); err == nil {
+		t.Error("ListExecutions() = nil error for a 400")
+	}
+}
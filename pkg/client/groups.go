@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrGroupNotFound is returned, wrapped, for a group ID that no execution
+// on the server was submitted with.
+var ErrGroupNotFound = errors.New("group not found")
+
+// GetGroup returns the aggregate status of the executions submitted with
+// a group ID and their results, oldest first.
+//
+// Example:
+//
+//	for _, tarData := range archives {
+//	    c.ExecuteAsync(ctx, tarData, &client.Metadata{Entrypoint: "main.py", GroupID: "batch-42"})
+//	}
+//	g, err := c.GetGroup(ctx, "batch-42")
+func (c *Client) GetGroup(ctx context.Context, groupID string) (*Group, error) {
+	return c.doGroup(ctx, "GET", groupID)
+}
+
+// KillGroup kills a group's running executions and cancels its pending
+// ones, returning the group afterwards.
+func (c *Client) KillGroup(ctx context.Context, groupID string) (*Group, error) {
+	return c.doGroup(ctx, "DELETE", groupID)
+}
+
+// doGroup sends a request for a group and decodes the group returned
+func (c *Client) doGroup(ctx context.Context, method, groupID string) (*Group, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v1/groups/"+groupID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("server returned %d: %s: %w", resp.StatusCode, respBody, ErrGroupNotFound)
+		}
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var g Group
+	if err := json.NewDecoder(resp.Body).Decode(&g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
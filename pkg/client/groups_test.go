@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGroups(t *testing.T) {
+	killed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups/batch-42" {
+			http.Error(w, `{"error":"group not found"}`, http.StatusNotFound)
+			return
+		}
+		status := StatusRunning
+		if r.Method == "DELETE" {
+			killed = true
+			status = StatusKilled
+		}
+		json.NewEncoder(w).Encode(Group{ID: "batch-42", Status: status, Total: 2})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	g, err := c.GetGroup(ctx, "batch-42")
+	if err != nil || g.Status != StatusRunning || g.Total != 2 {
+		t.Fatalf("GetGroup() = %+v, %v", g, err)
+	}
+
+	g, err = c.KillGroup(ctx, "batch-42")
+	if err != nil || g.Status != StatusKilled || !killed {
+		t.Fatalf("KillGroup() = %+v, %v", g, err)
+	}
+
+	if _, err := c.GetGroup(ctx, "other"); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("GetGroup() error = %v, want ErrGroupNotFound", err)
+	}
+}
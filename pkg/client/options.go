@@ -27,7 +27,12 @@ func WithHTTPClient(httpClient *http.Client) Option {
 
 // WithTimeout sets the HTTP client timeout.
 //
-// The default timeout is 5 minutes.
+// The default timeout is 5 minutes. It applies to every call, unless
+// [WithSyncTimeout] or [WithUploadTimeout] sets another for the call. A
+// sync call for an execution whose TimeoutSeconds (plus
+// InstallTimeoutSeconds) is longer waits that long plus two minutes
+// instead, so it doesn't give up before the server answers, and one whose
+// context has a deadline waits until that deadline.
 //
 // Example:
 //
@@ -37,3 +42,210 @@ func WithTimeout(timeout time.Duration) Option {
 		c.httpClient.Timeout = timeout
 	}
 }
+
+// WithSyncTimeout sets the timeout of the calls that wait for an execution
+// to finish: [Client.ExecuteSync], [Client.ExecuteSyncWithStdin],
+// [Client.Eval], [Client.RunTemplate] and [Client.EvalSession]. 0 means no
+// timeout beyond the call's context, for scripts that run as long as their
+// own timeout allows. A sync timeout that is set is kept as is, even for
+// executions with a longer timeout of their own or calls whose context has
+// a later deadline.
+//
+// Example:
+//
+//	// Status calls fail fast; sync executions may run for hours
+//	c := client.New(url,
+//	    client.WithTimeout(30*time.Second),
+//	    client.WithSyncTimeout(0),
+//	)
+func WithSyncTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.syncTimeout = &timeout
+	}
+}
+
+// WithUploadTimeout sets the timeout of the calls that send an archive or
+// file without waiting for it to run: [Client.ExecuteAsync],
+// [Client.SubmitSweep], [Client.Inspect], [Client.UploadFile] and the
+// chunked upload calls. 0 means no timeout beyond the call's context.
+func WithUploadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.uploadTimeout = &timeout
+	}
+}
+
+// WithConnectionPool sets how many connections to the server the client
+// keeps: at most maxIdle idle connections for reuse, and at most maxOpen
+// open at once, with further calls waiting for one (0 means no limit).
+//
+// Go's default keeps 2 idle connections, so a client making many
+// concurrent calls opens and closes connections constantly; raise maxIdle
+// to match its concurrency.
+//
+// Transport options change a copy of the HTTP client's [http.Transport]
+// (or of [http.DefaultTransport]); they are ignored if [WithHTTPClient]
+// sets another kind of RoundTripper.
+func WithConnectionPool(maxIdle, maxOpen int) Option {
+	return func(c *Client) {
+		c.transport = append(c.transport, func(t *http.Transport) {
+			t.MaxIdleConnsPerHost = maxIdle
+			if t.MaxIdleConns != 0 && t.MaxIdleConns < maxIdle {
+				t.MaxIdleConns = maxIdle
+			}
+			t.MaxConnsPerHost = maxOpen
+		})
+	}
+}
+
+// WithKeepAlive sets how long an idle connection is kept for reuse before
+// it is closed. A negative duration disables keep-alives, so every call
+// opens a new connection, e.g. to spread calls across replicas behind a
+// load balancer that balances connections.
+func WithKeepAlive(idleTimeout time.Duration) Option {
+	return func(c *Client) {
+		c.transport = append(c.transport, func(t *http.Transport) {
+			if idleTimeout < 0 {
+				t.DisableKeepAlives = true
+				return
+			}
+			t.DisableKeepAlives = false
+			t.IdleConnTimeout = idleTimeout
+		})
+	}
+}
+
+// WithHTTP2 enables or disables HTTP/2 for HTTPS servers. It is enabled by
+// default, except with a custom TLS configuration; disable it for proxies
+// that mishandle it. Plain HTTP always uses HTTP/1.1.
+func WithHTTP2(enabled bool) Option {
+	return func(c *Client) {
+		c.transport = append(c.transport, func(t *http.Transport) {
+			protocols := new(http.Protocols)
+			protocols.SetHTTP1(true)
+			protocols.SetHTTP2(enabled)
+			t.Protocols = protocols
+		})
+	}
+}
+
+// WithArchiveCache makes [Client.ExecuteSync] and [Client.ExecuteAsync]
+// ask the server whether it already has the archive, by its SHA-256, and
+// run the cached copy instead of sending the archive again. It saves the
+// upload when the same project is run repeatedly.
+func WithArchiveCache() Option {
+	return func(c *Client) {
+		c.archiveCache = true
+	}
+}
+
+// WithUploadProgress calls fn as the requests of [Client.ExecuteSync],
+// [Client.ExecuteSyncWithStdin] and [Client.ExecuteAsync] are sent, with the
+// bytes sent so far and the request's size, or -1 if the size is not known
+// in advance, as when stdin is streamed. Use it to show the progress of
+// large uploads; fn is called from the goroutine sending the request.
+//
+// Example:
+//
+//	c := client.New(url, client.WithUploadProgress(func(sent, total int64) {
+//	    fmt.Fprintf(os.Stderr, "\rUploaded %d of %d bytes", sent, total)
+//	}))
+func WithUploadProgress(fn func(sent, total int64)) Option {
+	return func(c *Client) {
+		c.uploadProgress = fn
+	}
+}
+
+// WithTenant names the tenant the server accounts the client's executions
+// to, and applies usage budgets to. Without it they are accounted to the
+// "default" tenant. Servers with API keys ignore it and use the key's
+// tenant.
+//
+// Example:
+//
+//	c := client.New(url, client.WithTenant("team-a"))
+func WithTenant(tenant string) Option {
+	return func(c *Client) {
+		c.tenant = tenant
+	}
+}
+
+// tenantHeader is the request header naming the tenant
+const tenantHeader = "X-Tenant"
+
+// WithAPIKey sends an API key with every request, for servers that require
+// one (PYEXEC_API_KEYS). What the client may do depends on the key's
+// scopes: reading needs any key, submitting the run scope, killing the
+// kill scope and administration the admin scope.
+//
+// Example:
+//
+//	c := client.New(url, client.WithAPIKey(os.Getenv("PYEXEC_API_KEY")))
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// apiKeyHeader is the request header carrying the API key
+const apiKeyHeader = "X-API-Key"
+
+// headerTransport adds headers to every request it sends
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+// RoundTrip sends a copy of the request with the headers added
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header[name] = values
+	}
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// withTransport returns a copy of an HTTP client whose transport has the
+// given changes applied
+func withTransport(httpClient *http.Client, changes []func(*http.Transport)) *http.Client {
+	var t *http.Transport
+	switch base := httpClient.Transport.(type) {
+	case nil:
+		t = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		t = base.Clone()
+	default:
+		return httpClient
+	}
+	for _, change := range changes {
+		change(t)
+	}
+
+	hc := *httpClient
+	hc.Transport = t
+	return &hc
+}
+
+// withTimeout returns a copy of an HTTP client with another timeout, or the
+// client itself if timeout is nil
+func withTimeout(httpClient *http.Client, timeout *time.Duration) *http.Client {
+	if timeout == nil {
+		return httpClient
+	}
+	hc := *httpClient
+	hc.Timeout = *timeout
+	return &hc
+}
+
+// withHeader returns a copy of an HTTP client that sends a header with
+// every request
+func withHeader(httpClient *http.Client, name, value string) *http.Client {
+	hc := *httpClient
+	header := http.Header{}
+	header.Set(name, value)
+	hc.Transport = &headerTransport{base: httpClient.Transport, header: header}
+	return &hc
+}
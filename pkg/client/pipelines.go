@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrPipelineNotFound is returned, wrapped, for a pipeline the server
+// doesn't hold: it never existed, finished longer ago than the server's
+// cleanup TTL, or was run by another instance.
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+// RunPipeline starts a pipeline and returns at once. Each step runs once
+// the steps it depends on have completed with exit code 0, and finds the
+// files they wrote to /work/output in /work/inputs/{name}. Use
+// [Client.WaitForPipeline] to wait for the last step.
+//
+// Example:
+//
+//	p, err := c.RunPipeline(ctx, &client.PipelineRequest{Steps: []client.PipelineStep{
+//	    {Name: "preprocess", SimpleExecRequest: client.SimpleExecRequest{Code: prep}},
+//	    {Name: "train", DependsOn: []string{"preprocess"}, SimpleExecRequest: client.SimpleExecRequest{Code: train}},
+//	    {Name: "report", DependsOn: []string{"train"}, SimpleExecRequest: client.SimpleExecRequest{Code: report}},
+//	}})
+//	if err != nil {
+//	    return err
+//	}
+//	p, err = c.WaitForPipeline(ctx, p.ID, time.Second)
+func (c *Client) RunPipeline(ctx context.Context, req *PipelineRequest) (*Pipeline, error) {
+	var p Pipeline
+	if err := c.doPipeline(ctx, "POST", "/api/v1/pipelines", req, http.StatusAccepted, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPipeline returns a pipeline's status and the state of its steps.
+func (c *Client) GetPipeline(ctx context.Context, pipelineID string) (*Pipeline, error) {
+	var p Pipeline
+	if err := c.doPipeline(ctx, "GET", "/api/v1/pipelines/"+pipelineID, nil, http.StatusOK, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CancelPipeline kills a pipeline's running steps and cancels those not
+// yet started.
+func (c *Client) CancelPipeline(ctx context.Context, pipelineID string) (*Pipeline, error) {
+	var p Pipeline
+	if err := c.doPipeline(ctx, "DELETE", "/api/v1/pipelines/"+pipelineID, nil, http.StatusOK, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// WaitForPipeline polls a pipeline until its last step has finished.
+func (c *Client) WaitForPipeline(ctx context.Context, pipelineID string, pollInterval time.Duration) (*Pipeline, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			p, err := c.GetPipeline(ctx, pipelineID)
+			if err != nil {
+				return nil, err
+			}
+			if p.Status.IsTerminal() {
+				return p, nil
+			}
+		}
+	}
+}
+
+// doPipeline sends a pipeline request with an optional JSON body and
+// decodes the JSON response into out
+func (c *Client) doPipeline(ctx context.Context, method, path string, in any, wantStatus int, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("server returned %d: %s: %w", resp.StatusCode, respBody, ErrPipelineNotFound)
+		}
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
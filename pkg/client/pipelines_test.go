@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPipelines(t *testing.T) {
+	polls := 0
+	var sent PipelineRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v1/pipelines":
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(Pipeline{ID: "pip_1", Status: StatusRunning})
+		case r.Method == "GET" && r.URL.Path == "/api/v1/pipelines/pip_1":
+			polls++
+			status := StatusRunning
+			if polls == 2 {
+				status = StatusCompleted
+			}
+			json.NewEncoder(w).Encode(Pipeline{ID: "pip_1", Status: status})
+		default:
+			http.Error(w, `{"error":"pipeline not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	p, err := c.RunPipeline(ctx, &PipelineRequest{Steps: []PipelineStep{
+		{Name: "prep", SimpleExecRequest: SimpleExecRequest{Code: "print(1)"}},
+		{Name: "train", DependsOn: []string{"prep"}, SimpleExecRequest: SimpleExecRequest{Code: "print(2)"}},
+	}})
+	if err != nil || p.ID != "pip_1" {
+		t.Fatalf("RunPipeline() = %+v, %v", p, err)
+	}
+	// Step fields are sent inline, as for /eval
+	if len(sent.Steps) != 2 || sent.Steps[1].Code != "print(2)" || sent.Steps[1].DependsOn[0] != "prep" {
+		t.Errorf("sent %+v", sent)
+	}
+
+	p, err = c.WaitForPipeline(ctx, p.ID, time.Millisecond)
+	if err != nil || p.Status != StatusCompleted || polls != 2 {
+		t.Fatalf("WaitForPipeline() = %+v, %v after %d polls", p, err, polls)
+	}
+
+	if _, err := c.CancelPipeline(ctx, "pip_2"); !errors.Is(err, ErrPipelineNotFound) {
+		t.Errorf("CancelPipeline() error = %v, want ErrPipelineNotFound", err)
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ListPresets returns the server's resource presets by name. Select one
+// with Metadata.Preset or SimpleExecRequest.Preset.
+//
+// Example:
+//
+//	presets, err := c.ListPresets(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	for _, p := range presets {
+//	    fmt.Printf("%s: %d MB, %d s\n", p.Name, p.MemoryMB, p.TimeoutSeconds)
+//	}
+func (c *Client) ListPresets(ctx context.Context) ([]Preset, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v1/presets", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var list PresetList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Presets, nil
+}
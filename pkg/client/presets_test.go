@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListPresets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/presets" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(PresetList{Presets: []Preset{
+			{Name: "gpu-large", DockerImage: "pytorch/pytorch:latest", MemoryMB: 32768},
+			{Name: "small", MemoryMB: 512, TimeoutSeconds: 60},
+		}})
+	}))
+	defer srv.Close()
+
+	presets, err := New(srv.URL).ListPresets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presets) != 2 || presets[0].DockerImage != "pytorch/pytorch:latest" || presets[1].TimeoutSeconds != 60 {
+		t.Errorf("ListPresets() = %+v", presets)
+	}
+
+	if _, err := New(srv.URL + "/missing").ListPresets(context.Background()); err == nil {
+		t.Error("ListPresets() = nil error for a 404")
+	}
+}
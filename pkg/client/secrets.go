@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ListSecrets returns the names of the secrets registered on the server.
+// Pass one to a script with Metadata.Secrets or SimpleExecRequest.Secrets;
+// its value never leaves the server.
+//
+// Example:
+//
+//	names, err := c.ListSecrets(ctx)
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Println(strings.Join(names, "\n"))
+func (c *Client) ListSecrets(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/api/v1/secrets", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var list SecretList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Secrets, nil
+}
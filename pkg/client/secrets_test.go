@@ -0,0 +1,32 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/secrets" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(SecretList{Secrets: []string{"DB_PASSWORD", "OPENAI_API_KEY"}})
+	}))
+	defer srv.Close()
+
+	names, err := New(srv.URL).ListSecrets(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[1] != "OPENAI_API_KEY" {
+		t.Errorf("ListSecrets() = %v", names)
+	}
+
+	if _, err := New(srv.URL + "/missing").ListSecrets(context.Background()); err == nil {
+		t.Error("ListSecrets() = nil error for a 404")
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrSessionNotFound is returned, wrapped, for a session that was closed,
+// timed out while idle, or never existed.
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession starts a persistent session: a container running one
+// Python interpreter, in which code run by [Client.EvalSession] keeps its
+// variables and imports from one call to the next. Close it with
+// [Client.CloseSession] when done; otherwise the server closes it after
+// its idle timeout.
+//
+// Example:
+//
+//	session, err := c.CreateSession(ctx, &client.CreateSessionRequest{
+//	    RequirementsTxt: "pandas",
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	defer c.CloseSession(ctx, session.ID)
+//
+//	c.EvalSession(ctx, session.ID, &client.SessionEvalRequest{Code: "import pandas as pd\ndf = pd.DataFrame({'a': [1, 2]})"})
+//	result, err := c.EvalSession(ctx, session.ID, &client.SessionEvalRequest{Code: "df['a'].sum()"})
+//	// *result.Result == "3"
+func (c *Client) CreateSession(ctx context.Context, req *CreateSessionRequest) (*Session, error) {
+	var session Session
+	if err := c.doSession(ctx, c.httpClient, "POST", "/api/v1/sessions", req, http.StatusCreated, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetSession describes a session.
+func (c *Client) GetSession(ctx context.Context, sessionID string) (*Session, error) {
+	var session Session
+	if err := c.doSession(ctx, c.httpClient, "GET", "/api/v1/sessions/"+sessionID, nil, http.StatusOK, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// EvalSession runs code in a session. An exception raised by the code, or
+// a timeout, is reported in the result's Error and leaves the session
+// usable.
+func (c *Client) EvalSession(ctx context.Context, sessionID string, req *SessionEvalRequest) (*SessionEvalResult, error) {
+	var timeout time.Duration
+	if req != nil {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	hc := c.syncClientWithin(ctx, timeout)
+	var result SessionEvalResult
+	if err := c.doSession(ctx, hc, "POST", "/api/v1/sessions/"+sessionID+"/eval", req, http.StatusOK, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CloseSession closes a session and removes its container.
+func (c *Client) CloseSession(ctx context.Context, sessionID string) error {
+	return c.doSession(ctx, c.httpClient, "DELETE", "/api/v1/sessions/"+sessionID, nil, http.StatusNoContent, nil)
+}
+
+// doSession sends a session request through hc with an optional JSON body
+// and decodes the JSON response into out, unless out is nil
+func (c *Client) doSession(ctx context.Context, hc *http.Client, method, path string, in any, wantStatus int, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("server returned %d: %s: %w", resp.StatusCode, respBody, ErrSessionNotFound)
+		}
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSessions(t *testing.T) {
+	var evals []string
+	closed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v1/sessions":
+			var req CreateSessionRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(Session{ID: "ses_1", DockerImage: req.DockerImage})
+		case r.Method == "POST" && r.URL.Path == "/api/v1/sessions/ses_1/eval" && !closed:
+			var req SessionEvalRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			evals = append(evals, req.Code)
+			result := "42"
+			json.NewEncoder(w).Encode(SessionEvalResult{Result: &result})
+		case r.Method == "DELETE" && r.URL.Path == "/api/v1/sessions/ses_1":
+			closed = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, `{"error":"session not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	session, err := c.CreateSession(ctx, &CreateSessionRequest{DockerImage: "python:3.12-slim"})
+	if err != nil || session.ID != "ses_1" || session.DockerImage != "python:3.12-slim" {
+		t.Fatalf("CreateSession() = %+v, %v", session, err)
+	}
+
+	result, err := c.EvalSession(ctx, session.ID, &SessionEvalRequest{Code: "6 * 7"})
+	if err != nil || result.Result == nil || *result.Result != "42" || len(evals) != 1 || evals[0] != "6 * 7" {
+		t.Fatalf("EvalSession() = %+v, %v (sent %v)", result, err, evals)
+	}
+
+	if err := c.CloseSession(ctx, session.ID); err != nil {
+		t.Fatalf("CloseSession() error = %v", err)
+	}
+	if _, err := c.EvalSession(ctx, session.ID, &SessionEvalRequest{Code: "1"}); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("EvalSession() after close error = %v, want ErrSessionNotFound", err)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// StreamLogs follows an execution's output while it runs, calling onOutput
+// with each piece of stdout or stderr as the script writes it, and returns
+// the end frame, with the execution's status and exit code, once it has
+// finished. Unlike [Client.WatchExecution] nothing is polled: the output
+// arrives over a WebSocket.
+//
+// Output is live when the server instance answering runs the execution;
+// otherwise the full output arrives once the execution has finished. Call
+// [Client.GetExecution] afterwards for the rest of the result.
+//
+// Example:
+//
+//	end, err := c.StreamLogs(ctx, execID, func(f *client.LogFrame) {
+//	    if f.Stream == client.StreamStderr {
+//	        fmt.Fprint(os.Stderr, f.Data)
+//	    } else {
+//	        fmt.Print(f.Data)
+//	    }
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	fmt.Printf("Exit code: %d\n", end.ExitCode)
+func (c *Client) StreamLogs(ctx context.Context, executionID string, onOutput func(*LogFrame)) (*LogFrame, error) {
+	endpoint, err := url.Parse(fmt.Sprintf("%s/api/v1/executions/%s/logs/stream", c.baseURL, executionID))
+	if err != nil {
+		return nil, err
+	}
+	switch endpoint.Scheme {
+	case "https":
+		endpoint.Scheme = "wss"
+	default:
+		endpoint.Scheme = "ws"
+	}
+
+	header := http.Header{}
+	if c.tenant != "" {
+		header.Set(tenantHeader, c.tenant)
+	}
+	if c.apiKey != "" {
+		header.Set(apiKeyHeader, c.apiKey)
+	}
+	conn, resp, err := c.websocketDialer().DialContext(ctx, endpoint.String(), header)
+	if err != nil {
+		switch {
+		case resp == nil:
+			return nil, err
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, fmt.Errorf("execution not found")
+		default:
+			return nil, fmt.Errorf("server returned %d", resp.StatusCode)
+		}
+	}
+	defer conn.Close()
+
+	// Closing the connection interrupts a read waiting for output
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		var frame LogFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("reading log stream: %w", err)
+		}
+		switch frame.Type {
+		case FrameEnd:
+			return &frame, nil
+		case FrameOutput:
+			if onOutput != nil {
+				onOutput(&frame)
+			}
+		}
+	}
+}
+
+// websocketDialer returns a dialer using the proxy and TLS settings of the
+// client's HTTP transport, when it has them
+func (c *Client) websocketDialer() *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	transport := c.httpClient.Transport
+	if h, ok := transport.(*headerTransport); ok {
+		transport = h.base
+	}
+	if t, ok := transport.(*http.Transport); ok {
+		dialer.Proxy = t.Proxy
+		dialer.TLSClientConfig = t.TLSClientConfig
+		dialer.NetDialContext = t.DialContext
+	}
+	return &dialer
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStreamLogs(t *testing.T) {
+	var tenant, apiKey string
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/executions/exe_1/logs/stream" {
+			http.NotFound(w, r)
+			return
+		}
+		tenant = r.Header.Get(tenantHeader)
+		apiKey = r.Header.Get(apiKeyHeader)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(LogFrame{Type: FrameOutput, Stream: StreamStdout, Data: "epoch 1\n"})
+		conn.WriteJSON(LogFrame{Type: "heartbeat"})
+		conn.WriteJSON(LogFrame{Type: FrameOutput, Stream: StreamStderr, Data: "warning\n", Skipped: 10})
+		conn.WriteJSON(LogFrame{Type: FrameEnd, Status: StatusCompleted, ExitCode: 2})
+	}))
+	defer server.Close()
+
+	c := New(server.URL, WithTenant("team-a"), WithAPIKey("s3cret"))
+	var output []string
+	end, err := c.StreamLogs(context.Background(), "exe_1", func(f *LogFrame) {
+		output = append(output, string(f.Stream)+": "+f.Data)
+	})
+	if err != nil {
+		t.Fatalf("StreamLogs() error = %v", err)
+	}
+
+	// Only output frames reach the callback
+	if got := strings.Join(output, ""); got != "stdout: epoch 1\nstderr: warning\n" {
+		t.Errorf("output = %q", got)
+	}
+	if end.Status != StatusCompleted || end.ExitCode != 2 {
+		t.Errorf("end = %+v", end)
+	}
+	if tenant != "team-a" {
+		t.Errorf("tenant header = %q, want team-a", tenant)
+	}
+	if apiKey != "s3cret" {
+		t.Errorf("API key header = %q, want s3cret", apiKey)
+	}
+
+	if _, err := c.StreamLogs(context.Background(), "exe_2", nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("StreamLogs() of an unknown execution = %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// SubmitSweep queues one execution of the archive for every combination
+// of the sweep's parameters and returns at once. The executions share a
+// group: metadata.GroupID, or one chosen by the server. Use
+// [Client.GetGroup] to follow them.
+//
+// Example:
+//
+//	sw, err := c.SubmitSweep(ctx, tarData, &client.Metadata{Entrypoint: "train.py"}, &client.Sweep{
+//	    Env:  map[string][]string{"LR": {"0.1", "0.01"}, "BATCH": {"32", "64"}},
+//	    Args: [][]string{{"--seed", "1"}, {"--seed", "2"}},
+//	})
+//	if err != nil {
+//	    return err
+//	}
+//	g, err := c.GetGroup(ctx, sw.GroupID)
+func (c *Client) SubmitSweep(ctx context.Context, tarData []byte, metadata *Metadata, sweep *Sweep) (*SweepResponse, error) {
+	var resp *SweepResponse
+	err := c.withCachedArchive(ctx, tarData, metadata, func(tarData []byte, metadata *Metadata) error {
+		var err error
+		resp, err = c.postSweep(ctx, tarData, metadata, sweep)
+		return err
+	})
+	return resp, err
+}
+
+// postSweep submits a multipart request to the sweeps endpoint
+func (c *Client) postSweep(ctx context.Context, tarData []byte, metadata *Metadata, sweep *Sweep) (*SweepResponse, error) {
+	sweepJSON, err := json.Marshal(sweep)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("sweep", string(sweepJSON)); err != nil {
+		return nil, err
+	}
+	if err := writeMultipart(writer, tarData, metadata, nil); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/sweeps", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("server returned %d: %w", resp.StatusCode, ErrArchiveNotCached)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var sweepResp SweepResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sweepResp); err != nil {
+		return nil, err
+	}
+	return &sweepResp, nil
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubmitSweep(t *testing.T) {
+	var sent Sweep
+	var meta Metadata
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/sweeps" {
+			http.NotFound(w, r)
+			return
+		}
+		json.Unmarshal([]byte(r.FormValue("sweep")), &sent)
+		json.Unmarshal([]byte(r.FormValue("metadata")), &meta)
+		if _, _, err := r.FormFile("tar"); err != nil {
+			t.Errorf("no tar part: %v", err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(SweepResponse{GroupID: "grid", Executions: []SweepExecution{
+			{ExecutionID: "exe_1", Env: map[string]string{"LR": "0.1"}},
+			{ExecutionID: "exe_2", Env: map[string]string{"LR": "0.01"}},
+		}})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	resp, err := c.SubmitSweep(context.Background(), []byte("tar"), &Metadata{Entrypoint: "train.py", GroupID: "grid"}, &Sweep{
+		Env: map[string][]string{"LR": {"0.1", "0.01"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GroupID != "grid" || len(resp.Executions) != 2 || resp.Executions[1].Env["LR"] != "0.01" {
+		t.Errorf("SubmitSweep() = %+v", resp)
+	}
+	if len(sent.Env["LR"]) != 2 || meta.Entrypoint != "train.py" || meta.GroupID != "grid" {
+		t.Errorf("sent sweep %+v with metadata %+v", sent, meta)
+	}
+}
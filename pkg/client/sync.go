@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrFilesMissing is returned, wrapped, by [Client.CreateArchive] when the
+// server doesn't hold some of the files.
+var ErrFilesMissing = errors.New("server is missing files")
+
+// SyncDirectory makes the server hold an archive of a directory, uploading
+// only the files it doesn't already have, and returns the archive's hex
+// SHA-256. Run it by setting [Metadata.ArchiveSHA256] and passing a nil
+// tarData to [Client.ExecuteSync] or [Client.ExecuteAsync].
+//
+// Each file's hash is remembered by the client along with its size and
+// modification time, so a repeat sync of a large directory only reads
+// the files that changed, and only uploads those the server lacks. The
+// archive holds the directory's regular files with their permissions;
+// empty directories are left out. The server must have its archive cache
+// enabled.
+//
+// Example:
+//
+//	for range changes {
+//	    sum, err := c.SyncDirectory(ctx, "./myproject")
+//	    if err != nil {
+//	        return err
+//	    }
+//	    result, err := c.ExecuteSync(ctx, nil, &client.Metadata{
+//	        Entrypoint:    "main.py",
+//	        ArchiveSHA256: sum,
+//	    })
+//	}
+func (c *Client) SyncDirectory(ctx context.Context, dirPath string) (string, error) {
+	var files []ArchiveFile
+	paths := make(map[string]string)
+	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dirPath, path)
+		if err != nil {
+			return err
+		}
+		sum, err := c.fileHashes.hash(path, info)
+		if err != nil {
+			return err
+		}
+		files = append(files, ArchiveFile{
+			Name:   filepath.ToSlash(relPath),
+			SHA256: sum,
+			Mode:   fmt.Sprintf("%04o", info.Mode().Perm()),
+		})
+		paths[sum] = path
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walking directory: %w", err)
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files in %s", dirPath)
+	}
+
+	sums := make([]string, 0, len(paths))
+	for sum := range paths {
+		sums = append(sums, sum)
+	}
+
+	// A file the server had can expire before the archive is made, so
+	// that is retried once
+	for attempt := 0; ; attempt++ {
+		missing, err := c.FindMissingFiles(ctx, sums)
+		if err != nil {
+			return "", err
+		}
+		for _, sum := range missing {
+			if err := c.uploadPath(ctx, sum, paths[sum]); err != nil {
+				return "", err
+			}
+		}
+
+		archive, err := c.CreateArchive(ctx, files)
+		if errors.Is(err, ErrFilesMissing) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return archive.SHA256, nil
+	}
+}
+
+// uploadPath uploads the file at path, which hashed to sum
+func (c *Client) uploadPath(ctx context.Context, sum, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := c.UploadFile(ctx, sum, f); err != nil {
+		return fmt.Errorf("uploading %s: %w", path, err)
+	}
+	return nil
+}
+
+// FindMissingFiles returns the hex SHA-256 digests in sums of the files
+// the server doesn't hold.
+func (c *Client) FindMissingFiles(ctx context.Context, sums []string) ([]string, error) {
+	var resp MissingFilesResponse
+	if err := c.doFiles(ctx, "POST", "/api/v1/files/missing", MissingFilesRequest{SHA256: sums}, http.StatusOK, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Missing, nil
+}
+
+// UploadFile stores a file's contents on the server under their hex
+// SHA-256, for [Client.CreateArchive] to build archives from.
+func (c *Client) UploadFile(ctx context.Context, sha256 string, r io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.baseURL+"/api/v1/files/"+sha256, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// CreateArchive has the server build an archive from files uploaded with
+// [Client.UploadFile] and add it to its archive cache. If the server is
+// missing any of the files the error wraps [ErrFilesMissing].
+func (c *Client) CreateArchive(ctx context.Context, files []ArchiveFile) (*Archive, error) {
+	var archive Archive
+	if err := c.doFiles(ctx, "POST", "/api/v1/archives", CreateArchiveRequest{Files: files}, http.StatusCreated, &archive); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+// doFiles sends a JSON request to one of the incremental upload endpoints
+// and decodes the response into out
+func (c *Client) doFiles(ctx context.Context, method, path string, in any, wantStatus int, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusConflict {
+			return fmt.Errorf("server returned %d: %s: %w", resp.StatusCode, respBody, ErrFilesMissing)
+		}
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// fileHashCache remembers the SHA-256 of files, so that files that haven't
+// changed since they were last hashed aren't read again
+type fileHashCache struct {
+	mu     sync.Mutex
+	hashes map[string]fileHash
+}
+
+// fileHash is a file's hash and the size and modification time it had
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// hash returns the hex SHA-256 of the file at path
+func (h *fileHashCache) hash(path string, info os.FileInfo) (string, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	h.mu.Lock()
+	cached, ok := h.hashes[key]
+	h.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+
+	h.mu.Lock()
+	if h.hashes == nil {
+		h.hashes = make(map[string]fileHash)
+	}
+	h.hashes[key] = fileHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	h.mu.Unlock()
+	return sum, nil
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFileServer implements the incremental upload endpoints, recording
+// which files were uploaded
+type fakeFileServer struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	uploads  []string
+	manifest []ArchiveFile
+}
+
+func (f *fakeFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/v1/files/missing":
+		var req MissingFilesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		missing := []string{}
+		for _, sum := range req.SHA256 {
+			if _, ok := f.files[sum]; !ok {
+				missing = append(missing, sum)
+			}
+		}
+		json.NewEncoder(w).Encode(MissingFilesResponse{Missing: missing})
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/api/v1/files/"):
+		sum := strings.TrimPrefix(r.URL.Path, "/api/v1/files/")
+		data, _ := io.ReadAll(r.Body)
+		if ArchiveSHA256(data) != sum {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		f.files[sum] = data
+		f.uploads = append(f.uploads, sum)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/archives":
+		var req CreateArchiveRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		for _, file := range req.Files {
+			if _, ok := f.files[file.SHA256]; !ok {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		f.manifest = req.Files
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Archive{SHA256: "archive"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestSyncDirectory_UploadsOnlyChanges(t *testing.T) {
+	fake := &fakeFileServer{files: make(map[string][]byte)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "pkg"), 0755)
+	os.WriteFile(filepath.Join(dir, "main.py"), []byte("import pkg.lib"), 0644)
+	os.WriteFile(filepath.Join(dir, "pkg", "lib.py"), []byte("x = 1"), 0644)
+	os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh"), 0755)
+
+	c := New(srv.URL)
+	sum, err := c.SyncDirectory(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("SyncDirectory() error = %v", err)
+	}
+	if sum != "archive" || len(fake.uploads) != 3 {
+		t.Fatalf("SyncDirectory() = %q with %d uploads, want archive with 3", sum, len(fake.uploads))
+	}
+	want := []ArchiveFile{
+		{Name: "main.py", SHA256: ArchiveSHA256([]byte("import pkg.lib")), Mode: "0644"},
+		{Name: "pkg/lib.py", SHA256: ArchiveSHA256([]byte("x = 1")), Mode: "0644"},
+		{Name: "run.sh", SHA256: ArchiveSHA256([]byte("#!/bin/sh")), Mode: "0755"},
+	}
+	for i := range want {
+		if i >= len(fake.manifest) || fake.manifest[i] != want[i] {
+			t.Fatalf("manifest = %+v, want %+v", fake.manifest, want)
+		}
+	}
+
+	// Only the changed file goes up again
+	later := time.Now().Add(time.Second)
+	os.WriteFile(filepath.Join(dir, "pkg", "lib.py"), []byte("x = 2"), 0644)
+	os.Chtimes(filepath.Join(dir, "pkg", "lib.py"), later, later)
+	fake.uploads = nil
+	if _, err := c.SyncDirectory(context.Background(), dir); err != nil {
+		t.Fatalf("SyncDirectory() again error = %v", err)
+	}
+	if len(fake.uploads) != 1 || fake.uploads[0] != ArchiveSHA256([]byte("x = 2")) {
+		t.Errorf("second sync uploaded %v, want only pkg/lib.py", fake.uploads)
+	}
+}
+
+func TestFileHashCache_SkipsUnchangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.py")
+	os.WriteFile(path, []byte("one"), 0644)
+	info, _ := os.Stat(path)
+
+	var cache fileHashCache
+	first, err := cache.hash(path, info)
+	if err != nil || first != ArchiveSHA256([]byte("one")) {
+		t.Fatalf("hash() = %q, %v", first, err)
+	}
+
+	// Same size and time means the file isn't read again
+	os.WriteFile(path, []byte("two"), 0644)
+	os.Chtimes(path, info.ModTime(), info.ModTime())
+	if sum, _ := cache.hash(path, info); sum != first {
+		t.Errorf("hash() of unchanged stat = %q, want cached %q", sum, first)
+	}
+
+	info, _ = os.Stat(path)
+	changed := info.ModTime().Add(time.Second)
+	os.Chtimes(path, changed, changed)
+	info, _ = os.Stat(path)
+	if sum, _ := cache.hash(path, info); sum != ArchiveSHA256([]byte("two")) {
+		t.Errorf("hash() after change = %q, want new hash", sum)
+	}
+}
+
+func TestCreateArchive_FilesMissing(t *testing.T) {
+	srv := httptest.NewServer(&fakeFileServer{files: make(map[string][]byte)})
+	defer srv.Close()
+
+	_, err := New(srv.URL).CreateArchive(context.Background(), []ArchiveFile{{Name: "main.py", SHA256: "abc"}})
+	if !errors.Is(err, ErrFilesMissing) {
+		t.Errorf("CreateArchive() error = %v, want ErrFilesMissing", err)
+	}
+}
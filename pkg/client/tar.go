@@ -3,6 +3,7 @@ package client
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
@@ -47,10 +48,30 @@ func TarFromFiles(files []string) ([]byte, error) {
 //
 //	tarData, err := client.TarFromDirectory("./myproject")
 func TarFromDirectory(dirPath string) ([]byte, error) {
+	tarData, _, err := TarFromDirectoryExcluding(dirPath, nil)
+	return tarData, err
+}
+
+// TarFromDirectoryExcluding creates an uncompressed tar archive from a
+// directory like [TarFromDirectory], leaving out entries that match any of
+// the exclude patterns, and returns the relative paths it left out.
+//
+// Patterns use [filepath.Match] syntax and are matched against both an
+// entry's name and its path relative to the directory, with forward
+// slashes. An excluded directory is left out with everything in it and is
+// reported once, with a trailing slash.
+//
+// Example:
+//
+//	tarData, ignored, err := client.TarFromDirectoryExcluding("./myproject",
+//	    []string{".git", "__pycache__", "*.pyc"})
+func TarFromDirectoryExcluding(dirPath string, exclude []string) ([]byte, []string, error) {
 	var buf bytes.Buffer
 	tw := tar.NewWriter(&buf)
 	defer tw.Close()
 
+	var ignored []string
+
 	// Walk the directory tree
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -68,18 +89,42 @@ func TarFromDirectory(dirPath string) ([]byte, error) {
 			return err
 		}
 
+		if excluded(filepath.ToSlash(relPath), exclude) {
+			if info.IsDir() {
+				ignored = append(ignored, filepath.ToSlash(relPath)+"/")
+				return filepath.SkipDir
+			}
+			ignored = append(ignored, filepath.ToSlash(relPath))
+			return nil
+		}
+
 		return addFileToTar(tw, path, relPath)
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("walking directory: %w", err)
+		return nil, nil, fmt.Errorf("walking directory: %w", err)
 	}
 
 	if err := tw.Close(); err != nil {
-		return nil, fmt.Errorf("closing tar: %w", err)
+		return nil, nil, fmt.Errorf("closing tar: %w", err)
 	}
 
-	return buf.Bytes(), nil
+	return buf.Bytes(), ignored, nil
+}
+
+// excluded reports whether relPath, or its last element, matches any of
+// the patterns
+func excluded(relPath string, patterns []string) bool {
+	name := filepath.Base(relPath)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // TarFromReader creates a tar archive from an io.Reader (e.g., stdin).
@@ -125,6 +170,8 @@ func TarFromReader(r io.Reader, filename string) ([]byte, error) {
 // TarFromMap creates a tar archive from a map of filename to content.
 //
 // This is the most convenient way to create a tar archive for simple scripts.
+// Files starting with a "#!" line are made executable (0755), so helper
+// scripts can be run from pre-commands; others get 0644.
 //
 // Example:
 //
@@ -138,9 +185,14 @@ func TarFromMap(files map[string]string) ([]byte, error) {
 	defer tw.Close()
 
 	for filename, content := range files {
+		var mode int64 = 0644
+		if strings.HasPrefix(content, "#!") {
+			mode = 0755
+		}
+
 		header := &tar.Header{
 			Name: filename,
-			Mode: 0644,
+			Mode: mode,
 			Size: int64(len(content)),
 		}
 
@@ -185,16 +237,17 @@ func addFileToTar(tw *tar.Writer, filePath string, tarPath string) error {
 	if info.IsDir() {
 		header := &tar.Header{
 			Name:     tarPath + "/",
-			Mode:     int64(info.Mode()),
+			Mode:     int64(info.Mode().Perm()),
 			Typeflag: tar.TypeDir,
 		}
 		return tw.WriteHeader(header)
 	}
 
-	// Handle regular files
+	// Handle regular files, keeping their permissions so executable
+	// scripts stay executable
 	header := &tar.Header{
 		Name: tarPath,
-		Mode: int64(info.Mode()),
+		Mode: int64(info.Mode().Perm()),
 		Size: info.Size(),
 	}
 
@@ -213,9 +266,13 @@ func addFileToTar(tw *tar.Writer, filePath string, tarPath string) error {
 //  2. __main__.py
 //  3. First .py file found
 //
-// Returns an error if no Python files are found.
+// Gzip-compressed archives are read transparently. Returns an error if no
+// Python files are found.
 func DetectEntrypoint(tarData []byte) (string, error) {
-	reader := tar.NewReader(bytes.NewReader(tarData))
+	reader, err := newTarReader(tarData)
+	if err != nil {
+		return "", err
+	}
 
 	var candidates []string
 	var firstPy string
@@ -255,3 +312,62 @@ func DetectEntrypoint(tarData []byte) (string, error) {
 
 	return "", fmt.Errorf("no Python files found in archive")
 }
+
+// ArchiveEntry describes one entry of a tar archive.
+type ArchiveEntry struct {
+	// Name is the entry's path in the archive.
+	Name string
+	// Size is the size of a regular file's contents in bytes.
+	Size int64
+	// Mode holds the entry's permissions and type.
+	Mode os.FileMode
+	// Linkname is the target of a symlink or hard link.
+	Linkname string
+}
+
+// ListArchive returns the entries of a tar archive in order, reading
+// gzip-compressed archives transparently.
+//
+// Example:
+//
+//	entries, err := client.ListArchive(tarData)
+//	for _, e := range entries {
+//	    fmt.Printf("%v %8d %s\n", e.Mode, e.Size, e.Name)
+//	}
+func ListArchive(tarData []byte) ([]ArchiveEntry, error) {
+	reader, err := newTarReader(tarData)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []ArchiveEntry
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, ArchiveEntry{
+			Name:     header.Name,
+			Size:     header.Size,
+			Mode:     header.FileInfo().Mode(),
+			Linkname: header.Linkname,
+		})
+	}
+}
+
+// newTarReader reads a tar archive, decompressing it first if it is
+// gzipped
+func newTarReader(tarData []byte) (*tar.Reader, error) {
+	var r io.Reader = bytes.NewReader(tarData)
+	if len(tarData) >= 2 && tarData[0] == 0x1f && tarData[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	return tar.NewReader(r), nil
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"io"
 	"os"
 	"path/filepath"
@@ -48,6 +49,28 @@ func TestTarFromMap(t *testing.T) {
 	}
 }
 
+func TestTarFromMap_ExecutableScripts(t *testing.T) {
+	tarData, err := TarFromMap(map[string]string{
+		"main.py":  "print('hello')",
+		"setup.sh": "#!/bin/sh\necho setup",
+	})
+	require.NoError(t, err)
+
+	modes := make(map[string]int64)
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		modes[header.Name] = header.Mode
+	}
+
+	assert.Equal(t, int64(0644), modes["main.py"])
+	assert.Equal(t, int64(0755), modes["setup.sh"])
+}
+
 func TestTarFromReader(t *testing.T) {
 	content := "print('hello from stdin')"
 	reader := strings.NewReader(content)
@@ -139,6 +162,72 @@ func TestTarFromDirectory(t *testing.T) {
 	assert.True(t, found["utils/helper.py"])
 }
 
+func TestTarFromDirectory_KeepsModes(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "main.py"), []byte("main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.Chmod(filepath.Join(tmpDir, "run.sh"), 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(tmpDir, "lib"), 0755))
+
+	tarData, err := TarFromDirectory(tmpDir)
+	require.NoError(t, err)
+
+	modes := make(map[string]int64)
+	tr := tar.NewReader(bytes.NewReader(tarData))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		modes[header.Name] = header.Mode
+	}
+
+	assert.Equal(t, int64(0644), modes["main.py"])
+	assert.Equal(t, int64(0755), modes["run.sh"])
+	assert.Equal(t, int64(0755), modes["lib/"])
+}
+
+func TestTarFromDirectoryExcluding(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "main.py"), []byte("main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "main.pyc"), []byte("bytecode"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "lib", "__pycache__"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "lib", "__pycache__", "x.pyc"), []byte("bytecode"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "lib", "util.py"), []byte("util"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "data", "raw"), 0755))
+
+	tarData, ignored, err := TarFromDirectoryExcluding(tmpDir, []string{"__pycache__", "*.pyc", "data/raw"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/raw/", "lib/__pycache__/", "main.pyc"}, ignored)
+
+	entries, err := ListArchive(tarData)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"data/", "lib/", "lib/util.py", "main.py"}, names)
+}
+
+func TestListArchive(t *testing.T) {
+	tarData, err := TarFromMap(map[string]string{"run.sh": "#!/bin/sh\n"})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	entries, err := ListArchive(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "run.sh", entries[0].Name)
+	assert.Equal(t, int64(10), entries[0].Size)
+	assert.Equal(t, os.FileMode(0755), entries[0].Mode)
+}
+
 func TestDetectEntrypoint(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -182,6 +271,21 @@ func TestDetectEntrypoint(t *testing.T) {
 	}
 }
 
+func TestDetectEntrypoint_Gzip(t *testing.T) {
+	tarData, err := TarFromMap(map[string]string{"lib.py": "", "main.py": ""})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(tarData)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	entrypoint, err := DetectEntrypoint(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "main.py", entrypoint)
+}
+
 func TestDetectEntrypoint_NoFiles(t *testing.T) {
 	files := map[string]string{
 		"README.md": "# Project",
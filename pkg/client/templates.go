@@ -0,0 +1,176 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrTemplateNotFound is returned, wrapped, for a template name the server
+// has no template for.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// PutTemplate stores a template under its name, replacing any template of
+// that name, and returns it as stored.
+//
+// Example:
+//
+//	_, err := c.PutTemplate(ctx, &client.Template{
+//	    Name:        "daily-report",
+//	    Description: "Build the daily sales report for a region",
+//	    Params:      []client.TemplateParam{{Name: "region", Required: true}},
+//	    SimpleExecRequest: client.SimpleExecRequest{
+//	        Code: "import report\nreport.build('{{region}}')",
+//	    },
+//	})
+func (c *Client) PutTemplate(ctx context.Context, t *Template) (*Template, error) {
+	var stored Template
+	if err := c.doTemplate(ctx, "PUT", "/api/v1/templates/"+url.PathEscape(t.Name), t, http.StatusOK, &stored); err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// GetTemplate returns a template, with its code and files.
+func (c *Client) GetTemplate(ctx context.Context, name string) (*Template, error) {
+	var t Template
+	if err := c.doTemplate(ctx, "GET", "/api/v1/templates/"+url.PathEscape(name), nil, http.StatusOK, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListTemplates returns the stored templates by name, without their code,
+// files or stdin.
+func (c *Client) ListTemplates(ctx context.Context) ([]Template, error) {
+	var list TemplateList
+	if err := c.doTemplate(ctx, "GET", "/api/v1/templates", nil, http.StatusOK, &list); err != nil {
+		return nil, err
+	}
+	return list.Templates, nil
+}
+
+// DeleteTemplate removes a template.
+func (c *Client) DeleteTemplate(ctx context.Context, name string) error {
+	return c.doTemplate(ctx, "DELETE", "/api/v1/templates/"+url.PathEscape(name), nil, http.StatusNoContent, nil)
+}
+
+// RenderTemplate returns the request a run of a template with these
+// parameters would make, without running it.
+func (c *Client) RenderTemplate(ctx context.Context, name string, params map[string]string) (*SimpleExecRequest, error) {
+	var req SimpleExecRequest
+	path := "/api/v1/templates/" + url.PathEscape(name) + "/render"
+	if err := c.doTemplate(ctx, "POST", path, &TemplateRunRequest{Params: params}, http.StatusOK, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// RunTemplate runs a template and waits for the result, as [Client.Eval]
+// does. req.Async is ignored; use [Client.RunTemplateAsync] to queue a run.
+//
+// Example:
+//
+//	result, err := c.RunTemplate(ctx, "daily-report", &client.TemplateRunRequest{
+//	    Params: map[string]string{"region": "eu"},
+//	})
+func (c *Client) RunTemplate(ctx context.Context, name string, req *TemplateRunRequest) (*ExecutionResult, error) {
+	run := TemplateRunRequest{}
+	if req != nil {
+		run = *req
+	}
+	run.Async = false
+	body, err := json.Marshal(&run)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/api/v1/templates/"+url.PathEscape(name)+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.syncClientWithin(ctx, 0).Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result ExecutionResult
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	case http.StatusAccepted:
+		return c.followDetached(ctx, resp.Body)
+	}
+	return nil, templateError(resp)
+}
+
+// RunTemplateAsync queues a run of a template and returns its execution ID
+// at once, as [Client.ExecuteAsync] does.
+func (c *Client) RunTemplateAsync(ctx context.Context, name string, req *TemplateRunRequest) (string, error) {
+	run := TemplateRunRequest{}
+	if req != nil {
+		run = *req
+	}
+	run.Async = true
+
+	var accepted AsyncResponse
+	path := "/api/v1/templates/" + url.PathEscape(name) + "/run"
+	if err := c.doTemplate(ctx, "POST", path, &run, http.StatusAccepted, &accepted); err != nil {
+		return "", err
+	}
+	return accepted.ExecutionID, nil
+}
+
+// doTemplate sends a template request with an optional JSON body and
+// decodes the JSON response, if any, into out
+func (c *Client) doTemplate(ctx context.Context, method, path string, in any, wantStatus int, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return templateError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// templateError describes an unexpected response to a template request
+func templateError(resp *http.Response) error {
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("server returned %d: %s: %w", resp.StatusCode, respBody, ErrTemplateNotFound)
+	}
+	return fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+}
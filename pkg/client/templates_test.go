@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	var runs []TemplateRunRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/api/v1/templates/greet":
+			var tmpl Template
+			json.NewDecoder(r.Body).Decode(&tmpl)
+			json.NewEncoder(w).Encode(tmpl)
+		case r.Method == "GET" && r.URL.Path == "/api/v1/templates":
+			json.NewEncoder(w).Encode(TemplateList{Templates: []Template{{Name: "greet"}}})
+		case r.Method == "POST" && r.URL.Path == "/api/v1/templates/greet/render":
+			json.NewEncoder(w).Encode(SimpleExecRequest{Code: "print('hello world')"})
+		case r.Method == "POST" && r.URL.Path == "/api/v1/templates/greet/run":
+			var run TemplateRunRequest
+			json.NewDecoder(r.Body).Decode(&run)
+			runs = append(runs, run)
+			if run.Async {
+				w.WriteHeader(http.StatusAccepted)
+				json.NewEncoder(w).Encode(AsyncResponse{ExecutionID: "exe_2"})
+				return
+			}
+			json.NewEncoder(w).Encode(ExecutionResult{ExecutionID: "exe_1", Status: StatusCompleted, Stdout: "hello world\n"})
+		case r.Method == "DELETE" && r.URL.Path == "/api/v1/templates/greet":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, `{"error":"template not found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	stored, err := c.PutTemplate(ctx, &Template{
+		Name:              "greet",
+		Params:            []TemplateParam{{Name: "who", Required: true}},
+		SimpleExecRequest: SimpleExecRequest{Code: "print('hello {{who}}')"},
+	})
+	if err != nil || stored.Code != "print('hello {{who}}')" || stored.Params[0].Name != "who" {
+		t.Fatalf("PutTemplate() = %+v, %v", stored, err)
+	}
+
+	list, err := c.ListTemplates(ctx)
+	if err != nil || len(list) != 1 || list[0].Name != "greet" {
+		t.Errorf("ListTemplates() = %+v, %v", list, err)
+	}
+
+	rendered, err := c.RenderTemplate(ctx, "greet", map[string]string{"who": "world"})
+	if err != nil || rendered.Code != "print('hello world')" {
+		t.Errorf("RenderTemplate() = %+v, %v", rendered, err)
+	}
+
+	// Async is set by the method called, not the request
+	params := map[string]string{"who": "world"}
+	result, err := c.RunTemplate(ctx, "greet", &TemplateRunRequest{Params: params, Async: true})
+	if err != nil || result.Stdout != "hello world\n" {
+		t.Errorf("RunTemplate() = %+v, %v", result, err)
+	}
+	execID, err := c.RunTemplateAsync(ctx, "greet", &TemplateRunRequest{Params: params})
+	if err != nil || execID != "exe_2" {
+		t.Errorf("RunTemplateAsync() = %q, %v", execID, err)
+	}
+	if len(runs) != 2 || runs[0].Async || !runs[1].Async || runs[1].Params["who"] != "world" {
+		t.Errorf("runs = %+v", runs)
+	}
+
+	if err := c.DeleteTemplate(ctx, "greet"); err != nil {
+		t.Errorf("DeleteTemplate() = %v", err)
+	}
+	if _, err := c.GetTemplate(ctx, "other"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("GetTemplate() error = %v, want ErrTemplateNotFound", err)
+	}
+	if _, err := c.RunTemplate(ctx, "other", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("RunTemplate() error = %v, want ErrTemplateNotFound", err)
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ToolSchema returns the server's /eval endpoint described as a tool for
+// LLM function calling, in OpenAI's format. name is the function's name;
+// empty means "execute_python".
+//
+// Example:
+//
+//	tool, err := c.ToolSchema(ctx, "")
+//	if err != nil {
+//	    return err
+//	}
+//	// Register tool with the model; when it calls the function:
+//	var req client.SimpleExecRequest
+//	json.Unmarshal([]byte(call.Arguments), &req)
+//	result, err := c.Eval(ctx, &req)
+func (c *Client) ToolSchema(ctx context.Context, name string) (*Tool, error) {
+	endpoint := c.baseURL + "/api/v1/tool-schema"
+	if name != "" {
+		endpoint += "?" + url.Values{"name": {name}}.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var tool Tool
+	if err := json.NewDecoder(resp.Body).Decode(&tool); err != nil {
+		return nil, err
+	}
+	return &tool, nil
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToolSchema(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/tool-schema" {
+			http.NotFound(w, r)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = "execute_python"
+		}
+		json.NewEncoder(w).Encode(Tool{Type: "function", Function: ToolFunction{
+			Name:       name,
+			Parameters: map[string]any{"type": "object"},
+		}})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	tool, err := c.ToolSchema(context.Background(), "")
+	if err != nil || tool.Function.Name != "execute_python" || tool.Function.Parameters["type"] != "object" {
+		t.Fatalf("ToolSchema() = %+v, %v", tool, err)
+	}
+	tool, err = c.ToolSchema(context.Background(), "run_py")
+	if err != nil || tool.Function.Name != "run_py" {
+		t.Errorf("ToolSchema(run_py) = %+v, %v", tool, err)
+	}
+}
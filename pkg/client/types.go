@@ -1,6 +1,9 @@
 package client
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ExecutionStatus represents the status of a code execution.
 type ExecutionStatus string
@@ -17,8 +20,59 @@ const (
 	StatusFailed ExecutionStatus = "failed"
 	// StatusKilled indicates the execution was terminated by the user.
 	StatusKilled ExecutionStatus = "killed"
+	// StatusCancelled indicates the execution was cancelled before it started.
+	StatusCancelled ExecutionStatus = "cancelled"
+	// StatusAwaitingApproval indicates the execution matched one of the
+	// server's approval rules and waits for an admin to approve or reject it.
+	StatusAwaitingApproval ExecutionStatus = "awaiting_approval"
+)
+
+// ExecutionPhase is the stage a running execution is in.
+type ExecutionPhase string
+
+// Execution phase constants.
+const (
+	// PhasePulling indicates the execution's Docker image is being pulled.
+	PhasePulling ExecutionPhase = "pulling"
+	// PhaseInstalling indicates requirements are being installed or
+	// pre-commands run.
+	PhaseInstalling ExecutionPhase = "installing"
+	// PhaseRunning indicates the script itself is running.
+	PhaseRunning ExecutionPhase = "running"
 )
 
+// TerminationReason explains why an execution was stopped by a signal.
+type TerminationReason string
+
+// Termination reason constants.
+const (
+	// TerminationTimeout indicates the execution exceeded its timeout.
+	TerminationTimeout TerminationReason = "timeout"
+	// TerminationKilled indicates the execution was killed through the API.
+	TerminationKilled TerminationReason = "killed"
+	// TerminationOOM indicates the container ran out of memory.
+	TerminationOOM TerminationReason = "oom"
+	// TerminationDiskLimit indicates the execution wrote more than its
+	// disk limit (ExecutionConfig.DiskMB) and was stopped.
+	TerminationDiskLimit TerminationReason = "disk_limit_exceeded"
+	// TerminationDisconnected indicates the caller of a sync execution
+	// disconnected and the server killed the execution.
+	TerminationDisconnected TerminationReason = "disconnected"
+	// TerminationRejected indicates an admin rejected an execution that was
+	// awaiting approval; it never ran.
+	TerminationRejected TerminationReason = "rejected"
+)
+
+// IsTerminal reports whether the status is final (the execution will not
+// change state again).
+func (s ExecutionStatus) IsTerminal() bool {
+	switch s {
+	case StatusCompleted, StatusFailed, StatusKilled, StatusCancelled:
+		return true
+	}
+	return false
+}
+
 // Metadata contains execution parameters sent to the server.
 //
 // At minimum, Entrypoint must be specified. All other fields are optional.
@@ -49,11 +103,139 @@ type Metadata struct {
 	EnvVars []string `json:"env_vars,omitempty"`
 	// ScriptArgs are arguments passed to the Python script (sys.argv).
 	ScriptArgs []string `json:"script_args,omitempty"`
-	// EvalLastExpr enables REPL-style behavior for simple execution.
-	// Internal use only - set via SimpleExecRequest.EvalLastExpr.
-	EvalLastExpr bool `json:"-"`
+	// EvalLastExpr enables REPL-style behavior: if the entrypoint's last
+	// statement is an expression, its repr() is returned in
+	// ExecutionResult.Result instead of being discarded.
+	EvalLastExpr bool `json:"eval_last_expr,omitempty"`
+	// AutoInstall detects the third-party packages imported by the
+	// archive's .py files and adds them to RequirementsTxt. Entries already
+	// in RequirementsTxt keep their version pins. The result's Install
+	// lists the detected packages in Detected and, as FreezePackages is
+	// turned on, their installed versions in Packages.
+	AutoInstall bool `json:"auto_install,omitempty"`
+	// UploadID runs the archive of a completed chunked upload (see
+	// [Client.UploadArchive]) instead of one sent with the request.
+	UploadID string `json:"upload_id,omitempty"`
+	// ArchiveSHA256 runs an archive the server has cached, by the hex
+	// SHA-256 of its bytes as sent, instead of one sent with the request.
+	// See [Client.HasArchive] and [WithArchiveCache].
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+
+	// Mode selects how the files are run. Empty runs Entrypoint as a
+	// script; ModePytest runs pytest and returns the parsed results in
+	// ExecutionResult.Tests.
+	Mode string `json:"mode,omitempty"`
+
+	// Retry re-runs the execution when an attempt fails in one of the
+	// ways it lists. Nil runs it once.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// GroupID adds the execution to a group, chosen by the caller, so that
+	// a fan-out of executions can be followed and killed together through
+	// /groups/{id}. It is up to 128 letters, digits, '.', '_', ':' and '-'.
+	GroupID string `json:"group_id,omitempty"`
+
+	// Preset selects one of the server's resource presets (see
+	// [Client.ListPresets]), which sets the image, memory, CPU, disk and
+	// timeout that DockerImage and Config leave unset.
+	Preset string `json:"preset,omitempty"`
+
+	// Labels are key/value pairs chosen by the caller that executions can
+	// be searched by. Keys are up to 63 letters, digits, '.', '_', '/' and
+	// '-'; values up to 256 characters; at most 32 labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Secrets names secrets registered on the server (see
+	// [Client.ListSecrets]) to pass to the script as environment variables
+	// of the same names. Their values are read by the server when the
+	// container starts and masked in the stored output.
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Placement restricts the execution to server instances with every
+	// one of these labels, e.g. {"gpu": "true"}. Async executions wait in
+	// the queue for such an instance; sync ones are refused by any other.
+	Placement map[string]string `json:"placement,omitempty"`
+}
+
+// FailureKind classifies how an execution attempt failed, for
+// [RetryPolicy.RetryOn].
+type FailureKind string
+
+// Failure kind constants.
+const (
+	// FailureInfraError means the service could not run the script, e.g.
+	// Docker failed to create or start the container.
+	FailureInfraError FailureKind = "infra_error"
+	// FailureTimeout means the script ran past its timeout.
+	FailureTimeout FailureKind = "timeout"
+	// FailurePullTimeout means pulling the image took longer than the
+	// server's pull timeout.
+	FailurePullTimeout FailureKind = "pull_timeout"
+	// FailureInstallTimeout means installing the requirements or running
+	// the pre-commands ran past ExecutionConfig.InstallTimeoutSeconds.
+	FailureInstallTimeout FailureKind = "install_timeout"
+	// FailureOOM means the container ran out of memory.
+	FailureOOM FailureKind = "oom"
+	// FailureDiskLimit means the script wrote more than its disk limit.
+	FailureDiskLimit FailureKind = "disk_limit_exceeded"
+	// FailureInstallError means installing the requirements or running
+	// the pre-commands failed.
+	FailureInstallError FailureKind = "install_error"
+	// FailureNonzeroExit means the script exited with a non-zero code.
+	FailureNonzeroExit FailureKind = "nonzero_exit"
+)
+
+// RetryPolicy re-runs a failed execution under the same execution ID. The
+// result reports the last attempt, with the earlier ones in
+// ExecutionResult.Attempts.
+//
+// Example:
+//
+//	metadata.Retry = &client.RetryPolicy{
+//	    MaxRetries: 2,
+//	    RetryOn:    []client.FailureKind{client.FailureInfraError, client.FailureTimeout},
+//	}
+type RetryPolicy struct {
+	// MaxRetries is how many times the execution is re-run after its
+	// first attempt. The server caps it (PYEXEC_MAX_RETRIES).
+	MaxRetries int `json:"max_retries"`
+	// BackoffSeconds is the wait before the first retry (default: 1).
+	// Each later retry waits twice as long as the one before.
+	BackoffSeconds float64 `json:"backoff_seconds,omitempty"`
+	// MaxBackoffSeconds caps the wait between attempts (default: 60).
+	MaxBackoffSeconds float64 `json:"max_backoff_seconds,omitempty"`
+	// RetryOn lists the failures that are retried (default:
+	// FailureInfraError only).
+	RetryOn []FailureKind `json:"retry_on,omitempty"`
 }
 
+// Attempt summarizes an attempt of an execution that was retried.
+type Attempt struct {
+	// Attempt numbers the attempt, from 1 for the first run.
+	Attempt int `json:"attempt"`
+	// FailureKind is how the attempt failed.
+	FailureKind FailureKind `json:"failure_kind"`
+	// ExitCode is the script's exit code, if it ran.
+	ExitCode int `json:"exit_code"`
+	// Error is the attempt's error message, if any.
+	Error string `json:"error,omitempty"`
+	// ContainerID is the container the attempt ran in, if one was created.
+	ContainerID string `json:"container_id,omitempty"`
+	// StartedAt is when the attempt started (UTC).
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt is when the attempt finished (UTC).
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Execution modes for Metadata.Mode.
+const (
+	// ModePytest runs pytest on Entrypoint, or on the whole working
+	// directory if Entrypoint is empty, with ScriptArgs as extra pytest
+	// arguments. pytest must be installed in the image or through
+	// RequirementsTxt.
+	ModePytest = "pytest"
+)
+
 // ExecutionConfig holds resource limits and execution settings.
 //
 // Example:
@@ -64,16 +246,85 @@ type Metadata struct {
 //	    MemoryMB:        2048,
 //	}
 type ExecutionConfig struct {
-	// TimeoutSeconds is the maximum execution time (default: 300).
+	// TimeoutSeconds is the maximum execution time (default: 300). Pulling
+	// the image and installing dependencies have limits of their own.
 	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// InstallTimeoutSeconds is the maximum time installing requirements
+	// and running pre-commands may take (default: the server's
+	// PYEXEC_INSTALL_TIMEOUT).
+	InstallTimeoutSeconds int `json:"install_timeout_seconds,omitempty"`
 	// NetworkDisabled disables network access if true (default: true).
 	NetworkDisabled bool `json:"network_disabled,omitempty"`
+	// InstallNetworkOnly allows network access while requirements are
+	// installed, without the user's files, then removes it before
+	// pre-commands and user code run. It overrides NetworkDisabled.
+	InstallNetworkOnly bool `json:"install_network_only,omitempty"`
+	// FreezePackages runs pip freeze after dependency installation and
+	// returns the resolved package versions in InstallResult.Packages.
+	FreezePackages bool `json:"freeze_packages,omitempty"`
+	// CombinedOutput also returns stdout and stderr interleaved in the order
+	// they were written, in ExecutionResult.Output.
+	CombinedOutput bool `json:"combined_output,omitempty"`
+	// RecordTimestamps records when each stdout and stderr line is
+	// emitted, so that output can be read back with the times in front of
+	// its lines (with_timestamps). Without it there are no times to show.
+	RecordTimestamps bool `json:"record_timestamps,omitempty"`
+	// StripANSI removes ANSI escape sequences (colors, cursor movement)
+	// that libraries such as rich, tqdm and pip write, from the captured
+	// output. The server may enforce it for every execution.
+	StripANSI bool `json:"strip_ansi,omitempty"`
+	// CaptureImages selects a headless matplotlib backend that saves
+	// figures to /work/output on plt.show(), and returns the images under
+	// /work/output in ExecutionResult.Artifacts.
+	CaptureImages bool `json:"capture_images,omitempty"`
+	// CollectArtifacts keeps every file the script writes under OutputDir,
+	// up to 50MB in total, as artifacts listed in ExecutionResult.Artifacts
+	// with a URL to download them from (see [Client.DownloadArtifacts]).
+	// They are named by their path relative to /work, e.g.
+	// "output/results.csv". The directory is created before the script
+	// runs, and its path is in the PYEXEC_OUTPUT_DIR environment variable.
+	CollectArtifacts bool `json:"collect_artifacts,omitempty"`
+	// OutputDir is the directory CollectArtifacts collects, absolute or
+	// relative to /work (default: /work/output).
+	OutputDir string `json:"output_dir,omitempty"`
+	// Coverage runs the script (or pytest) under coverage.py and returns
+	// the coverage percentage in ExecutionResult.Coverage, with the XML and
+	// HTML reports in ExecutionResult.Artifacts. coverage must be installed
+	// in the image or through RequirementsTxt.
+	Coverage bool `json:"coverage,omitempty"`
+	// Deterministic makes runs reproducible: hash randomization is fixed
+	// with PYTHONHASHSEED, and the random and numpy generators are seeded
+	// with Seed before user code runs. Other sources of randomness, such
+	// as os.urandom and uuid.uuid4, are unaffected.
+	Deterministic bool `json:"deterministic,omitempty"`
+	// Seed is the seed Deterministic uses (default: 0).
+	Seed uint32 `json:"seed,omitempty"`
+	// FakeTime freezes the clock the script sees at this RFC 3339 time,
+	// e.g. "2024-01-01T00:00:00Z", using libfaketime. The image must have
+	// libfaketime installed where the server expects it
+	// (PYEXEC_FAKETIME_LIB). Monotonic clocks keep running, so sleeps and
+	// timeouts still work.
+	FakeTime string `json:"fake_time,omitempty"`
 	// MemoryMB is the memory limit in megabytes (default: 1024).
 	MemoryMB int `json:"memory_mb,omitempty"`
-	// DiskMB is the disk space limit in megabytes (default: 2048).
+	// DiskMB is the disk space limit in megabytes (default: 2048). An
+	// execution that writes more is stopped, with TerminationDiskLimit.
 	DiskMB int `json:"disk_mb,omitempty"`
 	// CPUShares is the CPU shares (relative weight, default: 1024).
 	CPUShares int `json:"cpu_shares,omitempty"`
+	// BlkioWeight is the execution's share of disk I/O relative to other
+	// containers, from 10 to 1000 (default: the server's, else Docker's
+	// 500). It needs the BFQ I/O scheduler on the host.
+	BlkioWeight uint16 `json:"blkio_weight,omitempty"`
+	// DiskReadBps and DiskWriteBps limit the execution's disk reads and
+	// writes, in bytes per second, on the devices the server is
+	// configured with (PYEXEC_BLKIO_DEVICES).
+	DiskReadBps  int64 `json:"disk_read_bps,omitempty"`
+	DiskWriteBps int64 `json:"disk_write_bps,omitempty"`
+	// BandwidthKbps limits the execution's HTTP(S) traffic, in kilobits
+	// per second, through the server's egress proxy. The server's limit
+	// (PYEXEC_EGRESS_KBPS) applies when zero, and caps it otherwise.
+	BandwidthKbps int `json:"bandwidth_kbps,omitempty"`
 }
 
 // ExecutionResult contains the output and status of an execution.
@@ -82,10 +333,26 @@ type ExecutionResult struct {
 	ExecutionID string `json:"execution_id"`
 	// Status is the current execution state.
 	Status ExecutionStatus `json:"status"`
+	// Phase is the stage a running execution is in. It is empty once the
+	// execution has finished, and with executors that do not report phases.
+	Phase ExecutionPhase `json:"phase,omitempty"`
+	// QueuePosition is a pending execution's place in the async queue, 1
+	// for the next to run. It is 0 once a worker has claimed it.
+	QueuePosition int `json:"queue_position,omitempty"`
+	// GroupID is the group the execution was submitted to, if any.
+	GroupID string `json:"group_id,omitempty"`
+	// Labels are the labels the execution was submitted with, if any.
+	Labels map[string]string `json:"labels,omitempty"`
+	// TraceID is the request ID of the submission, which the script sees
+	// as PYEXEC_TRACE_ID.
+	TraceID string `json:"trace_id,omitempty"`
 	// Stdout is the standard output from the Python script.
 	Stdout string `json:"stdout,omitempty"`
 	// Stderr is the standard error from the Python script.
 	Stderr string `json:"stderr,omitempty"`
+	// Output is stdout and stderr interleaved in the order they were
+	// written, when CombinedOutput was set.
+	Output string `json:"output,omitempty"`
 	// ExitCode is the process exit code (0 = success).
 	ExitCode int `json:"exit_code"`
 	// Error is an error message if the execution failed internally.
@@ -94,21 +361,529 @@ type ExecutionResult struct {
 	ErrorType string `json:"error_type,omitempty"`
 	// ErrorLine is the line number where the error occurred.
 	ErrorLine int `json:"error_line,omitempty"`
+	// Signal is the name of the signal that terminated the script, e.g.
+	// "SIGKILL", derived from exit codes above 128.
+	Signal string `json:"signal,omitempty"`
+	// TerminationReason says why the script was stopped, when known.
+	TerminationReason TerminationReason `json:"termination_reason,omitempty"`
+	// ApprovalReason names the approval rule the execution matched, if it
+	// was held for an admin's approval.
+	ApprovalReason string `json:"approval_reason,omitempty"`
+	// Traceback holds the frames of the exception that ended the script,
+	// outermost first.
+	Traceback []TracebackFrame `json:"traceback,omitempty"`
 	// StartedAt is when execution started (UTC).
 	StartedAt *time.Time `json:"started_at,omitempty"`
 	// FinishedAt is when execution finished (UTC).
 	FinishedAt *time.Time `json:"finished_at,omitempty"`
 	// DurationMs is the total execution time in milliseconds.
 	DurationMs int64 `json:"duration_ms,omitempty"`
+	// PausedAt is when the execution was paused or checkpointed, while it
+	// is suspended.
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	// PausedMs is how long the execution has spent suspended, in
+	// milliseconds, not counting a suspension still going on. DurationMs
+	// includes it; the timeout does not.
+	PausedMs int64 `json:"paused_ms,omitempty"`
+	// CheckpointedAt is when the execution was last checkpointed to disk.
+	CheckpointedAt *time.Time `json:"checkpointed_at,omitempty"`
+	// CPU is the CPU time the script used. Compare it with DurationMs to
+	// tell CPU-bound, throttled and I/O-bound runs apart.
+	CPU *CPUUsage `json:"cpu,omitempty"`
+	// Timings breaks the execution's time down by phase, to tell time spent
+	// by the service from time spent installing or running.
+	Timings *Timings `json:"timings,omitempty"`
 	// Result contains the value of the last expression when EvalLastExpr is true.
 	// The value is the repr() of the Python object, or null if the last
 	// statement was not an expression.
 	Result *string `json:"result,omitempty"`
+	// StructuredOutput is the JSON document the script wrote to
+	// /work/output/result.json, if any. It gives programs a channel for
+	// machine-readable results that is separate from what they print.
+	StructuredOutput json.RawMessage `json:"structured_output,omitempty"`
+	// StructuredOutputError explains why a result.json the script wrote
+	// was not returned, e.g. because it was larger than 1MB or not valid
+	// JSON.
+	StructuredOutputError string `json:"structured_output_error,omitempty"`
+	// Tests holds the parsed test results, when Mode was ModePytest and
+	// pytest wrote a report.
+	Tests *TestReport `json:"tests,omitempty"`
+	// Coverage summarizes line coverage, when Coverage was set and
+	// coverage.py wrote a report.
+	Coverage *CoverageReport `json:"coverage,omitempty"`
+	// Artifacts holds the files the execution was asked to collect: images
+	// the script wrote to /work/output when CaptureImages was set,
+	// coverage.xml and htmlcov.tar.gz when Coverage was set, and the files
+	// under OutputDir, downloaded by their URL, when CollectArtifacts was
+	// set. When Stdout, Stderr or Output was cut to the server's inline
+	// limit, the full log is listed here too as stdout.log, stderr.log or
+	// output.log.
+	// Pipeline steps list the files they wrote to /work/output as a tar
+	// archive, output.tar, downloaded by its URL.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// Progress is the latest progress reported by the running script.
+	Progress *Progress `json:"progress,omitempty"`
+	// Install reports the dependency installation stage, if there was one.
+	// Stdout, Stderr and ExitCode above always belong to the script itself.
+	Install *InstallResult `json:"install,omitempty"`
+	// Manifest records the environment the execution ran in.
+	Manifest *Manifest `json:"manifest,omitempty"`
+	// Attempts lists the failed attempts before this result's, oldest
+	// first, when the execution was retried under Metadata.Retry.
+	// StartedAt is when the first attempt started.
+	Attempts []Attempt `json:"attempts,omitempty"`
+}
+
+// OutputStream selects an execution's stdout or stderr.
+type OutputStream string
+
+// Output stream constants.
+const (
+	// StreamStdout is the script's standard output.
+	StreamStdout OutputStream = "stdout"
+	// StreamStderr is the script's standard error.
+	StreamStderr OutputStream = "stderr"
+)
+
+// OutputUnit is what the offsets and limits of [ReadOutputOptions] count.
+type OutputUnit string
+
+// Output unit constants.
+const (
+	// UnitBytes counts bytes. It is the default.
+	UnitBytes OutputUnit = "bytes"
+	// UnitLines counts lines, each ending in a newline except possibly the
+	// last.
+	UnitLines OutputUnit = "lines"
+)
+
+// ReadOutputOptions selects the part of a stream [Client.ReadOutput]
+// returns.
+type ReadOutputOptions struct {
+	// Offset is where to start, usually the NextOffset of the previous
+	// chunk.
+	Offset int64
+	// Limit is the most units to return. 0 means up to the end.
+	Limit int64
+	// Unit is what Offset and Limit count. Empty means bytes.
+	Unit OutputUnit
+	// WithTimestamps prefixes each line with the time it was emitted, if
+	// the execution recorded them (ExecutionConfig.RecordTimestamps).
+	// Offsets then count the prefixed text, so use the same setting for
+	// every chunk of a stream.
+	WithTimestamps bool
+}
+
+// OutputChunk is a part of an execution's stdout or stderr.
+type OutputChunk struct {
+	// Data is the text of the chunk. Byte chunks end on a character
+	// boundary where possible.
+	Data string
+	// NextOffset is the offset to read the following chunk from.
+	NextOffset int64
+	// Complete is true once the execution has finished and the chunk
+	// reaches the end of the stream, so no more output will follow.
+	Complete bool
+}
+
+// LogFrameType says what a [LogFrame] carries.
+type LogFrameType string
+
+// Log frame type constants.
+const (
+	// FrameOutput carries a piece of stdout or stderr.
+	FrameOutput LogFrameType = "output"
+	// FrameEnd is the last frame of a stream, sent once the execution has
+	// finished.
+	FrameEnd LogFrameType = "end"
+)
+
+// LogFrame is a message on an execution's log stream, as read by
+// [Client.StreamLogs].
+type LogFrame struct {
+	// Type is what the frame carries.
+	Type LogFrameType `json:"type"`
+	// Stream and Data are the stream and text of an output frame.
+	Stream OutputStream `json:"stream,omitempty"`
+	Data   string       `json:"data,omitempty"`
+	// Skipped is how many bytes of output were written before this frame
+	// but are no longer held by the server, because the client connected
+	// late to a chatty execution. The stored stdout and stderr keep them.
+	Skipped int64 `json:"skipped,omitempty"`
+	// Status, ExitCode and Error describe how the execution finished, on
+	// the end frame.
+	Status   ExecutionStatus `json:"status,omitempty"`
+	ExitCode int             `json:"exit_code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// GetExecutionOptions controls how [Client.GetExecutionWithOptions] renders
+// an execution.
+type GetExecutionOptions struct {
+	// WithTimestamps prefixes each stdout and stderr line with the time it
+	// was emitted (RFC 3339, UTC), like `docker logs --timestamps`, if the
+	// execution recorded them (ExecutionConfig.RecordTimestamps).
+	WithTimestamps bool
+	// Fields limits the response to the named JSON fields, e.g.
+	// "exit_code", "duration_ms". execution_id and status are always
+	// returned. Empty means all fields.
+	Fields []string
+}
+
+// Manifest records what an execution ran on, so it can be reproduced later.
+type Manifest struct {
+	// Image is the Docker image as requested, e.g. "python:3.12-slim".
+	Image string `json:"image"`
+	// ImageDigest is the image's repository digest, e.g.
+	// "python@sha256:...". Use it in place of Image to pin the exact image.
+	// Empty for images that were built locally.
+	ImageDigest string `json:"image_digest,omitempty"`
+	// ImageID is the image's content-addressable ID.
+	ImageID string `json:"image_id,omitempty"`
+	// PythonVersion is the image's Python version, taken from its
+	// PYTHON_VERSION environment variable. Empty if the image doesn't set it.
+	PythonVersion string `json:"python_version,omitempty"`
+	// Platform is the image's OS and architecture, e.g. "linux/amd64".
+	Platform string `json:"platform,omitempty"`
+	// Config is the effective configuration after server defaults.
+	Config *ExecutionConfig `json:"config,omitempty"`
+}
+
+// CPUUsage is the CPU time used by an execution's container, from its
+// cgroup counters.
+type CPUUsage struct {
+	// UserMs is CPU time spent in user mode, in milliseconds.
+	UserMs int64 `json:"user_ms"`
+	// SystemMs is CPU time spent in the kernel, in milliseconds.
+	SystemMs int64 `json:"system_ms"`
+	// ThrottledMs is how long the container was held back by its CPU
+	// limit, in milliseconds.
+	ThrottledMs int64 `json:"throttled_ms"`
+}
+
+// Timings is how long each phase of an execution took, in milliseconds.
+// A phase that was skipped, such as the pull of an image that was already
+// present, takes 0.
+type Timings struct {
+	// QueueMs is how long an async execution waited for a free worker.
+	QueueMs int64 `json:"queue_ms"`
+	// PullMs is how long it took to check for and pull the Docker image.
+	PullMs int64 `json:"pull_ms"`
+	// InstallMs is how long the dependency installation stage took.
+	InstallMs int64 `json:"install_ms"`
+	// RunMs is how long the script itself ran, from container start to
+	// exit.
+	RunMs int64 `json:"run_ms"`
+}
+
+// TracebackFrame is one frame of a Python traceback.
+type TracebackFrame struct {
+	// File is the source file, e.g. "/work/main.py" or "<string>".
+	File string `json:"file"`
+	// Line is the line number within File.
+	Line int `json:"line"`
+	// Function is the function name, or "<module>" for top-level code.
+	// Empty for syntax errors.
+	Function string `json:"function,omitempty"`
+	// Code is the source line, if Python printed it.
+	Code string `json:"code,omitempty"`
+}
+
+// TestReport summarizes a pytest run.
+type TestReport struct {
+	// Total is the number of test cases collected.
+	Total int `json:"total"`
+	// Passed, Failed, Errors and Skipped count the cases by outcome.
+	// Errors are failures outside the test body, e.g. in a fixture.
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+	// DurationMs is the time pytest reported for the run in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// Cases lists every test case in the order pytest ran them.
+	Cases []TestCase `json:"cases,omitempty"`
+}
+
+// TestStatus is the outcome of a test case.
+type TestStatus string
+
+// Test case outcomes.
+const (
+	TestPassed  TestStatus = "passed"
+	TestFailed  TestStatus = "failed"
+	TestError   TestStatus = "error"
+	TestSkipped TestStatus = "skipped"
+)
+
+// TestCase is one test case of a pytest run.
+type TestCase struct {
+	// Name is the test function name, including parameters,
+	// e.g. "test_add[1-2]".
+	Name string `json:"name"`
+	// ClassName is the dotted module and class path, e.g.
+	// "tests.test_math.TestAdd".
+	ClassName string `json:"classname,omitempty"`
+	// Status is the outcome.
+	Status TestStatus `json:"status"`
+	// DurationMs is how long the test took in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// Message is the short failure, error or skip reason.
+	Message string `json:"message,omitempty"`
+	// Details is the full failure or error output, e.g. the assertion
+	// traceback.
+	Details string `json:"details,omitempty"`
+}
+
+// CoverageReport summarizes the line coverage measured by coverage.py.
+type CoverageReport struct {
+	// Percent is the share of lines executed, from 0 to 100.
+	Percent float64 `json:"percent"`
+	// LinesCovered is the number of lines executed.
+	LinesCovered int `json:"lines_covered"`
+	// LinesValid is the number of executable lines measured.
+	LinesValid int `json:"lines_valid"`
+}
+
+// Artifact is a file produced by an execution.
+type Artifact struct {
+	// Name is the file's name, e.g. "figure_1.png". Images keep their path
+	// relative to /work/output.
+	Name string `json:"name"`
+	// ContentType is the file's MIME type, e.g. "image/png".
+	ContentType string `json:"content_type"`
+	// Size is the file size in bytes.
+	Size int64 `json:"size"`
+	// Data is the file contents, base64-encoded in JSON. Empty for
+	// artifacts with a URL.
+	Data []byte `json:"data,omitempty"`
+	// URL is the path to download the artifact from, relative to the
+	// server, for artifacts too large to return inline such as spilled
+	// logs. Use [Client.GetArtifact] to fetch them.
+	URL string `json:"url,omitempty"`
+}
+
+// ArtifactList lists an execution's artifacts, without their contents.
+type ArtifactList struct {
+	// Artifacts are the execution's artifacts, each with the URL to
+	// download it from.
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// InstallResult is the outcome of the dependency installation stage, which
+// runs pre_commands and pip install in a container of its own.
+type InstallResult struct {
+	// Stdout is the standard output of the install commands.
+	Stdout string `json:"stdout,omitempty"`
+	// Stderr is the standard error of the install commands.
+	Stderr string `json:"stderr,omitempty"`
+	// ExitCode is the exit code of the install commands (0 = success).
+	ExitCode int `json:"exit_code"`
+	// DurationMs is how long installation took in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// Packages lists the installed packages in requirements format
+	// ("name==version"), when FreezePackages was set.
+	Packages []string `json:"packages,omitempty"`
+	// Detected lists the packages added to the requirements because the
+	// code imports them, when imports were detected (see AutoInstall).
+	Detected []string `json:"detected,omitempty"`
+}
+
+// Progress is self-reported progress of a running execution.
+type Progress struct {
+	// Percent is the completion percentage (0-100), if reported.
+	Percent *float64 `json:"percent,omitempty"`
+	// Message is a free-form status message.
+	Message string `json:"message,omitempty"`
+	// UpdatedAt is when progress or a heartbeat was last received (UTC).
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProgressUpdate is sent by a running script to report progress.
+//
+// An empty update acts as a heartbeat and only refreshes UpdatedAt.
+type ProgressUpdate struct {
+	// Percent is the completion percentage (0-100).
+	Percent *float64 `json:"percent,omitempty"`
+	// Message is a free-form status message.
+	Message string `json:"message,omitempty"`
 }
 
 // AsyncResponse is returned when submitting async execution.
 type AsyncResponse struct {
 	ExecutionID string `json:"execution_id"`
+	// QueuePosition is the execution's place in the queue when it was
+	// submitted, 1 for the next to run; 0 if a worker claimed it at once.
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// Upload is the state of a chunked archive upload.
+type Upload struct {
+	// UploadID identifies the upload in later requests and in
+	// Metadata.UploadID.
+	UploadID string `json:"upload_id"`
+	// Offset is how many bytes the server has received, where the next
+	// chunk must start.
+	Offset int64 `json:"offset"`
+	// Complete is true once the upload has been completed, after which it
+	// can be executed but not appended to.
+	Complete bool `json:"complete"`
+	// SHA256 is the hex SHA-256 digest of a completed upload.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Archive describes an archive in the server's cache.
+type Archive struct {
+	// SHA256 is the hex SHA-256 digest of the archive's bytes.
+	SHA256 string `json:"sha256"`
+	// Size is the archive's size in bytes.
+	Size int64 `json:"size"`
+}
+
+// InspectResult describes an archive without running it, as returned by
+// POST /api/v1/inspect.
+type InspectResult struct {
+	// Files lists the archive's files and links in order; directories are
+	// left out.
+	Files []InspectedFile `json:"files"`
+	// TotalSize is the sum of the files' sizes in bytes, uncompressed.
+	TotalSize int64 `json:"total_size"`
+	// Entrypoint is the script that would run: the one named in the
+	// metadata, or else the one detected. Empty if there is none, as in
+	// pytest mode.
+	Entrypoint string `json:"entrypoint,omitempty"`
+	// Requirements lists the third-party packages the code imports, or the
+	// dependencies a pyproject.toml or Pipfile declares, as auto_install
+	// would install them. Versions are not resolved.
+	Requirements []string `json:"requirements"`
+}
+
+// InspectedFile is one entry of an inspected archive.
+type InspectedFile struct {
+	Name string `json:"name"`
+	// Size is the file's size in bytes.
+	Size int64 `json:"size"`
+	// Mode is the file's octal permissions, e.g. "0644".
+	Mode string `json:"mode"`
+	// Link is the target of a symlink or hard link.
+	Link string `json:"link,omitempty"`
+}
+
+// ArchiveFile is one file of an archive the server assembles from files
+// it already holds.
+type ArchiveFile struct {
+	// Name is the file's path in the archive.
+	Name string `json:"name"`
+	// SHA256 is the hex SHA-256 digest of the file's contents.
+	SHA256 string `json:"sha256"`
+	// Mode is the file's octal permissions, e.g. "0755"; empty means 0644.
+	Mode string `json:"mode,omitempty"`
+}
+
+// CreateArchiveRequest asks the server to assemble and cache an archive
+// from files uploaded earlier.
+type CreateArchiveRequest struct {
+	Files []ArchiveFile `json:"files"`
+}
+
+// MissingFilesRequest asks the server which files it doesn't hold.
+type MissingFilesRequest struct {
+	// SHA256 lists the hex SHA-256 digests of the files' contents.
+	SHA256 []string `json:"sha256"`
+}
+
+// MissingFilesResponse lists the files the server needs uploaded.
+type MissingFilesResponse struct {
+	// Missing lists the digests from the request the server doesn't hold.
+	Missing []string `json:"missing"`
+}
+
+// CompleteUploadRequest is the optional body of a request completing an
+// upload.
+type CompleteUploadRequest struct {
+	// SHA256 is the hex SHA-256 digest of the whole archive. If set, the
+	// upload is only completed if the server received exactly that.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// CreateSessionRequest starts a persistent session: a container running one
+// Python interpreter, in which variables and imports persist from one
+// [SessionEvalRequest] to the next.
+type CreateSessionRequest struct {
+	// Files are written to /work, the session's working directory, where
+	// evaluated code can open or import them.
+	Files []CodeFile `json:"files,omitempty"`
+	// PythonVersion selects the image as for [SimpleExecRequest]. Empty
+	// uses DockerImage, or else the server default.
+	PythonVersion string `json:"python_version,omitempty"`
+	// DockerImage is the Docker image to use.
+	DockerImage string `json:"docker_image,omitempty"`
+	// RequirementsTxt is installed with pip before the interpreter starts.
+	RequirementsTxt string `json:"requirements_txt,omitempty"`
+	// PreCommands are shell commands run before the interpreter starts.
+	PreCommands []string `json:"pre_commands,omitempty"`
+	// EnvVars are environment variables in "KEY=value" format.
+	EnvVars []string `json:"env_vars,omitempty"`
+	// Config sets the container's limits and network access.
+	// TimeoutSeconds is the default timeout of each eval.
+	Config *ExecutionConfig `json:"config,omitempty"`
+	// IdleTimeoutSeconds closes the session after this long without an
+	// eval. Zero uses the server default, and the server may cap it.
+	IdleTimeoutSeconds int `json:"idle_timeout_seconds,omitempty"`
+}
+
+// Session describes a persistent session.
+type Session struct {
+	// ID identifies the session in /sessions/{id} requests.
+	ID string `json:"session_id"`
+	// DockerImage is the image the session runs in.
+	DockerImage string `json:"docker_image"`
+	// CreatedAt is when the session started (UTC).
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsedAt is when the session last ran code, or started (UTC).
+	LastUsedAt time.Time `json:"last_used_at"`
+	// ExpiresAt is when the session is closed unless it runs code first,
+	// nil if it has no idle timeout.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// IdleTimeoutSeconds is how long the session is kept without an eval,
+	// zero if it is kept until closed.
+	IdleTimeoutSeconds int `json:"idle_timeout_seconds"`
+	// Evals counts the code blocks the session has run.
+	Evals int `json:"evals"`
+	// Install reports the dependency installation stage, if there was one.
+	Install *InstallResult `json:"install,omitempty"`
+}
+
+// SessionEvalRequest runs code in a session.
+type SessionEvalRequest struct {
+	// Code is run in the session's namespace. If its last statement is an
+	// expression, the repr() of its value is returned in Result.
+	Code string `json:"code"`
+	// TimeoutSeconds interrupts the code after this long. Zero uses the
+	// session's Config.TimeoutSeconds.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// SessionEvalResult is the outcome of running code in a session.
+type SessionEvalResult struct {
+	// Stdout is what the code printed to sys.stdout.
+	Stdout string `json:"stdout,omitempty"`
+	// Stderr is what the code printed to sys.stderr, with the traceback
+	// if it raised.
+	Stderr string `json:"stderr,omitempty"`
+	// Result is the repr() of the trailing expression's value, or null if
+	// the code did not end in an expression or its value was None.
+	Result *string `json:"result,omitempty"`
+	// Error is the exception the code raised, e.g. "NameError: name 'x'
+	// is not defined". The session stays usable.
+	Error string `json:"error,omitempty"`
+	// ErrorType is the Python exception type, e.g. "NameError".
+	ErrorType string `json:"error_type,omitempty"`
+	// TerminationReason is TerminationTimeout when the code was
+	// interrupted for running past its timeout.
+	TerminationReason TerminationReason `json:"termination_reason,omitempty"`
+	// DurationMs is how long the eval took in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
 }
 
 // KillResponse is returned when killing an execution.
@@ -149,10 +924,497 @@ type SimpleExecRequest struct {
 	// These are merged with auto-detected packages (user-provided takes precedence).
 	// Set to "-" to disable auto-detection entirely for this request.
 	RequirementsTxt string `json:"requirements_txt,omitempty"`
+
+	// Packages lists packages to install, one requirement specifier each,
+	// e.g. "numpy" or "requests==2.31". They are added to RequirementsTxt,
+	// whose entries take precedence for the same package.
+	Packages []string `json:"packages,omitempty"`
+
+	// AutoInstall turns detection of third-party imports on or off for
+	// this request. Detected packages are pip installed, and the result's
+	// Install lists them in Detected and their installed versions in
+	// Packages. Nil uses the server default (PYEXEC_AUTO_DETECT_IMPORTS).
+	AutoInstall *bool `json:"auto_install,omitempty"`
+
+	// Retry re-runs the code when an attempt fails in one of the ways it
+	// lists, as for Metadata.Retry
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// GroupID adds the execution to a group, as for Metadata.GroupID
+	GroupID string `json:"group_id,omitempty"`
+
+	// Labels label the execution, as for Metadata.Labels
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Secrets passes server-side secrets to the code, as for
+	// Metadata.Secrets
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Placement restricts where the code runs, as for Metadata.Placement
+	Placement map[string]string `json:"placement,omitempty"`
+
+	// Preset selects one of the server's resource presets, as for
+	// Metadata.Preset. PythonVersion takes precedence over its image.
+	Preset string `json:"preset,omitempty"`
 }
 
+// EncodingBase64 marks a CodeFile whose Content is base64-encoded binary data
+const EncodingBase64 = "base64"
+
 // CodeFile represents a single file with its content
 type CodeFile struct {
-	Name    string `json:"name"`    // filename (e.g., "main.py")
-	Content string `json:"content"` // file content
+	Name     string `json:"name"`               // filename (e.g., "main.py")
+	Content  string `json:"content"`            // file content
+	Encoding string `json:"encoding,omitempty"` // "base64" for binary content; empty means UTF-8 text
+	Mode     string `json:"mode,omitempty"`     // octal permissions, e.g. "0755" for a script; empty means 0644
+}
+
+// Preset is a named bundle of resources defined by the server's operator,
+// which executions select with Metadata.Preset. Zero fields leave the
+// server defaults in place.
+type Preset struct {
+	// Name selects the preset, e.g. "small" or "gpu-large".
+	Name string `json:"name"`
+	// DockerImage is the image executions run in.
+	DockerImage string `json:"docker_image,omitempty"`
+	// MemoryMB is the memory limit in megabytes.
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// CPUShares is the CPU shares (relative weight).
+	CPUShares int `json:"cpu_shares,omitempty"`
+	// DiskMB is the disk space limit in megabytes.
+	DiskMB int `json:"disk_mb,omitempty"`
+	// TimeoutSeconds is the maximum execution time.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// PresetList is the response from GET /presets.
+type PresetList struct {
+	Presets []Preset `json:"presets"`
+}
+
+// SecretList is the response from GET /secrets: the names of the secrets
+// registered on the server. Values are never returned.
+type SecretList struct {
+	Secrets []string `json:"secrets"`
+}
+
+// Template is a script stored on the server under a name, so callers can
+// run it by name with parameters instead of uploading its code each time.
+// Besides its name, description and parameters it takes the fields of a
+// [SimpleExecRequest], which each run uses.
+type Template struct {
+	// Name identifies the template: up to 64 letters, digits, '.', '_' and
+	// '-'.
+	Name string `json:"name"`
+	// Description says what the template does, for the people and agents
+	// choosing one.
+	Description string `json:"description,omitempty"`
+	// Params are the parameters the template takes. Each {{name}} in its
+	// code, text files and stdin is replaced with the parameter's value,
+	// as is.
+	Params []TemplateParam `json:"params,omitempty"`
+	// UpdatedAt is when the template was last stored (UTC).
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SimpleExecRequest
+}
+
+// TemplateParam is a parameter of a [Template].
+type TemplateParam struct {
+	// Name is the parameter's name: a letter or underscore, then letters,
+	// digits and underscores.
+	Name string `json:"name"`
+	// Description says what the parameter is for.
+	Description string `json:"description,omitempty"`
+	// Default is the value of the parameter when a run doesn't give one.
+	Default string `json:"default,omitempty"`
+	// Required parameters must be given by every run.
+	Required bool `json:"required,omitempty"`
+}
+
+// TemplateList is the response from GET /templates. The templates' code,
+// files and stdin are left out; fetch a template by name for those.
+type TemplateList struct {
+	Templates []Template `json:"templates"`
+}
+
+// TemplateRunRequest runs a template, or renders it without running it.
+type TemplateRunRequest struct {
+	// Params are the values of the template's parameters, by name.
+	Params map[string]string `json:"params,omitempty"`
+	// Async queues the execution and returns its ID at once, as
+	// /exec/async does, rather than waiting for its result.
+	Async bool `json:"async,omitempty"`
+	// GroupID adds the execution to a group, in place of the template's.
+	GroupID string `json:"group_id,omitempty"`
+}
+
+// PipelineRequest runs executions as the steps of a pipeline: each step
+// starts once the steps it depends on have completed successfully, with
+// the files they wrote to /work/output copied into its own /work.
+type PipelineRequest struct {
+	// Steps are the pipeline's executions. Steps without dependencies
+	// start at once, and independent steps run in parallel.
+	Steps []PipelineStep `json:"steps"`
+}
+
+// PipelineStep is one execution of a pipeline. Besides Name and DependsOn
+// it takes the fields of a [SimpleExecRequest].
+type PipelineStep struct {
+	// Name identifies the step to the steps that depend on it, and names
+	// the directory its outputs are copied to in theirs:
+	// /work/inputs/{name}.
+	Name string `json:"name"`
+	// DependsOn lists the steps that must complete with exit code 0
+	// before this one runs. If one doesn't, this step is cancelled.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	SimpleExecRequest
+}
+
+// Pipeline describes a pipeline and the state of its steps.
+type Pipeline struct {
+	// ID identifies the pipeline in /pipelines/{id} requests.
+	ID string `json:"pipeline_id"`
+	// Status is running until every step has finished. It is then
+	// completed if every step completed with exit code 0, killed if the
+	// pipeline was cancelled, and failed otherwise.
+	Status ExecutionStatus `json:"status"`
+	// Steps are the pipeline's steps, in the order they were submitted.
+	Steps []PipelineStepStatus `json:"steps"`
+	// CreatedAt is when the pipeline was submitted (UTC).
+	CreatedAt time.Time `json:"created_at"`
+	// FinishedAt is when the last step finished (UTC), nil while running.
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// PipelineStepStatus is the state of one step of a pipeline.
+type PipelineStepStatus struct {
+	// Name is the step's name.
+	Name string `json:"name"`
+	// DependsOn lists the steps this one waits for.
+	DependsOn []string `json:"depends_on,omitempty"`
+	// ExecutionID is the step's execution, whose full result, and outputs
+	// as the output.tar artifact, are fetched from /executions/{id}. It is
+	// empty until the step starts.
+	ExecutionID string `json:"execution_id,omitempty"`
+	// Status is the execution's status: pending until the step starts,
+	// and cancelled if it never ran because a dependency failed or the
+	// pipeline was cancelled.
+	Status ExecutionStatus `json:"status"`
+	// ExitCode is the script's exit code once the step has completed.
+	ExitCode int `json:"exit_code"`
+	// Error is why the step failed or was cancelled.
+	Error string `json:"error,omitempty"`
+}
+
+// Group describes the executions submitted with one GroupID.
+type Group struct {
+	// ID is the group's ID.
+	ID string `json:"group_id"`
+	// Status is pending while every execution is pending and running
+	// while any is pending or running. Once all have finished it is
+	// killed if any was killed or cancelled, failed if any failed or
+	// exited non-zero, and completed otherwise.
+	Status ExecutionStatus `json:"status"`
+	// Total is the number of executions in the group.
+	Total int `json:"total"`
+	// Counts holds the number of executions in each status.
+	Counts map[ExecutionStatus]int `json:"counts"`
+	// Executions are the group's results, oldest first.
+	Executions []ExecutionResult `json:"executions"`
+}
+
+// ExecutionList is a page of stored executions, newest first, as returned
+// by [Client.ListExecutions].
+type ExecutionList struct {
+	// Executions are the page's results, newest first.
+	Executions []ExecutionResult `json:"executions"`
+	// NextCursor fetches the following page when passed as
+	// ListExecutionsOptions.Cursor. Empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListExecutionsOptions selects the executions [Client.ListExecutions]
+// returns. Zero fields match every execution.
+type ListExecutionsOptions struct {
+	// Statuses matches executions in any of the statuses.
+	Statuses []ExecutionStatus
+	// Labels matches executions with every one of the labels.
+	Labels map[string]string
+	// Since and Until bound when executions were created: Since
+	// inclusive, Until exclusive.
+	Since time.Time
+	Until time.Time
+	// Text matches executions whose entrypoint or error contains it,
+	// ignoring case.
+	Text string
+	// Limit is the most executions to return, up to 1000. 0 means the
+	// server's default of 50.
+	Limit int
+	// Cursor is the NextCursor of the previous page, or empty for the
+	// first.
+	Cursor string
+	// Fields limits each execution to the named JSON fields, as for
+	// GetExecutionOptions.Fields.
+	Fields []string
+	// IncludeOutput returns each execution's Stdout, Stderr and Output,
+	// which are left out otherwise unless Fields names them.
+	IncludeOutput bool
+}
+
+// Sweep is a matrix of parameter sets to run one archive with, sent to
+// /sweeps with the archive and metadata. One execution is created for
+// every combination of Env values and Args list.
+type Sweep struct {
+	// Env maps environment variables to the values they take. Each value
+	// replaces any setting of the variable in Metadata.EnvVars.
+	Env map[string][]string `json:"env,omitempty"`
+	// Args are alternative lists of script arguments, each appended to
+	// Metadata.ScriptArgs.
+	Args [][]string `json:"args,omitempty"`
+}
+
+// SweepResponse is returned when a sweep is submitted.
+type SweepResponse struct {
+	// GroupID is the group holding the sweep's executions: the metadata's
+	// GroupID if it had one, or one chosen by the server. Follow it with
+	// GET /groups/{id}.
+	GroupID string `json:"group_id"`
+	// Executions lists the executions created, with the parameters each
+	// one runs with.
+	Executions []SweepExecution `json:"executions"`
+}
+
+// SweepExecution is one combination of a sweep.
+type SweepExecution struct {
+	// ExecutionID is the execution running this combination.
+	ExecutionID string `json:"execution_id"`
+	// Env holds the swept environment variables' values.
+	Env map[string]string `json:"env,omitempty"`
+	// Args are the script arguments appended for this combination.
+	Args []string `json:"args,omitempty"`
+}
+
+// Tool describes the /eval endpoint as a tool for LLM function calling,
+// in OpenAI's tools format. Pass it to a model as one of its tools and
+// send the arguments of each call, as they are, to /eval.
+type Tool struct {
+	// Type is always "function".
+	Type string `json:"type"`
+	// Function names and describes the tool and its arguments.
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction is the function a [Tool] offers.
+type ToolFunction struct {
+	// Name is the function's name, "execute_python" unless another was
+	// asked for.
+	Name string `json:"name"`
+	// Description tells the model what the function does.
+	Description string `json:"description"`
+	// Parameters is the JSON Schema of the function's arguments, a subset
+	// of [SimpleExecRequest].
+	Parameters map[string]any `json:"parameters"`
+}
+
+// EventType names an execution lifecycle event.
+type EventType string
+
+// Execution event types.
+const (
+	// EventSubmitted is published when an execution is created.
+	EventSubmitted EventType = "submitted"
+	// EventStarted is published when an execution starts running.
+	EventStarted EventType = "started"
+	// EventCompleted is published when an execution reaches a terminal
+	// status, whichever it is, with a summary of its result.
+	EventCompleted EventType = "completed"
+)
+
+// ExecutionEvent is an execution lifecycle event, as published to the
+// NATS subject or Kafka topic the server is configured with.
+type ExecutionEvent struct {
+	// Type is what happened.
+	Type EventType `json:"type"`
+	// ExecutionID is the execution it happened to.
+	ExecutionID string `json:"execution_id"`
+	// GroupID is the execution's group, if any.
+	GroupID string `json:"group_id,omitempty"`
+	// Node is the server instance that published the event.
+	Node string `json:"node,omitempty"`
+	// Time is when it happened.
+	Time time.Time `json:"time"`
+	// Status is the execution's status after the event.
+	Status ExecutionStatus `json:"status"`
+	// Summary describes the result; only completed events have one.
+	Summary *EventSummary `json:"summary,omitempty"`
+}
+
+// EventSummary sums up a finished execution in a completed event. Fetch
+// the execution for its output.
+type EventSummary struct {
+	// ExitCode is the script's exit code.
+	ExitCode int `json:"exit_code"`
+	// DurationMs is the execution time in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// Error is the internal error, if the execution failed.
+	Error string `json:"error,omitempty"`
+	// ErrorType is the Python exception type, if the script raised one.
+	ErrorType string `json:"error_type,omitempty"`
+	// TerminationReason is why the script was stopped, if it was.
+	TerminationReason TerminationReason `json:"termination_reason,omitempty"`
+	// Attempts is the number of attempts run, when the execution was
+	// retried.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// Usage is the resources a tenant's executions consumed in one period.
+type Usage struct {
+	// Tenant is who submitted the executions.
+	Tenant string `json:"tenant"`
+	// Period is a UTC day ("2006-01-02") or month ("2006-01").
+	Period string `json:"period"`
+	// Executions is the number of executions that ran.
+	Executions int64 `json:"executions"`
+	// Failures is the number of them that did not complete with exit
+	// code 0.
+	Failures int64 `json:"failures"`
+	// DurationMs is their total execution time in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// CPUSeconds is the CPU time they used.
+	CPUSeconds float64 `json:"cpu_seconds"`
+	// MemoryMBSeconds is their memory limit in megabytes multiplied by
+	// their execution time in seconds: the memory they reserved.
+	MemoryMBSeconds float64 `json:"memory_mb_seconds"`
+}
+
+// UsageReport is the usage of one tenant, or every tenant, in a period.
+type UsageReport struct {
+	// Period is the UTC day ("2006-01-02") or month ("2006-01") reported.
+	Period string `json:"period"`
+	// Tenants holds each tenant's usage, by tenant name. A report for one
+	// tenant holds just that tenant, even if it has no usage.
+	Tenants []Usage `json:"tenants"`
+	// Total is the sum of the tenants' usage.
+	Total Usage `json:"total"`
+}
+
+// ServerStatus describes a server instance's state and load, from
+// /admin/status.
+type ServerStatus struct {
+	// Node is the instance's ID.
+	Node string `json:"node"`
+	// Labels are the instance's labels, which executions' placement
+	// constraints are matched against.
+	Labels map[string]string `json:"labels,omitempty"`
+	// MemoryMB is the largest memory limit the instance runs executions
+	// with; 0 means no limit.
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// Draining is true once the instance has stopped accepting executions
+	// to shut down.
+	Draining bool `json:"draining"`
+	// InFlight is the number of executions and requests the instance is
+	// handling, which shutdown waits for.
+	InFlight int `json:"in_flight"`
+	// Load describes how busy the instance is.
+	Load LoadStatus `json:"load"`
+	// Storage describes the executions the instance stores.
+	Storage StorageStats `json:"storage"`
+}
+
+// LoadStatus describes how close a server instance is to its concurrency
+// limit, and what it does with submissions beyond it.
+type LoadStatus struct {
+	// Running is the number of executions running on the instance.
+	Running int64 `json:"running"`
+	// MaxConcurrent is the most executions the instance runs at once; 0
+	// means no limit.
+	MaxConcurrent int `json:"max_concurrent"`
+	// Saturation is Running divided by MaxConcurrent; 0 without a limit.
+	Saturation float64 `json:"saturation"`
+	// OverloadPolicy is "queue" or "reject": what happens to submissions
+	// while every slot is taken.
+	OverloadPolicy string `json:"overload_policy"`
+	// Waiting is the number of sync requests waiting for a slot.
+	Waiting int64 `json:"waiting"`
+	// MaxWaiting is the most sync requests that may wait; 0 means no
+	// limit.
+	MaxWaiting int `json:"max_waiting"`
+	// Queued is the number of async executions waiting for a worker, on
+	// any instance sharing the queue.
+	Queued int `json:"queued"`
+	// MaxQueueLength is the most async executions that may be queued; 0
+	// means no limit.
+	MaxQueueLength int `json:"max_queue_length"`
+	// QueueError is why Queued could not be read, if it could not.
+	QueueError string `json:"queue_error,omitempty"`
+	// Rejected is the number of submissions rejected with 429 since the
+	// instance started.
+	Rejected int64 `json:"rejected"`
+	// Throttled is the number of requests refused with 429 since the
+	// instance started because their caller was over its quota.
+	Throttled int64 `json:"throttled"`
+}
+
+// StorageStats describes the executions a server stores. Instances sharing
+// Consul storage report the same figures.
+type StorageStats struct {
+	// Executions is the number of stored executions.
+	Executions int `json:"executions"`
+	// ByStatus counts the stored executions in each status.
+	ByStatus map[ExecutionStatus]int `json:"by_status"`
+	// Oldest is when the oldest stored execution was created; unset
+	// without executions.
+	Oldest *time.Time `json:"oldest,omitempty"`
+	// Bytes is the size of the stored execution records.
+	Bytes int64 `json:"bytes"`
+	// Finished is the number of stored executions that started and have
+	// finished.
+	Finished int `json:"finished"`
+	// Failures is the number of them that did not complete with exit
+	// code 0.
+	Failures int `json:"failures"`
+	// DurationMs is their total execution time in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+	// Error is why the statistics could not be read, if they could not.
+	Error string `json:"error,omitempty"`
+}
+
+// RestoreResult counts what a restore took from a backup (see
+// [Client.Restore]).
+type RestoreResult struct {
+	// Executions is the number of executions restored.
+	Executions int `json:"executions"`
+	// Templates is the number of templates restored.
+	Templates int `json:"templates"`
+	// Skipped is the number of executions and templates left as they were
+	// because the server already had them.
+	Skipped int `json:"skipped"`
+}
+
+// Approval is an execution held by one of the server's approval rules until
+// an admin approves or rejects it.
+type Approval struct {
+	// ExecutionID identifies the held execution.
+	ExecutionID string `json:"execution_id"`
+	// Tenant submitted the execution.
+	Tenant string `json:"tenant"`
+	// Reason names the approval rule the execution matched.
+	Reason string `json:"reason"`
+	// Metadata is what the execution runs with, once approved.
+	Metadata *Metadata `json:"metadata"`
+	// CreatedAt is when the execution was submitted (UTC).
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ApprovalList is the response from GET /admin/approvals, oldest first.
+type ApprovalList struct {
+	Approvals []Approval `json:"approvals"`
+}
+
+// RejectRequest rejects an execution awaiting approval.
+type RejectRequest struct {
+	// Reason is added to the execution's error, for its submitter.
+	Reason string `json:"reason,omitempty"`
 }
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Defaults for [UploadOptions]
+const (
+	DefaultUploadChunkSize  = 8 << 20
+	DefaultUploadRetries    = 5
+	DefaultUploadRetryDelay = time.Second
+)
+
+// UploadOptions configures [Client.UploadArchive].
+type UploadOptions struct {
+	// UploadID resumes an earlier upload of the same archive instead of
+	// starting a new one.
+	UploadID string
+	// ChunkSize is the size of each PUT; 0 means DefaultUploadChunkSize.
+	ChunkSize int64
+	// Retries is how many times in a row a failed chunk is retried before
+	// giving up; 0 means DefaultUploadRetries and a negative value none.
+	Retries int
+	// RetryDelay is the pause before each retry; 0 means
+	// DefaultUploadRetryDelay.
+	RetryDelay time.Duration
+}
+
+// UploadArchive uploads a large archive in chunks and returns the ID of the
+// completed upload, to be run by setting [Metadata.UploadID] and passing a
+// nil tarData to [Client.ExecuteSync] or [Client.ExecuteAsync].
+//
+// A failed chunk is retried from wherever the server says the upload got
+// to, so a dropped connection only costs the chunk in flight. If
+// UploadArchive gives up, the error includes the upload ID, which can be
+// passed back in opts to resume later. The upload is checked against the
+// archive's SHA-256 before it is completed.
+//
+// Example:
+//
+//	f, _ := os.Open("project.tar.gz")
+//	defer f.Close()
+//	info, _ := f.Stat()
+//
+//	uploadID, err := c.UploadArchive(ctx, f, info.Size(), nil)
+//	if err != nil {
+//	    return err
+//	}
+//	result, err := c.ExecuteSync(ctx, nil, &client.Metadata{
+//	    Entrypoint: "main.py",
+//	    UploadID:   uploadID,
+//	})
+func (c *Client) UploadArchive(ctx context.Context, r io.ReaderAt, size int64, opts *UploadOptions) (string, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultUploadChunkSize
+	}
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultUploadRetries
+	}
+	delay := opts.RetryDelay
+	if delay <= 0 {
+		delay = DefaultUploadRetryDelay
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, 0, size)); err != nil {
+		return "", fmt.Errorf("hashing archive: %w", err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	var upload *Upload
+	var err error
+	if opts.UploadID != "" {
+		upload, err = c.GetUpload(ctx, opts.UploadID)
+	} else {
+		upload, err = c.CreateUpload(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	failures := 0
+	for !upload.Complete && upload.Offset < size {
+		n := min(chunkSize, size-upload.Offset)
+		next, err := c.UploadChunk(ctx, upload.UploadID, upload.Offset, io.NewSectionReader(r, upload.Offset, n))
+		if err == nil {
+			upload = next
+			failures = 0
+			continue
+		}
+
+		failures++
+		if retries < 0 || failures > retries || ctx.Err() != nil {
+			return "", fmt.Errorf("uploading %s at offset %d: %w", upload.UploadID, upload.Offset, err)
+		}
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("uploading %s: %w", upload.UploadID, ctx.Err())
+		case <-time.After(delay):
+		}
+
+		// Part of the chunk may have arrived, so ask where to resume
+		if current, err := c.GetUpload(ctx, upload.UploadID); err == nil {
+			upload = current
+		}
+	}
+
+	if upload.Offset > size {
+		return "", fmt.Errorf("upload %s has %d bytes, more than the %d byte archive", upload.UploadID, upload.Offset, size)
+	}
+	if _, err := c.CompleteUpload(ctx, upload.UploadID, sum); err != nil {
+		return "", err
+	}
+	return upload.UploadID, nil
+}
+
+// CreateUpload starts a chunked archive upload. Most callers want
+// [Client.UploadArchive], which drives the whole upload.
+func (c *Client) CreateUpload(ctx context.Context) (*Upload, error) {
+	return c.doUpload(ctx, "POST", "/api/v1/uploads", nil, "", http.StatusCreated)
+}
+
+// GetUpload returns the state of an upload, including the offset the next
+// chunk must start at.
+func (c *Client) GetUpload(ctx context.Context, uploadID string) (*Upload, error) {
+	return c.doUpload(ctx, "GET", "/api/v1/uploads/"+uploadID, nil, "", http.StatusOK)
+}
+
+// UploadChunk appends chunk to an upload. offset must be the number of
+// bytes the server already has; see [Client.GetUpload].
+func (c *Client) UploadChunk(ctx context.Context, uploadID string, offset int64, chunk io.Reader) (*Upload, error) {
+	path := fmt.Sprintf("/api/v1/uploads/%s?offset=%d", uploadID, offset)
+	return c.doUpload(ctx, "PUT", path, chunk, "application/octet-stream", http.StatusOK)
+}
+
+// CompleteUpload finishes an upload so it can be executed. If sha256 is not
+// empty the server only completes the upload if its contents match.
+func (c *Client) CompleteUpload(ctx context.Context, uploadID, sha256 string) (*Upload, error) {
+	reqBody, err := json.Marshal(CompleteUploadRequest{SHA256: sha256})
+	if err != nil {
+		return nil, err
+	}
+	return c.doUpload(ctx, "POST", "/api/v1/uploads/"+uploadID+"/complete", bytes.NewReader(reqBody), "application/json", http.StatusOK)
+}
+
+// DeleteUpload deletes an upload and the data sent for it.
+func (c *Client) DeleteUpload(ctx context.Context, uploadID string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", c.baseURL+"/api/v1/uploads/"+uploadID, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned %d: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// doUpload sends an upload request and decodes the upload state returned
+func (c *Client) doUpload(ctx context.Context, method, path string, body io.Reader, contentType string, wantStatus int) (*Upload, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.uploadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var upload Upload
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUploadServer implements the upload endpoints for one upload. The
+// first chunk PUT keeps only half the chunk and fails, like a connection
+// dropped partway.
+type fakeUploadServer struct {
+	mu       sync.Mutex
+	data     []byte
+	complete bool
+	failed   bool
+	puts     int
+}
+
+func (f *fakeUploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := func(status int) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Upload{UploadID: "upl_1", Offset: int64(len(f.data)), Complete: f.complete})
+	}
+
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/v1/uploads":
+		state(http.StatusCreated)
+	case r.Method == "GET" && r.URL.Path == "/api/v1/uploads/upl_1":
+		state(http.StatusOK)
+	case r.Method == "PUT" && r.URL.Path == "/api/v1/uploads/upl_1":
+		f.puts++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		if offset != len(f.data) {
+			state(http.StatusConflict)
+			return
+		}
+		chunk, _ := io.ReadAll(r.Body)
+		if !f.failed {
+			f.failed = true
+			f.data = append(f.data, chunk[:len(chunk)/2]...)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		f.data = append(f.data, chunk...)
+		state(http.StatusOK)
+	case r.Method == "POST" && r.URL.Path == "/api/v1/uploads/upl_1/complete":
+		var req CompleteUploadRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		sum := sha256.Sum256(f.data)
+		if req.SHA256 != hex.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		f.complete = true
+		state(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUploadArchive_ResumesAfterFailure(t *testing.T) {
+	fake := &fakeUploadServer{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	archive := []byte(strings.Repeat("0123456789", 10))
+	c := New(srv.URL)
+	id, err := c.UploadArchive(context.Background(), bytes.NewReader(archive), int64(len(archive)), &UploadOptions{
+		ChunkSize:  30,
+		RetryDelay: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("UploadArchive() error = %v", err)
+	}
+	if id != "upl_1" {
+		t.Errorf("UploadArchive() = %q, want upl_1", id)
+	}
+	if !fake.complete || !bytes.Equal(fake.data, archive) {
+		t.Errorf("server has %q (complete %v), want the archive", fake.data, fake.complete)
+	}
+	// The failed chunk kept 15 bytes, so three more finish from there
+	if fake.puts != 4 {
+		t.Errorf("server got %d chunks, want 4", fake.puts)
+	}
+}
+
+func TestUploadArchive_GivesUp(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Upload{UploadID: "upl_1"})
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).UploadArchive(context.Background(), strings.NewReader("data"), 4, &UploadOptions{Retries: -1})
+	if err == nil || !strings.Contains(err.Error(), "upl_1") {
+		t.Errorf("UploadArchive() error = %v, want one naming the upload", err)
+	}
+}
+
+func TestWriteMultipart_UploadID(t *testing.T) {
+	body, contentType, err := New("http://example.com").buildMultipartRequest(nil, &Metadata{Entrypoint: "main.py", UploadID: "upl_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	if strings.Contains(string(data), `name="tar"`) {
+		t.Error("multipart body has a tar part, want only metadata")
+	}
+	if !strings.Contains(string(data), `"upload_id":"upl_1"`) || !strings.HasPrefix(contentType, "multipart/form-data") {
+		t.Errorf("multipart body = %s", data)
+	}
+}
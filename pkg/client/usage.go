@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// GetUsage returns a tenant's usage in a period, or that of every tenant
+// with usage if tenant is empty. period is a UTC day ("2006-01-02") or
+// month ("2006-01"); empty means the current month.
+//
+// Example:
+//
+//	report, err := c.GetUsage(ctx, "", "2026-01")
+//	if err != nil {
+//	    return err
+//	}
+//	for _, u := range report.Tenants {
+//	    fmt.Printf("%s: %d executions, %.0f CPU-seconds\n", u.Tenant, u.Executions, u.CPUSeconds)
+//	}
+func (c *Client) GetUsage(ctx context.Context, tenant, period string) (*UsageReport, error) {
+	query := url.Values{}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	if period != "" {
+		query.Set("period", period)
+	}
+	endpoint := c.baseURL + "/api/v1/usage"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, respBody)
+	}
+
+	var report UsageReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
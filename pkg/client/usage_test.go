@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetUsage(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/usage" {
+			http.NotFound(w, r)
+			return
+		}
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("period") == "bad" {
+			http.Error(w, `{"error":"invalid period"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(UsageReport{
+			Period:  "2026-10",
+			Tenants: []Usage{{Tenant: "team-a", Period: "2026-10", Executions: 2, CPUSeconds: 1.5}},
+			Total:   Usage{Period: "2026-10", Executions: 2, CPUSeconds: 1.5},
+		})
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL)
+	report, err := c.GetUsage(context.Background(), "", "")
+	if err != nil || query != "" || len(report.Tenants) != 1 || report.Total.CPUSeconds != 1.5 {
+		t.Fatalf("GetUsage() = %+v, %v (query %q)", report, err, query)
+	}
+	if _, err := c.GetUsage(context.Background(), "team-a", "2026-10"); err != nil || query != "period=2026-10&tenant=team-a" {
+		t.Errorf("GetUsage(team-a, 2026-10): %v, query %q", err, query)
+	}
+	if _, err := c.GetUsage(context.Background(), "", "bad"); err == nil {
+		t.Error("GetUsage() = nil error for a 400")
+	}
+}
@@ -21,7 +21,7 @@ For API reference, see: https://github.com/geraldthewes/python-executor/blob/mai
 """
 
 from .client import PythonExecutorClient
-from .types import ExecutionResult, Metadata, ExecutionConfig, ExecutionStatus
+from .types import ExecutionResult, Metadata, ExecutionConfig, ExecutionStatus, Progress, InstallResult, TracebackFrame, Manifest, CPUUsage, Artifact, TestReport, TestCase, CoverageReport, OutputChunk, Timings, Upload, InspectResult, InspectedFile, Session, SessionEvalResult, RetryPolicy, Attempt, Pipeline, PipelineStepStatus, Group, ExecutionList, SweepResult, SweepExecution, Usage, UsageReport, ServerStatus, LoadStatus, StorageStats, Preset, Template, TemplateParam, Approval, RestoreResult
 
 __version__ = "1.0.0"
 
@@ -31,4 +31,38 @@ __all__ = [
     "Metadata",
     "ExecutionConfig",
     "ExecutionStatus",
+    "Progress",
+    "InstallResult",
+    "TracebackFrame",
+    "Manifest",
+    "CPUUsage",
+    "Artifact",
+    "TestReport",
+    "TestCase",
+    "CoverageReport",
+    "OutputChunk",
+    "Timings",
+    "Upload",
+    "InspectResult",
+    "InspectedFile",
+    "Session",
+    "SessionEvalResult",
+    "RetryPolicy",
+    "Attempt",
+    "Pipeline",
+    "PipelineStepStatus",
+    "Group",
+    "ExecutionList",
+    "SweepResult",
+    "SweepExecution",
+    "Usage",
+    "UsageReport",
+    "ServerStatus",
+    "LoadStatus",
+    "StorageStats",
+    "Preset",
+    "Template",
+    "TemplateParam",
+    "Approval",
+    "RestoreResult",
 ]
@@ -28,18 +28,27 @@ Example:
     ... )
 """
 
+import base64
+import dataclasses
+import hashlib
 import io
 import json
 import tarfile
 import time
+from datetime import datetime
 from pathlib import Path
-from typing import Optional, Union
+from typing import List, Optional, Union
 
 import requests
+from requests.adapters import DEFAULT_POOLSIZE, HTTPAdapter
 
-from .types import ExecutionResult, Metadata, ExecutionStatus
+from .types import Approval, Artifact, ExecutionConfig, ExecutionList, ExecutionResult, Group, InspectResult, Metadata, ExecutionStatus, OutputChunk, Pipeline, Preset, RestoreResult, RetryPolicy, ServerStatus, Session, SessionEvalResult, SweepResult, Template, TemplateParam, Upload, UsageReport
 
 
+# How much longer than an execution may run a sync call waits for its
+# result, for pulling the image, starting containers and sending it back
+_SYNC_MARGIN = 120
+
 class PythonExecutorClient:
     """Client for the python-executor remote code execution service.
 
@@ -64,20 +73,84 @@ class PythonExecutorClient:
         0
     """
 
-    def __init__(self, base_url: str, timeout: int = 300):
+    def __init__(
+        self,
+        base_url: str,
+        timeout: int = 300,
+        cache_archives: bool = False,
+        tenant: Optional[str] = None,
+        api_key: Optional[str] = None,
+        sync_timeout: Optional[float] = None,
+        upload_timeout: Optional[float] = None,
+        pool_size: Optional[int] = None,
+        pool_block: bool = False,
+        keep_alive: bool = True,
+    ):
         """Initialize the Python executor client.
 
         Args:
             base_url: Base URL of the python-executor server (e.g., "http://pyexec.cluster:9999/").
             timeout: HTTP request timeout in seconds. Default is 300 (5 minutes).
+            cache_archives: If True, execute_sync() and execute_async() ask the
+                server whether it already has the archive, by its SHA-256, and
+                run the cached copy instead of sending the archive again.
+            tenant: Tenant the server accounts this client's executions to, and
+                applies usage budgets to. Sent as the X-Tenant header; without it
+                executions are accounted to the "default" tenant. Servers with
+                API keys ignore it and use the key's tenant.
+            api_key: API key for servers that require one, sent as the
+                X-API-Key header. Reading needs any key; submitting needs the
+                run scope, killing the kill scope and administration the
+                admin scope.
+            sync_timeout: Timeout in seconds of the calls that wait for an
+                execution to finish: execute_sync(), eval(), run_template()
+                and eval_session(). 0 means no timeout, for scripts that run
+                as long as their own timeout allows. Default is timeout,
+                raised for executions whose timeout_seconds (plus
+                install_timeout_seconds) is longer to that plus two
+                minutes; a sync_timeout that is given is kept as is.
+            upload_timeout: Timeout in seconds of the calls that send an
+                archive or file without waiting for it to run:
+                execute_async(), submit_sweep(), inspect(), upload_file()
+                and upload_chunk(). 0 means no timeout. Default is timeout.
+            pool_size: Connections to the server kept open for reuse.
+                Default is requests' 10; raise it for clients making many
+                concurrent calls.
+            pool_block: If True, at most pool_size connections are open at
+                once and further calls wait for one.
+            keep_alive: If False, every call opens a new connection, e.g.
+                to spread calls across replicas behind a load balancer that
+                balances connections. HTTP/2 is not supported by requests.
 
         Example:
             >>> client = PythonExecutorClient("http://pyexec.cluster:9999/")
             >>> client = PythonExecutorClient("http://localhost:8080", timeout=60)
+            >>> # Status calls fail fast; sync executions may run for hours
+            >>> client = PythonExecutorClient("http://localhost:8080", timeout=30, sync_timeout=0)
         """
         self.base_url = base_url.rstrip("/")
         self.timeout = timeout
+        self.sync_timeout = _call_timeout(sync_timeout, timeout)
+        self._sync_timeout_set = sync_timeout is not None
+        self.upload_timeout = _call_timeout(upload_timeout, timeout)
+        self.cache_archives = cache_archives
         self.session = requests.Session()
+        if pool_size is not None or pool_block:
+            adapter = HTTPAdapter(
+                pool_connections=pool_size or DEFAULT_POOLSIZE,
+                pool_maxsize=pool_size or DEFAULT_POOLSIZE,
+                pool_block=pool_block,
+            )
+            self.session.mount("http://", adapter)
+            self.session.mount("https://", adapter)
+        if not keep_alive:
+            self.session.headers["Connection"] = "close"
+        if tenant:
+            self.session.headers["X-Tenant"] = tenant
+        if api_key:
+            self.session.headers["X-API-Key"] = api_key
+        # Absolute path -> (size, mtime_ns, sha256), for sync_directory()
+        self._file_hashes: dict[str, tuple[int, int, str]] = {}
 
     def execute_sync(
         self,
@@ -90,6 +163,8 @@ class PythonExecutorClient:
 
         This method submits code for execution and blocks until completion.
         Use this for short-running scripts where you need the result immediately.
+        If the server detaches executions that run past a threshold, the
+        execution is polled until it finishes.
 
         Args:
             files: Python files to execute. Can be:
@@ -98,6 +173,9 @@ class PythonExecutorClient:
                 - str: String path to a file or directory
             tar_data: Pre-built tar archive bytes (alternative to files).
                 If provided, files parameter is ignored.
+                Neither is needed when metadata, upload_id or
+                archive_sha256 names a completed upload or cached archive;
+                see upload_archive() and has_archive().
             metadata: Full Metadata object for advanced configuration.
                 If provided, kwargs are ignored.
             **kwargs: Shorthand for metadata fields:
@@ -106,6 +184,15 @@ class PythonExecutorClient:
                 - requirements_txt (str): Contents of requirements.txt
                 - pre_commands (list[str]): Shell commands to run before execution
                 - stdin (str): Data to provide on stdin
+                - eval_last_expr (bool): Return the last expression's value in result
+                - upload_id (str): Run a completed chunked upload
+                - archive_sha256 (str): Run an archive cached on the server
+                - group_id (str): Add the execution to a group (see get_group())
+                - labels (dict[str, str]): Labels to search the execution by
+                - secrets (list[str]): Server-side secrets to pass as env vars
+                  (see list_secrets())
+                - placement (dict[str, str]): Labels the server instance must have
+                - preset (str): Server resource preset (see list_presets())
                 - timeout_seconds (int): Execution timeout
                 - network_disabled (bool): Disable network access
                 - memory_mb (int): Memory limit in MB
@@ -146,19 +233,8 @@ class PythonExecutorClient:
         """
         tar_bytes, meta = self._prepare_request(files, tar_data, metadata, **kwargs)
 
-        files_data = {
-            "tar": ("code.tar", tar_bytes, "application/octet-stream"),
-            "metadata": (None, json.dumps(meta.to_dict()), "application/json"),
-        }
-
-        response = self.session.post(
-            f"{self.base_url}/api/v1/exec/sync",
-            files=files_data,
-            timeout=self.timeout,
-        )
-        response.raise_for_status()
-
-        return ExecutionResult.from_dict(response.json())
+        response = self._post_exec("exec/sync", tar_bytes, meta)
+        return self._sync_result(response)
 
     def execute_async(
         self,
@@ -199,25 +275,82 @@ class PythonExecutorClient:
         """
         tar_bytes, meta = self._prepare_request(files, tar_data, metadata, **kwargs)
 
-        files_data = {
-            "tar": ("code.tar", tar_bytes, "application/octet-stream"),
-            "metadata": (None, json.dumps(meta.to_dict()), "application/json"),
-        }
-
-        response = self.session.post(
-            f"{self.base_url}/api/v1/exec/async",
-            files=files_data,
-            timeout=self.timeout,
-        )
+        response = self._post_exec("exec/async", tar_bytes, meta)
         response.raise_for_status()
 
         return response.json()["execution_id"]
 
-    def get_execution(self, execution_id: str) -> ExecutionResult:
+    def submit_sweep(
+        self,
+        files: Optional[Union[dict[str, str], Path, str]] = None,
+        tar_data: Optional[bytes] = None,
+        metadata: Optional[Metadata] = None,
+        env: Optional[dict[str, list[str]]] = None,
+        args: Optional[list[list[str]]] = None,
+        **kwargs,
+    ) -> SweepResult:
+        """Run one archive once per combination of a parameter matrix.
+
+        The server queues an execution for every combination of env values
+        and args list and returns at once. The executions share a group:
+        metadata.group_id (or the group_id kwarg), or one chosen by the
+        server. Follow them with get_group().
+
+        Args:
+            files: Python files to execute. Same options as execute_sync().
+            tar_data: Pre-built tar archive bytes (alternative to files).
+            metadata: Full Metadata object for advanced configuration.
+            env: Maps environment variables to the values they take. Each
+                value replaces any setting of the variable in env_vars.
+            args: Alternative lists of script arguments, each appended to
+                script_args.
+            **kwargs: Shorthand for metadata fields. See execute_sync().
+
+        Returns:
+            SweepResult: The group ID and each execution's parameters.
+
+        Raises:
+            requests.HTTPError: If the server returns an error response.
+
+        Example:
+            >>> sweep = client.submit_sweep(
+            ...     files="train.py",
+            ...     env={"LR": ["0.1", "0.01"], "BATCH": ["32", "64"]},
+            ...     args=[["--seed", "1"], ["--seed", "2"]],
+            ... )
+            >>> group = client.get_group(sweep.group_id)
+        """
+        tar_bytes, meta = self._prepare_request(files, tar_data, metadata, **kwargs)
+
+        sweep: dict = {}
+        if env:
+            sweep["env"] = env
+        if args:
+            sweep["args"] = args
+        parts = {"sweep": (None, json.dumps(sweep), "application/json")}
+
+        response = self._post_exec("sweeps", tar_bytes, meta, parts)
+        response.raise_for_status()
+
+        return SweepResult.from_dict(response.json())
+
+    def get_execution(
+        self,
+        execution_id: str,
+        with_timestamps: bool = False,
+        fields: Optional[List[str]] = None,
+    ) -> ExecutionResult:
         """Get the current status and result of an execution.
 
         Args:
             execution_id: The execution ID returned by execute_async().
+            with_timestamps: Prefix each stdout/stderr line with the time
+                it was emitted (RFC 3339, UTC), if the execution was
+                submitted with config.record_timestamps.
+            fields: Only return these result fields, e.g.
+                ["exit_code", "duration_ms"]. execution_id and status are
+                always returned; other fields keep their defaults. None
+                returns everything.
 
         Returns:
             ExecutionResult: Current status and any available output.
@@ -232,18 +365,294 @@ class PythonExecutorClient:
             >>> print(result.status)
             running
         """
+        params = {}
+        if with_timestamps:
+            params["with_timestamps"] = "true"
+        if fields:
+            params["fields"] = ",".join(fields)
+
         response = self.session.get(
             f"{self.base_url}/api/v1/executions/{execution_id}",
+            params=params or None,
             timeout=self.timeout,
         )
         response.raise_for_status()
 
         return ExecutionResult.from_dict(response.json())
 
+    def list_executions(
+        self,
+        status: Optional[List[str]] = None,
+        labels: Optional[dict[str, str]] = None,
+        since: Optional[Union[datetime, str]] = None,
+        until: Optional[Union[datetime, str]] = None,
+        text: Optional[str] = None,
+        limit: Optional[int] = None,
+        cursor: Optional[str] = None,
+        fields: Optional[List[str]] = None,
+        include_output: bool = False,
+    ) -> ExecutionList:
+        """Return a page of the stored executions, newest first.
+
+        Only executions matching every filter given are returned.
+
+        Args:
+            status: Statuses to match, e.g. ["running", "pending"].
+            labels: Labels the executions must all have.
+            since: Only executions created at or after this time, a
+                timezone-aware datetime or an RFC 3339 string.
+            until: Only executions created before this time.
+            text: Text the entrypoint or error must contain, ignoring case.
+            limit: Most executions to return, up to 1000. The server's
+                default of 50 if omitted.
+            cursor: next_cursor of the previous page.
+            fields: Only return these result fields of each execution, as
+                for get_execution().
+            include_output: Return each execution's stdout, stderr and
+                output, which are left out otherwise unless fields names
+                them.
+
+        Example:
+            >>> page = client.list_executions(status=["failed"])
+            >>> while True:
+            ...     for r in page.executions:
+            ...         print(r.execution_id, r.error)
+            ...     if not page.next_cursor:
+            ...         break
+            ...     page = client.list_executions(status=["failed"], cursor=page.next_cursor)
+        """
+        params: dict = {}
+        if status:
+            params["status"] = ",".join(status)
+        if labels:
+            params["label"] = [f"{k}={v}" for k, v in labels.items()]
+        if since:
+            params["since"] = since.isoformat() if isinstance(since, datetime) else since
+        if until:
+            params["until"] = until.isoformat() if isinstance(until, datetime) else until
+        if text:
+            params["q"] = text
+        if limit:
+            params["limit"] = limit
+        if cursor:
+            params["cursor"] = cursor
+        if fields:
+            params["fields"] = ",".join(fields)
+        if include_output:
+            params["include"] = "output"
+
+        response = self.session.get(
+            f"{self.base_url}/api/v1/executions",
+            params=params or None,
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return ExecutionList.from_dict(response.json())
+
+    def get_output(self, execution_id: str, stream: str = "stdout", offset: int = 0) -> str:
+        """Download an execution's stdout or stderr as plain text.
+
+        Unlike get_execution(), this fetches a single stream and can start
+        at a byte offset, so large logs can be read incrementally.
+
+        Args:
+            execution_id: The execution ID.
+            stream: "stdout" or "stderr".
+            offset: Byte offset to start from (e.g. the number of bytes
+                already read).
+
+        Returns:
+            str: The output from offset onward ("" if there is nothing new).
+
+        Raises:
+            ValueError: If stream is not "stdout" or "stderr".
+            requests.HTTPError: If the execution is not found (404) or server error.
+
+        Example:
+            >>> log = client.get_output(exec_id)
+            >>> more = client.get_output(exec_id, offset=len(log.encode()))
+        """
+        if stream not in ("stdout", "stderr"):
+            raise ValueError(f"stream must be 'stdout' or 'stderr', not {stream!r}")
+
+        response = self.session.get(
+            f"{self.base_url}/api/v1/executions/{execution_id}/{stream}",
+            headers={"Range": f"bytes={offset}-"} if offset > 0 else None,
+            timeout=self.timeout,
+        )
+        if response.status_code == 416:
+            return ""
+        response.raise_for_status()
+
+        return response.content.decode("utf-8", errors="replace")
+
+    def read_output(
+        self,
+        execution_id: str,
+        stream: str = "stdout",
+        offset: int = 0,
+        limit: int = 0,
+        unit: str = "bytes",
+        with_timestamps: bool = False,
+    ) -> OutputChunk:
+        """Read a chunk of an execution's stdout or stderr.
+
+        Pass each chunk's next_offset as the next offset to read a log piece
+        by piece. After an error, reading again from the last next_offset
+        continues exactly where the previous chunk ended, without repeating
+        or skipping output.
+
+        Args:
+            execution_id: The execution ID.
+            stream: "stdout" or "stderr".
+            offset: Where to start, in units.
+            limit: Most units to return (0 for up to the end).
+            unit: "bytes" or "lines".
+            with_timestamps: Prefix each line with the time it was emitted,
+                if the execution was submitted with config.record_timestamps.
+                Offsets then count the prefixed text.
+
+        Returns:
+            OutputChunk: The chunk and the offset to continue from.
+
+        Raises:
+            ValueError: If stream or unit is invalid.
+            requests.HTTPError: If the execution is not found (404) or server error.
+
+        Example:
+            >>> offset = 0
+            >>> while True:
+            ...     chunk = client.read_output(exec_id, offset=offset, limit=1 << 20)
+            ...     print(chunk.data, end="")
+            ...     if chunk.complete:
+            ...         break
+            ...     offset = chunk.next_offset
+        """
+        if stream not in ("stdout", "stderr"):
+            raise ValueError(f"stream must be 'stdout' or 'stderr', not {stream!r}")
+        if unit not in ("bytes", "lines"):
+            raise ValueError(f"unit must be 'bytes' or 'lines', not {unit!r}")
+
+        params = {"offset": offset, "unit": unit}
+        if limit > 0:
+            params["limit"] = limit
+        if with_timestamps:
+            params["with_timestamps"] = "true"
+
+        response = self.session.get(
+            f"{self.base_url}/api/v1/executions/{execution_id}/{stream}",
+            params=params,
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return OutputChunk(
+            data=response.content.decode("utf-8", errors="replace"),
+            next_offset=int(response.headers["X-Next-Offset"]),
+            complete=response.headers.get("X-Output-Complete") == "true",
+        )
+
+    def get_artifact(self, execution_id: str, name: str) -> bytes:
+        """Download one of an execution's artifacts.
+
+        Artifacts listed with a url, such as logs spilled because they
+        exceeded the server's inline limit, carry no data in the result
+        and must be fetched with this method.
+
+        Args:
+            execution_id: The execution ID.
+            name: The artifact's name, e.g. "stdout.log".
+
+        Returns:
+            bytes: The artifact's contents.
+
+        Raises:
+            requests.HTTPError: If the execution or artifact is not found (404)
+                or server error.
+
+        Example:
+            >>> result = client.get_execution(exec_id)
+            >>> for artifact in result.artifacts or []:
+            ...     if artifact.url:
+            ...         data = client.get_artifact(exec_id, artifact.name)
+        """
+        response = self.session.get(
+            f"{self.base_url}/api/v1/executions/{execution_id}/artifacts/{name}",
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return response.content
+
+    def list_artifacts(self, execution_id: str) -> List[Artifact]:
+        """List an execution's artifacts without their contents.
+
+        These are the files collected from the output directory with
+        ExecutionConfig.collect_artifacts, along with any images, coverage
+        reports and spilled logs.
+
+        Args:
+            execution_id: The execution ID.
+
+        Returns:
+            List[Artifact]: The artifacts, each with a url and no data.
+
+        Raises:
+            requests.HTTPError: If the execution is not found (404) or
+                server error.
+        """
+        response = self.session.get(
+            f"{self.base_url}/api/v1/executions/{execution_id}/artifacts",
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return [Artifact.from_dict(a) for a in response.json().get("artifacts", [])]
+
+    def download_artifacts(
+        self, execution_id: str, directory: Union[str, Path]
+    ) -> List[Artifact]:
+        """Save all of an execution's artifacts under a local directory.
+
+        The directory and any subdirectories are created as needed; a file
+        collected from /work/output/plots/loss.png is saved as
+        directory/output/plots/loss.png.
+
+        Args:
+            execution_id: The execution ID.
+            directory: Directory to save the artifacts under.
+
+        Returns:
+            List[Artifact]: The artifacts saved.
+
+        Raises:
+            requests.HTTPError: If the execution is not found (404) or
+                server error.
+            ValueError: If an artifact's name would escape the directory.
+
+        Example:
+            >>> config = ExecutionConfig(collect_artifacts=True)
+            >>> metadata = Metadata(entrypoint="main.py", config=config)
+            >>> result = client.execute_sync(files=files, metadata=metadata)
+            >>> client.download_artifacts(result.execution_id, "results")
+        """
+        root = Path(directory).resolve()
+        artifacts = self.list_artifacts(execution_id)
+        for artifact in artifacts:
+            dest = (root / artifact.name).resolve()
+            if root not in dest.parents:
+                raise ValueError(f"artifact {artifact.name!r}: invalid name")
+            dest.parent.mkdir(parents=True, exist_ok=True)
+            dest.write_bytes(self.get_artifact(execution_id, artifact.name))
+
+        return artifacts
+
     def kill(self, execution_id: str) -> None:
         """Terminate a running execution.
 
         Forcefully stops the Docker container running the Python code.
+        A pending (queued) execution is cancelled before it starts.
 
         Args:
             execution_id: The execution ID to kill.
@@ -262,6 +671,50 @@ class PythonExecutorClient:
         )
         response.raise_for_status()
 
+    def pause(self, execution_id: str) -> ExecutionResult:
+        """Freeze a running execution; its timeout stands still until resume().
+
+        Args:
+            execution_id: The running execution.
+
+        Returns:
+            ExecutionResult: The execution, still running, with paused_at set.
+        """
+        return self._suspend(execution_id, "pause")
+
+    def checkpoint(self, execution_id: str) -> ExecutionResult:
+        """Save a running execution to disk and stop it until resume().
+
+        The server must have checkpoints enabled (PYEXEC_CHECKPOINTS).
+
+        Args:
+            execution_id: The running execution.
+
+        Returns:
+            ExecutionResult: The execution, with paused_at and checkpointed_at set.
+        """
+        return self._suspend(execution_id, "checkpoint")
+
+    def resume(self, execution_id: str) -> ExecutionResult:
+        """Continue a paused execution, or restore a checkpointed one.
+
+        Args:
+            execution_id: The paused or checkpointed execution.
+
+        Returns:
+            ExecutionResult: The execution, running again.
+        """
+        return self._suspend(execution_id, "resume")
+
+    def _suspend(self, execution_id: str, action: str) -> ExecutionResult:
+        response = self.session.post(
+            f"{self.base_url}/api/v1/executions/{execution_id}/{action}",
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return ExecutionResult.from_dict(response.json())
+
     def wait_for_completion(
         self,
         execution_id: str,
@@ -304,10 +757,15 @@ class PythonExecutorClient:
         start_time = time.time()
 
         while True:
-            result = self.get_execution(execution_id)
+            result = self.get_execution(execution_id, fields=["status"])
 
-            if result.status in (ExecutionStatus.COMPLETED, ExecutionStatus.FAILED, ExecutionStatus.KILLED):
-                return result
+            if result.status in (
+                ExecutionStatus.COMPLETED,
+                ExecutionStatus.FAILED,
+                ExecutionStatus.KILLED,
+                ExecutionStatus.CANCELLED,
+            ):
+                return self.get_execution(execution_id)
 
             if max_wait and (time.time() - start_time) > max_wait:
                 raise TimeoutError(f"Execution did not complete within {max_wait}s")
@@ -318,12 +776,20 @@ class PythonExecutorClient:
         self,
         code: str,
         *,
-        files: Optional[list[dict[str, str]]] = None,
+        files: Optional[list[dict[str, Union[str, bytes]]]] = None,
         entrypoint: Optional[str] = None,
         stdin: Optional[str] = None,
         python_version: Optional[str] = None,
         timeout_seconds: Optional[int] = None,
         eval_last_expr: bool = True,
+        auto_install: Optional[bool] = None,
+        packages: Optional[list[str]] = None,
+        retry: Optional[RetryPolicy] = None,
+        group_id: Optional[str] = None,
+        preset: Optional[str] = None,
+        labels: Optional[dict[str, str]] = None,
+        secrets: Optional[list[str]] = None,
+        placement: Optional[dict[str, str]] = None,
     ) -> ExecutionResult:
         """Execute code with REPL-style expression evaluation.
 
@@ -333,8 +799,11 @@ class PythonExecutorClient:
 
         Args:
             code: Python code to execute. Creates a main.py with this content.
-            files: Optional list of file dicts with "name" and "content" keys.
-                Takes precedence over code if provided.
+            files: Optional list of file dicts with "name" and "content" keys,
+                and an optional octal "mode" such as "0755" for scripts run
+                from pre-commands. Takes precedence over code if provided.
+                Binary content may be given as bytes; it is sent
+                base64-encoded.
             entrypoint: File to execute. Defaults to "main.py" or first file.
             stdin: Standard input to provide to the script.
             python_version: Python version to use ("3.10", "3.11", "3.12", "3.13").
@@ -342,6 +811,22 @@ class PythonExecutorClient:
             timeout_seconds: Maximum execution time in seconds.
             eval_last_expr: If True (default), evaluate the last expression and
                 return its value in result. If False, behave like normal execution.
+            auto_install: Detect third-party imports and pip install them
+                (True) or not (False). None uses the server default. The
+                detected packages are listed in result.install.detected.
+            packages: Packages to pip install before the code runs, one
+                requirement specifier each, e.g. ["numpy", "requests==2.31"].
+            retry: Re-run the code when an attempt fails in a way the
+                policy lists. Earlier attempts are listed in result.attempts.
+            group_id: Add the execution to a group, as for Metadata.group_id.
+            preset: One of the server's resource presets, as for
+                Metadata.preset. python_version takes precedence over its
+                image, and timeout_seconds over its timeout.
+            labels: Label the execution, as for Metadata.labels.
+            secrets: Names of server-side secrets to pass to the code, as
+                for Metadata.secrets.
+            placement: Labels the server instance must have, as for
+                Metadata.placement.
 
         Returns:
             ExecutionResult: Object containing stdout, stderr, exit_code, and result.
@@ -383,7 +868,7 @@ class PythonExecutorClient:
         }
 
         if files is not None:
-            payload["files"] = files
+            payload["files"] = [_encode_file(f) for f in files]
         else:
             payload["code"] = code
 
@@ -395,39 +880,866 @@ class PythonExecutorClient:
             payload["python_version"] = python_version
         if timeout_seconds is not None:
             payload["config"] = {"timeout_seconds": timeout_seconds}
+        if auto_install is not None:
+            payload["auto_install"] = auto_install
+        if packages is not None:
+            payload["packages"] = packages
+        if retry is not None:
+            payload["retry"] = retry.to_dict()
+        if group_id is not None:
+            payload["group_id"] = group_id
+        if preset is not None:
+            payload["preset"] = preset
+        if labels is not None:
+            payload["labels"] = labels
+        if secrets is not None:
+            payload["secrets"] = secrets
+        if placement is not None:
+            payload["placement"] = placement
 
         response = self.session.post(
             f"{self.base_url}/api/v1/eval",
             json=payload,
+            timeout=self._sync_timeout_for(timeout_seconds),
+        )
+        return self._sync_result(response)
+
+    def inspect(
+        self,
+        files: Optional[Union[dict[str, str], Path, str]] = None,
+        tar_data: Optional[bytes] = None,
+        metadata: Optional[Metadata] = None,
+    ) -> InspectResult:
+        """Describe an archive without running it.
+
+        Returns the archive's files, total size, the entrypoint that would
+        run and the third-party packages its code imports. Nothing is
+        executed.
+
+        Args:
+            files: Files as for execute_sync().
+            tar_data: Pre-built tar archive bytes (alternative to files).
+            metadata: Optional; names an upload or cached archive to inspect
+                instead, or an entrypoint or mode to check.
+
+        Returns:
+            InspectResult: The archive's contents.
+
+        Example:
+            >>> info = client.inspect(files=Path("./myproject/"))
+            >>> info.entrypoint, info.requirements
+            ('main.py', ['numpy', 'requests'])
+        """
+        if tar_data is None and files is not None:
+            tar_data = self._create_tar(files)
+        if tar_data is None and not (metadata and (metadata.upload_id or metadata.archive_sha256)):
+            raise ValueError("Either files, tar_data, or metadata naming an upload or cached archive must be provided")
+
+        if metadata is not None:
+            parts = self._multipart(tar_data, metadata)
+        else:
+            parts = {"tar": ("code.tar", tar_data, "application/octet-stream")}
+        response = self.session.post(f"{self.base_url}/api/v1/inspect", files=parts, timeout=self.upload_timeout)
+        response.raise_for_status()
+
+        return InspectResult.from_dict(response.json())
+
+    def create_session(
+        self,
+        *,
+        files: Optional[list[dict[str, Union[str, bytes]]]] = None,
+        python_version: Optional[str] = None,
+        docker_image: Optional[str] = None,
+        requirements_txt: Optional[str] = None,
+        pre_commands: Optional[list[str]] = None,
+        env_vars: Optional[list[str]] = None,
+        config: Optional[ExecutionConfig] = None,
+        idle_timeout_seconds: Optional[int] = None,
+    ) -> Session:
+        """Start a persistent session.
+
+        A session is a container running one Python interpreter. Code run
+        with eval_session() keeps its variables and imports from one call
+        to the next. Close the session with close_session() when done;
+        otherwise the server closes it after its idle timeout.
+
+        Args:
+            files: Files written to the session's working directory, as for
+                eval().
+            python_version: Python version to use ("3.10" to "3.13").
+            docker_image: Docker image to use instead.
+            requirements_txt: Packages pip installs before the interpreter
+                starts.
+            pre_commands: Shell commands run before the interpreter starts.
+            env_vars: Environment variables as "KEY=value".
+            config: Limits and network access; timeout_seconds is the
+                default timeout of each eval.
+            idle_timeout_seconds: Close the session after this long without
+                an eval. None uses the server default.
+
+        Returns:
+            Session: The started session.
+
+        Example:
+            >>> session = client.create_session(requirements_txt="pandas")
+            >>> client.eval_session(session.session_id, "import pandas as pd\\ndf = pd.DataFrame({'a': [1, 2]})")
+            >>> client.eval_session(session.session_id, "df['a'].sum()").result
+            '3'
+            >>> client.close_session(session.session_id)
+        """
+        payload: dict = {}
+        if files is not None:
+            payload["files"] = [_encode_file(f) for f in files]
+        if python_version is not None:
+            payload["python_version"] = python_version
+        if docker_image is not None:
+            payload["docker_image"] = docker_image
+        if requirements_txt is not None:
+            payload["requirements_txt"] = requirements_txt
+        if pre_commands is not None:
+            payload["pre_commands"] = pre_commands
+        if env_vars is not None:
+            payload["env_vars"] = env_vars
+        if config is not None:
+            payload["config"] = config.to_dict()
+        if idle_timeout_seconds is not None:
+            payload["idle_timeout_seconds"] = idle_timeout_seconds
+
+        response = self.session.post(f"{self.base_url}/api/v1/sessions", json=payload, timeout=self.timeout)
+        response.raise_for_status()
+
+        return Session.from_dict(response.json())
+
+    def get_session(self, session_id: str) -> Session:
+        """Return a session's state, including when it expires."""
+        response = self.session.get(f"{self.base_url}/api/v1/sessions/{session_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Session.from_dict(response.json())
+
+    def eval_session(self, session_id: str, code: str, timeout_seconds: Optional[int] = None) -> SessionEvalResult:
+        """Run code in a session.
+
+        Variables and imports from earlier calls are still defined. If the
+        last statement is an expression, the repr() of its value is
+        returned in result. An exception, or running past timeout_seconds,
+        is reported in error and leaves the session usable.
+        """
+        payload: dict = {"code": code}
+        if timeout_seconds is not None:
+            payload["timeout_seconds"] = timeout_seconds
+
+        response = self.session.post(
+            f"{self.base_url}/api/v1/sessions/{session_id}/eval",
+            json=payload,
+            timeout=self._sync_timeout_for(timeout_seconds),
+        )
+        response.raise_for_status()
+
+        return SessionEvalResult.from_dict(response.json())
+
+    def close_session(self, session_id: str) -> None:
+        """Close a session and remove its container."""
+        response = self.session.delete(f"{self.base_url}/api/v1/sessions/{session_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+    def run_pipeline(self, steps: list[dict]) -> Pipeline:
+        """Start a pipeline of executions run in dependency order.
+
+        Each step is a dict with a "name", optionally the "depends_on" list
+        of steps it waits for, and the fields of an eval() request: "code"
+        or "files", "entrypoint", "python_version", "requirements_txt",
+        "config" and so on. A step starts once its dependencies have
+        completed with exit code 0, and finds the files each wrote to
+        /work/output in /work/inputs/<name>. Independent steps run in
+        parallel. Returns at once; use wait_for_pipeline() to wait.
+
+        Example:
+            >>> p = client.run_pipeline([
+            ...     {"name": "prep", "code": "open('/work/output/rows.csv', 'w').write('a,b')"},
+            ...     {"name": "train", "depends_on": ["prep"], "code": "print(open('inputs/prep/rows.csv').read())"},
+            ... ])
+            >>> client.wait_for_pipeline(p.pipeline_id).status
+            <ExecutionStatus.COMPLETED: 'completed'>
+        """
+        payload_steps = []
+        for step in steps:
+            step = dict(step)
+            if isinstance(step.get("config"), ExecutionConfig):
+                step["config"] = step["config"].to_dict()
+            if isinstance(step.get("retry"), RetryPolicy):
+                step["retry"] = step["retry"].to_dict()
+            if step.get("files") is not None:
+                step["files"] = [_encode_file(f) for f in step["files"]]
+            payload_steps.append(step)
+
+        response = self.session.post(
+            f"{self.base_url}/api/v1/pipelines",
+            json={"steps": payload_steps},
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return Pipeline.from_dict(response.json())
+
+    def get_pipeline(self, pipeline_id: str) -> Pipeline:
+        """Return a pipeline's status and the state of its steps."""
+        response = self.session.get(f"{self.base_url}/api/v1/pipelines/{pipeline_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Pipeline.from_dict(response.json())
+
+    def cancel_pipeline(self, pipeline_id: str) -> Pipeline:
+        """Kill a pipeline's running steps and cancel those not yet started."""
+        response = self.session.delete(f"{self.base_url}/api/v1/pipelines/{pipeline_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Pipeline.from_dict(response.json())
+
+    def wait_for_pipeline(
+        self,
+        pipeline_id: str,
+        poll_interval: float = 2.0,
+        max_wait: Optional[float] = None,
+    ) -> Pipeline:
+        """Wait for a pipeline's last step to finish.
+
+        Raises:
+            TimeoutError: If max_wait seconds pass first.
+        """
+        start_time = time.time()
+
+        while True:
+            pipeline = self.get_pipeline(pipeline_id)
+            if pipeline.status != ExecutionStatus.RUNNING:
+                return pipeline
+
+            if max_wait and (time.time() - start_time) > max_wait:
+                raise TimeoutError(f"Pipeline did not finish within {max_wait}s")
+
+            time.sleep(poll_interval)
+
+    def tool_schema(self, name: Optional[str] = None) -> dict:
+        """Return the eval endpoint described as a tool for LLM function
+        calling, in OpenAI's format.
+
+        The arguments of each call the model makes are an /eval request
+        body; run them with eval_tool_call().
+
+        Args:
+            name: The function's name. None means "execute_python".
+
+        Example:
+            >>> tools = [client.tool_schema()]
+            >>> # When the model calls the function:
+            >>> result = client.eval_tool_call(tool_call.function.arguments)
+        """
+        params = {"name": name} if name else None
+        response = self.session.get(f"{self.base_url}/api/v1/tool-schema", params=params, timeout=self.timeout)
+        response.raise_for_status()
+
+        return response.json()
+
+    def eval_tool_call(self, arguments: Union[str, dict]) -> ExecutionResult:
+        """Run the arguments of a call to the tool from tool_schema().
+
+        Args:
+            arguments: The call's arguments, as the JSON string the model
+                produced or already decoded.
+
+        Returns:
+            ExecutionResult: As for eval().
+        """
+        if isinstance(arguments, str):
+            arguments = json.loads(arguments)
+
+        response = self.session.post(f"{self.base_url}/api/v1/eval", json=arguments, timeout=self.timeout)
+        return self._sync_result(response)
+
+    def get_group(self, group_id: str) -> Group:
+        """Return the aggregate status of the executions submitted with
+        group_id and their results, oldest first.
+
+        Example:
+            >>> for path in ["job_a.py", "job_b.py"]:
+            ...     client.execute_async(files=path, group_id="batch-42")
+            >>> client.get_group("batch-42").counts
+            {'running': 2}
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/groups/{group_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Group.from_dict(response.json())
+
+    def kill_group(self, group_id: str) -> Group:
+        """Kill a group's running executions and cancel its pending ones."""
+        response = self.session.delete(f"{self.base_url}/api/v1/groups/{group_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Group.from_dict(response.json())
+
+    def get_usage(self, tenant: Optional[str] = None, period: Optional[str] = None) -> UsageReport:
+        """Return the resources tenants' executions consumed in a period.
+
+        Args:
+            tenant: Tenant to report. Every tenant with usage if omitted.
+            period: A UTC day ("2026-01-15") or month ("2026-01"). The current
+                month if omitted.
+
+        Example:
+            >>> report = client.get_usage(period="2026-01")
+            >>> for u in report.tenants:
+            ...     print(u.tenant, u.executions, u.cpu_seconds)
+        """
+        params = {}
+        if tenant:
+            params["tenant"] = tenant
+        if period:
+            params["period"] = period
+        response = self.session.get(f"{self.base_url}/api/v1/usage", params=params, timeout=self.timeout)
+        response.raise_for_status()
+
+        return UsageReport.from_dict(response.json())
+
+    def get_status(self) -> ServerStatus:
+        """Return the state and load of the server instance that answers.
+
+        Behind a load balancer this may be any replica.
+
+        Example:
+            >>> status = client.get_status()
+            >>> print(status.node, status.load.saturation, status.load.queued)
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/admin/status", timeout=self.timeout)
+        response.raise_for_status()
+
+        return ServerStatus.from_dict(response.json())
+
+    def list_approvals(self) -> list[Approval]:
+        """Return the executions held by the server's approval rules, oldest first.
+
+        Example:
+            >>> for a in client.list_approvals():
+            ...     print(a.execution_id, a.tenant, a.reason)
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/admin/approvals", timeout=self.timeout)
+        response.raise_for_status()
+
+        return [Approval.from_dict(a) for a in response.json().get("approvals") or []]
+
+    def approve_execution(self, execution_id: str) -> ExecutionResult:
+        """Queue an execution awaiting approval; it then runs like any async execution.
+
+        Args:
+            execution_id: The held execution.
+
+        Returns:
+            ExecutionResult: The execution, now pending.
+        """
+        response = self.session.post(
+            f"{self.base_url}/api/v1/admin/approvals/{execution_id}/approve",
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return ExecutionResult.from_dict(response.json())
+
+    def reject_execution(self, execution_id: str, reason: Optional[str] = None) -> ExecutionResult:
+        """Cancel an execution awaiting approval without running it.
+
+        Args:
+            execution_id: The held execution.
+            reason: Added to the execution's error, for its submitter.
+
+        Returns:
+            ExecutionResult: The execution, now cancelled with
+            termination_reason "rejected".
+        """
+        response = self.session.post(
+            f"{self.base_url}/api/v1/admin/approvals/{execution_id}/reject",
+            json={"reason": reason} if reason else {},
             timeout=self.timeout,
         )
         response.raise_for_status()
 
         return ExecutionResult.from_dict(response.json())
 
+    def backup(self, path: Union[Path, str]) -> None:
+        """Save a gzip-compressed backup of the server's executions and templates.
+
+        Args:
+            path: File to write the backup to, for restore() on any server.
+        """
+        response = self.session.get(
+            f"{self.base_url}/api/v1/admin/backup",
+            stream=True,
+            timeout=self.upload_timeout,
+        )
+        response.raise_for_status()
+
+        with open(path, "wb") as f:
+            for chunk in response.iter_content(chunk_size=1024 * 1024):
+                f.write(chunk)
+
+    def restore(self, path: Union[Path, str], overwrite: bool = False) -> RestoreResult:
+        """Load a backup saved by backup() into the server.
+
+        Executions that had not finished when the backup was taken are
+        restored as failed.
+
+        Args:
+            path: The backup file.
+            overwrite: Replace executions and templates the server already
+                has, rather than skipping them.
+
+        Returns:
+            RestoreResult: How many executions and templates were restored.
+        """
+        with open(path, "rb") as f:
+            response = self.session.post(
+                f"{self.base_url}/api/v1/admin/restore",
+                params={"overwrite": "true" if overwrite else "false"},
+                data=f,
+                headers={"Content-Type": "application/gzip"},
+                timeout=self.upload_timeout,
+            )
+        response.raise_for_status()
+
+        return RestoreResult.from_dict(response.json())
+
+    def list_presets(self) -> list[Preset]:
+        """Return the server's resource presets by name.
+
+        Example:
+            >>> [p.name for p in client.list_presets()]
+            ['gpu-large', 'small']
+            >>> client.eval("import torch; torch.cuda.is_available()", preset="gpu-large")
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/presets", timeout=self.timeout)
+        response.raise_for_status()
+
+        return [Preset.from_dict(p) for p in response.json().get("presets") or []]
+
+    def list_secrets(self) -> list[str]:
+        """Return the names of the secrets registered on the server.
+
+        Pass them to a script with Metadata.secrets or eval(secrets=...);
+        their values never leave the server.
+
+        Example:
+            >>> client.list_secrets()
+            ['DB_PASSWORD', 'OPENAI_API_KEY']
+            >>> client.eval("import os; len(os.environ['OPENAI_API_KEY']) > 0",
+            ...             secrets=["OPENAI_API_KEY"])
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/secrets", timeout=self.timeout)
+        response.raise_for_status()
+
+        return list(response.json().get("secrets") or [])
+
+    def put_template(
+        self,
+        name: str,
+        request: dict,
+        *,
+        description: Optional[str] = None,
+        params: Optional[list[TemplateParam]] = None,
+    ) -> Template:
+        """Store a script under a name, replacing any template of that name.
+
+        Args:
+            name: The template's name: up to 64 letters, digits, '.', '_'
+                and '-'.
+            request: The fields of the eval() request each run makes, as for
+                a run_pipeline() step: "code" or "files", "entrypoint",
+                "stdin", "config" and so on.
+            description: What the template does, for the people and agents
+                choosing one.
+            params: The parameters it takes. Each {{name}} in the code, text
+                files and stdin is replaced with the parameter's value.
+
+        Example:
+            >>> client.put_template(
+            ...     "daily-report",
+            ...     {"code": "import report\nreport.build('{{region}}')"},
+            ...     params=[TemplateParam("region", required=True)],
+            ... )
+            >>> client.run_template("daily-report", {"region": "eu"}).stdout
+        """
+        payload = dict(request)
+        if isinstance(payload.get("config"), ExecutionConfig):
+            payload["config"] = payload["config"].to_dict()
+        if isinstance(payload.get("retry"), RetryPolicy):
+            payload["retry"] = payload["retry"].to_dict()
+        if payload.get("files") is not None:
+            payload["files"] = [_encode_file(f) for f in payload["files"]]
+        if description is not None:
+            payload["description"] = description
+        if params is not None:
+            payload["params"] = [p.to_dict() for p in params]
+
+        response = self.session.put(f"{self.base_url}/api/v1/templates/{name}", json=payload, timeout=self.timeout)
+        response.raise_for_status()
+
+        return Template.from_dict(response.json())
+
+    def get_template(self, name: str) -> Template:
+        """Return a template, with its code and files."""
+        response = self.session.get(f"{self.base_url}/api/v1/templates/{name}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Template.from_dict(response.json())
+
+    def list_templates(self) -> list[Template]:
+        """Return the stored templates by name, without their code, files or stdin."""
+        response = self.session.get(f"{self.base_url}/api/v1/templates", timeout=self.timeout)
+        response.raise_for_status()
+
+        return [Template.from_dict(t) for t in response.json().get("templates") or []]
+
+    def delete_template(self, name: str) -> None:
+        """Remove a template."""
+        response = self.session.delete(f"{self.base_url}/api/v1/templates/{name}", timeout=self.timeout)
+        response.raise_for_status()
+
+    def render_template(self, name: str, params: Optional[dict[str, str]] = None) -> dict:
+        """Return the eval() request a run of a template with these
+        parameters would make, without running it."""
+        response = self.session.post(
+            f"{self.base_url}/api/v1/templates/{name}/render",
+            json={"params": params or {}},
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return response.json()
+
+    def run_template(
+        self,
+        name: str,
+        params: Optional[dict[str, str]] = None,
+        group_id: Optional[str] = None,
+    ) -> ExecutionResult:
+        """Run a template and wait for the result, as eval() does.
+
+        Args:
+            name: The template to run.
+            params: Values of its parameters, by name. Parameters left out
+                take their defaults.
+            group_id: Add the execution to a group, in place of the template's.
+
+        Raises:
+            requests.HTTPError: 400 if a required parameter is missing or an
+                unknown one is given, 404 if there is no such template.
+        """
+        response = self.session.post(
+            f"{self.base_url}/api/v1/templates/{name}/run",
+            json=self._template_run(params, group_id, False),
+            timeout=self.sync_timeout,
+        )
+        return self._sync_result(response)
+
+    def run_template_async(
+        self,
+        name: str,
+        params: Optional[dict[str, str]] = None,
+        group_id: Optional[str] = None,
+    ) -> str:
+        """Queue a run of a template and return its execution ID at once, as
+        execute_async() does. Arguments are as for run_template()."""
+        response = self.session.post(
+            f"{self.base_url}/api/v1/templates/{name}/run",
+            json=self._template_run(params, group_id, True),
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return response.json()["execution_id"]
+
+    def upload_archive(
+        self,
+        archive: Union[bytes, Path, str],
+        upload_id: Optional[str] = None,
+        chunk_size: int = 8 * 1024 * 1024,
+        retries: int = 5,
+        retry_delay: float = 1.0,
+    ) -> str:
+        """Upload a large archive in chunks, resuming after failures.
+
+        Each failed chunk is retried from wherever the server says the
+        upload got to, so a dropped connection only costs the chunk in
+        flight. The upload is checked against the archive's SHA-256 before
+        it is completed. Run it by passing the returned ID as upload_id to
+        execute_sync() or execute_async(), with an explicit entrypoint.
+
+        Args:
+            archive: The archive (tar or tar.gz) as bytes or a file path.
+            upload_id: Resume this earlier upload of the same archive
+                instead of starting a new one.
+            chunk_size: Bytes sent per request.
+            retries: Consecutive failures of a chunk before giving up.
+            retry_delay: Seconds to wait before each retry.
+
+        Returns:
+            str: The ID of the completed upload.
+
+        Raises:
+            requests.RequestException: If a chunk still fails after the
+                retries; resume by passing the upload's ID as upload_id.
+
+        Example:
+            >>> upload_id = client.upload_archive("project.tar.gz")
+            >>> result = client.execute_sync(upload_id=upload_id, entrypoint="main.py")
+        """
+        if isinstance(archive, (bytes, bytearray)):
+            f = io.BytesIO(archive)
+        else:
+            f = open(archive, "rb")
+
+        with f:
+            digest = hashlib.sha256()
+            for block in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(block)
+            size = f.tell()
+
+            upload = self.get_upload(upload_id) if upload_id else self.create_upload()
+            failures = 0
+            while not upload.complete and upload.offset < size:
+                f.seek(upload.offset)
+                chunk = f.read(chunk_size)
+                try:
+                    upload = self.upload_chunk(upload.upload_id, upload.offset, chunk)
+                    failures = 0
+                except requests.RequestException:
+                    failures += 1
+                    if failures > retries:
+                        raise
+                    time.sleep(retry_delay)
+                    # Part of the chunk may have arrived, so ask where to resume
+                    try:
+                        upload = self.get_upload(upload.upload_id)
+                    except requests.RequestException:
+                        pass
+
+        self.complete_upload(upload.upload_id, digest.hexdigest())
+        return upload.upload_id
+
+    def has_archive(self, sha256: str) -> bool:
+        """Report whether the server has cached an archive.
+
+        Archives are cached by the hex SHA-256 of their bytes as sent, from
+        earlier executions and completed uploads. Run a cached archive by
+        passing archive_sha256 (and an entrypoint) instead of files or
+        tar_data. Looking an archive up keeps it cached for longer.
+
+        Args:
+            sha256: Hex SHA-256 of the archive.
+
+        Returns:
+            bool: True if the archive is cached.
+
+        Example:
+            >>> digest = hashlib.sha256(tar_bytes).hexdigest()
+            >>> if client.has_archive(digest):
+            ...     result = client.execute_sync(archive_sha256=digest, entrypoint="main.py")
+        """
+        response = self.session.get(f"{self.base_url}/api/v1/archives/{sha256}", timeout=self.timeout)
+        if response.status_code == 404:
+            return False
+        response.raise_for_status()
+
+        return True
+
+    def sync_directory(self, path: Union[Path, str]) -> str:
+        """Upload only the files of a directory the server doesn't have.
+
+        The server builds an archive of the directory from the files it
+        already holds plus the ones uploaded, and caches it. Each file's
+        hash is remembered along with its size and modification time, so a
+        repeat sync of a large directory only reads the files that changed
+        and only uploads those the server lacks. The archive holds the
+        directory's regular files with their permissions; empty directories
+        are left out. The server must have its archive cache enabled.
+
+        Args:
+            path: The directory to sync.
+
+        Returns:
+            str: The hex SHA-256 of the archive, to pass as archive_sha256 to
+            execute_sync() or execute_async(), with an explicit entrypoint.
+
+        Example:
+            >>> digest = client.sync_directory("./myproject")
+            >>> result = client.execute_sync(archive_sha256=digest, entrypoint="main.py")
+        """
+        root = Path(path)
+        if not root.is_dir():
+            raise ValueError(f"Not a directory: {root}")
+
+        files = []
+        paths = {}
+        for file_path in sorted(root.rglob("*")):
+            if not file_path.is_file():
+                continue
+            digest = self._hash_file(file_path)
+            files.append({
+                "name": file_path.relative_to(root).as_posix(),
+                "sha256": digest,
+                "mode": f"{file_path.stat().st_mode & 0o777:04o}",
+            })
+            paths[digest] = file_path
+        if not files:
+            raise ValueError(f"No files in {root}")
+
+        # A file the server had can expire before the archive is made, so
+        # that is retried once
+        for attempt in range(2):
+            for digest in self.find_missing_files(list(paths)):
+                self.upload_file(digest, paths[digest].read_bytes())
+            try:
+                return self.create_archive(files)
+            except requests.HTTPError as e:
+                if attempt > 0 or e.response is None or e.response.status_code != 409:
+                    raise
+
+    def find_missing_files(self, sha256s: List[str]) -> List[str]:
+        """Return the hex SHA-256 digests of the files the server doesn't hold."""
+        response = self.session.post(
+            f"{self.base_url}/api/v1/files/missing",
+            json={"sha256": sha256s},
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return response.json().get("missing", [])
+
+    def upload_file(self, sha256: str, data: bytes) -> None:
+        """Store a file's contents on the server under their hex SHA-256,
+        for create_archive() to build archives from."""
+        response = self.session.put(
+            f"{self.base_url}/api/v1/files/{sha256}",
+            data=data,
+            headers={"Content-Type": "application/octet-stream"},
+            timeout=self.upload_timeout,
+        )
+        response.raise_for_status()
+
+    def create_archive(self, files: List[dict]) -> str:
+        """Have the server build and cache an archive from uploaded files.
+
+        Args:
+            files: Dicts with the "name", "sha256" and optionally octal
+                "mode" of each file.
+
+        Returns:
+            str: The hex SHA-256 of the archive.
+
+        Raises:
+            requests.HTTPError: With status 409 if the server is missing
+                some of the files; the response lists them.
+        """
+        response = self.session.post(
+            f"{self.base_url}/api/v1/archives",
+            json={"files": files},
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return response.json()["sha256"]
+
+    def _hash_file(self, path: Path) -> str:
+        """Return the SHA-256 of a file, reading it only if its size or
+        modification time changed since it was last hashed."""
+        key = str(path.resolve())
+        st = path.stat()
+        cached = self._file_hashes.get(key)
+        if cached and cached[0] == st.st_size and cached[1] == st.st_mtime_ns:
+            return cached[2]
+
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            for block in iter(lambda: f.read(1024 * 1024), b""):
+                digest.update(block)
+        self._file_hashes[key] = (st.st_size, st.st_mtime_ns, digest.hexdigest())
+        return digest.hexdigest()
+
+    def create_upload(self) -> Upload:
+        """Start a chunked archive upload. Most callers want upload_archive()."""
+        response = self.session.post(f"{self.base_url}/api/v1/uploads", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Upload.from_dict(response.json())
+
+    def get_upload(self, upload_id: str) -> Upload:
+        """Return the state of an upload, including where the next chunk starts."""
+        response = self.session.get(f"{self.base_url}/api/v1/uploads/{upload_id}", timeout=self.timeout)
+        response.raise_for_status()
+
+        return Upload.from_dict(response.json())
+
+    def upload_chunk(self, upload_id: str, offset: int, chunk: bytes) -> Upload:
+        """Append a chunk to an upload. offset must equal the bytes the
+        server already has; see get_upload()."""
+        response = self.session.put(
+            f"{self.base_url}/api/v1/uploads/{upload_id}",
+            params={"offset": offset},
+            data=chunk,
+            headers={"Content-Type": "application/octet-stream"},
+            timeout=self.upload_timeout,
+        )
+        response.raise_for_status()
+
+        return Upload.from_dict(response.json())
+
+    def complete_upload(self, upload_id: str, sha256: Optional[str] = None) -> Upload:
+        """Complete an upload so it can be run. If sha256 is given the server
+        only completes it if the received bytes match."""
+        payload = {"sha256": sha256} if sha256 else {}
+        response = self.session.post(
+            f"{self.base_url}/api/v1/uploads/{upload_id}/complete",
+            json=payload,
+            timeout=self.timeout,
+        )
+        response.raise_for_status()
+
+        return Upload.from_dict(response.json())
+
+    def delete_upload(self, upload_id: str) -> None:
+        """Delete an upload and the data sent for it."""
+        response = self.session.delete(f"{self.base_url}/api/v1/uploads/{upload_id}", timeout=self.timeout)
+        response.raise_for_status()
+
     def _prepare_request(
         self,
         files: Optional[Union[dict[str, str], Path, str]],
         tar_data: Optional[bytes],
         metadata: Optional[Metadata],
         **kwargs,
-    ) -> tuple[bytes, Metadata]:
+    ) -> tuple[Optional[bytes], Metadata]:
         """Prepare tar archive and metadata for an API request.
 
         Internal method that handles the various input formats and constructs
-        the tar archive and Metadata object needed for the API.
+        the tar archive and Metadata object needed for the API. The archive is
+        None when the metadata names an upload or cached archive instead.
         """
+        if metadata is not None:
+            by_reference = metadata.upload_id or metadata.archive_sha256
+        else:
+            by_reference = kwargs.get("upload_id") or kwargs.get("archive_sha256")
+
         # Create tar if not provided
-        if tar_data is None:
-            if files is None:
-                raise ValueError("Either files or tar_data must be provided")
+        if tar_data is None and files is not None:
             tar_data = self._create_tar(files)
+        if tar_data is None and not by_reference:
+            raise ValueError("Either files, tar_data, upload_id or archive_sha256 must be provided")
 
         # Create metadata if not provided
         if metadata is None:
             # Detect entrypoint
             entrypoint = kwargs.pop("entrypoint", None)
             if entrypoint is None:
+                if tar_data is None:
+                    raise ValueError("entrypoint must be given when running an upload or cached archive")
                 entrypoint = self._detect_entrypoint(tar_data)
 
             from .types import ExecutionConfig
@@ -437,22 +1749,107 @@ class PythonExecutorClient:
                 requirements_txt=kwargs.pop("requirements_txt", None),
                 pre_commands=kwargs.pop("pre_commands", None),
                 stdin=kwargs.pop("stdin", None),
+                eval_last_expr=kwargs.pop("eval_last_expr", False),
+                upload_id=kwargs.pop("upload_id", None),
+                archive_sha256=kwargs.pop("archive_sha256", None),
+                group_id=kwargs.pop("group_id", None),
+                preset=kwargs.pop("preset", None),
+                labels=kwargs.pop("labels", None),
+                secrets=kwargs.pop("secrets", None),
+                placement=kwargs.pop("placement", None),
                 config=ExecutionConfig(**kwargs) if kwargs else None,
             )
 
         return tar_data, metadata
 
+    def _post_exec(
+        self,
+        endpoint: str,
+        tar_data: Optional[bytes],
+        metadata: Metadata,
+        extra_parts: Optional[dict] = None,
+    ) -> requests.Response:
+        """POST an exec request to the sync, async or sweeps endpoint, with
+        any extra_parts after the archive and metadata.
+
+        With cache_archives, only the archive's hash is sent if the server
+        has it, and the archive itself if not or if the cached copy expired
+        before the request arrived.
+        """
+        url = f"{self.base_url}/api/v1/{endpoint}"
+        if endpoint == "exec/sync":
+            config = metadata.config
+            timeout = self._sync_timeout_for(config.timeout_seconds, config.install_timeout_seconds) if config else self.sync_timeout
+        else:
+            timeout = self.upload_timeout
+        extra_parts = extra_parts or {}
+        if self.cache_archives and tar_data is not None and not metadata.upload_id and not metadata.archive_sha256:
+            digest = hashlib.sha256(tar_data).hexdigest()
+            try:
+                cached = self.has_archive(digest)
+            except requests.RequestException:
+                # A failed lookup just means sending the archive
+                cached = False
+            if cached:
+                by_hash = dataclasses.replace(metadata, archive_sha256=digest)
+                response = self.session.post(url, files={**self._multipart(None, by_hash), **extra_parts}, timeout=timeout)
+                if response.status_code != 404:
+                    return response
+
+        return self.session.post(url, files={**self._multipart(tar_data, metadata), **extra_parts}, timeout=timeout)
+
+    def _sync_timeout_for(self, timeout_seconds: Optional[int], install_timeout_seconds: Optional[int] = None) -> Optional[float]:
+        """Return the requests timeout of a sync call for an execution with
+        these timeouts: sync_timeout, raised to cover them plus _SYNC_MARGIN
+        unless sync_timeout was given."""
+        if self._sync_timeout_set or self.sync_timeout is None or not timeout_seconds:
+            return self.sync_timeout
+        return max(self.sync_timeout, timeout_seconds + (install_timeout_seconds or 0) + _SYNC_MARGIN)
+
+    def _sync_result(self, response: requests.Response) -> ExecutionResult:
+        """Return the result of a sync request.
+
+        If the execution was still running after the server's detach
+        threshold, the server answers 202 with its ID and it is polled
+        until it finishes.
+        """
+        response.raise_for_status()
+        if response.status_code == 202:
+            return self.wait_for_completion(response.json()["execution_id"], poll_interval=1.0)
+
+        return ExecutionResult.from_dict(response.json())
+
+    def _template_run(self, params: Optional[dict[str, str]], group_id: Optional[str], run_async: bool) -> dict:
+        """Build the body of a template run request."""
+        payload: dict = {"params": params or {}}
+        if group_id is not None:
+            payload["group_id"] = group_id
+        if run_async:
+            payload["async"] = True
+        return payload
+
+    def _multipart(self, tar_data: Optional[bytes], metadata: Metadata) -> dict:
+        """Build the multipart parts of an exec request, leaving out the
+        tar part when the metadata names an upload or cached archive."""
+        parts = {}
+        if tar_data is not None:
+            parts["tar"] = ("code.tar", tar_data, "application/octet-stream")
+        parts["metadata"] = (None, json.dumps(metadata.to_dict()), "application/json")
+        return parts
+
     def _create_tar(self, files: Union[dict[str, str], Path, str]) -> bytes:
         """Create tar archive from files."""
         buf = io.BytesIO()
 
         with tarfile.open(fileobj=buf, mode="w") as tar:
             if isinstance(files, dict):
-                # Dict of filename -> content
+                # Dict of filename -> content; scripts starting with a
+                # "#!" line are made executable
                 for filename, content in files.items():
                     info = tarfile.TarInfo(name=filename)
                     content_bytes = content.encode() if isinstance(content, str) else content
                     info.size = len(content_bytes)
+                    info.mode = 0o755 if content_bytes.startswith(b"#!") else 0o644
                     tar.addfile(info, io.BytesIO(content_bytes))
 
             elif isinstance(files, (Path, str)):
@@ -486,3 +1883,19 @@ class PythonExecutorClient:
                 return names[0]
 
         raise ValueError("No Python files found in archive")
+
+
+def _encode_file(file: dict) -> dict:
+    """Base64-encode a /eval file whose content is bytes."""
+    content = file.get("content")
+    if isinstance(content, (bytes, bytearray)):
+        return {**file, "content": base64.b64encode(content).decode("ascii"), "encoding": "base64"}
+    return file
+
+
+def _call_timeout(timeout: Optional[float], default: float) -> Optional[float]:
+    """Return the requests timeout for a kind of call: default if unset,
+    None (no timeout) if 0."""
+    if timeout is None:
+        return default
+    return timeout or None
@@ -3,14 +3,30 @@
 This module contains the data types used by the PythonExecutorClient:
 - ExecutionStatus: Enum for execution states
 - ExecutionConfig: Resource limits and settings
+- RetryPolicy: When and how often a failed execution is re-run
 - Metadata: Execution parameters
+- Progress: Progress reported by a running script
+- InspectResult: Contents of an archive, from inspect()
+- InstallResult: Outcome of the dependency install stage
+- Attempt: A failed attempt of a retried execution
+- Session, SessionEvalResult: Persistent sessions and the code run in them
+- Pipeline, PipelineStepStatus: Pipelines of dependent executions
+- Group: Aggregate status of the executions submitted with a group_id
+- SweepResult, SweepExecution: Executions created by a parameter sweep
+- UsageReport, Usage: Resources consumed by tenants in a day or month
+- ServerStatus, LoadStatus, StorageStats: State, load and storage of a server instance
+- Preset: Named bundles of image and limits defined by the server
+- Template, TemplateParam: Scripts stored on the server and run by name
+- Approval: An execution held for an admin's approval
+- RestoreResult: What a restore took from a backup
 - ExecutionResult: Response from the server
 """
 
+import base64
 from dataclasses import dataclass
 from datetime import datetime
 from enum import Enum
-from typing import Optional
+from typing import Any, Optional
 
 
 class ExecutionStatus(str, Enum):
@@ -22,6 +38,9 @@ class ExecutionStatus(str, Enum):
         COMPLETED: Execution finished successfully (exit code may be non-zero).
         FAILED: Execution failed due to an internal error (not a script error).
         KILLED: Execution was terminated by the user.
+        CANCELLED: Execution was cancelled before it started.
+        AWAITING_APPROVAL: Execution matched one of the server's approval
+            rules and waits for an admin to approve or reject it.
 
     Example:
         >>> result = client.get_execution(exec_id)
@@ -33,6 +52,8 @@ class ExecutionStatus(str, Enum):
     COMPLETED = "completed"
     FAILED = "failed"
     KILLED = "killed"
+    CANCELLED = "cancelled"
+    AWAITING_APPROVAL = "awaiting_approval"
 
 
 @dataclass
@@ -43,10 +64,55 @@ class ExecutionConfig:
 
     Attributes:
         timeout_seconds: Maximum execution time in seconds. Default is 300 (5 min).
+            Pulling the image and installing dependencies are not counted.
+        install_timeout_seconds: Maximum time installing requirements and
+            running pre_commands may take. None uses the server's default.
         network_disabled: If True, the container has no network access. Default is True.
+        install_network_only: If True, network is available only while requirements
+            install; pre_commands then run offline after them, as does the script.
+        freeze_packages: If True, run pip freeze after installing dependencies
+            and return the result in ExecutionResult.install.packages.
+        combined_output: If True, also return stdout and stderr interleaved
+            in the order they were written, in ExecutionResult.output.
+        record_timestamps: If True, record when each output line is emitted,
+            so that output can be read back with_timestamps.
+        strip_ansi: If True, remove ANSI escape sequences (colors, progress
+            bars) from the captured output.
+        capture_images: If True, save matplotlib figures to /work/output on
+            plt.show() and return images written there in
+            ExecutionResult.artifacts.
+        collect_artifacts: If True, keep every file the script writes under
+            output_dir (up to 50MB in total) as an artifact, named by its
+            path relative to /work, e.g. "output/results.csv". The
+            directory is created before the script runs and its path is in
+            the PYEXEC_OUTPUT_DIR environment variable. Download the files
+            with PythonExecutorClient.download_artifacts().
+        output_dir: Directory collect_artifacts collects, absolute or
+            relative to /work. None uses /work/output.
+        coverage: If True, run under coverage.py and return the coverage
+            percentage in ExecutionResult.coverage, with coverage.xml and
+            htmlcov.tar.gz in ExecutionResult.artifacts. coverage must be
+            installed, e.g. via requirements_txt.
+        deterministic: If True, seed PYTHONHASHSEED and the random and numpy
+            generators with seed before the script runs, so that its output
+            is reproducible. os.urandom and uuid4 are unaffected.
+        seed: Seed used when deterministic is set. None uses 0.
+        fake_time: Freeze the clock the script sees at this RFC 3339 time,
+            e.g. "2024-01-01T00:00:00Z", using libfaketime. The image must
+            have libfaketime installed.
         memory_mb: Memory limit in megabytes. Default is 1024 (1 GB).
-        disk_mb: Disk space limit in megabytes. Default is 2048 (2 GB).
+        disk_mb: Disk space limit in megabytes. Default is 2048 (2 GB). An
+            execution that writes more is stopped, with termination_reason
+            "disk_limit_exceeded".
         cpu_shares: CPU shares (relative weight). Default is 1024.
+        blkio_weight: Share of disk I/O relative to other containers, from
+            10 to 1000. None uses the server's default.
+        disk_read_bps: Limit on disk reads in bytes per second. None uses
+            the server's default.
+        disk_write_bps: Limit on disk writes in bytes per second. None uses
+            the server's default.
+        bandwidth_kbps: Limit on HTTP(S) traffic through the server's egress
+            proxy, in kilobits per second. None uses the server's default.
 
     Example:
         >>> config = ExecutionConfig(
@@ -57,20 +123,105 @@ class ExecutionConfig:
         >>> metadata = Metadata(entrypoint="main.py", config=config)
     """
     timeout_seconds: int = 300
+    install_timeout_seconds: Optional[int] = None
     network_disabled: bool = True
+    install_network_only: bool = False
+    freeze_packages: bool = False
+    combined_output: bool = False
+    record_timestamps: bool = False
+    strip_ansi: bool = False
+    capture_images: bool = False
+    collect_artifacts: bool = False
+    output_dir: Optional[str] = None
+    coverage: bool = False
+    deterministic: bool = False
+    seed: Optional[int] = None
+    fake_time: Optional[str] = None
     memory_mb: int = 1024
     disk_mb: int = 2048
     cpu_shares: int = 1024
+    blkio_weight: Optional[int] = None
+    disk_read_bps: Optional[int] = None
+    disk_write_bps: Optional[int] = None
+    bandwidth_kbps: Optional[int] = None
 
     def to_dict(self):
         """Convert to dictionary for JSON serialization."""
-        return {
+        d = {
             "timeout_seconds": self.timeout_seconds,
             "network_disabled": self.network_disabled,
+            "install_network_only": self.install_network_only,
+            "freeze_packages": self.freeze_packages,
+            "combined_output": self.combined_output,
+            "strip_ansi": self.strip_ansi,
+            "record_timestamps": self.record_timestamps,
+            "capture_images": self.capture_images,
+            "coverage": self.coverage,
             "memory_mb": self.memory_mb,
             "disk_mb": self.disk_mb,
             "cpu_shares": self.cpu_shares,
         }
+        if self.install_timeout_seconds is not None:
+            d["install_timeout_seconds"] = self.install_timeout_seconds
+        if self.collect_artifacts:
+            d["collect_artifacts"] = True
+        if self.output_dir is not None:
+            d["output_dir"] = self.output_dir
+        if self.deterministic:
+            d["deterministic"] = True
+        if self.seed is not None:
+            d["seed"] = self.seed
+        if self.fake_time is not None:
+            d["fake_time"] = self.fake_time
+        if self.blkio_weight is not None:
+            d["blkio_weight"] = self.blkio_weight
+        if self.disk_read_bps is not None:
+            d["disk_read_bps"] = self.disk_read_bps
+        if self.disk_write_bps is not None:
+            d["disk_write_bps"] = self.disk_write_bps
+        if self.bandwidth_kbps is not None:
+            d["bandwidth_kbps"] = self.bandwidth_kbps
+        return d
+
+
+@dataclass
+class RetryPolicy:
+    """Re-runs a failed execution under the same execution ID.
+
+    The result reports the last attempt, with the earlier ones in
+    ExecutionResult.attempts.
+
+    Attributes:
+        max_retries: How many times to re-run after the first attempt. The
+            server caps it (PYEXEC_MAX_RETRIES).
+        backoff_seconds: Wait before the first retry; each later retry
+            waits twice as long. Default is 1.
+        max_backoff_seconds: Cap on the wait between attempts. Default is 60.
+        retry_on: Failures to retry: "infra_error" (the service could not
+            run the script, the default), "timeout", "oom",
+            "disk_limit_exceeded", "install_error" and "nonzero_exit".
+
+    Example:
+        >>> metadata = Metadata(
+        ...     entrypoint="main.py",
+        ...     retry=RetryPolicy(max_retries=2, retry_on=["infra_error", "timeout"]),
+        ... )
+    """
+    max_retries: int
+    backoff_seconds: Optional[float] = None
+    max_backoff_seconds: Optional[float] = None
+    retry_on: Optional[list[str]] = None
+
+    def to_dict(self):
+        """Convert to dictionary for JSON serialization."""
+        data: dict = {"max_retries": self.max_retries}
+        if self.backoff_seconds is not None:
+            data["backoff_seconds"] = self.backoff_seconds
+        if self.max_backoff_seconds is not None:
+            data["max_backoff_seconds"] = self.max_backoff_seconds
+        if self.retry_on:
+            data["retry_on"] = self.retry_on
+        return data
 
 
 @dataclass
@@ -87,6 +238,40 @@ class Metadata:
         config: Resource limits. See ExecutionConfig.
         env_vars: Environment variables as "KEY=value" strings.
         script_args: Arguments to pass to the Python script (sys.argv).
+        eval_last_expr: If True, the value of the entrypoint's last expression
+            is returned in ExecutionResult.result.
+        auto_install: If True, the third-party packages imported by the
+            .py files are added to requirements_txt and installed. They are
+            listed in ExecutionResult.install.detected.
+        mode: "pytest" runs pytest on the entrypoint (or on all files if
+            the entrypoint is empty) with script_args as pytest arguments,
+            and returns the parsed results in ExecutionResult.tests.
+            pytest must be installed, e.g. via requirements_txt.
+        upload_id: Runs the archive of a completed chunked upload (see
+            PythonExecutorClient.upload_archive) instead of one sent with the
+            request.
+        archive_sha256: Runs an archive the server has cached, by the hex
+            SHA-256 of its bytes as sent, instead of one sent with the request.
+            See PythonExecutorClient.has_archive.
+        retry: Re-run the execution when an attempt fails in a way the
+            policy lists. See RetryPolicy.
+        group_id: Adds the execution to a group of your choosing (up to 128
+            letters, digits, ".", "_", ":" and "-"), so the whole batch can
+            be followed with get_group() and killed with kill_group().
+        preset: One of the server's resource presets (see
+            PythonExecutorClient.list_presets), which sets the image and the
+            limits left unset. An ExecutionConfig sets all of its limits, so
+            only docker_image is taken from the preset when config is given.
+        labels: Key/value pairs of your choosing that executions can be
+            searched by. Keys are up to 63 letters, digits, ".", "_", "/"
+            and "-"; values up to 256 characters; at most 32 labels.
+        secrets: Names of secrets registered on the server (see
+            PythonExecutorClient.list_secrets) to pass to the script as
+            environment variables of the same names. The values are read
+            by the server and masked in the stored output.
+        placement: Labels a server instance must have to run the
+            execution, e.g. {"gpu": "true"}. Async executions wait in the
+            queue for such an instance; sync ones are refused by others.
 
     Example:
         >>> metadata = Metadata(
@@ -105,6 +290,17 @@ class Metadata:
     config: Optional[ExecutionConfig] = None
     env_vars: Optional[list[str]] = None
     script_args: Optional[list[str]] = None
+    eval_last_expr: bool = False
+    auto_install: bool = False
+    mode: Optional[str] = None
+    upload_id: Optional[str] = None
+    archive_sha256: Optional[str] = None
+    retry: Optional[RetryPolicy] = None
+    group_id: Optional[str] = None
+    preset: Optional[str] = None
+    labels: Optional[dict[str, str]] = None
+    secrets: Optional[list[str]] = None
+    placement: Optional[dict[str, str]] = None
 
     def to_dict(self):
         """Convert to dictionary for JSON serialization."""
@@ -124,10 +320,542 @@ class Metadata:
             data["env_vars"] = self.env_vars
         if self.script_args:
             data["script_args"] = self.script_args
+        if self.eval_last_expr:
+            data["eval_last_expr"] = True
+        if self.auto_install:
+            data["auto_install"] = True
+        if self.mode:
+            data["mode"] = self.mode
+        if self.upload_id:
+            data["upload_id"] = self.upload_id
+        if self.archive_sha256:
+            data["archive_sha256"] = self.archive_sha256
+        if self.retry:
+            data["retry"] = self.retry.to_dict()
+        if self.group_id:
+            data["group_id"] = self.group_id
+        if self.preset:
+            data["preset"] = self.preset
+        if self.labels:
+            data["labels"] = self.labels
+        if self.secrets:
+            data["secrets"] = self.secrets
+        if self.placement:
+            data["placement"] = self.placement
 
         return data
 
 
+@dataclass
+class Progress:
+    """Progress reported by a running script.
+
+    Attributes:
+        percent: Percent complete (0-100), if the script reported one.
+        message: Latest status message, if any.
+        updated_at: When the script last reported (UTC).
+    """
+    percent: Optional[float] = None
+    message: Optional[str] = None
+    updated_at: Optional[datetime] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Progress":
+        """Create a Progress from an API response dictionary."""
+        return cls(
+            percent=data.get("percent"),
+            message=data.get("message"),
+            updated_at=datetime.fromisoformat(data["updated_at"].rstrip("Z")) if data.get("updated_at") else None,
+        )
+
+
+@dataclass
+class Upload:
+    """State of a chunked archive upload.
+
+    Attributes:
+        upload_id: Identifies the upload in later requests and in
+            Metadata.upload_id.
+        offset: Bytes the server has received, where the next chunk starts.
+        complete: True once the upload has been completed and can be run.
+        sha256: Hex SHA-256 digest of a completed upload.
+    """
+    upload_id: str
+    offset: int = 0
+    complete: bool = False
+    sha256: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Upload":
+        """Create an Upload from an API response dictionary."""
+        return cls(
+            upload_id=data["upload_id"],
+            offset=data.get("offset", 0),
+            complete=data.get("complete", False),
+            sha256=data.get("sha256"),
+        )
+
+
+@dataclass
+class InspectedFile:
+    """One entry of an inspected archive.
+
+    Attributes:
+        name: Path in the archive.
+        size: Size in bytes.
+        mode: Octal permissions, e.g. "0644".
+        link: Target of a symlink or hard link.
+    """
+    name: str
+    size: int = 0
+    mode: str = "0644"
+    link: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "InspectedFile":
+        """Create an InspectedFile from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            size=data.get("size", 0),
+            mode=data.get("mode", "0644"),
+            link=data.get("link"),
+        )
+
+
+@dataclass
+class InspectResult:
+    """Description of an archive, returned by inspect() without running it.
+
+    Attributes:
+        files: The archive's files and links in order, without directories.
+        total_size: Sum of the files' sizes in bytes, uncompressed.
+        entrypoint: The script that would run, named or detected; None if
+            there is none, as in pytest mode.
+        requirements: Third-party packages the code imports, or the
+            dependencies a pyproject.toml or Pipfile declares, unpinned.
+    """
+    files: list[InspectedFile]
+    total_size: int = 0
+    entrypoint: Optional[str] = None
+    requirements: Optional[list[str]] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "InspectResult":
+        """Create an InspectResult from an API response dictionary."""
+        return cls(
+            files=[InspectedFile.from_dict(f) for f in data.get("files") or []],
+            total_size=data.get("total_size", 0),
+            entrypoint=data.get("entrypoint") or None,
+            requirements=data.get("requirements") or [],
+        )
+
+
+@dataclass
+class InstallResult:
+    """Outcome of the dependency install stage.
+
+    Requirements and pre_commands run in a separate container before the
+    script. If the install fails, the script does not run.
+
+    Attributes:
+        stdout: Standard output of the install commands.
+        stderr: Standard error of the install commands.
+        exit_code: Exit code of the install commands (0 = success).
+        duration_ms: Install time in milliseconds.
+        packages: Installed packages as "name==version" lines, when
+            freeze_packages was set.
+        detected: Packages added because the code imports them, when
+            imports were detected (auto_install).
+    """
+    stdout: Optional[str] = None
+    stderr: Optional[str] = None
+    exit_code: int = 0
+    duration_ms: int = 0
+    packages: Optional[list[str]] = None
+    detected: Optional[list[str]] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "InstallResult":
+        """Create an InstallResult from an API response dictionary."""
+        return cls(
+            stdout=data.get("stdout"),
+            stderr=data.get("stderr"),
+            exit_code=data.get("exit_code", 0),
+            duration_ms=data.get("duration_ms", 0),
+            packages=data.get("packages"),
+            detected=data.get("detected"),
+        )
+
+
+@dataclass
+class Attempt:
+    """A failed attempt of an execution retried under its RetryPolicy.
+
+    Attributes:
+        attempt: Number of the attempt, from 1 for the first run.
+        failure_kind: How it failed: "infra_error", "timeout", "oom",
+            "disk_limit_exceeded", "install_error" or "nonzero_exit".
+        exit_code: The script's exit code, if it ran.
+        error: The attempt's error message, if any.
+        container_id: The container the attempt ran in, if one was created.
+        started_at: When the attempt started (UTC).
+        finished_at: When the attempt finished (UTC).
+    """
+    attempt: int
+    failure_kind: str
+    exit_code: int = 0
+    error: Optional[str] = None
+    container_id: Optional[str] = None
+    started_at: Optional[datetime] = None
+    finished_at: Optional[datetime] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Attempt":
+        """Create an Attempt from an API response dictionary."""
+        return cls(
+            attempt=data["attempt"],
+            failure_kind=data["failure_kind"],
+            exit_code=data.get("exit_code", 0),
+            error=data.get("error"),
+            container_id=data.get("container_id"),
+            started_at=datetime.fromisoformat(data["started_at"].rstrip("Z")) if data.get("started_at") else None,
+            finished_at=datetime.fromisoformat(data["finished_at"].rstrip("Z")) if data.get("finished_at") else None,
+        )
+
+
+@dataclass
+class Session:
+    """A persistent session, from create_session() or get_session().
+
+    Attributes:
+        session_id: Identifies the session in eval_session() and
+            close_session().
+        docker_image: Image the session runs in.
+        created_at: When the session started (UTC).
+        last_used_at: When the session last ran code, or started (UTC).
+        expires_at: When the session is closed unless it runs code first;
+            None if it has no idle timeout.
+        idle_timeout_seconds: How long the session is kept without an eval.
+        evals: Number of code blocks the session has run.
+        install: Dependency install stage, if there was one.
+    """
+    session_id: str
+    docker_image: Optional[str] = None
+    created_at: Optional[datetime] = None
+    last_used_at: Optional[datetime] = None
+    expires_at: Optional[datetime] = None
+    idle_timeout_seconds: int = 0
+    evals: int = 0
+    install: Optional[InstallResult] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Session":
+        """Create a Session from an API response dictionary."""
+        return cls(
+            session_id=data["session_id"],
+            docker_image=data.get("docker_image"),
+            created_at=datetime.fromisoformat(data["created_at"].rstrip("Z")) if data.get("created_at") else None,
+            last_used_at=datetime.fromisoformat(data["last_used_at"].rstrip("Z")) if data.get("last_used_at") else None,
+            expires_at=datetime.fromisoformat(data["expires_at"].rstrip("Z")) if data.get("expires_at") else None,
+            idle_timeout_seconds=data.get("idle_timeout_seconds", 0),
+            evals=data.get("evals", 0),
+            install=InstallResult.from_dict(data["install"]) if data.get("install") else None,
+        )
+
+
+@dataclass
+class SessionEvalResult:
+    """Outcome of running code in a session with eval_session().
+
+    Attributes:
+        stdout: What the code printed to sys.stdout.
+        stderr: What the code printed to sys.stderr, with the traceback if
+            it raised.
+        result: repr() of the trailing expression's value, or None.
+        error: The exception the code raised, e.g. "NameError: name 'x' is
+            not defined". The session stays usable.
+        error_type: The Python exception type, e.g. "NameError".
+        termination_reason: "timeout" when the code was interrupted for
+            running past its timeout.
+        duration_ms: How long the eval took in milliseconds.
+    """
+    stdout: str = ""
+    stderr: str = ""
+    result: Optional[str] = None
+    error: Optional[str] = None
+    error_type: Optional[str] = None
+    termination_reason: Optional[str] = None
+    duration_ms: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "SessionEvalResult":
+        """Create a SessionEvalResult from an API response dictionary."""
+        return cls(
+            stdout=data.get("stdout", ""),
+            stderr=data.get("stderr", ""),
+            result=data.get("result"),
+            error=data.get("error"),
+            error_type=data.get("error_type"),
+            termination_reason=data.get("termination_reason"),
+            duration_ms=data.get("duration_ms", 0),
+        )
+
+
+@dataclass
+class CPUUsage:
+    """CPU time used by an execution, from its container's cgroup counters.
+
+    Attributes:
+        user_ms: CPU time in user mode, in milliseconds.
+        system_ms: CPU time in the kernel, in milliseconds.
+        throttled_ms: Time held back by the CPU limit, in milliseconds.
+    """
+    user_ms: int = 0
+    system_ms: int = 0
+    throttled_ms: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "CPUUsage":
+        """Create a CPUUsage from an API response dictionary."""
+        return cls(
+            user_ms=data.get("user_ms", 0),
+            system_ms=data.get("system_ms", 0),
+            throttled_ms=data.get("throttled_ms", 0),
+        )
+
+
+@dataclass
+class Timings:
+    """How long each phase of an execution took, in milliseconds.
+
+    A skipped phase, such as pulling an image that was already present,
+    takes 0.
+
+    Attributes:
+        queue_ms: Wait for a free worker (async executions only).
+        pull_ms: Checking for and pulling the Docker image.
+        install_ms: The dependency installation stage.
+        run_ms: The script itself, from container start to exit.
+    """
+    queue_ms: int = 0
+    pull_ms: int = 0
+    install_ms: int = 0
+    run_ms: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Timings":
+        """Create a Timings from an API response dictionary."""
+        return cls(
+            queue_ms=data.get("queue_ms", 0),
+            pull_ms=data.get("pull_ms", 0),
+            install_ms=data.get("install_ms", 0),
+            run_ms=data.get("run_ms", 0),
+        )
+
+
+@dataclass
+class TestCase:
+    """One test case of a pytest run.
+
+    Attributes:
+        name: Test function name, including parameters, e.g. "test_add[1-2]".
+        classname: Dotted module and class path, e.g. "tests.test_math.TestAdd".
+        status: "passed", "failed", "error" or "skipped".
+        duration_ms: How long the test took in milliseconds.
+        message: Short failure, error or skip reason.
+        details: Full failure or error output, e.g. the assertion traceback.
+    """
+    __test__ = False  # not a pytest test class
+
+    name: str
+    status: str
+    classname: Optional[str] = None
+    duration_ms: int = 0
+    message: Optional[str] = None
+    details: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "TestCase":
+        """Create a TestCase from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            status=data["status"],
+            classname=data.get("classname"),
+            duration_ms=data.get("duration_ms", 0),
+            message=data.get("message"),
+            details=data.get("details"),
+        )
+
+
+@dataclass
+class TestReport:
+    """Summary of a pytest run.
+
+    Attributes:
+        total: Number of test cases collected.
+        passed: Number of cases that passed.
+        failed: Number of cases that failed.
+        errors: Number of cases that errored outside the test body, e.g. in a fixture.
+        skipped: Number of cases that were skipped.
+        duration_ms: Time pytest reported for the run in milliseconds.
+        cases: Every test case, in the order pytest ran them.
+    """
+    __test__ = False  # not a pytest test class
+
+    total: int = 0
+    passed: int = 0
+    failed: int = 0
+    errors: int = 0
+    skipped: int = 0
+    duration_ms: int = 0
+    cases: Optional[list[TestCase]] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "TestReport":
+        """Create a TestReport from an API response dictionary."""
+        return cls(
+            total=data.get("total", 0),
+            passed=data.get("passed", 0),
+            failed=data.get("failed", 0),
+            errors=data.get("errors", 0),
+            skipped=data.get("skipped", 0),
+            duration_ms=data.get("duration_ms", 0),
+            cases=[TestCase.from_dict(c) for c in data["cases"]] if data.get("cases") else None,
+        )
+
+
+@dataclass
+class CoverageReport:
+    """Line coverage measured by coverage.py.
+
+    Attributes:
+        percent: Share of lines executed, from 0 to 100.
+        lines_covered: Number of lines executed.
+        lines_valid: Number of executable lines measured.
+    """
+    percent: float = 0.0
+    lines_covered: int = 0
+    lines_valid: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "CoverageReport":
+        """Create a CoverageReport from an API response dictionary."""
+        return cls(
+            percent=data.get("percent", 0.0),
+            lines_covered=data.get("lines_covered", 0),
+            lines_valid=data.get("lines_valid", 0),
+        )
+
+
+@dataclass
+class OutputChunk:
+    """A part of an execution's stdout or stderr, from read_output().
+
+    Attributes:
+        data: Text of the chunk.
+        next_offset: Offset to read the following chunk from.
+        complete: True once the execution has finished and the chunk
+            reaches the end of the stream, so no more output will follow.
+    """
+    data: str
+    next_offset: int
+    complete: bool = False
+
+
+@dataclass
+class Artifact:
+    """A file produced by an execution.
+
+    Attributes:
+        name: File name, e.g. "figure_1.png". Images keep their path
+            relative to /work/output, collected files their path relative
+            to /work, e.g. "output/results.csv".
+        content_type: MIME type, e.g. "image/png".
+        size: Size in bytes.
+        data: File contents. Empty for artifacts with a url.
+        url: Server path to download the artifact from, for artifacts too
+            large to return inline such as spilled logs and collected
+            files. Use
+            PythonExecutorClient.get_artifact() to fetch them.
+    """
+    name: str
+    content_type: str
+    size: int = 0
+    data: bytes = b""
+    url: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Artifact":
+        """Create an Artifact from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            content_type=data["content_type"],
+            size=data.get("size", 0),
+            data=base64.b64decode(data["data"]) if data.get("data") else b"",
+            url=data.get("url"),
+        )
+
+
+@dataclass
+class TracebackFrame:
+    """One frame of a Python traceback.
+
+    Attributes:
+        file: Source file, e.g. "/work/main.py" or "<string>".
+        line: Line number within the file.
+        function: Function name, or "<module>" for top-level code.
+            None for syntax errors.
+        code: The source line, if Python printed it.
+    """
+    file: str
+    line: int
+    function: Optional[str] = None
+    code: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "TracebackFrame":
+        """Create a TracebackFrame from an API response dictionary."""
+        return cls(
+            file=data["file"],
+            line=data["line"],
+            function=data.get("function"),
+            code=data.get("code"),
+        )
+
+
+@dataclass
+class Manifest:
+    """What an execution ran on, for reproducing it later.
+
+    Attributes:
+        image: Docker image as requested, e.g. "python:3.12-slim".
+        image_digest: Repository digest ("python@sha256:..."); use it to
+            pin the exact image. None for locally built images.
+        image_id: Content-addressable image ID.
+        python_version: Python version from the image's PYTHON_VERSION variable.
+        platform: Image OS and architecture, e.g. "linux/amd64".
+        config: Effective execution config after server defaults.
+    """
+    image: str
+    image_digest: Optional[str] = None
+    image_id: Optional[str] = None
+    python_version: Optional[str] = None
+    platform: Optional[str] = None
+    config: Optional[dict] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Manifest":
+        """Create a Manifest from an API response dictionary."""
+        return cls(
+            image=data["image"],
+            image_digest=data.get("image_digest"),
+            image_id=data.get("image_id"),
+            python_version=data.get("python_version"),
+            platform=data.get("platform"),
+            config=data.get("config"),
+        )
+
+
 @dataclass
 class ExecutionResult:
     """Result of a code execution.
@@ -137,16 +865,65 @@ class ExecutionResult:
     Attributes:
         execution_id: Unique identifier for this execution.
         status: Current status (pending, running, completed, failed, killed).
+        phase: Stage of a running execution: "pulling" its image,
+            "installing" dependencies or "running" the script. None once
+            it has finished.
+        queue_position: Place of a pending execution in the queue, 1 for
+            the next to run. None once it has started, or if it is not
+            waiting in the queue.
+        group_id: The group the execution was submitted to, if any.
+        labels: The labels the execution was submitted with, if any.
+        trace_id: Request ID of the submission, which the script sees as
+            PYEXEC_TRACE_ID.
         stdout: Standard output from the Python script.
         stderr: Standard error from the Python script.
+        output: Stdout and stderr interleaved in the order they were written,
+            when combined_output was set.
         exit_code: Process exit code (0 = success, non-zero = error).
         error: Error message if the execution failed internally.
+        error_type: Python exception type (e.g. "NameError") when exit_code != 0.
+        error_line: Line number where the exception was raised.
+        traceback: Frames of the exception that ended the script, outermost first.
+        signal: Signal that terminated the script (e.g. "SIGKILL"), if any.
+        termination_reason: Why the script was stopped: "timeout", "killed"
+            (via the kill API), "oom" (out of memory), "disk_limit_exceeded"
+            (wrote more than disk_mb), "disconnected" (the
+            sync caller went away) or "rejected" (an admin rejected it
+            before it ran).
+        approval_reason: The approval rule the execution matched, if it was
+            held for an admin's approval.
         started_at: When execution started (UTC).
         finished_at: When execution finished (UTC).
         duration_ms: Total execution time in milliseconds.
+        paused_at: When the execution was paused or checkpointed, while it
+            is suspended.
+        paused_ms: Time spent suspended in milliseconds, not counting a
+            suspension still going on. duration_ms includes it; the
+            timeout does not.
+        checkpointed_at: When the execution was last checkpointed to disk.
+        cpu: CPU time the script used; compare with duration_ms to tell
+            CPU-bound, throttled and I/O-bound runs apart.
+        timings: Time spent queued, pulling the image, installing
+            dependencies and running the script.
         result: REPL expression result when eval_last_expr is enabled.
             Contains the repr() of the last expression's value, or None
             if the last statement was not an expression.
+        structured_output: Parsed contents of /work/output/result.json, if
+            the script wrote one.
+        structured_output_error: Why a result.json the script wrote was
+            not returned (e.g. over 1MB or not valid JSON).
+        tests: Parsed pytest results, when mode was "pytest".
+        coverage: Line coverage, when config.coverage was set.
+        artifacts: Collected files: images written to /work/output when
+            capture_images was set, coverage reports when coverage was set,
+            and the full log of any stream cut to the server's inline limit
+            (stdout.log, stderr.log, output.log).
+        progress: Latest progress reported by the script while running.
+        install: Dependency install stage, if requirements or pre_commands were given.
+        manifest: Image and effective config the execution ran with.
+        attempts: Failed attempts before this result's, oldest first, when
+            the execution was retried under metadata.retry. started_at is
+            when the first attempt started.
 
     Example:
         >>> result = client.execute_sync(
@@ -166,14 +943,40 @@ class ExecutionResult:
     """
     execution_id: str
     status: ExecutionStatus
+    phase: Optional[str] = None
+    queue_position: Optional[int] = None
+    group_id: Optional[str] = None
+    labels: Optional[dict[str, str]] = None
+    trace_id: Optional[str] = None
     stdout: Optional[str] = None
     stderr: Optional[str] = None
+    output: Optional[str] = None
     exit_code: Optional[int] = None
     error: Optional[str] = None
+    error_type: Optional[str] = None
+    error_line: Optional[int] = None
+    traceback: Optional[list[TracebackFrame]] = None
+    signal: Optional[str] = None
+    termination_reason: Optional[str] = None
+    approval_reason: Optional[str] = None
     started_at: Optional[datetime] = None
     finished_at: Optional[datetime] = None
     duration_ms: Optional[int] = None
+    paused_at: Optional[datetime] = None
+    paused_ms: Optional[int] = None
+    checkpointed_at: Optional[datetime] = None
+    cpu: Optional[CPUUsage] = None
+    timings: Optional[Timings] = None
     result: Optional[str] = None
+    structured_output: Optional[Any] = None
+    structured_output_error: Optional[str] = None
+    tests: Optional[TestReport] = None
+    coverage: Optional[CoverageReport] = None
+    artifacts: Optional[list[Artifact]] = None
+    progress: Optional[Progress] = None
+    install: Optional[InstallResult] = None
+    manifest: Optional[Manifest] = None
+    attempts: Optional[list[Attempt]] = None
 
     @classmethod
     def from_dict(cls, data: dict) -> "ExecutionResult":
@@ -188,12 +991,547 @@ class ExecutionResult:
         return cls(
             execution_id=data["execution_id"],
             status=ExecutionStatus(data["status"]),
+            phase=data.get("phase"),
+            queue_position=data.get("queue_position"),
+            group_id=data.get("group_id"),
+            labels=data.get("labels"),
+            trace_id=data.get("trace_id"),
             stdout=data.get("stdout"),
             stderr=data.get("stderr"),
+            output=data.get("output"),
             exit_code=data.get("exit_code"),
             error=data.get("error"),
+            error_type=data.get("error_type"),
+            error_line=data.get("error_line"),
+            traceback=[TracebackFrame.from_dict(f) for f in data["traceback"]] if data.get("traceback") else None,
+            signal=data.get("signal"),
+            termination_reason=data.get("termination_reason"),
+            approval_reason=data.get("approval_reason"),
             started_at=datetime.fromisoformat(data["started_at"].rstrip("Z")) if data.get("started_at") else None,
             finished_at=datetime.fromisoformat(data["finished_at"].rstrip("Z")) if data.get("finished_at") else None,
             duration_ms=data.get("duration_ms"),
+            paused_at=datetime.fromisoformat(data["paused_at"].rstrip("Z")) if data.get("paused_at") else None,
+            paused_ms=data.get("paused_ms"),
+            checkpointed_at=datetime.fromisoformat(data["checkpointed_at"].rstrip("Z")) if data.get("checkpointed_at") else None,
+            cpu=CPUUsage.from_dict(data["cpu"]) if data.get("cpu") else None,
+            timings=Timings.from_dict(data["timings"]) if data.get("timings") else None,
             result=data.get("result"),
+            structured_output=data.get("structured_output"),
+            structured_output_error=data.get("structured_output_error"),
+            tests=TestReport.from_dict(data["tests"]) if data.get("tests") else None,
+            coverage=CoverageReport.from_dict(data["coverage"]) if data.get("coverage") else None,
+            artifacts=[Artifact.from_dict(a) for a in data["artifacts"]] if data.get("artifacts") else None,
+            progress=Progress.from_dict(data["progress"]) if data.get("progress") else None,
+            install=InstallResult.from_dict(data["install"]) if data.get("install") else None,
+            manifest=Manifest.from_dict(data["manifest"]) if data.get("manifest") else None,
+            attempts=[Attempt.from_dict(a) for a in data["attempts"]] if data.get("attempts") else None,
+        )
+
+
+@dataclass
+class PipelineStepStatus:
+    """The state of one step of a pipeline.
+
+    Attributes:
+        name: The step's name.
+        depends_on: Steps this one waits for.
+        execution_id: The step's execution, for get_execution(); None until
+            the step starts. Its outputs are the output.tar artifact.
+        status: pending until the step starts; cancelled if it never ran
+            because a dependency failed or the pipeline was cancelled.
+        exit_code: The script's exit code once the step has completed.
+        error: Why the step failed or was cancelled.
+    """
+    name: str
+    status: ExecutionStatus
+    depends_on: Optional[list[str]] = None
+    execution_id: Optional[str] = None
+    exit_code: int = 0
+    error: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "PipelineStepStatus":
+        """Create a PipelineStepStatus from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            status=ExecutionStatus(data["status"]),
+            depends_on=data.get("depends_on"),
+            execution_id=data.get("execution_id") or None,
+            exit_code=data.get("exit_code", 0),
+            error=data.get("error"),
+        )
+
+
+@dataclass
+class Pipeline:
+    """A pipeline, from run_pipeline() or get_pipeline().
+
+    Attributes:
+        pipeline_id: Identifies the pipeline in get_pipeline() and
+            cancel_pipeline().
+        status: running until every step has finished; then completed if
+            every step completed with exit code 0, killed if the pipeline
+            was cancelled, and failed otherwise.
+        steps: The steps' states, in the order they were submitted.
+        created_at: When the pipeline was submitted (UTC).
+        finished_at: When the last step finished (UTC).
+    """
+    pipeline_id: str
+    status: ExecutionStatus
+    steps: list[PipelineStepStatus]
+    created_at: Optional[datetime] = None
+    finished_at: Optional[datetime] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Pipeline":
+        """Create a Pipeline from an API response dictionary."""
+        return cls(
+            pipeline_id=data["pipeline_id"],
+            status=ExecutionStatus(data["status"]),
+            steps=[PipelineStepStatus.from_dict(s) for s in data.get("steps") or []],
+            created_at=datetime.fromisoformat(data["created_at"].rstrip("Z")) if data.get("created_at") else None,
+            finished_at=datetime.fromisoformat(data["finished_at"].rstrip("Z")) if data.get("finished_at") else None,
+        )
+
+
+@dataclass
+class Group:
+    """The executions submitted with one group_id, from get_group().
+
+    Attributes:
+        group_id: The group's ID, as given in Metadata.group_id.
+        status: pending while every execution is pending; running while
+            any is pending or running; then killed if any was killed or
+            cancelled, failed if any failed or exited non-zero, and
+            completed otherwise.
+        total: Number of executions in the group.
+        counts: Number of executions in each status.
+        executions: The executions' results, oldest first.
+    """
+    group_id: str
+    status: ExecutionStatus
+    total: int
+    counts: dict[str, int]
+    executions: list[ExecutionResult]
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Group":
+        """Create a Group from an API response dictionary."""
+        return cls(
+            group_id=data["group_id"],
+            status=ExecutionStatus(data["status"]),
+            total=data.get("total", 0),
+            counts=data.get("counts") or {},
+            executions=[ExecutionResult.from_dict(e) for e in data.get("executions") or []],
+        )
+
+
+@dataclass
+class ExecutionList:
+    """A page of stored executions, newest first, from list_executions().
+
+    Attributes:
+        executions: The page's results, newest first.
+        next_cursor: Pass as cursor to list_executions() for the following
+            page. None on the last page.
+    """
+    executions: list[ExecutionResult]
+    next_cursor: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "ExecutionList":
+        """Create an ExecutionList from an API response dictionary."""
+        return cls(
+            executions=[ExecutionResult.from_dict(e) for e in data.get("executions") or []],
+            next_cursor=data.get("next_cursor") or None,
+        )
+
+
+@dataclass
+class SweepExecution:
+    """One combination of a parameter sweep.
+
+    Attributes:
+        execution_id: The execution running this combination.
+        env: The swept environment variables' values.
+        args: The script arguments appended for this combination.
+    """
+    execution_id: str
+    env: Optional[dict[str, str]] = None
+    args: Optional[list[str]] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "SweepExecution":
+        """Create a SweepExecution from an API response dictionary."""
+        return cls(
+            execution_id=data["execution_id"],
+            env=data.get("env"),
+            args=data.get("args"),
+        )
+
+
+@dataclass
+class SweepResult:
+    """A submitted parameter sweep, from submit_sweep().
+
+    Attributes:
+        group_id: The group holding the sweep's executions, for get_group()
+            and kill_group().
+        executions: The executions created, with their parameters.
+    """
+    group_id: str
+    executions: list[SweepExecution]
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "SweepResult":
+        """Create a SweepResult from an API response dictionary."""
+        return cls(
+            group_id=data["group_id"],
+            executions=[SweepExecution.from_dict(e) for e in data.get("executions") or []],
+        )
+
+
+@dataclass
+class Usage:
+    """The resources a tenant's executions consumed in one period.
+
+    Attributes:
+        tenant: Who submitted the executions; empty in a report's total.
+        period: A UTC day ("2026-01-15") or month ("2026-01").
+        executions: Number of executions that ran.
+        failures: Number of them that did not complete with exit code 0.
+        duration_ms: Their total execution time in milliseconds.
+        cpu_seconds: The CPU time they used.
+        memory_mb_seconds: Their memory limit in MB times their execution
+            time in seconds.
+    """
+    tenant: str
+    period: str
+    executions: int = 0
+    failures: int = 0
+    duration_ms: int = 0
+    cpu_seconds: float = 0.0
+    memory_mb_seconds: float = 0.0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Usage":
+        """Create a Usage from an API response dictionary."""
+        return cls(
+            tenant=data.get("tenant", ""),
+            period=data.get("period", ""),
+            executions=data.get("executions", 0),
+            failures=data.get("failures", 0),
+            duration_ms=data.get("duration_ms", 0),
+            cpu_seconds=data.get("cpu_seconds", 0.0),
+            memory_mb_seconds=data.get("memory_mb_seconds", 0.0),
+        )
+
+
+@dataclass
+class UsageReport:
+    """Usage of one tenant, or every tenant, in a period, from get_usage().
+
+    Attributes:
+        period: The UTC day or month reported.
+        tenants: Each tenant's usage, by tenant name.
+        total: The sum of the tenants' usage.
+    """
+    period: str
+    tenants: list[Usage]
+    total: Usage
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "UsageReport":
+        """Create a UsageReport from an API response dictionary."""
+        return cls(
+            period=data["period"],
+            tenants=[Usage.from_dict(u) for u in data.get("tenants") or []],
+            total=Usage.from_dict(data.get("total") or {}),
+        )
+
+
+@dataclass
+class LoadStatus:
+    """How close a server instance is to its concurrency limit.
+
+    Attributes:
+        running: Executions running on the instance.
+        max_concurrent: Most executions the instance runs at once; 0 means no limit.
+        saturation: running divided by max_concurrent; 0 without a limit.
+        overload_policy: "queue" or "reject": what happens to submissions
+            while every slot is taken.
+        waiting: Sync requests waiting for a slot.
+        max_waiting: Most sync requests that may wait; 0 means no limit.
+        queued: Async executions waiting for a worker, on any instance
+            sharing the queue.
+        max_queue_length: Most async executions that may be queued; 0 means no limit.
+        queue_error: Why queued could not be read, if it could not.
+        rejected: Submissions rejected with 429 since the instance started.
+        throttled: Requests refused with 429 since the instance started
+            because their caller was over its quota.
+    """
+    running: int = 0
+    max_concurrent: int = 0
+    saturation: float = 0.0
+    overload_policy: str = "queue"
+    waiting: int = 0
+    max_waiting: int = 0
+    queued: int = 0
+    max_queue_length: int = 0
+    queue_error: Optional[str] = None
+    rejected: int = 0
+    throttled: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "LoadStatus":
+        """Create a LoadStatus from an API response dictionary."""
+        return cls(
+            running=data.get("running", 0),
+            max_concurrent=data.get("max_concurrent", 0),
+            saturation=data.get("saturation", 0.0),
+            overload_policy=data.get("overload_policy", "queue"),
+            waiting=data.get("waiting", 0),
+            max_waiting=data.get("max_waiting", 0),
+            queued=data.get("queued", 0),
+            max_queue_length=data.get("max_queue_length", 0),
+            queue_error=data.get("queue_error"),
+            rejected=data.get("rejected", 0),
+            throttled=data.get("throttled", 0),
+        )
+
+
+@dataclass
+class StorageStats:
+    """The executions a server stores. Instances sharing Consul storage
+    report the same figures.
+
+    Attributes:
+        executions: Stored executions.
+        by_status: Stored executions in each status, by status name.
+        oldest: When the oldest stored execution was created; None without executions.
+        bytes: Size of the stored execution records.
+        finished: Stored executions that started and have finished.
+        failures: Finished executions that did not complete with exit code 0.
+        duration_ms: Total execution time of the finished executions.
+        error: Why the statistics could not be read, if they could not.
+    """
+    executions: int = 0
+    by_status: Optional[dict[str, int]] = None
+    oldest: Optional[datetime] = None
+    bytes: int = 0
+    finished: int = 0
+    failures: int = 0
+    duration_ms: int = 0
+    error: Optional[str] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "StorageStats":
+        """Create a StorageStats from an API response dictionary."""
+        return cls(
+            executions=data.get("executions", 0),
+            by_status=data.get("by_status") or {},
+            oldest=datetime.fromisoformat(data["oldest"].rstrip("Z")) if data.get("oldest") else None,
+            bytes=data.get("bytes", 0),
+            finished=data.get("finished", 0),
+            failures=data.get("failures", 0),
+            duration_ms=data.get("duration_ms", 0),
+            error=data.get("error"),
+        )
+
+
+@dataclass
+class RestoreResult:
+    """What restore() took from a backup.
+
+    Attributes:
+        executions: Executions restored.
+        templates: Templates restored.
+        skipped: Executions and templates left as they were because the
+            server already had them.
+    """
+    executions: int = 0
+    templates: int = 0
+    skipped: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "RestoreResult":
+        """Create a RestoreResult from an API response dictionary."""
+        return cls(
+            executions=data.get("executions", 0),
+            templates=data.get("templates", 0),
+            skipped=data.get("skipped", 0),
+        )
+
+
+@dataclass
+class ServerStatus:
+    """State and load of a server instance, from get_status().
+
+    Attributes:
+        node: The instance's ID.
+        draining: True once the instance has stopped accepting executions to shut down.
+        in_flight: Executions and requests the instance is handling.
+        load: How busy the instance is.
+        storage: The executions the instance stores.
+        labels: The instance's labels, which Metadata.placement is matched
+            against.
+        memory_mb: The largest memory limit the instance runs executions
+            with; 0 means no limit.
+    """
+    node: str
+    draining: bool
+    in_flight: int
+    load: LoadStatus
+    storage: StorageStats
+    labels: Optional[dict[str, str]] = None
+    memory_mb: int = 0
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "ServerStatus":
+        """Create a ServerStatus from an API response dictionary."""
+        return cls(
+            node=data.get("node", ""),
+            draining=data.get("draining", False),
+            in_flight=data.get("in_flight", 0),
+            load=LoadStatus.from_dict(data.get("load") or {}),
+            storage=StorageStats.from_dict(data.get("storage") or {}),
+            labels=data.get("labels") or {},
+            memory_mb=data.get("memory_mb", 0),
+        )
+
+
+@dataclass
+class Preset:
+    """A named bundle of resources defined by the server's operator, from
+    list_presets(). Fields left as None keep the server defaults.
+
+    Attributes:
+        name: Selects the preset, in Metadata.preset or eval(preset=...).
+        docker_image: The image executions run in.
+        memory_mb: Memory limit in megabytes.
+        cpu_shares: CPU shares (relative weight).
+        disk_mb: Disk space limit in megabytes.
+        timeout_seconds: Maximum execution time in seconds.
+    """
+    name: str
+    docker_image: Optional[str] = None
+    memory_mb: Optional[int] = None
+    cpu_shares: Optional[int] = None
+    disk_mb: Optional[int] = None
+    timeout_seconds: Optional[int] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Preset":
+        """Create a Preset from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            docker_image=data.get("docker_image"),
+            memory_mb=data.get("memory_mb"),
+            cpu_shares=data.get("cpu_shares"),
+            disk_mb=data.get("disk_mb"),
+            timeout_seconds=data.get("timeout_seconds"),
+        )
+
+
+@dataclass
+class TemplateParam:
+    """A parameter of a template.
+
+    Attributes:
+        name: The parameter's name. Each {{name}} in the template's code,
+            text files and stdin is replaced with its value.
+        description: What the parameter is for.
+        default: The value used when a run doesn't give one.
+        required: True if every run must give a value.
+    """
+    name: str
+    description: Optional[str] = None
+    default: Optional[str] = None
+    required: bool = False
+
+    def to_dict(self) -> dict:
+        """Convert to a dictionary for the API request."""
+        d: dict = {"name": self.name}
+        if self.description:
+            d["description"] = self.description
+        if self.default:
+            d["default"] = self.default
+        if self.required:
+            d["required"] = True
+        return d
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "TemplateParam":
+        """Create a TemplateParam from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            description=data.get("description"),
+            default=data.get("default"),
+            required=data.get("required", False),
+        )
+
+
+# Fields of a template that are not part of the eval() request it makes
+_TEMPLATE_FIELDS = ("name", "description", "params", "updated_at")
+
+
+@dataclass
+class Template:
+    """A script stored on the server, from put_template(), get_template()
+    or list_templates().
+
+    Attributes:
+        name: The template's name, used to run it.
+        request: The fields of the eval() request each run makes: "code" or
+            "files", "entrypoint", "stdin", "config" and so on. Empty in
+            list_templates().
+        description: What the template does.
+        params: The parameters the template takes.
+        updated_at: When the template was last stored (UTC).
+    """
+    name: str
+    request: dict
+    description: Optional[str] = None
+    params: Optional[list[TemplateParam]] = None
+    updated_at: Optional[datetime] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Template":
+        """Create a Template from an API response dictionary."""
+        return cls(
+            name=data["name"],
+            request={k: v for k, v in data.items() if k not in _TEMPLATE_FIELDS},
+            description=data.get("description"),
+            params=[TemplateParam.from_dict(p) for p in data["params"]] if data.get("params") else None,
+            updated_at=datetime.fromisoformat(data["updated_at"].rstrip("Z")) if data.get("updated_at") else None,
+        )
+
+
+@dataclass
+class Approval:
+    """An execution held by one of the server's approval rules, from
+    list_approvals().
+
+    Attributes:
+        execution_id: The held execution.
+        tenant: Who submitted it.
+        reason: The approval rule it matched, e.g. "network access enabled".
+        metadata: The metadata it runs with once approved, as sent by the server.
+        created_at: When it was submitted (UTC).
+    """
+    execution_id: str
+    tenant: str
+    reason: str
+    metadata: Optional[dict] = None
+    created_at: Optional[datetime] = None
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "Approval":
+        """Create an Approval from an API response dictionary."""
+        return cls(
+            execution_id=data["execution_id"],
+            tenant=data.get("tenant", ""),
+            reason=data.get("reason", ""),
+            metadata=data.get("metadata"),
+            created_at=datetime.fromisoformat(data["created_at"].rstrip("Z")) if data.get("created_at") else None,
         )